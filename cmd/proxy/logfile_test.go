@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// TestInitLoggerFile tests that file output creates the log file and writes
+// to it in the configured format.
+func TestInitLoggerFile(t *testing.T) {
+	saved, savedLevel := log.Logger, zerolog.GlobalLevel()
+	t.Cleanup(func() {
+		log.Logger = saved
+		zerolog.SetGlobalLevel(savedLevel)
+	})
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", `"message":"written to file"`},
+		{"text", "written to file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "logs", "proxy.log")
+			closer, err := initLogger(config.LoggingConfig{
+				Level:  "info",
+				Format: tt.format,
+				Output: "file",
+				File:   config.FileConfig{Path: path, MaxSize: 100},
+			})
+			if err != nil {
+				t.Fatalf("initLogger() error = %v", err)
+			}
+			log.Info().Str("component", "test").Msg("written to file")
+			if err := closer.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("log file not created: %v", err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("log file = %q, want containing %q", data, tt.want)
+			}
+			if tt.format == "text" && bytes.Contains(data, []byte("\x1b[")) {
+				t.Errorf("log file = %q, want no color codes", data)
+			}
+		})
+	}
+}
+
+// TestRotatingFile tests that the file rotates at MaxSize and that only
+// MaxBackups rotated files are kept.
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "proxy.log")
+	f, err := newRotatingFile(config.FileConfig{Path: path, MaxSize: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+
+	// Each chunk fills most of a megabyte, so every write after the first
+	// rotates
+	chunk := bytes.Repeat([]byte("x"), 700*1024)
+	for i := 0; i < 4; i++ {
+		if _, err := f.Write(chunk); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		// Backup names have millisecond resolution
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "proxy-*.log"))
+	if err != nil {
+		t.Fatalf("Glob() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("backups = %v, want 2 kept", backups)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size() != int64(len(chunk)) {
+		t.Errorf("current file size = %d, want %d", info.Size(), len(chunk))
+	}
+}
+
+// TestRotatingFileAppends tests that an existing file is appended to and
+// counts toward the size limit.
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.log")
+	if err := os.WriteFile(path, []byte("existing\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	f, err := newRotatingFile(config.FileConfig{Path: path, MaxSize: 1})
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	if _, err := f.Write([]byte("appended\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	f.Close()
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "existing\nappended\n" {
+		t.Errorf("log file = %q, want existing content kept", data)
+	}
+	if _, err := f.Write([]byte("late\n")); err == nil {
+		t.Error("Write() after Close() error = nil, want error")
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
-	"strings"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -21,6 +24,7 @@ import (
 	"github.com/agentfacts/mcp-proxy/internal/transport"
 	"github.com/agentfacts/mcp-proxy/internal/transport/sse"
 	"github.com/agentfacts/mcp-proxy/internal/transport/stdio"
+	"github.com/agentfacts/mcp-proxy/internal/transport/ws"
 	"github.com/agentfacts/mcp-proxy/internal/upstream"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -34,14 +38,51 @@ var (
 
 // Application holds all the components of the proxy.
 type Application struct {
-	cfg            *config.Config
+	// cfg is replaced whole, never modified, when the config is reloaded;
+	// reloadMu serializes reloads
+	cfg      atomic.Pointer[config.Config]
+	reloadMu sync.Mutex
+
 	sessionManager *session.Manager
 	router         *router.Router
 	transport      transport.Transport
-	upstreamClient *upstream.Client
+	upstreamClient upstream.Upstream
+	upstreamProber *upstream.Prober
+	shadowClient   upstream.Upstream
 	policyEngine   *policy.Engine
+	policyBackend  policy.PolicyBackend
+	obligations    *policy.ObligationExecutor
+	alertWebhook   *policy.WebhookHandler
+	decisionLog    *policy.DecisionLogger
 	auditStore     *audit.Store
 	auditWriter    *audit.Writer
+	auditSink      audit.RecordSink
+	auditPruner    *audit.Pruner
+
+	// upstreamReconnector reconnects a required upstream that isn't probed
+	upstreamReconnector *upstream.Reconnector
+
+	// policyDerived holds what is derived from the policy data, replaced
+	// whole when the data is reloaded
+	policyDerived atomic.Pointer[derivedPolicyData]
+
+	// responseCache caches read results, if enabled
+	responseCache *router.ResponseCache
+
+	// upstreamBreaker fails upstream requests fast while the upstream keeps
+	// failing, if enabled. A set of named upstreams has a breaker per
+	// upstream instead.
+	upstreamBreaker *upstream.CircuitBreaker
+
+	// stopPolicyWatch stops policy file watching, if enabled
+	stopPolicyWatch context.CancelFunc
+
+	// stopBundlePoll stops remote policy bundle polling, if enabled
+	stopBundlePoll context.CancelFunc
+
+	// policyBundles loads the remote policy bundle, if configured, which
+	// then replaces the local policy files and data
+	policyBundles *policy.BundleLoader
 
 	// Observability
 	metrics   *observability.Metrics
@@ -49,10 +90,21 @@ type Application struct {
 	obsServer *observability.Server
 }
 
+// derivedPolicyData is what the application derives from the policy data
+// outside the policy backend.
+type derivedPolicyData struct {
+	data       *policy.PolicyData // nil when policies are disabled
+	didFilter  *policy.DIDFilter
+	writeTools map[string]bool
+}
+
 func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "config/proxy.yaml", "Path to configuration file")
 	showVersion := flag.Bool("version", false, "Show version information")
+	validateOnly := flag.Bool("validate", false, "Validate configuration and policies, then exit")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration with secrets masked, then exit")
+	testPolicies := flag.String("test-policies", "", "Evaluate the policy test cases in this JSON file, then exit")
 	flag.Parse()
 
 	if *showVersion {
@@ -70,13 +122,37 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *printConfig {
+		os.Exit(runPrintConfig(cfg, os.Stdout))
+	}
+
+	if *validateOnly {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		os.Exit(runValidate(context.Background(), cfg, os.Stdout))
+	}
+
+	if *testPolicies != "" {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		os.Exit(runTestPolicies(context.Background(), cfg, *testPolicies, os.Stdout))
+	}
+
 	// Initialize logger
-	initLogger(cfg.Logging)
+	logFile, err := initLogger(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
 
 	log.Info().
 		Str("version", version).
 		Str("config", *configPath).
 		Msg("Starting MCP Proxy")
+	for _, warning := range cfg.Warnings() {
+		log.Warn().Msg(warning)
+	}
 
 	// Create root context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
@@ -101,20 +177,38 @@ func main() {
 		Str("policy_mode", cfg.Policy.Mode).
 		Msg("Proxy server ready")
 
-	// Setup signal handling for graceful shutdown
+	// Setup signal handling for graceful shutdown and config reload
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	// Wait for shutdown signal
-	sig := <-sigChan
-	log.Info().Str("signal", sig.String()).Msg("Received shutdown signal")
+	// A transport that stops serving on its own, like stdio once stdin
+	// closes, shuts the proxy down too
+	var transportDone <-chan struct{}
+	if f, ok := app.transport.(transport.Finisher); ok {
+		transportDone = f.Done()
+	}
 
-	// Create shutdown context with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, cfg.Server.GracefulShutdown)
-	defer shutdownCancel()
+	// Reload on SIGHUP until a shutdown signal arrives
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig != syscall.SIGHUP {
+				log.Info().Str("signal", sig.String()).Msg("Received shutdown signal")
+				break wait
+			}
+			log.Info().Str("config", *configPath).Msg("Received SIGHUP, reloading configuration")
+			if err := app.reloadConfig(*configPath); err != nil {
+				log.Error().Err(err).Msg("Config reload failed, keeping current configuration")
+			}
+		case <-transportDone:
+			log.Info().Str("transport", app.transport.Name()).Msg("Transport stopped serving, shutting down")
+			break wait
+		}
+	}
 
-	// Perform graceful shutdown
-	if err := app.Stop(shutdownCtx); err != nil {
+	// Perform graceful shutdown; each component has its own timeout
+	if err := app.Stop(ctx); err != nil {
 		log.Error().Err(err).Msg("Error during shutdown")
 		os.Exit(1)
 	}
@@ -123,39 +217,125 @@ func main() {
 }
 
 func newApplication(cfg *config.Config) (*Application, error) {
-	app := &Application{
-		cfg: cfg,
-	}
+	app := &Application{}
+	app.cfg.Store(cfg)
 
 	// Initialize session manager
 	app.sessionManager = session.NewManager(session.ManagerConfig{
-		SessionTTL:      2 * time.Hour,
-		CleanupInterval: 1 * time.Minute,
-		MaxSessions:     cfg.Server.MaxConnections,
+		SessionTTL:       2 * time.Hour,
+		CleanupInterval:  1 * time.Minute,
+		MaxSessions:      cfg.Server.MaxConnections,
+		EvictionPolicy:   cfg.Server.SessionEviction,
+		ReplayBufferSize: cfg.Server.SSEReplayBuffer,
+
+		MessageBufferSize: cfg.Server.MessageBuffer,
+		OverflowPolicy:    cfg.Server.MessageOverflow,
+		OverflowTimeout:   cfg.Server.OverflowTimeout,
+
+		MaxLifetime: cfg.Server.MaxSessionLifetime,
+		IdleTimeout: cfg.Server.SessionIdleTimeout,
+	})
+	app.sessionManager.SetOnMessageDropped(func(policy string) {
+		app.metrics.IncrementMessagesDropped(policy)
+	})
+	app.sessionManager.SetOnSessionCreated(func(sess *session.Session) {
+		app.metrics.RecordSessionCreated(cfg.Server.Transport)
 	})
+	app.sessionManager.SetOnSessionClosed(func(sess *session.Session) {
+		app.metrics.RecordSessionClosed(cfg.Server.Transport, sess.Age().Seconds())
+		app.router.SessionClosed(sess)
+	})
+	app.sessionManager.SetOnCleanup(func(oldest time.Duration) {
+		app.metrics.SetOldestSessionAge(oldest.Seconds())
+	})
+	if cfg.Server.SessionSnapshot != "" {
+		if _, err := app.sessionManager.LoadSnapshot(cfg.Server.SessionSnapshot); err != nil {
+			log.Warn().Err(err).Msg("Failed to restore sessions, starting with none")
+		}
+	}
 
-	// Initialize upstream client (if URL configured)
-	if cfg.Upstream.URL != "" {
-		app.upstreamClient = upstream.NewClient(cfg.Upstream)
+	// Initialize upstream client (if URL or command configured), routing
+	// between several upstreams when named ones are configured
+	if len(cfg.Upstreams) > 0 {
+		set, err := upstream.NewSetFromConfig(cfg.Upstream, cfg.Upstreams)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create upstream clients: %w", err)
+		}
+		app.upstreamClient = set
+	} else if cfg.Upstream.URL != "" || cfg.Upstream.Command != "" {
+		client, err := upstream.New(cfg.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create upstream client: %w", err)
+		}
+		app.upstreamClient = client
+		if cfg.Upstream.CircuitBreaker.Enabled {
+			app.upstreamBreaker = upstream.NewCircuitBreaker(cfg.Upstream.CircuitBreaker)
+		}
 	}
 
 	// Initialize message router
 	app.router = router.NewRouter()
 
+	// Mirror matching requests to the shadow upstream, if configured
+	if cfg.Shadow.Enabled {
+		client, err := upstream.New(cfg.Shadow.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create shadow upstream client: %w", err)
+		}
+		app.shadowClient = client
+		shadow := router.NewShadow(func(ctx context.Context, message []byte) ([]byte, error) {
+			if !client.IsConnected() {
+				return nil, fmt.Errorf("shadow upstream not connected")
+			}
+			return client.Send(ctx, message)
+		}, cfg.Shadow.Methods, cfg.Shadow.Timeout)
+		// Clients' initialize handshakes go to the shadow too; the shadow
+		// client replays them if it reconnects
+		shadow.SetNotificationSender(func(ctx context.Context, message []byte) error {
+			if !client.IsConnected() {
+				return fmt.Errorf("shadow upstream not connected")
+			}
+			return upstream.SendNotification(ctx, client, message)
+		})
+		app.router.SetShadow(shadow)
+	}
+
 	// Set up upstream sender for router
 	app.router.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
-		if app.upstreamClient != nil && app.upstreamClient.IsConnected() {
-			return app.upstreamClient.Send(ctx, message)
+		client := app.upstreamClient
+		if upstreamReachable(client) {
+			app.metrics.SetUpstreamMode(observability.ModeProxying)
+			return app.upstreamBreaker.Send(ctx, client, message)
 		}
-		// No upstream - echo back for testing
-		return message, nil
+		// No upstream - the router echoes the request back
+		app.metrics.SetUpstreamMode(observability.ModeStandalone)
+		return nil, router.ErrStandalone
+	})
+	app.router.SetNotificationSender(func(ctx context.Context, message []byte) error {
+		client := app.upstreamClient
+		if !upstreamReachable(client) {
+			return router.ErrStandalone
+		}
+		return upstream.SendNotification(ctx, client, message)
 	})
 
+	// Relay resource update notifications to subscribed sessions
+	if notifier, ok := app.upstreamClient.(upstream.Notifier); ok {
+		notifier.SetNotificationHandler(app.router.HandleNotification)
+	}
+
+	// Metrics are created later, but before the upstream connects
+	if reporter, ok := app.upstreamClient.(upstream.DropReporter); ok {
+		reporter.SetOnResponseDropped(func() { app.metrics.IncrementUpstreamDropped() })
+	}
+
 	// Initialize audit store and writer (if enabled)
 	if cfg.Audit.Enabled {
 		var err error
 		app.auditStore, err = audit.NewStore(audit.StoreConfig{
+			Driver: cfg.Audit.Driver,
 			DBPath: cfg.Audit.DBPath,
+			DSN:    cfg.Audit.DSN,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create audit store: %w", err)
@@ -165,9 +345,89 @@ func newApplication(cfg *config.Config) (*Application, error) {
 			BufferSize:    cfg.Audit.BufferSize,
 			FlushInterval: cfg.Audit.FlushInterval,
 		})
+
+		sinks := []audit.RecordSink{app.auditWriter}
+		for _, sc := range cfg.Audit.Sinks {
+			sink, err := app.newAuditSink(sc)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		}
+		app.auditSink = audit.NewMultiSink(sinks...)
+
+		// Retention of 0 days keeps records forever
+		if cfg.Audit.RetentionDays > 0 {
+			app.auditPruner = audit.NewPruner(app.auditStore, audit.PrunerConfig{
+				Retention: time.Duration(cfg.Audit.RetentionDays) * 24 * time.Hour,
+			})
+		}
+	}
+
+	if rl := cfg.Server.RateLimit; rl.Requests > 0 {
+		app.router.SetRateLimiter(router.NewRateLimiter(rl.Requests, rl.Window, rl.PerDID))
+	}
+
+	if m := cfg.Server.Methods; len(m.Overrides) > 0 {
+		overrides := make(map[string]router.MethodConfig, len(m.Overrides))
+		for method, o := range m.Overrides {
+			mc, err := router.NewMethodOverride(method, o.Handler, o.LogLevel, o.AllowUnenforced)
+			if err != nil {
+				return nil, fmt.Errorf("invalid method override: %w", err)
+			}
+			overrides[method] = mc
+		}
+		app.router.SetMethodOverrides(overrides)
+	}
+	if m := cfg.Server.Methods; len(m.Allow) > 0 || len(m.Deny) > 0 || m.DenyUnknown {
+		filter := router.NewMethodFilter(m.Allow, m.Deny, m.DenyUnknown)
+		for method := range m.Overrides {
+			filter.AddKnown(method)
+		}
+		app.router.SetMethodFilter(filter)
 	}
 
+	if p := cfg.Server.Protocol; len(p.Versions) > 0 {
+		app.router.SetProtocolVersions(router.NewProtocolVersions(p.Versions, p.Unsupported == "rewrite"))
+	}
+
+	if cfg.Policy.AllowDryRun {
+		app.router.SetDryRunDIDs(cfg.Policy.DryRunDIDs)
+	}
+	app.router.SetMaxConcurrent(cfg.Server.MaxConcurrent)
+	app.router.SetMaxResponseBytes(cfg.Server.MaxResponseBytes)
+	app.router.SetHandlerTimeouts(map[router.HandlerType]time.Duration{
+		router.HandlerPassthrough: cfg.Server.Methods.Timeouts.Passthrough,
+		router.HandlerFullEnforce: cfg.Server.Methods.Timeouts.Enforce,
+		router.HandlerFilter:      cfg.Server.Methods.Timeouts.Filter,
+	})
+
+	// Classify write tools from the policy data's tool capabilities
+	app.router.SetWriteClassifier(func(tool string) bool {
+		derived := app.policyDerived.Load()
+		return derived != nil && derived.writeTools[tool]
+	})
+
+	// Reject verified DIDs that are blocked or not allowed, before policy evaluation
+	app.router.SetIdentityChecker(func(ctx context.Context, sess *session.Session, reqCtx *router.RequestContext) *router.IdentityRejection {
+		verified, did := sess.GetIdentity()
+		derived := app.policyDerived.Load()
+		if !verified || derived == nil {
+			return nil
+		}
+		err := derived.didFilter.Check(did)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, policy.ErrDIDBlocked):
+			return &router.IdentityRejection{Code: "did_blocked", Message: fmt.Sprintf("Agent DID %s is blocked", did)}
+		default:
+			return &router.IdentityRejection{Code: "did_not_allowed", Message: fmt.Sprintf("Agent DID %s is not allowed", did)}
+		}
+	})
+
 	// Set up audit logger
+	sampler := audit.NewSampler(cfg.Audit.SampleRate)
 	app.router.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *router.RequestContext, decision *router.PolicyDecision, response []byte, latency time.Duration) {
 		allowed := decision == nil || decision.Allow
 		durationSeconds := latency.Seconds()
@@ -181,21 +441,31 @@ func newApplication(cfg *config.Config) (*Application, error) {
 
 		if decision != nil {
 			app.metrics.RecordPolicyDecision(allowed, decision.MatchedRule, decision.PolicyMode, durationSeconds)
+			app.metrics.RecordRuleFires(decision.FiredRules)
 		}
 
-		// Always log to stdout
-		log.Info().
+		// Metrics count every request; sampling only thins logs and records
+		violations := decision != nil && len(decision.Violations) > 0
+		if !sampler.Keep(allowed, violations) {
+			return
+		}
+
+		// Log to stdout
+		event := log.Info().
 			Str("request_id", reqCtx.RequestID).
 			Str("session_id", sess.ID).
 			Str("agent_id", sess.AgentID).
 			Str("method", reqCtx.Method).
 			Str("tool", reqCtx.Tool).
 			Bool("allowed", allowed).
-			Dur("latency", latency).
-			Msg("Request processed")
+			Dur("latency", latency)
+		if decision != nil && decision.Filtered > 0 {
+			event = event.Int("filtered", decision.Filtered)
+		}
+		event.Msg("Request processed")
 
-		// Write to audit store if enabled
-		if app.auditWriter != nil {
+		// Write to the audit store and any extra sinks if enabled
+		if app.auditSink != nil {
 			// Build capabilities string
 			capsJSON, _ := json.Marshal(sess.Capabilities)
 
@@ -206,80 +476,210 @@ func newApplication(cfg *config.Config) (*Application, error) {
 				argsJSON = string(argsBytes)
 			}
 
-			// Build violations string
+			// Violations are recorded as a JSON array with their categories
 			var violations string
 			var matchedRule, policyMode string
 			if decision != nil {
 				if len(decision.Violations) > 0 {
-					violations = strings.Join(decision.Violations, "; ")
+					violJSON, _ := json.Marshal(decision.Violations)
+					violations = string(violJSON)
 				}
 				matchedRule = decision.MatchedRule
 				policyMode = decision.PolicyMode
 			}
 
+			// Obligations are recorded whether or not the request was allowed
+			var obligations string
+			if decision != nil && len(decision.Obligations) > 0 {
+				oblJSON, _ := json.Marshal(decision.Obligations)
+				obligations = string(oblJSON)
+			}
+
 			record := audit.NewRecordBuilder().
 				WithRequest(reqCtx.RequestID, sess.ID).
 				WithTiming(float64(latency.Microseconds())/1000.0).
+				WithLatencyBreakdown(
+					float64(reqCtx.PolicyLatency.Microseconds())/1000.0,
+					float64(reqCtx.UpstreamLatency.Microseconds())/1000.0,
+				).
 				WithAgent(sess.AgentID, sess.AgentName, string(capsJSON)).
 				WithMethod(reqCtx.Method, reqCtx.Tool, reqCtx.ResourceURI, argsJSON).
-				WithIdentity(sess.IdentityVerified, sess.DID).
+				TruncateArguments(cfg.Audit.Capture.MaxArgumentBytes).
+				WithIdentity(sess.GetIdentity()).
 				WithDecision(allowed, matchedRule, violations, policyMode).
+				WithObligations(obligations).
+				WithDryRun(reqCtx.DryRun).
+				WithEchoed(reqCtx.Echoed).
 				WithEnvironment(sess.SourceIP, cfg.Policy.Environment).
 				Build()
 
-			app.auditWriter.Write(record)
+			app.auditSink.Write(record)
 		}
 	})
 
 	// Initialize policy engine
 	app.policyEngine = policy.NewEngine(policy.EngineConfig{
-		Mode:    cfg.Policy.Mode,
-		Enabled: cfg.Policy.Enabled,
+		Mode:                cfg.Policy.Mode,
+		Enabled:             cfg.Policy.Enabled,
+		EvalTimeout:         cfg.Policy.Evaluation.Timeout,
+		StrictBuiltinErrors: cfg.Policy.Evaluation.StrictBuiltinErrors,
 		CacheConfig: policy.CacheConfig{
 			Enabled:    true,
-			TTL:        5 * time.Minute,
-			MaxEntries: 10000,
+			TTL:        cfg.Policy.Cache.TTL,
+			MaxEntries: cfg.Policy.Cache.MaxEntries,
+			L1Size:     cfg.Policy.Cache.L1Size,
 		},
 	})
 
+	// The capability backend stands in for OPA when policies only map tools
+	// to capabilities
+	app.policyBackend = app.policyEngine
+	if cfg.Policy.Enabled && cfg.Policy.Backend == policy.BackendCapability {
+		app.policyBackend = policy.NewCapabilityMatcher(cfg.Policy.Mode)
+	}
+
+	// Record sampled decisions with their full input for policy debugging
+	if cfg.Policy.Enabled && cfg.Policy.DecisionLog.Enabled {
+		sink, err := newDecisionSink(cfg.Policy.DecisionLog)
+		if err != nil {
+			return nil, err
+		}
+		app.decisionLog = policy.NewDecisionLogger(sink, policy.DecisionLoggerConfig{
+			SampleRate: cfg.Policy.DecisionLog.SampleRate,
+			BufferSize: cfg.Policy.DecisionLog.BufferSize,
+		})
+		// Metrics are created later, but before any request is evaluated
+		app.decisionLog.SetOnDrop(func(n int) { app.metrics.AddDecisionLogDropped(n) })
+		app.policyBackend.SetDecisionLogger(app.decisionLog)
+	}
+
+	// Cache upstream read results. They are stored before filtering, and
+	// policy is evaluated on every request, so they never bypass policy
+	if cfg.ResponseCache.Enabled {
+		app.responseCache = router.NewResponseCache(cfg.ResponseCache.Methods, cfg.ResponseCache.TTL, cfg.ResponseCache.MaxEntries)
+		app.responseCache.SetPerSession(perSessionUpstream(cfg))
+		app.router.SetResponseCache(app.responseCache)
+		app.policyEngine.SetOnChange(app.responseCache.Clear)
+	}
+
 	// Set up policy evaluator
 	app.router.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *router.RequestContext) (*router.PolicyDecision, error) {
-		// Build policy input
-		input := policy.NewInputBuilder().
-			WithAgent(sess.AgentID, sess.AgentID, sess.Capabilities).
-			WithRequest(reqCtx.Method, reqCtx.Tool, reqCtx.Arguments).
-			WithSession(sess.ID, sess.RequestCount, sess.CreatedAt).
-			WithEnvironment(sess.SourceIP, cfg.Policy.Environment, cfg.Server.Listen.Address).
-			Build()
-
-		// Set agent details if available
-		if cfg.Agent.ID != "" {
-			input.Agent.Model = cfg.Agent.Model
-			input.Agent.Publisher = cfg.Agent.Publisher
-		}
-
-		// Evaluate policy
-		result, err := app.policyEngine.Evaluate(ctx, input)
+		input := app.buildPolicyInput(sess, reqCtx.Method, reqCtx.Tool, reqCtx.ResourceURI, reqCtx.Arguments)
+		input.Request.Prompt = reqCtx.Prompt
+
+		// Evaluate policy, tracing the rules that fire when explain is on
+		opa := cfg.Policy.Backend == policy.BackendOPA
+		evaluate := app.policyBackend.Evaluate
+		if opa && cfg.Policy.Evaluation.Explain {
+			evaluate = app.policyEngine.EvaluateWithExplain
+		}
+		result, err := evaluate(ctx, input)
 		if err != nil {
+			if errors.Is(err, policy.ErrEvaluationTimeout) {
+				return nil, fmt.Errorf("%w: %v", router.ErrPolicyTimeout, err)
+			}
 			return nil, err
 		}
+		if opa && !cfg.Policy.Evaluation.Explain {
+			// Explained evaluations bypass the cache, and only OPA has one
+			app.metrics.RecordPolicyCache(result.CacheHit, result.CacheTier)
+		}
+		if result.Trace != nil {
+			log.Info().
+				Str("request_id", reqCtx.RequestID).
+				Bool("allow", result.Decision.Allow).
+				Strs("rules_fired", result.Trace).
+				Msg("Policy decision explained")
+		}
 
 		// Convert to router's PolicyDecision type
-		return &router.PolicyDecision{
+		decision := &router.PolicyDecision{
 			Allow:       result.Decision.Allow,
-			Violations:  result.Decision.Violations,
 			MatchedRule: result.Decision.MatchedRule,
+			FiredRules:  result.Decision.FiredRules,
 			PolicyMode:  result.PolicyMode,
-		}, nil
+		}
+		for _, v := range result.Decision.Violations {
+			decision.Violations = append(decision.Violations, router.Violation{
+				Category: v.Category,
+				Message:  v.Message,
+				Detail:   v.Detail,
+			})
+		}
+		for _, obl := range result.Decision.Obligations {
+			decision.Obligations = append(decision.Obligations, router.Obligation{
+				Action: obl.Action,
+				Params: obl.Params,
+			})
+		}
+		return decision, nil
+	})
+
+	// Set up obligation execution for allowed requests
+	app.obligations = policy.NewObligationExecutor()
+	if webhook := cfg.Policy.Obligations.AlertWebhook; webhook != "" {
+		app.alertWebhook = policy.NewWebhookHandler(webhook, policy.ObligationAlert, cfg.Policy.Obligations.WebhookTimeout)
+		app.obligations.Register(policy.ObligationAlert, app.alertWebhook)
+	}
+	app.router.SetObligationHandler(func(ctx context.Context, sess *session.Session, reqCtx *router.RequestContext, obligations []router.Obligation) {
+		pending := make([]policy.PolicyObligation, len(obligations))
+		for i, obl := range obligations {
+			pending[i] = policy.PolicyObligation{Action: obl.Action, Params: obl.Params}
+		}
+
+		req := &policy.ObligationRequest{
+			RequestID:   reqCtx.RequestID,
+			SessionID:   sess.ID,
+			AgentID:     sess.AgentID,
+			Method:      reqCtx.Method,
+			Tool:        reqCtx.Tool,
+			ResourceURI: reqCtx.ResourceURI,
+		}
+		if err := app.obligations.Execute(ctx, pending, req); err != nil {
+			log.Error().Err(err).Str("request_id", reqCtx.RequestID).Msg("Obligation execution failed")
+		}
+	})
+
+	// Set up tools/list filtering - each tool is evaluated as if it were called
+	app.router.SetToolFilter(func(ctx context.Context, sess *session.Session, reqCtx *router.RequestContext, tool string) bool {
+		input := app.buildPolicyInput(sess, "tools/call", tool, "", nil)
+
+		result, err := app.policyBackend.Evaluate(ctx, input)
+		if err != nil {
+			log.Error().Err(err).Str("tool", tool).Msg("Policy evaluation failed while filtering tools")
+			return false
+		}
+
+		// Audit mode reports but never hides tools
+		return result.Decision.Allow || result.PolicyMode == "audit"
+	})
+
+	// Set up resources/list filtering - each resource is evaluated as if it were read
+	app.router.SetResourceFilter(func(ctx context.Context, sess *session.Session, reqCtx *router.RequestContext, uri string) bool {
+		input := app.buildPolicyInput(sess, "resources/read", "", uri, nil)
+
+		result, err := app.policyBackend.Evaluate(ctx, input)
+		if err != nil {
+			log.Error().Err(err).Str("resource_uri", uri).Msg("Policy evaluation failed while filtering resources")
+			return false
+		}
+
+		return result.Decision.Allow || result.PolicyMode == "audit"
 	})
 
 	// Initialize transport based on config
 	switch cfg.Server.Transport {
 	case "sse":
-		app.transport = sse.NewServer(cfg.Server, cfg.Agent, app.sessionManager)
+		sseServer := sse.NewServer(cfg.Server, cfg.Agent, app.sessionManager)
+		sseServer.SetTLSConfig(cfg.TLS)
+		app.transport = sseServer
 	case "stdio":
 		stdioServer := stdio.NewServer(cfg.Agent, app.sessionManager)
+		stdioServer.SetFraming(stdio.Framing(cfg.Server.Stdio.Framing))
+		stdioServer.SetMaxMessageSize(int(cfg.Server.MaxRequestBytes))
 		app.transport = stdioServer
+	case "websocket":
+		app.transport = ws.NewServer(cfg.Server, cfg.Agent, app.sessionManager)
 	default:
 		return nil, fmt.Errorf("unknown transport: %s", cfg.Server.Transport)
 	}
@@ -289,23 +689,53 @@ func newApplication(cfg *config.Config) (*Application, error) {
 
 	// Initialize observability
 	app.metrics = observability.NewMetrics("mcp_proxy")
+	app.router.SetInFlightGauge(app.metrics.RequestsInFlight)
+	app.router.SetResponseSizeHistogram(app.metrics.UpstreamResponse)
 	app.health = observability.NewHealth(version)
+	app.health.SetModeFunc(app.upstreamMode)
 
 	// Register health checkers
-	if app.policyEngine != nil {
+	if app.policyBackend != nil {
 		app.health.RegisterChecker("policy_engine", observability.PolicyEngineChecker(func() bool {
-			return app.policyEngine.IsReady()
+			return app.policyBackend.IsReady()
 		}))
 	}
 	if app.upstreamClient != nil {
+		if cfg.Upstream.Probe.Enabled {
+			app.upstreamProber = upstream.NewProber(app.upstreamClient, cfg.Upstream)
+			app.upstreamProber.SetOnResult(func(healthy bool) {
+				if healthy {
+					app.metrics.UpstreamConnected.Set(1)
+				} else {
+					app.metrics.UpstreamConnected.Set(0)
+				}
+			})
+		} else if cfg.Upstream.Required {
+			app.upstreamReconnector = upstream.NewReconnector(app.upstreamClient, cfg.Upstream.Probe.Interval)
+		}
+		var circuitState func() upstream.CircuitState
+		if set, ok := app.upstreamClient.(*upstream.Set); ok {
+			circuitState = set.CircuitState
+		} else if app.upstreamBreaker != nil {
+			circuitState = app.upstreamBreaker.State
+		}
+		if circuitState != nil {
+			app.metrics.SetCircuitStateFunc(circuitState)
+		}
 		app.health.RegisterChecker("upstream", observability.UpstreamChecker(func() bool {
+			if app.upstreamProber != nil && !app.upstreamProber.Healthy() {
+				return false
+			}
 			return app.upstreamClient.IsConnected()
-		}))
+		}, circuitState, cfg.Upstream.Required))
 	}
 	if app.auditStore != nil {
-		app.health.RegisterChecker("audit_store", observability.DatabaseChecker(func(ctx context.Context) error {
-			return app.auditStore.Ping(ctx)
-		}))
+		app.health.RegisterChecker("audit_store", observability.AuditWriterChecker(
+			app.auditWriter.FillRatio,
+			func() time.Time { return app.auditWriter.Stats().LastWrite },
+			func() time.Time { return app.auditWriter.Stats().LastDrop },
+			app.auditStore.Ping,
+		))
 	}
 
 	// Create observability server
@@ -314,48 +744,388 @@ func newApplication(cfg *config.Config) (*Application, error) {
 		MetricsAddress: cfg.Metrics.Address,
 		MetricsPort:    cfg.Metrics.Port,
 		MetricsPath:    cfg.Metrics.Path,
+		PprofEnabled:   cfg.Metrics.PprofEnabled,
 		HealthEnabled:  cfg.Health.Enabled,
 		HealthAddress:  cfg.Health.Address,
 		HealthPort:     cfg.Health.Port,
 		LivenessPath:   cfg.Health.LivenessPath,
 		ReadinessPath:  cfg.Health.ReadinessPath,
+		AdminEnabled:   cfg.Admin.Enabled,
+		AdminAddress:   cfg.Admin.Address,
+		AdminPort:      cfg.Admin.Port,
 	}, app.metrics, app.health)
+	app.obsServer.SetStats(app.newStats())
+	if cfg.Admin.Enabled {
+		admin := observability.NewAdmin(app.sessionManager, cfg.Admin.Tokens)
+		if cfg.Policy.Enabled {
+			admin.SetPolicyDataReloader(app.reloadPolicyData)
+		}
+		app.obsServer.SetAdmin(admin)
+	}
 
 	return app, nil
 }
 
+// perSessionUpstream reports whether any upstream opens a connection per
+// client session.
+func perSessionUpstream(cfg *config.Config) bool {
+	if cfg.Upstream.ConnectionPool.PerSession {
+		return true
+	}
+	for _, u := range cfg.Upstreams {
+		if u.ConnectionPool.PerSession {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamReachable reports whether requests can be sent to u. A set of
+// upstreams checks the connection of the one it picks for each request.
+func upstreamReachable(u upstream.Upstream) bool {
+	if _, ok := u.(*upstream.Set); ok {
+		return true
+	}
+	return u != nil && u.IsConnected()
+}
+
+// newAuditSink creates the additional audit sink described by cfg.
+func (app *Application) newAuditSink(cfg config.AuditSinkConfig) (audit.RecordSink, error) {
+	// Metrics are created after the audit sinks, but before any request
+	// can reach them
+	onDrop := func() { app.metrics.IncrementAuditSinkDropped(cfg.Type) }
+	switch cfg.Type {
+	case "stdout":
+		sink := audit.NewJSONSink(os.Stdout, cfg.BufferSize)
+		sink.SetOnDrop(onDrop)
+		return sink, nil
+	case "file":
+		sink, err := audit.NewJSONFileSink(cfg.Path, cfg.BufferSize)
+		if err != nil {
+			return nil, err
+		}
+		sink.SetOnDrop(onDrop)
+		return sink, nil
+	case "syslog":
+		sink := audit.NewSyslogSink(audit.SyslogConfig{
+			Network:    cfg.Network,
+			Address:    cfg.Address,
+			BufferSize: cfg.BufferSize,
+			Version:    version,
+		})
+		sink.SetOnDrop(onDrop)
+		return sink, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink type: %s", cfg.Type)
+	}
+}
+
+// newDecisionSink creates the policy decision log sink described by cfg.
+func newDecisionSink(cfg config.DecisionLogConfig) (policy.DecisionSink, error) {
+	switch cfg.Type {
+	case "file":
+		return policy.NewDecisionFileSink(cfg.Path)
+	case "http":
+		return policy.NewHTTPDecisionSink(cfg.URL, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown decision log type: %s", cfg.Type)
+	}
+}
+
+// upstreamMode reports whether requests are being forwarded upstream or
+// echoed back, updating the upstream_mode gauge.
+func (app *Application) upstreamMode() string {
+	mode := observability.ModeStandalone
+	if app.upstreamClient != nil && app.upstreamClient.IsConnected() {
+		mode = observability.ModeProxying
+	}
+	app.metrics.SetUpstreamMode(mode)
+	return mode
+}
+
+// newStats collects the statistics served at /stats.
+func (app *Application) newStats() *observability.Stats {
+	stats := observability.NewStats(version)
+
+	stats.Register("sessions", func(ctx context.Context) (any, error) {
+		return map[string]int{"active": app.sessionManager.ActiveCount()}, nil
+	})
+	if app.policyEngine != nil {
+		stats.Register("policy", func(ctx context.Context) (any, error) {
+			return app.policyEngine.Stats(), nil
+		})
+	}
+	if app.auditStore != nil {
+		stats.Register("audit", func(ctx context.Context) (any, error) {
+			totals, err := app.auditStore.GetStats(ctx, nil)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{
+				"totals": totals,
+				"writer": app.auditWriter.Stats(),
+			}, nil
+		})
+	}
+
+	return stats
+}
+
+// buildPolicyInput builds the policy input for a request in the given session.
+func (app *Application) buildPolicyInput(sess *session.Session, method, tool, resourceURI string, arguments map[string]interface{}) *policy.PolicyInput {
+	cfg := app.cfg.Load()
+	input := policy.NewInputBuilder().
+		WithAgent(sess.AgentID, sess.AgentID, sess.Capabilities).
+		WithRequest(method, tool, arguments).
+		WithResource(resourceURI).
+		WithSession(sess.ID, sess.RequestCount, sess.CreatedAt).
+		WithAuthToken(transport.TokenFingerprint(sess.GetAuthToken())).
+		WithClientCert(sess.GetClientCertSubject()).
+		WithInitialize(sess.GetInitialize()).
+		WithCumulativeCounts(sess.GetCumulativeCounts()).
+		WithIdentity(sess.GetIdentity()).
+		WithEnvironment(sess.SourceIP, cfg.Policy.Environment, cfg.Server.Listen.Address).
+		Build()
+
+	// Set agent details if available
+	if cfg.Agent.ID != "" {
+		input.Agent.Model = cfg.Agent.Model
+		input.Agent.Publisher = cfg.Agent.Publisher
+	}
+
+	return input
+}
+
+// warmUpPolicyCache caches the decisions for the configured warm-up agents,
+// and the default agent, calling each warm-up tool. Failures are logged;
+// they only leave the cache colder.
+func (app *Application) warmUpPolicyCache(ctx context.Context, data *policy.PolicyData) {
+	cfg := app.cfg.Load()
+	agentConfigs := cfg.Policy.WarmUp.Agents
+	if cfg.Agent.ID != "" {
+		agentConfigs = append([]config.AgentConfig{cfg.Agent}, agentConfigs...)
+	}
+
+	agents := make([]policy.AgentContext, len(agentConfigs))
+	for i, a := range agentConfigs {
+		// Sessions use the agent ID as its name too
+		agents[i] = policy.AgentContext{
+			ID:           a.ID,
+			Name:         a.ID,
+			Capabilities: a.Capabilities,
+			Model:        a.Model,
+			Publisher:    a.Publisher,
+			Tags:         a.Tags,
+		}
+	}
+
+	start := time.Now()
+	inputs := policy.WarmUpInputs(data, agents, cfg.Policy.WarmUp.Tools)
+	cached, err := app.policyEngine.WarmUp(ctx, inputs)
+	if errors.Is(err, policy.ErrWarmUpSkipped) {
+		log.Info().Err(err).Msg("Policy cache warm-up skipped")
+		return
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("Some policy cache warm-up evaluations failed")
+	}
+	log.Info().
+		Int("inputs", len(inputs)).
+		Int("cached", cached).
+		Dur("duration", time.Since(start)).
+		Msg("Policy cache warmed up")
+}
+
+// policiesReloaded warms the decision cache up again, if warm-up is
+// enabled, after a reload of the policies or policy data has cleared it.
+func (app *Application) policiesReloaded(ctx context.Context) {
+	cfg := app.cfg.Load()
+	if cfg.Policy.Backend != policy.BackendOPA || !cfg.Policy.WarmUp.Enabled {
+		return
+	}
+	app.warmUpPolicyCache(ctx, app.policyDerived.Load().data)
+}
+
+// startBundlePolling loads the remote policy bundle over the local policies
+// and keeps polling it for changes. A bundle that cannot be loaded at
+// startup leaves the local policies active.
+func (app *Application) startBundlePolling(ctx context.Context) error {
+	bc := app.cfg.Load().Policy.Bundle
+	bundles, err := policy.NewBundleLoader(policy.BundleConfig{
+		URL:             bc.URL,
+		PollInterval:    bc.PollInterval,
+		VerificationKey: bc.VerificationKey,
+		KeyID:           bc.KeyID,
+		SigningAlg:      bc.SigningAlg,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure policy bundle: %w", err)
+	}
+
+	app.policyBundles = bundles
+
+	data, err := bundles.Load(ctx, app.policyEngine)
+	if err != nil {
+		log.Warn().Err(err).Str("url", bc.URL).Msg("Failed to load policy bundle, using local policies")
+	} else if data != nil {
+		app.applyPolicyData(data)
+	}
+
+	pollCtx, cancel := context.WithCancel(ctx)
+	app.stopBundlePoll = cancel
+	go bundles.Poll(pollCtx, app.policyEngine, func(data *policy.PolicyData) {
+		app.applyPolicyData(data)
+		app.policiesReloaded(pollCtx)
+	})
+	return nil
+}
+
+// reloadPolicyData re-reads the policy data file, or the policy bundle if
+// one is configured, into the policy backend, the agent rate limits, the
+// write tools and the DID filter, for the admin API. Cached responses are
+// cleared, since filtering depends on the data.
+func (app *Application) reloadPolicyData(ctx context.Context) (int, error) {
+	if app.policyBundles != nil {
+		keys, data, err := app.policyBundles.Reload(ctx, app.policyEngine)
+		if err != nil {
+			return 0, err
+		}
+		app.applyPolicyData(data)
+		app.policiesReloaded(ctx)
+		return keys, nil
+	}
+
+	cfg := app.cfg.Load()
+	loader := policy.NewLoader(cfg.Policy.PolicyDir, cfg.Policy.DataFile)
+	keys, err := loader.ReloadData(app.policyBackend)
+	if err != nil {
+		return 0, err
+	}
+	if app.responseCache != nil {
+		app.responseCache.Clear()
+	}
+	data, err := loader.LoadPolicyDataStruct()
+	if err != nil {
+		return 0, err
+	}
+	app.applyPolicyData(data)
+	app.policiesReloaded(ctx)
+	return keys, nil
+}
+
+// applyPolicyData applies the policy data outside the policy backend: agent
+// rate limits, write tools and the DID filter. data is nil when policies are
+// disabled.
+func (app *Application) applyPolicyData(data *policy.PolicyData) {
+	derived := &derivedPolicyData{data: data}
+	var blockedDIDs []string
+	if data != nil {
+		blockedDIDs = data.BlockedDIDs
+		derived.writeTools = data.WriteTools()
+		app.router.SetAgentRateLimits(router.NewAgentRateLimits(data.RateLimits))
+	}
+	derived.didFilter = policy.NewDIDFilter(app.cfg.Load().AgentFacts.AllowedDIDs, blockedDIDs)
+	app.policyDerived.Store(derived)
+}
+
 // Start starts all application components.
 func (app *Application) Start(ctx context.Context) error {
+	cfg := app.cfg.Load()
 	// Load policies
-	if app.cfg.Policy.Enabled {
-		loader := policy.NewLoader(app.cfg.Policy.PolicyDir, app.cfg.Policy.DataFile)
-		if err := loader.LoadAndInitialize(ctx, app.policyEngine); err != nil {
+	if cfg.Policy.Enabled {
+		opa := cfg.Policy.Backend == policy.BackendOPA
+		loader := policy.NewLoader(cfg.Policy.PolicyDir, cfg.Policy.DataFile)
+		var err error
+		if opa {
+			err = loader.LoadAndInitialize(ctx, app.policyEngine)
+		} else {
+			// Other backends have no Rego to compile, only data
+			_, err = loader.ReloadData(app.policyBackend)
+		}
+		if err != nil {
 			return fmt.Errorf("failed to load policies: %w", err)
 		}
+		data, err := loader.LoadPolicyDataStruct()
+		if err != nil {
+			return fmt.Errorf("failed to load policy data: %w", err)
+		}
 		log.Info().
-			Str("policy_dir", app.cfg.Policy.PolicyDir).
-			Str("data_file", app.cfg.Policy.DataFile).
-			Str("mode", app.cfg.Policy.Mode).
+			Str("policy_dir", cfg.Policy.PolicyDir).
+			Str("data_file", cfg.Policy.DataFile).
+			Str("mode", cfg.Policy.Mode).
+			Str("backend", cfg.Policy.Backend).
 			Msg("Policy engine initialized")
+
+		// Before any reload can warm up from it
+		app.applyPolicyData(data)
+
+		// A bundle replaces the local files, so they are not watched
+		if opa && cfg.Policy.WatchForChanges && cfg.Policy.Bundle.URL == "" {
+			watchCtx, cancel := context.WithCancel(ctx)
+			app.stopPolicyWatch = cancel
+			go func() {
+				onChange := func() { app.policiesReloaded(watchCtx) }
+				if err := loader.WatchForChanges(watchCtx, app.policyEngine, onChange); err != nil {
+					log.Error().Err(err).Msg("Policy file watching stopped")
+				}
+			}()
+		}
+
+		if opa && cfg.Policy.Bundle.URL != "" {
+			if err := app.startBundlePolling(ctx); err != nil {
+				return err
+			}
+		}
+
+		if opa && cfg.Policy.WarmUp.Enabled {
+			app.warmUpPolicyCache(ctx, app.policyDerived.Load().data)
+		}
+	} else {
+		app.applyPolicyData(nil)
 	}
 
 	// Start audit writer
 	if app.auditWriter != nil {
 		app.auditWriter.Start()
 		log.Info().
-			Str("db_path", app.cfg.Audit.DBPath).
+			Str("driver", cfg.Audit.Driver).
+			Str("db_path", cfg.Audit.DBPath).
 			Msg("Audit logging enabled")
 	}
 
+	// Start audit retention pruning
+	if app.auditPruner != nil {
+		app.auditPruner.SetOnPrune(app.metrics.IncrementAuditPruned)
+		app.auditPruner.Start()
+	}
+
 	// Start session manager
 	app.sessionManager.Start(ctx)
 
 	// Connect to upstream (if configured)
 	if app.upstreamClient != nil {
 		if err := app.upstreamClient.Connect(ctx); err != nil {
-			log.Warn().Err(err).Msg("Failed to connect to upstream - will operate in standalone mode")
+			if cfg.Upstream.Required {
+				log.Warn().Err(err).Msg("Failed to connect to required upstream - readiness will fail until it connects")
+			} else {
+				log.Warn().Err(err).Msg("Failed to connect to upstream - will operate in standalone mode")
+			}
 			// Don't fail startup - proxy can work without upstream for testing
 		}
+		if app.upstreamProber != nil {
+			app.upstreamProber.Start(ctx)
+		}
+		if app.upstreamReconnector != nil {
+			app.upstreamReconnector.Start(ctx)
+		}
+	}
+	if app.shadowClient != nil {
+		if err := app.shadowClient.Connect(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to connect to shadow upstream - requests won't be mirrored")
+		}
+	}
+	if app.upstreamMode() == observability.ModeStandalone {
+		log.Warn().Msg("No upstream connected - requests will be echoed back")
 	}
 
 	// Start transport server
@@ -374,34 +1144,131 @@ func (app *Application) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop gracefully stops all application components.
+// Stop gracefully stops all application components, in order: stop
+// accepting connections, drain upstream and sessions, flush audit records,
+// close the audit store. Each step has its own timeout from
+// server.shutdown_timeouts, so a step that runs long doesn't take time from
+// the ones after it; ctx cancels the remaining steps.
 func (app *Application) Stop(ctx context.Context) error {
+	cfg := app.cfg.Load()
 	log.Info().Msg("Starting graceful shutdown...")
+	timeouts := cfg.Server.ShutdownTimeouts
 
 	// Mark as not ready immediately
 	app.health.SetReady(false)
 
+	if app.stopPolicyWatch != nil {
+		app.stopPolicyWatch()
+	}
+	if app.stopBundlePoll != nil {
+		app.stopBundlePoll()
+	}
+
 	// Stop observability server
-	if err := app.obsServer.Stop(ctx); err != nil {
+	if err := stopWithin(ctx, timeouts.Transport, app.obsServer.Stop); err != nil {
 		log.Error().Err(err).Msg("Error stopping observability server")
 	}
 
+	// Save sessions before the transport drops them
+	if cfg.Server.SessionSnapshot != "" {
+		if err := app.sessionManager.SaveSnapshot(cfg.Server.SessionSnapshot); err != nil {
+			log.Error().Err(err).Msg("Error saving session snapshot")
+		}
+	}
+
 	// Stop transport server first (stop accepting new connections)
-	if err := app.transport.Stop(ctx); err != nil {
+	transportStopped := make(chan struct{})
+	err := stopWithin(ctx, timeouts.Transport, func(ctx context.Context) error {
+		defer close(transportStopped)
+		return app.transport.Stop(ctx)
+	})
+	if err != nil {
 		log.Error().Err(err).Msg("Error stopping transport server")
 	}
 
 	// Disconnect from upstream
-	if app.upstreamClient != nil {
-		app.upstreamClient.Disconnect()
+	err = stopWithin(ctx, timeouts.Upstream, func(context.Context) error {
+		if app.upstreamProber != nil {
+			app.upstreamProber.Stop()
+		}
+		if app.upstreamReconnector != nil {
+			app.upstreamReconnector.Stop()
+		}
+		if app.upstreamClient != nil {
+			app.upstreamClient.Disconnect()
+		}
+		if app.shadowClient != nil {
+			app.shadowClient.Disconnect()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error disconnecting from upstream")
 	}
 
 	// Stop session manager (closes all sessions)
-	app.sessionManager.Stop()
+	err = stopWithin(ctx, timeouts.Sessions, func(context.Context) error {
+		app.sessionManager.Stop()
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error stopping session manager")
+	}
 
-	// Stop audit writer (flushes remaining records)
-	if app.auditWriter != nil {
-		app.auditWriter.Stop()
+	// A transport stop that overran its timeout is still finishing requests,
+	// which write audit records; give it up to the audit timeout before the
+	// sinks close and start dropping them
+	err = stopWithin(ctx, timeouts.Audit, func(ctx context.Context) error {
+		select {
+		case <-transportStopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Transport still stopping, closing audit sinks anyway")
+	}
+
+	// Flush the remaining records, then close the audit store
+	err = stopWithin(ctx, timeouts.Audit, func(context.Context) error {
+		app.stopAudit()
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error flushing audit records")
+	}
+
+	return nil
+}
+
+// stopAudit writes the remaining decision log entries and audit records,
+// posts the queued alerts and closes the audit store.
+func (app *Application) stopAudit() {
+	// Post the queued alerts; no more obligations are executed
+	if app.alertWebhook != nil {
+		if err := app.alertWebhook.Close(); err != nil {
+			log.Error().Err(err).Msg("Error closing alert webhook")
+		}
+	}
+
+	// Write the remaining decision log entries; no more are evaluated
+	if app.decisionLog != nil {
+		if err := app.decisionLog.Close(); err != nil {
+			log.Error().Err(err).Msg("Error closing policy decision log")
+		}
+	}
+
+	// Stop audit pruner before the store is closed
+	if app.auditPruner != nil {
+		app.auditPruner.Stop()
+	}
+
+	// Stop audit writer (flushes remaining records) and close extra sinks
+	if app.auditSink != nil {
+		if err := app.auditSink.Close(); err != nil {
+			log.Error().Err(err).Msg("Error closing audit sinks")
+		}
 	}
 
 	// Close audit store
@@ -410,8 +1277,24 @@ func (app *Application) Stop(ctx context.Context) error {
 			log.Error().Err(err).Msg("Error closing audit store")
 		}
 	}
+}
 
-	return nil
+// stopWithin runs stop with a context that expires after timeout, and stops
+// waiting for it then even if stop ignores the context. A stop still
+// running is abandoned; shutdown moves on to the next component.
+func stopWithin(ctx context.Context, timeout time.Duration, stop func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- stop(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("not stopped within %s: %w", timeout, ctx.Err())
+	}
 }
 
 // handleMessage processes an incoming MCP message through the router.
@@ -420,7 +1303,85 @@ func (app *Application) handleMessage(ctx context.Context, sess *session.Session
 	return app.router.Route(ctx, sess, message)
 }
 
-func initLogger(cfg config.LoggingConfig) {
+// reloadConfig re-reads the configuration file and applies the settings that
+// can change while running: policy mode, log level, and CORS origins.
+// Changes to any other setting are logged as ignored and need a restart.
+func (app *Application) reloadConfig(path string) error {
+	newCfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	// Reloads apply to a copy that replaces the running config, so readers
+	// never see it half updated
+	app.reloadMu.Lock()
+	defer app.reloadMu.Unlock()
+	updated := *app.cfg.Load()
+	cfg := &updated
+
+	if newCfg.Policy.Mode != cfg.Policy.Mode {
+		if err := app.policyEngine.SetMode(newCfg.Policy.Mode); err != nil {
+			return err
+		}
+		if matcher, ok := app.policyBackend.(*policy.CapabilityMatcher); ok {
+			if err := matcher.SetMode(newCfg.Policy.Mode); err != nil {
+				return err
+			}
+		}
+		log.Info().
+			Str("from", cfg.Policy.Mode).
+			Str("to", newCfg.Policy.Mode).
+			Msg("Policy mode reloaded")
+		cfg.Policy.Mode = newCfg.Policy.Mode
+	}
+
+	if newCfg.Logging.Level != cfg.Logging.Level {
+		level, err := zerolog.ParseLevel(newCfg.Logging.Level)
+		if err != nil {
+			level = zerolog.InfoLevel
+		}
+		zerolog.SetGlobalLevel(level)
+		log.Info().
+			Str("from", cfg.Logging.Level).
+			Str("to", newCfg.Logging.Level).
+			Msg("Log level reloaded")
+		cfg.Logging.Level = newCfg.Logging.Level
+	}
+
+	origins := newCfg.Server.Security.CORSAllowedOrigins
+	if !slices.Equal(origins, cfg.Server.Security.CORSAllowedOrigins) {
+		if c, ok := app.transport.(transport.CORSConfigurable); ok {
+			c.SetCORSAllowedOrigins(origins)
+			log.Info().Strs("origins", origins).Msg("CORS allowed origins reloaded")
+		}
+		cfg.Server.Security.CORSAllowedOrigins = origins
+	}
+
+	// Settings that require a restart
+	if newCfg.Server.Listen != cfg.Server.Listen {
+		log.Warn().
+			Str("address", newCfg.Server.Listen.Address).
+			Int("port", newCfg.Server.Listen.Port).
+			Msg("Listen address change ignored, restart required")
+	}
+	if newCfg.Server.Transport != cfg.Server.Transport {
+		log.Warn().
+			Str("transport", newCfg.Server.Transport).
+			Msg("Transport change ignored, restart required")
+	}
+	if newCfg.Policy.Backend != cfg.Policy.Backend {
+		log.Warn().
+			Str("backend", newCfg.Policy.Backend).
+			Msg("Policy backend change ignored, restart required")
+	}
+
+	app.cfg.Store(cfg)
+	return nil
+}
+
+// initLogger configures the global logger. For file output it returns the
+// log file, which the caller closes on exit.
+func initLogger(cfg config.LoggingConfig) (io.Closer, error) {
 	// Set log level
 	level, err := zerolog.ParseLevel(cfg.Level)
 	if err != nil {
@@ -430,18 +1391,25 @@ func initLogger(cfg config.LoggingConfig) {
 
 	// Determine output destination
 	var output io.Writer = os.Stdout
+	var closer io.Closer
 	switch cfg.Output {
 	case "stderr":
 		output = os.Stderr
+	case "file":
+		file, err := newRotatingFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		output, closer = file, file
 	case "stdout", "":
 		output = os.Stdout
-		// File output could be added here if needed
 	}
 
 	// Configure output format
 	if cfg.Format == "text" {
 		log.Logger = log.Output(zerolog.ConsoleWriter{
 			Out:        output,
+			NoColor:    cfg.Output == "file",
 			TimeFormat: time.RFC3339,
 		})
 	} else {
@@ -451,4 +1419,5 @@ func initLogger(cfg config.LoggingConfig) {
 	}
 
 	log.Debug().Str("level", cfg.Level).Str("format", cfg.Format).Str("output", cfg.Output).Msg("Logger initialized")
+	return closer, nil
 }
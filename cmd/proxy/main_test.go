@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/audit"
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/observability"
+	"github.com/agentfacts/mcp-proxy/internal/policy"
+	"github.com/agentfacts/mcp-proxy/internal/router"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/rs/zerolog"
+)
+
+// corsTransport is a transport that records CORS origin updates.
+type corsTransport struct {
+	origins []string
+}
+
+func (t *corsTransport) Start(ctx context.Context) error                    { return nil }
+func (t *corsTransport) Stop(ctx context.Context) error                     { return nil }
+func (t *corsTransport) Name() string                                       { return "test" }
+func (t *corsTransport) SetMessageHandler(handler transport.MessageHandler) {}
+func (t *corsTransport) SetCORSAllowedOrigins(origins []string)             { t.origins = origins }
+
+// slowTransport is a transport whose Stop ignores its context and blocks
+// until released, like a server stuck draining connections. finish, if set,
+// runs before Stop returns, like the last request completing.
+type slowTransport struct {
+	corsTransport
+	release chan struct{}
+	finish  func()
+}
+
+func (t *slowTransport) Stop(ctx context.Context) error {
+	<-t.release
+	if t.finish != nil {
+		t.finish()
+	}
+	return nil
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+// TestReloadConfig tests that a reload applies the live-reloadable settings.
+func TestReloadConfig(t *testing.T) {
+	prevLevel := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(prevLevel) })
+
+	path := filepath.Join(t.TempDir(), "proxy.yaml")
+	writeConfig(t, path, `
+server:
+  listen:
+    port: 8080
+policy:
+  mode: enforce
+logging:
+  level: info
+`)
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tr := &corsTransport{}
+	app := &Application{
+		transport:    tr,
+		policyEngine: policy.NewEngine(policy.EngineConfig{Mode: cfg.Policy.Mode, Enabled: true}),
+	}
+	app.cfg.Store(cfg)
+
+	writeConfig(t, path, `
+server:
+  listen:
+    port: 9090
+  security:
+    cors_allowed_origins: ["https://app.example.com"]
+policy:
+  mode: audit
+logging:
+  level: debug
+`)
+
+	if err := app.reloadConfig(path); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+
+	if app.policyEngine.Mode() != "audit" {
+		t.Errorf("Mode() = %s, want audit", app.policyEngine.Mode())
+	}
+	if zerolog.GlobalLevel() != zerolog.DebugLevel {
+		t.Errorf("GlobalLevel() = %s, want debug", zerolog.GlobalLevel())
+	}
+	if !slices.Equal(tr.origins, []string{"https://app.example.com"}) {
+		t.Errorf("CORS origins = %v, want [https://app.example.com]", tr.origins)
+	}
+	if app.cfg.Load().Server.Listen.Port != 8080 {
+		t.Errorf("Listen port = %d, want 8080 (not reloadable)", app.cfg.Load().Server.Listen.Port)
+	}
+
+	// An invalid file leaves the running configuration untouched
+	writeConfig(t, path, "policy:\n  mode: permissive\n")
+	if err := app.reloadConfig(path); err == nil {
+		t.Error("reloadConfig() expected error for invalid config")
+	}
+	if app.policyEngine.Mode() != "audit" {
+		t.Errorf("Mode() = %s after failed reload, want audit", app.policyEngine.Mode())
+	}
+}
+
+// TestPolicyInputIdentity tests that the session's verified identity reaches
+// policy evaluation, so identity-based rules can match, and that decisions
+// cached for one identity are not reused for another.
+func TestPolicyInputIdentity(t *testing.T) {
+	ctx := context.Background()
+	modules := map[string]string{"identity.rego": `
+package mcp.policy
+
+import future.keywords.in
+
+default allow = false
+
+allow {
+	not input.request.tool in data.pii_tools
+}
+
+allow {
+	input.request.tool in data.pii_tools
+	input.identity.verified
+}
+
+decision = {"allow": allow}
+`}
+
+	type identity struct {
+		name      string
+		verified  bool
+		did       string
+		wantAllow bool
+	}
+	verified := identity{"verified", true, "did:web:agent.example.com", true}
+	unverified := identity{"unverified", false, "", false}
+
+	tests := []struct {
+		name  string
+		order []identity
+	}{
+		{"verified first", []identity{verified, unverified}},
+		{"unverified first", []identity{unverified, verified}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := policy.NewEngine(policy.EngineConfig{
+				Mode:        "enforce",
+				Enabled:     true,
+				CacheConfig: policy.CacheConfig{Enabled: true},
+			})
+			if err := engine.SetPolicyData(map[string]interface{}{
+				"pii_tools": []interface{}{"customer_lookup"},
+			}); err != nil {
+				t.Fatalf("SetPolicyData() error = %v", err)
+			}
+			if err := engine.LoadPolicies(ctx, modules); err != nil {
+				t.Fatalf("LoadPolicies() error = %v", err)
+			}
+
+			app := &Application{policyEngine: engine}
+			app.cfg.Store(&config.Config{})
+
+			for _, id := range tt.order {
+				sess := session.NewSession("sess_" + id.name)
+				sess.SetIdentity(id.verified, id.did)
+
+				input := app.buildPolicyInput(sess, "tools/call", "customer_lookup", "", nil)
+				if input.Identity.Verified != id.verified || input.Identity.DID != id.did {
+					t.Errorf("%s: Identity = %+v, want verified=%v did=%q", id.name, input.Identity, id.verified, id.did)
+				}
+
+				result, err := engine.Evaluate(ctx, input)
+				if err != nil {
+					t.Fatalf("%s: Evaluate() error = %v", id.name, err)
+				}
+				if result.Decision.Allow != id.wantAllow {
+					t.Errorf("%s: Allow = %v, want %v (cache hit = %v)", id.name, result.Decision.Allow, id.wantAllow, result.CacheHit)
+				}
+			}
+		})
+	}
+}
+
+// TestPolicyInputCumulativeCounts tests that session read and write counters
+// reach the policy input.
+func TestPolicyInputCumulativeCounts(t *testing.T) {
+	app := &Application{}
+	app.cfg.Store(&config.Config{})
+
+	sess := session.NewSession("sess_counts")
+	for i := 0; i < 3; i++ {
+		sess.IncrementReads()
+	}
+	sess.IncrementWrites()
+
+	input := app.buildPolicyInput(sess, "tools/call", "ticket_update", "", nil)
+	if input.Session.CumulativeReads != 3 || input.Session.CumulativeWrites != 1 {
+		t.Errorf("Session = %+v, want 3 reads and 1 write", input.Session)
+	}
+
+	data := &policy.PolicyData{ToolCapabilities: map[string]string{
+		"ticket_read":   "read:tickets",
+		"ticket_update": "write:tickets",
+		"admin_panel":   "admin:*",
+	}}
+	writeTools := data.WriteTools()
+	if !writeTools["ticket_update"] || !writeTools["admin_panel"] || writeTools["ticket_read"] {
+		t.Errorf("WriteTools() = %v, want ticket_update and admin_panel", writeTools)
+	}
+}
+
+// TestReloadPolicyData tests that reloading the policy data refreshes the
+// blocked DIDs and write tools derived from it, and clears cached responses.
+func TestReloadPolicyData(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.json")
+	writeConfig(t, dataFile, `{"tool_capabilities": {"ticket_read": "read:tickets"}, "blocked_dids": []}`)
+
+	cfg := &config.Config{}
+	cfg.Policy.PolicyDir = dir
+	cfg.Policy.DataFile = dataFile
+
+	cache := router.NewResponseCache([]string{"tools/list"}, time.Minute, 10)
+	app := &Application{
+		router:        router.NewRouter(),
+		policyBackend: policy.NewCapabilityMatcher("enforce"),
+		responseCache: cache,
+	}
+	app.cfg.Store(cfg)
+	if _, err := app.reloadPolicyData(context.Background()); err != nil {
+		t.Fatalf("reloadPolicyData() error = %v", err)
+	}
+
+	const did = "did:web:agent.example.com"
+	if err := app.policyDerived.Load().didFilter.Check(did); err != nil {
+		t.Fatalf("Check(%s) error = %v before reload", did, err)
+	}
+
+	cache.Put("tools/list", []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`))
+	writeConfig(t, dataFile, `{"tool_capabilities": {"ticket_update": "write:tickets"}, "blocked_dids": ["`+did+`"]}`)
+	if _, err := app.reloadPolicyData(context.Background()); err != nil {
+		t.Fatalf("reloadPolicyData() error = %v", err)
+	}
+
+	derived := app.policyDerived.Load()
+	if err := derived.didFilter.Check(did); !errors.Is(err, policy.ErrDIDBlocked) {
+		t.Errorf("Check(%s) error = %v after reload, want ErrDIDBlocked", did, err)
+	}
+	if !derived.writeTools["ticket_update"] {
+		t.Errorf("writeTools = %v after reload, want ticket_update", derived.writeTools)
+	}
+	if n := cache.Len(); n != 0 {
+		t.Errorf("response cache entries = %d after reload, want 0", n)
+	}
+}
+
+// TestBundlePolicyData tests that the policy bundle's data reaches the DID
+// filter, and that the admin reload reloads the bundle rather than the
+// local data file.
+func TestBundlePolicyData(t *testing.T) {
+	const did = "did:web:agent.example.com"
+	var (
+		mu      sync.Mutex
+		blocked = []interface{}{did}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const module = "package mcp.policy\n\ndecision = {\"allow\": true}\n"
+		mu.Lock()
+		b := bundle.Bundle{
+			Modules: []bundle.ModuleFile{{
+				URL:    "/mcp/policy.rego",
+				Path:   "/mcp/policy.rego",
+				Raw:    []byte(module),
+				Parsed: ast.MustParseModule(module),
+			}},
+			Data: map[string]interface{}{"blocked_dids": blocked},
+		}
+		mu.Unlock()
+		if err := bundle.NewWriter(w).Write(b); err != nil {
+			t.Errorf("Failed to write bundle: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.json")
+	writeConfig(t, dataFile, `{"blocked_dids": []}`)
+
+	cfg := &config.Config{}
+	cfg.Policy.PolicyDir = dir
+	cfg.Policy.DataFile = dataFile
+	cfg.Policy.Bundle.URL = srv.URL
+	cfg.Policy.Bundle.PollInterval = time.Hour
+
+	engine := policy.NewEngine(policy.EngineConfig{Mode: "enforce", Enabled: true})
+	app := &Application{
+		router:        router.NewRouter(),
+		policyEngine:  engine,
+		policyBackend: engine,
+	}
+	app.cfg.Store(cfg)
+	app.applyPolicyData(&policy.PolicyData{})
+
+	ctx := context.Background()
+	if err := app.startBundlePolling(ctx); err != nil {
+		t.Fatalf("startBundlePolling() error = %v", err)
+	}
+	defer app.stopBundlePoll()
+	if err := app.policyDerived.Load().didFilter.Check(did); !errors.Is(err, policy.ErrDIDBlocked) {
+		t.Errorf("Check(%s) error = %v with the bundle loaded, want ErrDIDBlocked", did, err)
+	}
+
+	mu.Lock()
+	blocked = []interface{}{}
+	mu.Unlock()
+	if _, err := app.reloadPolicyData(ctx); err != nil {
+		t.Fatalf("reloadPolicyData() error = %v", err)
+	}
+	if err := app.policyDerived.Load().didFilter.Check(did); err != nil {
+		t.Errorf("Check(%s) error = %v after the bundle reload, want nil", did, err)
+	}
+}
+
+// TestReloadPolicyDataWarmUp tests that reloading the policy data warms the
+// decision cache up again after the reload clears it.
+func TestReloadPolicyDataWarmUp(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "data.json")
+	writeConfig(t, dataFile, `{"tool_capabilities": {"ticket_read": "read:tickets", "ticket_update": "write:tickets"}}`)
+
+	cfg := &config.Config{}
+	cfg.Policy.Backend = policy.BackendOPA
+	cfg.Policy.PolicyDir = dir
+	cfg.Policy.DataFile = dataFile
+	cfg.Policy.WarmUp.Enabled = true
+	cfg.Policy.WarmUp.Agents = []config.AgentConfig{{ID: "agent1"}}
+
+	engine := policy.NewEngine(policy.EngineConfig{
+		Mode:        "enforce",
+		Enabled:     true,
+		CacheConfig: policy.CacheConfig{Enabled: true, TTL: time.Minute},
+	})
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, map[string]string{"allow.rego": `
+package mcp.policy
+
+decision = {"allow": true, "matched_rule": "allow_all", "violations": []}
+`}); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	app := &Application{
+		router:        router.NewRouter(),
+		policyEngine:  engine,
+		policyBackend: engine,
+	}
+	app.cfg.Store(cfg)
+	if _, err := app.reloadPolicyData(ctx); err != nil {
+		t.Fatalf("reloadPolicyData() error = %v", err)
+	}
+	if entries := engine.Stats().CacheStats.Entries; entries != 2 {
+		t.Errorf("cache entries = %d after reload, want 2", entries)
+	}
+}
+
+// TestStopFlushesAuditAfterSlowTransport tests that a transport overrunning
+// its shutdown timeout doesn't keep buffered audit records from being
+// flushed.
+func TestStopFlushesAuditAfterSlowTransport(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "audit.db")
+	store, err := audit.NewStore(audit.StoreConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	// Records are only flushed when the writer stops
+	writer := audit.NewWriter(store, audit.WriterConfig{BufferSize: 100, FlushInterval: time.Hour})
+	writer.Start()
+	writer.Write(audit.NewRecordBuilder().
+		WithRequest("req_1", "sess_1").
+		WithMethod("tools/call", "read_file", "", "").
+		WithDecision(true, "allow_all", "", "enforce").
+		Build())
+
+	cfg := &config.Config{}
+	cfg.Server.ShutdownTimeouts = config.ShutdownConfig{
+		Transport: 50 * time.Millisecond,
+		Upstream:  time.Second,
+		Sessions:  time.Second,
+		Audit:     500 * time.Millisecond,
+	}
+
+	tr := &slowTransport{release: make(chan struct{})}
+	t.Cleanup(func() { close(tr.release) })
+
+	health := observability.NewHealth("test")
+	app := &Application{
+		transport:      tr,
+		sessionManager: session.NewManager(session.ManagerConfig{}),
+		auditStore:     store,
+		auditWriter:    writer,
+		auditSink:      writer,
+		health:         health,
+		obsServer:      observability.NewServer(observability.ServerConfig{}, nil, health),
+	}
+	app.cfg.Store(cfg)
+
+	start := time.Now()
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Stop() took %s, want the transport abandoned after its timeout", elapsed)
+	}
+
+	reopened, err := audit.NewStore(audit.StoreConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer reopened.Close()
+
+	records, err := reopened.Query(context.Background(), audit.QueryOptions{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 1 || records[0].RequestID != "req_1" {
+		t.Errorf("flushed records = %d, want req_1", len(records))
+	}
+}
+
+// TestStopWaitsForTransportBeforeAudit tests that requests a transport
+// finishes after overrunning its shutdown timeout still get their audit
+// records flushed, rather than written to closed sinks.
+func TestStopWaitsForTransportBeforeAudit(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "audit.db")
+	store, err := audit.NewStore(audit.StoreConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	writer := audit.NewWriter(store, audit.WriterConfig{BufferSize: 100, FlushInterval: time.Hour})
+	writer.Start()
+
+	cfg := &config.Config{}
+	cfg.Server.ShutdownTimeouts = config.ShutdownConfig{
+		Transport: 50 * time.Millisecond,
+		Upstream:  time.Second,
+		Sessions:  time.Second,
+		Audit:     5 * time.Second,
+	}
+
+	// The last request completes 200ms after the transport timeout
+	tr := &slowTransport{release: make(chan struct{})}
+	tr.finish = func() {
+		writer.Write(audit.NewRecordBuilder().
+			WithRequest("req_late", "sess_1").
+			WithMethod("tools/call", "read_file", "", "").
+			WithDecision(true, "allow_all", "", "enforce").
+			Build())
+	}
+	time.AfterFunc(250*time.Millisecond, func() { close(tr.release) })
+
+	health := observability.NewHealth("test")
+	app := &Application{
+		transport:      tr,
+		sessionManager: session.NewManager(session.ManagerConfig{}),
+		auditStore:     store,
+		auditWriter:    writer,
+		auditSink:      writer,
+		health:         health,
+		obsServer:      observability.NewServer(observability.ServerConfig{}, nil, health),
+	}
+	app.cfg.Store(cfg)
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	reopened, err := audit.NewStore(audit.StoreConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer reopened.Close()
+
+	records, err := reopened.Query(context.Background(), audit.QueryOptions{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 1 || records[0].RequestID != "req_late" {
+		t.Errorf("flushed records = %d, want req_late", len(records))
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// runPrintConfig writes the effective configuration, after defaults,
+// environment overrides and secret references, to w as YAML with sensitive
+// values masked. It returns the process exit code.
+func runPrintConfig(cfg *config.Config, w io.Writer) int {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg.MaskSensitive()); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", err)
+		return 1
+	}
+	if err := enc.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/policy"
+)
+
+// runTestPolicies loads the configured policies and data into the
+// configured backend, evaluates the test cases in casesPath against them
+// and writes a PASS/FAIL line per case to w. It returns the process exit
+// code: 0 if every case passed, 1 otherwise.
+func runTestPolicies(ctx context.Context, cfg *config.Config, casesPath string, w io.Writer) int {
+	cases, err := policy.LoadTestCases(casesPath)
+	if err != nil {
+		fmt.Fprintf(w, "ERROR   %v\n", err)
+		return 1
+	}
+
+	var backend policy.PolicyBackend
+	loader := policy.NewLoader(cfg.Policy.PolicyDir, cfg.Policy.DataFile)
+	if cfg.Policy.Backend == policy.BackendCapability {
+		matcher := policy.NewCapabilityMatcher(cfg.Policy.Mode)
+		_, err = loader.ReloadData(matcher)
+		backend = matcher
+	} else {
+		engine := policy.NewEngine(policy.EngineConfig{
+			Mode:                cfg.Policy.Mode,
+			Enabled:             true,
+			EvalTimeout:         cfg.Policy.Evaluation.Timeout,
+			StrictBuiltinErrors: cfg.Policy.Evaluation.StrictBuiltinErrors,
+		})
+		err = loader.LoadAndInitialize(ctx, engine)
+		backend = engine
+	}
+	if err != nil {
+		fmt.Fprintf(w, "ERROR   %v\n", err)
+		return 1
+	}
+
+	report := policy.RunTestCases(ctx, backend, cases)
+	for _, r := range report.Results {
+		if r.Passed {
+			fmt.Fprintf(w, "PASS    %s\n", r.Case.Name)
+			continue
+		}
+		fmt.Fprintf(w, "FAIL    %s: %s\n", r.Case.Name, r.Reason)
+		if r.Result.Decision != nil && len(r.Result.Decision.Violations) > 0 {
+			messages := make([]string, len(r.Result.Decision.Violations))
+			for i, v := range r.Result.Decision.Violations {
+				messages[i] = v.Message
+			}
+			fmt.Fprintf(w, "        violations: %s\n", strings.Join(messages, "; "))
+		}
+	}
+
+	fmt.Fprintf(w, "Policy tests: %d passed, %d failed\n", report.Passed, report.Failed)
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// TestRunTestPolicies tests the -test-policies report and exit code.
+func TestRunTestPolicies(t *testing.T) {
+	policy := `package mcp.policy
+
+import rego.v1
+
+default allow := false
+
+allow if input.request.tool == "read_file"
+
+decision := {"allow": allow, "violations": [v | allow == false; v := "only read_file is allowed"], "matched_rule": "test"}
+`
+
+	tests := []struct {
+		name     string
+		cases    string
+		wantCode int
+		wantOut  []string
+	}{
+		{
+			name:     "all pass",
+			cases:    `[{"name": "read", "input": {"request": {"tool": "read_file"}}, "expect": "allow"}, {"name": "write", "input": {"request": {"tool": "write_file"}}, "expect": "deny"}]`,
+			wantCode: 0,
+			wantOut:  []string{"PASS    read", "PASS    write", "Policy tests: 2 passed, 0 failed"},
+		},
+		{
+			name:     "failure",
+			cases:    `[{"name": "write", "input": {"request": {"tool": "write_file"}}, "expect": "allow"}]`,
+			wantCode: 1,
+			wantOut:  []string{"FAIL    write: expected allow, got deny", "violations: only read_file is allowed", "0 passed, 1 failed"},
+		},
+		{
+			name:     "invalid cases",
+			cases:    `[{"name": "write", "input": {}, "expect": "maybe"}]`,
+			wantCode: 1,
+			wantOut:  []string{"ERROR   test case 0 (write): expect must be allow or deny"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{
+				"main.rego":  policy,
+				"data.json":  "{}",
+				"cases.json": tt.cases,
+			}
+			for name, content := range files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+
+			cfg := &config.Config{}
+			cfg.Policy.PolicyDir = dir
+			cfg.Policy.DataFile = filepath.Join(dir, "data.json")
+
+			var out bytes.Buffer
+			if code := runTestPolicies(context.Background(), cfg, filepath.Join(dir, "cases.json"), &out); code != tt.wantCode {
+				t.Errorf("runTestPolicies() = %d, want %d\n%s", code, tt.wantCode, out.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Output = %q, want it to contain %q", out.String(), want)
+				}
+			}
+		})
+	}
+}
+
+// TestRunTestPoliciesCapability tests that -test-policies evaluates the
+// cases on the capability backend when it is configured, with no Rego.
+func TestRunTestPoliciesCapability(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"data.json":  `{"tool_capabilities": {"delete_file": "admin:files"}}`,
+		"cases.json": `[{"name": "read", "input": {"request": {"tool": "read_file"}}, "expect": "allow"}, {"name": "delete", "input": {"request": {"tool": "delete_file"}}, "expect": "deny", "matched_rule": "missing_capability"}]`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	cfg := &config.Config{}
+	cfg.Policy.Backend = "capability"
+	cfg.Policy.PolicyDir = dir
+	cfg.Policy.DataFile = filepath.Join(dir, "data.json")
+
+	var out bytes.Buffer
+	if code := runTestPolicies(context.Background(), cfg, filepath.Join(dir, "cases.json"), &out); code != 0 {
+		t.Errorf("runTestPolicies() = %d, want 0\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Policy tests: 2 passed, 0 failed") {
+		t.Errorf("Output = %q, want both cases passed", out.String())
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/policy"
+)
+
+// runValidate compiles the configured policies without starting the proxy
+// and writes a report to w. The capability backend has no policies, so only
+// its data file is checked. The configuration has already been loaded and
+// validated. It returns the process exit code: 0 if everything is valid,
+// 1 otherwise.
+func runValidate(ctx context.Context, cfg *config.Config, w io.Writer) int {
+	fmt.Fprintln(w, "Configuration: OK")
+	for _, warning := range cfg.Warnings() {
+		fmt.Fprintf(w, "WARNING %s\n", warning)
+	}
+
+	loader := policy.NewLoader(cfg.Policy.PolicyDir, cfg.Policy.DataFile)
+	if cfg.Policy.Backend == policy.BackendCapability {
+		if _, err := loader.ReloadData(policy.NewCapabilityMatcher(cfg.Policy.Mode)); err != nil {
+			fmt.Fprintf(w, "ERROR   %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(w, "Policy data: OK (capability backend) in %s\n", cfg.Policy.DataFile)
+		return 0
+	}
+
+	report := loader.Validate(ctx)
+
+	for _, warn := range report.Warnings {
+		fmt.Fprintf(w, "WARNING %s\n", warn)
+	}
+	for _, issue := range report.Errors {
+		fmt.Fprintf(w, "ERROR   %s\n", issue)
+	}
+
+	if !report.OK() {
+		fmt.Fprintf(w, "Policies: %d error(s), %d warning(s) in %s\n",
+			len(report.Errors), len(report.Warnings), cfg.Policy.PolicyDir)
+		return 1
+	}
+
+	fmt.Fprintf(w, "Policies: OK (%d modules, %d warning(s)) in %s\n",
+		report.Modules, len(report.Warnings), cfg.Policy.PolicyDir)
+	return 0
+}
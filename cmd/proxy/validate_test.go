@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// TestRunValidate tests the -validate report and exit code.
+func TestRunValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		wantCode int
+		wantOut  string
+	}{
+		{"valid", "package mcp.policy\n\ndecision = {\"allow\": true}\n", 0, "Policies: OK (1 modules"},
+		{"invalid", "package mcp.policy\n\ndecision = {\n", 1, "main.rego:4:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "main.rego"), []byte(tt.policy), 0o600); err != nil {
+				t.Fatalf("Failed to write policy: %v", err)
+			}
+
+			cfg := &config.Config{}
+			cfg.Policy.PolicyDir = dir
+
+			var out bytes.Buffer
+			if code := runValidate(context.Background(), cfg, &out); code != tt.wantCode {
+				t.Errorf("runValidate() = %d, want %d\n%s", code, tt.wantCode, out.String())
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("Output = %q, want it to contain %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+// TestRunValidateCapability tests that -validate checks only the data file
+// for the capability backend.
+func TestRunValidateCapability(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantCode int
+		wantOut  string
+	}{
+		{"valid", `{"tool_capabilities": {"delete_file": "admin:files"}}`, 0, "Policy data: OK (capability backend)"},
+		{"invalid", `{"tool_capabilities": ["admin:files"]}`, 1, "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dataFile := filepath.Join(dir, "data.json")
+			if err := os.WriteFile(dataFile, []byte(tt.data), 0o600); err != nil {
+				t.Fatalf("Failed to write data: %v", err)
+			}
+
+			cfg := &config.Config{}
+			cfg.Policy.Backend = "capability"
+			cfg.Policy.PolicyDir = dir
+			cfg.Policy.DataFile = dataFile
+
+			var out bytes.Buffer
+			if code := runValidate(context.Background(), cfg, &out); code != tt.wantCode {
+				t.Errorf("runValidate() = %d, want %d\n%s", code, tt.wantCode, out.String())
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("Output = %q, want it to contain %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
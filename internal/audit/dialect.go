@@ -0,0 +1,291 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Supported audit store drivers.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// dialect captures the differences between the SQL databases the audit store
+// runs on. Queries are written with "?" placeholders and rebound per dialect.
+type dialect interface {
+	// driverName is the database/sql driver to open.
+	driverName() string
+
+	// dataSource builds the connection string from the store configuration.
+	dataSource(cfg StoreConfig) string
+
+	// configurePool applies connection pool limits suited to the database.
+	configurePool(db *sql.DB)
+
+	// schema returns the statements that create the audit table and indexes.
+	schema() string
+
+	// migrate brings tables created by earlier versions up to date.
+	migrate(db *sql.DB) error
+
+	// rebind rewrites "?" placeholders into the dialect's native form.
+	rebind(query string) string
+
+	// epochSeconds returns an expression converting a timestamp column to
+	// integer Unix seconds.
+	epochSeconds(column string) string
+}
+
+// dialectFor returns the dialect for a configured driver name.
+func dialectFor(driver string) (dialect, error) {
+	switch driver {
+	case "", DriverSQLite:
+		return sqliteDialect{}, nil
+	case DriverPostgres:
+		return postgresDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported audit driver: %s", driver)
+	}
+}
+
+// sqliteDialect stores audit records in a local SQLite file.
+type sqliteDialect struct{}
+
+func (sqliteDialect) driverName() string { return "sqlite3" }
+
+func (sqliteDialect) dataSource(cfg StoreConfig) string {
+	path := cfg.DBPath
+	if path == "" {
+		path = "audit.db"
+	}
+	return path + "?_journal_mode=WAL&_busy_timeout=5000"
+}
+
+func (sqliteDialect) configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(1) // SQLite only supports one writer
+	db.SetMaxIdleConns(1)
+}
+
+func (sqliteDialect) schema() string {
+	return `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		latency_ms REAL,
+		policy_latency_ms REAL,
+		upstream_latency_ms REAL,
+
+		-- Agent info
+		agent_id TEXT NOT NULL,
+		agent_name TEXT,
+		capabilities TEXT,
+
+		-- Request info
+		method TEXT NOT NULL,
+		tool TEXT,
+		resource_uri TEXT,
+		arguments TEXT,
+		arguments_truncated INTEGER DEFAULT 0,
+
+		-- Identity info
+		identity_verified INTEGER DEFAULT 0,
+		did TEXT,
+
+		-- Policy decision
+		allowed INTEGER NOT NULL,
+		matched_rule TEXT,
+		violations TEXT,
+		policy_mode TEXT,
+		obligations TEXT,
+		dry_run INTEGER DEFAULT 0,
+		echoed INTEGER DEFAULT 0,
+
+		-- Environment
+		source_ip TEXT,
+		environment TEXT
+	);
+` + indexSchema
+}
+
+func (sqliteDialect) migrate(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(audit_log)")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    bool
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !columns["obligations"] {
+		if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN obligations TEXT"); err != nil {
+			return fmt.Errorf("failed to add obligations column: %w", err)
+		}
+	}
+	if !columns["dry_run"] {
+		if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN dry_run INTEGER DEFAULT 0"); err != nil {
+			return fmt.Errorf("failed to add dry_run column: %w", err)
+		}
+	}
+	if !columns["echoed"] {
+		if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN echoed INTEGER DEFAULT 0"); err != nil {
+			return fmt.Errorf("failed to add echoed column: %w", err)
+		}
+	}
+	if !columns["arguments_truncated"] {
+		if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN arguments_truncated INTEGER DEFAULT 0"); err != nil {
+			return fmt.Errorf("failed to add arguments_truncated column: %w", err)
+		}
+	}
+	for _, column := range []string{"policy_latency_ms", "upstream_latency_ms"} {
+		if !columns[column] {
+			if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN " + column + " REAL"); err != nil {
+				return fmt.Errorf("failed to add %s column: %w", column, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) epochSeconds(column string) string {
+	return "CAST(strftime('%s', " + column + ") AS INTEGER)"
+}
+
+// postgresDialect stores audit records in PostgreSQL. It supports many
+// concurrent writers. A database/sql driver registered as "postgres"
+// (for example github.com/lib/pq) must be linked into the binary.
+type postgresDialect struct{}
+
+func (postgresDialect) driverName() string { return "postgres" }
+
+func (postgresDialect) dataSource(cfg StoreConfig) string { return cfg.DSN }
+
+func (postgresDialect) configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(16)
+	db.SetMaxIdleConns(4)
+}
+
+func (postgresDialect) schema() string {
+	return `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		request_id TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		timestamp TIMESTAMPTZ NOT NULL DEFAULT now(),
+		latency_ms DOUBLE PRECISION,
+		policy_latency_ms DOUBLE PRECISION,
+		upstream_latency_ms DOUBLE PRECISION,
+
+		-- Agent info
+		agent_id TEXT NOT NULL,
+		agent_name TEXT,
+		capabilities TEXT,
+
+		-- Request info
+		method TEXT NOT NULL,
+		tool TEXT,
+		resource_uri TEXT,
+		arguments TEXT,
+		arguments_truncated BOOLEAN DEFAULT FALSE,
+
+		-- Identity info
+		identity_verified BOOLEAN DEFAULT FALSE,
+		did TEXT,
+
+		-- Policy decision
+		allowed BOOLEAN NOT NULL,
+		matched_rule TEXT,
+		violations TEXT,
+		policy_mode TEXT,
+		obligations TEXT,
+		dry_run BOOLEAN DEFAULT FALSE,
+		echoed BOOLEAN DEFAULT FALSE,
+
+		-- Environment
+		source_ip TEXT,
+		environment TEXT
+	);
+` + indexSchema
+}
+
+func (postgresDialect) migrate(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS obligations TEXT"); err != nil {
+		return fmt.Errorf("failed to add obligations column: %w", err)
+	}
+	if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS dry_run BOOLEAN DEFAULT FALSE"); err != nil {
+		return fmt.Errorf("failed to add dry_run column: %w", err)
+	}
+	if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS echoed BOOLEAN DEFAULT FALSE"); err != nil {
+		return fmt.Errorf("failed to add echoed column: %w", err)
+	}
+	if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS arguments_truncated BOOLEAN DEFAULT FALSE"); err != nil {
+		return fmt.Errorf("failed to add arguments_truncated column: %w", err)
+	}
+	for _, column := range []string{"policy_latency_ms", "upstream_latency_ms"} {
+		if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS " + column + " DOUBLE PRECISION"); err != nil {
+			return fmt.Errorf("failed to add %s column: %w", column, err)
+		}
+	}
+	return nil
+}
+
+func (postgresDialect) rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			b.WriteByte(query[i])
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+func (postgresDialect) epochSeconds(column string) string {
+	return "CAST(EXTRACT(EPOCH FROM " + column + ") AS BIGINT)"
+}
+
+// indexSchema creates the indexes for common queries. The syntax is shared
+// by every supported database.
+const indexSchema = `
+	CREATE INDEX IF NOT EXISTS idx_audit_timestamp ON audit_log(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_audit_agent_id ON audit_log(agent_id);
+	CREATE INDEX IF NOT EXISTS idx_audit_session_id ON audit_log(session_id);
+	CREATE INDEX IF NOT EXISTS idx_audit_method ON audit_log(method);
+	CREATE INDEX IF NOT EXISTS idx_audit_allowed ON audit_log(allowed);
+	CREATE INDEX IF NOT EXISTS idx_audit_tool ON audit_log(tool);
+`
+
+// driverRegistered reports whether a database/sql driver is linked in.
+func driverRegistered(name string) bool {
+	return slices.Contains(sql.Drivers(), name)
+}
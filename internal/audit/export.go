@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Export formats.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// csvHeader lists the exported columns, matching the Record JSON field names.
+var csvHeader = []string{
+	"id", "request_id", "session_id", "timestamp", "latency_ms", "policy_latency_ms", "upstream_latency_ms",
+	"agent_id", "agent_name", "capabilities",
+	"method", "tool", "resource_uri", "arguments", "arguments_truncated",
+	"identity_verified", "did",
+	"allowed", "matched_rule", "violations", "policy_mode", "obligations", "dry_run", "echoed",
+	"source_ip", "environment",
+}
+
+// exportPageSize is the most records Export reads per query. Each page is
+// read in full before it is written out, so a slow export reader never holds
+// the database connection that audit writes need.
+var exportPageSize = 1000
+
+// recordEncoder writes records in one export format.
+type recordEncoder interface {
+	encode(r *Record) error
+	flush() error
+}
+
+// Export streams records matching opts to w as CSV (with a header row) or
+// newline-delimited JSON. Records are read and written a page at a time, so
+// neither the result set nor a database connection is held for the whole
+// export. Cancelling ctx aborts the export.
+func (s *Store) Export(ctx context.Context, opts QueryOptions, format string, w io.Writer) error {
+	var enc recordEncoder
+	switch format {
+	case FormatCSV:
+		c := &csvEncoder{w: csv.NewWriter(w)}
+		if err := c.w.Write(csvHeader); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		enc = c
+	case FormatJSONL:
+		enc = &jsonlEncoder{enc: json.NewEncoder(w)}
+	default:
+		return fmt.Errorf("unsupported export format: %s (must be csv or jsonl)", format)
+	}
+
+	page := opts
+	for {
+		page.Limit = exportPageSize
+		if remaining := opts.Limit - (page.Offset - opts.Offset); opts.Limit > 0 && remaining < page.Limit {
+			page.Limit = remaining
+		}
+		if page.Limit <= 0 {
+			break
+		}
+
+		records, err := s.Query(ctx, page)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := enc.encode(r); err != nil {
+				return fmt.Errorf("failed to write record: %w", err)
+			}
+		}
+		if len(records) < page.Limit {
+			break
+		}
+		page.Offset += len(records)
+	}
+
+	return enc.flush()
+}
+
+// csvEncoder writes one CSV row per record.
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) encode(r *Record) error {
+	return e.w.Write([]string{
+		strconv.FormatInt(r.ID, 10), r.RequestID, r.SessionID,
+		r.Timestamp.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(r.Latency, 'f', -1, 64),
+		strconv.FormatFloat(r.PolicyLatency, 'f', -1, 64),
+		strconv.FormatFloat(r.UpstreamLatency, 'f', -1, 64),
+		r.AgentID, r.AgentName, r.Capabilities,
+		r.Method, r.Tool, r.ResourceURI, r.Arguments, strconv.FormatBool(r.ArgumentsTruncated),
+		strconv.FormatBool(r.IdentityVerified), r.DID,
+		strconv.FormatBool(r.Allowed), r.MatchedRule, r.Violations, r.PolicyMode, r.Obligations, strconv.FormatBool(r.DryRun), strconv.FormatBool(r.Echoed),
+		r.SourceIP, r.Environment,
+	})
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonlEncoder writes one JSON object per line.
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) encode(r *Record) error {
+	return e.enc.Encode(r)
+}
+
+func (e *jsonlEncoder) flush() error {
+	return nil
+}
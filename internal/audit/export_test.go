@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newExportStore(t *testing.T, n int) *Store {
+	t.Helper()
+
+	store, err := NewStore(StoreConfig{DBPath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	for i := 0; i < n; i++ {
+		record := NewRecordBuilder().
+			WithRequest("req", "sess").
+			WithAgent("agent1", "Agent, \"One\"", `["read"]`).
+			WithMethod("tools/call", "read_file", "", `{"path":"/tmp/a"}`).
+			WithDecision(i%2 == 0, "rule", "", "enforce").
+			Build()
+		record.Timestamp = time.Now().Add(time.Duration(i) * time.Second)
+		if err := store.Insert(context.Background(), record); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	return store
+}
+
+// TestExportCSV tests CSV export with a header row and quoted values.
+func TestExportCSV(t *testing.T) {
+	store := newExportStore(t, 3)
+
+	var buf bytes.Buffer
+	if err := store.Export(context.Background(), QueryOptions{}, FormatCSV, &buf); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("CSV rows = %d, want 4 (header + 3)", len(rows))
+	}
+	if rows[0][0] != "id" || len(rows[0]) != len(csvHeader) {
+		t.Errorf("Unexpected header: %v", rows[0])
+	}
+	if rows[1][8] != `Agent, "One"` {
+		t.Errorf("agent_name = %q, want quoted value preserved", rows[1][8])
+	}
+	if rows[1][17] != "true" || rows[2][17] != "false" {
+		t.Errorf("allowed columns = %s, %s, want true, false", rows[1][17], rows[2][17])
+	}
+}
+
+// TestExportJSONL tests newline-delimited JSON export with filters.
+func TestExportJSONL(t *testing.T) {
+	store := newExportStore(t, 4)
+
+	allowed := true
+	var buf bytes.Buffer
+	if err := store.Export(context.Background(), QueryOptions{Allowed: &allowed}, FormatJSONL, &buf); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		if !r.Allowed {
+			t.Error("Exported record should match the allowed filter")
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("JSONL lines = %d, want 2", lines)
+	}
+}
+
+// TestExportEmpty tests exports with no matching records.
+func TestExportEmpty(t *testing.T) {
+	store := newExportStore(t, 0)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatCSV, "id,request_id,session_id,timestamp,latency_ms,policy_latency_ms,upstream_latency_ms,agent_id,agent_name,capabilities," +
+			"method,tool,resource_uri,arguments,arguments_truncated,identity_verified,did," +
+			"allowed,matched_rule,violations,policy_mode,obligations,dry_run,echoed,source_ip,environment\n"},
+		{FormatJSONL, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := store.Export(context.Background(), QueryOptions{}, tt.format, &buf); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Export() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestExportErrors tests invalid formats and cancellation.
+func TestExportErrors(t *testing.T) {
+	store := newExportStore(t, 3)
+
+	var buf bytes.Buffer
+	if err := store.Export(context.Background(), QueryOptions{}, "xml", &buf); err == nil {
+		t.Error("Export() expected error for unsupported format")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.Export(ctx, QueryOptions{}, FormatJSONL, &buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("Export() error = %v, want context.Canceled", err)
+	}
+}
+
+// insertingWriter inserts an audit record on every write, which blocks if
+// the export still holds the store's only connection.
+type insertingWriter struct {
+	bytes.Buffer
+	store *Store
+	err   error
+}
+
+func (w *insertingWriter) Write(p []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.store.Insert(ctx, NewRecordBuilder().WithRequest("req", "sess").Build()); err != nil && w.err == nil {
+		w.err = err
+	}
+	return w.Buffer.Write(p)
+}
+
+// TestExportPages tests that exports are read in pages that honour the
+// limit and offset, and that no database connection is held while records
+// are written out.
+func TestExportPages(t *testing.T) {
+	defer func(size int) { exportPageSize = size }(exportPageSize)
+	exportPageSize = 2
+
+	store := newExportStore(t, 5)
+
+	tests := []struct {
+		name    string
+		opts    QueryOptions
+		wantIDs []int64
+	}{
+		{name: "all", opts: QueryOptions{OrderBy: "id"}, wantIDs: []int64{1, 2, 3, 4, 5}},
+		{name: "limit and offset", opts: QueryOptions{OrderBy: "id", Offset: 1, Limit: 3}, wantIDs: []int64{2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := store.Export(context.Background(), tt.opts, FormatJSONL, &buf); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			var ids []int64
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var r Record
+				if err := dec.Decode(&r); err != nil {
+					t.Fatalf("Invalid JSON line: %v", err)
+				}
+				ids = append(ids, r.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("exported IDs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+
+	// Writers can insert while the export writes out each page
+	w := &insertingWriter{store: store}
+	if err := store.Export(context.Background(), QueryOptions{Limit: 5}, FormatJSONL, w); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if w.err != nil {
+		t.Errorf("Insert() during export error = %v", w.err)
+	}
+}
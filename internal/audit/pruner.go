@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultPruneInterval is how often the pruner removes expired records.
+const DefaultPruneInterval = time.Hour
+
+// Pruner periodically deletes audit records older than the retention period.
+type Pruner struct {
+	store     *Store
+	retention time.Duration
+	interval  time.Duration
+	onPrune   func(count int64)
+
+	// Lifecycle
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// PrunerConfig holds configuration for the audit pruner.
+type PrunerConfig struct {
+	Retention time.Duration // Records older than this are removed
+	Interval  time.Duration // How often to prune
+}
+
+// NewPruner creates a new retention pruner.
+func NewPruner(store *Store, cfg PrunerConfig) *Pruner {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultPruneInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Pruner{
+		store:     store,
+		retention: cfg.Retention,
+		interval:  cfg.Interval,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// SetOnPrune sets a callback invoked with the number of records removed by
+// each successful prune.
+func (p *Pruner) SetOnPrune(fn func(count int64)) {
+	p.onPrune = fn
+}
+
+// Start begins the background prune loop. The first prune runs immediately.
+func (p *Pruner) Start() {
+	p.wg.Add(1)
+	go p.pruneLoop()
+	log.Info().
+		Dur("retention", p.retention).
+		Dur("interval", p.interval).
+		Msg("Audit pruner started")
+}
+
+// pruneLoop prunes on start and then on every tick until stopped.
+func (p *Pruner) pruneLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.prune()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.prune()
+		}
+	}
+}
+
+// prune removes expired records once.
+func (p *Pruner) prune() {
+	ctx, cancel := context.WithTimeout(p.ctx, 30*time.Second)
+	defer cancel()
+
+	removed, err := p.store.Prune(ctx, p.retention)
+	if err != nil {
+		if p.ctx.Err() == nil {
+			log.Error().Err(err).Msg("Failed to prune audit records")
+		}
+		return
+	}
+
+	if p.onPrune != nil {
+		p.onPrune(removed)
+	}
+
+	log.Info().
+		Int64("removed", removed).
+		Dur("retention", p.retention).
+		Msg("Pruned audit records")
+}
+
+// Stop stops the prune loop, cancelling any prune in progress.
+func (p *Pruner) Stop() {
+	p.cancel()
+	p.wg.Wait()
+	log.Info().Msg("Audit pruner stopped")
+}
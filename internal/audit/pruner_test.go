@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestPruner tests that the pruner removes expired records and stops cleanly.
+func TestPruner(t *testing.T) {
+	store, err := NewStore(StoreConfig{DBPath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	for _, age := range []time.Duration{48 * time.Hour, 36 * time.Hour, time.Hour} {
+		record := NewRecordBuilder().
+			WithRequest("req", "sess").
+			WithAgent("agent1", "", "").
+			WithMethod("tools/call", "read_file", "", "").
+			WithDecision(true, "allow", "", "enforce").
+			Build()
+		record.Timestamp = now.Add(-age)
+		if err := store.Insert(ctx, record); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	pruned := make(chan int64, 10)
+	pruner := NewPruner(store, PrunerConfig{Retention: 24 * time.Hour, Interval: 10 * time.Millisecond})
+	pruner.SetOnPrune(func(count int64) { pruned <- count })
+	pruner.Start()
+
+	// The first prune runs immediately on start
+	select {
+	case count := <-pruned:
+		if count != 2 {
+			t.Errorf("First prune removed %d records, want 2", count)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Pruner did not run on start")
+	}
+
+	// Subsequent ticks find nothing left to remove
+	select {
+	case count := <-pruned:
+		if count != 0 {
+			t.Errorf("Second prune removed %d records, want 0", count)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Pruner did not run on interval")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		pruner.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop() did not return")
+	}
+
+	records, err := store.Query(ctx, QueryOptions{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("Remaining records = %d, want 1", len(records))
+	}
+}
@@ -0,0 +1,29 @@
+package audit
+
+import "sync/atomic"
+
+// Sampler decides which requests are logged and recorded. Denied requests
+// and requests with policy violations are always kept; of the rest, one in
+// every Rate is kept.
+type Sampler struct {
+	rate    uint64
+	allowed atomic.Uint64
+}
+
+// NewSampler creates a sampler keeping one in rate allowed requests. A rate
+// of 1 or less keeps every request.
+func NewSampler(rate int) *Sampler {
+	if rate < 1 {
+		rate = 1
+	}
+	return &Sampler{rate: uint64(rate)}
+}
+
+// Keep reports whether a request should be logged and recorded. The first
+// allowed request is kept, then every rate-th one after it.
+func (s *Sampler) Keep(allowed, violations bool) bool {
+	if !allowed || violations || s.rate == 1 {
+		return true
+	}
+	return (s.allowed.Add(1)-1)%s.rate == 0
+}
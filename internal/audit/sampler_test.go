@@ -0,0 +1,53 @@
+package audit
+
+import "testing"
+
+// TestSampler tests that allowed requests are sampled while denied and
+// violating requests are always kept.
+func TestSampler(t *testing.T) {
+	tests := []struct {
+		name       string
+		rate       int
+		allowed    bool
+		violations bool
+		wantKept   int
+	}{
+		{"allowed sampled", 10, true, false, 10},
+		{"denied always kept", 10, false, false, 100},
+		{"violations always kept", 10, true, true, 100},
+		{"rate 1 keeps all", 1, true, false, 100},
+		{"rate 0 keeps all", 0, true, false, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSampler(tt.rate)
+			kept := 0
+			for i := 0; i < 100; i++ {
+				if s.Keep(tt.allowed, tt.violations) {
+					kept++
+				}
+			}
+			if kept != tt.wantKept {
+				t.Errorf("kept %d of 100, want %d", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+// TestSamplerInterleaved tests that denials don't advance the allowed
+// count, so sampling stays one in N allowed requests.
+func TestSamplerInterleaved(t *testing.T) {
+	s := NewSampler(3)
+	var got []bool
+	for i := 0; i < 6; i++ {
+		got = append(got, s.Keep(true, false), s.Keep(false, false))
+	}
+
+	want := []bool{true, true, false, true, false, true, true, true, false, true, false, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Keep() sequence = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RecordSink receives audit records. Write must not block the request path
+// for long; sinks that do I/O should buffer or be cheap per record.
+type RecordSink interface {
+	Write(record *Record)
+	Flush()
+	Close() error
+}
+
+// Close stops the writer, flushing remaining records. It implements
+// RecordSink.
+func (w *Writer) Close() error {
+	w.Stop()
+	return nil
+}
+
+// MultiSink fans each record out to several sinks, e.g. the SQLite store
+// plus a JSON stream shipped to a SIEM.
+type MultiSink struct {
+	sinks []RecordSink
+}
+
+// NewMultiSink creates a sink that writes to every one of sinks.
+func NewMultiSink(sinks ...RecordSink) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+// Write passes record to every sink.
+func (m *MultiSink) Write(record *Record) {
+	for _, s := range m.sinks {
+		s.Write(record)
+	}
+}
+
+// Flush flushes every sink.
+func (m *MultiSink) Flush() {
+	for _, s := range m.sinks {
+		s.Flush()
+	}
+}
+
+// Close closes every sink, returning their errors joined.
+func (m *MultiSink) Close() error {
+	var errs []error
+	for _, s := range m.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// JSONSink writes each record as one line of JSON, in the same format as
+// the jsonl export. Records are queued and written from a background
+// goroutine, so slow file I/O never blocks Write; records that don't fit in
+// the queue, or are written after Close, are dropped.
+type JSONSink struct {
+	enc    *json.Encoder
+	closer io.Closer
+
+	queue  chan *Record
+	onDrop func()
+	wg     sync.WaitGroup
+
+	// closed is set by Close; mu keeps Write from sending on the closed queue
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewJSONSink creates a sink writing to w, queueing up to bufferSize records
+// (1000 if bufferSize is not positive), and starts its writer. Closing the
+// sink leaves w open.
+func NewJSONSink(w io.Writer, bufferSize int) *JSONSink {
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+
+	s := &JSONSink{
+		enc:   json.NewEncoder(w),
+		queue: make(chan *Record, bufferSize),
+	}
+	s.wg.Add(1)
+	go s.writeLoop()
+	return s
+}
+
+// NewJSONFileSink creates a sink appending to the file at path, creating it
+// if needed. Closing the sink closes the file.
+func NewJSONFileSink(path string, bufferSize int) (*JSONSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit sink file: %w", err)
+	}
+	s := NewJSONSink(f, bufferSize)
+	s.closer = f
+	return s, nil
+}
+
+// SetOnDrop sets a callback invoked for each record dropped because the
+// queue was full or the sink closed. Set it before writing records.
+func (s *JSONSink) SetOnDrop(fn func()) {
+	s.onDrop = fn
+}
+
+// Write queues record for writing, dropping it if the queue is full or the
+// sink is closed.
+func (s *JSONSink) Write(record *Record) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		s.drop()
+		return
+	}
+	select {
+	case s.queue <- record:
+	default:
+		s.drop()
+	}
+}
+
+// Flush is a no-op; queued records are written as soon as possible.
+func (s *JSONSink) Flush() {}
+
+// Close writes the records still queued and closes the underlying file, if
+// the sink opened one. Records written after Close are dropped.
+func (s *JSONSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// writeLoop encodes queued records until the queue is closed. Failures are
+// logged; the record is not retried.
+func (s *JSONSink) writeLoop() {
+	defer s.wg.Done()
+
+	for record := range s.queue {
+		if err := s.enc.Encode(record); err != nil {
+			log.Error().Err(err).Str("request_id", record.RequestID).Msg("Failed to write audit record to JSON sink")
+		}
+	}
+}
+
+func (s *JSONSink) drop() {
+	if s.onDrop != nil {
+		s.onDrop()
+	}
+}
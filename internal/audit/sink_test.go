@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memSink records what it receives, for tests.
+type memSink struct {
+	records  []*Record
+	flushes  int
+	closed   bool
+	closeErr error
+}
+
+func (m *memSink) Write(record *Record) { m.records = append(m.records, record) }
+func (m *memSink) Flush()               { m.flushes++ }
+func (m *memSink) Close() error {
+	m.closed = true
+	return m.closeErr
+}
+
+// TestMultiSink tests that every sink receives the same records, flushes
+// and close, and that close errors are reported.
+func TestMultiSink(t *testing.T) {
+	first := &memSink{}
+	second := &memSink{closeErr: errors.New("disk gone")}
+	multi := NewMultiSink(first, second)
+
+	record := NewRecordBuilder().
+		WithRequest("req-1", "sess-1").
+		WithMethod("tools/call", "read_file", "", "").
+		WithDecision(true, "allow", "", "enforce").
+		Build()
+	multi.Write(record)
+	multi.Flush()
+	err := multi.Close()
+
+	for name, sink := range map[string]*memSink{"first": first, "second": second} {
+		if len(sink.records) != 1 || sink.records[0] != record {
+			t.Errorf("%s sink records = %v, want the written record", name, sink.records)
+		}
+		if sink.flushes != 1 {
+			t.Errorf("%s sink flushes = %d, want 1", name, sink.flushes)
+		}
+		if !sink.closed {
+			t.Errorf("%s sink not closed", name)
+		}
+	}
+	if err == nil || err.Error() != "disk gone" {
+		t.Errorf("Close() error = %v, want disk gone", err)
+	}
+}
+
+// TestJSONSink tests that records are written one JSON object per line.
+func TestJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONSink(&buf, 0)
+
+	for _, id := range []string{"req-1", "req-2"} {
+		sink.Write(NewRecordBuilder().WithRequest(id, "sess-1").Build())
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %s", len(lines), buf.String())
+	}
+	var got Record
+	if err := json.Unmarshal(lines[1], &got); err != nil {
+		t.Fatalf("invalid JSON line %s: %v", lines[1], err)
+	}
+	if got.RequestID != "req-2" || got.SessionID != "sess-1" {
+		t.Errorf("decoded record = %+v, want req-2 in sess-1", got)
+	}
+}
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+// TestJSONSinkDrops tests that Write doesn't wait for a slow writer, and
+// that records beyond the queue, or written after Close, are dropped.
+func TestJSONSinkDrops(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	sink := NewJSONSink(w, 1)
+	var dropped atomic.Int64
+	sink.SetOnDrop(func() { dropped.Add(1) })
+
+	// One record is being written, one is queued, the rest are dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			sink.Write(NewRecordBuilder().WithRequest("req", "sess-1").Build())
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked on the slow writer")
+	}
+
+	close(w.release)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := dropped.Load(); got != 3 {
+		t.Errorf("dropped = %d, want 3", got)
+	}
+
+	sink.Write(NewRecordBuilder().WithRequest("late", "sess-1").Build())
+	if got := dropped.Load(); got != 4 {
+		t.Errorf("dropped after Close = %d, want 4", got)
+	}
+}
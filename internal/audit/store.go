@@ -11,36 +11,56 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// Store provides SQLite-based audit log storage.
+// Store provides SQL-backed audit log storage. SQLite is the default;
+// PostgreSQL can be selected for deployments with many concurrent writers.
 type Store struct {
-	db     *sql.DB
-	dbPath string
+	db      *sql.DB
+	dialect dialect
+	dbPath  string // Location for logs; never contains credentials
 }
 
 // StoreConfig holds configuration for the audit store.
 type StoreConfig struct {
+	Driver string // "sqlite" (default) or "postgres"
 	DBPath string // Path to SQLite file, ":memory:" for in-memory
+	DSN    string // PostgreSQL connection string
 }
 
-// NewStore creates a new SQLite audit store.
+// NewStore creates a new audit store using the configured driver.
 func NewStore(cfg StoreConfig) (*Store, error) {
-	if cfg.DBPath == "" {
-		cfg.DBPath = "audit.db"
+	d, err := dialectFor(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	if !driverRegistered(d.driverName()) {
+		return nil, fmt.Errorf("database driver %q is not linked into this build", d.driverName())
+	}
+
+	location := cfg.DBPath
+	if location == "" {
+		location = "audit.db"
+	}
+	if cfg.Driver == DriverPostgres {
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("postgres audit store requires a DSN")
+		}
+		location = DriverPostgres
 	}
 
-	db, err := sql.Open("sqlite3", cfg.DBPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	db, err := sql.Open(d.driverName(), d.dataSource(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(1) // SQLite only supports one writer
-	db.SetMaxIdleConns(1)
+	d.configurePool(db)
 	db.SetConnMaxLifetime(time.Hour)
 
 	store := &Store{
-		db:     db,
-		dbPath: cfg.DBPath,
+		db:      db,
+		dialect: d,
+		dbPath:  location,
 	}
 
 	// Initialize schema
@@ -52,74 +72,33 @@ func NewStore(cfg StoreConfig) (*Store, error) {
 	return store, nil
 }
 
-// initSchema creates the audit table and indexes.
+// initSchema creates the audit table and indexes and applies migrations.
 func (s *Store) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS audit_log (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		request_id TEXT NOT NULL,
-		session_id TEXT NOT NULL,
-		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		latency_ms REAL,
-
-		-- Agent info
-		agent_id TEXT NOT NULL,
-		agent_name TEXT,
-		capabilities TEXT,
-
-		-- Request info
-		method TEXT NOT NULL,
-		tool TEXT,
-		resource_uri TEXT,
-		arguments TEXT,
-
-		-- Identity info
-		identity_verified INTEGER DEFAULT 0,
-		did TEXT,
-
-		-- Policy decision
-		allowed INTEGER NOT NULL,
-		matched_rule TEXT,
-		violations TEXT,
-		policy_mode TEXT,
-
-		-- Environment
-		source_ip TEXT,
-		environment TEXT
-	);
-
-	-- Indexes for common queries
-	CREATE INDEX IF NOT EXISTS idx_audit_timestamp ON audit_log(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_audit_agent_id ON audit_log(agent_id);
-	CREATE INDEX IF NOT EXISTS idx_audit_session_id ON audit_log(session_id);
-	CREATE INDEX IF NOT EXISTS idx_audit_method ON audit_log(method);
-	CREATE INDEX IF NOT EXISTS idx_audit_allowed ON audit_log(allowed);
-	CREATE INDEX IF NOT EXISTS idx_audit_tool ON audit_log(tool);
-	`
-
-	_, err := s.db.Exec(schema)
-	return err
+	if _, err := s.db.Exec(s.dialect.schema()); err != nil {
+		return err
+	}
+	return s.dialect.migrate(s.db)
 }
 
 // Insert adds a single audit record.
 func (s *Store) Insert(ctx context.Context, record *Record) error {
 	query := `
 	INSERT INTO audit_log (
-		request_id, session_id, timestamp, latency_ms,
+		request_id, session_id, timestamp, latency_ms, policy_latency_ms, upstream_latency_ms,
 		agent_id, agent_name, capabilities,
-		method, tool, resource_uri, arguments,
+		method, tool, resource_uri, arguments, arguments_truncated,
 		identity_verified, did,
-		allowed, matched_rule, violations, policy_mode,
+		allowed, matched_rule, violations, policy_mode, obligations, dry_run, echoed,
 		source_ip, environment
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := s.db.ExecContext(ctx, query,
-		record.RequestID, record.SessionID, record.Timestamp, record.Latency,
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query),
+		record.RequestID, record.SessionID, record.Timestamp, record.Latency, record.PolicyLatency, record.UpstreamLatency,
 		record.AgentID, record.AgentName, record.Capabilities,
-		record.Method, record.Tool, record.ResourceURI, record.Arguments,
+		record.Method, record.Tool, record.ResourceURI, record.Arguments, record.ArgumentsTruncated,
 		record.IdentityVerified, record.DID,
-		record.Allowed, record.MatchedRule, record.Violations, record.PolicyMode,
+		record.Allowed, record.MatchedRule, record.Violations, record.PolicyMode, record.Obligations, record.DryRun, record.Echoed,
 		record.SourceIP, record.Environment,
 	)
 
@@ -138,16 +117,16 @@ func (s *Store) InsertBatch(ctx context.Context, records []*Record) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, `
+	stmt, err := tx.PrepareContext(ctx, s.dialect.rebind(`
 		INSERT INTO audit_log (
-			request_id, session_id, timestamp, latency_ms,
+			request_id, session_id, timestamp, latency_ms, policy_latency_ms, upstream_latency_ms,
 			agent_id, agent_name, capabilities,
-			method, tool, resource_uri, arguments,
+			method, tool, resource_uri, arguments, arguments_truncated,
 			identity_verified, did,
-			allowed, matched_rule, violations, policy_mode,
+			allowed, matched_rule, violations, policy_mode, obligations, dry_run, echoed,
 			source_ip, environment
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`))
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
@@ -155,11 +134,11 @@ func (s *Store) InsertBatch(ctx context.Context, records []*Record) error {
 
 	for _, record := range records {
 		_, err := stmt.ExecContext(ctx,
-			record.RequestID, record.SessionID, record.Timestamp, record.Latency,
+			record.RequestID, record.SessionID, record.Timestamp, record.Latency, record.PolicyLatency, record.UpstreamLatency,
 			record.AgentID, record.AgentName, record.Capabilities,
-			record.Method, record.Tool, record.ResourceURI, record.Arguments,
+			record.Method, record.Tool, record.ResourceURI, record.Arguments, record.ArgumentsTruncated,
 			record.IdentityVerified, record.DID,
-			record.Allowed, record.MatchedRule, record.Violations, record.PolicyMode,
+			record.Allowed, record.MatchedRule, record.Violations, record.PolicyMode, record.Obligations, record.DryRun, record.Echoed,
 			record.SourceIP, record.Environment,
 		)
 		if err != nil {
@@ -177,19 +156,46 @@ func (s *Store) InsertBatch(ctx context.Context, records []*Record) error {
 // allowedOrderByColumns defines the whitelist of columns that can be used in ORDER BY.
 // This prevents SQL injection through the OrderBy field.
 var allowedOrderByColumns = map[string]bool{
-	"id":         true,
-	"timestamp":  true,
-	"agent_id":   true,
-	"session_id": true,
-	"method":     true,
-	"tool":       true,
-	"allowed":    true,
-	"latency_ms": true,
-	"source_ip":  true,
+	"id":                  true,
+	"timestamp":           true,
+	"agent_id":            true,
+	"session_id":          true,
+	"method":              true,
+	"tool":                true,
+	"allowed":             true,
+	"latency_ms":          true,
+	"policy_latency_ms":   true,
+	"upstream_latency_ms": true,
+	"source_ip":           true,
 }
 
 // Query retrieves audit records based on options.
 func (s *Store) Query(ctx context.Context, opts QueryOptions) ([]*Record, error) {
+	query, args, err := buildQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*Record
+	for rows.Next() {
+		r, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// buildQuery builds the SELECT statement and arguments for the query options.
+func buildQuery(opts QueryOptions) (string, []interface{}, error) {
 	var conditions []string
 	var args []interface{}
 
@@ -221,12 +227,17 @@ func (s *Store) Query(ctx context.Context, opts QueryOptions) ([]*Record, error)
 		conditions = append(conditions, "allowed = ?")
 		args = append(args, *opts.Allowed)
 	}
+	if opts.ArgumentsContains != "" {
+		conditions = append(conditions, `arguments LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(opts.ArgumentsContains)+"%")
+	}
 
 	query := "SELECT id, request_id, session_id, timestamp, latency_ms, " +
+		"COALESCE(policy_latency_ms, 0), COALESCE(upstream_latency_ms, 0), " +
 		"agent_id, agent_name, capabilities, " +
-		"method, tool, resource_uri, arguments, " +
+		"method, tool, resource_uri, arguments, arguments_truncated, " +
 		"identity_verified, did, " +
-		"allowed, matched_rule, violations, policy_mode, " +
+		"allowed, matched_rule, violations, policy_mode, COALESCE(obligations, ''), dry_run, echoed, " +
 		"source_ip, environment " +
 		"FROM audit_log"
 
@@ -238,7 +249,7 @@ func (s *Store) Query(ctx context.Context, opts QueryOptions) ([]*Record, error)
 	orderBy := "timestamp"
 	if opts.OrderBy != "" {
 		if !allowedOrderByColumns[opts.OrderBy] {
-			return nil, fmt.Errorf("invalid order by column: %s", opts.OrderBy)
+			return "", nil, fmt.Errorf("invalid order by column: %s", opts.OrderBy)
 		}
 		orderBy = opts.OrderBy
 	}
@@ -247,6 +258,10 @@ func (s *Store) Query(ctx context.Context, opts QueryOptions) ([]*Record, error)
 		order = "DESC"
 	}
 	query += fmt.Sprintf(" ORDER BY %s %s", orderBy, order)
+	if orderBy != "id" {
+		// Break ties so that pages of the same query never overlap
+		query += ", id " + order
+	}
 
 	// Pagination
 	if opts.Limit > 0 {
@@ -256,30 +271,32 @@ func (s *Store) Query(ctx context.Context, opts QueryOptions) ([]*Record, error)
 		query += fmt.Sprintf(" OFFSET %d", opts.Offset)
 	}
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query: %w", err)
-	}
-	defer rows.Close()
+	return query, args, nil
+}
 
-	var records []*Record
-	for rows.Next() {
-		r := &Record{}
-		err := rows.Scan(
-			&r.ID, &r.RequestID, &r.SessionID, &r.Timestamp, &r.Latency,
-			&r.AgentID, &r.AgentName, &r.Capabilities,
-			&r.Method, &r.Tool, &r.ResourceURI, &r.Arguments,
-			&r.IdentityVerified, &r.DID,
-			&r.Allowed, &r.MatchedRule, &r.Violations, &r.PolicyMode,
-			&r.SourceIP, &r.Environment,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
-		records = append(records, r)
-	}
+// likeEscaper escapes LIKE wildcards so user input only matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 
-	return records, rows.Err()
+// escapeLike escapes s for use inside a LIKE pattern with ESCAPE '\'.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// scanRecord reads the current row produced by buildQuery.
+func scanRecord(rows *sql.Rows) (*Record, error) {
+	r := &Record{}
+	err := rows.Scan(
+		&r.ID, &r.RequestID, &r.SessionID, &r.Timestamp, &r.Latency, &r.PolicyLatency, &r.UpstreamLatency,
+		&r.AgentID, &r.AgentName, &r.Capabilities,
+		&r.Method, &r.Tool, &r.ResourceURI, &r.Arguments, &r.ArgumentsTruncated,
+		&r.IdentityVerified, &r.DID,
+		&r.Allowed, &r.MatchedRule, &r.Violations, &r.PolicyMode, &r.Obligations, &r.DryRun, &r.Echoed,
+		&r.SourceIP, &r.Environment,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return r, nil
 }
 
 // GetStats returns aggregate statistics.
@@ -287,8 +304,8 @@ func (s *Store) GetStats(ctx context.Context, since *time.Time) (*Stats, error)
 	query := `
 	SELECT
 		COUNT(*) as total,
-		COALESCE(SUM(CASE WHEN allowed = 1 THEN 1 ELSE 0 END), 0) as allowed,
-		COALESCE(SUM(CASE WHEN allowed = 0 THEN 1 ELSE 0 END), 0) as denied,
+		COALESCE(SUM(CASE WHEN allowed THEN 1 ELSE 0 END), 0) as allowed,
+		COALESCE(SUM(CASE WHEN NOT allowed THEN 1 ELSE 0 END), 0) as denied,
 		COUNT(DISTINCT agent_id) as unique_agents,
 		COUNT(DISTINCT session_id) as unique_sessions,
 		AVG(latency_ms) as avg_latency
@@ -304,7 +321,7 @@ func (s *Store) GetStats(ctx context.Context, since *time.Time) (*Stats, error)
 	var stats Stats
 	var avgLatency sql.NullFloat64
 
-	err := s.db.QueryRowContext(ctx, query, args...).Scan(
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(query), args...).Scan(
 		&stats.TotalRequests,
 		&stats.AllowedRequests,
 		&stats.DeniedRequests,
@@ -323,12 +340,174 @@ func (s *Store) GetStats(ctx context.Context, since *time.Time) (*Stats, error)
 	return &stats, nil
 }
 
+// GetTopStats returns the aggregate statistics from GetStats together with
+// the top n agents and tools by request count and by denial count.
+func (s *Store) GetTopStats(ctx context.Context, since *time.Time, n int) (*Stats, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid top count: %d (must be > 0)", n)
+	}
+
+	stats, err := s.GetStats(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdowns := []struct {
+		column string
+		denied bool
+		dest   *[]TopEntry
+	}{
+		{"agent_id", false, &stats.TopAgents},
+		{"tool", false, &stats.TopTools},
+		{"agent_id", true, &stats.TopDeniedAgents},
+		{"tool", true, &stats.TopDeniedTools},
+	}
+	for _, b := range breakdowns {
+		entries, err := s.topBy(ctx, b.column, b.denied, since, n)
+		if err != nil {
+			return nil, err
+		}
+		*b.dest = entries
+	}
+
+	return stats, nil
+}
+
+// topBy returns the top n values of column ordered by request or denial
+// count. column must be a trusted column name, never user input.
+func (s *Store) topBy(ctx context.Context, column string, byDenied bool, since *time.Time, n int) ([]TopEntry, error) {
+	query := fmt.Sprintf(`
+	SELECT
+		%[1]s,
+		COUNT(*) as requests,
+		COALESCE(SUM(CASE WHEN NOT allowed THEN 1 ELSE 0 END), 0) as denied
+	FROM audit_log
+	WHERE %[1]s IS NOT NULL AND %[1]s <> ''`, column)
+
+	var args []interface{}
+	if since != nil {
+		query += " AND timestamp >= ?"
+		args = append(args, *since)
+	}
+
+	query += fmt.Sprintf(" GROUP BY %s", column)
+	if byDenied {
+		query += " HAVING SUM(CASE WHEN NOT allowed THEN 1 ELSE 0 END) > 0 ORDER BY denied DESC"
+	} else {
+		query += " ORDER BY requests DESC"
+	}
+	query += fmt.Sprintf(", %s ASC LIMIT %d", column, n)
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	var entries []TopEntry
+	for rows.Next() {
+		var e TopEntry
+		if err := rows.Scan(&e.Key, &e.Requests, &e.Denied); err != nil {
+			return nil, fmt.Errorf("failed to scan top %s: %w", column, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// maxStatsBuckets is the most windows GetStatsOverTime returns, so a small
+// bucket over a long range can't fill memory with empty windows.
+const maxStatsBuckets = 10000
+
+// GetStatsOverTime returns statistics grouped into contiguous windows of
+// the given size, oldest first. Windows without records are included with
+// zero counts. With since set, windows run from since to now; otherwise
+// they start at the oldest record. A range of more than maxStatsBuckets
+// windows is an error.
+func (s *Store) GetStatsOverTime(ctx context.Context, bucket time.Duration, since *time.Time) ([]BucketStats, error) {
+	width := int64(bucket / time.Second)
+	if width < 1 {
+		return nil, fmt.Errorf("invalid bucket size: %s (must be at least 1s)", bucket)
+	}
+
+	query := fmt.Sprintf(`
+	SELECT
+		(%s / ?) * ? as bucket,
+		COUNT(*) as total,
+		COALESCE(SUM(CASE WHEN allowed THEN 1 ELSE 0 END), 0) as allowed,
+		COALESCE(SUM(CASE WHEN NOT allowed THEN 1 ELSE 0 END), 0) as denied,
+		AVG(latency_ms) as avg_latency
+	FROM audit_log
+	`, s.dialect.epochSeconds("timestamp"))
+
+	args := []interface{}{width, width}
+	if since != nil {
+		query += " WHERE timestamp >= ?"
+		args = append(args, *since)
+	}
+	query += " GROUP BY bucket ORDER BY bucket"
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats over time: %w", err)
+	}
+	defer rows.Close()
+
+	found := make(map[int64]BucketStats)
+	first, last := int64(-1), int64(-1)
+	for rows.Next() {
+		var start int64
+		var b BucketStats
+		var avgLatency sql.NullFloat64
+		if err := rows.Scan(&start, &b.TotalRequests, &b.AllowedRequests, &b.DeniedRequests, &avgLatency); err != nil {
+			return nil, fmt.Errorf("failed to scan bucket: %w", err)
+		}
+		if avgLatency.Valid {
+			b.AvgLatencyMs = avgLatency.Float64
+		}
+		found[start] = b
+		if first < 0 {
+			first = start
+		}
+		last = start
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Determine the window range
+	if since != nil {
+		first = since.Unix() / width * width
+		if now := time.Now().Unix() / width * width; now > last {
+			last = now
+		}
+	}
+	if first < 0 {
+		return []BucketStats{}, nil
+	}
+
+	if n := (last-first)/width + 1; n > maxStatsBuckets {
+		return nil, fmt.Errorf("too many stats buckets: %d (max %d, use a larger bucket or a later since)", n, maxStatsBuckets)
+	}
+
+	// Fill gaps so windows are contiguous
+	buckets := make([]BucketStats, 0, (last-first)/width+1)
+	for start := first; start <= last; start += width {
+		b := found[start]
+		b.Start = time.Unix(start, 0).UTC()
+		buckets = append(buckets, b)
+	}
+
+	return buckets, nil
+}
+
 // Prune removes records older than the specified duration.
 func (s *Store) Prune(ctx context.Context, olderThan time.Duration) (int64, error) {
 	cutoff := time.Now().Add(-olderThan)
 
 	result, err := s.db.ExecContext(ctx,
-		"DELETE FROM audit_log WHERE timestamp < ?",
+		s.dialect.rebind("DELETE FROM audit_log WHERE timestamp < ?"),
 		cutoff,
 	)
 	if err != nil {
@@ -2,8 +2,13 @@ package audit
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 // TestNewStore tests creating a new audit store.
@@ -58,6 +63,7 @@ func TestInsertRecord(t *testing.T) {
 	record := NewRecordBuilder().
 		WithRequest("req_123", "sess_456").
 		WithTiming(42.5).
+		WithLatencyBreakdown(1.25, 30).
 		WithAgent("agent1", "Test Agent", `["read","write"]`).
 		WithMethod("tools/call", "read_file", "", `{"path":"/test"}`).
 		WithIdentity(true, "did:example:123").
@@ -108,6 +114,167 @@ func TestInsertRecord(t *testing.T) {
 	if r.Latency != 42.5 {
 		t.Errorf("Latency = %f, want 42.5", r.Latency)
 	}
+	if r.PolicyLatency != 1.25 || r.UpstreamLatency != 30 {
+		t.Errorf("PolicyLatency, UpstreamLatency = %f, %f, want 1.25, 30", r.PolicyLatency, r.UpstreamLatency)
+	}
+}
+
+// TestObligationsColumn tests that obligations and the dry-run flag are
+// stored and that databases created before those columns existed are migrated.
+func TestObligationsColumn(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	// Create a database with the original schema
+	legacy, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	_, err = legacy.Exec(`CREATE TABLE audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		latency_ms REAL,
+		agent_id TEXT NOT NULL,
+		agent_name TEXT,
+		capabilities TEXT,
+		method TEXT NOT NULL,
+		tool TEXT,
+		resource_uri TEXT,
+		arguments TEXT,
+		identity_verified INTEGER DEFAULT 0,
+		did TEXT,
+		allowed INTEGER NOT NULL,
+		matched_rule TEXT,
+		violations TEXT,
+		policy_mode TEXT,
+		source_ip TEXT,
+		environment TEXT
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+	_, err = legacy.Exec(`INSERT INTO audit_log (
+		request_id, session_id, timestamp, latency_ms,
+		agent_id, agent_name, capabilities,
+		method, tool, resource_uri, arguments,
+		identity_verified, did,
+		allowed, matched_rule, violations, policy_mode,
+		source_ip, environment
+	) VALUES ('req_old', 'sess_1', ?, 1.5, 'agent1', '', '', 'tools/call', '', '', '', 0, '', 1, '', '', 'enforce', '', '')`,
+		time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to insert legacy row: %v", err)
+	}
+	legacy.Close()
+
+	store, err := NewStore(StoreConfig{DBPath: dbPath})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	record := NewRecordBuilder().
+		WithRequest("req_new", "sess_1").
+		WithAgent("agent1", "", "").
+		WithMethod("tools/call", "delete_file", "", "").
+		WithDecision(false, "deny_delete", "not allowed", "enforce").
+		WithObligations(`[{"action":"alert","params":{"severity":"high"}}]`).
+		WithDryRun(true).
+		WithEchoed(true).
+		Build()
+	if err := store.Insert(ctx, record); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	records, err := store.Query(ctx, QueryOptions{OrderBy: "id"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Query() returned %d records, want 2", len(records))
+	}
+	if records[0].Obligations != "" {
+		t.Errorf("Legacy row Obligations = %q, want empty", records[0].Obligations)
+	}
+	if records[1].Obligations != record.Obligations {
+		t.Errorf("Obligations = %q, want %q", records[1].Obligations, record.Obligations)
+	}
+	if records[0].DryRun || !records[1].DryRun {
+		t.Errorf("DryRun = %v, %v, want false, true", records[0].DryRun, records[1].DryRun)
+	}
+	if records[0].Echoed || !records[1].Echoed {
+		t.Errorf("Echoed = %v, %v, want false, true", records[0].Echoed, records[1].Echoed)
+	}
+}
+
+// TestTruncateArguments tests that oversized arguments are stored cut down
+// to the limit and flagged.
+func TestTruncateArguments(t *testing.T) {
+	store, err := NewStore(StoreConfig{DBPath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	large := `{"content":"` + strings.Repeat("é", 1<<20) + `"}`
+	const maxBytes = 1024
+
+	ctx := context.Background()
+	for _, args := range []string{`{"path":"/tmp/a"}`, large} {
+		record := NewRecordBuilder().
+			WithRequest("req_"+fmt.Sprint(len(args)), "sess_1").
+			WithAgent("agent1", "", "").
+			WithMethod("tools/call", "write_file", "", args).
+			TruncateArguments(maxBytes).
+			Build()
+		if err := store.Insert(ctx, record); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	records, err := store.Query(ctx, QueryOptions{OrderBy: "id"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Query() returned %d records, want 2", len(records))
+	}
+
+	if small := records[0]; small.Arguments != `{"path":"/tmp/a"}` || small.ArgumentsTruncated {
+		t.Errorf("Small arguments = %q, truncated = %v, want unchanged", small.Arguments, small.ArgumentsTruncated)
+	}
+
+	got := records[1]
+	if !got.ArgumentsTruncated {
+		t.Error("ArgumentsTruncated = false, want true")
+	}
+	if len(got.Arguments) > maxBytes {
+		t.Errorf("len(Arguments) = %d, want <= %d", len(got.Arguments), maxBytes)
+	}
+	if !strings.HasPrefix(got.Arguments, `{"content":"é`) || !strings.HasSuffix(got.Arguments, TruncatedMarker) {
+		t.Errorf("Arguments = %.40q..., want the original prefix ending in %q", got.Arguments, TruncatedMarker)
+	}
+	if !utf8.ValidString(got.Arguments) {
+		t.Error("Truncated arguments are not valid UTF-8")
+	}
+}
+
+// TestTruncateArgumentsSmallLimit tests that a limit shorter than
+// TruncatedMarker is still never exceeded.
+func TestTruncateArgumentsSmallLimit(t *testing.T) {
+	const args = `{"path":"/tmp/some/file"}`
+	for _, maxBytes := range []int{1, 5, len(TruncatedMarker), len(TruncatedMarker) + 1} {
+		record := NewRecordBuilder().
+			WithMethod("tools/call", "write_file", "", args).
+			TruncateArguments(maxBytes).
+			Build()
+		if len(record.Arguments) > maxBytes || !record.ArgumentsTruncated {
+			t.Errorf("TruncateArguments(%d) = %q, truncated = %v, want at most %d bytes and truncated",
+				maxBytes, record.Arguments, record.ArgumentsTruncated, maxBytes)
+		}
+	}
 }
 
 // TestInsertBatch tests inserting multiple records in a transaction.
@@ -300,6 +467,61 @@ func TestQueryWithFilters(t *testing.T) {
 	}
 }
 
+// TestQueryArgumentsContains tests substring search over request arguments.
+func TestQueryArgumentsContains(t *testing.T) {
+	store, err := NewStore(StoreConfig{DBPath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	arguments := []string{
+		`{"path":"/data/customers/c-1001.json"}`,
+		`{"path":"/data/customers/c-2002.json"}`,
+		`{"customer_id":"c-1001","action":"refund"}`,
+		`{"query":"100% done"}`,
+		`{"query":"1000 done"}`,
+		`{"name":"a_b"}`,
+		`{"name":"axb"}`,
+	}
+	for i, args := range arguments {
+		record := NewRecordBuilder().
+			WithRequest(fmt.Sprintf("req_%d", i), "sess").
+			WithAgent("agent1", "", "").
+			WithMethod("tools/call", "tool", "", args).
+			WithDecision(true, "allow", "", "enforce").
+			Build()
+		if err := store.Insert(ctx, record); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		contains  string
+		wantCount int
+	}{
+		{"path and id", "c-1001", 2},
+		{"path prefix", "/data/customers/", 2},
+		{"percent is literal", "100%", 1},
+		{"underscore is literal", "a_b", 1},
+		{"no match", "c-3003", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.Query(ctx, QueryOptions{ArgumentsContains: tt.contains})
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(records) != tt.wantCount {
+				t.Errorf("Query() returned %d records, want %d", len(records), tt.wantCount)
+			}
+		})
+	}
+}
+
 // TestQueryOrdering tests query result ordering.
 func TestQueryOrdering(t *testing.T) {
 	store, err := NewStore(StoreConfig{DBPath: ":memory:"})
@@ -479,6 +701,170 @@ func TestGetStats(t *testing.T) {
 	}
 }
 
+// TestGetTopStats tests per-agent and per-tool breakdowns.
+func TestGetTopStats(t *testing.T) {
+	store, err := NewStore(StoreConfig{DBPath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	inserts := []struct {
+		agent   string
+		tool    string
+		allowed bool
+	}{
+		{"agent1", "read_file", true},
+		{"agent1", "read_file", true},
+		{"agent1", "write_file", true},
+		{"agent1", "", true}, // e.g. tools/list, excluded from tool breakdown
+		{"agent2", "delete_file", false},
+		{"agent2", "delete_file", false},
+		{"agent2", "read_file", true},
+		{"agent3", "write_file", false},
+	}
+	for _, in := range inserts {
+		record := NewRecordBuilder().
+			WithRequest("req", "sess").
+			WithAgent(in.agent, "", "").
+			WithMethod("tools/call", in.tool, "", "").
+			WithDecision(in.allowed, "rule", "", "enforce").
+			Build()
+		if err := store.Insert(ctx, record); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	stats, err := store.GetTopStats(ctx, nil, 2)
+	if err != nil {
+		t.Fatalf("GetTopStats() error = %v", err)
+	}
+
+	if stats.TotalRequests != 8 {
+		t.Errorf("TotalRequests = %d, want 8", stats.TotalRequests)
+	}
+
+	tests := []struct {
+		name string
+		got  []TopEntry
+		want []TopEntry
+	}{
+		{"top agents", stats.TopAgents, []TopEntry{{"agent1", 4, 0}, {"agent2", 3, 2}}},
+		{"top tools", stats.TopTools, []TopEntry{{"read_file", 3, 0}, {"delete_file", 2, 2}}},
+		{"top denied agents", stats.TopDeniedAgents, []TopEntry{{"agent2", 3, 2}, {"agent3", 1, 1}}},
+		{"top denied tools", stats.TopDeniedTools, []TopEntry{{"delete_file", 2, 2}, {"write_file", 2, 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", tt.got, tt.want)
+			}
+			for i := range tt.want {
+				if tt.got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, tt.got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Plain GetStats does not pay for breakdowns
+	plain, err := store.GetStats(ctx, nil)
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if plain.TopAgents != nil || plain.TopTools != nil {
+		t.Error("GetStats() should not populate breakdowns")
+	}
+}
+
+// TestGetStatsOverTime tests per-window statistics with empty windows filled in.
+func TestGetStatsOverTime(t *testing.T) {
+	store, err := NewStore(StoreConfig{DBPath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	base := time.Now().Truncate(time.Hour).Add(-4 * time.Hour)
+
+	inserts := []struct {
+		offset  time.Duration
+		allowed bool
+		latency float64
+	}{
+		{10 * time.Minute, true, 10},
+		{50 * time.Minute, false, 30},
+		{2*time.Hour + 5*time.Minute, true, 5},
+		{3*time.Hour + 59*time.Minute, true, 7},
+	}
+	for _, in := range inserts {
+		record := NewRecordBuilder().
+			WithRequest("req", "sess").
+			WithTiming(in.latency).
+			WithAgent("agent1", "", "").
+			WithMethod("tools/call", "tool", "", "").
+			WithDecision(in.allowed, "rule", "", "enforce").
+			Build()
+		record.Timestamp = base.Add(in.offset)
+		if err := store.Insert(ctx, record); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	buckets, err := store.GetStatsOverTime(ctx, time.Hour, &base)
+	if err != nil {
+		t.Fatalf("GetStatsOverTime() error = %v", err)
+	}
+
+	// base .. current hour inclusive
+	want := []struct {
+		total, allowed, denied int64
+		avgLatency             float64
+	}{
+		{2, 1, 1, 20},
+		{0, 0, 0, 0},
+		{1, 1, 0, 5},
+		{1, 1, 0, 7},
+		{0, 0, 0, 0},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("GetStatsOverTime() returned %d buckets, want %d", len(buckets), len(want))
+	}
+	for i, w := range want {
+		b := buckets[i]
+		if !b.Start.Equal(base.Add(time.Duration(i) * time.Hour)) {
+			t.Errorf("bucket %d Start = %v, want %v", i, b.Start, base.Add(time.Duration(i)*time.Hour))
+		}
+		if b.TotalRequests != w.total || b.AllowedRequests != w.allowed || b.DeniedRequests != w.denied {
+			t.Errorf("bucket %d counts = %d/%d/%d, want %d/%d/%d", i,
+				b.TotalRequests, b.AllowedRequests, b.DeniedRequests, w.total, w.allowed, w.denied)
+		}
+		if b.AvgLatencyMs != w.avgLatency {
+			t.Errorf("bucket %d AvgLatencyMs = %f, want %f", i, b.AvgLatencyMs, w.avgLatency)
+		}
+	}
+
+	// Without since, windows start at the oldest record
+	all, err := store.GetStatsOverTime(ctx, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("GetStatsOverTime() error = %v", err)
+	}
+	if len(all) != 4 || !all[0].Start.Equal(base) {
+		t.Errorf("GetStatsOverTime(nil) = %d buckets starting %v, want 4 starting %v", len(all), all[0].Start, base)
+	}
+
+	if _, err := store.GetStatsOverTime(ctx, time.Millisecond, nil); err == nil {
+		t.Error("GetStatsOverTime() expected error for sub-second bucket")
+	}
+	yearAgo := time.Now().AddDate(-1, 0, 0)
+	if _, err := store.GetStatsOverTime(ctx, time.Second, &yearAgo); err == nil {
+		t.Error("GetStatsOverTime() expected error for too many buckets")
+	}
+}
+
 // TestPrune tests pruning old records.
 func TestPrune(t *testing.T) {
 	store, err := NewStore(StoreConfig{DBPath: ":memory:"})
@@ -726,3 +1112,49 @@ func boolPtr(b bool) *bool {
 func timePtr(t time.Time) *time.Time {
 	return &t
 }
+
+// TestDialectRebind tests placeholder rewriting for each driver.
+func TestDialectRebind(t *testing.T) {
+	query := "SELECT id FROM audit_log WHERE agent_id = ? AND allowed = ? LIMIT 10"
+
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{DriverSQLite, query},
+		{DriverPostgres, "SELECT id FROM audit_log WHERE agent_id = $1 AND allowed = $2 LIMIT 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			d, err := dialectFor(tt.driver)
+			if err != nil {
+				t.Fatalf("dialectFor() error = %v", err)
+			}
+			if got := d.rebind(query); got != tt.want {
+				t.Errorf("rebind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNewStoreDriverErrors tests rejection of unusable driver configurations.
+func TestNewStoreDriverErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config StoreConfig
+	}{
+		{"unknown driver", StoreConfig{Driver: "mysql"}},
+		{"postgres without dsn", StoreConfig{Driver: DriverPostgres}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStore(tt.config)
+			if err == nil {
+				store.Close()
+				t.Fatal("NewStore() expected error")
+			}
+		})
+	}
+}
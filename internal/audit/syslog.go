@@ -0,0 +1,269 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CEF header fields identifying the proxy as the event source.
+const (
+	cefVendor  = "AgentFacts"
+	cefProduct = "mcp-proxy"
+)
+
+// CEF and syslog severities. Denials are raised so SIEM rules can alert on
+// them without parsing the extension fields.
+const (
+	cefSeverityAllowed = 3
+	cefSeverityDenied  = 8
+
+	syslogFacilityLocal0 = 16
+	syslogInfo           = 6
+	syslogWarning        = 4
+)
+
+// SyslogConfig holds configuration for a syslog sink.
+type SyslogConfig struct {
+	Network    string // udp or tcp
+	Address    string // host:port of the syslog server
+	BufferSize int    // Records queued before new ones are dropped
+	Version    string // Proxy version reported in the CEF header
+}
+
+// SyslogSink sends audit records as CEF events to a syslog server. Records
+// are queued and sent from a background goroutine, so a slow or unreachable
+// server never blocks Write; records that don't fit in the queue, fail to
+// send, or are written after Close, are dropped.
+type SyslogSink struct {
+	network  string
+	address  string
+	version  string
+	hostname string
+
+	queue  chan *Record
+	onDrop func()
+	conn   net.Conn
+	wg     sync.WaitGroup
+
+	// closed is set by Close; mu keeps Write from sending on the closed queue
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewSyslogSink creates a syslog sink and starts its sender. The connection
+// is opened on the first record and reopened after a failed send.
+func NewSyslogSink(cfg SyslogConfig) *SyslogSink {
+	if cfg.Network == "" {
+		cfg.Network = "udp"
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	s := &SyslogSink{
+		network:  cfg.Network,
+		address:  cfg.Address,
+		version:  cfg.Version,
+		hostname: hostname,
+		queue:    make(chan *Record, cfg.BufferSize),
+	}
+	s.wg.Add(1)
+	go s.sendLoop()
+	return s
+}
+
+// SetOnDrop sets a callback invoked for each record dropped because the
+// queue was full or the send failed. Set it before writing records.
+func (s *SyslogSink) SetOnDrop(fn func()) {
+	s.onDrop = fn
+}
+
+// Write queues record for sending, dropping it if the queue is full or the
+// sink is closed.
+func (s *SyslogSink) Write(record *Record) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		s.drop()
+		return
+	}
+	select {
+	case s.queue <- record:
+	default:
+		s.drop()
+	}
+}
+
+// Flush is a no-op; queued records are sent as soon as possible.
+func (s *SyslogSink) Flush() {}
+
+// Close sends the records still queued and closes the connection. Records
+// written after Close are dropped.
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+// sendLoop sends queued records until the queue is closed.
+func (s *SyslogSink) sendLoop() {
+	defer s.wg.Done()
+
+	for record := range s.queue {
+		if err := s.send(record); err != nil {
+			log.Warn().Err(err).Str("address", s.address).Msg("Failed to send audit record to syslog")
+			s.drop()
+		}
+	}
+}
+
+// send writes one record, dialing first if there is no open connection.
+func (s *SyslogSink) send(record *Record) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	msg := s.format(record)
+	if s.network == "tcp" {
+		msg += "\n"
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *SyslogSink) drop() {
+	if s.onDrop != nil {
+		s.onDrop()
+	}
+}
+
+// format wraps the record's CEF event in an RFC 5424 syslog header.
+func (s *SyslogSink) format(r *Record) string {
+	severity := syslogInfo
+	if !r.Allowed {
+		severity = syslogWarning
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s - - - %s",
+		syslogFacilityLocal0*8+severity,
+		r.Timestamp.UTC().Format(time.RFC3339Nano),
+		s.hostname, cefProduct,
+		FormatCEF(r, s.version))
+}
+
+// FormatCEF formats r as a Common Event Format event. Denied requests get a
+// higher severity than allowed ones.
+func FormatCEF(r *Record, version string) string {
+	signature, name, severity, act := "request_allowed", "MCP request allowed", cefSeverityAllowed, "allow"
+	if !r.Allowed {
+		signature, name, severity, act = "request_denied", "MCP request denied", cefSeverityDenied, "deny"
+	}
+
+	ext := []string{
+		"rt=" + strconv.FormatInt(r.Timestamp.UnixMilli(), 10),
+		"act=" + act,
+	}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscape(value))
+		}
+	}
+	add("externalId", r.RequestID)
+	add("suser", r.AgentID)
+	add("duser", r.DID)
+	add("src", r.SourceIP)
+	add("request", r.Method)
+	reason, categories := cefViolations(r.Violations)
+	add("cat", categories)
+	add("reason", reason)
+	if r.Tool != "" {
+		add("cs1Label", "tool")
+		add("cs1", r.Tool)
+	}
+	if r.MatchedRule != "" {
+		add("cs2Label", "rule")
+		add("cs2", r.MatchedRule)
+	}
+	if r.SessionID != "" {
+		add("cs3Label", "session")
+		add("cs3", r.SessionID)
+	}
+	if r.PolicyMode != "" {
+		add("cs4Label", "policyMode")
+		add("cs4", r.PolicyMode)
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeaderEscape(cefVendor), cefHeaderEscape(cefProduct), cefHeaderEscape(version),
+		signature, name, severity, strings.Join(ext, " "))
+}
+
+// cefViolations returns the messages and distinct categories of the
+// record's violations, which are stored as a JSON array of objects. Records
+// from before violations were structured hold plain text, returned as is.
+func cefViolations(violations string) (reason, categories string) {
+	var parsed []struct {
+		Category string `json:"category"`
+		Message  string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(violations), &parsed); err != nil {
+		return violations, ""
+	}
+
+	var messages, cats []string
+	seen := make(map[string]bool)
+	for _, v := range parsed {
+		messages = append(messages, v.Message)
+		if v.Category != "" && !seen[v.Category] {
+			seen[v.Category] = true
+			cats = append(cats, v.Category)
+		}
+	}
+	return strings.Join(messages, "; "), strings.Join(cats, ",")
+}
+
+var (
+	cefHeaderReplacer    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionReplacer = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+)
+
+// cefHeaderEscape escapes a CEF header field.
+func cefHeaderEscape(s string) string {
+	return cefHeaderReplacer.Replace(s)
+}
+
+// cefExtensionEscape escapes a CEF extension value.
+func cefExtensionEscape(s string) string {
+	return cefExtensionReplacer.Replace(s)
+}
@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cefRecord builds the record used by the syslog tests.
+func cefRecord(allowed bool) *Record {
+	return cefRecordWithViolations(allowed, `[{"category":"blocklist","message":"tool is blocked","detail":"read_file"},{"category":"capability","message":"a=b"}]`)
+}
+
+// cefRecordWithViolations builds a syslog test record with the given
+// recorded violations, used when the record is denied.
+func cefRecordWithViolations(allowed bool, violations string) *Record {
+	b := NewRecordBuilder().
+		WithRequest("req-1", "sess-1").
+		WithAgent("agent1", "", "").
+		WithMethod("tools/call", "read_file", "", "").
+		WithEnvironment("10.0.0.1", "production")
+	if allowed {
+		b = b.WithDecision(true, "allow_read", "", "enforce")
+	} else {
+		b = b.WithDecision(false, "block_tool", violations, "enforce")
+	}
+	r := b.Build()
+	r.Timestamp = time.UnixMilli(1700000000000)
+	return r
+}
+
+// TestFormatCEF tests the CEF line for allowed and denied records.
+func TestFormatCEF(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    bool
+		violations string
+		want       string
+	}{
+		{
+			name:    "allowed",
+			allowed: true,
+			want: "CEF:0|AgentFacts|mcp-proxy|1.2.3|request_allowed|MCP request allowed|3|" +
+				"rt=1700000000000 act=allow externalId=req-1 suser=agent1 src=10.0.0.1 request=tools/call " +
+				"cs1Label=tool cs1=read_file cs2Label=rule cs2=allow_read cs3Label=session cs3=sess-1 " +
+				"cs4Label=policyMode cs4=enforce",
+		},
+		{
+			name:       "denied",
+			allowed:    false,
+			violations: `[{"category":"blocklist","message":"tool is blocked","detail":"read_file"},{"category":"capability","message":"a=b"}]`,
+			want: "CEF:0|AgentFacts|mcp-proxy|1.2.3|request_denied|MCP request denied|8|" +
+				"rt=1700000000000 act=deny externalId=req-1 suser=agent1 src=10.0.0.1 request=tools/call " +
+				`cat=blocklist,capability reason=tool is blocked; a\=b ` +
+				"cs1Label=tool cs1=read_file cs2Label=rule cs2=block_tool cs3Label=session cs3=sess-1 " +
+				"cs4Label=policyMode cs4=enforce",
+		},
+		{
+			name:       "denied with plain text violations",
+			allowed:    false,
+			violations: "tool is blocked",
+			want: "CEF:0|AgentFacts|mcp-proxy|1.2.3|request_denied|MCP request denied|8|" +
+				"rt=1700000000000 act=deny externalId=req-1 suser=agent1 src=10.0.0.1 request=tools/call " +
+				"reason=tool is blocked " +
+				"cs1Label=tool cs1=read_file cs2Label=rule cs2=block_tool cs3Label=session cs3=sess-1 " +
+				"cs4Label=policyMode cs4=enforce",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatCEF(cefRecordWithViolations(tt.allowed, tt.violations), "1.2.3"); got != tt.want {
+				t.Errorf("FormatCEF() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSyslogSink tests that records are sent over UDP with a syslog
+// priority matching the decision.
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	defer conn.Close()
+
+	sink := NewSyslogSink(SyslogConfig{Address: conn.LocalAddr().String(), Version: "1.2.3"})
+	sink.Write(cefRecord(true))
+	sink.Write(cefRecord(false))
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	for _, want := range []string{"<134>1 ", "<132>1 "} {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom() error = %v", err)
+		}
+		msg := string(buf[:n])
+		if !strings.HasPrefix(msg, want) {
+			t.Errorf("message = %q, want priority prefix %q", msg, want)
+		}
+		if !strings.Contains(msg, " mcp-proxy - - - CEF:0|AgentFacts|mcp-proxy|1.2.3|") {
+			t.Errorf("message = %q, want a CEF event", msg)
+		}
+	}
+}
+
+// TestSyslogSinkDrops tests that records which can't be delivered are
+// dropped and counted rather than blocking the writer.
+func TestSyslogSinkDrops(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var dropped atomic.Int64
+	sink := NewSyslogSink(SyslogConfig{Network: "tcp", Address: addr, BufferSize: 1})
+	sink.SetOnDrop(func() { dropped.Add(1) })
+
+	for i := 0; i < 5; i++ {
+		sink.Write(cefRecord(true))
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := dropped.Load(); got != 5 {
+		t.Errorf("dropped = %d, want 5", got)
+	}
+}
+
+// TestSyslogSinkWriteAfterClose tests that records written while or after
+// the sink closes are dropped instead of sending on the closed queue.
+func TestSyslogSinkWriteAfterClose(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	defer conn.Close()
+
+	sink := NewSyslogSink(SyslogConfig{Address: conn.LocalAddr().String()})
+	var dropped atomic.Int64
+	sink.SetOnDrop(func() { dropped.Add(1) })
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				sink.Write(cefRecord(true))
+			}
+		}()
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	wg.Wait()
+
+	before := dropped.Load()
+	sink.Write(cefRecord(true))
+	if got := dropped.Load() - before; got != 1 {
+		t.Errorf("dropped after Close = %d, want 1", got)
+	}
+}
@@ -2,8 +2,12 @@ package audit
 
 import (
 	"time"
+	"unicode/utf8"
 )
 
+// TruncatedMarker ends arguments cut short by RecordBuilder.TruncateArguments.
+const TruncatedMarker = "...truncated"
+
 // Record represents a single audit log entry.
 type Record struct {
 	// Identifiers
@@ -12,8 +16,10 @@ type Record struct {
 	SessionID string `json:"session_id"`
 
 	// Timing
-	Timestamp time.Time `json:"timestamp"`
-	Latency   float64   `json:"latency_ms"`
+	Timestamp       time.Time `json:"timestamp"`
+	Latency         float64   `json:"latency_ms"`          // End to end
+	PolicyLatency   float64   `json:"policy_latency_ms"`   // Policy evaluation
+	UpstreamLatency float64   `json:"upstream_latency_ms"` // Waiting on the upstream
 
 	// Agent info
 	AgentID      string `json:"agent_id"`
@@ -21,10 +27,11 @@ type Record struct {
 	Capabilities string `json:"capabilities,omitempty"` // JSON array as string
 
 	// Request info
-	Method      string `json:"method"`
-	Tool        string `json:"tool,omitempty"`
-	ResourceURI string `json:"resource_uri,omitempty"`
-	Arguments   string `json:"arguments,omitempty"` // JSON as string
+	Method             string `json:"method"`
+	Tool               string `json:"tool,omitempty"`
+	ResourceURI        string `json:"resource_uri,omitempty"`
+	Arguments          string `json:"arguments,omitempty"` // JSON as string
+	ArgumentsTruncated bool   `json:"arguments_truncated"` // Arguments exceeded the capture limit
 
 	// Identity info
 	IdentityVerified bool   `json:"identity_verified"`
@@ -35,6 +42,9 @@ type Record struct {
 	MatchedRule string `json:"matched_rule,omitempty"`
 	Violations  string `json:"violations,omitempty"` // JSON array as string
 	PolicyMode  string `json:"policy_mode"`
+	Obligations string `json:"obligations,omitempty"` // JSON array as string
+	DryRun      bool   `json:"dry_run"`               // Denial was forwarded at the client's request
+	Echoed      bool   `json:"echoed"`                // Response is the request echoed back because no upstream was connected
 
 	// Environment
 	SourceIP    string `json:"source_ip,omitempty"`
@@ -68,6 +78,14 @@ func (b *RecordBuilder) WithTiming(latencyMs float64) *RecordBuilder {
 	return b
 }
 
+// WithLatencyBreakdown sets the time spent evaluating policy and waiting on
+// the upstream.
+func (b *RecordBuilder) WithLatencyBreakdown(policyMs, upstreamMs float64) *RecordBuilder {
+	b.record.PolicyLatency = policyMs
+	b.record.UpstreamLatency = upstreamMs
+	return b
+}
+
 // WithAgent sets agent information.
 func (b *RecordBuilder) WithAgent(agentID, agentName, capabilities string) *RecordBuilder {
 	b.record.AgentID = agentID
@@ -85,6 +103,30 @@ func (b *RecordBuilder) WithMethod(method, tool, resourceURI, arguments string)
 	return b
 }
 
+// TruncateArguments limits the arguments to maxBytes, ending them with as
+// much of TruncatedMarker as fits, and flags the record if they were cut.
+// A maxBytes of 0 or less disables the limit.
+func (b *RecordBuilder) TruncateArguments(maxBytes int) *RecordBuilder {
+	if maxBytes <= 0 || len(b.record.Arguments) <= maxBytes {
+		return b
+	}
+	b.record.ArgumentsTruncated = true
+
+	// Too small for any of the arguments
+	if maxBytes <= len(TruncatedMarker) {
+		b.record.Arguments = TruncatedMarker[:maxBytes]
+		return b
+	}
+
+	// Cut on a rune boundary so the text stays readable
+	keep := maxBytes - len(TruncatedMarker)
+	for keep > 0 && !utf8.RuneStart(b.record.Arguments[keep]) {
+		keep--
+	}
+	b.record.Arguments = b.record.Arguments[:keep] + TruncatedMarker
+	return b
+}
+
 // WithIdentity sets identity information.
 func (b *RecordBuilder) WithIdentity(verified bool, did string) *RecordBuilder {
 	b.record.IdentityVerified = verified
@@ -101,6 +143,24 @@ func (b *RecordBuilder) WithDecision(allowed bool, matchedRule, violations, poli
 	return b
 }
 
+// WithObligations sets the obligations attached to the policy decision.
+func (b *RecordBuilder) WithObligations(obligations string) *RecordBuilder {
+	b.record.Obligations = obligations
+	return b
+}
+
+// WithDryRun marks the record as a dry run.
+func (b *RecordBuilder) WithDryRun(dryRun bool) *RecordBuilder {
+	b.record.DryRun = dryRun
+	return b
+}
+
+// WithEchoed marks the response as echoed by the proxy in standalone mode.
+func (b *RecordBuilder) WithEchoed(echoed bool) *RecordBuilder {
+	b.record.Echoed = echoed
+	return b
+}
+
 // WithEnvironment sets environment context.
 func (b *RecordBuilder) WithEnvironment(sourceIP, environment string) *RecordBuilder {
 	b.record.SourceIP = sourceIP
@@ -126,6 +186,10 @@ type QueryOptions struct {
 	Tool      string
 	Allowed   *bool
 
+	// ArgumentsContains matches records whose arguments JSON contains this
+	// substring. Wildcard characters are matched literally.
+	ArgumentsContains string
+
 	// Pagination
 	Limit  int
 	Offset int
@@ -143,4 +207,26 @@ type Stats struct {
 	UniqueAgents    int64   `json:"unique_agents"`
 	UniqueSessions  int64   `json:"unique_sessions"`
 	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+
+	// Breakdowns, populated only by GetTopStats
+	TopAgents       []TopEntry `json:"top_agents,omitempty"`        // By request count
+	TopTools        []TopEntry `json:"top_tools,omitempty"`         // By request count
+	TopDeniedAgents []TopEntry `json:"top_denied_agents,omitempty"` // By denial count
+	TopDeniedTools  []TopEntry `json:"top_denied_tools,omitempty"`  // By denial count
+}
+
+// TopEntry is the request and denial count for one agent or tool.
+type TopEntry struct {
+	Key      string `json:"key"`
+	Requests int64  `json:"requests"`
+	Denied   int64  `json:"denied"`
+}
+
+// BucketStats contains aggregate statistics for one time window.
+type BucketStats struct {
+	Start           time.Time `json:"start"`
+	TotalRequests   int64     `json:"total_requests"`
+	AllowedRequests int64     `json:"allowed_requests"`
+	DeniedRequests  int64     `json:"denied_requests"`
+	AvgLatencyMs    float64   `json:"avg_latency_ms"`
 }
@@ -16,6 +16,7 @@ type Writer struct {
 	buffer    []*Record
 	bufferMu  sync.Mutex
 	bufferMax int
+	stopped   bool // Set by Stop; later records are dropped
 
 	// Flush settings
 	flushInterval time.Duration
@@ -27,10 +28,12 @@ type Writer struct {
 	wg     sync.WaitGroup
 
 	// Metrics
-	written  int64
-	dropped  int64
-	flushes  int64
-	metricMu sync.Mutex
+	written   int64
+	dropped   int64
+	flushes   int64
+	lastWrite time.Time // Last successful flush, or when the writer was created
+	lastDrop  time.Time
+	metricMu  sync.Mutex
 }
 
 // WriterConfig holds configuration for the audit writer.
@@ -58,6 +61,7 @@ func NewWriter(store *Store, cfg WriterConfig) *Writer {
 		flushChan:     make(chan struct{}, 1),
 		ctx:           ctx,
 		cancel:        cancel,
+		lastWrite:     time.Now(),
 	}
 
 	return w
@@ -73,11 +77,17 @@ func (w *Writer) Start() {
 		Msg("Audit writer started")
 }
 
-// Write adds a record to the buffer.
+// Write adds a record to the buffer. Records written after Stop are
+// dropped.
 func (w *Writer) Write(record *Record) {
 	w.bufferMu.Lock()
 	defer w.bufferMu.Unlock()
 
+	if w.stopped {
+		w.recordDropped(1)
+		return
+	}
+
 	// Check if buffer is full
 	if len(w.buffer) >= w.bufferMax {
 		// Trigger async flush
@@ -89,9 +99,7 @@ func (w *Writer) Write(record *Record) {
 		// Drop oldest if still full
 		if len(w.buffer) >= w.bufferMax {
 			w.buffer = w.buffer[1:]
-			w.metricMu.Lock()
-			w.dropped++
-			w.metricMu.Unlock()
+			w.recordDropped(1)
 		}
 	}
 
@@ -141,20 +149,27 @@ func (w *Writer) flush() {
 	if err := w.store.InsertBatch(ctx, records); err != nil {
 		log.Error().Err(err).Int("count", len(records)).Msg("Failed to flush audit records")
 		// Records are lost - could implement retry queue here
-		w.metricMu.Lock()
-		w.dropped += int64(len(records))
-		w.metricMu.Unlock()
+		w.recordDropped(len(records))
 		return
 	}
 
 	w.metricMu.Lock()
 	w.written += int64(len(records))
 	w.flushes++
+	w.lastWrite = time.Now()
 	w.metricMu.Unlock()
 
 	log.Debug().Int("count", len(records)).Msg("Flushed audit records")
 }
 
+// recordDropped counts n dropped records.
+func (w *Writer) recordDropped(n int) {
+	w.metricMu.Lock()
+	w.dropped += int64(n)
+	w.lastDrop = time.Now()
+	w.metricMu.Unlock()
+}
+
 // Flush forces an immediate flush of the buffer.
 func (w *Writer) Flush() {
 	w.flush()
@@ -163,6 +178,9 @@ func (w *Writer) Flush() {
 // Stop stops the writer and flushes remaining records.
 func (w *Writer) Stop() {
 	log.Info().Msg("Stopping audit writer...")
+	w.bufferMu.Lock()
+	w.stopped = true
+	w.bufferMu.Unlock()
 	w.cancel()
 	w.wg.Wait()
 
@@ -175,27 +193,39 @@ func (w *Writer) Stop() {
 		Msg("Audit writer stopped")
 }
 
+// FillRatio returns how full the buffer is, from 0 (empty) to 1 (full).
+func (w *Writer) FillRatio() float64 {
+	w.bufferMu.Lock()
+	defer w.bufferMu.Unlock()
+	return float64(len(w.buffer)) / float64(w.bufferMax)
+}
+
 // WriterStats contains writer statistics.
 type WriterStats struct {
-	Written    int64
-	Dropped    int64
-	Flushes    int64
-	BufferSize int
+	Written    int64     `json:"written"`
+	Dropped    int64     `json:"dropped"`
+	Flushes    int64     `json:"flushes"`
+	BufferSize int       `json:"buffer_size"`
+	LastWrite  time.Time `json:"last_write"` // Last successful flush, or when the writer was created
+	LastDrop   time.Time `json:"last_drop"`  // Zero if no record was dropped
 }
 
 // Stats returns current writer statistics.
 func (w *Writer) Stats() WriterStats {
-	w.metricMu.Lock()
-	defer w.metricMu.Unlock()
-
+	// Write holds bufferMu while taking metricMu, so take them in that order
 	w.bufferMu.Lock()
 	bufferSize := len(w.buffer)
 	w.bufferMu.Unlock()
 
+	w.metricMu.Lock()
+	defer w.metricMu.Unlock()
+
 	return WriterStats{
 		Written:    w.written,
 		Dropped:    w.dropped,
 		Flushes:    w.flushes,
 		BufferSize: bufferSize,
+		LastWrite:  w.lastWrite,
+		LastDrop:   w.lastDrop,
 	}
 }
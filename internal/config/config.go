@@ -1,10 +1,15 @@
 package config
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -12,8 +17,9 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// Load reads and parses the configuration from a YAML file,
-// then applies environment variable overrides.
+// Load reads and parses the configuration from a YAML or, for a .json
+// extension, JSON file, then applies environment variable overrides and
+// resolves secret references.
 func Load(path string) (*Config, error) {
 	// Read configuration file (Clean path to prevent directory traversal)
 	data, err := os.ReadFile(filepath.Clean(path))
@@ -21,17 +27,26 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
 
-	// Parse YAML
-	cfg := &Config{}
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	// Parse over preset defaults
+	cfg := newConfig()
+	if err := parse(path, data, cfg); err != nil {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
 
 	// Apply defaults
 	applyDefaults(cfg)
 
-	// Apply environment variable overrides
+	// Apply environment variable overrides: the named shortcuts, then
+	// MCP_<PATH> for any field
 	applyEnvOverrides(cfg)
+	if err := applyPathOverrides(cfg); err != nil {
+		return nil, fmt.Errorf("applying environment overrides: %w", err)
+	}
+
+	// Resolve ${env:...} and ${file:...} secret references
+	if err := resolveReferences(cfg); err != nil {
+		return nil, fmt.Errorf("resolving config references: %w", err)
+	}
 
 	// Validate configuration
 	if err := validate(cfg); err != nil {
@@ -41,6 +56,34 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
+// parse decodes data into cfg in the format given by the path's extension.
+// JSON is a subset of YAML, so both formats are decoded through the yaml
+// tags and accept the same keys and values, such as "30s" durations; JSON
+// is checked first so that YAML-only syntax is rejected in .json files.
+func parse(path string, data []byte, cfg *Config) error {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, new(interface{})); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	return yaml.Unmarshal(data, cfg)
+}
+
+// newConfig returns a Config seeded with defaults for fields where the zero
+// value is meaningful, so an explicit zero in the config file is preserved.
+func newConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			HeartbeatInterval: 30 * time.Second,
+			SSEResumeWindow:   30 * time.Second,
+			OverflowTimeout:   5 * time.Second,
+		},
+		Audit: AuditConfig{
+			RetentionDays: 30,
+		},
+	}
+}
+
 // applyDefaults sets default values for configuration fields.
 func applyDefaults(cfg *Config) {
 	if cfg.Version == "" {
@@ -48,11 +91,17 @@ func applyDefaults(cfg *Config) {
 	}
 	applyServerDefaults(&cfg.Server)
 	applyUpstreamDefaults(&cfg.Upstream)
+	for i := range cfg.Upstreams {
+		applyUpstreamDefaults(&cfg.Upstreams[i].UpstreamConfig)
+	}
+	applyShadowDefaults(&cfg.Shadow)
+	applyResponseCacheDefaults(&cfg.ResponseCache)
 	applyAgentFactsDefaults(&cfg.AgentFacts)
 	applyPolicyDefaults(&cfg.Policy)
 	applyAuditDefaults(&cfg.Audit)
 	applyMetricsDefaults(&cfg.Metrics)
 	applyHealthDefaults(&cfg.Health)
+	applyAdminDefaults(&cfg.Admin)
 	applyLoggingDefaults(&cfg.Logging)
 	applyTLSDefaults(&cfg.TLS)
 }
@@ -61,12 +110,13 @@ func applyServerDefaults(s *ServerConfig) {
 	if s.Listen.Address == "" {
 		s.Listen.Address = "0.0.0.0"
 	}
-	if s.Listen.Port == 0 {
-		s.Listen.Port = 3000
-	}
 	if s.Transport == "" {
 		s.Transport = "sse"
 	}
+	// stdio doesn't listen, so a port there can only be a mistake
+	if s.Listen.Port == 0 && s.Transport != "stdio" {
+		s.Listen.Port = 3000
+	}
 	if s.ReadTimeout == 0 {
 		s.ReadTimeout = 30 * time.Second
 	}
@@ -79,12 +129,70 @@ func applyServerDefaults(s *ServerConfig) {
 	if s.GracefulShutdown == 0 {
 		s.GracefulShutdown = 30 * time.Second
 	}
+	if s.ShutdownTimeouts.Transport == 0 {
+		s.ShutdownTimeouts.Transport = s.GracefulShutdown
+	}
+	if s.ShutdownTimeouts.Upstream == 0 {
+		s.ShutdownTimeouts.Upstream = 5 * time.Second
+	}
+	if s.ShutdownTimeouts.Sessions == 0 {
+		s.ShutdownTimeouts.Sessions = 5 * time.Second
+	}
+	if s.ShutdownTimeouts.Audit == 0 {
+		s.ShutdownTimeouts.Audit = 10 * time.Second
+	}
 	if s.MaxConnections == 0 {
 		s.MaxConnections = 1000
 	}
+	if s.SessionEviction == "" {
+		s.SessionEviction = "reject"
+	}
+	if s.Protocol.Unsupported == "" {
+		s.Protocol.Unsupported = "reject"
+	}
+	if s.MaxRequestBytes == 0 {
+		s.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	if s.SSEReplayBuffer == 0 {
+		s.SSEReplayBuffer = 100
+	}
+	if s.Stdio.Framing == "" {
+		s.Stdio.Framing = "ndjson"
+	}
+	if s.MessageBuffer == 0 {
+		s.MessageBuffer = 100
+	}
+	if s.MessageOverflow == "" {
+		s.MessageOverflow = "block"
+	}
+	if s.RateLimit.Window == 0 {
+		s.RateLimit.Window = time.Minute
+	}
 	s.Security.EnableSecurityHeaders = true
 }
 
+func applyShadowDefaults(s *ShadowConfig) {
+	if len(s.Methods) == 0 {
+		s.Methods = []string{"tools/list", "resources/list", "resources/read", "prompts/list", "prompts/get"}
+	}
+	if s.Timeout == 0 {
+		s.Timeout = 10 * time.Second
+	}
+	applyUpstreamDefaults(&s.Upstream)
+}
+
+func applyResponseCacheDefaults(c *ResponseCacheConfig) {
+	if len(c.Methods) == 0 {
+		c.Methods = []string{"tools/list", "resources/read"}
+	}
+	if c.TTL == 0 {
+		c.TTL = time.Minute
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 1000
+	}
+}
+
 func applyUpstreamDefaults(u *UpstreamConfig) {
 	if u.Transport == "" {
 		u.Transport = "sse"
@@ -119,6 +227,18 @@ func applyUpstreamDefaults(u *UpstreamConfig) {
 	if u.CircuitBreaker.Timeout == 0 {
 		u.CircuitBreaker.Timeout = 30 * time.Second
 	}
+	if u.Probe.Interval == 0 {
+		u.Probe.Interval = 30 * time.Second
+	}
+	if u.Probe.Timeout == 0 {
+		u.Probe.Timeout = 5 * time.Second
+	}
+	if u.Probe.FailureThreshold == 0 {
+		u.Probe.FailureThreshold = 3
+	}
+	if u.ResponseBuffer.PerRequest == 0 {
+		u.ResponseBuffer.PerRequest = 1
+	}
 }
 
 func applyAgentFactsDefaults(af *AgentFactsConfig) {
@@ -161,9 +281,30 @@ func applyPolicyDefaults(p *PolicyConfig) {
 	if p.Evaluation.Timeout == 0 {
 		p.Evaluation.Timeout = 100 * time.Millisecond
 	}
+	if p.Obligations.WebhookTimeout == 0 {
+		p.Obligations.WebhookTimeout = 5 * time.Second
+	}
+	if p.Bundle.PollInterval == 0 {
+		p.Bundle.PollInterval = time.Minute
+	}
+	if p.DecisionLog.Timeout == 0 {
+		p.DecisionLog.Timeout = 5 * time.Second
+	}
+	if p.DecisionLog.SampleRate == 0 {
+		p.DecisionLog.SampleRate = 1
+	}
+	if p.DecisionLog.BufferSize == 0 {
+		p.DecisionLog.BufferSize = 1000
+	}
+	if p.Backend == "" {
+		p.Backend = "opa"
+	}
 }
 
 func applyAuditDefaults(a *AuditConfig) {
+	if a.Driver == "" {
+		a.Driver = "sqlite"
+	}
 	if a.DBPath == "" {
 		a.DBPath = "audit.db"
 	}
@@ -173,8 +314,16 @@ func applyAuditDefaults(a *AuditConfig) {
 	if a.FlushInterval == 0 {
 		a.FlushInterval = time.Second
 	}
-	if a.RetentionDays == 0 {
-		a.RetentionDays = 30
+	if a.SampleRate == 0 {
+		a.SampleRate = 1
+	}
+	for i := range a.Sinks {
+		if a.Sinks[i].BufferSize == 0 {
+			a.Sinks[i].BufferSize = 1000
+		}
+		if a.Sinks[i].Type == "syslog" && a.Sinks[i].Network == "" {
+			a.Sinks[i].Network = "udp"
+		}
 	}
 }
 
@@ -205,6 +354,15 @@ func applyHealthDefaults(h *HealthConfig) {
 	}
 }
 
+func applyAdminDefaults(a *AdminConfig) {
+	if a.Address == "" {
+		a.Address = "127.0.0.1"
+	}
+	if a.Port == 0 {
+		a.Port = 9091
+	}
+}
+
 func applyLoggingDefaults(l *LoggingConfig) {
 	if l.Level == "" {
 		l.Level = "info"
@@ -215,6 +373,9 @@ func applyLoggingDefaults(l *LoggingConfig) {
 	if l.Output == "" {
 		l.Output = "stdout"
 	}
+	if l.File.MaxSize == 0 {
+		l.File.MaxSize = 100
+	}
 }
 
 func applyTLSDefaults(t *TLSConfig) {
@@ -226,31 +387,39 @@ func applyTLSDefaults(t *TLSConfig) {
 	}
 }
 
-// applyEnvOverrides applies environment variable overrides to the configuration.
-// Environment variables use the format MCP_<SECTION>_<KEY> (uppercase, underscores).
+// applyEnvOverrides applies the named environment variable shortcuts, some of
+// which differ from the field path, such as MCP_SERVER_PORT for
+// server.listen.port.
 func applyEnvOverrides(cfg *Config) {
 	envMappings := map[string]func(string){
-		"MCP_SERVER_PORT":      func(v string) { cfg.Server.Listen.Port = parseInt(v, cfg.Server.Listen.Port) },
-		"MCP_SERVER_ADDRESS":   func(v string) { cfg.Server.Listen.Address = v },
-		"MCP_SERVER_TRANSPORT": func(v string) { cfg.Server.Transport = v },
-		"MCP_UPSTREAM_URL":     func(v string) { cfg.Upstream.URL = v },
-		"MCP_AGENT_ID":         func(v string) { cfg.Agent.ID = v },
-		"MCP_AGENT_NAME":       func(v string) { cfg.Agent.Name = v },
-		"MCP_AGENTFACTS_MODE":  func(v string) { cfg.AgentFacts.Mode = v },
-		"MCP_POLICY_MODE":      func(v string) { cfg.Policy.Mode = v },
-		"MCP_POLICY_RULES_DIR": func(v string) { cfg.Policy.PolicyDir = v },
-		"MCP_POLICY_DATA_FILE": func(v string) { cfg.Policy.DataFile = v },
-		"MCP_AUDIT_ENABLED":    func(v string) { cfg.Audit.Enabled = parseBool(v) },
-		"MCP_AUDIT_DB_PATH":    func(v string) { cfg.Audit.DBPath = v },
-		"MCP_METRICS_ENABLED":  func(v string) { cfg.Metrics.Enabled = parseBool(v) },
-		"MCP_METRICS_PORT":     func(v string) { cfg.Metrics.Port = parseInt(v, cfg.Metrics.Port) },
-		"MCP_HEALTH_ENABLED":   func(v string) { cfg.Health.Enabled = parseBool(v) },
-		"MCP_HEALTH_PORT":      func(v string) { cfg.Health.Port = parseInt(v, cfg.Health.Port) },
-		"MCP_LOGGING_LEVEL":    func(v string) { cfg.Logging.Level = v },
-		"MCP_LOGGING_FORMAT":   func(v string) { cfg.Logging.Format = v },
-		"MCP_TLS_ENABLED":      func(v string) { cfg.TLS.Enabled = parseBool(v) },
-		"MCP_TLS_CERT_FILE":    func(v string) { cfg.TLS.CertFile = v },
-		"MCP_TLS_KEY_FILE":     func(v string) { cfg.TLS.KeyFile = v },
+		"MCP_SERVER_PORT":          func(v string) { cfg.Server.Listen.Port = parseInt(v, cfg.Server.Listen.Port) },
+		"MCP_SERVER_ADDRESS":       func(v string) { cfg.Server.Listen.Address = v },
+		"MCP_SERVER_TRANSPORT":     func(v string) { cfg.Server.Transport = v },
+		"MCP_SERVER_AUTH_ENABLED":  func(v string) { cfg.Server.Auth.Enabled = parseBool(v) },
+		"MCP_SERVER_AUTH_SECRET":   func(v string) { cfg.Server.Auth.Secret = v },
+		"MCP_UPSTREAM_URL":         func(v string) { cfg.Upstream.URL = v },
+		"MCP_UPSTREAM_TRANSPORT":   func(v string) { cfg.Upstream.Transport = v },
+		"MCP_UPSTREAM_COMMAND":     func(v string) { cfg.Upstream.Command = v },
+		"MCP_AGENT_ID":             func(v string) { cfg.Agent.ID = v },
+		"MCP_AGENT_NAME":           func(v string) { cfg.Agent.Name = v },
+		"MCP_AGENTFACTS_MODE":      func(v string) { cfg.AgentFacts.Mode = v },
+		"MCP_POLICY_MODE":          func(v string) { cfg.Policy.Mode = v },
+		"MCP_POLICY_RULES_DIR":     func(v string) { cfg.Policy.PolicyDir = v },
+		"MCP_POLICY_DATA_FILE":     func(v string) { cfg.Policy.DataFile = v },
+		"MCP_POLICY_ALERT_WEBHOOK": func(v string) { cfg.Policy.Obligations.AlertWebhook = v },
+		"MCP_AUDIT_ENABLED":        func(v string) { cfg.Audit.Enabled = parseBool(v) },
+		"MCP_AUDIT_DB_PATH":        func(v string) { cfg.Audit.DBPath = v },
+		"MCP_AUDIT_DRIVER":         func(v string) { cfg.Audit.Driver = v },
+		"MCP_AUDIT_DSN":            func(v string) { cfg.Audit.DSN = v },
+		"MCP_METRICS_ENABLED":      func(v string) { cfg.Metrics.Enabled = parseBool(v) },
+		"MCP_METRICS_PORT":         func(v string) { cfg.Metrics.Port = parseInt(v, cfg.Metrics.Port) },
+		"MCP_HEALTH_ENABLED":       func(v string) { cfg.Health.Enabled = parseBool(v) },
+		"MCP_HEALTH_PORT":          func(v string) { cfg.Health.Port = parseInt(v, cfg.Health.Port) },
+		"MCP_LOGGING_LEVEL":        func(v string) { cfg.Logging.Level = v },
+		"MCP_LOGGING_FORMAT":       func(v string) { cfg.Logging.Format = v },
+		"MCP_TLS_ENABLED":          func(v string) { cfg.TLS.Enabled = parseBool(v) },
+		"MCP_TLS_CERT_FILE":        func(v string) { cfg.TLS.CertFile = v },
+		"MCP_TLS_KEY_FILE":         func(v string) { cfg.TLS.KeyFile = v },
 	}
 
 	for env, setter := range envMappings {
@@ -270,16 +439,191 @@ func applyEnvOverrides(cfg *Config) {
 	}
 }
 
+// enforcedMethods are the methods the router checks against policy by
+// default. A method override can only move them to another handler with
+// allow_unenforced.
+var enforcedMethods = map[string]bool{"tools/call": true, "resources/read": true, "resources/subscribe": true}
+
+// filterMethods are the methods whose responses the filter handler can
+// filter.
+var filterMethods = map[string]bool{"tools/list": true, "resources/list": true}
+
 // validate checks the configuration for errors.
 func validate(cfg *Config) error {
 	// Server validation
-	if cfg.Server.Listen.Port < 1 || cfg.Server.Listen.Port > 65535 {
+	if cfg.Server.Transport != "stdio" && (cfg.Server.Listen.Port < 1 || cfg.Server.Listen.Port > 65535) {
 		return fmt.Errorf("invalid server port: %d", cfg.Server.Listen.Port)
 	}
 
-	validTransports := map[string]bool{"sse": true, "stdio": true, "http": true}
+	if cfg.Server.HeartbeatInterval < 0 {
+		return fmt.Errorf("invalid server heartbeat_interval: %s", cfg.Server.HeartbeatInterval)
+	}
+
+	validEvictions := map[string]bool{"reject": true, "lru": true}
+	if !validEvictions[cfg.Server.SessionEviction] {
+		return fmt.Errorf("invalid server session_eviction: %s (must be reject or lru)", cfg.Server.SessionEviction)
+	}
+
+	if cfg.Server.SSEResumeWindow < 0 {
+		return fmt.Errorf("invalid server sse_resume_window: %s (must be >= 0)", cfg.Server.SSEResumeWindow)
+	}
+
+	if p := cfg.Server.Protocol; p.Unsupported != "reject" && p.Unsupported != "rewrite" {
+		return fmt.Errorf("invalid server protocol unsupported: %s (must be reject or rewrite)", p.Unsupported)
+	}
+	for _, v := range cfg.Server.Protocol.Versions {
+		if v == "" {
+			return fmt.Errorf("server protocol versions cannot be empty")
+		}
+	}
+
+	if len(cfg.Server.Methods.Allow) > 0 && len(cfg.Server.Methods.Deny) > 0 {
+		return fmt.Errorf("server methods allow and deny cannot both be set")
+	}
+
+	validHandlers := map[string]bool{"": true, "passthrough": true, "enforce": true, "filter": true}
+	validLogLevels := map[string]bool{"": true, "none": true, "metadata": true, "full": true}
+	for method, o := range cfg.Server.Methods.Overrides {
+		if !validHandlers[o.Handler] {
+			return fmt.Errorf("invalid handler for method %s: %s (must be passthrough, enforce, or filter)", method, o.Handler)
+		}
+		if !validLogLevels[o.LogLevel] {
+			return fmt.Errorf("invalid log_level for method %s: %s (must be none, metadata, or full)", method, o.LogLevel)
+		}
+		if o.Handler == "filter" && !filterMethods[method] {
+			return fmt.Errorf("invalid handler for method %s: filter (only applies to tools/list and resources/list)", method)
+		}
+		if enforcedMethods[method] && o.Handler != "" && o.Handler != "enforce" && !o.AllowUnenforced {
+			return fmt.Errorf("invalid handler for method %s: %s turns off enforcement (set allow_unenforced to allow it)", method, o.Handler)
+		}
+	}
+
+	if cfg.Server.MessageBuffer < 1 {
+		return fmt.Errorf("invalid server message_buffer: %d", cfg.Server.MessageBuffer)
+	}
+
+	validOverflows := map[string]bool{"block": true, "close": true}
+	if !validOverflows[cfg.Server.MessageOverflow] {
+		return fmt.Errorf("invalid server message_overflow: %s (must be block or close)", cfg.Server.MessageOverflow)
+	}
+
+	if cfg.Server.OverflowTimeout < 0 {
+		return fmt.Errorf("invalid server overflow_timeout: %s (must be >= 0)", cfg.Server.OverflowTimeout)
+	}
+
+	if cfg.Server.MaxSessionLifetime < 0 {
+		return fmt.Errorf("invalid server max_session_lifetime: %s (must be >= 0)", cfg.Server.MaxSessionLifetime)
+	}
+
+	if cfg.Server.SessionIdleTimeout < 0 {
+		return fmt.Errorf("invalid server session_idle_timeout: %s (must be >= 0)", cfg.Server.SessionIdleTimeout)
+	}
+
+	if t := cfg.Server.ShutdownTimeouts; t.Transport < 0 || t.Upstream < 0 || t.Sessions < 0 || t.Audit < 0 {
+		return fmt.Errorf("server shutdown_timeouts must be >= 0")
+	}
+
+	if cfg.Server.RateLimit.Requests < 0 {
+		return fmt.Errorf("invalid server rate_limit requests: %d", cfg.Server.RateLimit.Requests)
+	}
+	if cfg.Server.RateLimit.Window < 0 {
+		return fmt.Errorf("invalid server rate_limit window: %s", cfg.Server.RateLimit.Window)
+	}
+	if cfg.Server.MaxConcurrent < 0 {
+		return fmt.Errorf("invalid server max_concurrent_requests: %d (must be >= 0)", cfg.Server.MaxConcurrent)
+	}
+
+	if cfg.Server.MaxRequestBytes < 0 {
+		return fmt.Errorf("invalid server max_request_bytes: %d", cfg.Server.MaxRequestBytes)
+	}
+	if cfg.Server.MaxResponseBytes < 0 {
+		return fmt.Errorf("invalid server max_response_bytes: %d (must be >= 0)", cfg.Server.MaxResponseBytes)
+	}
+
+	validTransports := map[string]bool{"sse": true, "stdio": true, "http": true, "websocket": true}
 	if !validTransports[cfg.Server.Transport] {
-		return fmt.Errorf("invalid server transport: %s (must be sse, stdio, or http)", cfg.Server.Transport)
+		return fmt.Errorf("invalid server transport: %s (must be sse, stdio, http, or websocket)", cfg.Server.Transport)
+	}
+	if f := cfg.Server.Stdio.Framing; f != "ndjson" && f != "content-length" {
+		return fmt.Errorf("invalid server stdio framing: %s (must be ndjson or content-length)", f)
+	}
+
+	// Auth validation
+	if cfg.Server.Auth.Enabled && len(cfg.Server.Auth.Tokens) == 0 && cfg.Server.Auth.Secret == "" {
+		return fmt.Errorf("server auth is enabled but no tokens or secret are configured")
+	}
+
+	// Upstream validation
+	validUpstreamTransports := map[string]bool{"sse": true, "http": true, "stdio": true}
+	if !validUpstreamTransports[cfg.Upstream.Transport] {
+		return fmt.Errorf("invalid upstream transport: %s (must be sse, http, or stdio)", cfg.Upstream.Transport)
+	}
+	if cfg.Upstream.Transport == "stdio" && cfg.Upstream.Command == "" {
+		return fmt.Errorf("upstream command is required for stdio transport")
+	}
+	if n := cfg.Upstream.Probe.FailureThreshold; n < 1 {
+		return fmt.Errorf("invalid upstream probe failure_threshold: %d (must be >= 1)", n)
+	}
+	if n := cfg.Upstream.ResponseBuffer.PerRequest; n < 1 {
+		return fmt.Errorf("invalid upstream response_buffer per_request: %d (must be >= 1)", n)
+	}
+	upstreamNames := make(map[string]bool, len(cfg.Upstreams))
+	for _, u := range cfg.Upstreams {
+		if u.Name == "" {
+			return fmt.Errorf("upstreams entries require a name")
+		}
+		if u.Name == "default" {
+			return fmt.Errorf("upstream name %q is reserved for the upstream section", u.Name)
+		}
+		if strings.Contains(u.Name, ".") {
+			return fmt.Errorf("invalid upstream name: %s (must not contain '.', which namespaces its tools)", u.Name)
+		}
+		if upstreamNames[u.Name] {
+			return fmt.Errorf("duplicate upstream name: %s", u.Name)
+		}
+		upstreamNames[u.Name] = true
+		if !validUpstreamTransports[u.Transport] {
+			return fmt.Errorf("invalid transport for upstream %s: %s (must be sse, http, or stdio)", u.Name, u.Transport)
+		}
+		if u.Transport == "stdio" && u.Command == "" {
+			return fmt.Errorf("upstream %s: command is required for stdio transport", u.Name)
+		}
+		if u.Transport != "stdio" && u.URL == "" {
+			return fmt.Errorf("upstream %s: url is required", u.Name)
+		}
+		if len(u.Match.Methods) == 0 && len(u.Match.ToolPrefixes) == 0 {
+			return fmt.Errorf("upstream %s: match needs methods or tool_prefixes", u.Name)
+		}
+		for _, pattern := range u.Match.Methods {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("upstream %s: invalid method pattern %q: %w", u.Name, pattern, err)
+			}
+		}
+	}
+
+	if cfg.Shadow.Enabled {
+		shadow := cfg.Shadow.Upstream
+		if !validUpstreamTransports[shadow.Transport] {
+			return fmt.Errorf("invalid shadow upstream transport: %s (must be sse, http, or stdio)", shadow.Transport)
+		}
+		if shadow.Transport == "stdio" && shadow.Command == "" {
+			return fmt.Errorf("shadow upstream command is required for stdio transport")
+		}
+		if shadow.Transport != "stdio" && shadow.URL == "" {
+			return fmt.Errorf("shadow upstream url is required")
+		}
+		if cfg.Shadow.Timeout < 0 {
+			return fmt.Errorf("invalid shadow timeout: %s (must be >= 0)", cfg.Shadow.Timeout)
+		}
+		for _, pattern := range cfg.Shadow.Methods {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("shadow: invalid method pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	if cfg.ResponseCache.Enabled && (cfg.ResponseCache.TTL < 0 || cfg.ResponseCache.MaxEntries < 0) {
+		return fmt.Errorf("response_cache ttl and max_entries must be >= 0")
 	}
 
 	// AgentFacts mode validation
@@ -294,12 +638,262 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("invalid policy mode: %s (must be audit or enforce)", cfg.Policy.Mode)
 	}
 
+	if cfg.Policy.AllowDryRun && len(cfg.Policy.DryRunDIDs) == 0 {
+		return fmt.Errorf("policy allow_dry_run requires dry_run_dids, the verified agents allowed dry runs")
+	}
+
+	if cfg.Policy.Backend != "opa" && cfg.Policy.Backend != "capability" {
+		return fmt.Errorf("invalid policy backend: %s (must be opa or capability)", cfg.Policy.Backend)
+	}
+	if p := cfg.Policy; p.Backend == "capability" {
+		// These only apply to Rego, which the capability backend doesn't run
+		switch {
+		case p.WatchForChanges:
+			return fmt.Errorf("policy watch_for_changes is not supported by the capability backend")
+		case p.Bundle.URL != "":
+			return fmt.Errorf("policy bundle is not supported by the capability backend")
+		case p.WarmUp.Enabled:
+			return fmt.Errorf("policy warm_up is not supported by the capability backend")
+		case p.Evaluation.Explain:
+			return fmt.Errorf("policy evaluation explain is not supported by the capability backend")
+		}
+	}
+
+	if cfg.Policy.Bundle.URL != "" {
+		if !strings.HasPrefix(cfg.Policy.Bundle.URL, "http://") && !strings.HasPrefix(cfg.Policy.Bundle.URL, "https://") {
+			return fmt.Errorf("invalid policy bundle url: %s (must be http or https)", cfg.Policy.Bundle.URL)
+		}
+		if cfg.Policy.Bundle.PollInterval < 0 {
+			return fmt.Errorf("invalid policy bundle poll_interval: %s", cfg.Policy.Bundle.PollInterval)
+		}
+	}
+
+	if dl := cfg.Policy.DecisionLog; dl.Enabled {
+		switch dl.Type {
+		case "file":
+			if dl.Path == "" {
+				return fmt.Errorf("policy decision_log path is required for file logs")
+			}
+		case "http":
+			if !strings.HasPrefix(dl.URL, "http://") && !strings.HasPrefix(dl.URL, "https://") {
+				return fmt.Errorf("invalid policy decision_log url: %q (must be http or https)", dl.URL)
+			}
+			if dl.Timeout < 0 {
+				return fmt.Errorf("invalid policy decision_log timeout: %s", dl.Timeout)
+			}
+		default:
+			return fmt.Errorf("invalid policy decision_log type: %q (must be file or http)", dl.Type)
+		}
+		if dl.SampleRate < 1 {
+			return fmt.Errorf("invalid policy decision_log sample_rate: %d (must be >= 1)", dl.SampleRate)
+		}
+		if dl.BufferSize < 0 {
+			return fmt.Errorf("invalid policy decision_log buffer_size: %d (must be >= 0)", dl.BufferSize)
+		}
+	}
+
+	for i, agent := range cfg.Policy.WarmUp.Agents {
+		if agent.ID == "" {
+			return fmt.Errorf("policy warm_up agents[%d] id is required", i)
+		}
+	}
+
+	// Audit driver validation
+	if cfg.Audit.Enabled {
+		validDrivers := map[string]bool{"sqlite": true, "postgres": true}
+		if !validDrivers[cfg.Audit.Driver] {
+			return fmt.Errorf("invalid audit driver: %s (must be sqlite or postgres)", cfg.Audit.Driver)
+		}
+		if cfg.Audit.Driver == "postgres" && cfg.Audit.DSN == "" {
+			return fmt.Errorf("audit dsn is required for postgres driver")
+		}
+		// The postgres dialect needs a database/sql driver linked in
+		if cfg.Audit.Driver == "postgres" && !slices.Contains(sql.Drivers(), "postgres") {
+			return fmt.Errorf("audit driver postgres is not linked into this build (use sqlite)")
+		}
+	}
+
+	if t := cfg.Server.Methods.Timeouts; t.Passthrough < 0 || t.Enforce < 0 || t.Filter < 0 {
+		return fmt.Errorf("server methods timeouts must be >= 0")
+	}
+
+	// Audit retention validation (0 keeps records forever)
+	if cfg.Audit.RetentionDays < 0 {
+		return fmt.Errorf("invalid audit retention_days: %d (must be >= 0)", cfg.Audit.RetentionDays)
+	}
+	if cfg.Audit.SampleRate < 1 {
+		return fmt.Errorf("invalid audit sample_rate: %d (must be >= 1)", cfg.Audit.SampleRate)
+	}
+	if cfg.Audit.Capture.MaxArgumentBytes < 0 {
+		return fmt.Errorf("invalid audit capture max_argument_bytes: %d (must be >= 0)", cfg.Audit.Capture.MaxArgumentBytes)
+	}
+	for i, sink := range cfg.Audit.Sinks {
+		if sink.BufferSize < 0 {
+			return fmt.Errorf("invalid audit sinks[%d] buffer_size: %d (must be >= 0)", i, sink.BufferSize)
+		}
+		switch sink.Type {
+		case "stdout":
+			// The stdio transport writes MCP messages to stdout
+			if cfg.Server.Transport == "stdio" {
+				return fmt.Errorf("audit sinks[%d] type stdout cannot be used with the stdio transport", i)
+			}
+		case "file":
+			if sink.Path == "" {
+				return fmt.Errorf("audit sinks[%d] path is required for file sinks", i)
+			}
+		case "syslog":
+			if sink.Address == "" {
+				return fmt.Errorf("audit sinks[%d] address is required for syslog sinks", i)
+			}
+			if sink.Network != "udp" && sink.Network != "tcp" {
+				return fmt.Errorf("invalid audit sinks[%d] network: %q (must be udp or tcp)", i, sink.Network)
+			}
+		default:
+			return fmt.Errorf("invalid audit sinks[%d] type: %q (must be stdout, file or syslog)", i, sink.Type)
+		}
+	}
+
 	// Logging level validation
 	validLevels := map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
 	if !validLevels[cfg.Logging.Level] {
 		return fmt.Errorf("invalid logging level: %s (must be debug, info, warn, or error)", cfg.Logging.Level)
 	}
+	switch cfg.Logging.Output {
+	case "stdout", "stderr":
+	case "file":
+		if cfg.Logging.File.Path == "" {
+			return fmt.Errorf("logging file path is required for file output")
+		}
+	default:
+		return fmt.Errorf("invalid logging output: %s (must be stdout, stderr, or file)", cfg.Logging.Output)
+	}
+	if cfg.Logging.File.MaxSize < 0 || cfg.Logging.File.MaxBackups < 0 || cfg.Logging.File.MaxAge < 0 {
+		return fmt.Errorf("logging file max_size, max_backups and max_age must be >= 0")
+	}
+
+	// TLS validation
+	if cfg.TLS.Enabled {
+		if cfg.TLS.CertFile == "" || cfg.TLS.KeyFile == "" {
+			return fmt.Errorf("tls cert_file and key_file are required when tls is enabled")
+		}
+		validTLSVersions := map[string]bool{"1.2": true, "1.3": true}
+		if !validTLSVersions[cfg.TLS.MinVersion] {
+			return fmt.Errorf("invalid tls min_version: %s (must be 1.2 or 1.3)", cfg.TLS.MinVersion)
+		}
+		validClientAuth := map[string]bool{"none": true, "request": true, "require": true}
+		if !validClientAuth[cfg.TLS.ClientAuth] {
+			return fmt.Errorf("invalid tls client_auth: %s (must be none, request, or require)", cfg.TLS.ClientAuth)
+		}
+		if cfg.TLS.ClientAuth == "require" && cfg.TLS.CAFile == "" {
+			return fmt.Errorf("tls ca_file is required when client_auth is require")
+		}
+	}
+
+	// Admin validation
+	if cfg.Admin.Enabled {
+		if cfg.Admin.Port < 1 || cfg.Admin.Port > 65535 {
+			return fmt.Errorf("invalid admin port: %d", cfg.Admin.Port)
+		}
+		hasToken := false
+		for _, t := range cfg.Admin.Tokens {
+			if t != "" {
+				hasToken = true
+			}
+		}
+		if !hasToken {
+			return fmt.Errorf("admin tokens are required when admin is enabled")
+		}
+	}
+
+	return validateRelations(cfg)
+}
+
+// validateRelations checks settings that are only wrong in combination, or
+// that depend on files, so that misconfigurations fail at startup rather
+// than on first use.
+func validateRelations(cfg *Config) error {
+	if cfg.TLS.Enabled {
+		if cfg.Server.Transport != "sse" {
+			return fmt.Errorf("tls is enabled but only the sse server transport supports it (transport is %s)", cfg.Server.Transport)
+		}
+		files := []struct{ key, path string }{
+			{"cert_file", cfg.TLS.CertFile},
+			{"key_file", cfg.TLS.KeyFile},
+			{"ca_file", cfg.TLS.CAFile},
+		}
+		for _, f := range files {
+			if f.path == "" {
+				continue
+			}
+			if _, err := os.Stat(f.path); err != nil {
+				return fmt.Errorf("tls %s: %w", f.key, err)
+			}
+		}
+	}
+
+	if cfg.Upstream.Required && cfg.Upstream.URL == "" && cfg.Upstream.Command == "" && len(cfg.Upstreams) == 0 {
+		return fmt.Errorf("upstream required is set but no upstream url or command is configured")
+	}
+
+	if cfg.Audit.Enabled && cfg.Audit.Driver == "sqlite" {
+		if err := checkWritable(cfg.Audit.DBPath); err != nil {
+			return fmt.Errorf("audit db_path %s is not writable: %w", cfg.Audit.DBPath, err)
+		}
+	}
+
+	return nil
+}
+
+// Warnings returns settings that are valid but have no effect, for logging
+// at startup.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.Server.Transport == "stdio" && c.Server.Listen.Port != 0 {
+		warnings = append(warnings, fmt.Sprintf("server listen port %d is ignored: the stdio transport does not listen", c.Server.Listen.Port))
+	}
+	if c.Policy.WatchForChanges && c.Policy.Bundle.URL != "" {
+		warnings = append(warnings, "policy watch_for_changes is ignored: the policy bundle replaces the local policy files")
+	}
+	for _, method := range slices.Sorted(maps.Keys(c.Server.Methods.Overrides)) {
+		if o := c.Server.Methods.Overrides[method]; enforcedMethods[method] && o.Handler != "" && o.Handler != "enforce" {
+			warnings = append(warnings, fmt.Sprintf("server method %s is not enforced: its override uses the %s handler", method, o.Handler))
+		}
+	}
+	return warnings
+}
+
+// checkWritable reports whether a SQLite database can be written at path:
+// the file, if it exists, must open for writing, and its directory, which
+// holds the journal, must exist. Nothing is written, so the directory's
+// permissions are left for the store to report when it opens.
+func checkWritable(path string) error {
+	if path == "" {
+		return fmt.Errorf("path is empty")
+	}
+	if path == ":memory:" {
+		return nil
+	}
 
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("is a directory")
+		}
+		f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	info, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", filepath.Dir(path))
+	}
 	return nil
 }
 
@@ -330,37 +924,132 @@ func (c *Config) MaskSensitive() *Config {
 	if masked.TLS.KeyFile != "" {
 		masked.TLS.KeyFile = "****"
 	}
+	if masked.Audit.DSN != "" {
+		masked.Audit.DSN = "****"
+	}
+	if masked.Server.Auth.Secret != "" {
+		masked.Server.Auth.Secret = "****"
+	}
+	masked.Server.Auth.Tokens = maskList(masked.Server.Auth.Tokens)
+	masked.Admin.Tokens = maskList(masked.Admin.Tokens)
+	masked.Upstream = maskUpstream(masked.Upstream)
+	if len(masked.Upstreams) > 0 {
+		upstreams := make([]NamedUpstream, len(masked.Upstreams))
+		for i, u := range masked.Upstreams {
+			u.UpstreamConfig = maskUpstream(u.UpstreamConfig)
+			upstreams[i] = u
+		}
+		masked.Upstreams = upstreams
+	}
+	masked.Shadow.Upstream = maskUpstream(masked.Shadow.Upstream)
+	masked.Policy.Bundle.URL = maskURL(masked.Policy.Bundle.URL)
+	if masked.Policy.Bundle.VerificationKey != "" {
+		masked.Policy.Bundle.VerificationKey = "****"
+	}
+	// Webhook and log endpoints often carry a token in the URL
+	if masked.Policy.Obligations.AlertWebhook != "" {
+		masked.Policy.Obligations.AlertWebhook = "****"
+	}
+	if masked.Policy.DecisionLog.URL != "" {
+		masked.Policy.DecisionLog.URL = "****"
+	}
 	return &masked
 }
 
-// GetEnvMapping returns a map of configuration paths to environment variable names.
+// maskUpstream returns a copy of u with the credentials it may carry
+// masked: every header value and command argument, and the userinfo and
+// query of its URL.
+func maskUpstream(u UpstreamConfig) UpstreamConfig {
+	u.URL = maskURL(u.URL)
+	u.Args = maskList(u.Args)
+	u.Headers = maskHeaders(u.Headers)
+	return u
+}
+
+// maskURL returns raw with its userinfo and query values masked, keeping
+// the rest readable. A URL that doesn't parse is masked entirely.
+func maskURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "****"
+	}
+	hasUser := u.User != nil
+	u.User = nil
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			name, _, _ := strings.Cut(param, "=")
+			params[i] = name + "=****"
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+	if hasUser {
+		// Set by hand, since url.User would escape the asterisks
+		return strings.Replace(u.String(), "//", "//****@", 1)
+	}
+	return u.String()
+}
+
+// maskList returns a copy of values with every entry masked.
+func maskList(values []string) []string {
+	if len(values) == 0 {
+		return values
+	}
+	masked := make([]string, len(values))
+	for i := range masked {
+		masked[i] = "****"
+	}
+	return masked
+}
+
+// maskHeaders returns a copy of headers with every value masked.
+func maskHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	masked := make(map[string]string, len(headers))
+	for name := range headers {
+		masked[name] = "****"
+	}
+	return masked
+}
+
+// GetEnvMapping returns a map of configuration paths to the named environment
+// variable shortcuts. Every field can also be set with EnvName(path).
 func GetEnvMapping() map[string]string {
 	return map[string]string{
-		"server.port":             "MCP_SERVER_PORT",
-		"server.address":          "MCP_SERVER_ADDRESS",
-		"server.transport":        "MCP_SERVER_TRANSPORT",
-		"upstream.url":            "MCP_UPSTREAM_URL",
-		"agent.id":                "MCP_AGENT_ID",
-		"agent.name":              "MCP_AGENT_NAME",
-		"agent.capabilities":      "MCP_AGENT_CAPABILITIES",
-		"agentfacts.mode":         "MCP_AGENTFACTS_MODE",
-		"agentfacts.allowed_dids": "MCP_AGENTFACTS_ALLOWED_DIDS",
-		"policy.mode":             "MCP_POLICY_MODE",
-		"policy.rules_dir":        "MCP_POLICY_RULES_DIR",
-		"policy.data_file":        "MCP_POLICY_DATA_FILE",
-		"audit.enabled":           "MCP_AUDIT_ENABLED",
-		"audit.db_path":           "MCP_AUDIT_DB_PATH",
-		"metrics.enabled":         "MCP_METRICS_ENABLED",
-		"metrics.port":            "MCP_METRICS_PORT",
-		"health.enabled":          "MCP_HEALTH_ENABLED",
-		"health.port":             "MCP_HEALTH_PORT",
-		"logging.level":           "MCP_LOGGING_LEVEL",
-		"logging.format":          "MCP_LOGGING_FORMAT",
-		"tls.enabled":             "MCP_TLS_ENABLED",
-		"tls.cert_file":           "MCP_TLS_CERT_FILE",
-		"tls.key_file":            "MCP_TLS_KEY_FILE",
+		"server.port":                      "MCP_SERVER_PORT",
+		"server.address":                   "MCP_SERVER_ADDRESS",
+		"server.transport":                 "MCP_SERVER_TRANSPORT",
+		"server.auth.enabled":              "MCP_SERVER_AUTH_ENABLED",
+		"server.auth.secret":               "MCP_SERVER_AUTH_SECRET",
+		"upstream.url":                     "MCP_UPSTREAM_URL",
+		"upstream.transport":               "MCP_UPSTREAM_TRANSPORT",
+		"upstream.command":                 "MCP_UPSTREAM_COMMAND",
+		"agent.id":                         "MCP_AGENT_ID",
+		"agent.name":                       "MCP_AGENT_NAME",
+		"agent.capabilities":               "MCP_AGENT_CAPABILITIES",
+		"agentfacts.mode":                  "MCP_AGENTFACTS_MODE",
+		"agentfacts.allowed_dids":          "MCP_AGENTFACTS_ALLOWED_DIDS",
+		"policy.mode":                      "MCP_POLICY_MODE",
+		"policy.rules_dir":                 "MCP_POLICY_RULES_DIR",
+		"policy.data_file":                 "MCP_POLICY_DATA_FILE",
+		"policy.obligations.alert_webhook": "MCP_POLICY_ALERT_WEBHOOK",
+		"audit.enabled":                    "MCP_AUDIT_ENABLED",
+		"audit.db_path":                    "MCP_AUDIT_DB_PATH",
+		"audit.driver":                     "MCP_AUDIT_DRIVER",
+		"audit.dsn":                        "MCP_AUDIT_DSN",
+		"metrics.enabled":                  "MCP_METRICS_ENABLED",
+		"metrics.port":                     "MCP_METRICS_PORT",
+		"health.enabled":                   "MCP_HEALTH_ENABLED",
+		"health.port":                      "MCP_HEALTH_PORT",
+		"logging.level":                    "MCP_LOGGING_LEVEL",
+		"logging.format":                   "MCP_LOGGING_FORMAT",
+		"tls.enabled":                      "MCP_TLS_ENABLED",
+		"tls.cert_file":                    "MCP_TLS_CERT_FILE",
+		"tls.key_file":                     "MCP_TLS_KEY_FILE",
 	}
 }
-
-// Unused but required for the reflect import
-var _ = reflect.TypeOf(Config{})
@@ -0,0 +1,409 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const yamlConfig = `
+server:
+  listen:
+    port: 9000
+  transport: "http"
+  heartbeat_interval: 0s
+  sse_resume_window: 0s
+  overflow_timeout: 0s
+  methods:
+    deny: ["sampling/createMessage"]
+upstream:
+  url: "http://localhost:8080"
+  timeout: 10s
+  headers:
+    Authorization: "Bearer token"
+  retry:
+    enabled: true
+    max_attempts: 5
+upstreams:
+  - name: "search"
+    url: "http://localhost:8081"
+    match:
+      tool_prefixes: ["search_"]
+policy:
+  mode: "enforce"
+audit:
+  enabled: true
+  retention_days: 0
+`
+
+const jsonConfig = `{
+  "server": {
+    "listen": {"port": 9000},
+    "transport": "http",
+    "heartbeat_interval": "0s",
+    "sse_resume_window": "0s",
+    "overflow_timeout": "0s",
+    "methods": {"deny": ["sampling/createMessage"]}
+  },
+  "upstream": {
+    "url": "http://localhost:8080",
+    "timeout": "10s",
+    "headers": {"Authorization": "Bearer token"},
+    "retry": {"enabled": true, "max_attempts": 5}
+  },
+  "upstreams": [
+    {"name": "search", "url": "http://localhost:8081", "match": {"tool_prefixes": ["search_"]}}
+  ],
+  "policy": {"mode": "enforce"},
+  "audit": {"enabled": true, "retention_days": 0}
+}`
+
+// writeConfig writes content to name in a temporary directory and returns
+// its path.
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+// TestLoadJSON tests that a JSON config loads to the same Config as the
+// equivalent YAML, with defaults, environment overrides and validation
+// applied alike.
+func TestLoadJSON(t *testing.T) {
+	t.Setenv("MCP_UPSTREAM_TRANSPORT", "http")
+
+	want, err := Load(writeConfig(t, "proxy.yaml", yamlConfig))
+	if err != nil {
+		t.Fatalf("Load(yaml) error = %v", err)
+	}
+	got, err := Load(writeConfig(t, "proxy.json", jsonConfig))
+	if err != nil {
+		t.Fatalf("Load(json) error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON config = %+v\nwant YAML config %+v", got, want)
+	}
+
+	// Spot-check that explicit values, defaults and overrides all applied
+	if got.Upstream.Timeout != 10*time.Second {
+		t.Errorf("Upstream.Timeout = %s, want 10s", got.Upstream.Timeout)
+	}
+	if got.Server.HeartbeatInterval != 0 {
+		t.Errorf("Server.HeartbeatInterval = %s, want explicit 0", got.Server.HeartbeatInterval)
+	}
+	if got.Server.SSEResumeWindow != 0 {
+		t.Errorf("Server.SSEResumeWindow = %s, want explicit 0", got.Server.SSEResumeWindow)
+	}
+	if got.Server.OverflowTimeout != 0 {
+		t.Errorf("Server.OverflowTimeout = %s, want explicit 0", got.Server.OverflowTimeout)
+	}
+	if got.Upstreams[0].Timeout != 30*time.Second {
+		t.Errorf("Upstreams[0].Timeout = %s, want default 30s", got.Upstreams[0].Timeout)
+	}
+	if got.Upstream.Transport != "http" {
+		t.Errorf("Upstream.Transport = %q, want override http", got.Upstream.Transport)
+	}
+}
+
+// TestCircuitBreakerDefault tests that the upstream circuit breaker is off
+// unless enabled, in the example config as without one.
+func TestCircuitBreakerDefault(t *testing.T) {
+	for _, path := range []string{"../../config/proxy.yaml", writeConfig(t, "proxy.yaml", "upstream:\n  timeout: 10s\n")} {
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load(%s) error = %v", path, err)
+		}
+		if cfg.Upstream.CircuitBreaker.Enabled {
+			t.Errorf("Load(%s) upstream.circuit_breaker.enabled = true, want false", path)
+		}
+	}
+}
+
+// TestLoadJSONErrors tests that invalid JSON, including YAML-only syntax,
+// and invalid values are rejected.
+func TestLoadJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"syntax error", `{"server": {"listen": {"port": 9000}`, "invalid JSON"},
+		{"yaml in json file", "server:\n  listen:\n    port: 9000\n", "invalid JSON"},
+		{"invalid value", `{"policy": {"mode": "block"}}`, "invalid policy mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, "proxy.json", tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateRelations tests that settings which are invalid together, or
+// point at unusable files, fail the load with a precise error.
+func TestValidateRelations(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.WriteFile(f, []byte("pem"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	auditDB := filepath.Join(dir, "audit.db")
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "valid baseline",
+			content: `
+server:
+  listen:
+    port: 8443
+tls:
+  enabled: true
+  cert_file: "` + certFile + `"
+  key_file: "` + keyFile + `"
+upstream:
+  url: "http://localhost:8080"
+  required: true
+audit:
+  enabled: true
+  db_path: "` + auditDB + `"
+`,
+		},
+		{
+			name:    "stdio without port",
+			content: "server:\n  transport: \"stdio\"\n",
+		},
+		{
+			// The port is ignored, so the shipped config works with stdio
+			name:    "stdio with port",
+			content: "server:\n  transport: \"stdio\"\n  listen:\n    port: 3000\n",
+		},
+		{
+			name:    "tls without key file",
+			content: "tls:\n  enabled: true\n  cert_file: \"" + certFile + "\"\n",
+			wantErr: "tls cert_file and key_file are required",
+		},
+		{
+			name:    "tls with missing cert file",
+			content: "tls:\n  enabled: true\n  cert_file: \"" + filepath.Join(dir, "missing.pem") + "\"\n  key_file: \"" + keyFile + "\"\n",
+			wantErr: "tls cert_file",
+		},
+		{
+			name:    "tls with websocket transport",
+			content: "server:\n  transport: \"websocket\"\ntls:\n  enabled: true\n  cert_file: \"" + certFile + "\"\n  key_file: \"" + keyFile + "\"\n",
+			wantErr: "only the sse server transport supports it",
+		},
+		{
+			name:    "required upstream not configured",
+			content: "upstream:\n  required: true\n",
+			wantErr: "no upstream url or command",
+		},
+		{
+			name:    "negative probe failure threshold",
+			content: "upstream:\n  probe:\n    failure_threshold: -1\n",
+			wantErr: "invalid upstream probe failure_threshold",
+		},
+		{
+			name:    "postgres audit driver not linked",
+			content: "audit:\n  enabled: true\n  driver: \"postgres\"\n  dsn: \"postgres://audit@db/audit\"\n",
+			wantErr: "audit driver postgres is not linked",
+		},
+		{
+			name:    "dry runs without allowed agents",
+			content: "policy:\n  allow_dry_run: true\n",
+			wantErr: "policy allow_dry_run requires dry_run_dids",
+		},
+		{
+			name:    "audit db in missing directory",
+			content: "audit:\n  enabled: true\n  db_path: \"" + filepath.Join(dir, "missing", "audit.db") + "\"\n",
+			wantErr: "audit db_path",
+		},
+		{
+			name:    "audit db is a directory",
+			content: "audit:\n  enabled: true\n  db_path: \"" + dir + "\"\n",
+			wantErr: "is a directory",
+		},
+		{
+			name:    "file logging without path",
+			content: "logging:\n  output: \"file\"\n",
+			wantErr: "logging file path is required",
+		},
+		{
+			name:    "unknown logging output",
+			content: "logging:\n  output: \"syslog\"\n",
+			wantErr: "invalid logging output",
+		},
+		{
+			name:    "file audit sink without path",
+			content: "audit:\n  enabled: false\n  sinks:\n    - type: \"file\"\n",
+			wantErr: "audit sinks[0] path is required",
+		},
+		{
+			name:    "unknown audit sink type",
+			content: "audit:\n  enabled: false\n  sinks:\n    - type: \"stdout\"\n    - type: \"kafka\"\n",
+			wantErr: "invalid audit sinks[1] type",
+		},
+		{
+			name:    "syslog audit sink without address",
+			content: "audit:\n  enabled: false\n  sinks:\n    - type: \"syslog\"\n",
+			wantErr: "audit sinks[0] address is required",
+		},
+		{
+			name:    "syslog audit sink over unknown network",
+			content: "audit:\n  enabled: false\n  sinks:\n    - type: \"syslog\"\n      network: \"unix\"\n      address: \"siem:514\"\n",
+			wantErr: "invalid audit sinks[0] network",
+		},
+		{
+			name:    "syslog audit sink",
+			content: "audit:\n  enabled: false\n  sinks:\n    - type: \"syslog\"\n      address: \"siem:514\"\n",
+		},
+		{
+			name:    "stdout audit sink with stdio transport",
+			content: "server:\n  transport: \"stdio\"\naudit:\n  enabled: false\n  sinks:\n    - type: \"stdout\"\n",
+			wantErr: "audit sinks[0] type stdout cannot be used with the stdio transport",
+		},
+		{
+			name:    "http decision log without url",
+			content: "policy:\n  decision_log:\n    enabled: true\n    type: \"http\"\n",
+			wantErr: "invalid policy decision_log url",
+		},
+		{
+			name:    "file decision log",
+			content: "policy:\n  decision_log:\n    enabled: true\n    type: \"file\"\n    path: \"decisions.jsonl\"\n    sample_rate: 10\n",
+		},
+		{
+			name:    "warm-up agent without id",
+			content: "policy:\n  warm_up:\n    enabled: true\n    agents:\n      - capabilities: [\"read:*\"]\n",
+			wantErr: "policy warm_up agents[0] id is required",
+		},
+		{
+			name:    "unknown policy backend",
+			content: "policy:\n  backend: \"cedar\"\n",
+			wantErr: "invalid policy backend",
+		},
+		{
+			name:    "capability policy backend",
+			content: "policy:\n  backend: \"capability\"\n",
+		},
+		{
+			name:    "capability policy backend with watch_for_changes",
+			content: "policy:\n  backend: \"capability\"\n  watch_for_changes: true\n",
+			wantErr: "policy watch_for_changes is not supported by the capability backend",
+		},
+		{
+			name:    "capability policy backend with explain",
+			content: "policy:\n  backend: \"capability\"\n  evaluation:\n    explain: true\n",
+			wantErr: "policy evaluation explain is not supported by the capability backend",
+		},
+		{
+			name:    "protocol versions with rewrite",
+			content: "server:\n  protocol:\n    versions: [\"2025-03-26\", \"2025-06-18\"]\n    unsupported: \"rewrite\"\n",
+		},
+		{
+			name:    "unknown protocol unsupported action",
+			content: "server:\n  protocol:\n    unsupported: \"clamp\"\n",
+			wantErr: "invalid server protocol unsupported",
+		},
+		{
+			name:    "upstream name with namespace separator",
+			content: "upstreams:\n  - name: \"search.v2\"\n    url: \"http://localhost:8081\"\n    match:\n      tool_prefixes: [\"search_\"]\n",
+			wantErr: "invalid upstream name: search.v2",
+		},
+		{
+			name:    "filter override on non-list method",
+			content: "server:\n  methods:\n    overrides:\n      prompts/get:\n        handler: \"filter\"\n",
+			wantErr: "invalid handler for method prompts/get: filter",
+		},
+		{
+			name:    "override turns off enforcement",
+			content: "server:\n  methods:\n    overrides:\n      tools/call:\n        handler: \"passthrough\"\n",
+			wantErr: "invalid handler for method tools/call: passthrough turns off enforcement",
+		},
+		{
+			name:    "override turns off enforcement explicitly",
+			content: "server:\n  methods:\n    overrides:\n      tools/call:\n        handler: \"passthrough\"\n        allow_unenforced: true\n",
+		},
+		{
+			name:    "audit disabled with missing directory",
+			content: "audit:\n  enabled: false\n  db_path: \"" + filepath.Join(dir, "missing", "audit.db") + "\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, "proxy.yaml", tt.content))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Load() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Checking the audit db path writes nothing
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("%s has %d entries after validation, want only the cert and key files", dir, len(entries))
+	}
+}
+
+// TestWarnings tests that settings with no effect are reported.
+func TestWarnings(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "proxy.yaml", "server:\n  transport: \"stdio\"\n  listen:\n    port: 3000\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	warnings := cfg.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "port 3000 is ignored") {
+		t.Errorf("Warnings() = %v, want the ignored listen port", warnings)
+	}
+
+	cfg, err = Load(writeConfig(t, "proxy.yaml", "server:\n  transport: \"stdio\"\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if warnings := cfg.Warnings(); len(warnings) != 0 {
+		t.Errorf("Warnings() = %v, want none", warnings)
+	}
+
+	cfg, err = Load(writeConfig(t, "proxy.yaml", "policy:\n  watch_for_changes: true\n  bundle:\n    url: \"https://policies.example.com/mcp.tar.gz\"\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	warnings = cfg.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "watch_for_changes is ignored") {
+		t.Errorf("Warnings() = %v, want the ignored watch_for_changes", warnings)
+	}
+
+	cfg, err = Load(writeConfig(t, "proxy.yaml", "server:\n  methods:\n    overrides:\n      resources/read:\n        handler: \"passthrough\"\n        allow_unenforced: true\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	warnings = cfg.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "resources/read is not enforced") {
+		t.Errorf("Warnings() = %v, want the unenforced resources/read", warnings)
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// EnvName returns the environment variable that overrides the config field
+// at the dotted YAML path, e.g. MCP_UPSTREAM_TIMEOUT for upstream.timeout.
+func EnvName(path string) string {
+	return "MCP_" + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// applyPathOverrides sets every scalar or string-list field whose
+// EnvName variable is set. Lists are comma-separated; fields inside lists
+// and maps, such as upstreams entries, can't be overridden.
+func applyPathOverrides(cfg *Config) error {
+	return overrideFields(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// overrideFields applies overrides to the fields of the struct v found at
+// path.
+func overrideFields(v reflect.Value, path string) error {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldPath := path
+		if name, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); name != "" {
+			fieldPath = joinPath(path, name)
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := overrideFields(fv, fieldPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		env := EnvName(fieldPath)
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		if err := setFromString(fv, value); err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+	}
+	return nil
+}
+
+// setFromString parses value into v according to its type.
+func setFromString(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "true", "1", "yes":
+			v.SetBool(true)
+		case "false", "0", "no":
+			v.SetBool(false)
+		default:
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("lists of %s can't be set from the environment", v.Type().Elem())
+		}
+		items := strings.Split(value, ",")
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s fields can't be set from the environment", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPathOverrides tests that nested fields can be overridden with
+// MCP_<PATH> environment variables, after the config file and defaults.
+func TestPathOverrides(t *testing.T) {
+	t.Setenv("MCP_UPSTREAM_TIMEOUT", "45s")
+	t.Setenv("MCP_POLICY_CACHE_TTL", "1m30s")
+	t.Setenv("MCP_UPSTREAM_RETRY_MAX_ATTEMPTS", "7")
+	t.Setenv("MCP_UPSTREAM_CIRCUIT_BREAKER_ENABLED", "false")
+	t.Setenv("MCP_SERVER_METHODS_DENY", "sampling/createMessage, roots/list")
+
+	cfg, err := Load(writeConfig(t, "proxy.yaml", `
+upstream:
+  timeout: 10s
+  circuit_breaker:
+    enabled: true
+policy:
+  cache:
+    ttl: 5m
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Upstream.Timeout != 45*time.Second {
+		t.Errorf("upstream.timeout = %s, want 45s", cfg.Upstream.Timeout)
+	}
+	if cfg.Policy.Cache.TTL != 90*time.Second {
+		t.Errorf("policy.cache.ttl = %s, want 1m30s", cfg.Policy.Cache.TTL)
+	}
+	if cfg.Upstream.Retry.MaxAttempts != 7 {
+		t.Errorf("upstream.retry.max_attempts = %d, want 7", cfg.Upstream.Retry.MaxAttempts)
+	}
+	if cfg.Upstream.CircuitBreaker.Enabled {
+		t.Error("upstream.circuit_breaker.enabled = true, want false")
+	}
+	if want := []string{"sampling/createMessage", "roots/list"}; !reflect.DeepEqual(cfg.Server.Methods.Deny, want) {
+		t.Errorf("server.methods.deny = %v, want %v", cfg.Server.Methods.Deny, want)
+	}
+	// Unset fields keep their defaults
+	if cfg.Upstream.Retry.MaxDelay != 5*time.Second {
+		t.Errorf("upstream.retry.max_delay = %s, want default 5s", cfg.Upstream.Retry.MaxDelay)
+	}
+}
+
+// TestPathOverrideErrors tests that unparsable override values fail the
+// load with the variable named.
+func TestPathOverrideErrors(t *testing.T) {
+	tests := []struct {
+		env   string
+		value string
+	}{
+		{"MCP_UPSTREAM_TIMEOUT", "soon"},
+		{"MCP_UPSTREAM_RETRY_MAX_ATTEMPTS", "many"},
+		{"MCP_METRICS_ENABLED", "maybe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			_, err := Load(writeConfig(t, "proxy.yaml", "{}\n"))
+			if err == nil || !strings.Contains(err.Error(), tt.env) {
+				t.Errorf("Load() error = %v, want naming %s", err, tt.env)
+			}
+		})
+	}
+}
+
+// TestEnvName tests the environment variable names derived from paths.
+func TestEnvName(t *testing.T) {
+	if got := EnvName("upstream.circuit_breaker.threshold"); got != "MCP_UPSTREAM_CIRCUIT_BREAKER_THRESHOLD" {
+		t.Errorf("EnvName() = %s", got)
+	}
+}
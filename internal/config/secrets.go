@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// referencePattern matches secret references in config strings, such as
+// ${env:MCP_UPSTREAM_TOKEN} or ${file:/run/secrets/token}.
+var referencePattern = regexp.MustCompile(`\$\{(\w+):([^}]*)\}`)
+
+// resolveReferences replaces secret references in every string field of cfg
+// with the value they point to.
+func resolveReferences(cfg *Config) error {
+	return resolveValue(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// resolveValue resolves references in v and the values it contains. path is
+// the YAML key path of v, used in errors.
+func resolveValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		resolved, err := resolveString(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(resolved)
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldPath := path
+			if name, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); name != "" {
+				fieldPath = joinPath(path, name)
+			}
+			if err := resolveValue(v.Field(i), fieldPath); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		// Map values aren't addressable, so resolve a copy and store it back
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := resolveValue(elem, joinPath(path, fmt.Sprint(key))); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return resolveValue(v.Elem(), path)
+		}
+	}
+	return nil
+}
+
+// resolveString replaces each reference in s.
+func resolveString(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var resolveErr error
+	resolved := referencePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if resolveErr != nil {
+			return ref
+		}
+		m := referencePattern.FindStringSubmatch(ref)
+		value, err := resolveReference(m[1], m[2])
+		if err != nil {
+			resolveErr = fmt.Errorf("resolving %s: %w", ref, err)
+		}
+		return value
+	})
+	return resolved, resolveErr
+}
+
+// resolveReference returns the value of one reference.
+func resolveReference(kind, target string) (string, error) {
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(target)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", target)
+		}
+		return value, nil
+	case "file":
+		data, err := os.ReadFile(filepath.Clean(target))
+		if err != nil {
+			return "", err
+		}
+		// Secret files usually end with a newline that isn't part of the value
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("unknown reference type %q (must be env or file)", kind)
+	}
+}
+
+// joinPath appends key to a dotted config path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSecretReferences tests that env and file references are resolved in
+// nested fields, lists and maps before validation.
+func TestSecretReferences(t *testing.T) {
+	t.Setenv("TEST_UPSTREAM_TOKEN", "s3cret")
+	secretFile := filepath.Join(t.TempDir(), "dsn")
+	if err := os.WriteFile(secretFile, []byte("postgres://audit@db/audit\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	cfg, err := Load(writeConfig(t, "proxy.yaml", `
+upstream:
+  url: "http://localhost:8080"
+  headers:
+    Authorization: "Bearer ${env:TEST_UPSTREAM_TOKEN}"
+upstreams:
+  - name: "search"
+    url: "http://localhost:8081"
+    headers:
+      X-API-Key: "${env:TEST_UPSTREAM_TOKEN}"
+    match:
+      tool_prefixes: ["search_"]
+audit:
+  driver: "postgres"
+  dsn: "${file:`+secretFile+`}"
+server:
+  auth:
+    enabled: true
+    tokens: ["${env:TEST_UPSTREAM_TOKEN}"]
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := cfg.Upstream.Headers["Authorization"]; got != "Bearer s3cret" {
+		t.Errorf("upstream.headers.Authorization = %q, want %q", got, "Bearer s3cret")
+	}
+	if got := cfg.Upstreams[0].Headers["X-API-Key"]; got != "s3cret" {
+		t.Errorf("upstreams[0].headers.X-API-Key = %q, want %q", got, "s3cret")
+	}
+	if got := cfg.Audit.DSN; got != "postgres://audit@db/audit" {
+		t.Errorf("audit.dsn = %q, want file contents without trailing newline", got)
+	}
+	if got := cfg.Server.Auth.Tokens[0]; got != "s3cret" {
+		t.Errorf("server.auth.tokens[0] = %q, want %q", got, "s3cret")
+	}
+}
+
+// TestSecretReferenceErrors tests that references that can't be resolved
+// fail the load with the offending field named.
+func TestSecretReferenceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"missing env", "${env:TEST_UNSET_SECRET}", "environment variable TEST_UNSET_SECRET is not set"},
+		{"missing file", "${file:/nonexistent/secret}", "no such file"},
+		{"unknown type", "${vault:secret/token}", `unknown reference type "vault"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, "proxy.yaml", "upstream:\n  headers:\n    Authorization: \""+tt.value+"\"\n"))
+			if err == nil {
+				t.Fatal("Load() error = nil, want resolution error")
+			}
+			for _, want := range []string{"upstream.headers.Authorization", tt.wantErr} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %v, want containing %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -2,31 +2,115 @@ package config
 
 import "time"
 
+// DefaultMaxRequestBytes is the largest client message accepted when
+// server.max_request_bytes is unset, on every transport.
+const DefaultMaxRequestBytes = 10 * 1024 * 1024 // 10MB
+
 // Config is the root configuration structure for the MCP MCP Proxy.
 type Config struct {
-	Version    string           `yaml:"version"`
-	Server     ServerConfig     `yaml:"server"`
-	Upstream   UpstreamConfig   `yaml:"upstream"`
-	Agent      AgentConfig      `yaml:"agent"`
-	AgentFacts AgentFactsConfig `yaml:"agentfacts"`
-	Policy     PolicyConfig     `yaml:"policy"`
-	Audit      AuditConfig      `yaml:"audit"`
-	Metrics    MetricsConfig    `yaml:"metrics"`
-	Health     HealthConfig     `yaml:"health"`
-	Logging    LoggingConfig    `yaml:"logging"`
-	TLS        TLSConfig        `yaml:"tls"`
+	Version       string              `yaml:"version"`
+	Server        ServerConfig        `yaml:"server"`
+	Upstream      UpstreamConfig      `yaml:"upstream"`
+	Upstreams     []NamedUpstream     `yaml:"upstreams"` // Upstreams picked by match rules; upstream is the fallback
+	Shadow        ShadowConfig        `yaml:"shadow"`
+	ResponseCache ResponseCacheConfig `yaml:"response_cache"`
+	Agent         AgentConfig         `yaml:"agent"`
+	AgentFacts    AgentFactsConfig    `yaml:"agentfacts"`
+	Policy        PolicyConfig        `yaml:"policy"`
+	Audit         AuditConfig         `yaml:"audit"`
+	Metrics       MetricsConfig       `yaml:"metrics"`
+	Health        HealthConfig        `yaml:"health"`
+	Admin         AdminConfig         `yaml:"admin"`
+	Logging       LoggingConfig       `yaml:"logging"`
+	TLS           TLSConfig           `yaml:"tls"`
 }
 
 // ServerConfig defines the proxy server settings.
 type ServerConfig struct {
-	Listen           ListenConfig   `yaml:"listen"`
-	Transport        string         `yaml:"transport"` // sse, stdio, http
-	ReadTimeout      time.Duration  `yaml:"read_timeout"`
-	WriteTimeout     time.Duration  `yaml:"write_timeout"`
-	IdleTimeout      time.Duration  `yaml:"idle_timeout"`
-	GracefulShutdown time.Duration  `yaml:"graceful_shutdown"`
-	MaxConnections   int            `yaml:"max_connections"`
-	Security         SecurityConfig `yaml:"security"`
+	Listen            ListenConfig    `yaml:"listen"`
+	Transport         string          `yaml:"transport"` // sse, stdio, http, websocket
+	ReadTimeout       time.Duration   `yaml:"read_timeout"`
+	WriteTimeout      time.Duration   `yaml:"write_timeout"`
+	IdleTimeout       time.Duration   `yaml:"idle_timeout"`
+	GracefulShutdown  time.Duration   `yaml:"graceful_shutdown"`
+	ShutdownTimeouts  ShutdownConfig  `yaml:"shutdown_timeouts"`
+	MaxConnections    int             `yaml:"max_connections"`
+	SessionEviction   string          `yaml:"session_eviction"`   // reject, lru: what happens when max_connections is reached
+	MaxRequestBytes   int64           `yaml:"max_request_bytes"`  // Maximum size of a single client message
+	MaxResponseBytes  int64           `yaml:"max_response_bytes"` // Largest upstream response forwarded to enforced and filtered requests; 0 disables
+	HeartbeatInterval time.Duration   `yaml:"heartbeat_interval"` // Keep-alive ping interval; 0 disables
+	SSEReplayBuffer   int             `yaml:"sse_replay_buffer"`  // Messages kept per session for Last-Event-ID resumption
+	SSEResumeWindow   time.Duration   `yaml:"sse_resume_window"`  // How long a dropped SSE session can be resumed; 0 disables resumption
+	SSECompression    bool            `yaml:"sse_compression"`    // Gzip event streams for clients sending Accept-Encoding: gzip
+	SessionSnapshot   string          `yaml:"session_snapshot"`   // File sessions are saved to on shutdown and restored from on startup; empty disables
+	MessageBuffer     int             `yaml:"message_buffer"`     // Messages queued per session toward the client
+	MessageOverflow   string          `yaml:"message_overflow"`   // block, close: what happens when the message buffer stays full
+	OverflowTimeout   time.Duration   `yaml:"overflow_timeout"`   // How long to wait for room in a full message buffer; 0 does not wait
+	Security          SecurityConfig  `yaml:"security"`
+	Auth              AuthConfig      `yaml:"auth"`
+	RateLimit         RateLimitConfig `yaml:"rate_limit"`
+	MaxConcurrent     int             `yaml:"max_concurrent_requests"` // Requests a session may have in flight at once; 0 disables
+	Methods           MethodsConfig   `yaml:"methods"`
+	Stdio             StdioConfig     `yaml:"stdio"`
+
+	// MaxSessionLifetime closes sessions this long after they were created,
+	// however active, so clients reconnect and re-authenticate. SSE clients
+	// get a shutdown event first. 0 disables it.
+	MaxSessionLifetime time.Duration `yaml:"max_session_lifetime"`
+
+	// SessionIdleTimeout closes sessions with no activity for this long,
+	// independent of their TTL. 0 uses half the session TTL. Unlike
+	// IdleTimeout it applies to sessions, not HTTP connections.
+	SessionIdleTimeout time.Duration `yaml:"session_idle_timeout"`
+
+	// Protocol restricts the MCP protocol versions clients may initialize
+	// with
+	Protocol ProtocolConfig `yaml:"protocol"`
+}
+
+// ProtocolConfig defines which MCP protocol versions initialize requests
+// may declare.
+type ProtocolConfig struct {
+	Versions    []string `yaml:"versions"`    // Supported versions, e.g. 2025-06-18; empty accepts any
+	Unsupported string   `yaml:"unsupported"` // reject, rewrite: what happens to other versions
+}
+
+// StdioConfig defines settings for the stdio transport.
+type StdioConfig struct {
+	Framing string `yaml:"framing"` // ndjson, content-length: how messages are delimited
+}
+
+// MethodsConfig restricts which JSON-RPC methods are forwarded upstream.
+// Rejected methods get a method-not-found error.
+type MethodsConfig struct {
+	Allow       []string `yaml:"allow"`        // Only these methods pass; empty allows all
+	Deny        []string `yaml:"deny"`         // These methods are rejected
+	DenyUnknown bool     `yaml:"deny_unknown"` // Reject methods the proxy does not know instead of passing them through
+
+	// Overrides replace the built-in handling of methods, by method name
+	Overrides map[string]MethodOverride `yaml:"overrides"`
+
+	// Timeouts bound how long a request waits for the upstream, by handler
+	Timeouts HandlerTimeouts `yaml:"timeouts"`
+}
+
+// HandlerTimeouts limits the upstream send of requests per handler type,
+// independent of the upstream client's own timeout. Zero means no limit.
+type HandlerTimeouts struct {
+	Passthrough time.Duration `yaml:"passthrough"`
+	Enforce     time.Duration `yaml:"enforce"`
+	Filter      time.Duration `yaml:"filter"`
+}
+
+// MethodOverride changes how the proxy handles one method. Empty fields keep
+// the built-in value.
+type MethodOverride struct {
+	Handler  string `yaml:"handler"`   // passthrough, enforce, filter
+	LogLevel string `yaml:"log_level"` // none, metadata, full
+	// AllowUnenforced permits moving an enforced method (tools/call,
+	// resources/read, resources/subscribe) to another handler, which turns
+	// off its policy checks.
+	AllowUnenforced bool `yaml:"allow_unenforced"`
 }
 
 // SecurityConfig defines security-related settings.
@@ -37,6 +121,31 @@ type SecurityConfig struct {
 	EnableSecurityHeaders bool `yaml:"enable_security_headers"`
 }
 
+// AuthConfig defines bearer-token authentication for client connections.
+type AuthConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Tokens  []string `yaml:"tokens"` // Static per-client tokens
+	Secret  string   `yaml:"secret"` // Shared secret accepted from any client
+}
+
+// RateLimitConfig defines the per-session request rate limit applied before
+// policy enforcement.
+type RateLimitConfig struct {
+	Requests int           `yaml:"requests"` // Requests allowed per window; 0 disables
+	Window   time.Duration `yaml:"window"`
+	PerDID   bool          `yaml:"per_did"` // Share one limit across sessions of the same verified DID
+}
+
+// ShutdownConfig bounds how long each component may take to stop.
+// Every component gets its own timeout, so a slow transport can't use up
+// the time audit records need to be flushed.
+type ShutdownConfig struct {
+	Transport time.Duration `yaml:"transport"` // Draining client connections; defaults to graceful_shutdown
+	Upstream  time.Duration `yaml:"upstream"`  // Disconnecting upstream and shadow clients
+	Sessions  time.Duration `yaml:"sessions"`  // Closing the remaining sessions
+	Audit     time.Duration `yaml:"audit"`     // Flushing buffered records and closing the audit store
+}
+
 // ListenConfig defines the server listen address.
 type ListenConfig struct {
 	Address string `yaml:"address"`
@@ -46,11 +155,54 @@ type ListenConfig struct {
 // UpstreamConfig defines the upstream MCP server connection settings.
 type UpstreamConfig struct {
 	URL            string               `yaml:"url"`
-	Transport      string               `yaml:"transport"`
+	Transport      string               `yaml:"transport"` // sse, http, stdio
+	Command        string               `yaml:"command"`   // Executable for stdio transport
+	Args           []string             `yaml:"args"`
 	Timeout        time.Duration        `yaml:"timeout"`
+	Headers        map[string]string    `yaml:"headers"` // Sent on every request, e.g. Authorization
 	ConnectionPool ConnectionPoolConfig `yaml:"connection_pool"`
 	Retry          RetryConfig          `yaml:"retry"`
 	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	Probe          ProbeConfig          `yaml:"probe"`
+	Required       bool                 `yaml:"required"` // Not ready until the upstream is connected
+	ResponseBuffer ResponseBufferConfig `yaml:"response_buffer"`
+}
+
+// NamedUpstream is an additional upstream that receives the requests
+// matching its rules.
+type NamedUpstream struct {
+	Name           string        `yaml:"name"`
+	Match          UpstreamMatch `yaml:"match"`
+	UpstreamConfig `yaml:",inline"`
+}
+
+// ShadowConfig defines a secondary upstream that receives a copy of
+// matching requests. Its responses are compared with the primary's and
+// discarded; clients only ever see the primary's response.
+type ShadowConfig struct {
+	Enabled  bool           `yaml:"enabled"`
+	Methods  []string       `yaml:"methods"` // Method globs mirrored to the shadow; keep to methods without side effects
+	Timeout  time.Duration  `yaml:"timeout"` // Longest a shadow request may take, independent of the primary
+	Upstream UpstreamConfig `yaml:"upstream"`
+}
+
+// ResponseCacheConfig defines caching of upstream results for idempotent
+// read methods. Entries are keyed by method, params and agent capabilities,
+// and by session with per-session upstream connections. They are cleared
+// whenever policies or policy data change, and when the upstream notifies
+// that its lists or resources changed.
+type ResponseCacheConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Methods    []string      `yaml:"methods"` // Methods whose results are cached, e.g. tools/list
+	TTL        time.Duration `yaml:"ttl"`
+	MaxEntries int           `yaml:"max_entries"`
+}
+
+// UpstreamMatch selects the requests sent to a named upstream. A request
+// matches if either its method or its tool name matches.
+type UpstreamMatch struct {
+	Methods      []string `yaml:"methods"`       // Method globs, e.g. "resources/*"
+	ToolPrefixes []string `yaml:"tool_prefixes"` // Prefixes of tools/call tool names
 }
 
 // ConnectionPoolConfig defines connection pool settings.
@@ -58,6 +210,7 @@ type ConnectionPoolConfig struct {
 	MaxIdle     int           `yaml:"max_idle"`
 	MaxOpen     int           `yaml:"max_open"`
 	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	PerSession  bool          `yaml:"per_session"` // Open an upstream connection per client session, up to MaxOpen
 }
 
 // RetryConfig defines retry behavior for upstream connections.
@@ -69,6 +222,15 @@ type RetryConfig struct {
 	Backoff      string        `yaml:"backoff"` // exponential, linear, constant
 }
 
+// ProbeConfig defines the periodic ping that checks the upstream responds.
+// After FailureThreshold consecutive failures the connection is reset.
+type ProbeConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Interval         time.Duration `yaml:"interval"`
+	Timeout          time.Duration `yaml:"timeout"` // How long to wait for each ping response
+	FailureThreshold int           `yaml:"failure_threshold"`
+}
+
 // CircuitBreakerConfig defines circuit breaker settings.
 type CircuitBreakerConfig struct {
 	Enabled   bool          `yaml:"enabled"`
@@ -76,6 +238,13 @@ type CircuitBreakerConfig struct {
 	Timeout   time.Duration `yaml:"timeout"`
 }
 
+// ResponseBufferConfig sizes the buffer each pending request receives its
+// upstream response on. A response that finds the buffer full is dropped,
+// since waiting would hold up the responses to every other request.
+type ResponseBufferConfig struct {
+	PerRequest int `yaml:"per_request"` // Responses buffered per pending request
+}
+
 // AgentConfig defines the default agent identity (used when AgentFacts not provided).
 type AgentConfig struct {
 	ID           string   `yaml:"id"`
@@ -104,15 +273,68 @@ type PolicyConfig struct {
 	JSONPolicyDir   string           `yaml:"json_policy_dir"` // Directory for JSON policy definitions
 	DataFile        string           `yaml:"data_file"`
 	WatchForChanges bool             `yaml:"watch_for_changes"`
-	Environment     string           `yaml:"environment"` // development, staging, production
+	Environment     string           `yaml:"environment"`   // development, staging, production
+	AllowDryRun     bool             `yaml:"allow_dry_run"` // Let clients request audit mode for a single request
+	DryRunDIDs      []string         `yaml:"dry_run_dids"`  // Verified agents allowed to request dry runs
 	Cache           CacheConfig      `yaml:"cache"`
 	Evaluation      EvaluationConfig `yaml:"evaluation"`
+	Obligations     ObligationConfig `yaml:"obligations"`
+	Bundle          BundleConfig     `yaml:"bundle"`
+
+	// DecisionLog records the full input and decision of sampled policy
+	// evaluations, for debugging and replaying policies.
+	DecisionLog DecisionLogConfig `yaml:"decision_log"`
+
+	// WarmUp pre-fills the decision cache at startup so the first requests
+	// after a deploy don't all miss it.
+	WarmUp WarmUpConfig `yaml:"warm_up"`
+
+	// Backend selects what evaluates requests: opa runs the Rego policies,
+	// capability matches tool_capabilities in Go with no Rego to compile.
+	Backend string `yaml:"backend"`
+}
+
+// WarmUpConfig defines the agents and tools whose decisions are cached at
+// startup. Each agent is paired with each tool in a tools/call request.
+type WarmUpConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Agents  []AgentConfig `yaml:"agents"` // Agent identities to warm in addition to the default agent
+	Tools   []string      `yaml:"tools"`  // Tools to warm; empty uses every tool in tool_capabilities
+}
+
+// DecisionLogConfig defines where policy decisions are logged. Entries are
+// written one JSON object per line; http sinks post them in batches.
+type DecisionLogConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Type       string        `yaml:"type"`        // file, http
+	Path       string        `yaml:"path"`        // File to append to; required for file
+	URL        string        `yaml:"url"`         // Endpoint to post to; required for http
+	Timeout    time.Duration `yaml:"timeout"`     // Timeout for each http post
+	SampleRate int           `yaml:"sample_rate"` // Log 1 in N allowed decisions; denials are always logged
+	BufferSize int           `yaml:"buffer_size"` // Entries queued before dropping
+}
+
+// BundleConfig defines fetching policies and data as an OPA bundle from a
+// remote URL.
+type BundleConfig struct {
+	URL             string        `yaml:"url"`              // Bundle tarball URL; empty disables
+	PollInterval    time.Duration `yaml:"poll_interval"`    // How often to check for a new bundle
+	VerificationKey string        `yaml:"verification_key"` // PEM public key or file, or HMAC secret; empty skips signature checks
+	KeyID           string        `yaml:"key_id"`
+	SigningAlg      string        `yaml:"signing_alg"`
 }
 
 // EvaluationConfig defines policy evaluation settings.
 type EvaluationConfig struct {
 	Timeout             time.Duration `yaml:"timeout"`
 	StrictBuiltinErrors bool          `yaml:"strict_builtin_errors"`
+	Explain             bool          `yaml:"explain"` // Trace every evaluation and log the rules that fired
+}
+
+// ObligationConfig defines how policy obligations are executed.
+type ObligationConfig struct {
+	AlertWebhook   string        `yaml:"alert_webhook"`   // URL that "alert" obligations are posted to
+	WebhookTimeout time.Duration `yaml:"webhook_timeout"` // Timeout for webhook deliveries
 }
 
 // CacheConfig defines caching settings.
@@ -120,22 +342,42 @@ type CacheConfig struct {
 	Enabled    bool          `yaml:"enabled"`
 	TTL        time.Duration `yaml:"ttl"`
 	MaxEntries int           `yaml:"max_entries"`
+	L1Size     int           `yaml:"l1_size"` // Hot-tier entries; 0 = default, negative disables
 }
 
 // AuditConfig defines audit logging settings.
 type AuditConfig struct {
 	Enabled       bool          `yaml:"enabled"`
+	Driver        string        `yaml:"driver"`         // sqlite, postgres
 	DBPath        string        `yaml:"db_path"`        // SQLite database path
+	DSN           string        `yaml:"dsn"`            // PostgreSQL connection string
 	BufferSize    int           `yaml:"buffer_size"`    // Max records to buffer
 	FlushInterval time.Duration `yaml:"flush_interval"` // How often to flush
 	RetentionDays int           `yaml:"retention_days"` // Days to keep records (0 = forever)
+	SampleRate    int           `yaml:"sample_rate"`    // Record 1 in N allowed requests; denials are always recorded
 	Capture       CaptureConfig `yaml:"capture"`
+
+	// Sinks receive every audit record in addition to the store, e.g. to
+	// ship audit events to a SIEM.
+	Sinks []AuditSinkConfig `yaml:"sinks"`
+}
+
+// AuditSinkConfig defines an additional destination for audit records.
+// stdout and file sinks write one JSON object per line; syslog sinks send
+// CEF events.
+type AuditSinkConfig struct {
+	Type       string `yaml:"type"`        // stdout, file, syslog
+	Path       string `yaml:"path"`        // File to append to; required for file
+	Network    string `yaml:"network"`     // Syslog transport: udp or tcp
+	Address    string `yaml:"address"`     // Syslog server host:port; required for syslog
+	BufferSize int    `yaml:"buffer_size"` // Records queued before dropping
 }
 
 // CaptureConfig defines what to capture in audit logs.
 type CaptureConfig struct {
 	RequestArguments bool `yaml:"request_arguments"`
 	ResponseSummary  bool `yaml:"response_summary"`
+	MaxArgumentBytes int  `yaml:"max_argument_bytes"` // Truncate captured arguments JSON beyond this size; 0 = no limit
 }
 
 // MetricsConfig defines Prometheus metrics settings.
@@ -144,6 +386,10 @@ type MetricsConfig struct {
 	Address string `yaml:"address"`
 	Port    int    `yaml:"port"`
 	Path    string `yaml:"path"`
+
+	// PprofEnabled serves net/http/pprof under /debug/pprof/ on the metrics
+	// port. Keep the metrics port internal when enabling it.
+	PprofEnabled bool `yaml:"pprof_enabled"`
 }
 
 // HealthConfig defines health check endpoint settings.
@@ -155,6 +401,14 @@ type HealthConfig struct {
 	ReadinessPath string `yaml:"readiness_path"`
 }
 
+// AdminConfig defines the admin API used for incident response.
+type AdminConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Address string   `yaml:"address"`
+	Port    int      `yaml:"port"`
+	Tokens  []string `yaml:"tokens"` // Bearer tokens accepted by the admin API
+}
+
 // LoggingConfig defines logging settings.
 type LoggingConfig struct {
 	Level  string     `yaml:"level"`  // debug, info, warn, error
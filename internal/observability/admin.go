@@ -0,0 +1,146 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
+	"github.com/rs/zerolog/log"
+)
+
+// SessionInfo is the admin view of an active session.
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	AgentID      string    `json:"agent_id"`
+	AgentName    string    `json:"agent_name,omitempty"`
+	DID          string    `json:"did,omitempty"`
+	SourceIP     string    `json:"source_ip,omitempty"`
+	RequestCount int       `json:"request_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	AgeSeconds   float64   `json:"age_seconds"`
+	IdleSeconds  float64   `json:"idle_seconds"`
+}
+
+// Admin serves the admin API. Every request must carry one of the admin
+// bearer tokens.
+//
+//	GET    /admin/sessions       lists active sessions
+//	DELETE /admin/sessions/{id}  closes a session and frees its slot
+//	POST   /admin/policy/reload  re-reads the policy data file
+type Admin struct {
+	sessions     *session.Manager
+	auth         *transport.Authenticator
+	reloadPolicy PolicyDataReloader
+}
+
+// PolicyDataReloader re-reads the policy data and applies it, returning the
+// number of top-level keys loaded.
+type PolicyDataReloader func(ctx context.Context) (int, error)
+
+// NewAdmin creates the admin API for the given session manager.
+func NewAdmin(sessions *session.Manager, tokens []string) *Admin {
+	return &Admin{
+		sessions: sessions,
+		auth:     transport.NewAuthenticator(config.AuthConfig{Enabled: true, Tokens: tokens}),
+	}
+}
+
+// SetPolicyDataReloader sets the callback behind POST
+// /admin/policy/reload. Without one, the endpoint responds 404.
+func (a *Admin) SetPolicyDataReloader(fn PolicyDataReloader) {
+	a.reloadPolicy = fn
+}
+
+// Handler returns the admin API HTTP handler.
+func (a *Admin) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/sessions", a.listSessions)
+	mux.HandleFunc("DELETE /admin/sessions/{id}", a.deleteSession)
+	mux.HandleFunc("POST /admin/policy/reload", a.reloadPolicyData)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.auth.Authenticate(r); !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-proxy-admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// listSessions writes the active sessions as JSON.
+func (a *Admin) listSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := a.sessions.List()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		_, did := sess.GetIdentity()
+		infos = append(infos, SessionInfo{
+			ID:           sess.ID,
+			AgentID:      sess.AgentID,
+			AgentName:    sess.AgentName,
+			DID:          did,
+			SourceIP:     sess.SourceIP,
+			RequestCount: sess.GetRequestCount(),
+			CreatedAt:    sess.CreatedAt,
+			AgeSeconds:   sess.Age().Seconds(),
+			IdleSeconds:  sess.IdleTime().Seconds(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"count":    len(infos),
+		"sessions": infos,
+	})
+}
+
+// deleteSession closes a session, disconnecting its client.
+func (a *Admin) deleteSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := a.sessions.Get(id); !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	a.sessions.Delete(id)
+
+	log.Warn().
+		Str("session_id", id).
+		Str("remote_addr", r.RemoteAddr).
+		Msg("Session terminated by admin")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reloadPolicyData re-reads the policy data so that updated blocklists take
+// effect without a restart. On failure the previous data stays active.
+func (a *Admin) reloadPolicyData(w http.ResponseWriter, r *http.Request) {
+	if a.reloadPolicy == nil {
+		http.Error(w, "policy engine not enabled", http.StatusNotFound)
+		return
+	}
+
+	keys, err := a.reloadPolicy(r.Context())
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("Admin policy data reload failed")
+		http.Error(w, "policy data reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Warn().
+		Int("keys", keys).
+		Str("remote_addr", r.RemoteAddr).
+		Msg("Policy data reloaded by admin")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": keys,
+	})
+}
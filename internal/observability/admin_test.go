@@ -0,0 +1,157 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/agentfacts/mcp-proxy/internal/session"
+)
+
+const adminTestToken = "admin-secret"
+
+// adminRequest sends an admin API request with the given bearer token.
+func adminRequest(t *testing.T, method, url, token string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, url, err)
+	}
+	return resp
+}
+
+// TestAdminSessions tests listing and terminating sessions through the
+// admin API.
+func TestAdminSessions(t *testing.T) {
+	mgr := session.NewManager(session.ManagerConfig{MaxSessions: 2})
+	ctx := context.Background()
+
+	sess1, err := mgr.Create(ctx)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	sess1.AgentID = "agent1"
+	sess1.IncrementRequestCount()
+	if _, err := mgr.Create(ctx); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	ts := httptest.NewServer(NewAdmin(mgr, []string{adminTestToken}).Handler())
+	defer ts.Close()
+
+	// Requests without a valid token are rejected
+	for _, token := range []string{"", "wrong"} {
+		resp := adminRequest(t, http.MethodGet, ts.URL+"/admin/sessions", token)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET with token %q status = %d, want %d", token, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	resp := adminRequest(t, http.MethodGet, ts.URL+"/admin/sessions", adminTestToken)
+	var list struct {
+		Count    int           `json:"count"`
+		Sessions []SessionInfo `json:"sessions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode sessions: %v", err)
+	}
+	resp.Body.Close()
+
+	if list.Count != 2 || len(list.Sessions) != 2 {
+		t.Fatalf("listed %d sessions (count %d), want 2", len(list.Sessions), list.Count)
+	}
+	var found bool
+	for _, info := range list.Sessions {
+		if info.ID == sess1.ID {
+			found = true
+			if info.AgentID != "agent1" || info.RequestCount != 1 {
+				t.Errorf("session info = %+v, want agent1 with 1 request", info)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("session %s not listed", sess1.ID)
+	}
+
+	// Deleting closes the session and frees its slot
+	resp = adminRequest(t, http.MethodDelete, ts.URL+"/admin/sessions/"+sess1.ID, adminTestToken)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if !sess1.IsClosed() {
+		t.Error("Deleted session should be closed")
+	}
+	if got := mgr.ActiveCount(); got != 1 {
+		t.Errorf("ActiveCount() = %d, want 1", got)
+	}
+	if _, err := mgr.Create(ctx); err != nil {
+		t.Errorf("Create() after delete error = %v, want freed slot", err)
+	}
+
+	// Unknown sessions are reported
+	resp = adminRequest(t, http.MethodDelete, ts.URL+"/admin/sessions/"+sess1.ID, adminTestToken)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("DELETE unknown status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+// TestAdminPolicyReload tests reloading policy data through the admin API.
+func TestAdminPolicyReload(t *testing.T) {
+	admin := NewAdmin(session.NewManager(session.ManagerConfig{}), []string{adminTestToken})
+	ts := httptest.NewServer(admin.Handler())
+	defer ts.Close()
+	url := ts.URL + "/admin/policy/reload"
+
+	// Without a policy engine there is nothing to reload
+	resp := adminRequest(t, http.MethodPost, url, adminTestToken)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST without reloader status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	var reloads int
+	var reloadErr error
+	admin.SetPolicyDataReloader(func(ctx context.Context) (int, error) {
+		reloads++
+		return 4, reloadErr
+	})
+
+	resp = adminRequest(t, http.MethodPost, url, "wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || reloads != 0 {
+		t.Errorf("POST with wrong token status = %d after %d reloads, want %d and none", resp.StatusCode, reloads, http.StatusUnauthorized)
+	}
+
+	resp = adminRequest(t, http.MethodPost, url, adminTestToken)
+	var body struct {
+		Keys int `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || body.Keys != 4 || reloads != 1 {
+		t.Errorf("POST status = %d, keys = %d after %d reloads, want %d, 4 and 1", resp.StatusCode, body.Keys, reloads, http.StatusOK)
+	}
+
+	reloadErr = errors.New("failed to parse policy data")
+	resp = adminRequest(t, http.MethodPost, url, adminTestToken)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("POST with failing reload status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+}
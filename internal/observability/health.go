@@ -3,9 +3,12 @@ package observability
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/upstream"
 )
 
 // HealthStatus represents the overall health status.
@@ -24,11 +27,18 @@ type ComponentHealth struct {
 	Latency string       `json:"latency,omitempty"`
 }
 
+// Upstream modes reported in health responses and metrics.
+const (
+	ModeProxying   = "proxying"   // Requests are forwarded upstream
+	ModeStandalone = "standalone" // No upstream is connected; requests are echoed back
+)
+
 // HealthResponse is returned by health check endpoints.
 type HealthResponse struct {
 	Status     HealthStatus               `json:"status"`
 	Timestamp  time.Time                  `json:"timestamp"`
 	Version    string                     `json:"version,omitempty"`
+	Mode       string                     `json:"mode,omitempty"`
 	Components map[string]ComponentHealth `json:"components,omitempty"`
 }
 
@@ -39,6 +49,7 @@ type HealthChecker func(ctx context.Context) ComponentHealth
 type Health struct {
 	version  string
 	checkers map[string]HealthChecker
+	mode     func() string
 	mu       sync.RWMutex
 
 	// Ready state can be toggled during startup/shutdown
@@ -62,6 +73,14 @@ func (h *Health) RegisterChecker(name string, checker HealthChecker) {
 	h.checkers[name] = checker
 }
 
+// SetModeFunc sets the function reporting the upstream mode in component
+// health responses.
+func (h *Health) SetModeFunc(fn func() string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mode = fn
+}
+
 // SetReady sets the readiness state.
 func (h *Health) SetReady(ready bool) {
 	h.readyMu.Lock()
@@ -148,6 +167,7 @@ func (h *Health) checkAll(ctx context.Context) HealthResponse {
 	for name, checker := range h.checkers {
 		checkers[name] = checker
 	}
+	mode := h.mode
 	h.mu.RUnlock()
 
 	response := HealthResponse{
@@ -156,6 +176,9 @@ func (h *Health) checkAll(ctx context.Context) HealthResponse {
 		Version:    h.version,
 		Components: make(map[string]ComponentHealth),
 	}
+	if mode != nil {
+		response.Mode = mode()
+	}
 
 	// Run checks concurrently
 	var wg sync.WaitGroup
@@ -213,10 +236,78 @@ func DatabaseChecker(pingFunc func(ctx context.Context) error) HealthChecker {
 	}
 }
 
-// UpstreamChecker creates a health checker for upstream connectivity.
-func UpstreamChecker(isConnected func() bool) HealthChecker {
+// auditBufferNearFull is the buffer fill ratio above which the audit writer
+// is considered to be falling behind once it has gone auditWriteStall
+// without writing.
+const (
+	auditBufferNearFull = 0.9
+	auditWriteStall     = 30 * time.Second
+)
+
+// AuditWriterChecker creates a health checker for the audit writer and its
+// store. It reports unhealthy if the store is unreachable, and degraded if
+// records were dropped after the last successful write, or the buffer is
+// near capacity and nothing was written for auditWriteStall. It keeps no
+// state, so liveness and readiness checks see the same result.
+func AuditWriterChecker(fillRatio func() float64, lastWrite, lastDrop func() time.Time, pingFunc func(ctx context.Context) error) HealthChecker {
+	return func(ctx context.Context) ComponentHealth {
+		if err := pingFunc(ctx); err != nil {
+			return ComponentHealth{
+				Status:  HealthStatusUnhealthy,
+				Message: "database unreachable: " + err.Error(),
+			}
+		}
+
+		ratio := fillRatio()
+		written, dropped := lastWrite(), lastDrop()
+
+		switch {
+		case dropped.After(written):
+			return ComponentHealth{
+				Status:  HealthStatusDegraded,
+				Message: "audit records dropped since the last write",
+			}
+		case ratio >= auditBufferNearFull && time.Since(written) >= auditWriteStall:
+			return ComponentHealth{
+				Status:  HealthStatusDegraded,
+				Message: fmt.Sprintf("audit buffer %.0f%% full, last write %s ago", ratio*100, time.Since(written).Round(time.Second)),
+			}
+		}
+		return ComponentHealth{
+			Status:  HealthStatusHealthy,
+			Message: "connected",
+		}
+	}
+}
+
+// UpstreamChecker creates a health checker for upstream connectivity. When
+// required is set, a disconnected upstream is unhealthy, so readiness fails
+// until it connects; otherwise the proxy is degraded but still ready. If
+// circuitState is set, an open circuit breaker is unhealthy and a half-open
+// one degraded.
+func UpstreamChecker(isConnected func() bool, circuitState func() upstream.CircuitState, required bool) HealthChecker {
 	return func(ctx context.Context) ComponentHealth {
+		if circuitState != nil {
+			switch circuitState() {
+			case upstream.CircuitOpen:
+				return ComponentHealth{
+					Status:  HealthStatusUnhealthy,
+					Message: "upstream circuit open",
+				}
+			case upstream.CircuitHalfOpen:
+				return ComponentHealth{
+					Status:  HealthStatusDegraded,
+					Message: "upstream circuit half-open - retrying upstream",
+				}
+			}
+		}
 		if !isConnected() {
+			if required {
+				return ComponentHealth{
+					Status:  HealthStatusUnhealthy,
+					Message: "required upstream disconnected",
+				}
+			}
 			return ComponentHealth{
 				Status:  HealthStatusDegraded,
 				Message: "upstream disconnected - operating in standalone mode",
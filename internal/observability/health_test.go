@@ -0,0 +1,135 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/audit"
+)
+
+// TestAuditWriterChecker tests that the audit checker degrades while
+// records dropped since the last write or a stalled, near-full buffer
+// persist, gives the same result on every check, and fails when the store
+// does.
+func TestAuditWriterChecker(t *testing.T) {
+	store, err := audit.NewStore(audit.StoreConfig{DBPath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	// The writer is never started, so nothing drains the buffer
+	writer := audit.NewWriter(store, audit.WriterConfig{BufferSize: 10, FlushInterval: time.Hour})
+	check := AuditWriterChecker(
+		writer.FillRatio,
+		func() time.Time { return writer.Stats().LastWrite },
+		func() time.Time { return writer.Stats().LastDrop },
+		store.Ping,
+	)
+	ctx := context.Background()
+
+	// Checks are repeated, as liveness and readiness both run them
+	expect := func(check HealthChecker, want HealthStatus) {
+		t.Helper()
+		for range 2 {
+			if got := check(ctx); got.Status != want {
+				t.Errorf("status = %s (%s), want %s", got.Status, got.Message, want)
+			}
+		}
+	}
+	write := func(n int) {
+		for range n {
+			writer.Write(audit.NewRecordBuilder().WithRequest("req", "sess").Build())
+		}
+	}
+
+	expect(check, HealthStatusHealthy)
+
+	// A full buffer is fine while writes keep up
+	write(10)
+	if got := writer.FillRatio(); got != 1 {
+		t.Errorf("FillRatio() = %v, want 1", got)
+	}
+	expect(check, HealthStatusHealthy)
+
+	// Dropped records are degraded until the next successful write
+	write(1)
+	expect(check, HealthStatusDegraded)
+	writer.Flush()
+	expect(check, HealthStatusHealthy)
+
+	// A near-full buffer with no recent write is degraded
+	stalled := func(ratio float64) HealthChecker {
+		return AuditWriterChecker(
+			func() float64 { return ratio },
+			func() time.Time { return time.Now().Add(-time.Minute) },
+			func() time.Time { return time.Time{} },
+			store.Ping,
+		)
+	}
+	expect(stalled(1), HealthStatusDegraded)
+	expect(stalled(0.5), HealthStatusHealthy)
+
+	// An unreachable store is unhealthy
+	store.Close()
+	expect(check, HealthStatusUnhealthy)
+}
+
+// TestUpstreamRequired tests that a never-connecting upstream fails
+// readiness only when it is required, while liveness always passes.
+func TestUpstreamRequired(t *testing.T) {
+	tests := []struct {
+		name      string
+		required  bool
+		wantReady int
+	}{
+		{"optional", false, http.StatusOK},
+		{"required", true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := NewHealth("test")
+			health.RegisterChecker("upstream", UpstreamChecker(func() bool { return false }, nil, tt.required))
+			health.SetReady(true)
+
+			rec := httptest.NewRecorder()
+			health.ReadinessHandler()(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.wantReady {
+				t.Errorf("readiness status = %d, want %d", rec.Code, tt.wantReady)
+			}
+
+			rec = httptest.NewRecorder()
+			health.LivenessHandler()(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("liveness status = %d, want %d", rec.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+// TestHealthMode tests that component health responses report the upstream
+// mode.
+func TestHealthMode(t *testing.T) {
+	health := NewHealth("test")
+	health.SetReady(true)
+	mode := ModeStandalone
+	health.SetModeFunc(func() string { return mode })
+
+	for _, want := range []string{ModeStandalone, ModeProxying} {
+		mode = want
+		rec := httptest.NewRecorder()
+		health.ReadinessHandler()(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+		var resp HealthResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if resp.Mode != want {
+			t.Errorf("Mode = %q, want %q", resp.Mode, want)
+		}
+	}
+}
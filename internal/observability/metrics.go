@@ -1,6 +1,9 @@
 package observability
 
 import (
+	"sync/atomic"
+
+	"github.com/agentfacts/mcp-proxy/internal/upstream"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -13,37 +16,60 @@ type Metrics struct {
 	RequestsInFlight prometheus.Gauge
 
 	// Session metrics
-	ActiveSessions  prometheus.Gauge
-	SessionsTotal   *prometheus.CounterVec
-	SessionDuration prometheus.Histogram
+	ActiveSessions   prometheus.Gauge
+	SessionsTotal    *prometheus.CounterVec
+	SessionsClosed   *prometheus.CounterVec
+	SessionDuration  prometheus.Histogram
+	SessionOldestAge prometheus.Gauge
+	MessagesDropped  *prometheus.CounterVec
 
 	// Policy metrics
 	PolicyDecisions   *prometheus.CounterVec
+	PolicyRuleFires   *prometheus.CounterVec
 	PolicyEvaluation  prometheus.Histogram
-	PolicyCacheHits   prometheus.Counter
+	PolicyCacheHits   *prometheus.CounterVec
 	PolicyCacheMisses prometheus.Counter
+	DecisionLogDrops  prometheus.Counter
 
 	// Upstream metrics
 	UpstreamRequests  *prometheus.CounterVec
 	UpstreamDuration  prometheus.Histogram
+	UpstreamResponse  prometheus.Histogram
 	UpstreamConnected prometheus.Gauge
+	UpstreamMode      *prometheus.GaugeVec
+	UpstreamDropped   prometheus.Counter
 
 	// Audit metrics
 	AuditRecordsWritten prometheus.Counter
 	AuditRecordsDropped prometheus.Counter
 	AuditBufferSize     prometheus.Gauge
 	AuditFlushes        prometheus.Counter
+	AuditRecordsPruned  prometheus.Counter
+	AuditSinkDropped    *prometheus.CounterVec
+
+	// UpstreamCircuitState reports the circuit breaker state, polled from
+	// the function set with SetCircuitStateFunc
+	UpstreamCircuitState prometheus.GaugeFunc
+	circuitState         atomic.Pointer[func() upstream.CircuitState]
 }
 
-// NewMetrics creates and registers all Prometheus metrics.
+// NewMetrics creates and registers all Prometheus metrics with the default
+// registry.
 func NewMetrics(namespace string) *Metrics {
+	return NewMetricsWithRegistry(namespace, prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates all Prometheus metrics and registers them
+// with reg.
+func NewMetricsWithRegistry(namespace string, reg prometheus.Registerer) *Metrics {
 	if namespace == "" {
 		namespace = "mcp_proxy"
 	}
+	factory := promauto.With(reg)
 
-	return &Metrics{
+	m := &Metrics{
 		// Request metrics
-		RequestsTotal: promauto.NewCounterVec(
+		RequestsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "requests_total",
@@ -51,7 +77,7 @@ func NewMetrics(namespace string) *Metrics {
 			},
 			[]string{"method", "tool", "allowed"},
 		),
-		RequestDuration: promauto.NewHistogramVec(
+		RequestDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Namespace: namespace,
 				Name:      "request_duration_seconds",
@@ -60,7 +86,7 @@ func NewMetrics(namespace string) *Metrics {
 			},
 			[]string{"method"},
 		),
-		RequestsInFlight: promauto.NewGauge(
+		RequestsInFlight: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
 				Name:      "requests_in_flight",
@@ -69,14 +95,14 @@ func NewMetrics(namespace string) *Metrics {
 		),
 
 		// Session metrics
-		ActiveSessions: promauto.NewGauge(
+		ActiveSessions: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
 				Name:      "sessions_active",
 				Help:      "Number of active sessions",
 			},
 		),
-		SessionsTotal: promauto.NewCounterVec(
+		SessionsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "sessions_total",
@@ -84,7 +110,15 @@ func NewMetrics(namespace string) *Metrics {
 			},
 			[]string{"transport"},
 		),
-		SessionDuration: promauto.NewHistogram(
+		SessionsClosed: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "sessions_closed_total",
+				Help:      "Total number of sessions closed",
+			},
+			[]string{"transport"},
+		),
+		SessionDuration: factory.NewHistogram(
 			prometheus.HistogramOpts{
 				Namespace: namespace,
 				Name:      "session_duration_seconds",
@@ -92,9 +126,24 @@ func NewMetrics(namespace string) *Metrics {
 				Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
 			},
 		),
+		SessionOldestAge: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "session_oldest_age_seconds",
+				Help:      "Age of the oldest active session in seconds, as of the last session cleanup",
+			},
+		),
+		MessagesDropped: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "session_messages_dropped_total",
+				Help:      "Messages to clients dropped because the session buffer stayed full, by overflow policy",
+			},
+			[]string{"policy"},
+		),
 
 		// Policy metrics
-		PolicyDecisions: promauto.NewCounterVec(
+		PolicyDecisions: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "policy_decisions_total",
@@ -102,7 +151,15 @@ func NewMetrics(namespace string) *Metrics {
 			},
 			[]string{"decision", "rule", "mode"},
 		),
-		PolicyEvaluation: promauto.NewHistogram(
+		PolicyRuleFires: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "policy_rule_fires_total",
+				Help:      "Total times each policy rule fired",
+			},
+			[]string{"rule"},
+		),
+		PolicyEvaluation: factory.NewHistogram(
 			prometheus.HistogramOpts{
 				Namespace: namespace,
 				Name:      "policy_evaluation_seconds",
@@ -110,23 +167,31 @@ func NewMetrics(namespace string) *Metrics {
 				Buckets:   []float64{.0001, .0005, .001, .005, .01, .025, .05, .1},
 			},
 		),
-		PolicyCacheHits: promauto.NewCounter(
+		PolicyCacheHits: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "policy_cache_hits_total",
-				Help:      "Number of policy cache hits",
+				Help:      "Number of policy cache hits by tier",
 			},
+			[]string{"tier"},
 		),
-		PolicyCacheMisses: promauto.NewCounter(
+		PolicyCacheMisses: factory.NewCounter(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "policy_cache_misses_total",
 				Help:      "Number of policy cache misses",
 			},
 		),
+		DecisionLogDrops: factory.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "policy_decision_log_dropped_total",
+				Help:      "Policy decision log entries dropped because the log was backed up or its sink failed",
+			},
+		),
 
 		// Upstream metrics
-		UpstreamRequests: promauto.NewCounterVec(
+		UpstreamRequests: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "upstream_requests_total",
@@ -134,7 +199,7 @@ func NewMetrics(namespace string) *Metrics {
 			},
 			[]string{"status"},
 		),
-		UpstreamDuration: promauto.NewHistogram(
+		UpstreamDuration: factory.NewHistogram(
 			prometheus.HistogramOpts{
 				Namespace: namespace,
 				Name:      "upstream_request_duration_seconds",
@@ -142,44 +207,98 @@ func NewMetrics(namespace string) *Metrics {
 				Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
 			},
 		),
-		UpstreamConnected: promauto.NewGauge(
+		UpstreamResponse: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "upstream_response_size_bytes",
+				Help:      "Size of upstream responses to enforced and filtered requests in bytes",
+				Buckets:   prometheus.ExponentialBuckets(256, 4, 10),
+			},
+		),
+		UpstreamConnected: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
 				Name:      "upstream_connected",
 				Help:      "Whether upstream is connected (1) or not (0)",
 			},
 		),
+		UpstreamMode: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "upstream_mode",
+				Help:      "1 for the current mode: proxying to upstream, or standalone echoing requests back",
+			},
+			[]string{"mode"},
+		),
+		UpstreamDropped: factory.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "upstream_responses_dropped_total",
+				Help:      "Upstream responses dropped because the request's response buffer was full",
+			},
+		),
 
 		// Audit metrics
-		AuditRecordsWritten: promauto.NewCounter(
+		AuditRecordsWritten: factory.NewCounter(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "audit_records_written_total",
 				Help:      "Total audit records written to storage",
 			},
 		),
-		AuditRecordsDropped: promauto.NewCounter(
+		AuditRecordsDropped: factory.NewCounter(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "audit_records_dropped_total",
 				Help:      "Total audit records dropped due to buffer overflow or errors",
 			},
 		),
-		AuditBufferSize: promauto.NewGauge(
+		AuditBufferSize: factory.NewGauge(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
 				Name:      "audit_buffer_size",
 				Help:      "Current number of records in audit buffer",
 			},
 		),
-		AuditFlushes: promauto.NewCounter(
+		AuditFlushes: factory.NewCounter(
 			prometheus.CounterOpts{
 				Namespace: namespace,
 				Name:      "audit_flushes_total",
 				Help:      "Total number of audit buffer flushes",
 			},
 		),
+		AuditRecordsPruned: factory.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "audit_records_pruned_total",
+				Help:      "Total audit records removed by retention pruning",
+			},
+		),
+		AuditSinkDropped: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "audit_sink_records_dropped_total",
+				Help:      "Audit records an additional sink dropped because it was backed up or unreachable, by sink type",
+			},
+			[]string{"sink"},
+		),
 	}
+
+	m.UpstreamCircuitState = factory.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "upstream_circuit_state",
+			Help:      "Upstream circuit breaker state: 0 closed, 1 half-open, 2 open",
+		},
+		func() float64 {
+			if state := m.circuitState.Load(); state != nil {
+				return float64((*state)())
+			}
+			return float64(upstream.CircuitClosed)
+		},
+	)
+
+	return m
 }
 
 // RecordRequest records metrics for a processed request.
@@ -202,20 +321,78 @@ func (m *Metrics) RecordPolicyDecision(allowed bool, rule, mode string, duration
 	m.PolicyEvaluation.Observe(durationSeconds)
 }
 
-// RecordSession records session metrics.
-func (m *Metrics) RecordSession(transport string, durationSeconds float64) {
+// RecordPolicyCache records whether a policy evaluation was served from the
+// decision cache, and from which tier ("L1" or "L2").
+func (m *Metrics) RecordPolicyCache(hit bool, tier string) {
+	if !hit {
+		m.PolicyCacheMisses.Inc()
+		return
+	}
+	m.PolicyCacheHits.WithLabelValues(tier).Inc()
+}
+
+// RecordRuleFires counts each rule that fired for one policy decision.
+func (m *Metrics) RecordRuleFires(rules []string) {
+	for _, rule := range rules {
+		m.PolicyRuleFires.WithLabelValues(rule).Inc()
+	}
+}
+
+// RecordSessionCreated counts a new session.
+func (m *Metrics) RecordSessionCreated(transport string) {
 	m.SessionsTotal.WithLabelValues(transport).Inc()
+}
+
+// RecordSessionClosed records a session that has ended and how long it
+// lasted.
+func (m *Metrics) RecordSessionClosed(transport string, durationSeconds float64) {
+	m.SessionsClosed.WithLabelValues(transport).Inc()
 	if durationSeconds > 0 {
 		m.SessionDuration.Observe(durationSeconds)
 	}
 }
 
+// SetOldestSessionAge sets the age of the oldest active session.
+func (m *Metrics) SetOldestSessionAge(seconds float64) {
+	m.SessionOldestAge.Set(seconds)
+}
+
+// IncrementMessagesDropped counts a client message dropped under the given
+// overflow policy.
+func (m *Metrics) IncrementMessagesDropped(policy string) {
+	m.MessagesDropped.WithLabelValues(policy).Inc()
+}
+
 // RecordUpstreamRequest records an upstream request result.
 func (m *Metrics) RecordUpstreamRequest(status string, durationSeconds float64) {
 	m.UpstreamRequests.WithLabelValues(status).Inc()
 	m.UpstreamDuration.Observe(durationSeconds)
 }
 
+// IncrementUpstreamDropped counts an upstream response dropped because its
+// request's buffer was full.
+func (m *Metrics) IncrementUpstreamDropped() {
+	m.UpstreamDropped.Inc()
+}
+
+// SetCircuitStateFunc sets the function the upstream_circuit_state gauge
+// polls for the circuit breaker state. Without one the gauge reports
+// closed.
+func (m *Metrics) SetCircuitStateFunc(state func() upstream.CircuitState) {
+	m.circuitState.Store(&state)
+}
+
+// SetUpstreamMode marks mode (ModeProxying or ModeStandalone) as current.
+func (m *Metrics) SetUpstreamMode(mode string) {
+	for _, known := range []string{ModeProxying, ModeStandalone} {
+		if known == mode {
+			m.UpstreamMode.WithLabelValues(known).Set(1)
+		} else {
+			m.UpstreamMode.WithLabelValues(known).Set(0)
+		}
+	}
+}
+
 // UpdateAuditStats updates audit-related gauges.
 func (m *Metrics) UpdateAuditStats(bufferSize int, written, dropped, flushes int64) {
 	m.AuditBufferSize.Set(float64(bufferSize))
@@ -237,3 +414,19 @@ func (m *Metrics) IncrementAuditDropped(count int) {
 func (m *Metrics) IncrementAuditFlushes() {
 	m.AuditFlushes.Inc()
 }
+
+// IncrementAuditSinkDropped counts a record dropped by an additional audit
+// sink of the given type.
+func (m *Metrics) IncrementAuditSinkDropped(sink string) {
+	m.AuditSinkDropped.WithLabelValues(sink).Inc()
+}
+
+// AddDecisionLogDropped adds n to the dropped decision log entries counter.
+func (m *Metrics) AddDecisionLogDropped(n int) {
+	m.DecisionLogDrops.Add(float64(n))
+}
+
+// IncrementAuditPruned increments the audit records pruned counter.
+func (m *Metrics) IncrementAuditPruned(count int64) {
+	m.AuditRecordsPruned.Add(float64(count))
+}
@@ -0,0 +1,170 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/upstream"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatherCounter returns the value of the counter with the given name and
+// label value in reg, or 0 if it has not been recorded.
+func gatherCounter(t *testing.T, reg *prometheus.Registry, name, label, value string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matches := label == ""
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label && pair.GetValue() == value {
+					matches = true
+				}
+			}
+			if matches {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// TestRecordPolicyCache tests that cache hits are counted by tier and
+// misses separately.
+func TestRecordPolicyCache(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetricsWithRegistry("test", reg)
+
+	m.RecordPolicyCache(true, "L1")
+	m.RecordPolicyCache(true, "L1")
+	m.RecordPolicyCache(true, "L2")
+	m.RecordPolicyCache(false, "")
+
+	tests := []struct {
+		name   string
+		metric string
+		tier   string
+		want   float64
+	}{
+		{name: "L1 hits", metric: "test_policy_cache_hits_total", tier: "L1", want: 2},
+		{name: "L2 hits", metric: "test_policy_cache_hits_total", tier: "L2", want: 1},
+		{name: "misses", metric: "test_policy_cache_misses_total", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label := ""
+			if tt.tier != "" {
+				label = "tier"
+			}
+			if got := gatherCounter(t, reg, tt.metric, label, tt.tier); got != tt.want {
+				t.Errorf("%s{tier=%q} = %v, want %v", tt.metric, tt.tier, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSessionDurationOnDelete tests that sessions are counted when created
+// and their lifetime is observed once they are deleted from the session
+// manager.
+func TestSessionDurationOnDelete(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetricsWithRegistry("test", reg)
+
+	mgr := session.NewManager(session.DefaultManagerConfig())
+	mgr.SetOnSessionCreated(func(sess *session.Session) {
+		m.RecordSessionCreated("sse")
+	})
+	mgr.SetOnSessionClosed(func(sess *session.Session) {
+		m.RecordSessionClosed("sse", sess.Age().Seconds())
+	})
+
+	sess, err := mgr.Create(context.Background())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got := gatherCounter(t, reg, "test_sessions_total", "transport", "sse"); got != 1 {
+		t.Errorf("sessions_total{transport=sse} after Create = %v, want 1", got)
+	}
+	mgr.Delete(sess.ID)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	var observed uint64
+	for _, family := range families {
+		if family.GetName() == "test_session_duration_seconds" {
+			observed = family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	if observed != 1 {
+		t.Errorf("session_duration_seconds observations = %d, want 1", observed)
+	}
+	if got := gatherCounter(t, reg, "test_sessions_closed_total", "transport", "sse"); got != 1 {
+		t.Errorf("sessions_closed_total{transport=sse} = %v, want 1", got)
+	}
+}
+
+// TestUpstreamCircuitState tests that the circuit state gauge and the
+// upstream health check follow the breaker through open, half-open and
+// closed.
+func TestUpstreamCircuitState(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetricsWithRegistry("test", reg)
+
+	const timeout = 50 * time.Millisecond
+	breaker := upstream.NewCircuitBreaker(config.CircuitBreakerConfig{Enabled: true, Threshold: 1, Timeout: timeout})
+	m.SetCircuitStateFunc(breaker.State)
+	checker := UpstreamChecker(func() bool { return true }, breaker.State, true)
+
+	expect := func(want upstream.CircuitState, wantStatus HealthStatus) {
+		t.Helper()
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather() error = %v", err)
+		}
+		gauge := -1.0
+		for _, family := range families {
+			if family.GetName() == "test_upstream_circuit_state" {
+				gauge = family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		if gauge != float64(want) {
+			t.Errorf("test_upstream_circuit_state = %v, want %v (%s)", gauge, float64(want), want)
+		}
+		if got := checker(context.Background()).Status; got != wantStatus {
+			t.Errorf("upstream health = %s, want %s", got, wantStatus)
+		}
+	}
+
+	expect(upstream.CircuitClosed, HealthStatusHealthy)
+
+	generation, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	breaker.Record(generation, errors.New("connection refused"))
+	expect(upstream.CircuitOpen, HealthStatusUnhealthy)
+
+	time.Sleep(timeout)
+	expect(upstream.CircuitHalfOpen, HealthStatusDegraded)
+
+	generation, err = breaker.Allow()
+	if err != nil {
+		t.Fatalf("Allow() trial error = %v", err)
+	}
+	breaker.Record(generation, nil)
+	expect(upstream.CircuitClosed, HealthStatusHealthy)
+}
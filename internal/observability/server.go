@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -17,6 +18,7 @@ type ServerConfig struct {
 	MetricsAddress string
 	MetricsPort    int
 	MetricsPath    string
+	PprofEnabled   bool // Serve /debug/pprof/ on the metrics server
 
 	// Health configuration
 	HealthEnabled bool
@@ -24,6 +26,11 @@ type ServerConfig struct {
 	HealthPort    int
 	LivenessPath  string
 	ReadinessPath string
+
+	// Admin configuration
+	AdminEnabled bool
+	AdminAddress string
+	AdminPort    int
 }
 
 // Server serves metrics and health check endpoints.
@@ -31,9 +38,12 @@ type Server struct {
 	cfg     ServerConfig
 	metrics *Metrics
 	health  *Health
+	stats   *Stats
+	admin   *Admin
 
 	metricsServer *http.Server
 	healthServer  *http.Server
+	adminServer   *http.Server
 }
 
 // NewServer creates a new observability server.
@@ -45,6 +55,16 @@ func NewServer(cfg ServerConfig, metrics *Metrics, health *Health) *Server {
 	}
 }
 
+// SetStats sets the statistics served at /stats on the metrics server.
+func (s *Server) SetStats(stats *Stats) {
+	s.stats = stats
+}
+
+// SetAdmin sets the admin API served on the admin server.
+func (s *Server) SetAdmin(admin *Admin) {
+	s.admin = admin
+}
+
 // Start starts the observability servers.
 func (s *Server) Start(ctx context.Context) error {
 	// Start metrics server if enabled
@@ -61,26 +81,66 @@ func (s *Server) Start(ctx context.Context) error {
 		}
 	}
 
+	// Start admin server if enabled
+	if s.cfg.AdminEnabled && s.admin != nil {
+		if err := s.startAdminServer(); err != nil {
+			return fmt.Errorf("failed to start admin server: %w", err)
+		}
+	}
+
 	return nil
 }
 
-// startMetricsServer starts the Prometheus metrics HTTP server.
-func (s *Server) startMetricsServer() error {
+// pprofWriteTimeout is the metrics server write timeout when pprof is
+// enabled, long enough for CPU profiles and traces of up to a minute.
+const pprofWriteTimeout = 90 * time.Second
+
+// metricsHandler returns the handler for the metrics server.
+func (s *Server) metricsHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle(s.cfg.MetricsPath, promhttp.Handler())
+	if s.stats != nil {
+		mux.HandleFunc("/stats", s.stats.Handler())
+	}
+
+	if s.cfg.PprofEnabled {
+		// /debug/pprof/               index of available profiles
+		// /debug/pprof/cmdline        command line of the process
+		// /debug/pprof/profile        CPU profile (?seconds=N, default 30)
+		// /debug/pprof/symbol         symbol lookup for program counters
+		// /debug/pprof/trace          execution trace (?seconds=N, default 1)
+		// /debug/pprof/{heap,goroutine,allocs,block,mutex,threadcreate}
+		//                             named profiles, served by the index handler
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	return mux
+}
+
+// startMetricsServer starts the Prometheus metrics HTTP server.
+func (s *Server) startMetricsServer() error {
+	writeTimeout := 10 * time.Second
+	if s.cfg.PprofEnabled {
+		writeTimeout = pprofWriteTimeout
+	}
 
 	addr := fmt.Sprintf("%s:%d", s.cfg.MetricsAddress, s.cfg.MetricsPort)
 	s.metricsServer = &http.Server{
 		Addr:         addr,
-		Handler:      mux,
+		Handler:      s.metricsHandler(),
 		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: writeTimeout,
 	}
 
 	go func() {
 		log.Info().
 			Str("address", addr).
 			Str("path", s.cfg.MetricsPath).
+			Bool("pprof", s.cfg.PprofEnabled).
 			Msg("Metrics server listening")
 
 		if err := s.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -121,6 +181,29 @@ func (s *Server) startHealthServer() error {
 	return nil
 }
 
+// startAdminServer starts the admin API HTTP server.
+func (s *Server) startAdminServer() error {
+	addr := fmt.Sprintf("%s:%d", s.cfg.AdminAddress, s.cfg.AdminPort)
+	s.adminServer = &http.Server{
+		Addr:         addr,
+		Handler:      s.admin.Handler(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Info().
+			Str("address", addr).
+			Msg("Admin server listening")
+
+		if err := s.adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Admin server error")
+		}
+	}()
+
+	return nil
+}
+
 // Stop gracefully stops the observability servers.
 func (s *Server) Stop(ctx context.Context) error {
 	var errs []error
@@ -139,6 +222,13 @@ func (s *Server) Stop(ctx context.Context) error {
 		}
 	}
 
+	if s.adminServer != nil {
+		log.Info().Msg("Stopping admin server...")
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("admin server shutdown: %w", err))
+		}
+	}
+
 	if len(errs) > 0 {
 		return errs[0]
 	}
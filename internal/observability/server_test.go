@@ -0,0 +1,131 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestMetricsHandlerPprof tests that pprof routes are served only when
+// enabled.
+func TestMetricsHandlerPprof(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		wantStatus int
+	}{
+		{name: "enabled", enabled: true, wantStatus: http.StatusOK},
+		{name: "disabled by default", enabled: false, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(ServerConfig{
+				MetricsPath:  "/metrics",
+				PprofEnabled: tt.enabled,
+			}, nil, nil)
+
+			ts := httptest.NewServer(srv.metricsHandler())
+			defer ts.Close()
+
+			resp, err := http.Get(ts.URL + "/debug/pprof/")
+			if err != nil {
+				t.Fatalf("GET /debug/pprof/ error = %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("GET /debug/pprof/ status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			resp, err = http.Get(ts.URL + "/metrics")
+			if err != nil {
+				t.Fatalf("GET /metrics error = %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("GET /metrics status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+		})
+	}
+}
+
+// TestStatsHandler tests the JSON shape of the stats endpoint.
+func TestStatsHandler(t *testing.T) {
+	stats := NewStats("test")
+	stats.Register("policy", func(ctx context.Context) (any, error) {
+		return map[string]any{"evaluations": 3, "cache": map[string]any{"hit_rate": 0.5}}, nil
+	})
+	stats.Register("sessions", func(ctx context.Context) (any, error) {
+		return map[string]int{"active": 2}, nil
+	})
+	stats.Register("audit", func(ctx context.Context) (any, error) {
+		return nil, errors.New("database unreachable")
+	})
+
+	srv := NewServer(ServerConfig{MetricsPath: "/metrics"}, nil, nil)
+	srv.SetStats(stats)
+	ts := httptest.NewServer(srv.metricsHandler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/stats")
+	if err != nil {
+		t.Fatalf("GET /stats error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /stats status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var body struct {
+		Timestamp time.Time `json:"timestamp"`
+		Version   string    `json:"version"`
+		Stats     struct {
+			Policy struct {
+				Evaluations int `json:"evaluations"`
+				Cache       struct {
+					HitRate float64 `json:"hit_rate"`
+				} `json:"cache"`
+			} `json:"policy"`
+			Sessions struct {
+				Active int `json:"active"`
+			} `json:"sessions"`
+		} `json:"stats"`
+		Errors map[string]string `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+
+	if body.Timestamp.IsZero() || body.Version != "test" {
+		t.Errorf("timestamp = %v, version = %q", body.Timestamp, body.Version)
+	}
+	if body.Stats.Policy.Evaluations != 3 || body.Stats.Policy.Cache.HitRate != 0.5 {
+		t.Errorf("policy stats = %+v", body.Stats.Policy)
+	}
+	if body.Stats.Sessions.Active != 2 {
+		t.Errorf("sessions.active = %d, want 2", body.Stats.Sessions.Active)
+	}
+	if body.Errors["audit"] != "database unreachable" {
+		t.Errorf("errors = %v, want audit error", body.Errors)
+	}
+
+	// The endpoint is read-only
+	resp, err = http.Post(ts.URL+"/stats", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /stats error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /stats status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,91 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StatsProvider returns one section of the stats response. The value is
+// encoded as JSON.
+type StatsProvider func(ctx context.Context) (any, error)
+
+// StatsResponse is returned by the stats endpoint.
+type StatsResponse struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Version   string            `json:"version,omitempty"`
+	Stats     map[string]any    `json:"stats"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// Stats collects runtime statistics from registered providers.
+type Stats struct {
+	version   string
+	providers map[string]StatsProvider
+	mu        sync.RWMutex
+}
+
+// NewStats creates an empty stats collector.
+func NewStats(version string) *Stats {
+	return &Stats{
+		version:   version,
+		providers: make(map[string]StatsProvider),
+	}
+}
+
+// Register adds a provider for a named stats section.
+func (s *Stats) Register(name string, provider StatsProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providers[name] = provider
+}
+
+// Collect queries all providers. Sections whose provider fails are left out
+// of Stats and reported in Errors.
+func (s *Stats) Collect(ctx context.Context) StatsResponse {
+	s.mu.RLock()
+	providers := make(map[string]StatsProvider, len(s.providers))
+	for name, provider := range s.providers {
+		providers[name] = provider
+	}
+	s.mu.RUnlock()
+
+	response := StatsResponse{
+		Timestamp: time.Now().UTC(),
+		Version:   s.version,
+		Stats:     make(map[string]any, len(providers)),
+	}
+	for name, provider := range providers {
+		value, err := provider(ctx)
+		if err != nil {
+			if response.Errors == nil {
+				response.Errors = make(map[string]string)
+			}
+			response.Errors[name] = err.Error()
+			continue
+		}
+		response.Stats[name] = value
+	}
+
+	return response
+}
+
+// Handler returns a read-only HTTP handler serving the collected stats.
+func (s *Stats) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(s.Collect(ctx))
+	}
+}
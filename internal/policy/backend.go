@@ -0,0 +1,46 @@
+package policy
+
+import "context"
+
+// Policy backends selectable with the policy.backend setting.
+const (
+	BackendOPA        = "opa"
+	BackendCapability = "capability"
+)
+
+// PolicyBackend evaluates requests against policy. Engine, which runs Rego
+// on embedded OPA, is the default backend; CapabilityMatcher is a
+// lightweight alternative for deployments that only map tools to
+// capabilities. Loading Rego modules is left to Engine, the only backend
+// that has them.
+type PolicyBackend interface {
+	// Evaluate returns the decision for input, recording it in the decision
+	// log if one is set.
+	Evaluate(ctx context.Context, input *PolicyInput) (*EvaluationResult, error)
+
+	// Simulate evaluates each input fresh, without caching, logging or
+	// statistics. A failed evaluation is reported in the result's Err.
+	Simulate(ctx context.Context, inputs []*PolicyInput) []*EvaluationResult
+
+	// IsReady reports whether the backend can evaluate requests.
+	IsReady() bool
+
+	// SetData replaces the runtime policy data (tool_capabilities,
+	// blocked_tools, etc).
+	SetData(data map[string]interface{}) error
+
+	// SetDecisionLogger sets the logger evaluated decisions are recorded
+	// to. Set it before evaluating requests.
+	SetDecisionLogger(l *DecisionLogger)
+}
+
+var (
+	_ PolicyBackend = (*Engine)(nil)
+	_ PolicyBackend = (*CapabilityMatcher)(nil)
+)
+
+// SetData updates the runtime policy data. It is SetPolicyData under the
+// name PolicyBackend requires.
+func (e *Engine) SetData(data map[string]interface{}) error {
+	return e.SetPolicyData(data)
+}
@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/rs/zerolog/log"
+)
+
+// Remote bundle defaults.
+const (
+	DefaultBundlePollInterval = time.Minute
+	DefaultBundleTimeout      = 30 * time.Second
+	DefaultBundleKeyID        = "default"
+	DefaultBundleSigningAlg   = "RS256"
+	DefaultBundleMaxBytes     = 64 * 1024 * 1024
+)
+
+// errBundleNotModified is returned by fetch when the server reports that the
+// bundle has not changed since the last fetch.
+var errBundleNotModified = errors.New("bundle not modified")
+
+// BundleConfig configures fetching an OPA bundle from a remote URL.
+type BundleConfig struct {
+	URL          string
+	PollInterval time.Duration // defaults to DefaultBundlePollInterval
+	Timeout      time.Duration // per-request limit; defaults to DefaultBundleTimeout
+	MaxBytes     int64         // download and file size limit; defaults to DefaultBundleMaxBytes
+
+	// VerificationKey is the PEM public key, or a file containing it, that
+	// bundles must be signed with. With an HS* SigningAlg it is the HMAC
+	// secret itself. Empty disables signature verification.
+	VerificationKey string
+	KeyID           string // defaults to DefaultBundleKeyID
+	SigningAlg      string // defaults to DefaultBundleSigningAlg
+}
+
+// BundleLoader fetches an OPA bundle tarball over HTTP(S) and loads its
+// policies and data into the engine. A bundle that fails to download, verify
+// or compile is ignored and the last good bundle stays active. The bundle's
+// data has the layout of the policy data file.
+type BundleLoader struct {
+	cfg    BundleConfig
+	client *http.Client
+	verify *bundle.VerificationConfig
+
+	mu   sync.Mutex
+	etag string // of the last good bundle
+}
+
+// NewBundleLoader creates a bundle loader, reading the verification key if
+// one is configured.
+func NewBundleLoader(cfg BundleConfig) (*BundleLoader, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("bundle URL is required")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultBundlePollInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultBundleTimeout
+	}
+	if cfg.KeyID == "" {
+		cfg.KeyID = DefaultBundleKeyID
+	}
+	if cfg.SigningAlg == "" {
+		cfg.SigningAlg = DefaultBundleSigningAlg
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultBundleMaxBytes
+	}
+
+	b := &BundleLoader{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+
+	if cfg.VerificationKey != "" {
+		key := cfg.VerificationKey
+		if !strings.Contains(key, "-----BEGIN") && !strings.HasPrefix(cfg.SigningAlg, "HS") {
+			content, err := os.ReadFile(filepath.Clean(key))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read bundle verification key: %w", err)
+			}
+			key = string(content)
+		}
+		b.verify = bundle.NewVerificationConfig(map[string]*bundle.KeyConfig{
+			cfg.KeyID: {Key: key, Algorithm: cfg.SigningAlg},
+		}, cfg.KeyID, "", nil)
+	}
+
+	return b, nil
+}
+
+// Load fetches the bundle and loads it into the engine, replacing its
+// policies and data, and returns the data. If the bundle has not changed
+// since the last load, Load does nothing and returns nil.
+func (b *BundleLoader) Load(ctx context.Context, engine *Engine) (*PolicyData, error) {
+	_, data, err := b.load(ctx, engine)
+	return data, err
+}
+
+// Reload fetches and loads the bundle even if it has not changed, and
+// returns the number of top-level data keys loaded and the data.
+func (b *BundleLoader) Reload(ctx context.Context, engine *Engine) (int, *PolicyData, error) {
+	b.mu.Lock()
+	b.etag = ""
+	b.mu.Unlock()
+	return b.load(ctx, engine)
+}
+
+// load fetches the bundle and loads it into the engine, returning the
+// number of top-level data keys and the data, or no data if the bundle has
+// not changed.
+func (b *BundleLoader) load(ctx context.Context, engine *Engine) (int, *PolicyData, error) {
+	bndl, etag, err := b.fetch(ctx)
+	if errors.Is(err, errBundleNotModified) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	modules := make(map[string]string, len(bndl.Modules))
+	for _, mod := range bndl.Modules {
+		modules[strings.TrimPrefix(mod.Path, "/")] = string(mod.Raw)
+	}
+	if len(modules) == 0 {
+		return 0, nil, fmt.Errorf("bundle contains no policies")
+	}
+
+	data := bndl.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	pd, err := PolicyDataFromMap(data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid bundle data: %w", err)
+	}
+
+	if err := engine.LoadPoliciesAndData(ctx, modules, data); err != nil {
+		return 0, nil, fmt.Errorf("failed to compile bundle: %w", err)
+	}
+
+	b.mu.Lock()
+	b.etag = etag
+	b.mu.Unlock()
+
+	log.Info().
+		Str("url", b.cfg.URL).
+		Int("modules", len(modules)).
+		Str("revision", bndl.Manifest.Revision).
+		Msg("Policy bundle loaded")
+
+	return len(data), pd, nil
+}
+
+// Poll reloads the bundle every poll interval until ctx is cancelled.
+// Failures are logged and the last good bundle stays active. onChange, if
+// non-nil, is called with the data of each bundle that is loaded.
+func (b *BundleLoader) Poll(ctx context.Context, engine *Engine, onChange func(data *PolicyData)) {
+	ticker := time.NewTicker(b.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := b.Load(ctx, engine)
+			if err != nil {
+				log.Error().Err(err).Str("url", b.cfg.URL).Msg("Failed to load policy bundle, keeping last good bundle")
+				continue
+			}
+			if data != nil && onChange != nil {
+				onChange(data)
+			}
+		}
+	}
+}
+
+// fetch downloads and reads the bundle, verifying its signature if
+// configured.
+func (b *BundleLoader) fetch(ctx context.Context) (*bundle.Bundle, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.cfg.URL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid bundle URL: %w", err)
+	}
+	b.mu.Lock()
+	if b.etag != "" {
+		req.Header.Set("If-None-Match", b.etag)
+	}
+	b.mu.Unlock()
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download bundle: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, "", errBundleNotModified
+	default:
+		io.Copy(io.Discard, resp.Body)
+		return nil, "", fmt.Errorf("failed to download bundle: %s", resp.Status)
+	}
+
+	// Read one byte past the limit to tell a bundle that fits from one cut off
+	body, err := io.ReadAll(io.LimitReader(resp.Body, b.cfg.MaxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download bundle: %w", err)
+	}
+	if int64(len(body)) > b.cfg.MaxBytes {
+		return nil, "", fmt.Errorf("bundle exceeds %d bytes", b.cfg.MaxBytes)
+	}
+
+	reader := bundle.NewReader(bytes.NewReader(body)).WithSizeLimitBytes(b.cfg.MaxBytes)
+	if b.verify != nil {
+		reader = reader.WithBundleVerificationConfig(b.verify)
+	}
+	bndl, err := reader.Read()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	return &bndl, resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,241 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+const bundleTestSecret = "bundle-test-secret"
+
+// bundleServer serves a bundle tarball with an ETag, or fails on request.
+type bundleServer struct {
+	mu      sync.Mutex
+	body    []byte
+	etag    string
+	fail    bool
+	fetches int
+}
+
+func (s *bundleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetches++
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	if r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Write(s.body)
+}
+
+func (s *bundleServer) set(body []byte, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+	s.etag = etag
+	s.fail = false
+}
+
+func (s *bundleServer) setFailing() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = true
+}
+
+// buildBundle writes a bundle tarball with one policy and data, signing it
+// with bundleTestSecret if sign is true.
+func buildBundle(t *testing.T, policy string, data map[string]interface{}, sign bool) []byte {
+	t.Helper()
+
+	b := bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: "test"},
+		Modules: []bundle.ModuleFile{{
+			URL:    "/mcp/policy.rego",
+			Path:   "/mcp/policy.rego",
+			Raw:    []byte(policy),
+			Parsed: ast.MustParseModule(policy),
+		}},
+		Data: data,
+	}
+	if sign {
+		if err := b.GenerateSignature(bundle.NewSigningConfig(bundleTestSecret, "HS256", ""), "test", false); err != nil {
+			t.Fatalf("GenerateSignature() error = %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.NewWriter(&buf).Write(b); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	return buf.Bytes()
+}
+
+const bundleDataPolicy = `package mcp.policy
+
+decision = {"allow": true, "matched_rule": data.settings.rule}
+`
+
+// TestBundleLoader tests loading, reloading and falling back to the last
+// good bundle.
+func TestBundleLoader(t *testing.T) {
+	srv := &bundleServer{}
+	srv.set(buildBundle(t, bundleDataPolicy, map[string]interface{}{
+		"settings":     map[string]interface{}{"rule": "bundle_v1"},
+		"blocked_dids": []interface{}{"did:web:evil.example"},
+	}, false), `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	loader, err := NewBundleLoader(BundleConfig{URL: ts.URL})
+	if err != nil {
+		t.Fatalf("NewBundleLoader() error = %v", err)
+	}
+
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+	ctx := context.Background()
+	input := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", []string{"read"}).
+		WithRequest("tools/call", "read_file", nil).
+		Build()
+
+	expectRule := func(want string) {
+		t.Helper()
+		result, err := engine.Evaluate(ctx, input)
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		if result.Decision.MatchedRule != want {
+			t.Errorf("MatchedRule = %q, want %q", result.Decision.MatchedRule, want)
+		}
+	}
+
+	data, err := loader.Load(ctx, engine)
+	if err != nil || data == nil {
+		t.Fatalf("Load() = %v, %v, want data, nil", data, err)
+	}
+	expectRule("bundle_v1")
+	if !slices.Equal(data.BlockedDIDs, []string{"did:web:evil.example"}) {
+		t.Errorf("BlockedDIDs = %v, want the bundle's", data.BlockedDIDs)
+	}
+
+	// Unchanged bundle is answered with 304
+	data, err = loader.Load(ctx, engine)
+	if err != nil || data != nil {
+		t.Fatalf("Load() unchanged = %v, %v, want nil, nil", data, err)
+	}
+
+	// Unless a reload is forced
+	keys, data, err := loader.Reload(ctx, engine)
+	if err != nil || data == nil || keys != 2 {
+		t.Fatalf("Reload() = %d, %v, %v, want 2, data, nil", keys, data, err)
+	}
+
+	// New bundle revision is picked up
+	srv.set(buildBundle(t, bundleDataPolicy, map[string]interface{}{
+		"settings": map[string]interface{}{"rule": "bundle_v2"},
+	}, false), `"v2"`)
+	data, err = loader.Load(ctx, engine)
+	if err != nil || data == nil {
+		t.Fatalf("Load() v2 = %v, %v, want data, nil", data, err)
+	}
+	expectRule("bundle_v2")
+
+	// Server errors keep the last good bundle
+	srv.setFailing()
+	if _, err := loader.Load(ctx, engine); err == nil {
+		t.Error("Load() with failing server should return error")
+	}
+	expectRule("bundle_v2")
+
+	// Corrupt bundles keep the last good bundle
+	srv.set([]byte("not a tarball"), `"v3"`)
+	if _, err := loader.Load(ctx, engine); err == nil {
+		t.Error("Load() with corrupt bundle should return error")
+	}
+	expectRule("bundle_v2")
+}
+
+// TestBundleLoaderSignature tests that signed bundles are verified.
+func TestBundleLoaderSignature(t *testing.T) {
+	data := map[string]interface{}{
+		"settings": map[string]interface{}{"rule": "signed"},
+	}
+
+	tests := []struct {
+		name    string
+		sign    bool
+		wantErr bool
+	}{
+		{name: "signed bundle", sign: true},
+		{name: "unsigned bundle", sign: false, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &bundleServer{}
+			srv.set(buildBundle(t, bundleDataPolicy, data, tt.sign), `"v1"`)
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			loader, err := NewBundleLoader(BundleConfig{
+				URL:             ts.URL,
+				VerificationKey: bundleTestSecret,
+				KeyID:           "test",
+				SigningAlg:      "HS256",
+			})
+			if err != nil {
+				t.Fatalf("NewBundleLoader() error = %v", err)
+			}
+
+			engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+			_, err = loader.Load(context.Background(), engine)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestBundleLoaderLimits tests that oversized bundles and unreadable
+// verification key files are rejected.
+func TestBundleLoaderLimits(t *testing.T) {
+	body := buildBundle(t, bundleDataPolicy, map[string]interface{}{
+		"settings": map[string]interface{}{"rule": "large"},
+	}, false)
+	srv := &bundleServer{}
+	srv.set(body, `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	loader, err := NewBundleLoader(BundleConfig{URL: ts.URL, MaxBytes: int64(len(body) - 1)})
+	if err != nil {
+		t.Fatalf("NewBundleLoader() error = %v", err)
+	}
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+	if _, err := loader.Load(context.Background(), engine); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Load() of oversized bundle error = %v, want size limit error", err)
+	}
+
+	_, err = NewBundleLoader(BundleConfig{
+		URL:             ts.URL,
+		VerificationKey: filepath.Join(t.TempDir(), "missing.pem"),
+	})
+	if err == nil {
+		t.Error("NewBundleLoader() with unreadable key file should return error")
+	}
+}
@@ -3,14 +3,28 @@ package policy
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// DefaultL1Size is the default number of entries held in the L1 tier.
+const DefaultL1Size = 1024
+
 // DecisionCache provides multi-tier caching for policy decisions.
 type DecisionCache struct {
+	// L1 cache - small, lock-free, most recently used decisions
+	l1 []atomic.Pointer[l1Item]
+
+	// gen is bumped by Invalidate; L1 items from an earlier generation are
+	// ignored, so a Get racing Invalidate cannot promote a stale entry
+	gen atomic.Uint64
+
 	// L2 cache - session-scoped, longer TTL
 	l2Cache map[string]*cacheEntry
 	l2Mu    sync.RWMutex
@@ -21,10 +35,10 @@ type DecisionCache struct {
 	enabled    bool
 
 	// Metrics
-	l1Hits  int64
-	l2Hits  int64
-	misses  int64
-	evicted int64
+	l1Hits  atomic.Int64
+	l2Hits  atomic.Int64
+	misses  atomic.Int64
+	evicted atomic.Int64
 }
 
 type cacheEntry struct {
@@ -32,11 +46,19 @@ type cacheEntry struct {
 	expiresAt time.Time
 }
 
+// l1Item is an L1 slot's contents. Items are immutable once published.
+type l1Item struct {
+	key   string
+	entry *cacheEntry
+	gen   uint64
+}
+
 // CacheConfig holds cache configuration.
 type CacheConfig struct {
 	Enabled    bool
 	TTL        time.Duration
 	MaxEntries int
+	L1Size     int // L1 tier entries; 0 uses DefaultL1Size, negative disables L1
 }
 
 // NewDecisionCache creates a new decision cache.
@@ -47,8 +69,12 @@ func NewDecisionCache(cfg CacheConfig) *DecisionCache {
 	if cfg.MaxEntries == 0 {
 		cfg.MaxEntries = 10000
 	}
+	if cfg.L1Size == 0 {
+		cfg.L1Size = DefaultL1Size
+	}
 
 	c := &DecisionCache{
+		l1:         newL1(cfg.L1Size),
 		l2Cache:    make(map[string]*cacheEntry),
 		l2TTL:      cfg.TTL,
 		maxEntries: cfg.MaxEntries,
@@ -69,17 +95,25 @@ func (c *DecisionCache) Get(key string) (*PolicyDecision, bool, string) {
 		return nil, false, ""
 	}
 
+	// Check L1 cache
+	gen := c.gen.Load()
+	if decision, ok := c.l1Get(key, gen); ok {
+		c.l1Hits.Add(1)
+		return decision, true, "L1"
+	}
+
 	// Check L2 cache
 	c.l2Mu.RLock()
 	entry, ok := c.l2Cache[key]
 	c.l2Mu.RUnlock()
 
 	if ok && time.Now().Before(entry.expiresAt) {
-		c.l2Hits++
+		c.l2Hits.Add(1)
+		c.l1Put(key, entry, gen)
 		return entry.decision, true, "L2"
 	}
 
-	c.misses++
+	c.misses.Add(1)
 	return nil, false, ""
 }
 
@@ -97,10 +131,14 @@ func (c *DecisionCache) Set(key string, decision *PolicyDecision) {
 		c.evictOldest()
 	}
 
-	c.l2Cache[key] = &cacheEntry{
+	entry := &cacheEntry{
 		decision:  decision,
 		expiresAt: time.Now().Add(c.l2TTL),
 	}
+	c.l2Cache[key] = entry
+
+	// Keep a stale copy from being served by L1
+	c.l1Refresh(key, entry, c.gen.Load())
 }
 
 // Invalidate removes all cached entries (e.g., on policy reload).
@@ -109,14 +147,87 @@ func (c *DecisionCache) Invalidate() {
 		return
 	}
 
+	// Bumping the generation under the lock orders it against any Get that
+	// could still see the old L2 entries
 	c.l2Mu.Lock()
 	c.l2Cache = make(map[string]*cacheEntry)
+	c.gen.Add(1)
 	c.l2Mu.Unlock()
+
+	for i := range c.l1 {
+		c.l1[i].Store(nil)
+	}
+}
+
+// newL1 creates the L1 tier, or nil if size is negative.
+func newL1(size int) []atomic.Pointer[l1Item] {
+	if size < 0 {
+		return nil
+	}
+	return make([]atomic.Pointer[l1Item], size)
+}
+
+// l1Slot returns the slot for key. The L1 tier is direct-mapped: each key
+// has exactly one slot and a newer promotion replaces whatever was there.
+func (c *DecisionCache) l1Slot(key string) *atomic.Pointer[l1Item] {
+	// FNV-1a, inlined to avoid allocating a hash.Hash on the hot path
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &c.l1[h%uint32(len(c.l1))]
+}
+
+// l1Get looks up key in the L1 tier, ignoring items from before gen.
+func (c *DecisionCache) l1Get(key string, gen uint64) (*PolicyDecision, bool) {
+	if len(c.l1) == 0 {
+		return nil, false
+	}
+
+	item := c.l1Slot(key).Load()
+	if item == nil || item.key != key || item.gen != gen || !time.Now().Before(item.entry.expiresAt) {
+		return nil, false
+	}
+	return item.entry.decision, true
+}
+
+// l1Put promotes an L2 entry read in generation gen into the L1 tier.
+func (c *DecisionCache) l1Put(key string, entry *cacheEntry, gen uint64) {
+	if len(c.l1) == 0 {
+		return
+	}
+	c.l1Slot(key).Store(&l1Item{key: key, entry: entry, gen: gen})
+}
+
+// l1Refresh replaces the L1 entry for key if one is present.
+func (c *DecisionCache) l1Refresh(key string, entry *cacheEntry, gen uint64) {
+	if len(c.l1) == 0 {
+		return
+	}
+
+	slot := c.l1Slot(key)
+	if item := slot.Load(); item != nil && item.key == key {
+		slot.CompareAndSwap(item, &l1Item{key: key, entry: entry, gen: gen})
+	}
+}
+
+// l1Delete removes the L1 entry for key if one is present.
+func (c *DecisionCache) l1Delete(key string) {
+	if len(c.l1) == 0 {
+		return
+	}
+
+	slot := c.l1Slot(key)
+	if item := slot.Load(); item != nil && item.key == key {
+		slot.CompareAndSwap(item, nil)
+	}
 }
 
 // ComputeKey generates a cache key from the policy input.
-// Key format: agent_id:tool:capabilities_hash
-func (c *DecisionCache) ComputeKey(input *PolicyInput) string {
+// Key format: agent_id:tool:resource_uri:prompt:source_ip:verified:did:capabilities_hash[:keyed_hash]
+// keyed_hash covers the values of keyed, and is left out if keyed is empty.
+func (c *DecisionCache) ComputeKey(input *PolicyInput, keyed ...keyedInput) string {
 	// Sort capabilities for consistent hashing
 	caps := make([]string, len(input.Agent.Capabilities))
 	copy(caps, input.Agent.Capabilities)
@@ -124,7 +235,23 @@ func (c *DecisionCache) ComputeKey(input *PolicyInput) string {
 
 	capsHash := hashString(strings.Join(caps, ","))
 
-	return input.Agent.ID + ":" + input.Request.Tool + ":" + capsHash[:8]
+	key := input.Agent.ID + ":" + input.Request.Tool + ":" + input.Request.ResourceURI + ":" + input.Request.Prompt + ":" +
+		input.Context.SourceIP + ":" + strconv.FormatBool(input.Identity.Verified) + ":" + input.Identity.DID + ":" + capsHash[:8]
+	if len(keyed) == 0 {
+		return key
+	}
+
+	// Encoding the values together keeps adjacent fields from running into
+	// each other; maps are encoded with sorted keys
+	values := make([]interface{}, len(keyed))
+	for i, k := range keyed {
+		values[i] = k.value(input)
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		encoded = []byte(fmt.Sprintf("%#v", values))
+	}
+	return key + ":" + hashString(string(encoded))[:16]
 }
 
 // Stats returns cache statistics.
@@ -133,30 +260,41 @@ func (c *DecisionCache) Stats() CacheStats {
 	entries := len(c.l2Cache)
 	c.l2Mu.RUnlock()
 
-	total := c.l1Hits + c.l2Hits + c.misses
+	gen := c.gen.Load()
+	l1Entries := 0
+	for i := range c.l1 {
+		if item := c.l1[i].Load(); item != nil && item.gen == gen {
+			l1Entries++
+		}
+	}
+
+	l1Hits, l2Hits, misses := c.l1Hits.Load(), c.l2Hits.Load(), c.misses.Load()
+	total := l1Hits + l2Hits + misses
 	hitRate := float64(0)
 	if total > 0 {
-		hitRate = float64(c.l1Hits+c.l2Hits) / float64(total)
+		hitRate = float64(l1Hits+l2Hits) / float64(total)
 	}
 
 	return CacheStats{
-		L1Hits:  c.l1Hits,
-		L2Hits:  c.l2Hits,
-		Misses:  c.misses,
-		Entries: entries,
-		HitRate: hitRate,
-		Evicted: c.evicted,
+		L1Hits:    l1Hits,
+		L2Hits:    l2Hits,
+		Misses:    misses,
+		Entries:   entries,
+		L1Entries: l1Entries,
+		HitRate:   hitRate,
+		Evicted:   c.evicted.Load(),
 	}
 }
 
 // CacheStats contains cache performance statistics.
 type CacheStats struct {
-	L1Hits  int64
-	L2Hits  int64
-	Misses  int64
-	Entries int
-	HitRate float64
-	Evicted int64
+	L1Hits    int64   `json:"l1_hits"`
+	L2Hits    int64   `json:"l2_hits"`
+	Misses    int64   `json:"misses"`
+	Entries   int     `json:"entries"`
+	L1Entries int     `json:"l1_entries"`
+	HitRate   float64 `json:"hit_rate"`
+	Evicted   int64   `json:"evicted"`
 }
 
 // evictOldest removes the oldest entries to make room.
@@ -165,8 +303,7 @@ func (c *DecisionCache) evictOldest() {
 	now := time.Now()
 	for key, entry := range c.l2Cache {
 		if now.After(entry.expiresAt) {
-			delete(c.l2Cache, key)
-			c.evicted++
+			c.evictLocked(key)
 		}
 	}
 
@@ -175,8 +312,7 @@ func (c *DecisionCache) evictOldest() {
 		toRemove := c.maxEntries / 10
 		removed := 0
 		for key := range c.l2Cache {
-			delete(c.l2Cache, key)
-			c.evicted++
+			c.evictLocked(key)
 			removed++
 			if removed >= toRemove {
 				break
@@ -203,12 +339,18 @@ func (c *DecisionCache) cleanup() {
 	now := time.Now()
 	for key, entry := range c.l2Cache {
 		if now.After(entry.expiresAt) {
-			delete(c.l2Cache, key)
-			c.evicted++
+			c.evictLocked(key)
 		}
 	}
 }
 
+// evictLocked removes key from both tiers. c.l2Mu must be held.
+func (c *DecisionCache) evictLocked(key string) {
+	delete(c.l2Cache, key)
+	c.l1Delete(key)
+	c.evicted.Add(1)
+}
+
 // hashString returns a SHA256 hash of the input string.
 func hashString(s string) string {
 	h := sha256.Sum256([]byte(s))
@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCacheL1Promotion tests that L2 hits are promoted to the L1 tier.
+func TestCacheL1Promotion(t *testing.T) {
+	cache := NewDecisionCache(CacheConfig{Enabled: true, TTL: time.Minute})
+
+	cache.Set("key", &PolicyDecision{Allow: true, MatchedRule: "first"})
+
+	tiers := []string{"L2", "L1", "L1"}
+	for i, want := range tiers {
+		decision, ok, tier := cache.Get("key")
+		if !ok {
+			t.Fatalf("Get() #%d missed", i+1)
+		}
+		if tier != want {
+			t.Errorf("Get() #%d tier = %s, want %s", i+1, tier, want)
+		}
+		if decision.MatchedRule != "first" {
+			t.Errorf("MatchedRule = %s, want first", decision.MatchedRule)
+		}
+	}
+
+	// Overwriting a promoted key must not leave a stale L1 copy
+	cache.Set("key", &PolicyDecision{Allow: false, MatchedRule: "second"})
+	decision, _, tier := cache.Get("key")
+	if tier != "L1" || decision.MatchedRule != "second" {
+		t.Errorf("Get() after Set = (%s, %s), want (L1, second)", tier, decision.MatchedRule)
+	}
+
+	stats := cache.Stats()
+	if stats.L1Hits != 3 || stats.L2Hits != 1 {
+		t.Errorf("L1Hits = %d, L2Hits = %d, want 3 and 1", stats.L1Hits, stats.L2Hits)
+	}
+	if stats.L1Entries != 1 {
+		t.Errorf("L1Entries = %d, want 1", stats.L1Entries)
+	}
+
+	// Invalidation clears both tiers
+	cache.Invalidate()
+	if _, ok, _ := cache.Get("key"); ok {
+		t.Error("Get() after Invalidate() should miss")
+	}
+}
+
+// TestCacheL1Eviction tests that the L1 tier stays within its configured size.
+func TestCacheL1Eviction(t *testing.T) {
+	tests := []struct {
+		name        string
+		l1Size      int
+		wantEntries int
+	}{
+		{"small", 4, 4},
+		{"sharded", 64, 64},
+		{"disabled", -1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewDecisionCache(CacheConfig{Enabled: true, TTL: time.Minute, L1Size: tt.l1Size})
+
+			// Promote many more keys than L1 can hold
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key-%d", i)
+				cache.Set(key, &PolicyDecision{Allow: true})
+				cache.Get(key)
+			}
+
+			stats := cache.Stats()
+			if stats.L1Entries != tt.wantEntries {
+				t.Errorf("L1Entries = %d, want %d", stats.L1Entries, tt.wantEntries)
+			}
+			if stats.Entries != 1000 {
+				t.Errorf("Entries = %d, want 1000", stats.Entries)
+			}
+
+			// The most recently promoted key is still served from L1
+			if _, _, tier := cache.Get("key-999"); tt.l1Size > 0 && tier != "L1" {
+				t.Errorf("Most recent key tier = %s, want L1", tier)
+			}
+		})
+	}
+}
+
+// BenchmarkCacheL1Hit measures lookups served by the L1 tier.
+func BenchmarkCacheL1Hit(b *testing.B) {
+	cache := NewDecisionCache(CacheConfig{Enabled: true, TTL: time.Hour})
+	cache.Set("agent1:read_file::abcdef12", &PolicyDecision{Allow: true})
+	cache.Get("agent1:read_file::abcdef12") // promote
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cache.Get("agent1:read_file::abcdef12")
+		}
+	})
+}
+
+// BenchmarkCacheL2Hit measures lookups served by the L2 tier.
+func BenchmarkCacheL2Hit(b *testing.B) {
+	cache := NewDecisionCache(CacheConfig{Enabled: true, TTL: time.Hour, L1Size: -1})
+	cache.Set("agent1:read_file::abcdef12", &PolicyDecision{Allow: true})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cache.Get("agent1:read_file::abcdef12")
+		}
+	})
+}
+
+// TestCacheL1StalePromotion tests that an entry read from L2 before an
+// Invalidate is not served from L1 after it, even if promoted afterwards.
+func TestCacheL1StalePromotion(t *testing.T) {
+	cache := NewDecisionCache(CacheConfig{Enabled: true, TTL: time.Minute})
+	cache.Set("key", &PolicyDecision{Allow: true})
+
+	// A Get that read the L2 entry, then lost the race with Invalidate
+	gen := cache.gen.Load()
+	cache.l2Mu.RLock()
+	entry := cache.l2Cache["key"]
+	cache.l2Mu.RUnlock()
+	cache.Invalidate()
+	cache.l1Put("key", entry, gen)
+
+	if _, ok, tier := cache.Get("key"); ok {
+		t.Errorf("Get() after Invalidate() hit %s, want a miss", tier)
+	}
+	if n := cache.Stats().L1Entries; n != 0 {
+		t.Errorf("L1Entries = %d, want 0", n)
+	}
+}
+
+// TestCacheEvictionClearsL1 tests that entries evicted from L2 to make room
+// are no longer served from L1.
+func TestCacheEvictionClearsL1(t *testing.T) {
+	cache := NewDecisionCache(CacheConfig{Enabled: true, TTL: time.Minute, MaxEntries: 10})
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		cache.Set(key, &PolicyDecision{Allow: true})
+		cache.Get(key) // Promote to L1
+	}
+	cache.Set("key10", &PolicyDecision{Allow: true})
+
+	stats := cache.Stats()
+	if stats.Evicted != 1 {
+		t.Fatalf("Evicted = %d, want 1", stats.Evicted)
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		cache.l2Mu.RLock()
+		_, inL2 := cache.l2Cache[key]
+		cache.l2Mu.RUnlock()
+		if _, ok, tier := cache.Get(key); ok != inL2 {
+			t.Errorf("Get(%s) hit = %v (%s), want %v", key, ok, tier, inL2)
+		}
+	}
+}
+
+// TestCacheConcurrentInvalidate exercises Get, Set, Invalidate and Stats
+// together; run with -race. Once the last Invalidate returns, nothing set
+// before it may be served.
+func TestCacheConcurrentInvalidate(t *testing.T) {
+	cache := NewDecisionCache(CacheConfig{Enabled: true, TTL: time.Minute, MaxEntries: 50, L1Size: 16})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key%d", (w*7+i)%64)
+				cache.Set(key, &PolicyDecision{Allow: true})
+				cache.Get(key)
+				if i%100 == 0 {
+					cache.Invalidate()
+					cache.Stats()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	cache.Invalidate()
+	for i := 0; i < 64; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if _, ok, tier := cache.Get(key); ok {
+			t.Errorf("Get(%s) after Invalidate() hit %s", key, tier)
+		}
+	}
+}
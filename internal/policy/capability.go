@@ -0,0 +1,217 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/glob"
+)
+
+// ErrNoPolicyData is returned when a CapabilityMatcher evaluates a request
+// before its policy data has been set.
+var ErrNoPolicyData = errors.New("policy data not loaded")
+
+// CapabilityMatcher is a PolicyBackend that decides requests in Go, with no
+// Rego to compile. It applies the same rules as the bundled capability.rego
+// and blocklist.rego: blocked tools, agents and verified DIDs and resources
+// matching a blocked_resources glob are denied, tools without a required
+// capability are allowed, and "read:*" or "*" grant by wildcard. Rate
+// limits are left to the router.
+type CapabilityMatcher struct {
+	data *PolicyData
+	mode string // "enforce" or "audit"
+	mu   sync.RWMutex
+
+	// blockedResources holds data.BlockedResources compiled with "/" as
+	// the separator, as glob.match is called in blocklist.rego
+	blockedResources []glob.Glob
+
+	// decisionLog records sampled decisions, if set
+	decisionLog *DecisionLogger
+}
+
+// NewCapabilityMatcher creates a capability matcher in the given mode. It
+// is not ready until SetData is called.
+func NewCapabilityMatcher(mode string) *CapabilityMatcher {
+	if mode == "" {
+		mode = "enforce"
+	}
+	return &CapabilityMatcher{mode: mode}
+}
+
+// SetData replaces the policy data. Keys the matcher doesn't use are
+// ignored.
+func (m *CapabilityMatcher) SetData(data map[string]interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode policy data: %w", err)
+	}
+
+	var pd PolicyData
+	if err := json.Unmarshal(raw, &pd); err != nil {
+		return fmt.Errorf("failed to parse policy data: %w", err)
+	}
+
+	blockedResources := make([]glob.Glob, len(pd.BlockedResources))
+	for i, pattern := range pd.BlockedResources {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return fmt.Errorf("invalid blocked_resources pattern %q: %w", pattern, err)
+		}
+		blockedResources[i] = g
+	}
+
+	m.mu.Lock()
+	m.data = &pd
+	m.blockedResources = blockedResources
+	m.mu.Unlock()
+	return nil
+}
+
+// SetDecisionLogger sets the logger that evaluated decisions are recorded
+// to. Set it before evaluating requests.
+func (m *CapabilityMatcher) SetDecisionLogger(l *DecisionLogger) {
+	m.decisionLog = l
+}
+
+// IsReady returns true once policy data has been set.
+func (m *CapabilityMatcher) IsReady() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.data != nil
+}
+
+// Mode returns the current policy mode.
+func (m *CapabilityMatcher) Mode() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.mode
+}
+
+// SetMode switches between "enforce" and "audit".
+func (m *CapabilityMatcher) SetMode(mode string) error {
+	if mode != "enforce" && mode != "audit" {
+		return fmt.Errorf("invalid policy mode: %s (must be enforce or audit)", mode)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mode = mode
+	return nil
+}
+
+// Evaluate decides input against the blocklists and tool_capabilities.
+func (m *CapabilityMatcher) Evaluate(ctx context.Context, input *PolicyInput) (*EvaluationResult, error) {
+	result, err := m.evaluate(input)
+	if err != nil {
+		return nil, err
+	}
+	if m.decisionLog != nil {
+		m.decisionLog.Log(result)
+	}
+	return result, nil
+}
+
+// Simulate decides each input like Evaluate, without logging the
+// decisions.
+func (m *CapabilityMatcher) Simulate(ctx context.Context, inputs []*PolicyInput) []*EvaluationResult {
+	results := make([]*EvaluationResult, len(inputs))
+	for i, input := range inputs {
+		result, err := m.evaluate(input)
+		if err != nil {
+			result = &EvaluationResult{Input: input, PolicyMode: m.Mode(), Err: err}
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// evaluate decides input against the current data.
+func (m *CapabilityMatcher) evaluate(input *PolicyInput) (*EvaluationResult, error) {
+	start := time.Now()
+
+	m.mu.RLock()
+	data, mode, blockedResources := m.data, m.mode, m.blockedResources
+	m.mu.RUnlock()
+
+	if data == nil {
+		return nil, ErrNoPolicyData
+	}
+
+	result := &EvaluationResult{
+		Input:      input,
+		PolicyMode: mode,
+		Decision:   matchCapability(data, blockedResources, input),
+	}
+	result.EvalTime = time.Since(start)
+	return result, nil
+}
+
+// matchCapability decides input against data, with blockedResources the
+// compiled data.BlockedResources. Like main.rego, it reports every failed
+// check in FiredRules and the first of blocked and missing_capability as
+// the MatchedRule.
+func matchCapability(data *PolicyData, blockedResources []glob.Glob, input *PolicyInput) *PolicyDecision {
+	decision := &PolicyDecision{}
+
+	blocked := func(detail, message string) {
+		decision.Violations = append(decision.Violations, Violation{
+			Category: CategoryBlocklist,
+			Message:  message,
+			Detail:   detail,
+		})
+	}
+	if tool := input.Request.Tool; slices.Contains(data.BlockedTools, tool) {
+		blocked(tool, fmt.Sprintf("Tool '%s' is blocked by policy", tool))
+	}
+	if uri := input.Request.ResourceURI; uri != "" && slices.ContainsFunc(blockedResources, func(g glob.Glob) bool { return g.Match(uri) }) {
+		blocked(uri, fmt.Sprintf("Resource '%s' is blocked by policy", uri))
+	}
+	if agent := input.Agent.ID; slices.Contains(data.BlockedAgents, agent) {
+		blocked(agent, fmt.Sprintf("Agent '%s' is blocked by policy", agent))
+	}
+	if did := input.Identity.DID; input.Identity.Verified && slices.Contains(data.BlockedDIDs, did) {
+		blocked(did, fmt.Sprintf("DID '%s' is blocked by policy", did))
+	}
+	if len(decision.Violations) > 0 {
+		decision.FiredRules = append(decision.FiredRules, "blocked")
+	}
+
+	if required, ok := data.ToolCapabilities[input.Request.Tool]; ok && !hasCapability(input.Agent.Capabilities, required) {
+		decision.FiredRules = append(decision.FiredRules, "missing_capability")
+		decision.Violations = append(decision.Violations, Violation{
+			Category: CategoryCapability,
+			Message: fmt.Sprintf("Agent '%s' lacks capability '%s' required for tool '%s'",
+				input.Agent.ID, required, input.Request.Tool),
+			Detail: required,
+		})
+	}
+
+	if len(decision.FiredRules) == 0 {
+		decision.Allow = true
+		decision.MatchedRule = "allowed"
+	} else {
+		decision.MatchedRule = decision.FiredRules[0]
+	}
+	return decision
+}
+
+// hasCapability reports whether any granted capability covers required,
+// exactly, by a "prefix:*" wildcard, or by "*".
+func hasCapability(granted []string, required string) bool {
+	for _, g := range granted {
+		switch {
+		case g == required, g == "*":
+			return true
+		case strings.HasSuffix(g, ":*") && strings.HasPrefix(required, strings.TrimSuffix(g, "*")):
+			return true
+		}
+	}
+	return false
+}
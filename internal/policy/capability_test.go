@@ -0,0 +1,288 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestCapabilityMatcher tests the capability backend against
+// tool_capabilities, including wildcard grants.
+func TestCapabilityMatcher(t *testing.T) {
+	ctx := context.Background()
+	matcher := NewCapabilityMatcher("enforce")
+
+	if matcher.IsReady() {
+		t.Error("IsReady() = true before SetData")
+	}
+	input := NewInputBuilder().WithRequest("tools/call", "customer_lookup", nil).Build()
+	if _, err := matcher.Evaluate(ctx, input); !errors.Is(err, ErrNoPolicyData) {
+		t.Fatalf("Evaluate() before SetData error = %v, want ErrNoPolicyData", err)
+	}
+
+	err := matcher.SetData(map[string]interface{}{
+		"tool_capabilities": map[string]interface{}{
+			"customer_lookup": "read:customers",
+			"delete_customer": "admin:customers",
+		},
+		"rate_limits": map[string]interface{}{"default": 1000},
+	})
+	if err != nil {
+		t.Fatalf("SetData() error = %v", err)
+	}
+	if !matcher.IsReady() {
+		t.Error("IsReady() = false after SetData")
+	}
+
+	tests := []struct {
+		name         string
+		capabilities []string
+		tool         string
+		wantAllow    bool
+	}{
+		{"exact match", []string{"read:customers"}, "customer_lookup", true},
+		{"wildcard match", []string{"read:*"}, "customer_lookup", true},
+		{"super admin", []string{"*"}, "delete_customer", true},
+		{"wildcard for another action", []string{"read:*"}, "delete_customer", false},
+		{"no capabilities", nil, "customer_lookup", false},
+		{"unmapped tool", nil, "weather", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := NewInputBuilder().
+				WithAgent("test-agent", "Test Agent", tt.capabilities).
+				WithRequest("tools/call", tt.tool, nil).
+				Build()
+
+			result, err := matcher.Evaluate(ctx, input)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if result.Decision.Allow != tt.wantAllow {
+				t.Errorf("Allow = %v, want %v", result.Decision.Allow, tt.wantAllow)
+			}
+			if result.PolicyMode != "enforce" {
+				t.Errorf("PolicyMode = %s, want enforce", result.PolicyMode)
+			}
+			if !tt.wantAllow {
+				if result.Decision.MatchedRule != "missing_capability" {
+					t.Errorf("MatchedRule = %s, want missing_capability", result.Decision.MatchedRule)
+				}
+				if len(result.Decision.Violations) != 1 || result.Decision.Violations[0].Category != CategoryCapability {
+					t.Errorf("Violations = %+v, want one capability violation", result.Decision.Violations)
+				}
+			}
+		})
+	}
+}
+
+// TestCapabilityMatcherPolicyTests runs the cases of policies/
+// capability_test.rego against the capability matcher. The rate limit cases
+// are left out; the router enforces rate limits for every backend.
+func TestCapabilityMatcherPolicyTests(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		agentID      string
+		capabilities []string
+		tool         string
+		did          string // verified if set
+		resource     string
+		data         PolicyData
+		wantAllow    bool
+		wantRule     string
+		wantCategory string
+	}{
+		{
+			name:         "allow exact capability match",
+			agentID:      "test-agent",
+			capabilities: []string{"read:customers"},
+			tool:         "customer_lookup",
+			data:         PolicyData{ToolCapabilities: map[string]string{"customer_lookup": "read:customers"}},
+			wantAllow:    true,
+			wantRule:     "allowed",
+		},
+		{
+			name:         "allow wildcard capability match",
+			agentID:      "test-agent",
+			capabilities: []string{"read:*"},
+			tool:         "customer_lookup",
+			data:         PolicyData{ToolCapabilities: map[string]string{"customer_lookup": "read:customers"}},
+			wantAllow:    true,
+			wantRule:     "allowed",
+		},
+		{
+			name:         "allow super admin wildcard",
+			agentID:      "test-agent",
+			capabilities: []string{"*"},
+			tool:         "database_drop",
+			data:         PolicyData{ToolCapabilities: map[string]string{"database_drop": "admin:database"}},
+			wantAllow:    true,
+			wantRule:     "allowed",
+		},
+		{
+			name:         "deny missing capability",
+			agentID:      "test-agent",
+			capabilities: []string{"read:orders"},
+			tool:         "customer_lookup",
+			data:         PolicyData{ToolCapabilities: map[string]string{"customer_lookup": "read:customers"}},
+			wantRule:     "missing_capability",
+			wantCategory: CategoryCapability,
+		},
+		{
+			name:         "deny blocked agent",
+			agentID:      "blocked-agent",
+			capabilities: []string{"read:customers"},
+			tool:         "customer_lookup",
+			data: PolicyData{
+				ToolCapabilities: map[string]string{"customer_lookup": "read:customers"},
+				BlockedAgents:    []string{"blocked-agent"},
+			},
+			wantRule:     "blocked",
+			wantCategory: CategoryBlocklist,
+		},
+		{
+			name:         "deny blocked tool",
+			agentID:      "test-agent",
+			capabilities: []string{"admin:*"},
+			tool:         "database_drop",
+			data: PolicyData{
+				ToolCapabilities: map[string]string{"database_drop": "admin:database"},
+				BlockedTools:     []string{"database_drop"},
+			},
+			wantRule:     "blocked",
+			wantCategory: CategoryBlocklist,
+		},
+		{
+			name:      "allow unmapped tool",
+			agentID:   "test-agent",
+			tool:      "unknown_tool",
+			data:      PolicyData{ToolCapabilities: map[string]string{}},
+			wantAllow: true,
+			wantRule:  "allowed",
+		},
+		{
+			name:         "deny blocked DID",
+			agentID:      "test-agent",
+			capabilities: []string{"read:customers"},
+			tool:         "customer_lookup",
+			did:          "did:key:z6MkBadActor",
+			data: PolicyData{
+				ToolCapabilities: map[string]string{"customer_lookup": "read:customers"},
+				BlockedDIDs:      []string{"did:key:z6MkBadActor"},
+			},
+			wantRule:     "blocked",
+			wantCategory: CategoryBlocklist,
+		},
+		{
+			name:         "deny blocked resource",
+			agentID:      "test-agent",
+			resource:     "file:///etc/ssh/sshd_config",
+			data:         PolicyData{BlockedResources: []string{"file:///etc/**"}},
+			wantRule:     "blocked",
+			wantCategory: CategoryBlocklist,
+		},
+		{
+			name:      "allow resource below a single-segment pattern",
+			agentID:   "test-agent",
+			resource:  "file:///etc/ssh/sshd_config",
+			data:      PolicyData{BlockedResources: []string{"file:///etc/*"}},
+			wantAllow: true,
+			wantRule:  "allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := PolicyDataFromStruct(&tt.data)
+			if err != nil {
+				t.Fatalf("PolicyDataFromStruct() error = %v", err)
+			}
+			matcher := NewCapabilityMatcher("enforce")
+			if err := matcher.SetData(data); err != nil {
+				t.Fatalf("SetData() error = %v", err)
+			}
+
+			input := NewInputBuilder().
+				WithAgent(tt.agentID, tt.agentID, tt.capabilities).
+				WithRequest("tools/call", tt.tool, nil).
+				WithIdentity(tt.did != "", tt.did).
+				WithResource(tt.resource).
+				Build()
+
+			result, err := matcher.Evaluate(ctx, input)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			decision := result.Decision
+			if decision.Allow != tt.wantAllow {
+				t.Errorf("Allow = %v, want %v", decision.Allow, tt.wantAllow)
+			}
+			if decision.MatchedRule != tt.wantRule {
+				t.Errorf("MatchedRule = %s, want %s", decision.MatchedRule, tt.wantRule)
+			}
+			if tt.wantAllow {
+				if len(decision.Violations) != 0 {
+					t.Errorf("Violations = %+v, want none", decision.Violations)
+				}
+				return
+			}
+			if len(decision.Violations) != 1 || decision.Violations[0].Category != tt.wantCategory {
+				t.Errorf("Violations = %+v, want one %s violation", decision.Violations, tt.wantCategory)
+			}
+		})
+	}
+}
+
+// TestCapabilityMatcherDecisionLogAndTests tests that the matcher records
+// its decisions in the decision log and runs policy test cases, without
+// logging simulated ones.
+func TestCapabilityMatcherDecisionLogAndTests(t *testing.T) {
+	ctx := context.Background()
+	matcher := NewCapabilityMatcher("enforce")
+	if err := matcher.SetData(map[string]interface{}{
+		"tool_capabilities": map[string]interface{}{"delete_customer": "admin:customers"},
+	}); err != nil {
+		t.Fatalf("SetData() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	logger := NewDecisionLogger(NewJSONDecisionSink(&out), DecisionLoggerConfig{})
+	matcher.SetDecisionLogger(logger)
+
+	denied := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", []string{"read:*"}).
+		WithRequest("tools/call", "delete_customer", nil).
+		Build()
+	if _, err := matcher.Evaluate(ctx, denied); err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+
+	report := RunTestCases(ctx, matcher, []TestCase{
+		{Name: "denied", Input: *denied, Expect: "deny", MatchedRule: "missing_capability"},
+		{Name: "wrong expectation", Input: *denied, Expect: "allow"},
+	})
+	if report.Passed != 1 || report.Failed != 1 {
+		t.Errorf("RunTestCases() passed %d, failed %d, want 1 and 1", report.Passed, report.Failed)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	var entries []DecisionLogEntry
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var entry DecisionLogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("decoding decision log: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 1 || entries[0].Result == nil || entries[0].Result.MatchedRule != "missing_capability" {
+		t.Errorf("decision log = %+v, want the one evaluated denial", entries)
+	}
+}
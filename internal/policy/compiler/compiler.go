@@ -88,6 +88,24 @@ func (c *Compiler) Compile(def *PolicyDefinition) (*CompileResult, error) {
 		result.Warnings = append(result.Warnings, warnings...)
 	}
 
+	if rules, ok := grouped[RuleTypeTimeWindow]; ok {
+		content, warnings, err := CompileTimeWindowRules(rules, def.Name)
+		if err != nil {
+			return nil, fmt.Errorf("compile time window rules: %w", err)
+		}
+		moduleBuilder.WriteString(content)
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+
+	if rules, ok := grouped[RuleTypeIPRange]; ok {
+		content, warnings, err := CompileIPRangeRules(rules, def.Name)
+		if err != nil {
+			return nil, fmt.Errorf("compile ip range rules: %w", err)
+		}
+		moduleBuilder.WriteString(content)
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+
 	if rules, ok := grouped[RuleTypeCustom]; ok {
 		content, warnings, err := CompileCustomRules(rules, def.Name)
 		if err != nil {
@@ -1,8 +1,11 @@
 package compiler
 
 import (
+	"context"
 	"strings"
 	"testing"
+
+	"github.com/open-policy-agent/opa/rego"
 )
 
 func TestCompileCapabilityRule(t *testing.T) {
@@ -182,6 +185,111 @@ func TestCompileCustomRule(t *testing.T) {
 	}
 }
 
+// TestCompileStructuredViolations tests that each rule type reports its
+// violations as objects with a category, the rule's message and the rule ID.
+func TestCompileStructuredViolations(t *testing.T) {
+	tests := []struct {
+		name         string
+		rule         RuleDefinition
+		input        map[string]interface{}
+		wantCategory string
+	}{
+		{
+			name: "capability",
+			rule: RuleDefinition{
+				ID:         "require-read",
+				Type:       RuleTypeCapability,
+				Conditions: map[string]interface{}{"tool": "customer_lookup", "requires_capability": "read:customers"},
+				Action:     ActionDeny,
+				Message:    "Missing capability",
+			},
+			input: map[string]interface{}{
+				"request": map[string]interface{}{"tool": "customer_lookup"},
+				"agent":   map[string]interface{}{"capabilities": []interface{}{"read:orders"}},
+			},
+			wantCategory: "capability",
+		},
+		{
+			name: "blocklist",
+			rule: RuleDefinition{
+				ID:         "block-tools",
+				Type:       RuleTypeBlocklist,
+				Conditions: map[string]interface{}{"match_type": "tool", "values": []interface{}{"shell_exec"}},
+				Action:     ActionDeny,
+				Message:    "Tool is blocked",
+			},
+			input:        map[string]interface{}{"request": map[string]interface{}{"tool": "shell_exec"}},
+			wantCategory: "blocklist",
+		},
+		{
+			name: "rate limit",
+			rule: RuleDefinition{
+				ID:         "agent-limit",
+				Type:       RuleTypeRateLimit,
+				Conditions: map[string]interface{}{"limit": float64(10), "window": "session"},
+				Action:     ActionDeny,
+				Message:    "Rate limit exceeded",
+			},
+			input: map[string]interface{}{
+				"agent":   map[string]interface{}{"id": "agent1"},
+				"session": map[string]interface{}{"request_count": 10},
+			},
+			wantCategory: "rate_limit",
+		},
+		{
+			name: "custom",
+			rule: RuleDefinition{
+				ID:         "no-delete",
+				Type:       RuleTypeCustom,
+				Conditions: map[string]interface{}{"tool_in": []interface{}{"delete_file"}},
+				Action:     ActionDeny,
+				Message:    "Deletes are not allowed",
+			},
+			input:        map[string]interface{}{"request": map[string]interface{}{"tool": "delete_file"}},
+			wantCategory: "custom",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			def := &PolicyDefinition{Version: "1.0", Name: "test-structured", Rules: []RuleDefinition{tc.rule}}
+			result, err := NewCompiler().Compile(def)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			module := result.Modules["json_test_structured.rego"]
+
+			rs, err := rego.New(
+				rego.Query("data.mcp.policy.violations"),
+				rego.Module("json_test_structured.rego", module),
+				rego.Input(tc.input),
+			).Eval(context.Background())
+			if err != nil {
+				t.Fatalf("Eval() error = %v\n%s", err, module)
+			}
+			if len(rs) == 0 {
+				t.Fatalf("no violations\n%s", module)
+			}
+			violations, _ := rs[0].Expressions[0].Value.([]interface{})
+			if len(violations) != 1 {
+				t.Fatalf("violations = %v, want one\n%s", rs[0].Expressions[0].Value, module)
+			}
+
+			violation, _ := violations[0].(map[string]interface{})
+			want := map[string]interface{}{
+				"category": tc.wantCategory,
+				"message":  tc.rule.Message,
+				"detail":   sanitizeRuleID(tc.rule.ID),
+			}
+			for key, value := range want {
+				if violation[key] != value {
+					t.Errorf("violation[%q] = %v, want %v", key, violation[key], value)
+				}
+			}
+		})
+	}
+}
+
 func TestValidationErrors(t *testing.T) {
 	compiler := NewCompiler()
 
@@ -249,6 +357,105 @@ func TestValidationErrors(t *testing.T) {
 			},
 			err: "must be one of: tool, agent, did",
 		},
+		{
+			name: "time_window end before start",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeTimeWindow, Conditions: map[string]interface{}{"start": "17:00", "end": "09:00"}},
+				},
+			},
+			err: "'end' must be after 'start'",
+		},
+		{
+			name: "time_window malformed time",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeTimeWindow, Conditions: map[string]interface{}{"start": "9am", "end": "17:00"}},
+				},
+			},
+			err: "HH:MM format",
+		},
+		{
+			name: "time_window missing end",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeTimeWindow, Conditions: map[string]interface{}{"start": "09:00"}},
+				},
+			},
+			err: "requires 'end' condition",
+		},
+		{
+			name: "time_window unknown day",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeTimeWindow, Conditions: map[string]interface{}{"start": "09:00", "end": "17:00", "days": []interface{}{"funday"}}},
+				},
+			},
+			err: "unknown day",
+		},
+		{
+			name: "time_window unknown timezone",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeTimeWindow, Conditions: map[string]interface{}{"start": "09:00", "end": "17:00", "timezone": "Mars/Olympus"}},
+				},
+			},
+			err: "not a known time zone",
+		},
+		{
+			name: "ip_range invalid CIDR",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeIPRange, Conditions: map[string]interface{}{"allowed_cidrs": []interface{}{"10.0.0.0/33"}}},
+				},
+			},
+			err: "invalid CIDR: 10.0.0.0/33",
+		},
+		{
+			name: "ip_range without CIDRs",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeIPRange, Conditions: map[string]interface{}{"tools": []interface{}{"deploy"}}},
+				},
+			},
+			err: "requires 'allowed_cidrs' or 'blocked_cidrs'",
+		},
+		{
+			name: "field_any invalid operator",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeCustom, Conditions: map[string]interface{}{"field_any": "request.arguments.tags", "op": "like", "value": "x"}},
+				},
+			},
+			err: "invalid operator: like",
+		},
+		{
+			name: "field_any invalid path",
+			def: &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test",
+				Rules: []RuleDefinition{
+					{ID: "r1", Type: RuleTypeCustom, Conditions: map[string]interface{}{"field_any": "request[0]", "op": "eq", "value": "x"}},
+				},
+			},
+			err: "'field_any' must be a field path",
+		},
 	}
 
 	for _, tc := range tests {
@@ -347,3 +554,299 @@ func TestSanitizeRuleID(t *testing.T) {
 		})
 	}
 }
+
+// TestCompileAnyExpression tests that 'any' compiles to a disjunction: a rule
+// whose alternatives are mutually exclusive matches when either one holds.
+func TestCompileAnyExpression(t *testing.T) {
+	def := &PolicyDefinition{
+		Version: "1.0",
+		Name:    "test-any",
+		Rules: []RuleDefinition{
+			{
+				ID:   "either-tool",
+				Type: RuleTypeCustom,
+				Conditions: map[string]interface{}{
+					"all": []interface{}{
+						map[string]interface{}{
+							"any": []interface{}{
+								map[string]interface{}{"tool_in": []interface{}{"tool_a"}},
+								map[string]interface{}{
+									"any": []interface{}{
+										map[string]interface{}{"tool_in": []interface{}{"tool_b"}},
+										map[string]interface{}{"tool_in": []interface{}{"tool_c"}},
+									},
+								},
+							},
+						},
+						map[string]interface{}{"agent.id": "agent1"},
+					},
+				},
+				Action:  ActionDeny,
+				Message: "Tool denied",
+			},
+		},
+	}
+
+	result, err := NewCompiler().Compile(def)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	module := result.Modules["json_test_any.rego"]
+
+	query, err := rego.New(
+		rego.Query("data.mcp.policy.either_tool_match"),
+		rego.Module("json_test_any.rego", module),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		t.Fatalf("generated Rego does not compile: %v\n%s", err, module)
+	}
+
+	tests := []struct {
+		tool    string
+		agent   string
+		matches bool
+	}{
+		{"tool_a", "agent1", true},
+		{"tool_b", "agent1", true},
+		{"tool_c", "agent1", true},
+		{"tool_d", "agent1", false},
+		{"tool_a", "agent2", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.tool+"/"+tc.agent, func(t *testing.T) {
+			input := map[string]interface{}{
+				"agent":   map[string]interface{}{"id": tc.agent},
+				"request": map[string]interface{}{"tool": tc.tool},
+			}
+			rs, err := query.Eval(context.Background(), rego.EvalInput(input))
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			matched := len(rs) > 0 && rs[0].Expressions[0].Value == true
+			if matched != tc.matches {
+				t.Errorf("match = %v, want %v\n%s", matched, tc.matches, module)
+			}
+		})
+	}
+}
+
+// TestCompileTimeWindowRule tests that a time_window rule only allows its
+// tools during the window.
+func TestCompileTimeWindowRule(t *testing.T) {
+	def := &PolicyDefinition{
+		Version: "1.0",
+		Name:    "test-hours",
+		Rules: []RuleDefinition{
+			{
+				ID:   "business-hours",
+				Type: RuleTypeTimeWindow,
+				Conditions: map[string]interface{}{
+					"tools": []interface{}{"deploy"},
+					"days":  []interface{}{"mon", "tue", "wed", "thu", "fri"},
+					"start": "09:00",
+					"end":   "17:00",
+				},
+				Action:  ActionAllow,
+				Message: "deploy is only allowed during business hours",
+			},
+		},
+	}
+
+	result, err := NewCompiler().Compile(def)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	module := result.Modules["json_test_hours.rego"]
+	if !strings.Contains(module, "input.context.timestamp") {
+		t.Errorf("generated Rego should use input.context.timestamp, got:\n%s", module)
+	}
+
+	query, err := rego.New(
+		rego.Query("data.mcp.policy.violations"),
+		rego.Module("json_test_hours.rego", module),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		t.Fatalf("generated Rego does not compile: %v\n%s", err, module)
+	}
+
+	tests := []struct {
+		name      string
+		tool      string
+		timestamp string
+		denied    bool
+	}{
+		{"weekday inside window", "deploy", "2025-06-11T10:30:00Z", false},
+		{"weekday at start", "deploy", "2025-06-11T09:00:00Z", false},
+		{"weekday at end", "deploy", "2025-06-11T17:00:00Z", true},
+		{"weekday before window", "deploy", "2025-06-11T08:59:00Z", true},
+		{"weekend inside hours", "deploy", "2025-06-14T10:30:00Z", true},
+		{"other tool outside window", "read_file", "2025-06-14T22:00:00Z", false},
+		{"offset timestamp", "deploy", "2025-06-11T12:30:00+02:00", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			input := map[string]interface{}{
+				"request": map[string]interface{}{"tool": tc.tool},
+				"context": map[string]interface{}{"timestamp": tc.timestamp},
+			}
+			rs, err := query.Eval(context.Background(), rego.EvalInput(input))
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			// The violations set evaluates to an array of violation objects
+			var violations []interface{}
+			if len(rs) > 0 {
+				violations, _ = rs[0].Expressions[0].Value.([]interface{})
+			}
+			if denied := len(violations) > 0; denied != tc.denied {
+				t.Errorf("denied = %v (violations %v), want %v", denied, violations, tc.denied)
+			}
+		})
+	}
+}
+
+// TestCompileIPRangeRule tests allow and block lists of source IP ranges.
+func TestCompileIPRangeRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions map[string]interface{}
+		sourceIP   string
+		denied     bool
+	}{
+		{"allowed inside range", map[string]interface{}{"allowed_cidrs": []interface{}{"10.0.0.0/8", "192.168.1.0/24"}}, "192.168.1.20", false},
+		{"allowed outside range", map[string]interface{}{"allowed_cidrs": []interface{}{"10.0.0.0/8", "192.168.1.0/24"}}, "203.0.113.5", true},
+		{"allowed without source IP", map[string]interface{}{"allowed_cidrs": []interface{}{"10.0.0.0/8"}}, "", true},
+		{"allowed IPv6", map[string]interface{}{"allowed_cidrs": []interface{}{"2001:db8::/32"}}, "2001:db8::1", false},
+		{"blocked inside range", map[string]interface{}{"blocked_cidrs": []interface{}{"203.0.113.0/24"}}, "203.0.113.5", true},
+		{"blocked outside range", map[string]interface{}{"blocked_cidrs": []interface{}{"203.0.113.0/24"}}, "10.1.2.3", false},
+		{"other tool", map[string]interface{}{"tools": []interface{}{"deploy"}, "blocked_cidrs": []interface{}{"0.0.0.0/0"}}, "10.1.2.3", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			def := &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test-ip",
+				Rules: []RuleDefinition{
+					{ID: "office-only", Type: RuleTypeIPRange, Conditions: tc.conditions, Action: ActionDeny},
+				},
+			}
+
+			result, err := NewCompiler().Compile(def)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			module := result.Modules["json_test_ip.rego"]
+
+			input := map[string]interface{}{
+				"request": map[string]interface{}{"tool": "read_file"},
+				"context": map[string]interface{}{"source_ip": tc.sourceIP},
+			}
+			rs, err := rego.New(
+				rego.Query("data.mcp.policy.violations"),
+				rego.Module("json_test_ip.rego", module),
+				rego.Input(input),
+			).Eval(context.Background())
+			if err != nil {
+				t.Fatalf("Eval() error = %v\n%s", err, module)
+			}
+
+			var violations []interface{}
+			if len(rs) > 0 {
+				violations, _ = rs[0].Expressions[0].Value.([]interface{})
+			}
+			if denied := len(violations) > 0; denied != tc.denied {
+				t.Errorf("denied = %v, want %v\n%s", denied, tc.denied, module)
+			}
+		})
+	}
+}
+
+// TestCompileFieldAny tests that field_any matches when any element of an
+// array field satisfies the operator.
+func TestCompileFieldAny(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    map[string]interface{}
+		tags    []interface{}
+		matches bool
+	}{
+		{
+			name:    "equals matching element",
+			expr:    map[string]interface{}{"field_any": "request.arguments.tags", "op": "eq", "value": "pii"},
+			tags:    []interface{}{"public", "pii"},
+			matches: true,
+		},
+		{
+			name:    "equals no matching element",
+			expr:    map[string]interface{}{"field_any": "request.arguments.tags", "op": "eq", "value": "pii"},
+			tags:    []interface{}{"public", "internal"},
+			matches: false,
+		},
+		{
+			name:    "empty array",
+			expr:    map[string]interface{}{"field_any": "request.arguments.tags", "op": "eq", "value": "pii"},
+			tags:    []interface{}{},
+			matches: false,
+		},
+		{
+			name:    "startswith",
+			expr:    map[string]interface{}{"field_any": "request.arguments.tags", "op": "startswith", "value": "secret:"},
+			tags:    []interface{}{"public", "secret:keys"},
+			matches: true,
+		},
+		{
+			name:    "not_in",
+			expr:    map[string]interface{}{"field_any": "request.arguments.tags", "op": "not_in", "value": []interface{}{"public", "internal"}},
+			tags:    []interface{}{"public", "internal"},
+			matches: false,
+		},
+		{
+			name: "negated",
+			expr: map[string]interface{}{"not": map[string]interface{}{
+				"field_any": "request.arguments.tags", "op": "eq", "value": "pii",
+			}},
+			tags:    []interface{}{"public"},
+			matches: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			def := &PolicyDefinition{
+				Version: "1.0",
+				Name:    "test-tags",
+				Rules: []RuleDefinition{
+					{ID: "tagged", Type: RuleTypeCustom, Conditions: tc.expr, Action: ActionDeny, Message: "tagged"},
+				},
+			}
+
+			result, err := NewCompiler().Compile(def)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			module := result.Modules["json_test_tags.rego"]
+
+			input := map[string]interface{}{
+				"request": map[string]interface{}{
+					"arguments": map[string]interface{}{"tags": tc.tags},
+				},
+			}
+			rs, err := rego.New(
+				rego.Query("data.mcp.policy.tagged_match"),
+				rego.Module("json_test_tags.rego", module),
+				rego.Input(input),
+			).Eval(context.Background())
+			if err != nil {
+				t.Fatalf("Eval() error = %v\n%s", err, module)
+			}
+
+			matched := len(rs) > 0 && rs[0].Expressions[0].Value == true
+			if matched != tc.matches {
+				t.Errorf("match = %v, want %v\n%s", matched, tc.matches, module)
+			}
+		})
+	}
+}
@@ -18,7 +18,8 @@ func CompileCustomRules(rules []RuleDefinition, policyName string) (string, []st
 		}
 
 		// Compile conditions to Rego
-		conditions, err := exprCompiler.Compile(rule.Conditions)
+		ruleID := sanitizeRuleID(rule.ID)
+		conditions, helpers, err := exprCompiler.CompileRule(ruleID, rule.Conditions)
 		if err != nil {
 			return "", nil, fmt.Errorf("rule %s: %w", rule.ID, err)
 		}
@@ -34,9 +35,10 @@ func CompileCustomRules(rules []RuleDefinition, policyName string) (string, []st
 		}
 
 		data := CustomData{
-			RuleID:      sanitizeRuleID(rule.ID),
+			RuleID:      ruleID,
 			Description: description,
 			Conditions:  conditions,
+			Helpers:     helpers,
 			Action:      rule.Action,
 			Message:     message,
 		}
@@ -9,18 +9,43 @@ import (
 // ExpressionCompiler compiles JSON expressions to Rego code.
 type ExpressionCompiler struct {
 	indent int
+
+	// Helper rules generated for 'any' expressions, named after prefix
+	prefix  string
+	helpers []string
 }
 
 // NewExpressionCompiler creates a new expression compiler.
 func NewExpressionCompiler() *ExpressionCompiler {
-	return &ExpressionCompiler{indent: 1}
+	return &ExpressionCompiler{indent: 1, prefix: "expr"}
 }
 
-// Compile compiles a condition expression to Rego code.
+// Compile compiles a condition expression to Rego code. Any helper rules the
+// expression needs are available from Helpers afterwards.
 func (ec *ExpressionCompiler) Compile(expr map[string]interface{}) (string, error) {
+	ec.helpers = nil
 	return ec.compileExpr(expr, ec.indent)
 }
 
+// CompileRule compiles the conditions of a rule, returning the rule body and
+// the helper rules it references. Helper rules are named after ruleID so
+// that rules in one module do not collide.
+func (ec *ExpressionCompiler) CompileRule(ruleID string, expr map[string]interface{}) (string, string, error) {
+	ec.prefix = ruleID
+	defer func() { ec.prefix = "expr" }()
+
+	conditions, err := ec.Compile(expr)
+	if err != nil {
+		return "", "", err
+	}
+	return conditions, ec.Helpers(), nil
+}
+
+// Helpers returns the helper rules generated by the last Compile.
+func (ec *ExpressionCompiler) Helpers() string {
+	return strings.Join(ec.helpers, "\n")
+}
+
 func (ec *ExpressionCompiler) compileExpr(expr map[string]interface{}, indent int) (string, error) {
 	indentStr := strings.Repeat("    ", indent)
 
@@ -66,6 +91,11 @@ func (ec *ExpressionCompiler) compileExpr(expr map[string]interface{}, indent in
 		return ec.compileFieldMatches(fieldMatches, indent)
 	}
 
+	// Array quantifier: some element of the field satisfies the operator
+	if field, ok := expr["field_any"]; ok {
+		return ec.compileFieldAny(field, expr, indent)
+	}
+
 	// Field operation with explicit operator
 	if field, ok := expr["field"]; ok {
 		return ec.compileFieldOp(field.(string), expr, indent)
@@ -103,47 +133,38 @@ func (ec *ExpressionCompiler) compileAll(all interface{}, indent int) (string, e
 	return strings.Join(conditions, "\n"), nil
 }
 
+// compileAny compiles a disjunction. Conditions on consecutive lines of a
+// Rego body are ANDed, so each alternative becomes its own body of a helper
+// rule; the helper is true when any one of them holds.
 func (ec *ExpressionCompiler) compileAny(any interface{}, indent int) (string, error) {
 	items, ok := any.([]interface{})
 	if !ok {
 		return "", fmt.Errorf("'any' must be an array")
 	}
+	if len(items) == 0 {
+		return "", fmt.Errorf("'any' must not be empty")
+	}
 
-	indentStr := strings.Repeat("    ", indent)
-	var conditions []string
+	name := fmt.Sprintf("%s_any_%d", ec.prefix, len(ec.helpers)+1)
+	// Reserve the name before compiling, so nested helpers number after it
+	slot := len(ec.helpers)
+	ec.helpers = append(ec.helpers, "")
+
+	var builder strings.Builder
 	for i, item := range items {
 		itemMap, ok := item.(map[string]interface{})
 		if !ok {
 			return "", fmt.Errorf("any[%d] must be an object", i)
 		}
-		cond, err := ec.compileExpr(itemMap, indent+1)
+		cond, err := ec.compileExpr(itemMap, 1)
 		if err != nil {
 			return "", fmt.Errorf("any[%d]: %w", i, err)
 		}
-		conditions = append(conditions, cond)
-	}
-
-	// OPA any: use helper rule or comprehension
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("%s# any of the following\n", indentStr))
-	builder.WriteString(fmt.Sprintf("%s{\n", indentStr))
-	for _, cond := range conditions {
-		builder.WriteString(fmt.Sprintf("%s    %s\n", indentStr, strings.TrimSpace(cond)))
+		builder.WriteString(fmt.Sprintf("%s if {\n%s\n}\n", name, cond))
 	}
-	builder.WriteString(fmt.Sprintf("%s} | {\n", indentStr))
-	// Close with alternative syntax for OPA
-	builder.WriteString(fmt.Sprintf("%s    true\n", indentStr))
-	builder.WriteString(fmt.Sprintf("%s}", indentStr))
+	ec.helpers[slot] = builder.String()
 
-	// Actually, let's use a simpler approach with helper rules
-	// For now, just OR them together
-	var orConditions []string
-	for _, cond := range conditions {
-		orConditions = append(orConditions, fmt.Sprintf("(%s)", strings.TrimSpace(cond)))
-	}
-
-	return fmt.Sprintf("%s# any: one of the following must be true\n%s%s",
-		indentStr, indentStr, strings.Join(orConditions, fmt.Sprintf("\n%s", indentStr))), nil
+	return strings.Repeat("    ", indent) + name, nil
 }
 
 func (ec *ExpressionCompiler) compileNot(not interface{}, indent int) (string, error) {
@@ -220,48 +241,77 @@ func (ec *ExpressionCompiler) compileFieldMatches(fieldMatches interface{}, inde
 
 func (ec *ExpressionCompiler) compileFieldOp(field string, expr map[string]interface{}, indent int) (string, error) {
 	indentStr := strings.Repeat("    ", indent)
-	regoPath := fieldPathToRego(field)
 
 	op, ok := expr["op"].(string)
 	if !ok {
 		return "", fmt.Errorf("'op' is required for field operations")
 	}
 
-	value := expr["value"]
+	cond, err := compileOp(fieldPathToRego(field), Operator(op), expr["value"])
+	if err != nil {
+		return "", err
+	}
+	return indentStr + cond, nil
+}
+
+// compileFieldAny compiles an array quantifier, true when some element of
+// the array at the field path satisfies the operator. It compiles to a
+// single comprehension so that it can also be negated.
+func (ec *ExpressionCompiler) compileFieldAny(field interface{}, expr map[string]interface{}, indent int) (string, error) {
+	indentStr := strings.Repeat("    ", indent)
+
+	path, ok := field.(string)
+	if !ok || !isFieldPath(path) {
+		return "", fmt.Errorf("'field_any' must be a field path")
+	}
+
+	op, ok := expr["op"].(string)
+	if !ok {
+		return "", fmt.Errorf("'op' is required for field_any")
+	}
+
+	cond, err := compileOp("elem", Operator(op), expr["value"])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%scount([elem | some elem in %s; %s]) > 0", indentStr, fieldPathToRego(path), cond), nil
+}
 
-	switch Operator(op) {
+// compileOp compiles a comparison of the Rego term against value.
+func compileOp(term string, op Operator, value interface{}) (string, error) {
+	switch op {
 	case OpEquals:
-		return fmt.Sprintf("%s%s == %s", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("%s == %s", term, valueToRego(value)), nil
 	case OpNotEquals:
-		return fmt.Sprintf("%s%s != %s", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("%s != %s", term, valueToRego(value)), nil
 	case OpGreaterThan:
-		return fmt.Sprintf("%s%s > %s", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("%s > %s", term, valueToRego(value)), nil
 	case OpGreaterEq:
-		return fmt.Sprintf("%s%s >= %s", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("%s >= %s", term, valueToRego(value)), nil
 	case OpLessThan:
-		return fmt.Sprintf("%s%s < %s", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("%s < %s", term, valueToRego(value)), nil
 	case OpLessEq:
-		return fmt.Sprintf("%s%s <= %s", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("%s <= %s", term, valueToRego(value)), nil
 	case OpContains:
-		return fmt.Sprintf("%scontains(%s, %s)", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("contains(%s, %s)", term, valueToRego(value)), nil
 	case OpStartsWith:
-		return fmt.Sprintf("%sstartswith(%s, %s)", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("startswith(%s, %s)", term, valueToRego(value)), nil
 	case OpEndsWith:
-		return fmt.Sprintf("%sendswith(%s, %s)", indentStr, regoPath, valueToRego(value)), nil
+		return fmt.Sprintf("endswith(%s, %s)", term, valueToRego(value)), nil
 	case OpMatches:
-		return fmt.Sprintf("%sregex.match(%s, %s)", indentStr, valueToRego(value), regoPath), nil
+		return fmt.Sprintf("regex.match(%s, %s)", valueToRego(value), term), nil
 	case OpIn:
 		values, err := toStringSlice(value)
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("%s%s in %s", indentStr, regoPath, quoteSlice(values)), nil
+		return fmt.Sprintf("%s in %s", term, quoteSlice(values)), nil
 	case OpNotIn:
 		values, err := toStringSlice(value)
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("%snot %s in %s", indentStr, regoPath, quoteSlice(values)), nil
+		return fmt.Sprintf("not %s in %s", term, quoteSlice(values)), nil
 	default:
 		return "", fmt.Errorf("unknown operator: %s", op)
 	}
@@ -317,7 +367,7 @@ func isFieldPath(s string) bool {
 	// Skip known keywords
 	keywords := map[string]bool{
 		"all": true, "any": true, "not": true,
-		"field": true, "op": true, "value": true,
+		"field": true, "op": true, "value": true, "field_any": true,
 		"field_equals": true, "field_in": true, "field_matches": true,
 		"tool_in": true, "agent_in": true,
 	}
@@ -0,0 +1,88 @@
+package compiler
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CompileIPRangeRules compiles IP range rules to Rego.
+func CompileIPRangeRules(rules []RuleDefinition, policyName string) (string, []string, error) {
+	var warnings []string
+	var builder strings.Builder
+
+	for _, rule := range rules {
+		if !rule.IsEnabled() {
+			continue
+		}
+
+		allowed, blocked, err := parseCIDRLists(rule.Conditions)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+
+		var tools []string
+		if raw, ok := rule.Conditions["tools"]; ok {
+			if tools, err = toStringSlice(raw); err != nil {
+				return "", nil, fmt.Errorf("rule %s: 'tools': %w", rule.ID, err)
+			}
+		}
+
+		message := rule.Message
+		if message == "" {
+			message = "Source IP is not permitted by policy"
+		}
+
+		data := IPRangeData{
+			RuleID:  sanitizeRuleID(rule.ID),
+			Tools:   tools,
+			Allowed: allowed,
+			Blocked: blocked,
+			Message: message,
+		}
+
+		rendered, err := RenderIPRange(data)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+
+		builder.WriteString(rendered)
+		builder.WriteString("\n")
+	}
+
+	return builder.String(), warnings, nil
+}
+
+// parseCIDRLists reads the allowed_cidrs and blocked_cidrs conditions,
+// checking the CIDR syntax of each entry. At least one list is required.
+func parseCIDRLists(conditions map[string]interface{}) ([]string, []string, error) {
+	allowed, err := parseCIDRs(conditions, "allowed_cidrs")
+	if err != nil {
+		return nil, nil, err
+	}
+	blocked, err := parseCIDRs(conditions, "blocked_cidrs")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(allowed) == 0 && len(blocked) == 0 {
+		return nil, nil, fmt.Errorf("ip_range rule requires 'allowed_cidrs' or 'blocked_cidrs' condition")
+	}
+	return allowed, blocked, nil
+}
+
+func parseCIDRs(conditions map[string]interface{}, key string) ([]string, error) {
+	raw, ok := conditions[key]
+	if !ok {
+		return nil, nil
+	}
+	cidrs, err := toStringSlice(raw)
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %w", key, err)
+	}
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("'%s' contains an invalid CIDR: %s", key, cidr)
+		}
+	}
+	return cidrs, nil
+}
@@ -38,6 +38,8 @@ const (
 	RuleTypeBlocklist  RuleType = "blocklist"
 	RuleTypeRateLimit  RuleType = "rate_limit"
 	RuleTypeCustom     RuleType = "custom"
+	RuleTypeTimeWindow RuleType = "time_window"
+	RuleTypeIPRange    RuleType = "ip_range"
 )
 
 // Action defines the policy action.
@@ -74,6 +76,25 @@ type RateLimitConditions struct {
 	Window       string `json:"window,omitempty"` // session, minute, hour
 }
 
+// TimeWindowConditions represents conditions for time window rules. With
+// action allow, the tools may only be called inside the window; with deny,
+// they may not be called inside it.
+type TimeWindowConditions struct {
+	Tools    []string `json:"tools,omitempty"`    // Empty applies to every tool
+	Days     []string `json:"days,omitempty"`     // mon..sun or full names; empty means every day
+	Start    string   `json:"start"`              // HH:MM, inclusive
+	End      string   `json:"end"`                // HH:MM, exclusive; 24:00 for midnight
+	Timezone string   `json:"timezone,omitempty"` // IANA name, default UTC
+}
+
+// IPRangeConditions represents conditions for IP range rules, matched
+// against the client's source IP.
+type IPRangeConditions struct {
+	Tools        []string `json:"tools,omitempty"`         // Empty applies to every tool
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"` // Deny sources outside these ranges
+	BlockedCIDRs []string `json:"blocked_cidrs,omitempty"` // Deny sources inside these ranges
+}
+
 // Expression represents a condition expression for custom rules.
 type Expression struct {
 	// Logical operators
@@ -81,10 +102,12 @@ type Expression struct {
 	Any []Expression `json:"any,omitempty"`
 	Not *Expression  `json:"not,omitempty"`
 
-	// Field operations
-	Field string      `json:"field,omitempty"`
-	Op    Operator    `json:"op,omitempty"`
-	Value interface{} `json:"value,omitempty"`
+	// Field operations. FieldAny applies Op to each element of an array
+	// field and holds when any element matches.
+	Field    string      `json:"field,omitempty"`
+	FieldAny string      `json:"field_any,omitempty"`
+	Op       Operator    `json:"op,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
 
 	// Shorthand conditions
 	FieldEquals  map[string]interface{} `json:"field_equals,omitempty"`
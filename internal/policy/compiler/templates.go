@@ -22,6 +22,8 @@ func init() {
 	template.Must(templates.New("blocklist").Parse(blocklistTemplate))
 	template.Must(templates.New("ratelimit").Parse(rateLimitTemplate))
 	template.Must(templates.New("custom").Parse(customTemplate))
+	template.Must(templates.New("timewindow").Parse(timeWindowTemplate))
+	template.Must(templates.New("iprange").Parse(ipRangeTemplate))
 }
 
 func quoteString(s string) string {
@@ -73,10 +75,10 @@ const capabilityTemplate = `
     capability_matches(cap, required)
 }
 
-violations[msg] if {
+violations contains violation if {
     input.request.tool == {{quote .Tool}}
     not {{.RuleID}}_check
-    msg := {{quote .Message}}
+    violation := {"category": "capability", "message": {{quote .Message}}, "detail": {{quote .RuleID}}}
 }
 `
 
@@ -92,9 +94,9 @@ blocked if {
     {{.RuleID}}_blocked
 }
 
-violations[msg] if {
+violations contains violation if {
     {{.RuleID}}_blocked
-    msg := {{quote .Message}}
+    violation := {"category": "blocklist", "message": {{quote .Message}}, "detail": {{quote .RuleID}}}
 }
 `
 
@@ -111,9 +113,9 @@ rate_limit_ok if {
     not {{.RuleID}}_exceeded
 }
 
-violations[msg] if {
+violations contains violation if {
     {{.RuleID}}_exceeded
-    msg := {{quote .Message}}
+    violation := {"category": "rate_limit", "message": {{quote .Message}}, "detail": {{quote .RuleID}}}
 }
 `
 
@@ -124,11 +126,13 @@ const customTemplate = `
 {{.RuleID}}_match if {
 {{.Conditions}}
 }
+{{if .Helpers}}
+{{.Helpers}}{{end}}
 
 {{if eq .Action "deny"}}
-violations[msg] if {
+violations contains violation if {
     {{.RuleID}}_match
-    msg := {{quote .Message}}
+    violation := {"category": "custom", "message": {{quote .Message}}, "detail": {{quote .RuleID}}}
 }
 {{else}}
 allow if {
@@ -137,6 +141,64 @@ allow if {
 {{end}}
 `
 
+const timeWindowTemplate = `
+# Rule: {{.RuleID}} (time_window)
+# {{if eq .Action "deny"}}Denied{{else}}Only allowed{{end}} during {{.Window}}{{if .Days}} on {{join ", " .Days}}{{end}}
+
+{{.RuleID}}_applies if {
+    {{if .Tools}}input.request.tool in {{quoteSlice .Tools}}{{else}}true{{end}}
+}
+
+{{.RuleID}}_in_window if {
+    ns := time.parse_rfc3339_ns(input.context.timestamp)
+    {{if .Days}}time.weekday([ns, {{quote .Timezone}}]) in {{quoteSlice .Days}}
+    {{end}}clock := time.clock([ns, {{quote .Timezone}}])
+    minutes := (clock[0] * 60) + clock[1]
+    minutes >= {{.Start}}
+    minutes < {{.End}}
+}
+
+violations contains violation if {
+    {{.RuleID}}_applies
+    {{if ne .Action "deny"}}not {{end}}{{.RuleID}}_in_window
+    violation := {"category": "time_window", "message": {{quote .Message}}, "detail": {{quote .RuleID}}}
+}
+`
+
+const ipRangeTemplate = `
+# Rule: {{.RuleID}} (ip_range)
+{{- if .Allowed}}
+# Allowed: {{join ", " .Allowed}}{{end}}
+{{- if .Blocked}}
+# Blocked: {{join ", " .Blocked}}{{end}}
+
+{{.RuleID}}_applies if {
+    {{if .Tools}}input.request.tool in {{quoteSlice .Tools}}{{else}}true{{end}}
+}
+{{if .Allowed}}
+{{.RuleID}}_allowed if {
+    some cidr in {{quoteSlice .Allowed}}
+    net.cidr_contains(cidr, input.context.source_ip)
+}
+
+violations contains violation if {
+    {{.RuleID}}_applies
+    not {{.RuleID}}_allowed
+    violation := {"category": "ip_range", "message": {{quote .Message}}, "detail": {{quote .RuleID}}}
+}
+{{end}}{{if .Blocked}}
+{{.RuleID}}_blocked if {
+    some cidr in {{quoteSlice .Blocked}}
+    net.cidr_contains(cidr, input.context.source_ip)
+}
+
+violations contains violation if {
+    {{.RuleID}}_applies
+    {{.RuleID}}_blocked
+    violation := {"category": "ip_range", "message": {{quote .Message}}, "detail": {{quote .RuleID}}}
+}
+{{end}}`
+
 // TemplateData provides data for template rendering.
 type TemplateData struct {
 	PolicyName  string
@@ -175,10 +237,33 @@ type CustomData struct {
 	RuleID      string
 	Description string
 	Conditions  string
+	Helpers     string // Helper rules referenced by Conditions
 	Action      Action
 	Message     string
 }
 
+// TimeWindowData provides data for time window rule templates.
+type TimeWindowData struct {
+	RuleID   string
+	Tools    []string // Empty applies the rule to every tool
+	Days     []string // Weekday names; empty means every day
+	Start    int      // Minutes since midnight, inclusive
+	End      int      // Minutes since midnight, exclusive
+	Timezone string
+	Window   string // Human-readable window for comments
+	Action   Action
+	Message  string
+}
+
+// IPRangeData provides data for IP range rule templates.
+type IPRangeData struct {
+	RuleID  string
+	Tools   []string // Empty applies the rule to every tool
+	Allowed []string // Source IPs must be in one of these CIDRs
+	Blocked []string // Source IPs must not be in any of these CIDRs
+	Message string
+}
+
 // RenderHeader renders the Rego file header.
 func RenderHeader(data TemplateData) (string, error) {
 	var buf bytes.Buffer
@@ -223,3 +308,21 @@ func RenderCustom(data CustomData) (string, error) {
 	}
 	return buf.String(), nil
 }
+
+// RenderTimeWindow renders a time window rule.
+func RenderTimeWindow(data TimeWindowData) (string, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "timewindow", data); err != nil {
+		return "", fmt.Errorf("render timewindow: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// RenderIPRange renders an IP range rule.
+func RenderIPRange(data IPRangeData) (string, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "iprange", data); err != nil {
+		return "", fmt.Errorf("render iprange: %w", err)
+	}
+	return buf.String(), nil
+}
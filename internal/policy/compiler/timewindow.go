@@ -0,0 +1,146 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekdays maps accepted day names to the names time.weekday returns in Rego.
+var weekdays = map[string]string{
+	"mon": "Monday", "monday": "Monday",
+	"tue": "Tuesday", "tuesday": "Tuesday",
+	"wed": "Wednesday", "wednesday": "Wednesday",
+	"thu": "Thursday", "thursday": "Thursday",
+	"fri": "Friday", "friday": "Friday",
+	"sat": "Saturday", "saturday": "Saturday",
+	"sun": "Sunday", "sunday": "Sunday",
+}
+
+// CompileTimeWindowRules compiles time window rules to Rego.
+func CompileTimeWindowRules(rules []RuleDefinition, policyName string) (string, []string, error) {
+	var warnings []string
+	var builder strings.Builder
+
+	for _, rule := range rules {
+		if !rule.IsEnabled() {
+			continue
+		}
+
+		start, end, err := parseTimeRange(rule.Conditions)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+
+		var tools []string
+		if raw, ok := rule.Conditions["tools"]; ok {
+			if tools, err = toStringSlice(raw); err != nil {
+				return "", nil, fmt.Errorf("rule %s: 'tools': %w", rule.ID, err)
+			}
+		}
+
+		days, err := parseDays(rule.Conditions)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+
+		timezone := "UTC"
+		if tz, ok := rule.Conditions["timezone"].(string); ok && tz != "" {
+			timezone = tz
+		}
+
+		window := fmt.Sprintf("%s-%s %s", rule.Conditions["start"], rule.Conditions["end"], timezone)
+		message := rule.Message
+		if message == "" {
+			if rule.Action == ActionDeny {
+				message = fmt.Sprintf("Not allowed during %s", window)
+			} else {
+				message = fmt.Sprintf("Only allowed during %s", window)
+			}
+		}
+
+		data := TimeWindowData{
+			RuleID:   sanitizeRuleID(rule.ID),
+			Tools:    tools,
+			Days:     days,
+			Start:    start,
+			End:      end,
+			Timezone: timezone,
+			Window:   window,
+			Action:   rule.Action,
+			Message:  message,
+		}
+
+		rendered, err := RenderTimeWindow(data)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+
+		builder.WriteString(rendered)
+		builder.WriteString("\n")
+	}
+
+	return builder.String(), warnings, nil
+}
+
+// parseTimeRange reads the start and end conditions, returning them as
+// minutes since midnight.
+func parseTimeRange(conditions map[string]interface{}) (int, int, error) {
+	start, err := parseClock(conditions, "start")
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(conditions, "end")
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("'end' must be after 'start'")
+	}
+	return start, end, nil
+}
+
+// parseClock parses an "HH:MM" condition as minutes since midnight. "24:00"
+// is accepted as the end of the day.
+func parseClock(conditions map[string]interface{}, key string) (int, error) {
+	raw, ok := conditions[key]
+	if !ok {
+		return 0, fmt.Errorf("time_window rule requires '%s' condition", key)
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return 0, fmt.Errorf("'%s' must be a string", key)
+	}
+
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' must be a time in HH:MM format: %s", key, s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseDays reads the days condition as Rego weekday names. No days means
+// every day.
+func parseDays(conditions map[string]interface{}) ([]string, error) {
+	raw, ok := conditions["days"]
+	if !ok {
+		return nil, nil
+	}
+	names, err := toStringSlice(raw)
+	if err != nil {
+		return nil, fmt.Errorf("'days': %w", err)
+	}
+
+	days := make([]string, 0, len(names))
+	for _, name := range names {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("'days' contains an unknown day: %s", name)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
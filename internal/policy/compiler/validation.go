@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // Validator validates policy definitions.
@@ -74,6 +75,10 @@ func (v *Validator) validateRule(rule *RuleDefinition, index int) error {
 		return v.validateRateLimitRule(rule)
 	case RuleTypeCustom:
 		return v.validateCustomRule(rule)
+	case RuleTypeTimeWindow:
+		return v.validateTimeWindowRule(rule)
+	case RuleTypeIPRange:
+		return v.validateIPRangeRule(rule)
 	default:
 		return fmt.Errorf("unknown rule type: %s", rule.Type)
 	}
@@ -177,6 +182,48 @@ func (v *Validator) validateRateLimitRule(rule *RuleDefinition) error {
 	return nil
 }
 
+func (v *Validator) validateTimeWindowRule(rule *RuleDefinition) error {
+	if _, _, err := parseTimeRange(rule.Conditions); err != nil {
+		return err
+	}
+
+	if _, err := parseDays(rule.Conditions); err != nil {
+		return err
+	}
+
+	if tools, ok := rule.Conditions["tools"]; ok {
+		if _, err := toStringSlice(tools); err != nil {
+			return fmt.Errorf("'tools': %w", err)
+		}
+	}
+
+	if tz, ok := rule.Conditions["timezone"]; ok {
+		name, ok := tz.(string)
+		if !ok {
+			return fmt.Errorf("'timezone' must be a string")
+		}
+		if _, err := time.LoadLocation(name); err != nil {
+			return fmt.Errorf("'timezone' is not a known time zone: %s", name)
+		}
+	}
+
+	return nil
+}
+
+func (v *Validator) validateIPRangeRule(rule *RuleDefinition) error {
+	if _, _, err := parseCIDRLists(rule.Conditions); err != nil {
+		return err
+	}
+
+	if tools, ok := rule.Conditions["tools"]; ok {
+		if _, err := toStringSlice(tools); err != nil {
+			return fmt.Errorf("'tools': %w", err)
+		}
+	}
+
+	return nil
+}
+
 func (v *Validator) validateCustomRule(rule *RuleDefinition) error {
 	// Custom rules must have at least one condition
 	if len(rule.Conditions) == 0 {
@@ -231,6 +278,21 @@ func (v *Validator) validateExpression(expr map[string]interface{}) error {
 		}
 	}
 
+	// Validate array quantifiers
+	if field, ok := expr["field_any"]; ok {
+		path, ok := field.(string)
+		if !ok || !isFieldPath(path) {
+			return fmt.Errorf("'field_any' must be a field path")
+		}
+		op, ok := expr["op"].(string)
+		if !ok {
+			return fmt.Errorf("'field_any' requires an 'op'")
+		}
+		if !isValidOperator(Operator(op)) {
+			return fmt.Errorf("invalid operator: %s", op)
+		}
+	}
+
 	// Validate field operations
 	if field, ok := expr["field"]; ok {
 		if _, ok := field.(string); !ok {
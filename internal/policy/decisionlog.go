@@ -0,0 +1,264 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// maxDecisionBatch is the most entries handed to a DecisionSink at once.
+const maxDecisionBatch = 100
+
+// DecisionLogEntry is one policy decision as recorded in the decision log:
+// the full input and the decision it produced, so the evaluation can be
+// debugged or replayed against another policy version. Unlike audit records
+// it carries no request outcome.
+type DecisionLogEntry struct {
+	DecisionID string          `json:"decision_id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Mode       string          `json:"mode"`
+	Input      *PolicyInput    `json:"input"`
+	Result     *PolicyDecision `json:"result"`
+	CacheHit   bool            `json:"cache_hit"`
+	EvalTimeMs float64         `json:"eval_time_ms"`
+}
+
+// DecisionSink receives batches of decision log entries from a
+// DecisionLogger's background goroutine.
+type DecisionSink interface {
+	WriteDecisions(entries []*DecisionLogEntry) error
+	Close() error
+}
+
+// DecisionLoggerConfig holds configuration for a decision logger.
+type DecisionLoggerConfig struct {
+	SampleRate int // Log 1 in N allowed decisions; denials are always logged
+	BufferSize int // Entries queued before new ones are dropped
+}
+
+// DecisionLogger records sampled policy decisions to a DecisionSink.
+// Entries are queued and written from a background goroutine, so a slow
+// sink never blocks evaluation; entries that don't fit in the queue, fail
+// to write, or are logged after Close, are dropped.
+type DecisionLogger struct {
+	sink    DecisionSink
+	rate    uint64
+	allowed atomic.Uint64
+
+	queue  chan *DecisionLogEntry
+	onDrop func(n int)
+	wg     sync.WaitGroup
+
+	// closed is set by Close; mu keeps Log from sending on the closed queue
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewDecisionLogger creates a decision logger writing to sink and starts its
+// writer.
+func NewDecisionLogger(sink DecisionSink, cfg DecisionLoggerConfig) *DecisionLogger {
+	if cfg.SampleRate < 1 {
+		cfg.SampleRate = 1
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+
+	l := &DecisionLogger{
+		sink:  sink,
+		rate:  uint64(cfg.SampleRate),
+		queue: make(chan *DecisionLogEntry, cfg.BufferSize),
+	}
+	l.wg.Add(1)
+	go l.writeLoop()
+	return l
+}
+
+// SetOnDrop sets a callback invoked with the number of entries dropped
+// because the queue was full or the sink failed. Set it before logging.
+func (l *DecisionLogger) SetOnDrop(fn func(n int)) {
+	l.onDrop = fn
+}
+
+// Log queues the decision in result if it is sampled. Results without a
+// decision are ignored.
+func (l *DecisionLogger) Log(result *EvaluationResult) {
+	if result == nil || result.Decision == nil || !l.keep(result.Decision) {
+		return
+	}
+
+	entry := &DecisionLogEntry{
+		DecisionID: uuid.New().String(),
+		Timestamp:  time.Now().UTC(),
+		Mode:       result.PolicyMode,
+		Input:      result.Input,
+		Result:     result.Decision,
+		CacheHit:   result.CacheHit,
+		EvalTimeMs: float64(result.EvalTime.Microseconds()) / 1000,
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		l.drop(1)
+		return
+	}
+	select {
+	case l.queue <- entry:
+	default:
+		l.drop(1)
+	}
+}
+
+// keep reports whether a decision is sampled: every denial, and the first
+// of every rate allowed decisions.
+func (l *DecisionLogger) keep(decision *PolicyDecision) bool {
+	if !decision.Allow || len(decision.Violations) > 0 || l.rate == 1 {
+		return true
+	}
+	return (l.allowed.Add(1)-1)%l.rate == 0
+}
+
+// Close writes the entries still queued and closes the sink. Entries logged
+// after Close are dropped.
+func (l *DecisionLogger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	return l.sink.Close()
+}
+
+// writeLoop writes queued entries until the queue is closed, batching
+// whatever has accumulated while the previous batch was written.
+func (l *DecisionLogger) writeLoop() {
+	defer l.wg.Done()
+
+	batch := make([]*DecisionLogEntry, 0, maxDecisionBatch)
+	for entry := range l.queue {
+		batch = append(batch[:0], entry)
+	fill:
+		for len(batch) < maxDecisionBatch {
+			select {
+			case next, ok := <-l.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+
+		if err := l.sink.WriteDecisions(batch); err != nil {
+			log.Warn().Err(err).Int("entries", len(batch)).Msg("Failed to write policy decision log")
+			l.drop(len(batch))
+		}
+	}
+}
+
+func (l *DecisionLogger) drop(n int) {
+	if l.onDrop != nil {
+		l.onDrop(n)
+	}
+}
+
+// JSONDecisionSink writes each entry as one line of JSON.
+type JSONDecisionSink struct {
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// NewJSONDecisionSink creates a sink writing to w. Closing the sink leaves w
+// open.
+func NewJSONDecisionSink(w io.Writer) *JSONDecisionSink {
+	return &JSONDecisionSink{enc: json.NewEncoder(w)}
+}
+
+// NewDecisionFileSink creates a sink appending JSON lines to the file at
+// path, creating it if needed. Closing the sink closes the file.
+func NewDecisionFileSink(path string) (*JSONDecisionSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open decision log file: %w", err)
+	}
+	s := NewJSONDecisionSink(f)
+	s.closer = f
+	return s, nil
+}
+
+// WriteDecisions encodes entries, stopping at the first failure.
+func (s *JSONDecisionSink) WriteDecisions(entries []*DecisionLogEntry) error {
+	for _, entry := range entries {
+		if err := s.enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying file, if the sink opened one.
+func (s *JSONDecisionSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// HTTPDecisionSink posts each batch of entries to a URL as newline-delimited
+// JSON. Failed batches are not retried.
+type HTTPDecisionSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPDecisionSink creates a sink posting to url with the given timeout
+// per batch.
+func NewHTTPDecisionSink(url string, timeout time.Duration) *HTTPDecisionSink {
+	return &HTTPDecisionSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// WriteDecisions posts entries in a single request.
+func (s *HTTPDecisionSink) WriteDecisions(entries []*DecisionLogEntry) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("failed to encode decision log entry: %w", err)
+		}
+	}
+
+	resp, err := s.client.Post(s.url, "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("decision log endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close is a no-op; the sink holds no open connection of its own.
+func (s *HTTPDecisionSink) Close() error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestDecisionLog tests that evaluated decisions are logged with their full
+// input, and that only allowed decisions are sampled.
+func TestDecisionLog(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:    "enforce",
+		Enabled: true,
+	})
+
+	modules := map[string]string{
+		"deny_delete.rego": `
+package mcp.policy
+
+import rego.v1
+
+default decision := {
+	"allow": true,
+	"matched_rule": "allow_all",
+	"violations": []
+}
+
+decision := {
+	"allow": false,
+	"matched_rule": "deny_delete",
+	"violations": ["delete not allowed"]
+} if {
+	input.request.tool == "delete_file"
+}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	logger := NewDecisionLogger(NewJSONDecisionSink(&out), DecisionLoggerConfig{SampleRate: 2})
+	engine.SetDecisionLogger(logger)
+
+	denied := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", []string{"read"}).
+		WithRequest("tools/call", "delete_file", map[string]interface{}{"path": "/etc/passwd"}).
+		WithIdentity(true, "did:example:123").
+		WithEnvironment("10.0.0.1", "production", "us-east-1").
+		Build()
+	if _, err := engine.Evaluate(ctx, denied); err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+
+	// Of four allowed decisions, the first and third are sampled
+	for i := 0; i < 4; i++ {
+		allowed := NewInputBuilder().
+			WithAgent("agent1", "Test Agent", []string{"read"}).
+			WithRequest("tools/call", "read_file", map[string]interface{}{"n": i}).
+			Build()
+		if _, err := engine.Evaluate(ctx, allowed); err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	var entries []DecisionLogEntry
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var entry DecisionLogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("decoding decision log: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("logged %d decisions, want 3", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.DecisionID == "" {
+		t.Error("DecisionID is empty")
+	}
+	if entry.Mode != "enforce" {
+		t.Errorf("Mode = %s, want 'enforce'", entry.Mode)
+	}
+	if entry.Result == nil || entry.Result.Allow || entry.Result.MatchedRule != "deny_delete" {
+		t.Errorf("Result = %+v, want a deny_delete denial", entry.Result)
+	}
+	if entry.Input == nil {
+		t.Fatal("Input is nil")
+	}
+	if entry.Input.Agent.ID != "agent1" || len(entry.Input.Agent.Capabilities) != 1 {
+		t.Errorf("Input.Agent = %+v", entry.Input.Agent)
+	}
+	if entry.Input.Request.Tool != "delete_file" || entry.Input.Request.Arguments["path"] != "/etc/passwd" {
+		t.Errorf("Input.Request = %+v", entry.Input.Request)
+	}
+	if entry.Input.Identity.DID != "did:example:123" {
+		t.Errorf("Input.Identity.DID = %s, want 'did:example:123'", entry.Input.Identity.DID)
+	}
+	if entry.Input.Context.SourceIP != "10.0.0.1" {
+		t.Errorf("Input.Context.SourceIP = %s, want '10.0.0.1'", entry.Input.Context.SourceIP)
+	}
+
+	for i, want := range []float64{0, 2} {
+		got := entries[i+1]
+		if got.Result == nil || !got.Result.Allow {
+			t.Errorf("entry %d Result = %+v, want allowed", i+1, got.Result)
+		}
+		if got.Input == nil || got.Input.Request.Arguments["n"] != want {
+			t.Errorf("entry %d Input = %+v, want argument n = %v", i+1, got.Input, want)
+		}
+	}
+}
+
+// TestDecisionLogAfterClose tests that decisions logged while or after the
+// logger closes are dropped instead of sending on the closed queue.
+func TestDecisionLogAfterClose(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewDecisionLogger(NewJSONDecisionSink(&out), DecisionLoggerConfig{})
+	var dropped atomic.Int64
+	logger.SetOnDrop(func(n int) { dropped.Add(int64(n)) })
+
+	result := &EvaluationResult{Decision: &PolicyDecision{Allow: false}}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				logger.Log(result)
+			}
+		}()
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	wg.Wait()
+
+	before := dropped.Load()
+	logger.Log(result)
+	if got := dropped.Load() - before; got != 1 {
+		t.Errorf("dropped after Close = %d, want 1", got)
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
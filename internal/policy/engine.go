@@ -3,14 +3,26 @@ package policy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/topdown"
 )
 
+// DefaultEvalTimeout is the default upper bound on a single policy evaluation.
+const DefaultEvalTimeout = 100 * time.Millisecond
+
+// ErrEvaluationTimeout is returned when a policy evaluation exceeds the
+// configured timeout.
+var ErrEvaluationTimeout = errors.New("policy evaluation timed out")
+
 // Engine provides policy evaluation using embedded OPA.
 type Engine struct {
 	// Compiled policy query
@@ -27,21 +39,38 @@ type Engine struct {
 	// Decision cache
 	cache *DecisionCache
 
-	// Configuration
-	mode    string // "enforce" or "audit"
-	enabled bool
+	// bypassCache is set while the policies read uncachedInputs
+	bypassCache atomic.Bool
+
+	// keyed holds the keyedInputs the policies read, added to cache keys
+	keyed atomic.Pointer[[]keyedInput]
 
-	// Metrics
-	evaluations   int64
-	evalErrors    int64
-	avgEvalTimeNs int64
+	// onChange is called after policies or policy data change
+	onChange func()
+
+	// decisionLog records sampled decisions, if set
+	decisionLog *DecisionLogger
+
+	// Configuration
+	mode        string // "enforce" or "audit"
+	modeMu      sync.RWMutex
+	enabled     bool
+	evalTimeout time.Duration
+	strict      bool
+
+	// Metrics, updated by concurrent evaluations
+	evaluations   atomic.Int64
+	evalErrors    atomic.Int64
+	avgEvalTimeNs atomic.Int64
 }
 
 // EngineConfig holds configuration for the policy engine.
 type EngineConfig struct {
-	Mode        string // "enforce" or "audit"
-	Enabled     bool
-	CacheConfig CacheConfig
+	Mode                string // "enforce" or "audit"
+	Enabled             bool
+	EvalTimeout         time.Duration // per-evaluation limit; defaults to DefaultEvalTimeout
+	StrictBuiltinErrors bool          // builtin errors fail evaluation instead of being undefined
+	CacheConfig         CacheConfig
 }
 
 // NewEngine creates a new policy engine.
@@ -49,25 +78,93 @@ func NewEngine(cfg EngineConfig) *Engine {
 	if cfg.Mode == "" {
 		cfg.Mode = "enforce"
 	}
+	if cfg.EvalTimeout <= 0 {
+		cfg.EvalTimeout = DefaultEvalTimeout
+	}
 
 	return &Engine{
-		policyData: make(map[string]interface{}),
-		cache:      NewDecisionCache(cfg.CacheConfig),
-		mode:       cfg.Mode,
-		enabled:    cfg.Enabled,
+		policyData:  make(map[string]interface{}),
+		cache:       NewDecisionCache(cfg.CacheConfig),
+		mode:        cfg.Mode,
+		enabled:     cfg.Enabled,
+		evalTimeout: cfg.EvalTimeout,
+		strict:      cfg.StrictBuiltinErrors,
 	}
 }
 
-// LoadPolicies compiles and loads Rego policies.
+// LoadPolicies compiles and loads Rego policies. If compilation fails the
+// previously loaded policies stay active.
 func (e *Engine) LoadPolicies(ctx context.Context, modules map[string]string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	// Store modules for later recompilation
+	prev := e.modules
 	e.modules = modules
 
 	// Compile with current policy data
-	return e.compileWithData(ctx)
+	if err := e.compileWithData(ctx); err != nil {
+		e.modules = prev
+		return err
+	}
+
+	// Cached decisions were made by the old policies
+	e.invalidate()
+	return nil
+}
+
+// LoadPoliciesAndData replaces the policies and policy data together,
+// compiling once. If compilation fails the previous policies and data stay
+// active.
+func (e *Engine) LoadPoliciesAndData(ctx context.Context, modules map[string]string, data map[string]interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	prevModules := e.modules
+	e.modules = modules
+
+	e.dataMu.Lock()
+	prevData := e.policyData
+	e.policyData = data
+	e.dataMu.Unlock()
+
+	if err := e.compileWithData(ctx); err != nil {
+		e.modules = prevModules
+		e.dataMu.Lock()
+		e.policyData = prevData
+		e.dataMu.Unlock()
+		return err
+	}
+
+	e.invalidate()
+	return nil
+}
+
+// SetOnChange sets a callback run after policies or policy data change, for
+// caches outside the engine whose contents depend on them.
+func (e *Engine) SetOnChange(fn func()) {
+	e.onChange = fn
+}
+
+// SetDecisionLogger sets the logger that evaluated decisions are recorded
+// to. Set it before evaluating requests.
+func (e *Engine) SetDecisionLogger(l *DecisionLogger) {
+	e.decisionLog = l
+}
+
+// logDecision records result in the decision log, if one is set.
+func (e *Engine) logDecision(result *EvaluationResult) {
+	if e.decisionLog != nil {
+		e.decisionLog.Log(result)
+	}
+}
+
+// invalidate clears the decision cache and notifies the change callback.
+func (e *Engine) invalidate() {
+	e.cache.Invalidate()
+	if e.onChange != nil {
+		e.onChange()
+	}
 }
 
 // compileWithData compiles policies with the current policy data.
@@ -76,6 +173,7 @@ func (e *Engine) compileWithData(ctx context.Context) error {
 	// Build rego options with all modules
 	opts := []func(*rego.Rego){
 		rego.Query("data.mcp.policy.decision"),
+		rego.StrictBuiltinErrors(e.strict),
 	}
 
 	for name, content := range e.modules {
@@ -98,17 +196,30 @@ func (e *Engine) compileWithData(ctx context.Context) error {
 	}
 
 	e.query = query
+	e.bypassCache.Store(readsInput(e.modules, uncachedInputs...))
+	keyed := keyedInputsRead(e.modules)
+	e.keyed.Store(&keyed)
 	return nil
 }
 
+// cacheKey returns the decision cache key for input, covering the keyed
+// inputs the loaded policies read.
+func (e *Engine) cacheKey(input *PolicyInput) string {
+	var keyed []keyedInput
+	if p := e.keyed.Load(); p != nil {
+		keyed = *p
+	}
+	return e.cache.ComputeKey(input, keyed...)
+}
+
 // SetPolicyData updates the runtime policy data.
 func (e *Engine) SetPolicyData(data map[string]interface{}) error {
 	e.dataMu.Lock()
 	e.policyData = data
 	e.dataMu.Unlock()
 
-	// Invalidate cache when data changes
-	e.cache.Invalidate()
+	// Invalidate caches when data changes
+	e.invalidate()
 
 	// Recompile with new data
 	e.mu.Lock()
@@ -127,7 +238,7 @@ func (e *Engine) Evaluate(ctx context.Context, input *PolicyInput) (*EvaluationR
 
 	result := &EvaluationResult{
 		Input:      input,
-		PolicyMode: e.mode,
+		PolicyMode: e.Mode(),
 	}
 
 	// If disabled, allow everything
@@ -140,20 +251,25 @@ func (e *Engine) Evaluate(ctx context.Context, input *PolicyInput) (*EvaluationR
 		return result, nil
 	}
 
-	// Check cache first
-	cacheKey := e.cache.ComputeKey(input)
-	if cached, hit, tier := e.cache.Get(cacheKey); hit {
-		result.Decision = cached
-		result.CacheHit = true
-		result.CacheTier = tier
-		result.EvalTime = time.Since(start)
-		return result, nil
+	// Check cache first, unless the policies read inputs the key leaves out
+	cacheable := !e.bypassCache.Load()
+	var cacheKey string
+	if cacheable {
+		cacheKey = e.cacheKey(input)
+		if cached, hit, tier := e.cache.Get(cacheKey); hit {
+			result.Decision = cached
+			result.CacheHit = true
+			result.CacheTier = tier
+			result.EvalTime = time.Since(start)
+			e.logDecision(result)
+			return result, nil
+		}
 	}
 
 	// Evaluate policy
 	decision, err := e.evaluatePolicy(ctx, input)
 	if err != nil {
-		e.evalErrors++
+		e.evalErrors.Add(1)
 		return nil, fmt.Errorf("policy evaluation failed: %w", err)
 	}
 
@@ -161,17 +277,81 @@ func (e *Engine) Evaluate(ctx context.Context, input *PolicyInput) (*EvaluationR
 	result.EvalTime = time.Since(start)
 
 	// Update metrics
-	e.evaluations++
+	e.evaluations.Add(1)
 	e.updateAvgEvalTime(result.EvalTime)
 
 	// Cache the result
-	e.cache.Set(cacheKey, decision)
+	if cacheable {
+		e.cache.Set(cacheKey, decision)
+	}
+	e.logDecision(result)
 
 	return result, nil
 }
 
+// EvaluateWithExplain evaluates a policy decision like Evaluate, but always
+// runs OPA with tracing and records in result.Trace which rules fired. The
+// decision cache is bypassed. Tracing slows evaluation considerably, so this
+// is meant for debugging.
+func (e *Engine) EvaluateWithExplain(ctx context.Context, input *PolicyInput) (*EvaluationResult, error) {
+	start := time.Now()
+
+	result := &EvaluationResult{
+		Input:      input,
+		PolicyMode: e.Mode(),
+	}
+
+	if !e.enabled {
+		result.Decision = &PolicyDecision{
+			Allow:       true,
+			MatchedRule: "policy_disabled",
+		}
+		result.EvalTime = time.Since(start)
+		return result, nil
+	}
+
+	tracer := topdown.NewBufferTracer()
+	decision, err := e.evaluatePolicy(ctx, input, rego.EvalQueryTracer(tracer))
+	if err != nil {
+		e.evalErrors.Add(1)
+		return nil, fmt.Errorf("policy evaluation failed: %w", err)
+	}
+
+	result.Decision = decision
+	result.Trace = firedRules(*tracer)
+	result.EvalTime = time.Since(start)
+
+	e.evaluations.Add(1)
+	e.updateAvgEvalTime(result.EvalTime)
+	e.logDecision(result)
+
+	return result, nil
+}
+
+// firedRules lists, in evaluation order, each rule whose body succeeded,
+// as "data.path.rule (file:row)".
+func firedRules(events []*topdown.Event) []string {
+	trace := []string{}
+	for _, ev := range events {
+		if ev.Op != topdown.ExitOp {
+			continue
+		}
+		rule, ok := ev.Node.(*ast.Rule)
+		if !ok {
+			continue
+		}
+
+		line := rule.Path().String()
+		if loc := rule.Location; loc != nil {
+			line = fmt.Sprintf("%s (%s:%d)", line, loc.File, loc.Row)
+		}
+		trace = append(trace, line)
+	}
+	return trace
+}
+
 // evaluatePolicy runs the OPA evaluation.
-func (e *Engine) evaluatePolicy(ctx context.Context, input *PolicyInput) (*PolicyDecision, error) {
+func (e *Engine) evaluatePolicy(ctx context.Context, input *PolicyInput, opts ...rego.EvalOption) (*PolicyDecision, error) {
 	e.mu.RLock()
 	query := e.query
 	e.mu.RUnlock()
@@ -182,16 +362,23 @@ func (e *Engine) evaluatePolicy(ctx context.Context, input *PolicyInput) (*Polic
 		return nil, fmt.Errorf("failed to convert input: %w", err)
 	}
 
+	// Bound evaluation time so slow or runaway policies cannot stall requests
+	evalCtx, cancel := context.WithTimeout(ctx, e.evalTimeout)
+	defer cancel()
+
 	// Evaluate with input (data is already in the compiled store)
-	results, err := query.Eval(ctx, rego.EvalInput(inputMap))
+	results, err := query.Eval(evalCtx, append([]rego.EvalOption{rego.EvalInput(inputMap)}, opts...)...)
 	if err != nil {
+		if errors.Is(evalCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, fmt.Errorf("%w after %s", ErrEvaluationTimeout, e.evalTimeout)
+		}
 		return nil, fmt.Errorf("evaluation error: %w", err)
 	}
 
 	if len(results) == 0 {
 		return &PolicyDecision{
 			Allow:       false,
-			Violations:  []string{"No policy decision returned"},
+			Violations:  []Violation{{Message: "No policy decision returned"}},
 			MatchedRule: "no_result",
 		}, nil
 	}
@@ -219,20 +406,23 @@ func parseDecision(value interface{}) (*PolicyDecision, error) {
 		decision.Allow = allow
 	}
 
-	// Parse violations
-	if violations, ok := decisionMap["violations"].([]interface{}); ok {
-		for _, v := range violations {
-			if s, ok := v.(string); ok {
-				decision.Violations = append(decision.Violations, s)
-			}
-		}
-	}
+	decision.Violations = parseViolations(decisionMap["violations"])
 
 	// Parse matched_rule
 	if rule, ok := decisionMap["matched_rule"].(string); ok {
 		decision.MatchedRule = rule
 	}
 
+	// Parse fired_rules, which policies may report as an array or set
+	if fired, ok := decisionMap["fired_rules"].([]interface{}); ok {
+		for _, r := range fired {
+			if s, ok := r.(string); ok {
+				decision.FiredRules = append(decision.FiredRules, s)
+			}
+		}
+		sort.Strings(decision.FiredRules)
+	}
+
 	// Parse obligations if present
 	if obligations, ok := decisionMap["obligations"].([]interface{}); ok {
 		for _, o := range obligations {
@@ -258,6 +448,49 @@ func parseDecision(value interface{}) (*PolicyDecision, error) {
 	return decision, nil
 }
 
+// parseViolations converts the decision's violations, reported as a set of
+// objects with category, message and detail, or of plain strings. Policies
+// written as violations[msg] without contains report an object keyed by
+// the violation instead, which is accepted too.
+func parseViolations(value interface{}) []Violation {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		// Object keys are violations; structured ones arrive JSON-encoded.
+		// Sort them so decisions don't depend on map order.
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			var obj map[string]interface{}
+			if json.Unmarshal([]byte(key), &obj) == nil {
+				items = append(items, obj)
+			} else {
+				items = append(items, key)
+			}
+		}
+	}
+
+	var violations []Violation
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			violations = append(violations, Violation{Message: v})
+		case map[string]interface{}:
+			var violation Violation
+			violation.Category, _ = v["category"].(string)
+			violation.Message, _ = v["message"].(string)
+			violation.Detail, _ = v["detail"].(string)
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
 // structToMap converts a struct to a map using JSON marshaling.
 func structToMap(v interface{}) (map[string]interface{}, error) {
 	data, err := json.Marshal(v)
@@ -277,35 +510,55 @@ func structToMap(v interface{}) (map[string]interface{}, error) {
 func (e *Engine) updateAvgEvalTime(d time.Duration) {
 	// Simple exponential moving average
 	alpha := int64(10) // Weight for new value
-	if e.avgEvalTimeNs == 0 {
-		e.avgEvalTimeNs = d.Nanoseconds()
-	} else {
-		e.avgEvalTimeNs = (e.avgEvalTimeNs*(100-alpha) + d.Nanoseconds()*alpha) / 100
+	for {
+		old := e.avgEvalTimeNs.Load()
+		avg := d.Nanoseconds()
+		if old != 0 {
+			avg = (old*(100-alpha) + avg*alpha) / 100
+		}
+		if e.avgEvalTimeNs.CompareAndSwap(old, avg) {
+			return
+		}
 	}
 }
 
 // Mode returns the current policy mode.
 func (e *Engine) Mode() string {
+	e.modeMu.RLock()
+	defer e.modeMu.RUnlock()
 	return e.mode
 }
 
+// SetMode switches between "enforce" and "audit" without reloading
+// policies. Evaluations already in progress keep the previous mode.
+func (e *Engine) SetMode(mode string) error {
+	if mode != "enforce" && mode != "audit" {
+		return fmt.Errorf("invalid policy mode: %s (must be enforce or audit)", mode)
+	}
+
+	e.modeMu.Lock()
+	defer e.modeMu.Unlock()
+	e.mode = mode
+	return nil
+}
+
 // Stats returns engine statistics.
 func (e *Engine) Stats() EngineStats {
 	cacheStats := e.cache.Stats()
 	return EngineStats{
-		Evaluations:   e.evaluations,
-		EvalErrors:    e.evalErrors,
-		AvgEvalTimeMs: float64(e.avgEvalTimeNs) / 1e6,
+		Evaluations:   e.evaluations.Load(),
+		EvalErrors:    e.evalErrors.Load(),
+		AvgEvalTimeMs: float64(e.avgEvalTimeNs.Load()) / 1e6,
 		CacheStats:    cacheStats,
 	}
 }
 
 // EngineStats contains policy engine statistics.
 type EngineStats struct {
-	Evaluations   int64
-	EvalErrors    int64
-	AvgEvalTimeMs float64
-	CacheStats    CacheStats
+	Evaluations   int64      `json:"evaluations"`
+	EvalErrors    int64      `json:"eval_errors"`
+	AvgEvalTimeMs float64    `json:"avg_eval_time_ms"`
+	CacheStats    CacheStats `json:"cache"`
 }
 
 // IsAllowed is a convenience method to check if a request is allowed.
@@ -316,7 +569,7 @@ func (e *Engine) IsAllowed(ctx context.Context, input *PolicyInput) (bool, *Eval
 	}
 
 	// In audit mode, always return true but still log the decision
-	if e.mode == "audit" {
+	if result.PolicyMode == "audit" {
 		return true, result, nil
 	}
 
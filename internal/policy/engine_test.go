@@ -2,8 +2,13 @@ package policy
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/policy/compiler"
 )
 
 // TestNewEngine tests policy engine creation with various configurations.
@@ -191,6 +196,119 @@ decision = {
 	}
 }
 
+// TestEvaluationTimeout tests that slow policies are cut off by the configured timeout.
+func TestEvaluationTimeout(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:        "enforce",
+		Enabled:     true,
+		EvalTimeout: 10 * time.Millisecond,
+	})
+
+	// Policy that iterates far longer than the timeout allows
+	modules := map[string]string{
+		"slow.rego": `
+package mcp.policy
+
+n := count([1 | numbers.range(1, 100000)[_]; numbers.range(1, 100000)[_]])
+
+decision = {
+	"allow": n > 0,
+	"matched_rule": "slow",
+	"violations": []
+}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	input := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", []string{"read"}).
+		WithRequest("tools/call", "read_file", nil).
+		Build()
+
+	start := time.Now()
+	_, err := engine.Evaluate(ctx, input)
+	if !errors.Is(err, ErrEvaluationTimeout) {
+		t.Fatalf("Evaluate() error = %v, want ErrEvaluationTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Evaluate() took %s, expected to stop near the timeout", elapsed)
+	}
+
+	stats := engine.Stats()
+	if stats.EvalErrors != 1 {
+		t.Errorf("EvalErrors = %d, want 1", stats.EvalErrors)
+	}
+}
+
+// TestStrictBuiltinErrors tests that builtin errors only fail evaluation in strict mode.
+func TestStrictBuiltinErrors(t *testing.T) {
+	// Invalid regex built from input: lenient mode treats the call as undefined
+	modules := map[string]string{
+		"regex.rego": `
+package mcp.policy
+
+default matched = false
+
+matched {
+	regex.match(concat("", ["[", input.request.tool]), "x")
+}
+
+decision = {
+	"allow": true,
+	"matched_rule": sprintf("matched_%v", [matched]),
+	"violations": []
+}
+`,
+	}
+
+	tests := []struct {
+		name      string
+		strict    bool
+		expectErr bool
+	}{
+		{"lenient", false, false},
+		{"strict", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(EngineConfig{
+				Mode:                "enforce",
+				Enabled:             true,
+				StrictBuiltinErrors: tt.strict,
+			})
+
+			ctx := context.Background()
+			if err := engine.LoadPolicies(ctx, modules); err != nil {
+				t.Fatalf("LoadPolicies() error = %v", err)
+			}
+
+			input := NewInputBuilder().
+				WithAgent("agent1", "Test Agent", []string{"read"}).
+				WithRequest("tools/call", "read_file", nil).
+				Build()
+
+			result, err := engine.Evaluate(ctx, input)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("Evaluate() expected error in strict mode")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if result.Decision.MatchedRule != "matched_false" {
+				t.Errorf("MatchedRule = %s, want 'matched_false'", result.Decision.MatchedRule)
+			}
+		})
+	}
+}
+
 // TestPolicyEvaluationDeny tests policy that denies a request.
 func TestPolicyEvaluationDeny(t *testing.T) {
 	engine := NewEngine(EngineConfig{
@@ -238,6 +356,72 @@ decision = {
 	}
 }
 
+// TestSetMode tests switching between enforce and audit at runtime.
+func TestSetMode(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:    "enforce",
+		Enabled: true,
+	})
+
+	modules := map[string]string{
+		"deny.rego": `
+package mcp.policy
+
+decision = {
+	"allow": false,
+	"matched_rule": "deny_all"
+}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	input := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", []string{"read"}).
+		WithRequest("tools/call", "delete_file", nil).
+		Build()
+
+	tests := []struct {
+		mode        string
+		wantAllowed bool
+	}{
+		{"audit", true},
+		{"enforce", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if err := engine.SetMode(tt.mode); err != nil {
+				t.Fatalf("SetMode() error = %v", err)
+			}
+			if engine.Mode() != tt.mode {
+				t.Errorf("Mode() = %s, want %s", engine.Mode(), tt.mode)
+			}
+
+			allowed, result, err := engine.IsAllowed(ctx, input)
+			if err != nil {
+				t.Fatalf("IsAllowed() error = %v", err)
+			}
+			if allowed != tt.wantAllowed {
+				t.Errorf("IsAllowed() = %v, want %v", allowed, tt.wantAllowed)
+			}
+			if result.PolicyMode != tt.mode {
+				t.Errorf("PolicyMode = %s, want %s", result.PolicyMode, tt.mode)
+			}
+		})
+	}
+
+	if err := engine.SetMode("permissive"); err == nil {
+		t.Error("SetMode() expected error for invalid mode")
+	}
+	if engine.Mode() != "enforce" {
+		t.Errorf("Mode() = %s after invalid SetMode, want enforce", engine.Mode())
+	}
+}
+
 // TestPolicyWithData tests policy evaluation with runtime data.
 func TestPolicyWithData(t *testing.T) {
 	engine := NewEngine(EngineConfig{
@@ -421,6 +605,59 @@ decision = {
 	}
 }
 
+// TestCacheKeySourceIP tests that a cached ip_range decision for one client
+// IP is not served to another.
+func TestCacheKeySourceIP(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:        "enforce",
+		Enabled:     true,
+		CacheConfig: CacheConfig{Enabled: true, TTL: time.Minute},
+	})
+
+	modules := map[string]string{
+		"ip.rego": `
+package mcp.policy
+
+import rego.v1
+
+default decision := {"allow": false, "matched_rule": "ip_denied", "violations": ["source IP not allowed"]}
+
+decision := {"allow": true, "matched_rule": "allowed", "violations": []} if {
+	net.cidr_contains("10.0.0.0/8", input.context.source_ip)
+}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	evaluate := func(sourceIP string) *EvaluationResult {
+		t.Helper()
+		input := NewInputBuilder().
+			WithAgent("agent1", "Test Agent", []string{"read"}).
+			WithRequest("tools/call", "test_tool", nil).
+			WithEnvironment(sourceIP, "production", "").
+			Build()
+		result, err := engine.Evaluate(ctx, input)
+		if err != nil {
+			t.Fatalf("Evaluate(%s) error = %v", sourceIP, err)
+		}
+		return result
+	}
+
+	if result := evaluate("10.1.2.3"); !result.Decision.Allow {
+		t.Errorf("Allow from 10.1.2.3 = false, want true")
+	}
+	if result := evaluate("192.168.1.1"); result.Decision.Allow || result.CacheHit {
+		t.Errorf("From 192.168.1.1: Allow = %v, CacheHit = %v, want a fresh deny", result.Decision.Allow, result.CacheHit)
+	}
+	if result := evaluate("10.1.2.3"); !result.Decision.Allow || !result.CacheHit {
+		t.Errorf("Again from 10.1.2.3: Allow = %v, CacheHit = %v, want a cached allow", result.Decision.Allow, result.CacheHit)
+	}
+}
+
 // TestCacheInvalidation tests cache invalidation on data update.
 func TestCacheInvalidation(t *testing.T) {
 	engine := NewEngine(EngineConfig{
@@ -493,6 +730,40 @@ decision = {
 	}
 }
 
+// TestOnChange tests that the change callback runs when policies or policy
+// data are replaced, but not when a load fails.
+func TestOnChange(t *testing.T) {
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+	changes := 0
+	engine.SetOnChange(func() { changes++ })
+
+	modules := map[string]string{
+		"test.rego": `
+package mcp.policy
+
+decision = {"allow": true, "matched_rule": "allow_all", "violations": []}
+`,
+	}
+	ctx := context.Background()
+
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+	if err := engine.SetPolicyData(map[string]interface{}{"test": "data"}); err != nil {
+		t.Fatalf("SetPolicyData() error = %v", err)
+	}
+	if err := engine.LoadPoliciesAndData(ctx, modules, map[string]interface{}{}); err != nil {
+		t.Fatalf("LoadPoliciesAndData() error = %v", err)
+	}
+	if err := engine.LoadPolicies(ctx, map[string]string{"bad.rego": "package"}); err == nil {
+		t.Fatal("LoadPolicies() with invalid module error = nil")
+	}
+
+	if changes != 3 {
+		t.Errorf("change callback ran %d times, want 3", changes)
+	}
+}
+
 // TestAuditModeVsEnforceMode tests behavior difference between modes.
 func TestAuditModeVsEnforceMode(t *testing.T) {
 	tests := []struct {
@@ -615,6 +886,49 @@ decision = {
 	}
 }
 
+// TestEngineStatsConcurrent tests that evaluations are counted while Stats
+// is read concurrently, as by the /stats endpoint; run with -race.
+func TestEngineStatsConcurrent(t *testing.T) {
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+
+	modules := map[string]string{
+		"test.rego": `
+package mcp.policy
+
+decision = {"allow": true, "matched_rule": "allow_all", "violations": []}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	input := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", nil).
+		WithRequest("tools/call", "test_tool", nil).
+		Build()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if _, err := engine.Evaluate(ctx, input); err != nil {
+					t.Errorf("Evaluate() error = %v", err)
+				}
+				engine.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := engine.Stats().Evaluations; n != 100 {
+		t.Errorf("Evaluations = %d, want 100", n)
+	}
+}
+
 // TestIsReady tests engine readiness check.
 func TestIsReady(t *testing.T) {
 	// Disabled engine is always ready
@@ -775,3 +1089,454 @@ func TestModeGetter(t *testing.T) {
 		t.Errorf("Mode() = %s, want 'audit'", engine.Mode())
 	}
 }
+
+// TestCacheKeyArguments tests that a decision cached for a field_any rule
+// on the request arguments is not served to a call with other arguments.
+func TestCacheKeyArguments(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:        "enforce",
+		Enabled:     true,
+		CacheConfig: CacheConfig{Enabled: true, TTL: time.Minute},
+	})
+
+	compiled, err := compiler.NewCompiler().Compile(&compiler.PolicyDefinition{
+		Version: "1.0",
+		Name:    "tags",
+		Rules: []compiler.RuleDefinition{{
+			ID:         "no-pii",
+			Type:       compiler.RuleTypeCustom,
+			Conditions: map[string]interface{}{"field_any": "request.arguments.tags", "op": "eq", "value": "pii"},
+			Action:     compiler.ActionDeny,
+			Message:    "pii-tagged records are not allowed",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	modules := compiled.Modules
+	modules["decision.rego"] = `
+package mcp.policy
+
+import rego.v1
+
+decision := {"allow": count(violations) == 0, "matched_rule": "tags", "violations": violations}
+`
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	evaluate := func(tags ...interface{}) *EvaluationResult {
+		t.Helper()
+		input := NewInputBuilder().
+			WithAgent("agent1", "Test Agent", nil).
+			WithRequest("tools/call", "export_records", map[string]interface{}{"tags": tags}).
+			Build()
+		result, err := engine.Evaluate(ctx, input)
+		if err != nil {
+			t.Fatalf("Evaluate(%v) error = %v", tags, err)
+		}
+		return result
+	}
+
+	if result := evaluate("public"); !result.Decision.Allow {
+		t.Error("Allow with public tags = false, want true")
+	}
+	if result := evaluate("public", "pii"); result.Decision.Allow || result.CacheHit {
+		t.Errorf("With a pii tag: Allow = %v, CacheHit = %v, want a fresh deny", result.Decision.Allow, result.CacheHit)
+	}
+}
+
+// TestCacheTimeWindow tests that a compiled time window policy is decided
+// at every request's own timestamp with the cache enabled, rather than
+// reusing a decision made inside the window after it closes.
+func TestCacheTimeWindow(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:        "enforce",
+		Enabled:     true,
+		CacheConfig: CacheConfig{Enabled: true, TTL: time.Hour},
+	})
+
+	compiled, err := compiler.NewCompiler().Compile(&compiler.PolicyDefinition{
+		Version: "1.0",
+		Name:    "hours",
+		Rules: []compiler.RuleDefinition{{
+			ID:   "business-hours",
+			Type: compiler.RuleTypeTimeWindow,
+			Conditions: map[string]interface{}{
+				"tools": []interface{}{"deploy"},
+				"start": "09:00",
+				"end":   "17:00",
+			},
+			Action:  compiler.ActionAllow,
+			Message: "deploy is only allowed during business hours",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	modules := compiled.Modules
+	modules["decision.rego"] = `
+package mcp.policy
+
+import rego.v1
+
+decision := {"allow": count(violations) == 0, "matched_rule": "time_window", "violations": violations}
+`
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	evaluate := func(at string) *EvaluationResult {
+		t.Helper()
+		input := NewInputBuilder().
+			WithAgent("agent1", "Test Agent", nil).
+			WithRequest("tools/call", "deploy", nil).
+			Build()
+		ts, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			t.Fatalf("time.Parse(%s) error = %v", at, err)
+		}
+		input.Context.Timestamp = ts
+		result, err := engine.Evaluate(ctx, input)
+		if err != nil {
+			t.Fatalf("Evaluate(%s) error = %v", at, err)
+		}
+		return result
+	}
+
+	if result := evaluate("2025-06-11T16:59:59Z"); !result.Decision.Allow {
+		t.Error("Allow just before the window closes = false, want true")
+	}
+	if result := evaluate("2025-06-11T17:00:01Z"); result.Decision.Allow || result.CacheHit {
+		t.Errorf("Just after the window closes: Allow = %v, CacheHit = %v, want a fresh deny", result.Decision.Allow, result.CacheHit)
+	}
+}
+
+// TestCacheSessionCounters tests that a policy on a session's cumulative
+// reads is decided on the current counts with the cache enabled, rather
+// than reusing a decision made before the limit was reached, while
+// requests with the same counts are still served from the cache.
+func TestCacheSessionCounters(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:        "enforce",
+		Enabled:     true,
+		CacheConfig: CacheConfig{Enabled: true, TTL: time.Minute},
+	})
+
+	modules := map[string]string{
+		"reads.rego": `
+package mcp.policy
+
+import rego.v1
+
+default decision := {"allow": false, "matched_rule": "read_limit", "violations": ["read limit exceeded"]}
+
+decision := {"allow": true, "matched_rule": "allowed", "violations": []} if {
+	input.session.cumulative_reads < 3
+}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	evaluate := func(reads int) *EvaluationResult {
+		t.Helper()
+		input := NewInputBuilder().
+			WithAgent("agent1", "Test Agent", nil).
+			WithRequest("tools/call", "ticket_read", nil).
+			WithSession("sess_1", 1, time.Now()).
+			Build()
+		input.Session.CumulativeReads = reads
+		result, err := engine.Evaluate(ctx, input)
+		if err != nil {
+			t.Fatalf("Evaluate(%d reads) error = %v", reads, err)
+		}
+		return result
+	}
+
+	if result := evaluate(2); !result.Decision.Allow {
+		t.Error("Allow after 2 reads = false, want true")
+	}
+	if result := evaluate(3); result.Decision.Allow || result.CacheHit {
+		t.Errorf("After 3 reads: Allow = %v, CacheHit = %v, want a fresh deny", result.Decision.Allow, result.CacheHit)
+	}
+	if result := evaluate(3); result.Decision.Allow || !result.CacheHit {
+		t.Errorf("Again after 3 reads: Allow = %v, CacheHit = %v, want a cached deny", result.Decision.Allow, result.CacheHit)
+	}
+}
+
+// TestEvaluateWithExplain tests that explained evaluations report the rules
+// that fired for a denied request.
+func TestEvaluateWithExplain(t *testing.T) {
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+
+	modules := map[string]string{
+		"explain.rego": `
+package mcp.policy
+
+import future.keywords.in
+
+default allow = false
+
+allow {
+	input.request.tool in ["read_file"]
+}
+
+violations[msg] {
+	input.request.tool == "delete_file"
+	msg := "delete_file is not permitted"
+}
+
+decision = {
+	"allow": allow,
+	"violations": [v | violations[v]],
+	"matched_rule": "explain"
+}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	input := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", []string{"read"}).
+		WithRequest("tools/call", "delete_file", nil).
+		Build()
+
+	result, err := engine.EvaluateWithExplain(ctx, input)
+	if err != nil {
+		t.Fatalf("EvaluateWithExplain() error = %v", err)
+	}
+	if result.Decision.Allow {
+		t.Fatal("Expected request to be denied")
+	}
+	if len(result.Trace) == 0 {
+		t.Fatal("Expected a non-empty trace")
+	}
+
+	var violationsFired bool
+	for _, line := range result.Trace {
+		if strings.HasPrefix(line, "data.mcp.policy.violations") && strings.Contains(line, "explain.rego:") {
+			violationsFired = true
+		}
+		if strings.HasSuffix(line, "explain.rego:8)") {
+			t.Errorf("Trace reports the allow rule body fired: %s", line)
+		}
+	}
+	if !violationsFired {
+		t.Errorf("Trace does not report the violations rule: %v", result.Trace)
+	}
+
+	// Plain evaluations carry no trace
+	result, err = engine.Evaluate(ctx, input)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if result.Trace != nil {
+		t.Errorf("Evaluate() Trace = %v, want nil", result.Trace)
+	}
+}
+
+// TestPolicyFiredRules tests that every rule a policy reports as fired is
+// returned, not just the matched rule.
+func TestPolicyFiredRules(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:    "enforce",
+		Enabled: true,
+	})
+
+	modules := map[string]string{
+		"fired.rego": `
+package mcp.policy
+
+import rego.v1
+
+decision := {
+	"allow": count(fired_rules) == 0,
+	"matched_rule": "checks",
+	"fired_rules": fired_rules,
+}
+
+fired_rules contains "write_blocked" if {
+	input.request.tool == "write_file"
+}
+
+fired_rules contains "missing_admin" if {
+	not "admin" in input.agent.capabilities
+}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		tool string
+		caps []string
+		want []string
+	}{
+		{name: "none fired", tool: "read_file", caps: []string{"admin"}, want: nil},
+		{name: "one fired", tool: "read_file", caps: []string{"read"}, want: []string{"missing_admin"}},
+		{name: "both fired", tool: "write_file", caps: []string{"read"}, want: []string{"missing_admin", "write_blocked"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := NewInputBuilder().
+				WithAgent("agent1", "Test Agent", tt.caps).
+				WithRequest("tools/call", tt.tool, nil).
+				Build()
+
+			result, err := engine.Evaluate(ctx, input)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if strings.Join(result.Decision.FiredRules, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("FiredRules = %v, want %v", result.Decision.FiredRules, tt.want)
+			}
+			if result.Decision.Allow != (len(tt.want) == 0) {
+				t.Errorf("Allow = %v, want %v", result.Decision.Allow, len(tt.want) == 0)
+			}
+		})
+	}
+}
+
+// TestParseViolations tests that violations are parsed from sets of
+// structured objects, from plain strings, and from the object form
+// violations[msg] rules produce.
+func TestParseViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []Violation
+	}{
+		{
+			name: "structured set",
+			value: []interface{}{
+				map[string]interface{}{"category": "blocklist", "message": "Tool is blocked", "detail": "rm_rf"},
+				map[string]interface{}{"category": "rate_limit", "message": "Too many requests"},
+			},
+			want: []Violation{
+				{Category: CategoryBlocklist, Message: "Tool is blocked", Detail: "rm_rf"},
+				{Category: CategoryRateLimit, Message: "Too many requests"},
+			},
+		},
+		{
+			name:  "strings",
+			value: []interface{}{"access denied"},
+			want:  []Violation{{Message: "access denied"}},
+		},
+		{
+			name: "object keyed by violation",
+			value: map[string]interface{}{
+				"b denied": true,
+				`{"category":"identity","message":"a denied"}`: true,
+			},
+			want: []Violation{
+				{Message: "b denied"},
+				{Category: CategoryIdentity, Message: "a denied"},
+			},
+		},
+		{
+			name:  "missing",
+			value: nil,
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseViolations(tt.value)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseViolations() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("violation %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestBundledPolicyViolations tests that the bundled Rego policies report
+// categorized violations.
+func TestBundledPolicyViolations(t *testing.T) {
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+	loader := NewLoader("../../policies", "../../config/policy_data.json", WithJSONPolicyDir(t.TempDir()))
+	ctx := context.Background()
+	if err := loader.LoadAndInitialize(ctx, engine); err != nil {
+		t.Fatalf("LoadAndInitialize() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		tool         string
+		requestCount int
+		want         Violation
+	}{
+		{
+			name: "missing capability",
+			tool: "customer_lookup",
+			want: Violation{
+				Category: CategoryCapability,
+				Message:  "Agent 'agent1' lacks capability 'read:customers' required for tool 'customer_lookup'",
+				Detail:   "read:customers",
+			},
+		},
+		{
+			name: "blocked tool",
+			tool: "shell_exec",
+			want: Violation{Category: CategoryBlocklist, Message: "Tool 'shell_exec' is blocked by policy", Detail: "shell_exec"},
+		},
+		{
+			name:         "rate limit",
+			tool:         "ticket_read",
+			requestCount: 1000,
+			want: Violation{
+				Category: CategoryRateLimit,
+				Message:  "Agent 'agent1' exceeded rate limit (1000/1000 requests in session)",
+				Detail:   "1000/1000",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := NewInputBuilder().
+				WithAgent("agent1", "Test Agent", []string{"read:tickets"}).
+				WithRequest("tools/call", tt.tool, nil).
+				WithSession("sess1", tt.requestCount, time.Now()).
+				Build()
+
+			result, err := engine.Evaluate(ctx, input)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if result.Decision.Allow {
+				t.Fatal("Decision should deny")
+			}
+			found := false
+			for _, v := range result.Decision.Violations {
+				if v == tt.want {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Violations = %+v, want to include %+v", result.Decision.Violations, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by DIDFilter.Check.
+var (
+	ErrDIDBlocked    = errors.New("did is blocked")
+	ErrDIDNotAllowed = errors.New("did is not in the allowed list")
+)
+
+// DIDFilter decides whether a verified agent DID may make requests. The
+// check is made at the identity layer, before policy evaluation.
+type DIDFilter struct {
+	allowed map[string]struct{}
+	blocked map[string]struct{}
+}
+
+// NewDIDFilter creates a filter from an allow list and a block list. An
+// empty allow list allows every DID that is not blocked.
+func NewDIDFilter(allowed, blocked []string) *DIDFilter {
+	f := &DIDFilter{
+		allowed: make(map[string]struct{}, len(allowed)),
+		blocked: make(map[string]struct{}, len(blocked)),
+	}
+	for _, did := range allowed {
+		f.allowed[did] = struct{}{}
+	}
+	for _, did := range blocked {
+		f.blocked[did] = struct{}{}
+	}
+	return f
+}
+
+// Check returns nil if did may make requests. The block list is checked
+// first, so a DID on both lists is blocked.
+func (f *DIDFilter) Check(did string) error {
+	if _, ok := f.blocked[did]; ok {
+		return fmt.Errorf("%w: %s", ErrDIDBlocked, did)
+	}
+	if len(f.allowed) > 0 {
+		if _, ok := f.allowed[did]; !ok {
+			return fmt.Errorf("%w: %s", ErrDIDNotAllowed, did)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDIDFilter tests allow and block list checks, with block taking precedence.
+func TestDIDFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		blocked []string
+		did     string
+		wantErr error
+	}{
+		{"no lists", nil, nil, "did:web:a", nil},
+		{"allowed", []string{"did:web:a"}, nil, "did:web:a", nil},
+		{"not allowed", []string{"did:web:a"}, nil, "did:web:b", ErrDIDNotAllowed},
+		{"blocked", nil, []string{"did:web:a"}, "did:web:a", ErrDIDBlocked},
+		{"blocked without allow list", nil, []string{"did:web:a"}, "did:web:b", nil},
+		{"block wins over allow", []string{"did:web:a"}, []string{"did:web:a"}, "did:web:a", ErrDIDBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewDIDFilter(tt.allowed, tt.blocked).Check(tt.did)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check(%q) error = %v, want %v", tt.did, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// uncachedInputs are the input fields decisions are not cached on: they
+// change from one request to the next without changing the cache key. The
+// engine bypasses its decision cache while the loaded policies read any of
+// them.
+var uncachedInputs = []string{
+	"context.timestamp", // Time windows
+}
+
+// keyedInput is an input field outside the base decision cache key.
+type keyedInput struct {
+	path  string
+	value func(*PolicyInput) interface{}
+}
+
+// keyedInputs are the input fields that can differ between requests with
+// the same base cache key. While the loaded policies read any of them, the
+// engine adds their values to the key, so a decision is only reused for
+// requests that agree on everything the policies look at.
+var keyedInputs = []keyedInput{
+	{"agent.name", func(in *PolicyInput) interface{} { return in.Agent.Name }},
+	{"agent.model", func(in *PolicyInput) interface{} { return in.Agent.Model }},
+	{"agent.publisher", func(in *PolicyInput) interface{} { return in.Agent.Publisher }},
+	{"agent.tags", func(in *PolicyInput) interface{} { return in.Agent.Tags }},
+	{"request.method", func(in *PolicyInput) interface{} { return in.Request.Method }},
+	{"request.arguments", func(in *PolicyInput) interface{} { return in.Request.Arguments }},
+	{"request.intent", func(in *PolicyInput) interface{} { return in.Request.Intent }},
+	{"session.id", func(in *PolicyInput) interface{} { return in.Session.ID }},
+	{"session.request_count", func(in *PolicyInput) interface{} { return in.Session.RequestCount }},
+	{"session.started_at", func(in *PolicyInput) interface{} { return in.Session.StartedAt }},
+	{"session.cumulative_reads", func(in *PolicyInput) interface{} { return in.Session.CumulativeReads }},
+	{"session.cumulative_writes", func(in *PolicyInput) interface{} { return in.Session.CumulativeWrites }},
+	{"session.auth_token_id", func(in *PolicyInput) interface{} { return in.Session.AuthTokenID }},
+	{"session.client_cert_subject", func(in *PolicyInput) interface{} { return in.Session.ClientCertSubject }},
+	{"session.protocol_version", func(in *PolicyInput) interface{} { return in.Session.ProtocolVersion }},
+	{"session.client_capabilities", func(in *PolicyInput) interface{} { return in.Session.ClientCapabilities }},
+	{"identity.signature_alg", func(in *PolicyInput) interface{} { return in.Identity.SignatureAlg }},
+	{"identity.issued_at", func(in *PolicyInput) interface{} { return in.Identity.IssuedAt }},
+	{"identity.has_log_proof", func(in *PolicyInput) interface{} { return in.Identity.HasLogProof }},
+	{"context.environment", func(in *PolicyInput) interface{} { return in.Context.Environment }},
+	{"context.proxy_region", func(in *PolicyInput) interface{} { return in.Context.ProxyRegion }},
+}
+
+// keyedInputsRead returns the keyedInputs that any module may read.
+func keyedInputsRead(modules map[string]string) []keyedInput {
+	var read []keyedInput
+	for _, k := range keyedInputs {
+		if readsInput(modules, k.path) {
+			read = append(read, k)
+		}
+	}
+	return read
+}
+
+// inputRefPattern matches a reference to input, capturing the dotted path
+// that follows and any identifier character that makes "input" part of a
+// longer name.
+var inputRefPattern = regexp.MustCompile(`\binput((?:\.[A-Za-z_][A-Za-z0-9_]*)*)([A-Za-z0-9_]?)`)
+
+// readsInput reports whether any module may read one of paths, such as
+// "context.timestamp". A module reads a path if it refers to it, to a field
+// under it, or to a parent taken whole (input.context, input.context[k] or
+// input itself). Comments are ignored, but mentions in strings count, so
+// the answer errs toward true.
+func readsInput(modules map[string]string, paths ...string) bool {
+	for _, src := range modules {
+		for _, line := range strings.Split(src, "\n") {
+			if i := strings.IndexByte(line, '#'); i >= 0 {
+				line = line[:i]
+			}
+			for _, m := range inputRefPattern.FindAllStringSubmatch(line, -1) {
+				if m[2] != "" {
+					continue // e.g. "inputs"
+				}
+				ref := strings.TrimPrefix(m[1], ".")
+				for _, path := range paths {
+					if ref == "" || ref == path || strings.HasPrefix(ref, path+".") || strings.HasPrefix(path, ref+".") {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
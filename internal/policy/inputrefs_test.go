@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestReadsInput tests which references to input count as reading a path.
+func TestReadsInput(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want bool
+	}{
+		{"exact field", "x := input.context.timestamp", true},
+		{"parent taken whole", "ctx := input.context", true},
+		{"parent indexed", `ts := input.context["timestamp"]`, true},
+		{"input itself", "i := input", true},
+		{"sibling field", "ip := input.context.source_ip", false},
+		{"other section", "tool := input.request.tool", false},
+		{"longer name", "inputs := [1]", false},
+		{"comment", "# uses input.context.timestamp\nx := 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modules := map[string]string{"test.rego": "package mcp.policy\n\n" + tt.src + "\n"}
+			if got := readsInput(modules, "context.timestamp"); got != tt.want {
+				t.Errorf("readsInput(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestKeyedInputsRead tests that only the session fields a policy reads are
+// added to the cache key.
+func TestKeyedInputsRead(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"none", "tool := input.request.tool", nil},
+		{"one field", "input.session.request_count < limit", []string{"session.request_count"}},
+		{"session taken whole", "s := input.session", []string{
+			"session.id", "session.request_count", "session.started_at",
+			"session.cumulative_reads", "session.cumulative_writes", "session.auth_token_id",
+			"session.client_cert_subject", "session.protocol_version", "session.client_capabilities",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modules := map[string]string{"test.rego": "package mcp.policy\n\n" + tt.src + "\n"}
+			var got []string
+			for _, k := range keyedInputsRead(modules) {
+				got = append(got, k.path)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("keyedInputsRead(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
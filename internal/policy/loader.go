@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/agentfacts/mcp-proxy/internal/policy/compiler"
 	"github.com/rs/zerolog/log"
@@ -18,6 +19,9 @@ type Loader struct {
 	dataFile      string
 	jsonPolicyDir string
 	compiler      *compiler.Compiler
+
+	// Policy file watching
+	watchDebounce time.Duration
 }
 
 // LoaderOption configures the loader.
@@ -30,6 +34,14 @@ func WithJSONPolicyDir(dir string) LoaderOption {
 	}
 }
 
+// WithWatchDebounce sets how long policy files must be unchanged before
+// WatchForChanges reloads them.
+func WithWatchDebounce(d time.Duration) LoaderOption {
+	return func(l *Loader) {
+		l.watchDebounce = d
+	}
+}
+
 // NewLoader creates a new policy loader.
 func NewLoader(policyDir, dataFile string, opts ...LoaderOption) *Loader {
 	l := &Loader{
@@ -37,6 +49,7 @@ func NewLoader(policyDir, dataFile string, opts ...LoaderOption) *Loader {
 		dataFile:      dataFile,
 		jsonPolicyDir: filepath.Join(policyDir, "json"),
 		compiler:      compiler.NewCompiler(),
+		watchDebounce: DefaultWatchDebounce,
 	}
 
 	for _, opt := range opts {
@@ -48,6 +61,12 @@ func NewLoader(policyDir, dataFile string, opts ...LoaderOption) *Loader {
 
 // LoadPolicies loads all policy files (.rego and compiled .json) from the policy directory.
 func (l *Loader) LoadPolicies() (map[string]string, error) {
+	return l.loadModules(false)
+}
+
+// loadModules loads Rego and JSON policies. When strict is false, JSON
+// policy errors are logged and only the Rego files are returned.
+func (l *Loader) loadModules(strict bool) (map[string]string, error) {
 	modules := make(map[string]string)
 
 	// Load native Rego files first
@@ -61,6 +80,9 @@ func (l *Loader) LoadPolicies() (map[string]string, error) {
 
 	// Load and compile JSON policies
 	jsonModules, err := l.loadJSONPolicies()
+	if err != nil && strict {
+		return nil, err
+	}
 	if err != nil {
 		// Log warning but don't fail if JSON policies can't be loaded
 		log.Warn().Err(err).Msg("Failed to load JSON policies, continuing with Rego only")
@@ -213,24 +235,27 @@ func (l *Loader) LoadAndInitialize(ctx context.Context, engine *Engine) error {
 	return nil
 }
 
-// WatchForChanges monitors policy files for changes (placeholder for future implementation).
-func (l *Loader) WatchForChanges(ctx context.Context, engine *Engine, onChange func()) error {
-	// TODO: Implement file watching with fsnotify
-	// For now, this is a placeholder that could be called to set up file watching
-	log.Info().Msg("Policy file watching not yet implemented")
-	return nil
+// ReloadData re-reads the policy data file and swaps it into the backend,
+// leaving the policy modules as they are. It returns the number of
+// top-level keys loaded. If the file can't be read or parsed, the backend
+// keeps its current data.
+func (l *Loader) ReloadData(backend PolicyBackend) (int, error) {
+	data, err := l.LoadPolicyData()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := backend.SetData(data); err != nil {
+		return 0, fmt.Errorf("failed to set policy data: %w", err)
+	}
+
+	return len(data), nil
 }
 
 // ValidatePolicies checks if policies can be loaded and compiled without errors.
+// Use Validate for a per-file report including warnings.
 func (l *Loader) ValidatePolicies(ctx context.Context) error {
-	modules, err := l.LoadPolicies()
-	if err != nil {
-		return err
-	}
-
-	// Try to compile with a temporary engine
-	engine := NewEngine(EngineConfig{Enabled: true})
-	return engine.LoadPolicies(ctx, modules)
+	return l.Validate(ctx).Err()
 }
 
 // PolicyDataFromStruct converts a PolicyData struct to a map for OPA.
@@ -248,6 +273,22 @@ func PolicyDataFromStruct(pd *PolicyData) (map[string]interface{}, error) {
 	return result, nil
 }
 
+// PolicyDataFromMap converts policy data loaded for OPA to a PolicyData
+// struct.
+func PolicyDataFromMap(data map[string]interface{}) (*PolicyData, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var pd PolicyData
+	if err := json.Unmarshal(content, &pd); err != nil {
+		return nil, err
+	}
+
+	return &pd, nil
+}
+
 // LoadPolicyDataStruct loads policy data as a typed struct.
 func (l *Loader) LoadPolicyDataStruct() (*PolicyData, error) {
 	content, err := os.ReadFile(l.dataFile)
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const reloadBlocklistPolicy = `package mcp.policy
+
+import rego.v1
+
+default allow := false
+
+allow if not input.request.tool in data.blocked_tools
+
+matched_rule := "allowed" if {
+	allow
+} else := "blocked_tool"
+
+decision := {"allow": allow, "matched_rule": matched_rule}
+`
+
+// TestReloadData tests that reloading the data file makes new blocklist
+// entries take effect without reloading the policies.
+func TestReloadData(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "blocklist.rego"), []byte(reloadBlocklistPolicy), 0o600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+	dataFile := filepath.Join(dir, "data.json")
+	if err := os.WriteFile(dataFile, []byte(`{"blocked_tools": ["drop_table"]}`), 0o600); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	loader := NewLoader(dir, dataFile)
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true, CacheConfig: CacheConfig{Enabled: true}})
+	ctx := context.Background()
+	if err := loader.LoadAndInitialize(ctx, engine); err != nil {
+		t.Fatalf("LoadAndInitialize() error = %v", err)
+	}
+
+	input := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", nil).
+		WithRequest("tools/call", "delete_file", nil).
+		Build()
+	allowed, _, err := engine.IsAllowed(ctx, input)
+	if err != nil || !allowed {
+		t.Fatalf("IsAllowed() = %v, %v before reload, want allowed", allowed, err)
+	}
+
+	data := `{"blocked_tools": ["drop_table", "delete_file"], "blocked_agents": []}`
+	if err := os.WriteFile(dataFile, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	keys, err := loader.ReloadData(engine)
+	if err != nil {
+		t.Fatalf("ReloadData() error = %v", err)
+	}
+	if keys != 2 {
+		t.Errorf("ReloadData() = %d keys, want 2", keys)
+	}
+
+	result, err := engine.Evaluate(ctx, input)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if result.Decision.Allow || result.Decision.MatchedRule != "blocked_tool" {
+		t.Errorf("Decision = %+v after reload, want blocked_tool denial", result.Decision)
+	}
+	if result.CacheHit {
+		t.Error("Decision was served from the cache after reload")
+	}
+
+	// A broken data file leaves the current data in place
+	if err := os.WriteFile(dataFile, []byte(`{`), 0o600); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if _, err := loader.ReloadData(engine); err == nil {
+		t.Error("ReloadData() error = nil for invalid JSON")
+	}
+	if allowed, _, _ := engine.IsAllowed(ctx, input); allowed {
+		t.Error("IsAllowed() = true after failed reload, want the previous blocklist kept")
+	}
+}
@@ -0,0 +1,228 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Obligation actions understood by the proxy.
+const (
+	ObligationLog   = "log"
+	ObligationAlert = "alert"
+)
+
+// Webhook delivery limits: deliveries are made by a fixed number of workers
+// from a bounded queue, so a slow endpoint can't pile up goroutines.
+const (
+	webhookWorkers   = 4
+	webhookQueueSize = 100
+)
+
+// ErrWebhookQueueFull is returned by WebhookHandler.Handle when the delivery
+// queue is full, or the handler closed, and the obligation is dropped.
+var ErrWebhookQueueFull = errors.New("webhook delivery queue full")
+
+// ObligationRequest describes the request an obligation was attached to.
+type ObligationRequest struct {
+	RequestID   string `json:"request_id"`
+	SessionID   string `json:"session_id"`
+	AgentID     string `json:"agent_id"`
+	Method      string `json:"method"`
+	Tool        string `json:"tool,omitempty"`
+	ResourceURI string `json:"resource_uri,omitempty"`
+}
+
+// ObligationHandler carries out a single obligation action.
+type ObligationHandler interface {
+	Handle(ctx context.Context, params map[string]string, req *ObligationRequest) error
+}
+
+// ObligationHandlerFunc adapts a function to the ObligationHandler interface.
+type ObligationHandlerFunc func(ctx context.Context, params map[string]string, req *ObligationRequest) error
+
+// Handle calls f(ctx, params, req).
+func (f ObligationHandlerFunc) Handle(ctx context.Context, params map[string]string, req *ObligationRequest) error {
+	return f(ctx, params, req)
+}
+
+// ObligationExecutor dispatches obligations to handlers registered by action.
+type ObligationExecutor struct {
+	mu       sync.RWMutex
+	handlers map[string]ObligationHandler
+}
+
+// NewObligationExecutor creates an executor with the default "log" handler registered.
+func NewObligationExecutor() *ObligationExecutor {
+	x := &ObligationExecutor{
+		handlers: make(map[string]ObligationHandler),
+	}
+	x.Register(ObligationLog, ObligationHandlerFunc(logObligation))
+	return x
+}
+
+// Register sets the handler for an action, replacing any existing one.
+func (x *ObligationExecutor) Register(action string, handler ObligationHandler) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.handlers[action] = handler
+}
+
+// Execute runs every obligation in order. Obligations without a registered
+// handler are skipped. Handler failures do not stop later obligations; they
+// are returned joined together.
+func (x *ObligationExecutor) Execute(ctx context.Context, obligations []PolicyObligation, req *ObligationRequest) error {
+	var errs []error
+	for _, obl := range obligations {
+		x.mu.RLock()
+		handler, ok := x.handlers[obl.Action]
+		x.mu.RUnlock()
+
+		if !ok {
+			log.Warn().
+				Str("action", obl.Action).
+				Str("request_id", req.RequestID).
+				Msg("No handler registered for obligation")
+			continue
+		}
+
+		if err := handler.Handle(ctx, obl.Params, req); err != nil {
+			errs = append(errs, fmt.Errorf("obligation %s: %w", obl.Action, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logObligation is the default "log" handler.
+func logObligation(ctx context.Context, params map[string]string, req *ObligationRequest) error {
+	event := log.Info().
+		Str("request_id", req.RequestID).
+		Str("session_id", req.SessionID).
+		Str("agent_id", req.AgentID).
+		Str("method", req.Method).
+		Str("tool", req.Tool)
+	for k, v := range params {
+		event = event.Str(k, v)
+	}
+	event.Msg("Policy obligation")
+	return nil
+}
+
+// WebhookHandler posts obligations as JSON to a webhook URL. Deliveries are
+// queued and made by background workers so a slow endpoint does not delay
+// the request; obligations that don't fit in the queue, or arrive after
+// Close, are dropped.
+type WebhookHandler struct {
+	url    string
+	action string
+	client *http.Client
+
+	queue chan webhookDelivery
+	wg    sync.WaitGroup
+
+	// closed is set by Close; mu keeps Handle from sending on the closed queue
+	mu     sync.RWMutex
+	closed bool
+}
+
+// webhookDelivery is one queued webhook post.
+type webhookDelivery struct {
+	body      []byte
+	requestID string
+}
+
+// NewWebhookHandler creates a handler that posts to url with the given timeout
+// and starts its workers. The action name is included in each payload.
+func NewWebhookHandler(url, action string, timeout time.Duration) *WebhookHandler {
+	h := &WebhookHandler{
+		url:    url,
+		action: action,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan webhookDelivery, webhookQueueSize),
+	}
+	h.wg.Add(webhookWorkers)
+	for i := 0; i < webhookWorkers; i++ {
+		go h.deliverLoop()
+	}
+	return h
+}
+
+// webhookPayload is the JSON body posted to the webhook.
+type webhookPayload struct {
+	Action    string             `json:"action"`
+	Params    map[string]string  `json:"params,omitempty"`
+	Request   *ObligationRequest `json:"request"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+// Handle queues a webhook delivery for the obligation.
+func (h *WebhookHandler) Handle(ctx context.Context, params map[string]string, req *ObligationRequest) error {
+	body, err := json.Marshal(webhookPayload{
+		Action:    h.action,
+		Params:    params,
+		Request:   req,
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return ErrWebhookQueueFull
+	}
+	select {
+	case h.queue <- webhookDelivery{body: body, requestID: req.RequestID}:
+		return nil
+	default:
+		return ErrWebhookQueueFull
+	}
+}
+
+// Close makes the deliveries still queued and stops the workers.
+func (h *WebhookHandler) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+
+	h.wg.Wait()
+	return nil
+}
+
+// deliverLoop makes queued deliveries until the queue is closed.
+func (h *WebhookHandler) deliverLoop() {
+	defer h.wg.Done()
+	for d := range h.queue {
+		h.deliver(d.body, d.requestID)
+	}
+}
+
+// deliver posts a payload, logging any failure.
+func (h *WebhookHandler) deliver(body []byte, requestID string) {
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Error().Err(err).Str("request_id", requestID).Msg("Obligation webhook delivery failed")
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Error().
+			Int("status", resp.StatusCode).
+			Str("request_id", requestID).
+			Msg("Obligation webhook returned error status")
+	}
+}
@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestObligationExecutor tests dispatching obligations to registered handlers.
+func TestObligationExecutor(t *testing.T) {
+	x := NewObligationExecutor()
+
+	var handled []string
+	x.Register(ObligationAlert, ObligationHandlerFunc(func(ctx context.Context, params map[string]string, req *ObligationRequest) error {
+		handled = append(handled, params["severity"]+":"+req.Tool)
+		return nil
+	}))
+	x.Register("notify", ObligationHandlerFunc(func(ctx context.Context, params map[string]string, req *ObligationRequest) error {
+		return errors.New("notifier unavailable")
+	}))
+
+	obligations := []PolicyObligation{
+		{Action: ObligationLog, Params: map[string]string{"reason": "sensitive"}},
+		{Action: "notify", Params: map[string]string{"channel": "security"}},
+		{Action: ObligationAlert, Params: map[string]string{"severity": "high"}},
+		{Action: "unknown"},
+	}
+	req := &ObligationRequest{RequestID: "req_1", Method: "tools/call", Tool: "delete_file"}
+
+	err := x.Execute(context.Background(), obligations, req)
+	if err == nil {
+		t.Fatal("Execute() expected notify handler error")
+	}
+
+	// A failing handler must not prevent later obligations from running
+	if len(handled) != 1 || handled[0] != "high:delete_file" {
+		t.Errorf("alert handler calls = %v, want [high:delete_file]", handled)
+	}
+
+	if err := x.Execute(context.Background(), nil, req); err != nil {
+		t.Errorf("Execute() with no obligations error = %v", err)
+	}
+}
+
+// TestWebhookHandler tests that alerts are posted to the webhook.
+func TestWebhookHandler(t *testing.T) {
+	received := make(chan webhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		received <- payload
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	handler := NewWebhookHandler(server.URL, ObligationAlert, time.Second)
+	req := &ObligationRequest{RequestID: "req_1", AgentID: "agent1", Tool: "delete_file"}
+
+	if err := handler.Handle(context.Background(), map[string]string{"severity": "high"}, req); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	select {
+	case payload := <-received:
+		if payload.Action != ObligationAlert {
+			t.Errorf("Action = %s, want alert", payload.Action)
+		}
+		if payload.Params["severity"] != "high" {
+			t.Errorf("Params = %v, want severity=high", payload.Params)
+		}
+		if payload.Request == nil || payload.Request.Tool != "delete_file" {
+			t.Errorf("Request = %+v, want tool delete_file", payload.Request)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Webhook was not called")
+	}
+}
+
+// TestWebhookHandlerQueueFull tests that alerts are dropped rather than
+// queued without bound while the webhook is slow, and after Close.
+func TestWebhookHandlerQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	handler := NewWebhookHandler(server.URL, ObligationAlert, 5*time.Second)
+	req := &ObligationRequest{RequestID: "req_1"}
+
+	// Workers block on the webhook, then the queue fills up
+	var dropped int
+	for i := 0; i < webhookWorkers+webhookQueueSize+10; i++ {
+		if err := handler.Handle(context.Background(), nil, req); errors.Is(err, ErrWebhookQueueFull) {
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		t.Error("Handle() never reported a full queue")
+	}
+
+	close(release)
+	if err := handler.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := handler.Handle(context.Background(), nil, req); !errors.Is(err, ErrWebhookQueueFull) {
+		t.Errorf("Handle() after Close error = %v, want ErrWebhookQueueFull", err)
+	}
+}
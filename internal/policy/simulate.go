@@ -0,0 +1,133 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Simulate evaluates each input against the loaded policies, bypassing the
+// decision cache so every input is evaluated fresh, and without counting
+// toward the engine's statistics. A failed evaluation is reported in the
+// result's Err rather than stopping the run.
+func (e *Engine) Simulate(ctx context.Context, inputs []*PolicyInput) []*EvaluationResult {
+	results := make([]*EvaluationResult, len(inputs))
+	for i, input := range inputs {
+		start := time.Now()
+		result := &EvaluationResult{
+			Input:      input,
+			PolicyMode: e.Mode(),
+		}
+
+		if !e.enabled {
+			result.Decision = &PolicyDecision{
+				Allow:       true,
+				MatchedRule: "policy_disabled",
+			}
+		} else if decision, err := e.evaluatePolicy(ctx, input); err != nil {
+			result.Err = err
+		} else {
+			result.Decision = decision
+		}
+
+		result.EvalTime = time.Since(start)
+		results[i] = result
+	}
+	return results
+}
+
+// TestCase is a sample input with the decision the policies should reach.
+type TestCase struct {
+	Name        string      `json:"name"`
+	Input       PolicyInput `json:"input"`
+	Expect      string      `json:"expect"`                 // "allow" or "deny"
+	MatchedRule string      `json:"matched_rule,omitempty"` // Checked when set
+}
+
+// TestCaseResult is the outcome of one test case.
+type TestCaseResult struct {
+	Case   TestCase
+	Result *EvaluationResult
+	Passed bool
+	Reason string // Why the case failed
+}
+
+// TestReport summarizes a run of test cases.
+type TestReport struct {
+	Results []TestCaseResult
+	Passed  int
+	Failed  int
+}
+
+// OK reports whether every test case passed.
+func (r *TestReport) OK() bool {
+	return r.Failed == 0
+}
+
+// LoadTestCases reads test cases from a JSON file holding an array of
+// cases, each with a name, a policy input and an expected "allow" or
+// "deny".
+func LoadTestCases(path string) ([]TestCase, error) {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test cases: %w", err)
+	}
+
+	var cases []TestCase
+	if err := json.Unmarshal(content, &cases); err != nil {
+		return nil, fmt.Errorf("failed to parse test cases %s: %w", path, err)
+	}
+	for i, tc := range cases {
+		if tc.Expect != "allow" && tc.Expect != "deny" {
+			return nil, fmt.Errorf("test case %d (%s): expect must be allow or deny, got %q", i, tc.Name, tc.Expect)
+		}
+	}
+	return cases, nil
+}
+
+// RunTestCases simulates every case on backend and compares the decisions
+// with the expected ones. Cases without a timestamp are evaluated at the
+// current time, as requests are.
+func RunTestCases(ctx context.Context, backend PolicyBackend, cases []TestCase) *TestReport {
+	inputs := make([]*PolicyInput, len(cases))
+	for i := range cases {
+		input := cases[i].Input
+		if input.Context.Timestamp.IsZero() {
+			input.Context.Timestamp = time.Now()
+		}
+		inputs[i] = &input
+	}
+
+	report := &TestReport{}
+	for i, result := range backend.Simulate(ctx, inputs) {
+		tr := TestCaseResult{Case: cases[i], Result: result}
+		switch {
+		case result.Err != nil:
+			tr.Reason = result.Err.Error()
+		case result.Decision.Allow != (cases[i].Expect == "allow"):
+			tr.Reason = fmt.Sprintf("expected %s, got %s", cases[i].Expect, decisionName(result.Decision.Allow))
+		case cases[i].MatchedRule != "" && result.Decision.MatchedRule != cases[i].MatchedRule:
+			tr.Reason = fmt.Sprintf("expected matched rule %q, got %q", cases[i].MatchedRule, result.Decision.MatchedRule)
+		default:
+			tr.Passed = true
+		}
+
+		if tr.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, tr)
+	}
+	return report
+}
+
+func decisionName(allow bool) string {
+	if allow {
+		return "allow"
+	}
+	return "deny"
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// simulatePolicy allows read_file and denies delete_file with a violation.
+const simulatePolicy = `
+package mcp.policy
+
+import rego.v1
+
+default allow := false
+
+allow if input.request.tool == "read_file"
+
+violations contains {"category": "blocklist", "message": "delete_file is not permitted"} if {
+	input.request.tool == "delete_file"
+}
+
+matched_rule := "read_only" if allow
+else := "default_deny"
+
+decision := {
+	"allow": allow,
+	"violations": violations,
+	"matched_rule": matched_rule,
+}
+`
+
+// newSimulateEngine returns an engine with simulatePolicy loaded.
+func newSimulateEngine(t *testing.T) *Engine {
+	t.Helper()
+
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+	if err := engine.LoadPolicies(context.Background(), map[string]string{"simulate.rego": simulatePolicy}); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+	return engine
+}
+
+// TestSimulate tests that each input is evaluated without touching the
+// decision cache or the engine's statistics.
+func TestSimulate(t *testing.T) {
+	engine := newSimulateEngine(t)
+	ctx := context.Background()
+
+	read := NewInputBuilder().WithAgent("agent1", "", nil).WithRequest("tools/call", "read_file", nil).Build()
+	del := NewInputBuilder().WithAgent("agent1", "", nil).WithRequest("tools/call", "delete_file", nil).Build()
+
+	results := engine.Simulate(ctx, []*PolicyInput{read, del, read})
+	if len(results) != 3 {
+		t.Fatalf("Simulate() returned %d results, want 3", len(results))
+	}
+	for i, want := range []bool{true, false, true} {
+		if results[i].Err != nil {
+			t.Fatalf("result %d error = %v", i, results[i].Err)
+		}
+		if results[i].Decision.Allow != want {
+			t.Errorf("result %d allow = %v, want %v", i, results[i].Decision.Allow, want)
+		}
+		if results[i].CacheHit {
+			t.Errorf("result %d was served from the cache", i)
+		}
+	}
+	if got := results[1].Decision.Violations; len(got) != 1 || got[0].Category != CategoryBlocklist {
+		t.Errorf("violations = %+v, want one blocklist violation", got)
+	}
+
+	if stats := engine.Stats(); stats.Evaluations != 0 {
+		t.Errorf("Evaluations = %d after Simulate, want 0", stats.Evaluations)
+	}
+	result, err := engine.Evaluate(ctx, read)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if result.CacheHit {
+		t.Error("Evaluate() hit the cache after Simulate, want a fresh evaluation")
+	}
+}
+
+// TestRunTestCases tests loading a suite of cases from a file and reporting
+// which pass and why the others fail.
+func TestRunTestCases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cases.json")
+	suite := `[
+		{"name": "read allowed", "input": {"request": {"method": "tools/call", "tool": "read_file"}}, "expect": "allow", "matched_rule": "read_only"},
+		{"name": "delete denied", "input": {"request": {"method": "tools/call", "tool": "delete_file"}}, "expect": "deny"},
+		{"name": "wrong expectation", "input": {"request": {"method": "tools/call", "tool": "delete_file"}}, "expect": "allow"},
+		{"name": "wrong rule", "input": {"request": {"method": "tools/call", "tool": "write_file"}}, "expect": "deny", "matched_rule": "blocked"}
+	]`
+	if err := os.WriteFile(path, []byte(suite), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	cases, err := LoadTestCases(path)
+	if err != nil {
+		t.Fatalf("LoadTestCases() error = %v", err)
+	}
+	report := RunTestCases(context.Background(), newSimulateEngine(t), cases)
+
+	if report.Passed != 2 || report.Failed != 2 || report.OK() {
+		t.Errorf("Passed = %d, Failed = %d, want 2 and 2", report.Passed, report.Failed)
+	}
+
+	tests := []struct {
+		name       string
+		wantPassed bool
+		wantReason string
+	}{
+		{name: "read allowed", wantPassed: true},
+		{name: "delete denied", wantPassed: true},
+		{name: "wrong expectation", wantReason: "expected allow, got deny"},
+		{name: "wrong rule", wantReason: `expected matched rule "blocked", got "default_deny"`},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := report.Results[i]
+			if got.Case.Name != tt.name {
+				t.Fatalf("result %d is %q, want %q", i, got.Case.Name, tt.name)
+			}
+			if got.Passed != tt.wantPassed || got.Reason != tt.wantReason {
+				t.Errorf("Passed = %v, Reason = %q, want %v, %q", got.Passed, got.Reason, tt.wantPassed, tt.wantReason)
+			}
+		})
+	}
+}
+
+// TestLoadTestCasesErrors tests that malformed suites are rejected.
+func TestLoadTestCasesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "invalid JSON", content: `{`, wantErr: "failed to parse test cases"},
+		{name: "missing expectation", content: `[{"name": "no expect", "input": {}}]`, wantErr: "expect must be allow or deny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cases.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+			_, err := LoadTestCases(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadTestCases() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"strings"
 	"time"
 )
 
@@ -26,19 +27,27 @@ type AgentContext struct {
 
 // RequestContext contains information about the request being made.
 type RequestContext struct {
-	Method    string                 `json:"method"`
-	Tool      string                 `json:"tool"`
-	Arguments map[string]interface{} `json:"arguments"`
-	Intent    string                 `json:"intent"`
+	Method      string                 `json:"method"`
+	Tool        string                 `json:"tool"`
+	ResourceURI string                 `json:"resource_uri"`
+	Prompt      string                 `json:"prompt"`
+	Arguments   map[string]interface{} `json:"arguments"`
+	Intent      string                 `json:"intent"`
 }
 
 // SessionContext contains information about the current session.
 type SessionContext struct {
-	ID               string    `json:"id"`
-	RequestCount     int       `json:"request_count"`
-	StartedAt        time.Time `json:"started_at"`
-	CumulativeReads  int       `json:"cumulative_reads"`
-	CumulativeWrites int       `json:"cumulative_writes"`
+	ID                string    `json:"id"`
+	RequestCount      int       `json:"request_count"`
+	StartedAt         time.Time `json:"started_at"`
+	CumulativeReads   int       `json:"cumulative_reads"`
+	CumulativeWrites  int       `json:"cumulative_writes"`
+	AuthTokenID       string    `json:"auth_token_id"`       // Fingerprint of the authenticating bearer token
+	ClientCertSubject string    `json:"client_cert_subject"` // Subject of the client's TLS certificate
+
+	// Declared by the client in its initialize request
+	ProtocolVersion    string                 `json:"protocol_version"`
+	ClientCapabilities map[string]interface{} `json:"client_capabilities"`
 }
 
 // IdentityContext contains verified identity information from AgentFacts.
@@ -61,11 +70,32 @@ type EnvironmentContext struct {
 // PolicyDecision is the output from OPA policy evaluation.
 type PolicyDecision struct {
 	Allow       bool               `json:"allow"`
-	Violations  []string           `json:"violations"`
+	Violations  []Violation        `json:"violations"`
 	MatchedRule string             `json:"matched_rule"`
+	FiredRules  []string           `json:"fired_rules,omitempty"` // Every rule that fired, if the policy reports them
 	Obligations []PolicyObligation `json:"obligations,omitempty"`
 }
 
+// Violation categories emitted by the bundled and compiled policies, so
+// alerting can match on the kind of denial rather than its wording.
+const (
+	CategoryCapability = "capability"
+	CategoryBlocklist  = "blocklist"
+	CategoryRateLimit  = "rate_limit"
+	CategoryIdentity   = "identity"
+	CategoryTimeWindow = "time_window"
+	CategoryIPRange    = "ip_range"
+	CategoryCustom     = "custom"
+)
+
+// Violation is one reason a policy denied a request. Policies that report
+// plain strings produce violations with only a Message.
+type Violation struct {
+	Category string `json:"category,omitempty"`
+	Message  string `json:"message"`
+	Detail   string `json:"detail,omitempty"`
+}
+
 // PolicyObligation represents an action that must be taken (e.g., log, alert).
 type PolicyObligation struct {
 	Action string            `json:"action"` // "log", "alert", "rate_limit"
@@ -77,6 +107,7 @@ type PolicyData struct {
 	ToolCapabilities      map[string]string `json:"tool_capabilities"`
 	RateLimits            map[string]int    `json:"rate_limits"`
 	BlockedTools          []string          `json:"blocked_tools"`
+	BlockedResources      []string          `json:"blocked_resources"` // Glob patterns matched against resource URIs
 	BlockedAgents         []string          `json:"blocked_agents"`
 	BlockedDIDs           []string          `json:"blocked_dids"`
 	AllowedDIDs           []string          `json:"allowed_dids"`
@@ -86,14 +117,28 @@ type PolicyData struct {
 	BlockedModelsForPII   []string          `json:"blocked_models_for_pii"`
 }
 
+// WriteTools returns the tools whose required capability grants write or
+// admin access, such as "write:customers" or "admin:*".
+func (pd *PolicyData) WriteTools() map[string]bool {
+	tools := make(map[string]bool)
+	for tool, capability := range pd.ToolCapabilities {
+		if strings.HasPrefix(capability, "write:") || strings.HasPrefix(capability, "admin:") {
+			tools[tool] = true
+		}
+	}
+	return tools
+}
+
 // EvaluationResult contains the full result of a policy evaluation.
 type EvaluationResult struct {
 	Decision   *PolicyDecision
 	Input      *PolicyInput
 	EvalTime   time.Duration
 	CacheHit   bool
-	CacheTier  string // "L1", "L2", or ""
-	PolicyMode string // "audit" or "enforce"
+	CacheTier  string   // "L1", "L2", or ""
+	PolicyMode string   // "audit" or "enforce"
+	Trace      []string // Rules that fired, set by EvaluateWithExplain
+	Err        error    // Evaluation failure, set by Simulate instead of returning it
 }
 
 // InputBuilder helps construct PolicyInput from various sources.
@@ -140,6 +185,18 @@ func (b *InputBuilder) WithRequest(method, tool string, arguments map[string]int
 	return b
 }
 
+// WithResource sets the resource URI for resource requests.
+func (b *InputBuilder) WithResource(uri string) *InputBuilder {
+	b.input.Request.ResourceURI = uri
+	return b
+}
+
+// WithPrompt sets the prompt name for prompts/get requests.
+func (b *InputBuilder) WithPrompt(name string) *InputBuilder {
+	b.input.Request.Prompt = name
+	return b
+}
+
 // WithSession sets the session context.
 func (b *InputBuilder) WithSession(id string, requestCount int, startedAt time.Time) *InputBuilder {
 	b.input.Session = SessionContext{
@@ -150,6 +207,36 @@ func (b *InputBuilder) WithSession(id string, requestCount int, startedAt time.T
 	return b
 }
 
+// WithCumulativeCounts sets the session's cumulative read and write counts.
+// Must be called after WithSession.
+func (b *InputBuilder) WithCumulativeCounts(reads, writes int) *InputBuilder {
+	b.input.Session.CumulativeReads = reads
+	b.input.Session.CumulativeWrites = writes
+	return b
+}
+
+// WithAuthToken sets the fingerprint of the token that authenticated the session.
+// Must be called after WithSession.
+func (b *InputBuilder) WithAuthToken(tokenID string) *InputBuilder {
+	b.input.Session.AuthTokenID = tokenID
+	return b
+}
+
+// WithClientCert sets the subject of the client's TLS certificate.
+// Must be called after WithSession.
+func (b *InputBuilder) WithClientCert(subject string) *InputBuilder {
+	b.input.Session.ClientCertSubject = subject
+	return b
+}
+
+// WithInitialize sets the protocol version and capabilities the client
+// declared in initialize. Must be called after WithSession.
+func (b *InputBuilder) WithInitialize(protocolVersion string, capabilities map[string]interface{}) *InputBuilder {
+	b.input.Session.ProtocolVersion = protocolVersion
+	b.input.Session.ClientCapabilities = capabilities
+	return b
+}
+
 // WithIdentity sets the identity context.
 func (b *InputBuilder) WithIdentity(verified bool, did string) *InputBuilder {
 	b.input.Identity = IdentityContext{
@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/agentfacts/mcp-proxy/internal/policy/compiler"
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// PolicyIssue is an error or warning found in a policy file.
+type PolicyIssue struct {
+	File    string
+	Line    int // 0 when the issue has no specific line
+	Message string
+}
+
+// String formats the issue as "file:line: message".
+func (i PolicyIssue) String() string {
+	switch {
+	case i.File == "":
+		return i.Message
+	case i.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+	default:
+		return i.File + ": " + i.Message
+	}
+}
+
+// ValidationReport collects the results of validating the policy files.
+type ValidationReport struct {
+	Errors   []PolicyIssue
+	Warnings []PolicyIssue
+	Modules  int // Rego modules compiled, when there are no errors
+}
+
+// OK reports whether validation found no errors.
+func (r *ValidationReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Err returns the validation errors joined into one error, or nil.
+func (r *ValidationReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	errs := make([]error, len(r.Errors))
+	for i, issue := range r.Errors {
+		errs[i] = errors.New(issue.String())
+	}
+	return errors.Join(errs...)
+}
+
+func (r *ValidationReport) addError(file string, err error) {
+	// Rego errors carry their own locations; report each one separately
+	var astErrs ast.Errors
+	if errors.As(err, &astErrs) {
+		for _, e := range astErrs {
+			issue := PolicyIssue{File: file, Message: e.Message}
+			if e.Location != nil {
+				issue.File = e.Location.File
+				issue.Line = e.Location.Row
+			}
+			r.Errors = append(r.Errors, issue)
+		}
+		return
+	}
+	r.Errors = append(r.Errors, PolicyIssue{File: file, Message: err.Error()})
+}
+
+// Validate parses every .rego file, compiles every JSON policy, and compiles
+// the resulting modules together with the policy data, as the engine would at
+// startup. Unlike LoadPolicies it does not stop at the first bad file: every
+// error is reported against the file it came from, along with JSON compiler
+// warnings.
+func (l *Loader) Validate(ctx context.Context) *ValidationReport {
+	report := &ValidationReport{}
+	modules := make(map[string]string)
+
+	// Rego files are parsed one at a time so syntax errors name their file
+	files, err := filepath.Glob(filepath.Join(l.policyDir, "*.rego"))
+	if err != nil {
+		report.addError(l.policyDir, err)
+		return report
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.rego") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			report.addError(file, err)
+			continue
+		}
+		if _, err := ast.ParseModule(file, string(content)); err != nil {
+			report.addError(file, err)
+			continue
+		}
+		modules[filepath.Base(file)] = string(content)
+	}
+	if len(files) == 0 {
+		report.addError(l.policyDir, fmt.Errorf("no .rego files found"))
+	}
+
+	// JSON policies
+	jsonFiles, _ := filepath.Glob(filepath.Join(l.jsonPolicyDir, "*.json"))
+	for _, file := range jsonFiles {
+		content, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			report.addError(file, err)
+			continue
+		}
+
+		var def compiler.PolicyDefinition
+		if err := json.Unmarshal(content, &def); err != nil {
+			report.addError(file, fmt.Errorf("invalid JSON: %w", err))
+			continue
+		}
+
+		result, err := l.compiler.Compile(&def)
+		if err != nil {
+			report.addError(file, err)
+			continue
+		}
+		for _, warn := range result.Warnings {
+			report.Warnings = append(report.Warnings, PolicyIssue{File: file, Message: warn})
+		}
+		for name, content := range result.Modules {
+			if _, exists := modules[name]; exists {
+				report.Warnings = append(report.Warnings, PolicyIssue{
+					File:    file,
+					Message: fmt.Sprintf("generated module %s conflicts with a Rego file, Rego takes precedence", name),
+				})
+				continue
+			}
+			modules[name] = content
+		}
+	}
+
+	// Compile everything together, with the policy data the engine would use
+	engine := NewEngine(EngineConfig{Enabled: true})
+	if l.dataFile != "" {
+		data, err := l.LoadPolicyData()
+		if err != nil {
+			report.addError(l.dataFile, err)
+		} else if err := engine.SetPolicyData(data); err != nil {
+			report.addError(l.dataFile, err)
+		}
+	}
+
+	if !report.OK() {
+		return report
+	}
+
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		report.addError("", err)
+		return report
+	}
+
+	report.Modules = len(modules)
+	return report
+}
@@ -0,0 +1,102 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePolicyFiles writes files (relative path -> content) under a new
+// policy directory and returns it.
+func writePolicyFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// TestValidate tests per-file validation of Rego and JSON policies.
+func TestValidate(t *testing.T) {
+	const allow = "package mcp.policy\n\ndecision = {\"allow\": true}\n"
+
+	tests := []struct {
+		name       string
+		files      map[string]string
+		wantErrors []string // substrings of reported errors, in order
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"main.rego": allow},
+		},
+		{
+			name:  "test files skipped",
+			files: map[string]string{"main.rego": allow, "main_test.rego": "package broken {"},
+		},
+		{
+			name:       "no rego files",
+			files:      map[string]string{"README": ""},
+			wantErrors: []string{"no .rego files found"},
+		},
+		{
+			name: "syntax error names file and line",
+			files: map[string]string{
+				"main.rego":   allow,
+				"broken.rego": "package mcp.policy\n\nx = {\n",
+			},
+			wantErrors: []string{"broken.rego:4: unexpected eof", "broken.rego:4: unexpected eof"},
+		},
+		{
+			name: "invalid JSON policy",
+			files: map[string]string{
+				"main.rego":      allow,
+				"json/bad.json":  `{"version":`,
+				"json/also.json": `{}`,
+			},
+			wantErrors: []string{"also.json", "bad.json: invalid JSON"},
+		},
+		{
+			name: "conflicting rules across files",
+			files: map[string]string{
+				"a.rego": "package mcp.policy\n\ndefault x = false\n",
+				"b.rego": "package mcp.policy\n\ndefault x = true\n",
+			},
+			wantErrors: []string{"multiple default rules"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePolicyFiles(t, tt.files)
+			report := NewLoader(dir, "").Validate(context.Background())
+
+			if len(report.Errors) != len(tt.wantErrors) {
+				t.Fatalf("Errors = %v, want %d", report.Errors, len(tt.wantErrors))
+			}
+			for i, want := range tt.wantErrors {
+				if got := report.Errors[i].String(); !strings.Contains(got, want) {
+					t.Errorf("Errors[%d] = %q, want it to contain %q", i, got, want)
+				}
+			}
+			if report.OK() != (len(tt.wantErrors) == 0) {
+				t.Errorf("OK() = %v", report.OK())
+			}
+			if report.OK() && report.Modules == 0 {
+				t.Error("Modules = 0 for a valid policy set")
+			}
+			if (report.Err() == nil) != report.OK() {
+				t.Errorf("Err() = %v, want nil only when OK", report.Err())
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrWarmUpSkipped is returned by Engine.WarmUp when the policies read
+// inputs decisions are not cached on.
+var ErrWarmUpSkipped = errors.New("policies read inputs decisions are not cached on")
+
+// WarmUpInputs builds a tools/call input for every combination of agent and
+// tool. If tools is empty, every tool in data's tool_capabilities is used.
+// Only the agent and tool are set, so the decisions cached for them are
+// served to requests by that agent for that tool that leave every other
+// field the policies read unset too.
+func WarmUpInputs(data *PolicyData, agents []AgentContext, tools []string) []*PolicyInput {
+	if len(tools) == 0 && data != nil {
+		for tool := range data.ToolCapabilities {
+			tools = append(tools, tool)
+		}
+		sort.Strings(tools)
+	}
+
+	inputs := make([]*PolicyInput, 0, len(agents)*len(tools))
+	for _, agent := range agents {
+		for _, tool := range tools {
+			input := NewInputBuilder().
+				WithAgent(agent.ID, agent.Name, agent.Capabilities).
+				WithRequest("tools/call", tool, nil).
+				Build()
+			input.Agent.Model = agent.Model
+			input.Agent.Publisher = agent.Publisher
+			input.Agent.Tags = agent.Tags
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+// WarmUp evaluates inputs and caches their decisions, so that the first
+// real requests after startup are served from the cache. Warm-up
+// evaluations are not counted in Stats or written to the decision log.
+// It returns the number of decisions cached; inputs that fail to evaluate
+// are skipped and their errors returned together. Nothing is evaluated if
+// the engine or its cache is disabled, and ErrWarmUpSkipped is returned if
+// the policies read inputs decisions are not cached on. Warm-up inputs leave
+// most fields unset; decisions for them are keyed on those the policies
+// read, so they are only served to requests that leave them unset too.
+func (e *Engine) WarmUp(ctx context.Context, inputs []*PolicyInput) (int, error) {
+	if !e.enabled || !e.cache.enabled {
+		return 0, nil
+	}
+	if e.bypassCache.Load() {
+		return 0, ErrWarmUpSkipped
+	}
+
+	cached := 0
+	var errs []error
+	for _, input := range inputs {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		decision, err := e.evaluatePolicy(ctx, input)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("agent %s, tool %s: %w", input.Agent.ID, input.Request.Tool, err))
+			continue
+		}
+		e.cache.Set(e.cacheKey(input), decision)
+		cached++
+	}
+
+	return cached, errors.Join(errs...)
+}
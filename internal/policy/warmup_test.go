@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestWarmUp tests that warm-up fills the decision cache without counting
+// evaluations, so the next matching request is a cache hit.
+func TestWarmUp(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:    "enforce",
+		Enabled: true,
+		CacheConfig: CacheConfig{
+			Enabled:    true,
+			TTL:        1 * time.Minute,
+			MaxEntries: 100,
+		},
+	})
+
+	modules := map[string]string{
+		"warmup.rego": `
+package mcp.policy
+
+decision = {
+	"allow": true,
+	"matched_rule": "allow_all",
+	"violations": []
+}
+`,
+	}
+
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	data := &PolicyData{
+		ToolCapabilities: map[string]string{
+			"read_file":   "read:files",
+			"write_file":  "write:files",
+			"list_tables": "read:db",
+		},
+	}
+	agents := []AgentContext{
+		{ID: "agent1", Capabilities: []string{"read:*"}},
+		{ID: "agent2", Capabilities: []string{"read:*", "write:files"}},
+	}
+
+	inputs := WarmUpInputs(data, agents, nil)
+	if len(inputs) != 6 {
+		t.Fatalf("WarmUpInputs() returned %d inputs, want 6", len(inputs))
+	}
+	if got := len(WarmUpInputs(data, agents, []string{"read_file"})); got != 2 {
+		t.Errorf("WarmUpInputs() with tools returned %d inputs, want 2", got)
+	}
+
+	cached, err := engine.WarmUp(ctx, inputs)
+	if err != nil {
+		t.Fatalf("WarmUp() error = %v", err)
+	}
+	if cached != 6 {
+		t.Errorf("WarmUp() cached %d, want 6", cached)
+	}
+
+	stats := engine.Stats()
+	if stats.CacheStats.Entries != 6 {
+		t.Errorf("cache entries = %d, want 6", stats.CacheStats.Entries)
+	}
+	if stats.Evaluations != 0 {
+		t.Errorf("evaluations = %d, want 0", stats.Evaluations)
+	}
+
+	// A request differing only outside the cache key is served from the cache
+	input := NewInputBuilder().
+		WithAgent("agent2", "Agent Two", []string{"write:files", "read:*"}).
+		WithRequest("tools/call", "write_file", map[string]interface{}{"path": "/tmp/x"}).
+		WithSession("sess_1", 3, time.Now()).
+		Build()
+	result, err := engine.Evaluate(ctx, input)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if !result.CacheHit {
+		t.Error("Evaluate() after warm-up should be a cache hit")
+	}
+}
+
+// TestWarmUpKeyedInputs tests that a decision warmed up for an input the
+// warm-up inputs leave unset is not served to requests that set it.
+func TestWarmUpKeyedInputs(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		setup func(*PolicyInput)
+	}{
+		{
+			name:  "arguments",
+			body:  `input.request.arguments.path != "/etc/passwd"`,
+			setup: func(in *PolicyInput) { in.Request.Arguments = map[string]interface{}{"path": "/etc/passwd"} },
+		},
+		{
+			name:  "environment",
+			body:  `input.context.environment != "production"`,
+			setup: func(in *PolicyInput) { in.Context.Environment = "production" },
+		},
+		{
+			name:  "session",
+			body:  `input.session.request_count < 100`,
+			setup: func(in *PolicyInput) { in.Session.RequestCount = 100 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(EngineConfig{
+				Mode:        "enforce",
+				Enabled:     true,
+				CacheConfig: CacheConfig{Enabled: true, TTL: time.Minute},
+			})
+
+			modules := map[string]string{"warmup.rego": `
+package mcp.policy
+
+import rego.v1
+
+default decision := {"allow": false, "matched_rule": "denied", "violations": []}
+
+decision := {"allow": true, "matched_rule": "allowed", "violations": []} if {
+	` + tt.body + `
+}
+`}
+			ctx := context.Background()
+			if err := engine.LoadPolicies(ctx, modules); err != nil {
+				t.Fatalf("LoadPolicies() error = %v", err)
+			}
+
+			inputs := WarmUpInputs(nil, []AgentContext{{ID: "agent1"}}, []string{"read_file"})
+			if cached, err := engine.WarmUp(ctx, inputs); err != nil || cached != 1 {
+				t.Fatalf("WarmUp() = %d, %v, want 1, nil", cached, err)
+			}
+
+			input := NewInputBuilder().
+				WithAgent("agent1", "", nil).
+				WithRequest("tools/call", "read_file", nil).
+				Build()
+			tt.setup(input)
+			result, err := engine.Evaluate(ctx, input)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if result.Decision.Allow || result.CacheHit {
+				t.Errorf("Allow = %v, CacheHit = %v, want a fresh deny", result.Decision.Allow, result.CacheHit)
+			}
+		})
+	}
+}
+
+// TestWarmUpSkipped tests that nothing is cached when the policies read
+// inputs decisions are not cached on.
+func TestWarmUpSkipped(t *testing.T) {
+	engine := NewEngine(EngineConfig{
+		Mode:        "enforce",
+		Enabled:     true,
+		CacheConfig: CacheConfig{Enabled: true, TTL: time.Minute},
+	})
+
+	modules := map[string]string{"warmup.rego": `
+package mcp.policy
+
+import rego.v1
+
+default decision := {"allow": false, "matched_rule": "denied", "violations": []}
+
+decision := {"allow": true, "matched_rule": "allowed", "violations": []} if {
+	time.weekday(time.parse_rfc3339_ns(input.context.timestamp)) != "Sunday"
+}
+`}
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	inputs := WarmUpInputs(nil, []AgentContext{{ID: "agent1"}}, []string{"read_file"})
+	cached, err := engine.WarmUp(ctx, inputs)
+	if !errors.Is(err, ErrWarmUpSkipped) {
+		t.Errorf("WarmUp() error = %v, want ErrWarmUpSkipped", err)
+	}
+	if cached != 0 {
+		t.Errorf("WarmUp() cached %d, want 0", cached)
+	}
+	if entries := engine.Stats().CacheStats.Entries; entries != 0 {
+		t.Errorf("cache entries = %d, want 0", entries)
+	}
+}
@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultWatchDebounce is how long policy files must be unchanged before a
+// reload.
+const DefaultWatchDebounce = time.Second
+
+// WatchForChanges monitors the .rego files in the policy directory and the
+// .json files in the JSON policy directory with fsnotify, recompiling and
+// swapping the engine's policies when they change. A reload waits until no
+// file has changed for the debounce period so that editors writing in
+// several steps trigger a single reload. If the new policies fail to load
+// or compile, the error is logged and the previous policies stay active.
+// onChange, if non-nil, is called after each successful reload.
+// WatchForChanges blocks until ctx is cancelled, and returns an error if
+// the policy directory can't be watched.
+func (l *Loader) WatchForChanges(ctx context.Context, engine *Engine, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create policy watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(l.policyDir); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", l.policyDir, err)
+	}
+	l.watchJSONDir(watcher)
+
+	log.Info().
+		Str("dir", l.policyDir).
+		Str("json_dir", l.jsonPolicyDir).
+		Msg("Watching policy files for changes")
+
+	// Stopped until a change arms it
+	debounce := time.NewTimer(l.watchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// The JSON policy directory may be created after watching starts
+			if event.Has(fsnotify.Create) && event.Name == l.jsonPolicyDir {
+				l.watchJSONDir(watcher)
+			}
+			if l.isPolicyFile(event.Name) {
+				debounce.Reset(l.watchDebounce)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Warn().Err(err).Msg("Policy watcher error")
+
+		case <-debounce.C:
+			if l.reload(ctx, engine) && onChange != nil {
+				onChange()
+			}
+		}
+	}
+}
+
+// watchJSONDir adds the JSON policy directory to watcher if it exists.
+func (l *Loader) watchJSONDir(watcher *fsnotify.Watcher) {
+	if l.jsonPolicyDir == "" {
+		return
+	}
+	if info, err := os.Stat(l.jsonPolicyDir); err != nil || !info.IsDir() {
+		return
+	}
+	if err := watcher.Add(l.jsonPolicyDir); err != nil {
+		log.Warn().Err(err).Str("dir", l.jsonPolicyDir).Msg("Failed to watch JSON policy directory")
+	}
+}
+
+// isPolicyFile reports whether path is a file WatchForChanges reloads for:
+// a .rego file in the policy directory or a .json file in the JSON policy
+// directory.
+func (l *Loader) isPolicyFile(path string) bool {
+	dir := filepath.Dir(path)
+	switch filepath.Ext(path) {
+	case ".rego":
+		return dir == filepath.Clean(l.policyDir)
+	case ".json":
+		return l.jsonPolicyDir != "" && dir == filepath.Clean(l.jsonPolicyDir)
+	}
+	return false
+}
+
+// reload recompiles the policy files into the engine, reporting success.
+func (l *Loader) reload(ctx context.Context, engine *Engine) bool {
+	modules, err := l.loadModules(true)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reload policies, keeping previous policies")
+		return false
+	}
+
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		log.Error().Err(err).Msg("Failed to compile reloaded policies, keeping previous policies")
+		return false
+	}
+
+	log.Info().Int("count", len(modules)).Msg("Policies reloaded")
+	return true
+}
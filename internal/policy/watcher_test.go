@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	watchAllowPolicy = `package mcp.policy
+
+decision = {"allow": true, "matched_rule": "allow_all"}
+`
+	watchDenyPolicy = `package mcp.policy
+
+decision = {"allow": false, "matched_rule": "deny_all", "violations": ["denied"]}
+`
+)
+
+// waitForRule polls the engine until the decision's matched rule is want.
+func waitForRule(t *testing.T, engine *Engine, input *PolicyInput, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		result, err := engine.Evaluate(context.Background(), input)
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		if result.Decision.MatchedRule == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Decision did not change to %s", want)
+}
+
+// TestWatchForChanges tests that policy file changes are picked up and that
+// a broken policy keeps the previous one active.
+func TestWatchForChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.rego")
+	if err := os.WriteFile(path, []byte(watchAllowPolicy), 0o600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+
+	loader := NewLoader(dir, "", WithWatchDebounce(20*time.Millisecond))
+
+	modules, err := loader.LoadPolicies()
+	if err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	engine := NewEngine(EngineConfig{Mode: "enforce", Enabled: true})
+	ctx := context.Background()
+	if err := engine.LoadPolicies(ctx, modules); err != nil {
+		t.Fatalf("LoadPolicies() error = %v", err)
+	}
+
+	input := NewInputBuilder().
+		WithAgent("agent1", "Test Agent", []string{"read"}).
+		WithRequest("tools/call", "read_file", nil).
+		Build()
+	waitForRule(t, engine, input, "allow_all")
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	reloaded := make(chan struct{}, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- loader.WatchForChanges(watchCtx, engine, func() { reloaded <- struct{}{} })
+	}()
+
+	// Let the watcher start watching before changing the file
+	time.Sleep(20 * time.Millisecond)
+
+	if err := os.WriteFile(path, []byte(watchDenyPolicy), 0o600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+	waitForRule(t, engine, input, "deny_all")
+
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onChange was not called")
+	}
+
+	// A policy that fails to compile is ignored
+	if err := os.WriteFile(path, []byte("package mcp.policy\n\ndecision = {"), 0o600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	result, err := engine.Evaluate(ctx, input)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if result.Decision.MatchedRule != "deny_all" {
+		t.Errorf("MatchedRule = %s, want previous policy deny_all", result.Decision.MatchedRule)
+	}
+	select {
+	case <-reloaded:
+		t.Error("onChange should not be called for a broken policy")
+	default:
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("WatchForChanges() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WatchForChanges() did not return after cancel")
+	}
+}
@@ -0,0 +1,74 @@
+package router
+
+import (
+	json "github.com/goccy/go-json"
+)
+
+// listItemKeep decides whether a single list entry survives filtering.
+// It returns the entry's display name (for logging) and whether to keep it.
+type listItemKeep func(item json.RawMessage) (name string, keep bool)
+
+// filterListResponse removes entries from result.<key> in a JSON-RPC list
+// response. Envelope fields and the remaining entries' order are preserved.
+// Responses that are errors or not shaped like a list are returned unchanged.
+func filterListResponse(response []byte, key string, keep listItemKeep) ([]byte, []string, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(response, &envelope); err != nil {
+		return response, nil, nil
+	}
+
+	resultRaw, ok := envelope["result"]
+	if !ok {
+		return response, nil, nil
+	}
+
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(resultRaw, &result); err != nil {
+		return response, nil, nil
+	}
+
+	itemsRaw, ok := result[key]
+	if !ok {
+		return response, nil, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(itemsRaw, &items); err != nil {
+		return response, nil, nil
+	}
+
+	kept := make([]json.RawMessage, 0, len(items))
+	var removed []string
+	for _, item := range items {
+		name, ok := keep(item)
+		if !ok {
+			removed = append(removed, name)
+			continue
+		}
+		kept = append(kept, item)
+	}
+
+	// Nothing removed - return the upstream bytes untouched
+	if len(removed) == 0 {
+		return response, nil, nil
+	}
+
+	newItems, err := json.Marshal(kept)
+	if err != nil {
+		return nil, nil, err
+	}
+	result[key] = newItems
+
+	newResult, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, err
+	}
+	envelope["result"] = newResult
+
+	filtered, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return filtered, removed, nil
+}
@@ -0,0 +1,126 @@
+package router
+
+import "fmt"
+
+// MethodFilter decides which JSON-RPC methods the router forwards. Rejected
+// methods are answered with CodeMethodNotFound.
+type MethodFilter struct {
+	allow       map[string]bool // nil means no allowlist
+	deny        map[string]bool
+	known       map[string]bool // Known methods beyond MethodRegistry
+	denyUnknown bool
+}
+
+// NewMethodFilter creates a method filter. If allow is non-empty only those
+// methods pass; methods in deny never pass. With denyUnknown, methods not in
+// MethodRegistry are rejected instead of passed through.
+func NewMethodFilter(allow, deny []string, denyUnknown bool) *MethodFilter {
+	f := &MethodFilter{
+		deny:        make(map[string]bool, len(deny)),
+		denyUnknown: denyUnknown,
+	}
+	if len(allow) > 0 {
+		f.allow = make(map[string]bool, len(allow))
+		for _, m := range allow {
+			f.allow[m] = true
+		}
+	}
+	for _, m := range deny {
+		f.deny[m] = true
+	}
+	return f
+}
+
+// AddKnown marks methods as known, so denyUnknown lets them through.
+func (f *MethodFilter) AddKnown(methods ...string) {
+	if f.known == nil {
+		f.known = make(map[string]bool, len(methods))
+	}
+	for _, m := range methods {
+		f.known[m] = true
+	}
+}
+
+// Allowed reports whether method may be forwarded.
+func (f *MethodFilter) Allowed(method string) bool {
+	if f.deny[method] {
+		return false
+	}
+	if f.allow != nil {
+		return f.allow[method]
+	}
+	if f.denyUnknown {
+		_, known := MethodRegistry[method]
+		return known || f.known[method]
+	}
+	return true
+}
+
+// ParseHandlerType converts a handler name as reported in logs
+// ("passthrough", "enforce" or "filter") to its HandlerType.
+func ParseHandlerType(name string) (HandlerType, error) {
+	switch name {
+	case "passthrough":
+		return HandlerPassthrough, nil
+	case "enforce":
+		return HandlerFullEnforce, nil
+	case "filter":
+		return HandlerFilter, nil
+	default:
+		return 0, fmt.Errorf("unknown handler: %s (must be passthrough, enforce, or filter)", name)
+	}
+}
+
+// ParseLogLevel converts a log level name ("none", "metadata" or "full") to
+// its LogLevel.
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch name {
+	case "none":
+		return LogNone, nil
+	case "metadata":
+		return LogMetadata, nil
+	case "full":
+		return LogFull, nil
+	default:
+		return 0, fmt.Errorf("unknown log level: %s (must be none, metadata, or full)", name)
+	}
+}
+
+// filterMethods are the methods whose responses handleFilter knows how to
+// filter.
+var filterMethods = map[string]bool{"tools/list": true, "resources/list": true}
+
+// NewMethodOverride returns method's configuration with the handler and log
+// level replaced by the named ones. An empty name keeps the built-in value,
+// or the unknown-method default for methods not in MethodRegistry. Moving an
+// enforced method to another handler turns off its policy checks, so it is
+// an error unless allowUnenforced is set.
+func NewMethodOverride(method, handler, logLevel string, allowUnenforced bool) (MethodConfig, error) {
+	cfg, ok := MethodRegistry[method]
+	if !ok {
+		cfg = unknownMethodConfig
+	}
+
+	if handler != "" {
+		h, err := ParseHandlerType(handler)
+		if err != nil {
+			return MethodConfig{}, fmt.Errorf("method %s: %w", method, err)
+		}
+		if h == HandlerFilter && !filterMethods[method] {
+			return MethodConfig{}, fmt.Errorf("method %s: filter only applies to tools/list and resources/list", method)
+		}
+		if cfg.Handler == HandlerFullEnforce && h != HandlerFullEnforce && !allowUnenforced {
+			return MethodConfig{}, fmt.Errorf("method %s: handler %s turns off enforcement (set allow_unenforced to allow it)", method, handler)
+		}
+		cfg.Handler = h
+	}
+	if logLevel != "" {
+		l, err := ParseLogLevel(logLevel)
+		if err != nil {
+			return MethodConfig{}, fmt.Errorf("method %s: %w", method, err)
+		}
+		cfg.LogLevel = l
+	}
+
+	return cfg, nil
+}
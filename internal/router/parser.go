@@ -1,6 +1,7 @@
 package router
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
 	"strings"
@@ -100,6 +101,33 @@ func (p *Parser) Parse(data []byte) (*Request, error) {
 	return req, nil
 }
 
+// IsBatch returns true if the message is a JSON-RPC batch (top-level array).
+func (p *Parser) IsBatch(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// ParseBatch splits a JSON-RPC batch into its raw elements.
+// Each element must still be validated with Parse.
+func (p *Parser) ParseBatch(data []byte) ([]json.RawMessage, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, &ParseError{
+			Code:    CodeParseError,
+			Message: fmt.Sprintf("Invalid JSON: %v", err),
+		}
+	}
+
+	if len(elements) == 0 {
+		return nil, &ParseError{
+			Code:    CodeInvalidRequest,
+			Message: "Empty batch",
+		}
+	}
+
+	return elements, nil
+}
+
 // ParseToolCall extracts tool call parameters from a request.
 func (p *Parser) ParseToolCall(req *Request) (*ToolCallParams, error) {
 	if req.Params == nil {
@@ -127,12 +155,32 @@ func (p *Parser) ParseToolCall(req *Request) (*ToolCallParams, error) {
 	return &params, nil
 }
 
-// ParseResourceRead extracts resource read parameters from a request.
+// ParseInitialize extracts initialize parameters from a request. Missing
+// params are left for the upstream to reject, and the protocol version is
+// not checked here.
+func (p *Parser) ParseInitialize(req *Request) (*InitializeParams, error) {
+	var params InitializeParams
+	if req.Params == nil {
+		return &params, nil
+	}
+
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, &ParseError{
+			Code:    CodeInvalidParams,
+			Message: fmt.Sprintf("Invalid initialize params: %v", err),
+		}
+	}
+
+	return &params, nil
+}
+
+// ParseResourceRead extracts resource read parameters from a request. The
+// same parameters are used by resources/subscribe and resources/unsubscribe.
 func (p *Parser) ParseResourceRead(req *Request) (*ResourceReadParams, error) {
 	if req.Params == nil {
 		return nil, &ParseError{
 			Code:    CodeInvalidParams,
-			Message: "Missing 'params' for resources/read",
+			Message: "Missing 'params' for " + req.Method,
 		}
 	}
 
@@ -140,14 +188,41 @@ func (p *Parser) ParseResourceRead(req *Request) (*ResourceReadParams, error) {
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return nil, &ParseError{
 			Code:    CodeInvalidParams,
-			Message: fmt.Sprintf("Invalid resources/read params: %v", err),
+			Message: fmt.Sprintf("Invalid %s params: %v", req.Method, err),
 		}
 	}
 
 	if params.URI == "" {
 		return nil, &ParseError{
 			Code:    CodeInvalidParams,
-			Message: "Missing 'uri' in resources/read params",
+			Message: "Missing 'uri' in " + req.Method + " params",
+		}
+	}
+
+	return &params, nil
+}
+
+// ParsePromptGet extracts prompt get parameters from a request.
+func (p *Parser) ParsePromptGet(req *Request) (*PromptGetParams, error) {
+	if req.Params == nil {
+		return nil, &ParseError{
+			Code:    CodeInvalidParams,
+			Message: "Missing 'params' for prompts/get",
+		}
+	}
+
+	var params PromptGetParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, &ParseError{
+			Code:    CodeInvalidParams,
+			Message: fmt.Sprintf("Invalid prompts/get params: %v", err),
+		}
+	}
+
+	if params.Name == "" {
+		return nil, &ParseError{
+			Code:    CodeInvalidParams,
+			Message: "Missing 'name' in prompts/get params",
 		}
 	}
 
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"sort"
+
+	json "github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+)
+
+// ProtocolVersions restricts the MCP protocol versions clients may
+// initialize with. Versions are the dated strings of the MCP spec, such as
+// "2025-06-18", which sort in release order.
+type ProtocolVersions struct {
+	supported []string // Oldest first
+	rewrite   bool
+}
+
+// NewProtocolVersions creates a protocol version check. Unsupported
+// versions are rejected, or with rewrite clamped to the nearest supported
+// version.
+func NewProtocolVersions(supported []string, rewrite bool) *ProtocolVersions {
+	versions := append([]string(nil), supported...)
+	sort.Strings(versions)
+	return &ProtocolVersions{supported: versions, rewrite: rewrite}
+}
+
+// Supported returns the supported versions, oldest first.
+func (p *ProtocolVersions) Supported() []string {
+	return p.supported
+}
+
+// IsSupported reports whether version is supported.
+func (p *ProtocolVersions) IsSupported(version string) bool {
+	i := sort.SearchStrings(p.supported, version)
+	return i < len(p.supported) && p.supported[i] == version
+}
+
+// Clamp returns the newest supported version no newer than version, or the
+// oldest supported version if every one is newer.
+func (p *ProtocolVersions) Clamp(version string) string {
+	i := sort.SearchStrings(p.supported, version)
+	if i < len(p.supported) && p.supported[i] == version {
+		return version
+	}
+	if i == 0 {
+		return p.supported[0]
+	}
+	return p.supported[i-1]
+}
+
+// checkProtocolVersion applies the protocol version check to an initialize
+// request. It returns the message to forward, rewritten if the version was
+// clamped, and false if the request is to be rejected.
+func (r *Router) checkProtocolVersion(reqCtx *RequestContext, message []byte) ([]byte, bool) {
+	init, pv := reqCtx.Initialize, r.protocolVersions
+	if init == nil || pv == nil || pv.IsSupported(init.ProtocolVersion) {
+		return message, true
+	}
+	if !pv.rewrite {
+		return message, false
+	}
+
+	version := pv.Clamp(init.ProtocolVersion)
+	rewritten, err := rewriteProtocolVersion(message, version)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("request_id", reqCtx.RequestID).
+			Msg("Failed to rewrite protocol version")
+		return message, false
+	}
+
+	log.Debug().
+		Str("request_id", reqCtx.RequestID).
+		Str("requested", init.ProtocolVersion).
+		Str("version", version).
+		Msg("Rewrote unsupported protocol version")
+	init.ProtocolVersion = version
+	return rewritten, true
+}
+
+// rewriteProtocolVersion returns message with params.protocolVersion set to
+// version. Other fields are kept as they were.
+func rewriteProtocolVersion(message []byte, version string) ([]byte, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return nil, err
+	}
+
+	var params map[string]json.RawMessage
+	if raw, ok := envelope["params"]; ok {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, err
+		}
+	}
+	if params == nil {
+		params = make(map[string]json.RawMessage, 1)
+	}
+
+	v, err := json.Marshal(version)
+	if err != nil {
+		return nil, err
+	}
+	params["protocolVersion"] = v
+
+	newParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	envelope["params"] = newParams
+
+	return json.Marshal(envelope)
+}
@@ -0,0 +1,146 @@
+package router
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/session"
+)
+
+// pruneThreshold is the number of tracked DIDs above which idle DID buckets
+// are discarded.
+const pruneThreshold = 1024
+
+// RateLimiter limits enforced requests to a number per window. Each session
+// has its own token bucket; with perDID set, sessions of the same verified
+// DID share one instead.
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+	perDID bool
+
+	mu   sync.Mutex
+	dids map[string]*session.TokenBucket
+}
+
+// NewRateLimiter creates a rate limiter allowing limit requests per window.
+func NewRateLimiter(limit int, window time.Duration, perDID bool) *RateLimiter {
+	return &RateLimiter{
+		limit:  limit,
+		window: window,
+		perDID: perDID,
+		dids:   make(map[string]*session.TokenBucket),
+	}
+}
+
+// Limit returns the number of requests allowed per window.
+func (l *RateLimiter) Limit() int {
+	return l.limit
+}
+
+// Window returns the rate limit window.
+func (l *RateLimiter) Window() time.Duration {
+	return l.window
+}
+
+// Allow consumes a token for a request in sess. When the limit is exceeded
+// it returns false and how long until the next request would be allowed.
+func (l *RateLimiter) Allow(sess *session.Session) (bool, time.Duration) {
+	now := time.Now()
+
+	if l.perDID {
+		if verified, did := sess.GetIdentity(); verified && did != "" {
+			return l.didBucket(did, now).Take(l.limit, l.window, now)
+		}
+	}
+
+	return sess.TakeRateToken(l.limit, l.window, now)
+}
+
+// didBucket returns the shared bucket for did, creating it if needed.
+func (l *RateLimiter) didBucket(did string, now time.Time) *session.TokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.dids[did]
+	if ok {
+		return bucket
+	}
+
+	if len(l.dids) >= pruneThreshold {
+		for key, b := range l.dids {
+			if b.Idle(l.window, now) {
+				delete(l.dids, key)
+			}
+		}
+	}
+
+	bucket = &session.TokenBucket{}
+	l.dids[did] = bucket
+	return bucket
+}
+
+// DefaultAgentLimitKey is the AgentRateLimits key applying to agents no
+// other key matches.
+const DefaultAgentLimitKey = "default"
+
+// AgentRateLimits caps the number of requests in a session by the session's
+// agent, as the rate_limits policy data does. Keys are agent IDs or glob
+// patterns such as "support-*"; an exact ID wins over patterns, longer
+// patterns win over shorter ones, and DefaultAgentLimitKey applies to
+// everything else.
+type AgentRateLimits struct {
+	exact    map[string]int
+	patterns []string // Longest first
+}
+
+// NewAgentRateLimits creates limits from rate_limits policy data. Keys that
+// are not valid patterns are treated as plain agent IDs.
+func NewAgentRateLimits(limits map[string]int) *AgentRateLimits {
+	l := &AgentRateLimits{exact: make(map[string]int, len(limits))}
+	for key, limit := range limits {
+		l.exact[key] = limit
+		if key == DefaultAgentLimitKey || !strings.ContainsAny(key, "*?[") {
+			continue
+		}
+		if _, err := path.Match(key, ""); err == nil {
+			l.patterns = append(l.patterns, key)
+		}
+	}
+	sort.Slice(l.patterns, func(i, j int) bool {
+		if len(l.patterns[i]) != len(l.patterns[j]) {
+			return len(l.patterns[i]) > len(l.patterns[j])
+		}
+		return l.patterns[i] < l.patterns[j]
+	})
+	return l
+}
+
+// Limit returns the request limit for agentID, and false if none applies.
+func (l *AgentRateLimits) Limit(agentID string) (int, bool) {
+	if limit, ok := l.exact[agentID]; ok {
+		return limit, true
+	}
+	for _, pattern := range l.patterns {
+		if ok, _ := path.Match(pattern, agentID); ok {
+			return l.exact[pattern], true
+		}
+	}
+	limit, ok := l.exact[DefaultAgentLimitKey]
+	return limit, ok
+}
+
+// Exceeded reports whether sess has reached its agent's limit, and the
+// limit. The request count includes the request being handled, so as in
+// the bundled rate_limit policy a request is refused once the count reaches
+// the limit.
+func (l *AgentRateLimits) Exceeded(sess *session.Session) (bool, int) {
+	limit, ok := l.Limit(sess.AgentID)
+	if !ok {
+		return false, 0
+	}
+	return sess.GetRequestCount() >= limit, limit
+}
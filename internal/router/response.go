@@ -2,6 +2,7 @@ package router
 
 import (
 	"bytes"
+	"math"
 	"sync"
 	"time"
 
@@ -98,20 +99,21 @@ func (b *ResponseBuilder) InternalError(id interface{}, message string) *Respons
 }
 
 // PolicyViolation creates a policy violation error response (-32001).
-func (b *ResponseBuilder) PolicyViolation(id interface{}, reqCtx *RequestContext, agentID string, capabilities []string, violations []string, policyMode string) *Response {
+func (b *ResponseBuilder) PolicyViolation(id interface{}, reqCtx *RequestContext, agentID string, capabilities []string, violations []Violation, policyMode string) *Response {
 	data := PolicyViolationData{
 		RequestID:         reqCtx.RequestID,
 		AgentID:           agentID,
 		Tool:              reqCtx.Tool,
 		AgentCapabilities: capabilities,
-		Violations:        violations,
+		Violations:        violationMessages(violations),
+		Categories:        violationCategories(violations),
 		PolicyMode:        policyMode,
 		Timestamp:         time.Now().UTC().Format(time.RFC3339Nano),
 	}
 
 	message := "Policy violation"
 	if len(violations) > 0 {
-		message = violations[0] // Use first violation as message
+		message = violations[0].Message // Use first violation as message
 	}
 
 	return b.ErrorWithData(id, CodePolicyViolation, message, data)
@@ -125,16 +127,51 @@ func (b *ResponseBuilder) IdentityError(id interface{}, errorCode string, messag
 	return b.ErrorWithData(id, CodeIdentityError, message, data)
 }
 
-// RateLimited creates a rate limit error response (-32003).
-func (b *ResponseBuilder) RateLimited(id interface{}, agentID string, limit int, current int) *Response {
+// RateLimited creates a rate limit error response (-32003). retryAfter is
+// reported in whole seconds, rounded up.
+func (b *ResponseBuilder) RateLimited(id interface{}, agentID string, limit int, window time.Duration, retryAfter time.Duration) *Response {
 	data := map[string]interface{}{
-		"agent_id": agentID,
-		"limit":    limit,
-		"current":  current,
+		"agent_id":   agentID,
+		"limit":      limit,
+		"window":     window.String(),
+		"retryAfter": int64(math.Ceil(retryAfter.Seconds())),
 	}
 	return b.ErrorWithData(id, CodeRateLimited, "Rate limit exceeded", data)
 }
 
+// AgentRateLimited creates a rate limit error response (-32003) for a
+// session that has made as many requests as its agent is allowed.
+func (b *ResponseBuilder) AgentRateLimited(id interface{}, agentID string, limit, requestCount int) *Response {
+	data := map[string]interface{}{
+		"agent_id":     agentID,
+		"limit":        limit,
+		"requestCount": requestCount,
+	}
+	return b.ErrorWithData(id, CodeRateLimited, "Rate limit exceeded", data)
+}
+
+// ConcurrencyLimited creates a rate limit error response (-32003) for a
+// session that already has limit requests in flight.
+func (b *ResponseBuilder) ConcurrencyLimited(id interface{}, agentID string, limit int) *Response {
+	data := map[string]interface{}{
+		"agent_id":      agentID,
+		"maxConcurrent": limit,
+		"retryAfter":    1,
+	}
+	return b.ErrorWithData(id, CodeRateLimited, "Too many concurrent requests", data)
+}
+
+// UnsupportedProtocolVersion creates an invalid params error response
+// (-32602) for an initialize request declaring a protocol version the proxy
+// does not accept, as the MCP spec prescribes.
+func (b *ResponseBuilder) UnsupportedProtocolVersion(id interface{}, requested string, supported []string) *Response {
+	data := map[string]interface{}{
+		"supported": supported,
+		"requested": requested,
+	}
+	return b.ErrorWithData(id, CodeInvalidParams, "Unsupported protocol version", data)
+}
+
 // UpstreamError creates an upstream error response (-32004).
 func (b *ResponseBuilder) UpstreamError(id interface{}, message string) *Response {
 	return b.Error(id, CodeUpstreamError, message)
@@ -167,6 +204,26 @@ func (b *ResponseBuilder) Marshal(resp *Response) ([]byte, error) {
 	return result, nil
 }
 
+// MarshalBatch joins already-marshaled responses into a JSON-RPC batch array.
+func (b *ResponseBuilder) MarshalBatch(responses [][]byte) []byte {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	buf.WriteByte('[')
+	for i, resp := range responses {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(bytes.TrimSpace(resp))
+	}
+	buf.WriteByte(']')
+
+	// Copy to new slice to avoid returning pooled buffer
+	result := make([]byte, buf.Len())
+	copy(result, buf.Bytes())
+	return result
+}
+
 // MustMarshal serializes a response to JSON, panicking on error.
 func (b *ResponseBuilder) MustMarshal(resp *Response) []byte {
 	data, err := json.Marshal(resp)
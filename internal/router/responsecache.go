@@ -0,0 +1,159 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	json "github.com/goccy/go-json"
+)
+
+// ResponseCache holds upstream results for idempotent read methods, so
+// repeated identical requests don't reach the upstream. Entries are keyed
+// by method, params and the caller's capabilities, and by session when each
+// session has its own upstream connection. It is separate from the policy
+// decision cache: policy is still evaluated on every request.
+type ResponseCache struct {
+	methods    map[string]bool
+	ttl        time.Duration
+	maxEntries int
+	perSession bool
+
+	mu      sync.Mutex
+	entries map[string]responseEntry
+}
+
+type responseEntry struct {
+	result    json.RawMessage
+	expiresAt time.Time
+}
+
+// NewResponseCache creates a cache for the results of methods, each kept
+// for ttl, holding at most maxEntries results.
+func NewResponseCache(methods []string, ttl time.Duration, maxEntries int) *ResponseCache {
+	set := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		set[m] = true
+	}
+	return &ResponseCache{
+		methods:    set,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]responseEntry),
+	}
+}
+
+// SetPerSession keys entries by session as well, for upstream connections
+// opened per session whose results must not reach other sessions.
+func (c *ResponseCache) SetPerSession(perSession bool) {
+	c.perSession = perSession
+}
+
+// Caches reports whether results of method are cached.
+func (c *ResponseCache) Caches(method string) bool {
+	return c.methods[method]
+}
+
+// Get returns the cached result for key, if present and not expired.
+func (c *ResponseCache) Get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.result, true
+}
+
+// Put stores the result of a successful upstream response for key.
+// Responses carrying an error, or without a result, aren't cached.
+func (c *ResponseCache) Put(key string, response []byte) {
+	var parsed struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(response, &parsed); err != nil || len(parsed.Result) == 0 || len(parsed.Error) > 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[key] = responseEntry{
+		result:    append(json.RawMessage(nil), parsed.Result...),
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
+
+// Clear removes every entry, e.g. when policy data changes or the upstream
+// reports that its lists or resources changed.
+func (c *ResponseCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]responseEntry)
+}
+
+// Len returns the number of cached results, including expired ones not yet
+// removed.
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// evict removes expired entries, or the entry closest to expiry if none
+// have. Must be called with c.mu held.
+func (c *ResponseCache) evict() {
+	now := time.Now()
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.expiresAt.Before(oldest) {
+			oldestKey, oldest = key, entry.expiresAt
+		}
+	}
+	if len(c.entries) >= c.maxEntries && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// key returns the cache key for a request: its method, params and the
+// sorted capabilities of the calling session, plus the session ID when
+// entries are kept per session.
+func (c *ResponseCache) key(reqCtx *RequestContext, sess *session.Session) string {
+	var caps []string
+	var sessionID string
+	if sess != nil {
+		caps = append(caps, sess.Capabilities...)
+		sort.Strings(caps)
+		if c.perSession {
+			sessionID = sess.ID
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(reqCtx.Method))
+	h.Write([]byte{0})
+	h.Write(reqCtx.Request.Params)
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(caps, ",")))
+	h.Write([]byte{0})
+	h.Write([]byte(sessionID))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,162 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/session"
+)
+
+// TestResponseCache tests that a repeated identical read is answered from
+// the cache with the new request's ID, while other params, capabilities
+// and methods reach the upstream.
+func TestResponseCache(t *testing.T) {
+	calls := 0
+	r := NewRouter()
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		calls++
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{"contents":[{"text":"hello"}]}}`), nil
+	})
+	cache := NewResponseCache([]string{"resources/read"}, time.Minute, 100)
+	r.SetResponseCache(cache)
+
+	reader := session.NewSession("sess1")
+	reader.Capabilities = []string{"read:files"}
+	admin := session.NewSession("sess2")
+	admin.Capabilities = []string{"admin:*", "read:files"}
+
+	read := func(sess *session.Session, id int, uri string) []byte {
+		t.Helper()
+		msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"resources/read","params":{"uri":%q}}`, id, uri)
+		resp, err := r.Route(context.Background(), sess, []byte(msg))
+		if err != nil {
+			t.Fatalf("Route() error = %v", err)
+		}
+		return resp
+	}
+
+	read(reader, 1, "file:///a")
+	resp := read(reader, 2, "file:///a")
+	if calls != 1 {
+		t.Fatalf("upstream calls = %d after identical reads, want 1", calls)
+	}
+	var cached struct {
+		ID     int `json:"id"`
+		Result struct {
+			Contents []struct {
+				Text string `json:"text"`
+			} `json:"contents"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &cached); err != nil {
+		t.Fatalf("invalid cached response %s: %v", resp, err)
+	}
+	if cached.ID != 2 || len(cached.Result.Contents) != 1 || cached.Result.Contents[0].Text != "hello" {
+		t.Errorf("cached response = %s, want the upstream result with id 2", resp)
+	}
+
+	read(reader, 3, "file:///b")
+	if calls != 2 {
+		t.Errorf("upstream calls = %d, want other params to miss the cache", calls)
+	}
+	read(admin, 4, "file:///a")
+	if calls != 3 {
+		t.Errorf("upstream calls = %d, want other capabilities to miss the cache", calls)
+	}
+
+	cache.Clear()
+	read(reader, 5, "file:///a")
+	if calls != 4 {
+		t.Errorf("upstream calls = %d, want a miss after Clear", calls)
+	}
+
+	if _, err := r.Route(context.Background(), reader, []byte(`{"jsonrpc":"2.0","id":6,"method":"tools/list"}`)); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if _, err := r.Route(context.Background(), reader, []byte(`{"jsonrpc":"2.0","id":7,"method":"tools/list"}`)); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if calls != 6 {
+		t.Errorf("upstream calls = %d, want uncached methods always forwarded", calls)
+	}
+}
+
+// TestResponseCacheInvalidation tests that upstream change notifications
+// clear the cache and that per-session entries stay with their session.
+func TestResponseCacheInvalidation(t *testing.T) {
+	calls := 0
+	r := NewRouter()
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		calls++
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`), nil
+	})
+	cache := NewResponseCache([]string{"tools/list"}, time.Minute, 100)
+	r.SetResponseCache(cache)
+
+	list := func(sess *session.Session) {
+		t.Helper()
+		if _, err := r.Route(context.Background(), sess, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)); err != nil {
+			t.Fatalf("Route() error = %v", err)
+		}
+	}
+
+	first := session.NewSession("sess1")
+	second := session.NewSession("sess2")
+	list(first)
+	list(second)
+	if calls != 1 {
+		t.Fatalf("upstream calls = %d for a shared upstream, want 1", calls)
+	}
+
+	for _, method := range []string{"notifications/tools/list_changed", "notifications/resources/updated"} {
+		r.HandleNotification([]byte(`{"jsonrpc":"2.0","method":"` + method + `","params":{"uri":"file:///a"}}`))
+		if cache.Len() != 0 {
+			t.Errorf("Len() = %d after %s, want cleared", cache.Len(), method)
+		}
+		list(first)
+	}
+	r.HandleNotification([]byte(`{"jsonrpc":"2.0","method":"notifications/message"}`))
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %d after an unrelated notification, want kept", cache.Len())
+	}
+
+	cache.SetPerSession(true)
+	cache.Clear()
+	calls = 0
+	list(first)
+	list(second)
+	list(first)
+	if calls != 2 {
+		t.Errorf("upstream calls = %d for per-session upstreams, want one per session", calls)
+	}
+}
+
+// TestResponseCachePut tests that only successful results are cached, that
+// entries expire, and that the cache stays within its size.
+func TestResponseCachePut(t *testing.T) {
+	cache := NewResponseCache([]string{"tools/list"}, 20*time.Millisecond, 2)
+
+	cache.Put("error", []byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"boom"}}`))
+	cache.Put("invalid", []byte(`not json`))
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d, want errors and invalid responses not cached", cache.Len())
+	}
+
+	cache.Put("a", []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`))
+	cache.Put("b", []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`))
+	cache.Put("c", []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`))
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want at most 2", cache.Len())
+	}
+	if result, ok := cache.Get("c"); !ok || string(result) != `{"tools":[]}` {
+		t.Errorf("Get(c) = %s, %v, want the latest result", result, ok)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := cache.Get("c"); ok {
+		t.Error("Get(c) after TTL = hit, want expired")
+	}
+}
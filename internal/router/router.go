@@ -2,9 +2,13 @@ package router
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
 	json "github.com/goccy/go-json"
 	"github.com/rs/zerolog/log"
 )
@@ -14,10 +18,53 @@ type Router struct {
 	parser   *Parser
 	response *ResponseBuilder
 
+	rateLimiter     *RateLimiter
+	agentLimits     atomic.Pointer[AgentRateLimits]
+	methodFilter    *MethodFilter
+	methodOverrides map[string]MethodConfig
+	subscriptions   *Subscriptions
+	dryRunDIDs      map[string]bool
+	maxConcurrent   int
+	timeouts        map[HandlerType]time.Duration
+	shadow          *Shadow
+	responseCache   *ResponseCache
+	inFlight        Gauge
+
+	maxResponseBytes int64
+	responseSize     Histogram
+
+	// protocolVersions restricts the versions initialize may declare
+	protocolVersions *ProtocolVersions
+
 	// Callbacks for different stages
+	identityChecker IdentityChecker
 	policyEvaluator PolicyEvaluator
 	upstreamSender  UpstreamSender
+	notifier        NotificationSender
 	auditLogger     AuditLogger
+	toolFilter      ToolFilter
+	resourceFilter  ResourceFilter
+	obligations     ObligationHandler
+	writeClassifier WriteClassifier
+}
+
+// ErrUpstreamTimeout is returned by sendUpstream when the upstream doesn't
+// answer within the handler's timeout.
+var ErrUpstreamTimeout = errors.New("upstream timeout")
+
+// ErrPolicyTimeout is returned by a PolicyEvaluator when evaluation exceeds
+// its time limit. The router reports it to the client as a policy timeout.
+var ErrPolicyTimeout = errors.New("policy timeout")
+
+// IdentityChecker is called for every request, before any handler, to vet
+// the session's identity. Returning a non-nil rejection blocks the request
+// with an identity error, whatever the method's handler or policy mode.
+type IdentityChecker func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) *IdentityRejection
+
+// IdentityRejection explains why an identity was rejected.
+type IdentityRejection struct {
+	Code    string // Machine-readable reason, e.g. "did_blocked"
+	Message string
 }
 
 // PolicyEvaluator is called to evaluate policy for a request.
@@ -26,25 +73,215 @@ type PolicyEvaluator func(ctx context.Context, sess *session.Session, reqCtx *Re
 // PolicyDecision contains the result of policy evaluation.
 type PolicyDecision struct {
 	Allow       bool
-	Violations  []string
+	Violations  []Violation
 	MatchedRule string
-	PolicyMode  string // "audit" or "enforce"
+	FiredRules  []string // Every policy rule that fired, if the policy reports them
+	PolicyMode  string   // "audit" or "enforce"
+	Filtered    int      // Number of list entries removed by response filtering
+	Obligations []Obligation
 }
 
-// UpstreamSender is called to forward requests to upstream.
+// Violation is one reason a request was denied. Category groups violations
+// for alerting, e.g. "capability", "blocklist", "rate_limit" or "identity".
+type Violation struct {
+	Category string `json:"category,omitempty"`
+	Message  string `json:"message"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// Violation categories the router assigns to denials it makes itself.
+const (
+	CategoryBlocklist = "blocklist"
+	CategoryRateLimit = "rate_limit"
+	CategoryIdentity  = "identity"
+	CategoryFiltered  = "filtered"
+	CategoryProtocol  = "protocol"
+)
+
+// violationMessages returns the message of each violation.
+func violationMessages(violations []Violation) []string {
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		messages[i] = v.Message
+	}
+	return messages
+}
+
+// violationCategories returns the distinct categories of violations in
+// order of first appearance.
+func violationCategories(violations []Violation) []string {
+	var categories []string
+	seen := make(map[string]bool)
+	for _, v := range violations {
+		if v.Category != "" && !seen[v.Category] {
+			seen[v.Category] = true
+			categories = append(categories, v.Category)
+		}
+	}
+	return categories
+}
+
+// Obligation is an action the policy requires the proxy to carry out.
+type Obligation struct {
+	Action string            `json:"action"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// UpstreamSender is called to forward requests to upstream. It returns
+// ErrStandalone when no upstream is connected, and the request is echoed back.
 type UpstreamSender func(ctx context.Context, message []byte) ([]byte, error)
 
+// NotificationSender is called to forward notifications upstream without
+// waiting for a response.
+type NotificationSender func(ctx context.Context, message []byte) error
+
+// ErrStandalone is returned by an UpstreamSender that has no connected
+// upstream to forward to.
+var ErrStandalone = errors.New("no upstream connected")
+
 // AuditLogger is called to log requests and decisions.
 type AuditLogger func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration)
 
+// ToolFilter is called for each tool in a tools/list response.
+// Returning false removes the tool from the response sent to the client.
+type ToolFilter func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, tool string) bool
+
+// ResourceFilter is called for each resource URI in a resources/list response.
+// Returning false removes the resource from the response sent to the client.
+type ResourceFilter func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, uri string) bool
+
+// ObligationHandler is called with the obligations of an allowed decision
+// before the request is forwarded.
+type ObligationHandler func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, obligations []Obligation)
+
+// Gauge is a metric that moves up and down, such as a prometheus.Gauge.
+type Gauge interface {
+	Inc()
+	Dec()
+}
+
+// Histogram is a metric observing a distribution of values, such as a
+// prometheus.Histogram.
+type Histogram interface {
+	Observe(float64)
+}
+
+// WriteClassifier reports whether calling tool writes data. Forwarded calls
+// to write tools count toward the session's cumulative writes.
+type WriteClassifier func(tool string) bool
+
 // NewRouter creates a new message router.
 func NewRouter() *Router {
 	return &Router{
-		parser:   NewParser(),
-		response: NewResponseBuilder(),
+		parser:        NewParser(),
+		response:      NewResponseBuilder(),
+		subscriptions: NewSubscriptions(),
+	}
+}
+
+// SetRateLimiter sets the limiter consulted before enforcing policy. Nil
+// disables rate limiting.
+func (r *Router) SetRateLimiter(l *RateLimiter) {
+	r.rateLimiter = l
+}
+
+// SetAgentRateLimits sets the per-agent session request limits consulted
+// before enforcing policy. Nil disables them. It is safe to call while
+// requests are being routed, e.g. after policy data is reloaded.
+func (r *Router) SetAgentRateLimits(l *AgentRateLimits) {
+	r.agentLimits.Store(l)
+}
+
+// SetIdentityChecker sets the identity check callback.
+func (r *Router) SetIdentityChecker(fn IdentityChecker) {
+	r.identityChecker = fn
+}
+
+// SetMethodFilter sets which methods are forwarded. Without one, every
+// method is.
+func (r *Router) SetMethodFilter(f *MethodFilter) {
+	r.methodFilter = f
+}
+
+// SetProtocolVersions sets the MCP protocol versions initialize requests
+// may declare. Without it, every version is forwarded.
+func (r *Router) SetProtocolVersions(p *ProtocolVersions) {
+	r.protocolVersions = p
+}
+
+// SetMaxConcurrent sets how many requests a session may have in flight at
+// once. Zero disables the limit.
+func (r *Router) SetMaxConcurrent(n int) {
+	r.maxConcurrent = n
+}
+
+// SetDryRunDIDs sets the verified agents that may request a dry run, in
+// which a denied request is logged as in audit mode and forwarded anyway.
+// Without any, dry runs are disabled.
+func (r *Router) SetDryRunDIDs(dids []string) {
+	r.dryRunDIDs = make(map[string]bool, len(dids))
+	for _, did := range dids {
+		r.dryRunDIDs[did] = true
 	}
 }
 
+// dryRunAllowed reports whether sess may request a dry run.
+func (r *Router) dryRunAllowed(sess *session.Session) bool {
+	verified, did := sess.GetIdentity()
+	return verified && r.dryRunDIDs[did]
+}
+
+// SetMethodOverrides sets method configurations that take precedence over
+// MethodRegistry.
+func (r *Router) SetMethodOverrides(overrides map[string]MethodConfig) {
+	r.methodOverrides = overrides
+}
+
+// SetHandlerTimeouts sets how long requests of each handler type wait for
+// the upstream. Handlers without a positive timeout wait as long as the
+// upstream client does.
+func (r *Router) SetHandlerTimeouts(timeouts map[HandlerType]time.Duration) {
+	r.timeouts = timeouts
+}
+
+// SetShadow sets the shadow upstream that matching requests are mirrored
+// to. Nil disables mirroring.
+func (r *Router) SetShadow(s *Shadow) {
+	r.shadow = s
+}
+
+// SetResponseCache sets the cache answering repeated reads of its methods.
+// Nil disables response caching.
+func (r *Router) SetResponseCache(c *ResponseCache) {
+	r.responseCache = c
+}
+
+// applyMethodOverride replaces reqCtx.Config if the method is overridden.
+func (r *Router) applyMethodOverride(reqCtx *RequestContext) {
+	if cfg, ok := r.methodOverrides[reqCtx.Method]; ok {
+		reqCtx.Config = cfg
+	}
+}
+
+// SetInFlightGauge sets the gauge tracking messages being routed. A batch
+// counts as one message for as long as any of its elements is in flight.
+func (r *Router) SetInFlightGauge(g Gauge) {
+	r.inFlight = g
+}
+
+// SetMaxResponseBytes sets the largest upstream response forwarded for
+// enforced and filtered requests. Larger responses are replaced with an
+// upstream error. Zero disables the limit.
+func (r *Router) SetMaxResponseBytes(n int64) {
+	r.maxResponseBytes = n
+}
+
+// SetResponseSizeHistogram sets the histogram observing the size of
+// upstream responses to enforced and filtered requests.
+func (r *Router) SetResponseSizeHistogram(h Histogram) {
+	r.responseSize = h
+}
+
 // SetPolicyEvaluator sets the policy evaluation callback.
 func (r *Router) SetPolicyEvaluator(fn PolicyEvaluator) {
 	r.policyEvaluator = fn
@@ -55,41 +292,159 @@ func (r *Router) SetUpstreamSender(fn UpstreamSender) {
 	r.upstreamSender = fn
 }
 
+// SetNotificationSender sets the callback forwarding notifications. Without
+// one, notifications go through the upstream sender and any response is
+// discarded.
+func (r *Router) SetNotificationSender(fn NotificationSender) {
+	r.notifier = fn
+}
+
 // SetAuditLogger sets the audit logging callback.
 func (r *Router) SetAuditLogger(fn AuditLogger) {
 	r.auditLogger = fn
 }
 
+// SetToolFilter sets the tools/list filtering callback.
+func (r *Router) SetToolFilter(fn ToolFilter) {
+	r.toolFilter = fn
+}
+
+// SetResourceFilter sets the resources/list filtering callback.
+func (r *Router) SetResourceFilter(fn ResourceFilter) {
+	r.resourceFilter = fn
+}
+
+// SetObligationHandler sets the obligation execution callback.
+func (r *Router) SetObligationHandler(fn ObligationHandler) {
+	r.obligations = fn
+}
+
+// SetWriteClassifier sets the callback that classifies write tools.
+func (r *Router) SetWriteClassifier(fn WriteClassifier) {
+	r.writeClassifier = fn
+}
+
 // Route processes an incoming MCP message and returns a response.
+// A top-level JSON array is treated as a JSON-RPC batch.
 func (r *Router) Route(ctx context.Context, sess *session.Session, message []byte) ([]byte, error) {
+	if r.inFlight != nil {
+		r.inFlight.Inc()
+		defer r.inFlight.Dec()
+	}
+
+	if r.parser.IsBatch(message) {
+		return r.routeBatch(ctx, sess, message)
+	}
+
 	start := time.Now()
 
 	// Parse the message
 	req, err := r.parser.Parse(message)
 	if err != nil {
-		if parseErr, ok := err.(*ParseError); ok {
-			resp := r.response.FromParseError(parseErr, nil)
-			return r.response.Marshal(resp)
+		return r.parseErrorResponse(err)
+	}
+
+	return r.dispatch(ctx, sess, req, message, start)
+}
+
+// routeBatch routes each element of a JSON-RPC batch independently and
+// assembles the responses in request order. Notifications produce no entry.
+func (r *Router) routeBatch(ctx context.Context, sess *session.Session, message []byte) ([]byte, error) {
+	elements, err := r.parser.ParseBatch(message)
+	if err != nil {
+		return r.parseErrorResponse(err)
+	}
+
+	responses := make([][]byte, 0, len(elements))
+	for _, elem := range elements {
+		start := time.Now()
+
+		req, err := r.parser.Parse(elem)
+		if err != nil {
+			resp, _ := r.parseErrorResponse(err)
+			responses = append(responses, resp)
+			continue
+		}
+
+		// Capture before dispatch releases the pooled request
+		id := req.ID
+		notification := r.parser.IsNotification(req)
+
+		resp, err := r.dispatch(ctx, sess, req, elem, start)
+		if err != nil {
+			log.Error().Err(err).Str("session_id", sess.ID).Msg("Batch element routing error")
+			resp, _ = r.response.Marshal(r.response.UpstreamError(id, err.Error()))
+		}
+
+		if notification || resp == nil {
+			continue
 		}
-		resp := r.response.ParseError(err.Error())
+		responses = append(responses, resp)
+	}
+
+	// A batch of only notifications gets no response at all
+	if len(responses) == 0 {
+		return nil, nil
+	}
+
+	return r.response.MarshalBatch(responses), nil
+}
+
+// parseErrorResponse builds a marshaled error response for a parse failure.
+func (r *Router) parseErrorResponse(err error) ([]byte, error) {
+	if parseErr, ok := err.(*ParseError); ok {
+		resp := r.response.FromParseError(parseErr, nil)
 		return r.response.Marshal(resp)
 	}
+	resp := r.response.ParseError(err.Error())
+	return r.response.Marshal(resp)
+}
+
+// dispatch runs a parsed request through its handler and audit logging.
+// The request is released back to the pool before returning.
+func (r *Router) dispatch(ctx context.Context, sess *session.Session, req *Request, message []byte, start time.Time) ([]byte, error) {
+	var err error
+
+	// Callbacks such as the upstream sender can tell which session is calling
+	ctx = session.NewContext(ctx, sess)
 
 	// Create request context (pooled) - reuse start time to avoid second time.Now() call
 	reqCtx := NewRequestContextAt(req, start)
 	defer reqCtx.Release()
+	if id := transport.RequestIDFromContext(ctx); id != "" {
+		reqCtx.RequestID = id
+	}
+	r.applyMethodOverride(reqCtx)
+
+	// Methods rejected by the filter are denied before their params are parsed
+	methodDenied := r.methodFilter != nil && !r.methodFilter.Allowed(req.Method)
 
 	// Extract tool/resource information based on method
-	if err := r.extractRequestDetails(req, reqCtx); err != nil {
-		if parseErr, ok := err.(*ParseError); ok {
-			resp := r.response.FromParseError(parseErr, req.ID)
-			return r.response.Marshal(resp)
+	if !methodDenied {
+		if err := r.extractRequestDetails(req, reqCtx); err != nil {
+			if parseErr, ok := err.(*ParseError); ok {
+				resp := r.response.FromParseError(parseErr, req.ID)
+				return r.response.Marshal(resp)
+			}
 		}
 	}
 
-	// Extract AgentFacts token if present
-	if meta, _ := r.parser.ExtractMeta(req.Params); meta != nil {
+	// Initialize requests declaring an unsupported protocol version are
+	// rejected, or clamped to a supported one before going upstream
+	message, versionAllowed := r.checkProtocolVersion(reqCtx, message)
+
+	// Extract AgentFacts token and dry-run flag if present
+	meta, metaErr := r.parser.ExtractMeta(req.Params)
+	if metaErr != nil {
+		if r.parser.IsNotification(req) {
+			return nil, nil
+		}
+		return r.response.Marshal(r.response.InvalidParams(req.ID, metaErr.Error()))
+	}
+	reqCtx.DryRun = transport.IsDryRun(ctx)
+	if meta != nil {
 		reqCtx.AgentFactsToken = meta.AgentFacts
+		reqCtx.DryRun = reqCtx.DryRun || meta.DryRun
 	}
 
 	log.Debug().
@@ -100,18 +455,129 @@ func (r *Router) Route(ctx context.Context, sess *session.Session, message []byt
 		Str("handler", handlerTypeName(reqCtx.Config.Handler)).
 		Msg("Routing request")
 
+	// Disallowed identities are rejected before any handler, so that none
+	// of their requests reach the upstream, whatever the method
+	var rejection *IdentityRejection
+	if r.identityChecker != nil && !methodDenied && versionAllowed {
+		rejection = r.identityChecker(ctx, sess, reqCtx)
+	}
+
+	// A dry run bypasses enforcement, so it is only honoured for the
+	// verified agents allowed it, once the identity check has run
+	if reqCtx.DryRun && !r.dryRunAllowed(sess) {
+		log.Debug().
+			Str("request_id", reqCtx.RequestID).
+			Str("session_id", sess.ID).
+			Msg("Ignoring dry run request, the agent is not allowed dry runs")
+		reqCtx.DryRun = false
+	}
+
+	// Cap the requests a session has in flight; notifications are exempt
+	// since they can't be told they were rejected
+	concurrencyLimited := false
+	if r.maxConcurrent > 0 && !methodDenied && versionAllowed && rejection == nil && !r.parser.IsNotification(req) {
+		if sess.AcquireRequestSlot(r.maxConcurrent) {
+			defer sess.ReleaseRequestSlot()
+		} else {
+			concurrencyLimited = true
+		}
+	}
+
+	// The upstream subscription is shared by every session subscribed to
+	// the resource, so it stays until the last of them unsubscribes
+	sharedSubscription := false
+	if !concurrencyLimited && !methodDenied && versionAllowed && rejection == nil {
+		sharedSubscription = r.unsubscribe(sess, reqCtx)
+	}
+
+	// Keep what the client declared in initialize for policy, whichever
+	// handler the method has; the request and the upstream's response are
+	// forwarded unchanged
+	if init := reqCtx.Initialize; init != nil && !concurrencyLimited && !methodDenied && versionAllowed && rejection == nil {
+		sess.SetInitialize(init.ProtocolVersion, init.Capabilities)
+	}
+
 	// Handle based on method configuration
 	var response []byte
 	var decision *PolicyDecision
 
-	switch reqCtx.Config.Handler {
-	case HandlerPassthrough:
+	switch {
+	case concurrencyLimited:
+		log.Warn().
+			Str("request_id", reqCtx.RequestID).
+			Str("session_id", sess.ID).
+			Int("max_concurrent", r.maxConcurrent).
+			Msg("Concurrent request limit exceeded")
+		decision = &PolicyDecision{
+			Allow:       false,
+			Violations:  []Violation{{Category: CategoryRateLimit, Message: "concurrent request limit exceeded"}},
+			MatchedRule: "concurrency_limited",
+			PolicyMode:  "concurrency_limit",
+		}
+		response, err = r.response.Marshal(r.response.ConcurrencyLimited(req.ID, sess.AgentID, r.maxConcurrent))
+
+	case methodDenied:
+		log.Warn().
+			Str("request_id", reqCtx.RequestID).
+			Str("session_id", sess.ID).
+			Str("method", req.Method).
+			Msg("Method not permitted")
+		decision = &PolicyDecision{
+			Allow:       false,
+			Violations:  []Violation{{Category: CategoryBlocklist, Message: "method not permitted: " + req.Method, Detail: req.Method}},
+			MatchedRule: "method_denied",
+			PolicyMode:  "method_filter",
+		}
+		// Notifications get no response
+		if !r.parser.IsNotification(req) {
+			response, err = r.response.Marshal(r.response.MethodNotFound(req.ID, req.Method))
+		}
+
+	case !versionAllowed:
+		version := reqCtx.Initialize.ProtocolVersion
+		log.Warn().
+			Str("request_id", reqCtx.RequestID).
+			Str("session_id", sess.ID).
+			Str("protocol_version", version).
+			Strs("supported", r.protocolVersions.Supported()).
+			Msg("Unsupported protocol version")
+		decision = &PolicyDecision{
+			Allow:       false,
+			Violations:  []Violation{{Category: CategoryProtocol, Message: "unsupported protocol version: " + version, Detail: version}},
+			MatchedRule: "unsupported_protocol_version",
+			PolicyMode:  "protocol_versions",
+		}
+		response, err = r.response.Marshal(r.response.UnsupportedProtocolVersion(req.ID, version, r.protocolVersions.Supported()))
+
+	case rejection != nil:
+		log.Warn().
+			Str("request_id", reqCtx.RequestID).
+			Str("agent_id", sess.AgentID).
+			Str("reason", rejection.Code).
+			Msg("Identity rejected")
+		decision = &PolicyDecision{
+			Allow:       false,
+			Violations:  []Violation{{Category: CategoryIdentity, Message: rejection.Message, Detail: rejection.Code}},
+			MatchedRule: rejection.Code,
+			PolicyMode:  "identity",
+		}
+		response, err = r.response.Marshal(r.response.IdentityError(req.ID, rejection.Code, rejection.Message))
+
+	case sharedSubscription:
+		log.Debug().
+			Str("request_id", reqCtx.RequestID).
+			Str("session_id", sess.ID).
+			Str("uri", reqCtx.ResourceURI).
+			Msg("Resource subscription removed, still shared upstream")
+		response, err = r.response.Marshal(r.response.Success(req.ID, struct{}{}))
+
+	case reqCtx.Config.Handler == HandlerPassthrough:
 		response, err = r.handlePassthrough(ctx, sess, reqCtx, message)
 
-	case HandlerFullEnforce:
+	case reqCtx.Config.Handler == HandlerFullEnforce:
 		response, decision, err = r.handleEnforce(ctx, sess, reqCtx, message)
 
-	case HandlerFilter:
+	case reqCtx.Config.Handler == HandlerFilter:
 		response, decision, err = r.handleFilter(ctx, sess, reqCtx, message)
 
 	default:
@@ -120,6 +586,15 @@ func (r *Router) Route(ctx context.Context, sess *session.Session, message []byt
 
 	latency := time.Since(start)
 
+	if err == nil {
+		r.trackSubscription(sess, reqCtx, response)
+	}
+
+	// Notifications never get a response, not even an error
+	if r.parser.IsNotification(req) {
+		response = nil
+	}
+
 	// Audit log
 	if r.auditLogger != nil && reqCtx.Config.LogLevel != LogNone {
 		r.auditLogger(ctx, sess, reqCtx, decision, response, latency)
@@ -149,7 +624,7 @@ func (r *Router) extractRequestDetails(req *Request, reqCtx *RequestContext) err
 			reqCtx.AgentFactsToken = params.Meta.AgentFacts
 		}
 
-	case "resources/read":
+	case "resources/read", "resources/subscribe", "resources/unsubscribe":
 		params, err := r.parser.ParseResourceRead(req)
 		if err != nil {
 			return err
@@ -158,6 +633,33 @@ func (r *Router) extractRequestDetails(req *Request, reqCtx *RequestContext) err
 		if params.Meta != nil {
 			reqCtx.AgentFactsToken = params.Meta.AgentFacts
 		}
+
+	case "initialize":
+		params, err := r.parser.ParseInitialize(req)
+		if err != nil {
+			// The upstream reports malformed params; they are forwarded
+			// unchanged
+			return nil
+		}
+		reqCtx.Initialize = params
+		if params.Meta != nil {
+			reqCtx.AgentFactsToken = params.Meta.AgentFacts
+		}
+
+	case "prompts/get":
+		params, err := r.parser.ParsePromptGet(req)
+		if err != nil {
+			// Policy needs the name only when the method is enforced;
+			// otherwise the upstream reports the invalid params
+			if reqCtx.Config.Handler != HandlerFullEnforce {
+				return nil
+			}
+			return err
+		}
+		reqCtx.Prompt = params.Name
+		if params.Meta != nil {
+			reqCtx.AgentFactsToken = params.Meta.AgentFacts
+		}
 	}
 
 	return nil
@@ -165,30 +667,219 @@ func (r *Router) extractRequestDetails(req *Request, reqCtx *RequestContext) err
 
 // handlePassthrough forwards the request without policy check.
 func (r *Router) handlePassthrough(ctx context.Context, sess *session.Session, reqCtx *RequestContext, message []byte) ([]byte, error) {
-	if r.upstreamSender != nil {
+	response, err := r.sendUpstream(ctx, reqCtx, message)
+	if errors.Is(err, ErrUpstreamTimeout) {
+		return r.upstreamTimeout(reqCtx, err), nil
+	}
+	return response, err
+}
+
+// sendUpstream forwards the message upstream, adding the time taken to
+// reqCtx.UpstreamLatency. Without an upstream the message is echoed back
+// and reqCtx.Echoed is set. If the handler's timeout passes first it returns
+// ErrUpstreamTimeout.
+func (r *Router) sendUpstream(ctx context.Context, reqCtx *RequestContext, message []byte) ([]byte, error) {
+	notification := r.parser.IsNotification(reqCtx.Request)
+	if r.shadow != nil && shadowHandshakeMethods[reqCtx.Method] {
+		r.shadow.Handshake(message, notification)
+	}
+	if notification {
+		r.sendNotification(ctx, reqCtx, message)
+		return nil, nil
+	}
+	if r.upstreamSender == nil {
+		reqCtx.Echoed = true
+		return message, nil
+	}
+
+	// Identical reads are answered from the response cache
+	var cacheKey string
+	if r.responseCache != nil && r.responseCache.Caches(reqCtx.Method) {
+		cacheKey = r.responseCache.key(reqCtx, session.FromContext(ctx))
+		if result, ok := r.responseCache.Get(cacheKey); ok {
+			log.Debug().
+				Str("request_id", reqCtx.RequestID).
+				Str("method", reqCtx.Method).
+				Msg("Served from response cache")
+			return r.response.Marshal(r.response.Success(reqCtx.Request.ID, result))
+		}
+	}
+
+	// Forward the request ID, provided or generated, so upstream logs match
+	ctx = transport.WithRequestID(ctx, reqCtx.RequestID)
+
+	// The shadow is sent in parallel and compared once both answer. It has
+	// already been sent the handshake.
+	var compareShadow func(primary []byte)
+	if r.shadow != nil && r.shadow.Matches(reqCtx.Method) && !shadowHandshakeMethods[reqCtx.Method] {
+		compareShadow = r.shadow.Mirror(reqCtx.RequestID, reqCtx.Method, message)
+	}
+
+	start := time.Now()
+	response, err := r.sendWithTimeout(ctx, reqCtx, message)
+	reqCtx.UpstreamLatency += time.Since(start)
+	if compareShadow != nil {
+		if err != nil {
+			compareShadow(nil)
+		} else {
+			compareShadow(response)
+		}
+	}
+	if errors.Is(err, ErrStandalone) {
+		reqCtx.Echoed = true
+		return message, nil
+	}
+	if err == nil && cacheKey != "" {
+		r.responseCache.Put(cacheKey, response)
+	}
+	return response, err
+}
+
+// sendNotification forwards a notification upstream without waiting for a
+// response. Failures are logged, since there is no response to report them
+// in.
+func (r *Router) sendNotification(ctx context.Context, reqCtx *RequestContext, message []byte) {
+	ctx = transport.WithRequestID(ctx, reqCtx.RequestID)
+
+	var err error
+	switch {
+	case r.notifier != nil:
+		err = r.notifier(ctx, message)
+	case r.upstreamSender != nil:
+		_, err = r.upstreamSender(ctx, message)
+	default:
+		return
+	}
+	if err != nil && !errors.Is(err, ErrStandalone) {
+		log.Warn().
+			Err(err).
+			Str("request_id", reqCtx.RequestID).
+			Str("method", reqCtx.Method).
+			Msg("Failed to forward notification")
+	}
+}
+
+// sendWithTimeout calls the upstream sender, giving up once the handler's
+// timeout passes even if the sender ignores its context.
+func (r *Router) sendWithTimeout(ctx context.Context, reqCtx *RequestContext, message []byte) ([]byte, error) {
+	timeout := r.timeouts[reqCtx.Config.Handler]
+	if timeout <= 0 {
 		return r.upstreamSender(ctx, message)
 	}
-	// No upstream - echo back
-	return message, nil
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		response []byte
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := r.upstreamSender(ctx, message)
+		done <- result{response, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w after %s", ErrUpstreamTimeout, timeout)
+		}
+		return res.response, res.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w after %s", ErrUpstreamTimeout, timeout)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// upstreamTimeout returns the upstream error response for a request that
+// timed out, or nil for a notification.
+func (r *Router) upstreamTimeout(reqCtx *RequestContext, err error) []byte {
+	log.Warn().
+		Str("request_id", reqCtx.RequestID).
+		Str("method", reqCtx.Method).
+		Err(err).
+		Msg("Upstream timed out")
+	if r.parser.IsNotification(reqCtx.Request) {
+		return nil
+	}
+	data, _ := r.response.Marshal(r.response.UpstreamError(reqCtx.Request.ID, err.Error()))
+	return data
 }
 
 // handleEnforce applies full policy enforcement before forwarding.
 func (r *Router) handleEnforce(ctx context.Context, sess *session.Session, reqCtx *RequestContext, message []byte) ([]byte, *PolicyDecision, error) {
+	// Reject requests over the rate limit before doing any other work
+	if r.rateLimiter != nil {
+		if ok, retryAfter := r.rateLimiter.Allow(sess); !ok {
+			log.Warn().
+				Str("request_id", reqCtx.RequestID).
+				Str("session_id", sess.ID).
+				Str("agent_id", sess.AgentID).
+				Dur("retry_after", retryAfter).
+				Msg("Rate limit exceeded")
+			decision := &PolicyDecision{
+				Allow:       false,
+				Violations:  []Violation{{Category: CategoryRateLimit, Message: "rate limit exceeded"}},
+				MatchedRule: "rate_limited",
+				PolicyMode:  "rate_limit",
+			}
+			resp := r.response.RateLimited(reqCtx.Request.ID, sess.AgentID, r.rateLimiter.Limit(), r.rateLimiter.Window(), retryAfter)
+			data, _ := r.response.Marshal(resp)
+			return data, decision, nil
+		}
+	}
+
+	// Reject sessions that have used up their agent's request limit
+	if limits := r.agentLimits.Load(); limits != nil {
+		if exceeded, limit := limits.Exceeded(sess); exceeded {
+			count := sess.GetRequestCount()
+			log.Warn().
+				Str("request_id", reqCtx.RequestID).
+				Str("session_id", sess.ID).
+				Str("agent_id", sess.AgentID).
+				Int("request_count", count).
+				Int("limit", limit).
+				Msg("Agent rate limit exceeded")
+			decision := &PolicyDecision{
+				Allow: false,
+				Violations: []Violation{{
+					Category: CategoryRateLimit,
+					Message:  fmt.Sprintf("Agent '%s' exceeded rate limit (%d/%d requests in session)", sess.AgentID, count, limit),
+					Detail:   fmt.Sprintf("%d/%d", count, limit),
+				}},
+				MatchedRule: "agent_rate_limited",
+				PolicyMode:  "rate_limit",
+			}
+			resp := r.response.AgentRateLimited(reqCtx.Request.ID, sess.AgentID, limit, count)
+			data, _ := r.response.Marshal(resp)
+			return data, decision, nil
+		}
+	}
+
 	// Evaluate policy
 	var decision *PolicyDecision
 	if r.policyEvaluator != nil {
 		var err error
+		evalStart := time.Now()
 		decision, err = r.policyEvaluator(ctx, sess, reqCtx)
+		reqCtx.PolicyLatency += time.Since(evalStart)
 		if err != nil {
 			log.Error().Err(err).Str("request_id", reqCtx.RequestID).Msg("Policy evaluation error")
-			resp := r.response.InternalError(reqCtx.Request.ID, "Policy evaluation failed")
+			message := "Policy evaluation failed"
+			if errors.Is(err, ErrPolicyTimeout) {
+				message = "Policy timeout"
+			}
+			resp := r.response.InternalError(reqCtx.Request.ID, message)
 			data, _ := r.response.Marshal(resp)
 			return data, decision, nil
 		}
 
 		// Check decision
 		if !decision.Allow {
-			if decision.PolicyMode == "enforce" {
+			if decision.PolicyMode == "enforce" && !reqCtx.DryRun {
 				// Block the request
 				resp := r.response.PolicyViolation(
 					reqCtx.Request.ID,
@@ -201,12 +892,15 @@ func (r *Router) handleEnforce(ctx context.Context, sess *session.Session, reqCt
 				data, _ := r.response.Marshal(resp)
 				return data, decision, nil
 			}
-			// Audit mode - log but continue
+			// Audit mode or dry run - log but continue
 			log.Warn().
 				Str("request_id", reqCtx.RequestID).
 				Str("agent_id", sess.AgentID).
-				Strs("violations", decision.Violations).
+				Strs("violations", violationMessages(decision.Violations)).
+				Bool("dry_run", reqCtx.DryRun).
 				Msg("Policy violation (audit mode)")
+		} else if r.obligations != nil && len(decision.Obligations) > 0 {
+			r.obligations(ctx, sess, reqCtx, decision.Obligations)
 		}
 	} else {
 		// No policy evaluator - default allow
@@ -217,46 +911,139 @@ func (r *Router) handleEnforce(ctx context.Context, sess *session.Session, reqCt
 		}
 	}
 
+	r.countAccess(sess, reqCtx)
+
 	// Forward to upstream
-	var response []byte
-	var err error
-	if r.upstreamSender != nil {
-		response, err = r.upstreamSender(ctx, message)
-		if err != nil {
-			resp := r.response.UpstreamError(reqCtx.Request.ID, err.Error())
-			data, _ := r.response.Marshal(resp)
-			return data, decision, nil
-		}
-	} else {
-		// No upstream - echo back
-		response = message
+	response, err := r.sendUpstream(ctx, reqCtx, message)
+	if errors.Is(err, ErrUpstreamTimeout) {
+		return r.upstreamTimeout(reqCtx, err), decision, nil
+	}
+	if err != nil {
+		resp := r.response.UpstreamError(reqCtx.Request.ID, err.Error())
+		data, _ := r.response.Marshal(resp)
+		return data, decision, nil
+	}
+	if data := r.checkResponseSize(reqCtx, response); data != nil {
+		return data, decision, nil
 	}
 
 	return response, decision, nil
 }
 
+// checkResponseSize observes the size of an upstream response. If it is
+// over the maximum, it returns the error response sent to the client
+// instead; otherwise nil.
+func (r *Router) checkResponseSize(reqCtx *RequestContext, response []byte) []byte {
+	if response == nil || reqCtx.Echoed {
+		return nil
+	}
+	size := int64(len(response))
+	if r.responseSize != nil {
+		r.responseSize.Observe(float64(size))
+	}
+	if r.maxResponseBytes <= 0 || size <= r.maxResponseBytes {
+		return nil
+	}
+
+	log.Warn().
+		Str("request_id", reqCtx.RequestID).
+		Str("method", reqCtx.Method).
+		Int64("size", size).
+		Int64("max", r.maxResponseBytes).
+		Msg("Upstream response too large")
+	data, _ := r.response.Marshal(r.response.UpstreamError(reqCtx.Request.ID, "response too large"))
+	return data
+}
+
+// countAccess updates the session's cumulative counters for a request that
+// is about to be forwarded: resources/read counts as a read, and tools/call
+// of a write-classified tool counts as a write.
+func (r *Router) countAccess(sess *session.Session, reqCtx *RequestContext) {
+	switch reqCtx.Method {
+	case "resources/read":
+		sess.IncrementReads()
+	case "tools/call":
+		if r.writeClassifier != nil && r.writeClassifier(reqCtx.Tool) {
+			sess.IncrementWrites()
+		}
+	}
+}
+
 // handleFilter applies policy filtering to list responses.
 func (r *Router) handleFilter(ctx context.Context, sess *session.Session, reqCtx *RequestContext, message []byte) ([]byte, *PolicyDecision, error) {
-	// For now, treat filter same as passthrough
-	// TODO: Implement response filtering based on capabilities
-
 	decision := &PolicyDecision{
 		Allow:       true,
 		PolicyMode:  "filter",
 		MatchedRule: "passthrough",
 	}
 
-	var response []byte
-	var err error
-	if r.upstreamSender != nil {
-		response, err = r.upstreamSender(ctx, message)
-	} else {
-		response = message
+	response, err := r.sendUpstream(ctx, reqCtx, message)
+	if errors.Is(err, ErrUpstreamTimeout) {
+		return r.upstreamTimeout(reqCtx, err), decision, nil
+	}
+	if err != nil {
+		return response, decision, err
+	}
+	if data := r.checkResponseSize(reqCtx, response); data != nil {
+		return data, decision, nil
+	}
+
+	// Filtering evaluates policy for each entry
+	filterStart := time.Now()
+	var removed []string
+	switch reqCtx.Method {
+	case "tools/list":
+		if r.toolFilter == nil {
+			break
+		}
+		response, removed, err = filterListResponse(response, "tools", func(item json.RawMessage) (string, bool) {
+			var tool struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(item, &tool); err != nil || tool.Name == "" {
+				// Malformed entries can't be evaluated - drop them
+				return "", false
+			}
+			return tool.Name, r.toolFilter(ctx, sess, reqCtx, tool.Name)
+		})
+		decision.MatchedRule = "tool_filter"
+
+	case "resources/list":
+		if r.resourceFilter == nil {
+			break
+		}
+		response, removed, err = filterListResponse(response, "resources", func(item json.RawMessage) (string, bool) {
+			var resource struct {
+				URI string `json:"uri"`
+			}
+			if err := json.Unmarshal(item, &resource); err != nil || resource.URI == "" {
+				return "", false
+			}
+			return resource.URI, r.resourceFilter(ctx, sess, reqCtx, resource.URI)
+		})
+		decision.MatchedRule = "resource_filter"
+	}
+	reqCtx.PolicyLatency += time.Since(filterStart)
+	if err != nil {
+		log.Error().Err(err).Str("request_id", reqCtx.RequestID).Msg("Response filtering failed")
+		resp := r.response.InternalError(reqCtx.Request.ID, "Response filtering failed")
+		data, _ := r.response.Marshal(resp)
+		return data, decision, nil
 	}
 
-	// TODO: Filter the response to remove unauthorized tools/resources
+	if len(removed) > 0 {
+		decision.Filtered = len(removed)
+		for _, name := range removed {
+			decision.Violations = append(decision.Violations, Violation{Category: CategoryFiltered, Message: "filtered: " + name, Detail: name})
+		}
+		log.Debug().
+			Str("request_id", reqCtx.RequestID).
+			Str("method", reqCtx.Method).
+			Int("removed", len(removed)).
+			Msg("Filtered list response")
+	}
 
-	return response, decision, err
+	return response, decision, nil
 }
 
 // handlerTypeName returns a string name for the handler type.
@@ -282,6 +1069,7 @@ func (r *Router) ParseAndValidate(message []byte) (*Request, *RequestContext, er
 	}
 
 	reqCtx := NewRequestContext(req)
+	r.applyMethodOverride(reqCtx)
 	if err := r.extractRequestDetails(req, reqCtx); err != nil {
 		return req, reqCtx, err
 	}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // TestNewRouter tests router creation.
@@ -265,6 +269,78 @@ func TestResourcesReadParsing(t *testing.T) {
 	}
 }
 
+// TestPromptsGetParsing tests parsing prompts/get method parameters, which
+// are only validated when the method is enforced.
+func TestPromptsGetParsing(t *testing.T) {
+	enforce, err := NewMethodOverride("prompts/get", "enforce", "metadata", false)
+	if err != nil {
+		t.Fatalf("NewMethodOverride() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		message    string
+		enforced   bool
+		wantErr    bool
+		wantPrompt string
+	}{
+		{
+			name:       "valid prompt get",
+			message:    `{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"name":"code_review","arguments":{"language":"go"}}}`,
+			wantErr:    false,
+			wantPrompt: "code_review",
+		},
+		{
+			name:     "missing params",
+			message:  `{"jsonrpc":"2.0","id":1,"method":"prompts/get"}`,
+			enforced: true,
+			wantErr:  true,
+		},
+		{
+			name:     "missing prompt name",
+			message:  `{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"arguments":{}}}`,
+			enforced: true,
+			wantErr:  true,
+		},
+		{
+			name:    "missing prompt name passed through",
+			message: `{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"arguments":{}}}`,
+			wantErr: false,
+		},
+		{
+			name:       "prompt get with meta",
+			message:    `{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"name":"summarize","_meta":{"agentfacts":"token123"}}}`,
+			wantErr:    false,
+			wantPrompt: "summarize",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			if tt.enforced {
+				r.SetMethodOverrides(map[string]MethodConfig{"prompts/get": enforce})
+			}
+			req, reqCtx, err := r.ParseAndValidate([]byte(tt.message))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAndValidate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				if req.Method != "prompts/get" {
+					t.Errorf("Method = %s, want prompts/get", req.Method)
+				}
+				if reqCtx.Prompt != tt.wantPrompt {
+					t.Errorf("Prompt = %s, want %s", reqCtx.Prompt, tt.wantPrompt)
+				}
+				if reqCtx.Config.Handler != HandlerPassthrough {
+					t.Errorf("Handler = %v, want passthrough by default", reqCtx.Config.Handler)
+				}
+			}
+		})
+	}
+}
+
 // TestPolicyEvaluationIntegration tests routing with policy evaluation.
 func TestPolicyEvaluationIntegration(t *testing.T) {
 	tests := []struct {
@@ -288,7 +364,7 @@ func TestPolicyEvaluationIntegration(t *testing.T) {
 			policyDecision: &PolicyDecision{
 				Allow:       false,
 				PolicyMode:  "enforce",
-				Violations:  []string{"missing_capability"},
+				Violations:  []Violation{{Category: "capability", Message: "missing_capability"}},
 				MatchedRule: "deny_rule",
 			},
 			policyError:   nil,
@@ -299,7 +375,7 @@ func TestPolicyEvaluationIntegration(t *testing.T) {
 			policyDecision: &PolicyDecision{
 				Allow:       false,
 				PolicyMode:  "audit",
-				Violations:  []string{"missing_capability"},
+				Violations:  []Violation{{Category: "capability", Message: "missing_capability"}},
 				MatchedRule: "deny_rule",
 			},
 			policyError:   nil,
@@ -361,6 +437,55 @@ func TestPolicyEvaluationIntegration(t *testing.T) {
 	}
 }
 
+// TestPolicyViolationCategories tests that a denial's error data lists the
+// violation messages and their distinct categories.
+func TestPolicyViolationCategories(t *testing.T) {
+	r := NewRouter()
+	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+		return &PolicyDecision{
+			Allow:      false,
+			PolicyMode: "enforce",
+			Violations: []Violation{
+				{Category: "capability", Message: "lacks read:files", Detail: "read:files"},
+				{Category: "blocklist", Message: "tool is blocked"},
+				{Category: "capability", Message: "lacks admin:files"},
+				{Message: "legacy string violation"},
+			},
+		}, nil
+	})
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`
+	resp, err := r.Route(context.Background(), session.NewSession("sess1"), []byte(msg))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	var jsonResp struct {
+		Error *struct {
+			Code    int                 `json:"code"`
+			Message string              `json:"message"`
+			Data    PolicyViolationData `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &jsonResp); err != nil {
+		t.Fatalf("invalid response %s: %v", resp, err)
+	}
+	if jsonResp.Error == nil || jsonResp.Error.Code != CodePolicyViolation {
+		t.Fatalf("response = %s, want policy violation", resp)
+	}
+	if jsonResp.Error.Message != "lacks read:files" {
+		t.Errorf("message = %q, want the first violation", jsonResp.Error.Message)
+	}
+	wantViolations := []string{"lacks read:files", "tool is blocked", "lacks admin:files", "legacy string violation"}
+	if fmt.Sprint(jsonResp.Error.Data.Violations) != fmt.Sprint(wantViolations) {
+		t.Errorf("violations = %v, want %v", jsonResp.Error.Data.Violations, wantViolations)
+	}
+	wantCategories := []string{"capability", "blocklist"}
+	if fmt.Sprint(jsonResp.Error.Data.Categories) != fmt.Sprint(wantCategories) {
+		t.Errorf("categories = %v, want %v", jsonResp.Error.Data.Categories, wantCategories)
+	}
+}
+
 // TestAuditLogging tests that audit logger is called with correct parameters.
 func TestAuditLogging(t *testing.T) {
 	r := NewRouter()
@@ -460,6 +585,169 @@ func TestPassthroughHandler(t *testing.T) {
 	}
 }
 
+// TestInitializeCapture tests that the session keeps the protocol version
+// and capabilities from initialize while the response passes through.
+func TestInitializeCapture(t *testing.T) {
+	r := NewRouter()
+
+	const upstreamResponse = `{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-06-18","capabilities":{"tools":{}},"serverInfo":{"name":"upstream","version":"1.0"}}}`
+	var forwarded string
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		forwarded = string(message)
+		return []byte(upstreamResponse), nil
+	})
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{"roots":{"listChanged":true},"experimental":{"streaming":{}}},"clientInfo":{"name":"client","version":"1.0"}}}`
+	sess := session.NewSession("test_sess")
+
+	resp, err := r.Route(context.Background(), sess, []byte(msg))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if forwarded != msg {
+		t.Errorf("Forwarded = %s, want the request unchanged", forwarded)
+	}
+	if string(resp) != upstreamResponse {
+		t.Errorf("Response = %s, want the upstream response unchanged", resp)
+	}
+
+	version, caps := sess.GetInitialize()
+	if version != "2025-06-18" {
+		t.Errorf("ProtocolVersion = %s, want 2025-06-18", version)
+	}
+	roots, ok := caps["roots"].(map[string]interface{})
+	if !ok || roots["listChanged"] != true {
+		t.Errorf("Capabilities[roots] = %v, want listChanged", caps["roots"])
+	}
+	if _, ok := caps["experimental"]; !ok {
+		t.Errorf("Capabilities = %v, want experimental", caps)
+	}
+
+	// Malformed params are left for the upstream to reject
+	malformed := `{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"capabilities":[]}}`
+	resp, err = r.Route(context.Background(), sess, []byte(malformed))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if forwarded != malformed {
+		t.Errorf("Forwarded = %s, want the malformed request unchanged", forwarded)
+	}
+	if string(resp) != upstreamResponse {
+		t.Errorf("Response = %s, want the upstream response unchanged", resp)
+	}
+
+	// The capture doesn't depend on the handler
+	override, err := NewMethodOverride("initialize", "enforce", "full", false)
+	if err != nil {
+		t.Fatalf("NewMethodOverride() error = %v", err)
+	}
+	r.SetMethodOverrides(map[string]MethodConfig{"initialize": override})
+	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+		return &PolicyDecision{Allow: true, PolicyMode: "enforce"}, nil
+	})
+	sess = session.NewSession("test_sess_enforced")
+	if _, err := r.Route(context.Background(), sess, []byte(msg)); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if version, _ := sess.GetInitialize(); version != "2025-06-18" {
+		t.Errorf("ProtocolVersion with initialize enforced = %q, want 2025-06-18", version)
+	}
+}
+
+// TestProtocolVersions tests accepting, rejecting and clamping the protocol
+// version declared in initialize.
+func TestProtocolVersions(t *testing.T) {
+	supported := []string{"2025-06-18", "2024-11-05", "2025-03-26"}
+
+	tests := []struct {
+		name        string
+		rewrite     bool
+		version     string
+		wantVersion string // Version forwarded upstream; empty if rejected
+	}{
+		{"accept supported", false, "2025-03-26", "2025-03-26"},
+		{"reject newer", false, "2026-01-01", ""},
+		{"reject between", false, "2025-01-01", ""},
+		{"accept supported with rewrite", true, "2025-06-18", "2025-06-18"},
+		{"clamp newer to newest", true, "2026-01-01", "2025-06-18"},
+		{"clamp between to older", true, "2025-05-01", "2025-03-26"},
+		{"clamp older to oldest", true, "2024-01-01", "2024-11-05"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			r.SetProtocolVersions(NewProtocolVersions(supported, tt.rewrite))
+
+			var forwarded []byte
+			r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+				forwarded = message
+				return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+			})
+			var decision *PolicyDecision
+			r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, d *PolicyDecision, response []byte, latency time.Duration) {
+				decision = d
+			})
+
+			msg := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"` + tt.version + `","capabilities":{"roots":{}}}}`
+			sess := session.NewSession("test_sess")
+			resp, err := r.Route(context.Background(), sess, []byte(msg))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			if tt.wantVersion == "" {
+				if forwarded != nil {
+					t.Errorf("Forwarded %s, want rejected", forwarded)
+				}
+				var errResp struct {
+					Error struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+						Data    struct {
+							Supported []string `json:"supported"`
+							Requested string   `json:"requested"`
+						} `json:"data"`
+					} `json:"error"`
+				}
+				if err := json.Unmarshal(resp, &errResp); err != nil {
+					t.Fatalf("Unmarshal response error = %v", err)
+				}
+				e := errResp.Error
+				if e.Code != CodeInvalidParams || e.Message != "Unsupported protocol version" {
+					t.Errorf("Error = %d %s, want %d Unsupported protocol version", e.Code, e.Message, CodeInvalidParams)
+				}
+				if e.Data.Requested != tt.version || len(e.Data.Supported) != len(supported) {
+					t.Errorf("Error data = %+v, want requested %s and %d supported", e.Data, tt.version, len(supported))
+				}
+				if decision == nil || decision.Allow || decision.MatchedRule != "unsupported_protocol_version" {
+					t.Errorf("Audited decision = %+v, want unsupported_protocol_version denial", decision)
+				}
+				if version, _ := sess.GetInitialize(); version != "" {
+					t.Errorf("Session ProtocolVersion = %s, want none", version)
+				}
+				return
+			}
+
+			var req struct {
+				Params InitializeParams `json:"params"`
+			}
+			if err := json.Unmarshal(forwarded, &req); err != nil {
+				t.Fatalf("Unmarshal forwarded error = %v", err)
+			}
+			if req.Params.ProtocolVersion != tt.wantVersion {
+				t.Errorf("Forwarded protocolVersion = %s, want %s", req.Params.ProtocolVersion, tt.wantVersion)
+			}
+			if _, ok := req.Params.Capabilities["roots"]; !ok {
+				t.Errorf("Forwarded capabilities = %v, want roots kept", req.Params.Capabilities)
+			}
+			if version, _ := sess.GetInitialize(); version != tt.wantVersion {
+				t.Errorf("Session ProtocolVersion = %s, want %s", version, tt.wantVersion)
+			}
+		})
+	}
+}
+
 // TestEnforceHandler tests full enforcement routing.
 func TestEnforceHandler(t *testing.T) {
 	r := NewRouter()
@@ -493,7 +781,7 @@ func TestEnforceHandler(t *testing.T) {
 	}
 }
 
-// TestFilterHandler tests filter routing (currently implemented as passthrough).
+// TestFilterHandler tests filter routing without a filter configured.
 func TestFilterHandler(t *testing.T) {
 	r := NewRouter()
 
@@ -517,19 +805,31 @@ func TestFilterHandler(t *testing.T) {
 	}
 }
 
-// TestUpstreamError tests handling of upstream errors.
-func TestUpstreamError(t *testing.T) {
+// TestToolsListFiltering tests that tools/list responses are filtered by the tool filter.
+func TestToolsListFiltering(t *testing.T) {
 	r := NewRouter()
 
-	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
-		return &PolicyDecision{Allow: true, PolicyMode: "enforce"}, nil
-	})
+	upstreamResp := `{"jsonrpc":"2.0","id":7,"result":{"tools":[` +
+		`{"name":"read_file","description":"Read"},` +
+		`{"name":"shell_exec","description":"Shell"},` +
+		`{"name":"list_dir","description":"List"},` +
+		`{"name":"delete_file","description":"Delete"}]}}`
 
 	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
-		return nil, errors.New("upstream connection failed")
+		return []byte(upstreamResp), nil
 	})
 
-	msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool"}}`
+	allowed := map[string]bool{"read_file": true, "list_dir": true}
+	r.SetToolFilter(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, tool string) bool {
+		return allowed[tool]
+	})
+
+	var capturedDecision *PolicyDecision
+	r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+		capturedDecision = decision
+	})
+
+	msg := `{"jsonrpc":"2.0","id":7,"method":"tools/list"}`
 	sess := session.NewSession("test_sess")
 
 	resp, err := r.Route(context.Background(), sess, []byte(msg))
@@ -537,157 +837,1845 @@ func TestUpstreamError(t *testing.T) {
 		t.Fatalf("Route() error = %v", err)
 	}
 
-	// Parse response
-	var jsonResp Response
+	var jsonResp struct {
+		JSONRPC string  `json:"jsonrpc"`
+		ID      float64 `json:"id"`
+		Result  struct {
+			Tools []struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+			} `json:"tools"`
+		} `json:"result"`
+	}
 	if err := json.Unmarshal(resp, &jsonResp); err != nil {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	// Should return an error response
-	if jsonResp.Error == nil {
-		t.Error("Expected error response for upstream failure")
-	}
-	if jsonResp.Error.Code != CodeUpstreamError {
-		t.Errorf("Error code = %d, want %d", jsonResp.Error.Code, CodeUpstreamError)
+	if jsonResp.JSONRPC != "2.0" || jsonResp.ID != 7 {
+		t.Errorf("Envelope = (%q, %v), want (2.0, 7)", jsonResp.JSONRPC, jsonResp.ID)
 	}
-}
-
-// TestNoUpstream tests routing without upstream sender (echo mode).
-func TestNoUpstream(t *testing.T) {
-	r := NewRouter()
-	// No upstream sender set
-
-	msg := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
-	sess := session.NewSession("test_sess")
 
-	resp, err := r.Route(context.Background(), sess, []byte(msg))
-	if err != nil {
-		t.Fatalf("Route() error = %v", err)
+	var names []string
+	for _, tool := range jsonResp.Result.Tools {
+		names = append(names, tool.Name)
 	}
-
-	// Should echo back the request
-	if string(resp) != msg {
-		t.Error("Response does not match request in echo mode")
+	if len(names) != 2 || names[0] != "read_file" || names[1] != "list_dir" {
+		t.Errorf("Tools = %v, want [read_file list_dir]", names)
 	}
-}
-
-// TestBuildErrorResponse tests building custom error responses.
-func TestBuildErrorResponse(t *testing.T) {
-	r := NewRouter()
-
-	resp, err := r.BuildErrorResponse(1, CodeMethodNotFound, "Method not found")
-	if err != nil {
-		t.Fatalf("BuildErrorResponse() error = %v", err)
+	if jsonResp.Result.Tools[0].Description != "Read" {
+		t.Errorf("Tool fields not preserved: %+v", jsonResp.Result.Tools[0])
 	}
 
-	var jsonResp Response
-	if err := json.Unmarshal(resp, &jsonResp); err != nil {
-		t.Fatalf("Failed to unmarshal response: %v", err)
+	if capturedDecision == nil {
+		t.Fatal("Audit logger was not called")
 	}
-
-	// ID can be int or float64 when unmarshaled from JSON
-	if jsonResp.ID == nil {
-		t.Error("Response ID is nil")
-	} else {
-		// JSON numbers unmarshal as float64
-		if idFloat, ok := jsonResp.ID.(float64); ok {
-			if idFloat != 1.0 {
-				t.Errorf("Response ID = %v, want 1", jsonResp.ID)
-			}
-		} else if idInt, ok := jsonResp.ID.(int); ok {
-			if idInt != 1 {
-				t.Errorf("Response ID = %v, want 1", jsonResp.ID)
-			}
-		} else {
-			t.Errorf("Response ID type = %T, want int or float64", jsonResp.ID)
-		}
+	if capturedDecision.Filtered != 2 {
+		t.Errorf("Decision.Filtered = %d, want 2", capturedDecision.Filtered)
 	}
-
-	if jsonResp.Error == nil {
-		t.Error("Response error is nil")
-	} else {
-		if jsonResp.Error.Code != CodeMethodNotFound {
-			t.Errorf("Error code = %d, want %d", jsonResp.Error.Code, CodeMethodNotFound)
-		}
-		if jsonResp.Error.Message != "Method not found" {
-			t.Errorf("Error message = %s, want 'Method not found'", jsonResp.Error.Message)
-		}
+	if !capturedDecision.Allow {
+		t.Error("Filtered list request should still be allowed")
 	}
 }
 
-// TestMethodRegistry tests the method configuration registry.
-func TestMethodRegistry(t *testing.T) {
+// TestToolsListFilteringPassthrough tests responses that must not be modified.
+func TestToolsListFilteringPassthrough(t *testing.T) {
 	tests := []struct {
-		method          string
-		expectedHandler HandlerType
-		expectedLog     LogLevel
+		name     string
+		upstream string
 	}{
-		{"tools/call", HandlerFullEnforce, LogFull},
-		{"tools/list", HandlerFilter, LogMetadata},
-		{"resources/read", HandlerFullEnforce, LogFull},
-		{"resources/list", HandlerFilter, LogMetadata},
-		{"ping", HandlerPassthrough, LogNone},
-		{"initialize", HandlerPassthrough, LogMetadata},
-		{"notifications/initialized", HandlerPassthrough, LogNone},
+		{"all tools allowed", `{"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"read_file"}]}}`},
+		{"error response", `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"boom"}}`},
+		{"no tools field", `{"jsonrpc":"2.0","id":1,"result":{}}`},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.method, func(t *testing.T) {
-			cfg, ok := MethodRegistry[tt.method]
-			if !ok {
-				t.Errorf("Method %s not found in registry", tt.method)
-				return
-			}
-			if cfg.Handler != tt.expectedHandler {
-				t.Errorf("Handler = %v, want %v", cfg.Handler, tt.expectedHandler)
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+				return []byte(tt.upstream), nil
+			})
+			r.SetToolFilter(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, tool string) bool {
+				return tool == "read_file"
+			})
+
+			msg := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+			resp, err := r.Route(context.Background(), session.NewSession("test_sess"), []byte(msg))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
 			}
-			if cfg.LogLevel != tt.expectedLog {
-				t.Errorf("LogLevel = %v, want %v", cfg.LogLevel, tt.expectedLog)
+			if string(resp) != tt.upstream {
+				t.Errorf("Response = %s, want unchanged %s", resp, tt.upstream)
 			}
 		})
 	}
 }
 
-// TestUnknownMethod tests routing of unknown methods (should default to passthrough).
-func TestUnknownMethod(t *testing.T) {
+// TestResourcesListFiltering tests that resources/list responses are filtered
+// by the resource filter and that pagination cursors survive filtering.
+func TestResourcesListFiltering(t *testing.T) {
 	r := NewRouter()
 
-	upstreamCalled := false
+	upstreamResp := `{"jsonrpc":"2.0","id":"list-1","result":{"resources":[` +
+		`{"uri":"file:///data/report.csv","name":"report"},` +
+		`{"uri":"file:///etc/passwd","name":"passwd"},` +
+		`{"uri":"file:///data/notes.txt","name":"notes"},` +
+		`{"uri":"file:///etc/shadow","name":"shadow"}],` +
+		`"nextCursor":"page-2"}}`
+
+	var forwarded []byte
 	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
-		upstreamCalled = true
-		return message, nil
+		forwarded = message
+		return []byte(upstreamResp), nil
 	})
 
-	msg := `{"jsonrpc":"2.0","id":1,"method":"unknown/method"}`
+	var checked []string
+	r.SetResourceFilter(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, uri string) bool {
+		checked = append(checked, uri)
+		return !strings.HasPrefix(uri, "file:///etc/")
+	})
+
+	var capturedDecision *PolicyDecision
+	r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+		capturedDecision = decision
+	})
+
+	msg := `{"jsonrpc":"2.0","id":"list-1","method":"resources/list","params":{"cursor":"page-1"}}`
 	sess := session.NewSession("test_sess")
 
-	_, err := r.Route(context.Background(), sess, []byte(msg))
+	resp, err := r.Route(context.Background(), sess, []byte(msg))
 	if err != nil {
 		t.Fatalf("Route() error = %v", err)
 	}
 
-	// Unknown methods should be passed through
+	if string(forwarded) != msg {
+		t.Errorf("Forwarded request = %s, want %s", forwarded, msg)
+	}
+	if len(checked) != 4 {
+		t.Errorf("Resource filter called %d times, want 4", len(checked))
+	}
+
+	var jsonResp struct {
+		ID     string `json:"id"`
+		Result struct {
+			Resources []struct {
+				URI  string `json:"uri"`
+				Name string `json:"name"`
+			} `json:"resources"`
+			NextCursor string `json:"nextCursor"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &jsonResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if jsonResp.ID != "list-1" {
+		t.Errorf("ID = %q, want list-1", jsonResp.ID)
+	}
+	if jsonResp.Result.NextCursor != "page-2" {
+		t.Errorf("nextCursor = %q, want page-2", jsonResp.Result.NextCursor)
+	}
+
+	var uris []string
+	for _, res := range jsonResp.Result.Resources {
+		uris = append(uris, res.URI)
+	}
+	want := []string{"file:///data/report.csv", "file:///data/notes.txt"}
+	if len(uris) != len(want) || uris[0] != want[0] || uris[1] != want[1] {
+		t.Errorf("Resources = %v, want %v", uris, want)
+	}
+
+	if capturedDecision == nil || capturedDecision.Filtered != 2 {
+		t.Errorf("Decision = %+v, want Filtered = 2", capturedDecision)
+	}
+}
+
+// TestUpstreamError tests handling of upstream errors.
+func TestUpstreamError(t *testing.T) {
+	r := NewRouter()
+
+	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+		return &PolicyDecision{Allow: true, PolicyMode: "enforce"}, nil
+	})
+
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		return nil, errors.New("upstream connection failed")
+	})
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool"}}`
+	sess := session.NewSession("test_sess")
+
+	resp, err := r.Route(context.Background(), sess, []byte(msg))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	// Parse response
+	var jsonResp Response
+	if err := json.Unmarshal(resp, &jsonResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	// Should return an error response
+	if jsonResp.Error == nil {
+		t.Error("Expected error response for upstream failure")
+	}
+	if jsonResp.Error.Code != CodeUpstreamError {
+		t.Errorf("Error code = %d, want %d", jsonResp.Error.Code, CodeUpstreamError)
+	}
+}
+
+// TestPolicyTimeout tests that policy timeouts are reported as internal errors.
+func TestPolicyTimeout(t *testing.T) {
+	r := NewRouter()
+
+	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+		return nil, fmt.Errorf("%w: evaluation exceeded 100ms", ErrPolicyTimeout)
+	})
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool"}}`
+	sess := session.NewSession("test_sess")
+
+	resp, err := r.Route(context.Background(), sess, []byte(msg))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	var jsonResp Response
+	if err := json.Unmarshal(resp, &jsonResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if jsonResp.Error == nil {
+		t.Fatal("Expected error response for policy timeout")
+	}
+	if jsonResp.Error.Code != CodeInternalError {
+		t.Errorf("Error code = %d, want %d", jsonResp.Error.Code, CodeInternalError)
+	}
+	if jsonResp.Error.Message != "Policy timeout" {
+		t.Errorf("Error message = %q, want %q", jsonResp.Error.Message, "Policy timeout")
+	}
+}
+
+// TestObligationHandler tests that obligations run only for allowed requests.
+func TestObligationHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow       bool
+		expectCalls int
+	}{
+		{"allowed", true, 1},
+		{"denied", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+
+			r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+				return &PolicyDecision{
+					Allow:       tt.allow,
+					PolicyMode:  "enforce",
+					Obligations: []Obligation{{Action: "log", Params: map[string]string{"reason": "audit"}}},
+				}, nil
+			})
+
+			calls := 0
+			r.SetObligationHandler(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, obligations []Obligation) {
+				calls++
+				if len(obligations) != 1 || obligations[0].Action != "log" {
+					t.Errorf("Unexpected obligations: %+v", obligations)
+				}
+				if reqCtx.Tool != "test_tool" {
+					t.Errorf("Tool = %s, want test_tool", reqCtx.Tool)
+				}
+			})
+
+			msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool"}}`
+			if _, err := r.Route(context.Background(), session.NewSession("test_sess"), []byte(msg)); err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			if calls != tt.expectCalls {
+				t.Errorf("Obligation handler calls = %d, want %d", calls, tt.expectCalls)
+			}
+		})
+	}
+}
+
+// TestIdentityChecker tests that rejected identities are blocked before policy evaluation.
+func TestIdentityChecker(t *testing.T) {
+	tests := []struct {
+		name         string
+		rejection    *IdentityRejection
+		expectPolicy bool
+	}{
+		{"accepted", nil, true},
+		{"rejected", &IdentityRejection{Code: "did_blocked", Message: "DID is blocked"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+
+			r.SetIdentityChecker(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) *IdentityRejection {
+				return tt.rejection
+			})
+
+			policyCalled := false
+			r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+				policyCalled = true
+				return &PolicyDecision{Allow: true, PolicyMode: "audit"}, nil
+			})
+
+			var audited *PolicyDecision
+			r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+				audited = decision
+			})
+
+			msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool"}}`
+			resp, err := r.Route(context.Background(), session.NewSession("test_sess"), []byte(msg))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			if policyCalled != tt.expectPolicy {
+				t.Errorf("Policy evaluated = %v, want %v", policyCalled, tt.expectPolicy)
+			}
+			if tt.rejection == nil {
+				return
+			}
+
+			var jsonResp Response
+			if err := json.Unmarshal(resp, &jsonResp); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if jsonResp.Error == nil || jsonResp.Error.Code != CodeIdentityError {
+				t.Fatalf("Expected identity error, got %s", resp)
+			}
+			if jsonResp.Error.Message != tt.rejection.Message {
+				t.Errorf("Error message = %q, want %q", jsonResp.Error.Message, tt.rejection.Message)
+			}
+			if audited == nil || audited.Allow || audited.MatchedRule != tt.rejection.Code {
+				t.Errorf("Audited decision = %+v, want denial with rule %s", audited, tt.rejection.Code)
+			}
+		})
+	}
+}
+
+// TestIdentityCheckerAllMethods tests that a rejected identity reaches the
+// upstream with no method, whatever its handler.
+func TestIdentityCheckerAllMethods(t *testing.T) {
+	r := NewRouter()
+	r.SetIdentityChecker(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) *IdentityRejection {
+		return &IdentityRejection{Code: "did_blocked", Message: "DID is blocked"}
+	})
+	forwarded := 0
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		forwarded++
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	})
+
+	for _, method := range []string{"tools/list", "resources/read", "ping", "tools/call"} {
+		msg := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":{"name":"test_tool","uri":"file:///a"}}`
+		resp, err := r.Route(context.Background(), session.NewSession("test_sess"), []byte(msg))
+		if err != nil {
+			t.Fatalf("Route(%s) error = %v", method, err)
+		}
+		var jsonResp Response
+		if err := json.Unmarshal(resp, &jsonResp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if jsonResp.Error == nil || jsonResp.Error.Code != CodeIdentityError {
+			t.Errorf("%s: expected identity error, got %s", method, resp)
+		}
+	}
+	if forwarded != 0 {
+		t.Errorf("Forwarded %d requests of a rejected identity, want 0", forwarded)
+	}
+}
+
+// TestCumulativeCounters tests that forwarded reads and writes are counted on the session.
+func TestCumulativeCounters(t *testing.T) {
+	r := NewRouter()
+	r.SetWriteClassifier(func(tool string) bool { return tool == "customer_update" })
+	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+		// Deny deletes so they are never forwarded
+		return &PolicyDecision{Allow: reqCtx.Tool != "customer_delete", PolicyMode: "enforce"}, nil
+	})
+
+	sess := session.NewSession("test_sess")
+	messages := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"file:///a"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"file:///b"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"customer_update"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"customer_lookup"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"customer_delete"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/list"}`,
+	}
+	for _, msg := range messages {
+		if _, err := r.Route(context.Background(), sess, []byte(msg)); err != nil {
+			t.Fatalf("Route() error = %v", err)
+		}
+	}
+
+	reads, writes := sess.GetCumulativeCounts()
+	if reads != 2 || writes != 1 {
+		t.Errorf("Counts = %d reads, %d writes, want 2 reads, 1 write", reads, writes)
+	}
+}
+
+// TestNoUpstream tests routing without upstream sender (echo mode).
+func TestNoUpstream(t *testing.T) {
+	r := NewRouter()
+	// No upstream sender set
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	sess := session.NewSession("test_sess")
+
+	resp, err := r.Route(context.Background(), sess, []byte(msg))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	// Should echo back the request
+	if string(resp) != msg {
+		t.Error("Response does not match request in echo mode")
+	}
+}
+
+// TestBuildErrorResponse tests building custom error responses.
+func TestBuildErrorResponse(t *testing.T) {
+	r := NewRouter()
+
+	resp, err := r.BuildErrorResponse(1, CodeMethodNotFound, "Method not found")
+	if err != nil {
+		t.Fatalf("BuildErrorResponse() error = %v", err)
+	}
+
+	var jsonResp Response
+	if err := json.Unmarshal(resp, &jsonResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	// ID can be int or float64 when unmarshaled from JSON
+	if jsonResp.ID == nil {
+		t.Error("Response ID is nil")
+	} else {
+		// JSON numbers unmarshal as float64
+		if idFloat, ok := jsonResp.ID.(float64); ok {
+			if idFloat != 1.0 {
+				t.Errorf("Response ID = %v, want 1", jsonResp.ID)
+			}
+		} else if idInt, ok := jsonResp.ID.(int); ok {
+			if idInt != 1 {
+				t.Errorf("Response ID = %v, want 1", jsonResp.ID)
+			}
+		} else {
+			t.Errorf("Response ID type = %T, want int or float64", jsonResp.ID)
+		}
+	}
+
+	if jsonResp.Error == nil {
+		t.Error("Response error is nil")
+	} else {
+		if jsonResp.Error.Code != CodeMethodNotFound {
+			t.Errorf("Error code = %d, want %d", jsonResp.Error.Code, CodeMethodNotFound)
+		}
+		if jsonResp.Error.Message != "Method not found" {
+			t.Errorf("Error message = %s, want 'Method not found'", jsonResp.Error.Message)
+		}
+	}
+}
+
+// TestMethodRegistry tests the method configuration registry.
+func TestMethodRegistry(t *testing.T) {
+	tests := []struct {
+		method          string
+		expectedHandler HandlerType
+		expectedLog     LogLevel
+	}{
+		{"tools/call", HandlerFullEnforce, LogFull},
+		{"tools/list", HandlerFilter, LogMetadata},
+		{"resources/read", HandlerFullEnforce, LogFull},
+		{"resources/list", HandlerFilter, LogMetadata},
+		{"ping", HandlerPassthrough, LogNone},
+		{"initialize", HandlerPassthrough, LogMetadata},
+		{"notifications/initialized", HandlerPassthrough, LogNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			cfg, ok := MethodRegistry[tt.method]
+			if !ok {
+				t.Errorf("Method %s not found in registry", tt.method)
+				return
+			}
+			if cfg.Handler != tt.expectedHandler {
+				t.Errorf("Handler = %v, want %v", cfg.Handler, tt.expectedHandler)
+			}
+			if cfg.LogLevel != tt.expectedLog {
+				t.Errorf("LogLevel = %v, want %v", cfg.LogLevel, tt.expectedLog)
+			}
+		})
+	}
+}
+
+// TestUnknownMethod tests routing of unknown methods (should default to passthrough).
+func TestUnknownMethod(t *testing.T) {
+	r := NewRouter()
+
+	upstreamCalled := false
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		upstreamCalled = true
+		return message, nil
+	})
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"unknown/method"}`
+	sess := session.NewSession("test_sess")
+
+	_, err := r.Route(context.Background(), sess, []byte(msg))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	// Unknown methods should be passed through
 	if !upstreamCalled {
 		t.Error("Upstream should be called for unknown methods")
 	}
 }
 
-// TestAgentFactsTokenExtraction tests extraction of AgentFacts token from metadata.
-func TestAgentFactsTokenExtraction(t *testing.T) {
+// TestAgentFactsTokenExtraction tests extraction of AgentFacts token from metadata.
+func TestAgentFactsTokenExtraction(t *testing.T) {
+	r := NewRouter()
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool","_meta":{"agentfacts":"token123"}}}`
+
+	req, reqCtx, err := r.ParseAndValidate([]byte(msg))
+	if err != nil {
+		t.Fatalf("ParseAndValidate() error = %v", err)
+	}
+
+	if req.Method != "tools/call" {
+		t.Errorf("Method = %s, want tools/call", req.Method)
+	}
+
+	if reqCtx.AgentFactsToken != "token123" {
+		t.Errorf("AgentFactsToken = %s, want 'token123'", reqCtx.AgentFactsToken)
+	}
+}
+
+// TestBatchRequest tests routing of a JSON-RPC batch with mixed handlers.
+func TestBatchRequest(t *testing.T) {
+	r := NewRouter()
+
+	var evaluatedTools []string
+	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+		evaluatedTools = append(evaluatedTools, reqCtx.Tool)
+		if reqCtx.Tool == "blocked_tool" {
+			return &PolicyDecision{Allow: false, PolicyMode: "enforce", Violations: []Violation{{Message: "blocked"}}}, nil
+		}
+		return &PolicyDecision{Allow: true, PolicyMode: "enforce"}, nil
+	})
+
+	var upstreamCalls int
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		upstreamCalls++
+		var req Request
+		if err := json.Unmarshal(message, &req); err != nil {
+			return nil, err
+		}
+		resp := Response{JSONRPC: "2.0", ID: req.ID, Result: req.Method}
+		return json.Marshal(resp)
+	})
+
+	var auditCount int
+	r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+		auditCount++
+	})
+
+	msg := `[
+		{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"allowed_tool"}},
+		{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":9}},
+		{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"blocked_tool"}},
+		{"jsonrpc":"2.0","id":3,"method":"tools/list"}
+	]`
+	sess := session.NewSession("test_sess")
+
+	resp, err := r.Route(context.Background(), sess, []byte(msg))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	var responses []Response
+	if err := json.Unmarshal(resp, &responses); err != nil {
+		t.Fatalf("Failed to unmarshal batch response: %v (%s)", err, resp)
+	}
+
+	if len(responses) != 3 {
+		t.Fatalf("len(responses) = %d, want 3 (notification omitted)", len(responses))
+	}
+
+	wantIDs := []float64{1, 2, 3}
+	for i, want := range wantIDs {
+		if id, _ := responses[i].ID.(float64); id != want {
+			t.Errorf("responses[%d].ID = %v, want %v", i, responses[i].ID, want)
+		}
+	}
+
+	if responses[0].Error != nil {
+		t.Errorf("responses[0] should succeed, got error %+v", responses[0].Error)
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != CodePolicyViolation {
+		t.Errorf("responses[1] should be a policy violation, got %+v", responses[1])
+	}
+	if responses[2].Error != nil {
+		t.Errorf("responses[2] should succeed, got error %+v", responses[2].Error)
+	}
+
+	if len(evaluatedTools) != 2 {
+		t.Errorf("policy evaluated %d times, want 2", len(evaluatedTools))
+	}
+	// allowed_tool, notification, tools/list reach upstream; blocked_tool does not
+	if upstreamCalls != 3 {
+		t.Errorf("upstream called %d times, want 3", upstreamCalls)
+	}
+	if auditCount != 4 {
+		t.Errorf("audit logger called %d times, want 4", auditCount)
+	}
+}
+
+// TestBatchErrors tests batch-level and element-level error handling.
+func TestBatchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		wantCode int
+		wantLen  int // expected batch length, 0 for a single error object
+	}{
+		{
+			name:     "empty batch",
+			message:  `[]`,
+			wantCode: CodeInvalidRequest,
+		},
+		{
+			name:     "malformed batch",
+			message:  `[{"jsonrpc":"2.0","id":1,"method":"ping"},`,
+			wantCode: CodeParseError,
+		},
+		{
+			name:     "invalid element",
+			message:  `[{"jsonrpc":"1.0","id":1,"method":"ping"}, 42]`,
+			wantCode: CodeInvalidRequest,
+			wantLen:  2,
+		},
+	}
+
+	r := NewRouter()
+	sess := session.NewSession("test_sess")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := r.Route(context.Background(), sess, []byte(tt.message))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			if tt.wantLen == 0 {
+				var jsonResp Response
+				if err := json.Unmarshal(resp, &jsonResp); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if jsonResp.Error == nil || jsonResp.Error.Code != tt.wantCode {
+					t.Errorf("Response = %s, want error code %d", resp, tt.wantCode)
+				}
+				return
+			}
+
+			var responses []Response
+			if err := json.Unmarshal(resp, &responses); err != nil {
+				t.Fatalf("Failed to unmarshal batch response: %v", err)
+			}
+			if len(responses) != tt.wantLen {
+				t.Fatalf("len(responses) = %d, want %d", len(responses), tt.wantLen)
+			}
+			if responses[0].Error == nil || responses[0].Error.Code != tt.wantCode {
+				t.Errorf("responses[0] = %+v, want error code %d", responses[0], tt.wantCode)
+			}
+		})
+	}
+}
+
+// TestBatchOnlyNotifications tests that a batch of notifications yields no response.
+func TestBatchOnlyNotifications(t *testing.T) {
+	r := NewRouter()
+
+	msg := `[{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","method":"notifications/cancelled"}]`
+	sess := session.NewSession("test_sess")
+
+	resp, err := r.Route(context.Background(), sess, []byte(msg))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if resp != nil {
+		t.Errorf("Response = %s, want nil", resp)
+	}
+}
+
+// TestRateLimiter tests that requests over the limit are rejected with a
+// rate limit error and still audited.
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name       string
+		perDID     bool
+		sameLimits bool // whether the two sessions share one limit
+	}{
+		{"per session", false, false},
+		{"per DID", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			r.SetRateLimiter(NewRateLimiter(2, time.Minute, tt.perDID))
+
+			var audited *PolicyDecision
+			r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+				audited = decision
+			})
+
+			sess1 := session.NewSession("sess1")
+			sess1.SetIdentity(true, "did:key:agent")
+			sess2 := session.NewSession("sess2")
+			sess2.SetIdentity(true, "did:key:agent")
+
+			msg := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool"}}`)
+			route := func(sess *session.Session) *Response {
+				t.Helper()
+				resp, err := r.Route(context.Background(), sess, msg)
+				if err != nil {
+					t.Fatalf("Route() error = %v", err)
+				}
+				var jsonResp Response
+				if err := json.Unmarshal(resp, &jsonResp); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				return &jsonResp
+			}
+
+			for i := 0; i < 2; i++ {
+				if resp := route(sess1); resp.Error != nil {
+					t.Fatalf("Request %d error = %+v, want allowed", i+1, resp.Error)
+				}
+			}
+
+			resp := route(sess1)
+			if resp.Error == nil || resp.Error.Code != CodeRateLimited {
+				t.Fatalf("Expected rate limit error, got %+v", resp)
+			}
+			data, ok := resp.Error.Data.(map[string]interface{})
+			if !ok {
+				t.Fatalf("Error data = %T, want object", resp.Error.Data)
+			}
+			if retry, _ := data["retryAfter"].(float64); retry < 1 {
+				t.Errorf("retryAfter = %v, want at least 1", data["retryAfter"])
+			}
+			if audited == nil || audited.Allow || audited.MatchedRule != "rate_limited" {
+				t.Errorf("Audited decision = %+v, want rate_limited denial", audited)
+			}
+
+			// Another session of the same DID shares the limit only per DID
+			resp = route(sess2)
+			if limited := resp.Error != nil && resp.Error.Code == CodeRateLimited; limited != tt.sameLimits {
+				t.Errorf("Second session rate limited = %v, want %v", limited, tt.sameLimits)
+			}
+		})
+	}
+}
+
+// TestAgentRateLimits tests that a session is refused once its agent's
+// request limit from policy data is reached.
+func TestAgentRateLimits(t *testing.T) {
+	limits := NewAgentRateLimits(map[string]int{
+		"support-agent": 3,
+		"support-*":     5,
+		"analytics-*":   50,
+		"default":       10,
+	})
+	for _, tt := range []struct {
+		agentID string
+		want    int
+	}{
+		{"support-agent", 3},
+		{"support-bot", 5},
+		{"analytics-prod", 50},
+		{"other", 10},
+	} {
+		if got, ok := limits.Limit(tt.agentID); !ok || got != tt.want {
+			t.Errorf("Limit(%q) = %d, %v, want %d", tt.agentID, got, ok, tt.want)
+		}
+	}
+	if _, ok := NewAgentRateLimits(map[string]int{"a": 1}).Limit("b"); ok {
+		t.Error("Limit() without a default should not apply to other agents")
+	}
+
+	r := NewRouter()
+	r.SetAgentRateLimits(limits)
+
+	var audited *PolicyDecision
+	r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+		audited = decision
+	})
+
+	limited := session.NewSession("sess1")
+	limited.SetAgent("support-agent", "Support", nil)
+	other := session.NewSession("sess2")
+	other.SetAgent("other", "Other", nil)
+
+	msg := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool"}}`)
+	route := func(sess *session.Session) *Response {
+		t.Helper()
+		// Transports count each request before routing it
+		sess.IncrementRequestCount()
+		resp, err := r.Route(context.Background(), sess, msg)
+		if err != nil {
+			t.Fatalf("Route() error = %v", err)
+		}
+		var jsonResp Response
+		if err := json.Unmarshal(resp, &jsonResp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return &jsonResp
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := route(limited); resp.Error != nil {
+			t.Fatalf("Request %d error = %+v, want allowed", i+1, resp.Error)
+		}
+	}
+
+	resp := route(limited)
+	if resp.Error == nil || resp.Error.Code != CodeRateLimited {
+		t.Fatalf("Expected rate limit error, got %+v", resp)
+	}
+	data, ok := resp.Error.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Error data = %T, want object", resp.Error.Data)
+	}
+	if data["agent_id"] != "support-agent" || data["limit"] != float64(3) || data["requestCount"] != float64(3) {
+		t.Errorf("Error data = %v, want support-agent at 3/3", data)
+	}
+	if audited == nil || audited.Allow || audited.MatchedRule != "agent_rate_limited" {
+		t.Errorf("Audited decision = %+v, want agent_rate_limited denial", audited)
+	}
+	if len(audited.Violations) != 1 || audited.Violations[0].Category != CategoryRateLimit {
+		t.Errorf("Violations = %+v, want one rate_limit violation", audited.Violations)
+	}
+
+	// Other agents have their own limits
+	if resp := route(other); resp.Error != nil {
+		t.Errorf("Other agent error = %+v, want allowed", resp.Error)
+	}
+
+	// Clearing the limits lets the session through again
+	r.SetAgentRateLimits(nil)
+	if resp := route(limited); resp.Error != nil {
+		t.Errorf("Request after clearing limits error = %+v, want allowed", resp.Error)
+	}
+}
+
+// TestMethodFilter tests allowlist, denylist and unknown-method gating.
+func TestMethodFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow       []string
+		deny        []string
+		denyUnknown bool
+		allowed     map[string]bool // method -> expected to be forwarded
+	}{
+		{
+			name:  "allowlist only",
+			allow: []string{"initialize", "tools/list"},
+			allowed: map[string]bool{
+				"initialize":     true,
+				"tools/list":     true,
+				"prompts/list":   false,
+				"custom/unknown": false,
+			},
+		},
+		{
+			name: "denylist",
+			deny: []string{"prompts/get", "custom/unknown"},
+			allowed: map[string]bool{
+				"initialize":     true,
+				"prompts/get":    false,
+				"prompts/list":   true,
+				"custom/unknown": false,
+				"custom/other":   true,
+			},
+		},
+		{
+			name:        "deny unknown",
+			denyUnknown: true,
+			allowed: map[string]bool{
+				"prompts/list":   true,
+				"custom/unknown": false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			r.SetMethodFilter(NewMethodFilter(tt.allow, tt.deny, tt.denyUnknown))
+
+			forwarded := 0
+			r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+				forwarded++
+				return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+			})
+
+			var audited *PolicyDecision
+			r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+				audited = decision
+			})
+
+			sess := session.NewSession("sess1")
+			for method, want := range tt.allowed {
+				forwarded, audited = 0, nil
+				msg := []byte(`{"jsonrpc":"2.0","id":1,"method":"` + method + `"}`)
+				resp, err := r.Route(context.Background(), sess, msg)
+				if err != nil {
+					t.Fatalf("Route(%s) error = %v", method, err)
+				}
+
+				var jsonResp Response
+				if err := json.Unmarshal(resp, &jsonResp); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+
+				if want {
+					if jsonResp.Error != nil || forwarded != 1 {
+						t.Errorf("%s: error = %+v, forwarded %d times, want forwarded", method, jsonResp.Error, forwarded)
+					}
+					continue
+				}
+				if jsonResp.Error == nil || jsonResp.Error.Code != CodeMethodNotFound {
+					t.Errorf("%s: error = %+v, want method not found", method, jsonResp.Error)
+				}
+				if forwarded != 0 {
+					t.Errorf("%s: forwarded %d times, want 0", method, forwarded)
+				}
+				if audited == nil || audited.MatchedRule != "method_denied" {
+					t.Errorf("%s: audited decision = %+v, want method_denied", method, audited)
+				}
+			}
+		})
+	}
+}
+
+// TestMethodFilterNotification tests that rejected notifications get no
+// response.
+func TestMethodFilterNotification(t *testing.T) {
+	r := NewRouter()
+	r.SetMethodFilter(NewMethodFilter(nil, []string{"notifications/cancelled"}, false))
+
+	resp, err := r.Route(context.Background(), session.NewSession("sess1"),
+		[]byte(`{"jsonrpc":"2.0","method":"notifications/cancelled"}`))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if resp != nil {
+		t.Errorf("Route() response = %s, want none", resp)
+	}
+}
+
+// TestNotificationNoResponse tests that notifications are forwarded without
+// waiting for a response and that none is returned to the client.
+func TestNotificationNoResponse(t *testing.T) {
+	const notification = `{"jsonrpc":"2.0","method":"notifications/initialized"}`
+	reply := func(ctx context.Context, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":null,"result":{}}`), nil
+	}
+
+	tests := []struct {
+		name         string
+		sender       UpstreamSender
+		notifier     bool
+		wantNotified bool
+		wantSent     bool
+	}{
+		{"notification sender", reply, true, true, false},
+		{"upstream sender fallback", reply, false, false, true},
+		{"standalone", nil, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			sent, notified := false, false
+			if tt.sender != nil {
+				r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+					sent = true
+					return tt.sender(ctx, message)
+				})
+			}
+			if tt.notifier {
+				r.SetNotificationSender(func(ctx context.Context, message []byte) error {
+					notified = string(message) == notification
+					return nil
+				})
+			}
+
+			resp, err := r.Route(context.Background(), session.NewSession("sess1"), []byte(notification))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+			if resp != nil {
+				t.Errorf("Route() response = %s, want none", resp)
+			}
+			if notified != tt.wantNotified {
+				t.Errorf("notification sender called = %v, want %v", notified, tt.wantNotified)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("upstream sender called = %v, want %v", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+// TestMaxConcurrent tests that requests beyond a session's concurrency cap
+// are rejected with a rate limit error while the others complete, and that
+// slots free up once requests finish.
+func TestMaxConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	r := NewRouter()
+	r.SetMaxConcurrent(2)
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		started <- struct{}{}
+		<-release
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	})
+	r.SetNotificationSender(func(ctx context.Context, message []byte) error {
+		return nil
+	})
+
+	var denied *PolicyDecision
+	r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+		if decision != nil && !decision.Allow {
+			denied = decision
+		}
+	})
+
+	sess := session.NewSession("sess1")
+	call := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`)
+
+	// Fill both slots with requests blocked upstream
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := r.Route(context.Background(), sess, call)
+			done <- err
+		}()
+	}
+	<-started
+	<-started
+
+	resp, err := r.Route(context.Background(), sess, call)
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	var jsonResp struct {
+		Error *struct {
+			Code int `json:"code"`
+			Data struct {
+				MaxConcurrent int `json:"maxConcurrent"`
+				RetryAfter    int `json:"retryAfter"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &jsonResp); err != nil {
+		t.Fatalf("invalid response %s: %v", resp, err)
+	}
+	if jsonResp.Error == nil || jsonResp.Error.Code != CodeRateLimited {
+		t.Fatalf("response = %s, want rate limit error %d", resp, CodeRateLimited)
+	}
+	if jsonResp.Error.Data.MaxConcurrent != 2 || jsonResp.Error.Data.RetryAfter < 1 {
+		t.Errorf("error data = %+v, want maxConcurrent 2 and a retry hint", jsonResp.Error.Data)
+	}
+	if denied == nil || denied.MatchedRule != "concurrency_limited" {
+		t.Errorf("audited decision = %+v, want concurrency_limited", denied)
+	}
+
+	// Notifications don't take a slot
+	if _, err := r.Route(context.Background(), sess, []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled"}`)); err != nil {
+		t.Fatalf("Route() notification error = %v", err)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Route() error = %v", err)
+		}
+	}
+	if sess.InFlight() != 0 {
+		t.Errorf("InFlight() = %d after completion, want 0", sess.InFlight())
+	}
+
+	resp, err = r.Route(context.Background(), sess, call)
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if strings.Contains(string(resp), `"error"`) {
+		t.Errorf("response after slots freed = %s, want success", resp)
+	}
+}
+
+// gaugeValue returns the value of the gauge with the given name in reg.
+func gaugeValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("gauge %s not registered", name)
+	return 0
+}
+
+// TestInFlightGauge tests that the in-flight gauge counts messages while
+// they are routed, a batch as one, and returns to zero once they complete.
+func TestInFlightGauge(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{name: "single request", message: `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`},
+		{name: "batch", message: `[{"jsonrpc":"2.0","id":1,"method":"tools/list"},{"jsonrpc":"2.0","id":2,"method":"resources/list"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "requests_in_flight"})
+			reg.MustRegister(gauge)
+
+			entered := make(chan struct{}, 2)
+			release := make(chan struct{})
+			r := NewRouter()
+			r.SetInFlightGauge(gauge)
+			r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+				entered <- struct{}{}
+				<-release
+				return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+			})
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := r.Route(context.Background(), session.NewSession("sess1"), []byte(tt.message))
+				done <- err
+			}()
+
+			<-entered
+			if got := gaugeValue(t, reg, "requests_in_flight"); got != 1 {
+				t.Errorf("in flight during request = %v, want 1", got)
+			}
+
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+			if got := gaugeValue(t, reg, "requests_in_flight"); got != 0 {
+				t.Errorf("in flight after request = %v, want 0", got)
+			}
+		})
+	}
+}
+
+// TestMethodOverrides tests that overriding a passthrough method's handler
+// makes the router evaluate policy for it.
+func TestMethodOverrides(t *testing.T) {
+	override, err := NewMethodOverride("prompts/get", "enforce", "full", false)
+	if err != nil {
+		t.Fatalf("NewMethodOverride() error = %v", err)
+	}
+	if override.Handler != HandlerFullEnforce || override.LogLevel != LogFull {
+		t.Fatalf("NewMethodOverride() = %+v, want enforce with full logging", override)
+	}
+
+	tests := []struct {
+		name          string
+		overrides     map[string]MethodConfig
+		wantEvaluated bool
+	}{
+		{"built-in passthrough", nil, false},
+		{"overridden to enforce", map[string]MethodConfig{"prompts/get": override}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			r.SetMethodOverrides(tt.overrides)
+
+			evaluated := false
+			var prompt string
+			r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+				evaluated = true
+				prompt = reqCtx.Prompt
+				return &PolicyDecision{Allow: false, Violations: []Violation{{Message: "prompt denied"}}, PolicyMode: "enforce"}, nil
+			})
+			r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+				return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+			})
+
+			msg := []byte(`{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"name":"secret_prompt"}}`)
+			resp, err := r.Route(context.Background(), session.NewSession("sess1"), msg)
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			var jsonResp Response
+			if err := json.Unmarshal(resp, &jsonResp); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if evaluated != tt.wantEvaluated {
+				t.Errorf("policy evaluated = %v, want %v", evaluated, tt.wantEvaluated)
+			}
+			if denied := jsonResp.Error != nil; denied != tt.wantEvaluated {
+				t.Errorf("response error = %+v, want denied %v", jsonResp.Error, tt.wantEvaluated)
+			}
+			if tt.wantEvaluated && prompt != "secret_prompt" {
+				t.Errorf("evaluated prompt = %q, want secret_prompt", prompt)
+			}
+		})
+	}
+}
+
+// TestNewMethodOverride tests merging overrides with the built-in registry.
+func TestNewMethodOverride(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		handler     string
+		logLevel    string
+		allow       bool
+		wantHandler HandlerType
+		wantLog     LogLevel
+		wantErr     bool
+	}{
+		{"keeps built-in log level", "prompts/get", "enforce", "", false, HandlerFullEnforce, LogMetadata, false},
+		{"keeps built-in handler", "tools/call", "", "none", false, HandlerFullEnforce, LogNone, false},
+		{"unknown method", "custom/method", "enforce", "", false, HandlerFullEnforce, LogMetadata, false},
+		{"invalid handler", "prompts/get", "block", "", false, 0, 0, true},
+		{"invalid log level", "prompts/get", "", "verbose", false, 0, 0, true},
+		{"filter on non-list method", "prompts/get", "filter", "", false, 0, 0, true},
+		{"unenforced tools/call", "tools/call", "passthrough", "", false, 0, 0, true},
+		{"unenforced resources/read", "resources/read", "filter", "", false, 0, 0, true},
+		{"allowed unenforced tools/call", "tools/call", "passthrough", "", true, HandlerPassthrough, LogFull, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := NewMethodOverride(tt.method, tt.handler, tt.logLevel, tt.allow)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMethodOverride() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if cfg.Handler != tt.wantHandler || cfg.LogLevel != tt.wantLog {
+				t.Errorf("NewMethodOverride() = %+v, want handler %v log %v", cfg, tt.wantHandler, tt.wantLog)
+			}
+		})
+	}
+}
+
+// TestResourceSubscriptionRelay tests that upstream resource update
+// notifications reach only the sessions whose subscribe was allowed.
+func TestResourceSubscriptionRelay(t *testing.T) {
+	r := NewRouter()
+	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+		allow := reqCtx.ResourceURI != "file:///secret.txt"
+		return &PolicyDecision{Allow: allow, Violations: []Violation{{Message: "denied"}}, PolicyMode: "enforce"}, nil
+	})
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	})
+
+	route := func(sess *session.Session, method, uri string) {
+		t.Helper()
+		msg := []byte(`{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":{"uri":"` + uri + `"}}`)
+		if _, err := r.Route(context.Background(), sess, msg); err != nil {
+			t.Fatalf("Route(%s) error = %v", method, err)
+		}
+	}
+	// Updates are relayed asynchronously
+	received := func(sess *session.Session) string {
+		select {
+		case msg := <-sess.MessageChan:
+			return string(msg)
+		case <-time.After(50 * time.Millisecond):
+			return ""
+		}
+	}
+	updated := func(uri string) []byte {
+		return []byte(`{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"` + uri + `"}}`)
+	}
+
+	subscriber := session.NewSession("subscriber")
+	other := session.NewSession("other")
+	denied := session.NewSession("denied")
+
+	route(subscriber, "resources/subscribe", "file:///notes.txt")
+	route(denied, "resources/subscribe", "file:///secret.txt")
+
+	// Upstream pushes an update for the subscribed resource
+	r.HandleNotification(updated("file:///notes.txt"))
+	if got := received(subscriber); got != string(updated("file:///notes.txt")) {
+		t.Errorf("Subscriber received %q, want the update", got)
+	}
+	if got := received(other); got != "" {
+		t.Errorf("Unsubscribed session received %q", got)
+	}
+
+	// A denied subscribe is not registered
+	r.HandleNotification(updated("file:///secret.txt"))
+	if got := received(denied); got != "" {
+		t.Errorf("Denied session received %q", got)
+	}
+
+	// Other notifications are not relayed
+	r.HandleNotification([]byte(`{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`))
+	if got := received(subscriber); got != "" {
+		t.Errorf("Subscriber received unrelated notification %q", got)
+	}
+
+	// Unsubscribing stops updates
+	route(subscriber, "resources/unsubscribe", "file:///notes.txt")
+	r.HandleNotification(updated("file:///notes.txt"))
+	if got := received(subscriber); got != "" {
+		t.Errorf("Unsubscribed session received %q", got)
+	}
+
+	// A subscriber whose buffer stays full gets its overflow policy applied
+	full := session.NewSession("full")
+	full.SetBackpressure(session.OverflowClose, 0, nil)
+	for full.SendMessage([]byte("queued")) {
+	}
+	route(full, "resources/subscribe", "file:///notes.txt")
+	r.HandleNotification(updated("file:///notes.txt"))
+	select {
+	case <-full.Done:
+	case <-time.After(time.Second):
+		t.Error("Session with a full buffer was not closed by its overflow policy")
+	}
+}
+
+// TestSharedSubscription tests that the upstream subscription of a resource
+// is cancelled only once its last subscriber unsubscribes or closes.
+func TestSharedSubscription(t *testing.T) {
 	r := NewRouter()
+	sent := make(chan string, 10)
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		var req Request
+		if err := json.Unmarshal(message, &req); err != nil {
+			t.Errorf("Unmarshal() error = %v", err)
+		}
+		sent <- req.Method
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	})
+	route := func(sess *session.Session, method, uri string) string {
+		t.Helper()
+		msg := []byte(`{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":{"uri":"` + uri + `"}}`)
+		resp, err := r.Route(context.Background(), sess, msg)
+		if err != nil {
+			t.Fatalf("Route(%s) error = %v", method, err)
+		}
+		return string(resp)
+	}
+	upstream := func() string {
+		select {
+		case method := <-sent:
+			return method
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
 
-	msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"test_tool","_meta":{"agentfacts":"token123"}}}`
+	first := session.NewSession("first")
+	second := session.NewSession("second")
+	route(first, "resources/subscribe", "file:///notes.txt")
+	route(second, "resources/subscribe", "file:///notes.txt")
+	upstream()
+	upstream()
 
-	req, reqCtx, err := r.ParseAndValidate([]byte(msg))
+	// The first unsubscribe is answered by the proxy
+	if resp := route(first, "resources/unsubscribe", "file:///notes.txt"); !strings.Contains(resp, `"result"`) {
+		t.Errorf("Shared unsubscribe response = %s, want a result", resp)
+	}
+	select {
+	case method := <-sent:
+		t.Errorf("Shared unsubscribe sent %s upstream", method)
+	default:
+	}
+	if got := r.subscriptions.Sessions("file:///notes.txt"); len(got) != 1 || got[0] != second {
+		t.Errorf("Subscribers = %v, want the second session", got)
+	}
+
+	// Closing the last subscriber cancels the upstream subscription
+	r.SessionClosed(second)
+	if method := upstream(); method != "resources/unsubscribe" {
+		t.Errorf("Upstream received %q after the last subscriber closed, want resources/unsubscribe", method)
+	}
+	if got := r.subscriptions.Sessions("file:///notes.txt"); len(got) != 0 {
+		t.Errorf("Subscribers = %v after close, want none", got)
+	}
+
+	// Without other subscribers, unsubscribe reaches the upstream
+	route(first, "resources/subscribe", "file:///notes.txt")
+	upstream()
+	route(first, "resources/unsubscribe", "file:///notes.txt")
+	if method := upstream(); method != "resources/unsubscribe" {
+		t.Errorf("Upstream received %q, want resources/unsubscribe", method)
+	}
+}
+
+// TestDryRun tests that a dry run forwards a denied request and is flagged
+// for the audit logger, and only for verified agents allowed dry runs.
+func TestDryRun(t *testing.T) {
+	const (
+		plain   = `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_file"}}`
+		metaRun = `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_file","_meta":{"dry_run":true}}}`
+		tester  = "did:example:tester"
+	)
+
+	tests := []struct {
+		name          string
+		dryRunDIDs    []string
+		did           string // Verified identity of the session, if any
+		message       string
+		header        bool
+		wantForwarded bool
+	}{
+		{"no dry run", []string{tester}, tester, plain, false, false},
+		{"meta dry run", []string{tester}, tester, metaRun, false, true},
+		{"header dry run", []string{tester}, tester, plain, true, true},
+		{"dry runs disabled", nil, tester, metaRun, true, false},
+		{"unverified agent", []string{tester}, "", metaRun, true, false},
+		{"agent not allowed", []string{tester}, "did:example:other", metaRun, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			r.SetDryRunDIDs(tt.dryRunDIDs)
+			r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+				return &PolicyDecision{Allow: false, Violations: []Violation{{Message: "delete not allowed"}}, PolicyMode: "enforce"}, nil
+			})
+
+			forwarded := false
+			r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+				forwarded = true
+				return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+			})
+
+			var auditedDryRun bool
+			r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+				auditedDryRun = reqCtx.DryRun
+			})
+
+			ctx := context.Background()
+			if tt.header {
+				ctx = transport.WithDryRun(ctx)
+			}
+			sess := session.NewSession("sess1")
+			if tt.did != "" {
+				sess.SetIdentity(true, tt.did)
+			}
+			resp, err := r.Route(ctx, sess, []byte(tt.message))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			var jsonResp Response
+			if err := json.Unmarshal(resp, &jsonResp); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if forwarded != tt.wantForwarded {
+				t.Errorf("forwarded = %v, want %v", forwarded, tt.wantForwarded)
+			}
+			if blocked := jsonResp.Error != nil; blocked == tt.wantForwarded {
+				t.Errorf("response error = %+v, want blocked %v", jsonResp.Error, !tt.wantForwarded)
+			}
+			if auditedDryRun != tt.wantForwarded {
+				t.Errorf("audited DryRun = %v, want %v", auditedDryRun, tt.wantForwarded)
+			}
+		})
+	}
+}
+
+// TestInvalidMeta tests that a malformed _meta is rejected as invalid
+// params rather than ignored.
+func TestInvalidMeta(t *testing.T) {
+	r := NewRouter()
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		t.Error("request with invalid _meta was forwarded")
+		return nil, nil
+	})
+
+	resp, err := r.Route(context.Background(), session.NewSession("sess1"),
+		[]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file","_meta":{"dry_run":"yes"}}}`))
 	if err != nil {
-		t.Fatalf("ParseAndValidate() error = %v", err)
+		t.Fatalf("Route() error = %v", err)
 	}
 
-	if req.Method != "tools/call" {
-		t.Errorf("Method = %s, want tools/call", req.Method)
+	var jsonResp Response
+	if err := json.Unmarshal(resp, &jsonResp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
+	if jsonResp.Error == nil || jsonResp.Error.Code != CodeInvalidParams {
+		t.Errorf("response error = %+v, want invalid params", jsonResp.Error)
+	}
+}
 
-	if reqCtx.AgentFactsToken != "token123" {
-		t.Errorf("AgentFactsToken = %s, want 'token123'", reqCtx.AgentFactsToken)
+// TestEchoedResponses tests that responses echoed back because no upstream
+// is connected are flagged for the audit log, and real ones are not.
+func TestEchoedResponses(t *testing.T) {
+	const (
+		call = `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`
+		list = `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`
+	)
+	forward := func(ctx context.Context, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`), nil
+	}
+	standalone := func(ctx context.Context, message []byte) ([]byte, error) {
+		return nil, ErrStandalone
+	}
+	failing := func(ctx context.Context, message []byte) ([]byte, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	tests := []struct {
+		name       string
+		sender     UpstreamSender
+		message    string
+		wantEchoed bool
+	}{
+		{"forwarded", forward, call, false},
+		{"standalone", standalone, call, true},
+		{"standalone list", standalone, list, true},
+		{"no sender", nil, call, true},
+		{"upstream error", failing, call, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			if tt.sender != nil {
+				r.SetUpstreamSender(tt.sender)
+			}
+
+			audited := false
+			var auditedEchoed bool
+			r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+				audited = true
+				auditedEchoed = reqCtx.Echoed
+			})
+
+			resp, err := r.Route(context.Background(), session.NewSession("sess1"), []byte(tt.message))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+			if !audited {
+				t.Fatal("audit logger not called")
+			}
+			if auditedEchoed != tt.wantEchoed {
+				t.Errorf("audited Echoed = %v, want %v", auditedEchoed, tt.wantEchoed)
+			}
+			if tt.wantEchoed && string(resp) != tt.message {
+				t.Errorf("response = %s, want the request echoed back", resp)
+			}
+		})
+	}
+}
+
+// TestRequestIDPropagation tests that a request ID from the context is used
+// for the audit record and forwarded upstream, and that one is generated
+// when absent.
+func TestRequestIDPropagation(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"provided", "client-req-7"},
+		{"generated", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+
+			var forwardedID string
+			r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+				forwardedID = transport.RequestIDFromContext(ctx)
+				return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+			})
+
+			var auditedID string
+			r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+				auditedID = reqCtx.RequestID
+			})
+
+			ctx := context.Background()
+			if tt.id != "" {
+				ctx = transport.WithRequestID(ctx, tt.id)
+			}
+			msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`
+			if _, err := r.Route(ctx, session.NewSession("sess1"), []byte(msg)); err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			if auditedID == "" {
+				t.Fatal("audited RequestID is empty")
+			}
+			if tt.id != "" && auditedID != tt.id {
+				t.Errorf("audited RequestID = %q, want %q", auditedID, tt.id)
+			}
+			if forwardedID != auditedID {
+				t.Errorf("forwarded request ID = %q, want %q", forwardedID, auditedID)
+			}
+		})
+	}
+}
+
+// TestHandlerTimeouts tests that a slow upstream is cut off after the
+// handler's timeout with an upstream error, and that handlers without a
+// timeout wait for it.
+func TestHandlerTimeouts(t *testing.T) {
+	slow := func(ctx context.Context, message []byte) ([]byte, error) {
+		// Ignores ctx, like a sender stuck on a backend
+		time.Sleep(200 * time.Millisecond)
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`), nil
+	}
+
+	tests := []struct {
+		name        string
+		message     string
+		timeouts    map[HandlerType]time.Duration
+		wantTimeout bool
+	}{
+		{
+			name:        "enforce times out",
+			message:     `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`,
+			timeouts:    map[HandlerType]time.Duration{HandlerFullEnforce: 20 * time.Millisecond},
+			wantTimeout: true,
+		},
+		{
+			name:        "passthrough times out",
+			message:     `{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+			timeouts:    map[HandlerType]time.Duration{HandlerPassthrough: 20 * time.Millisecond},
+			wantTimeout: true,
+		},
+		{
+			name:        "filter times out",
+			message:     `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			timeouts:    map[HandlerType]time.Duration{HandlerFilter: 20 * time.Millisecond},
+			wantTimeout: true,
+		},
+		{
+			name:     "other handler's timeout",
+			message:  `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			timeouts: map[HandlerType]time.Duration{HandlerFullEnforce: 20 * time.Millisecond},
+		},
+		{
+			name:    "no timeouts",
+			message: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			r.SetUpstreamSender(slow)
+			r.SetHandlerTimeouts(tt.timeouts)
+
+			start := time.Now()
+			resp, err := r.Route(context.Background(), session.NewSession("sess1"), []byte(tt.message))
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			var jsonResp struct {
+				Error *struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(resp, &jsonResp); err != nil {
+				t.Fatalf("invalid response %s: %v", resp, err)
+			}
+
+			if !tt.wantTimeout {
+				if jsonResp.Error != nil {
+					t.Errorf("response error = %+v, want the upstream result", jsonResp.Error)
+				}
+				return
+			}
+			if elapsed >= 200*time.Millisecond {
+				t.Errorf("Route() took %s, want cut off near 20ms", elapsed)
+			}
+			if jsonResp.Error == nil || jsonResp.Error.Code != CodeUpstreamError {
+				t.Fatalf("response = %s, want upstream error %d", resp, CodeUpstreamError)
+			}
+			if !strings.Contains(jsonResp.Error.Message, "upstream timeout") {
+				t.Errorf("error message = %q, want an upstream timeout", jsonResp.Error.Message)
+			}
+		})
+	}
+}
+
+// TestLatencyBreakdown tests that policy, upstream and total durations are
+// all passed to the audit logger.
+func TestLatencyBreakdown(t *testing.T) {
+	const delay = 5 * time.Millisecond
+
+	r := NewRouter()
+	r.SetPolicyEvaluator(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext) (*PolicyDecision, error) {
+		time.Sleep(delay)
+		return &PolicyDecision{Allow: true, PolicyMode: "enforce"}, nil
+	})
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		time.Sleep(delay)
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	})
+
+	var policyLatency, upstreamLatency, total time.Duration
+	r.SetAuditLogger(func(ctx context.Context, sess *session.Session, reqCtx *RequestContext, decision *PolicyDecision, response []byte, latency time.Duration) {
+		policyLatency = reqCtx.PolicyLatency
+		upstreamLatency = reqCtx.UpstreamLatency
+		total = latency
+	})
+
+	msg := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`)
+	if _, err := r.Route(context.Background(), session.NewSession("sess1"), msg); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	if policyLatency < delay {
+		t.Errorf("PolicyLatency = %v, want at least %v", policyLatency, delay)
+	}
+	if upstreamLatency < delay {
+		t.Errorf("UpstreamLatency = %v, want at least %v", upstreamLatency, delay)
+	}
+	if total < policyLatency+upstreamLatency {
+		t.Errorf("total latency = %v, want at least %v", total, policyLatency+upstreamLatency)
+	}
+}
+
+// TestNotificationAnyMethod tests that any message without an ID is a
+// notification, not only methods under notifications/.
+func TestNotificationAnyMethod(t *testing.T) {
+	const notification = `{"jsonrpc":"2.0","method":"tools/list"}`
+
+	r := NewRouter()
+	sent, notified := false, false
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		sent = true
+		return []byte(`{"jsonrpc":"2.0","id":null,"result":{}}`), nil
+	})
+	r.SetNotificationSender(func(ctx context.Context, message []byte) error {
+		notified = string(message) == notification
+		return nil
+	})
+
+	resp, err := r.Route(context.Background(), session.NewSession("sess1"), []byte(notification))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if resp != nil {
+		t.Errorf("Route() response = %s, want none", resp)
+	}
+	if !notified || sent {
+		t.Errorf("notification sender called = %v, upstream sender called = %v, want only the notification sender", notified, sent)
+	}
+}
+
+// TestMaxResponseBytes tests that upstream responses over the limit are
+// replaced with an upstream error and that every response size is observed.
+func TestMaxResponseBytes(t *testing.T) {
+	large := `{"jsonrpc":"2.0","id":1,"result":{"content":"` + strings.Repeat("x", 4096) + `"}}`
+
+	tests := []struct {
+		name     string
+		message  string
+		response string
+		wantErr  bool
+	}{
+		{
+			name:     "small enforced response",
+			message:  `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`,
+			response: `{"jsonrpc":"2.0","id":1,"result":{}}`,
+		},
+		{
+			name:     "oversized enforced response",
+			message:  `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`,
+			response: large,
+			wantErr:  true,
+		},
+		{
+			name:     "oversized filtered response",
+			message:  `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			response: large,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "upstream_response_size_bytes"})
+			reg.MustRegister(histogram)
+
+			r := NewRouter()
+			r.SetMaxResponseBytes(1024)
+			r.SetResponseSizeHistogram(histogram)
+			r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+				return []byte(tt.response), nil
+			})
+
+			resp, err := r.Route(context.Background(), session.NewSession("sess1"), []byte(tt.message))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+
+			var jsonResp Response
+			if err := json.Unmarshal(resp, &jsonResp); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if !tt.wantErr {
+				if jsonResp.Error != nil {
+					t.Errorf("Error = %+v, want the upstream response", jsonResp.Error)
+				}
+			} else if jsonResp.Error == nil || jsonResp.Error.Code != CodeUpstreamError || !strings.Contains(jsonResp.Error.Message, "response too large") {
+				t.Errorf("Error = %+v, want upstream error \"response too large\"", jsonResp.Error)
+			}
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("Gather() error = %v", err)
+			}
+			h := families[0].GetMetric()[0].GetHistogram()
+			if h.GetSampleCount() != 1 || h.GetSampleSum() != float64(len(tt.response)) {
+				t.Errorf("histogram count = %d, sum = %v, want 1, %d", h.GetSampleCount(), h.GetSampleSum(), len(tt.response))
+			}
+		})
 	}
 }
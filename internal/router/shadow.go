@@ -0,0 +1,277 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/transport"
+	json "github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+)
+
+// Shadow mirrors requests to a secondary upstream and compares its
+// responses with the primary's. Shadow responses are never returned to the
+// client, and the primary path never waits for the shadow.
+type Shadow struct {
+	sender       UpstreamSender
+	notifier     NotificationSender
+	methods      []string
+	timeout      time.Duration
+	onDivergence func(d ShadowDivergence)
+
+	// Client handshakes, sent to the shadow in order by one goroutine
+	handshakes     chan shadowHandshake
+	startHandshake sync.Once
+}
+
+// shadowHandshake is a handshake message waiting to be sent to the shadow.
+type shadowHandshake struct {
+	message      []byte
+	notification bool
+}
+
+// shadowHandshakeMethods are the messages passed to Shadow.Handshake.
+var shadowHandshakeMethods = map[string]bool{
+	"initialize":                true,
+	"notifications/initialized": true,
+}
+
+// shadowHandshakeQueue is how many handshake messages can wait for the
+// shadow; more are dropped.
+const shadowHandshakeQueue = 64
+
+// ShadowDivergence describes how a shadow response differed from the
+// primary response to the same request.
+type ShadowDivergence struct {
+	RequestID   string
+	Method      string
+	Differences []string
+	PrimarySize int
+	ShadowSize  int
+}
+
+// NewShadow creates a shadow that mirrors requests whose method matches one
+// of the methods globs to sender, giving each at most timeout.
+func NewShadow(sender UpstreamSender, methods []string, timeout time.Duration) *Shadow {
+	return &Shadow{
+		sender:     sender,
+		methods:    methods,
+		timeout:    timeout,
+		handshakes: make(chan shadowHandshake, shadowHandshakeQueue),
+	}
+}
+
+// SetNotificationSender sets the callback sending notifications to the
+// shadow. Without one, they go through the shadow's sender.
+func (s *Shadow) SetNotificationSender(fn NotificationSender) {
+	s.notifier = fn
+}
+
+// SetOnDivergence sets a callback invoked after each divergence is logged.
+func (s *Shadow) SetOnDivergence(fn func(d ShadowDivergence)) {
+	s.onDivergence = fn
+}
+
+// Matches reports whether requests for method are mirrored.
+func (s *Shadow) Matches(method string) bool {
+	for _, pattern := range s.methods {
+		if ok, _ := path.Match(pattern, method); ok {
+			return ok
+		}
+	}
+	return false
+}
+
+// Mirror sends a copy of message to the shadow in the background and
+// returns a function to call exactly once with the primary response. The
+// comparison runs once both have answered; a nil primary response, such as
+// after an upstream error, skips it.
+func (s *Shadow) Mirror(requestID, method string, message []byte) func(primary []byte) {
+	message = bytes.Clone(message)
+	primaryCh := make(chan []byte, 1)
+
+	go func() {
+		// Detached from the client request so its end doesn't cancel the
+		// shadow, but keeping the request ID for correlation
+		ctx, cancel := context.WithTimeout(transport.WithRequestID(context.Background(), requestID), s.timeout)
+		defer cancel()
+
+		shadow, err := s.sender(ctx, message)
+		primary := <-primaryCh
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("request_id", requestID).
+				Str("method", method).
+				Msg("Shadow request failed")
+			return
+		}
+		if primary == nil {
+			return
+		}
+
+		differences := compareResponses(primary, shadow)
+		if len(differences) == 0 {
+			return
+		}
+		d := ShadowDivergence{
+			RequestID:   requestID,
+			Method:      method,
+			Differences: differences,
+			PrimarySize: len(primary),
+			ShadowSize:  len(shadow),
+		}
+		log.Warn().
+			Str("request_id", requestID).
+			Str("method", method).
+			Strs("differences", differences).
+			Int("primary_bytes", d.PrimarySize).
+			Int("shadow_bytes", d.ShadowSize).
+			Msg("Shadow response diverged")
+		if s.onDivergence != nil {
+			s.onDivergence(d)
+		}
+	}()
+
+	return func(primary []byte) {
+		primaryCh <- bytes.Clone(primary)
+	}
+}
+
+// Handshake sends the shadow a client's initialize request or
+// notifications/initialized, so that mirrored requests reach a server that
+// has been initialized. Messages are sent in the order they arrive, without
+// the primary path waiting, and their responses aren't compared.
+func (s *Shadow) Handshake(message []byte, notification bool) {
+	s.startHandshake.Do(func() { go s.sendHandshakes() })
+
+	select {
+	case s.handshakes <- shadowHandshake{bytes.Clone(message), notification}:
+	default:
+		log.Warn().Msg("Shadow handshake queue full, dropping message")
+	}
+}
+
+// sendHandshakes sends queued handshake messages to the shadow one by one.
+func (s *Shadow) sendHandshakes() {
+	for h := range s.handshakes {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		var err error
+		if h.notification && s.notifier != nil {
+			err = s.notifier(ctx, h.message)
+		} else {
+			_, err = s.sender(ctx, h.message)
+		}
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to send handshake to shadow upstream")
+		}
+	}
+}
+
+// maxCompareDepth bounds how deep response shapes are compared.
+const maxCompareDepth = 8
+
+// compareResponses returns the differences in shape between two JSON-RPC
+// responses: result versus error, error codes, object keys, value types and
+// array lengths. Scalar values aren't compared, since they often differ
+// legitimately between backends (timestamps, IDs).
+func compareResponses(primary, shadow []byte) []string {
+	type rpcResponse struct {
+		Result interface{} `json:"result"`
+		Error  *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+
+	var p, s rpcResponse
+	if err := json.Unmarshal(primary, &p); err != nil {
+		return []string{"primary response is not valid JSON"}
+	}
+	if err := json.Unmarshal(shadow, &s); err != nil {
+		return []string{"shadow response is not valid JSON"}
+	}
+
+	switch {
+	case p.Error == nil && s.Error != nil:
+		return []string{fmt.Sprintf("shadow returned error %d, primary a result", s.Error.Code)}
+	case p.Error != nil && s.Error == nil:
+		return []string{fmt.Sprintf("primary returned error %d, shadow a result", p.Error.Code)}
+	case p.Error != nil:
+		if p.Error.Code != s.Error.Code {
+			return []string{fmt.Sprintf("error code %d, shadow %d", p.Error.Code, s.Error.Code)}
+		}
+		return nil
+	}
+
+	var differences []string
+	compareShape("result", p.Result, s.Result, 0, &differences)
+	return differences
+}
+
+// compareShape appends the shape differences between a and b, found at
+// path, to differences.
+func compareShape(path string, a, b interface{}, depth int, differences *[]string) {
+	if ta, tb := jsonType(a), jsonType(b); ta != tb {
+		*differences = append(*differences, fmt.Sprintf("%s: %s, shadow %s", path, ta, tb))
+		return
+	}
+	if depth >= maxCompareDepth {
+		return
+	}
+
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b := b.(map[string]interface{})
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			av, inA := a[k]
+			bv, inB := b[k]
+			switch {
+			case !inB:
+				*differences = append(*differences, fmt.Sprintf("%s.%s: missing in shadow", path, k))
+			case !inA:
+				*differences = append(*differences, fmt.Sprintf("%s.%s: only in shadow", path, k))
+			default:
+				compareShape(path+"."+k, av, bv, depth+1, differences)
+			}
+		}
+	case []interface{}:
+		b := b.([]interface{})
+		if len(a) != len(b) {
+			*differences = append(*differences, fmt.Sprintf("%s: %d items, shadow %d", path, len(a), len(b)))
+		}
+	}
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	default:
+		return "number"
+	}
+}
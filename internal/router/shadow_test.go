@@ -0,0 +1,211 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// TestShadowDivergence tests that a diverging shadow response is logged
+// while the client gets the primary response.
+func TestShadowDivergence(t *testing.T) {
+	var logs bytes.Buffer
+	saved, savedLevel := log.Logger, zerolog.GlobalLevel()
+	log.Logger = zerolog.New(&logs)
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	t.Cleanup(func() {
+		log.Logger = saved
+		zerolog.SetGlobalLevel(savedLevel)
+	})
+
+	const primary = `{"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"a"},{"name":"b"}]}}`
+	r := NewRouter()
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		return []byte(primary), nil
+	})
+
+	shadow := NewShadow(func(ctx context.Context, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"a"}],"nextCursor":"x"}}`), nil
+	}, []string{"tools/list"}, time.Second)
+	diverged := make(chan ShadowDivergence, 1)
+	shadow.SetOnDivergence(func(d ShadowDivergence) { diverged <- d })
+	r.SetShadow(shadow)
+
+	resp, err := r.Route(context.Background(), session.NewSession("sess1"), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if string(resp) != primary {
+		t.Errorf("response = %s, want the primary response", resp)
+	}
+
+	select {
+	case d := <-diverged:
+		want := []string{"result.nextCursor: only in shadow", "result.tools: 2 items, shadow 1"}
+		if !reflect.DeepEqual(d.Differences, want) {
+			t.Errorf("Differences = %v, want %v", d.Differences, want)
+		}
+		if d.Method != "tools/list" || d.RequestID == "" {
+			t.Errorf("divergence = %+v, want method and request ID set", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("divergence not reported")
+	}
+
+	if !strings.Contains(logs.String(), "Shadow response diverged") {
+		t.Errorf("logs = %s, want the divergence logged", logs.String())
+	}
+}
+
+// TestShadowMethods tests that only allowlisted methods are mirrored and
+// that a slow shadow doesn't delay the primary response.
+func TestShadowMethods(t *testing.T) {
+	mirrored := make(chan string, 2)
+	shadow := NewShadow(func(ctx context.Context, message []byte) ([]byte, error) {
+		mirrored <- string(message)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, []string{"resources/*"}, 500*time.Millisecond)
+
+	r := NewRouter()
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	})
+	r.SetShadow(shadow)
+
+	sess := session.NewSession("sess1")
+	start := time.Now()
+	if _, err := r.Route(context.Background(), sess, []byte(`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`)); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if _, err := r.Route(context.Background(), sess, []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"delete_file"}}`)); err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("Route() took %s, want no wait for the shadow", elapsed)
+	}
+
+	select {
+	case msg := <-mirrored:
+		if !strings.Contains(msg, "resources/list") {
+			t.Errorf("mirrored %s, want resources/list", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("resources/list not mirrored")
+	}
+	select {
+	case msg := <-mirrored:
+		t.Errorf("mirrored %s, want tools/call skipped", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestShadowHandshake tests that the shadow gets the client's handshake in
+// order, initialize through the sender and notifications/initialized through
+// the notification sender, without comparing them.
+func TestShadowHandshake(t *testing.T) {
+	sent := make(chan string, 3)
+	shadow := NewShadow(func(ctx context.Context, message []byte) ([]byte, error) {
+		sent <- "request " + string(message)
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	}, []string{"*"}, time.Second)
+	shadow.SetNotificationSender(func(ctx context.Context, message []byte) error {
+		sent <- "notification " + string(message)
+		return nil
+	})
+
+	r := NewRouter()
+	r.SetUpstreamSender(func(ctx context.Context, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-06-18"}}`), nil
+	})
+	r.SetNotificationSender(func(ctx context.Context, message []byte) error { return nil })
+	r.SetShadow(shadow)
+
+	sess := session.NewSession("sess1")
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`
+	initialized := `{"jsonrpc":"2.0","method":"notifications/initialized"}`
+	for _, msg := range []string{initialize, initialized} {
+		if _, err := r.Route(context.Background(), sess, []byte(msg)); err != nil {
+			t.Fatalf("Route() error = %v", err)
+		}
+	}
+
+	for _, want := range []string{"request " + initialize, "notification " + initialized} {
+		select {
+		case got := <-sent:
+			if got != want {
+				t.Errorf("shadow got %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("shadow never got %s", want)
+		}
+	}
+	select {
+	case got := <-sent:
+		t.Errorf("shadow got %s, want the handshake sent once", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestCompareResponses tests the shape differences found between primary
+// and shadow responses.
+func TestCompareResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		shadow  string
+		want    []string
+	}{
+		{
+			name:    "same shape, different values",
+			primary: `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"text":"a"}],"ts":1}}`,
+			shadow:  `{"jsonrpc":"2.0","id":1,"result":{"contents":[{"text":"b"}],"ts":2}}`,
+		},
+		{
+			name:    "type changed",
+			primary: `{"jsonrpc":"2.0","id":1,"result":{"count":1}}`,
+			shadow:  `{"jsonrpc":"2.0","id":1,"result":{"count":"1"}}`,
+			want:    []string{"result.count: number, shadow string"},
+		},
+		{
+			name:    "missing key",
+			primary: `{"jsonrpc":"2.0","id":1,"result":{"a":{"b":true}}}`,
+			shadow:  `{"jsonrpc":"2.0","id":1,"result":{"a":{}}}`,
+			want:    []string{"result.a.b: missing in shadow"},
+		},
+		{
+			name:    "shadow error",
+			primary: `{"jsonrpc":"2.0","id":1,"result":{}}`,
+			shadow:  `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"not found"}}`,
+			want:    []string{"shadow returned error -32601, primary a result"},
+		},
+		{
+			name:    "error codes",
+			primary: `{"jsonrpc":"2.0","id":1,"error":{"code":-32602}}`,
+			shadow:  `{"jsonrpc":"2.0","id":1,"error":{"code":-32603}}`,
+			want:    []string{"error code -32602, shadow -32603"},
+		},
+		{
+			name:    "invalid shadow",
+			primary: `{"jsonrpc":"2.0","id":1,"result":{}}`,
+			shadow:  `not json`,
+			want:    []string{"shadow response is not valid JSON"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compareResponses([]byte(tt.primary), []byte(tt.shadow))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareResponses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
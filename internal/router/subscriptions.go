@@ -0,0 +1,219 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	json "github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+)
+
+// methodResourceUpdated is the notification an upstream sends when a
+// subscribed resource changes.
+const methodResourceUpdated = "notifications/resources/updated"
+
+// changeNotifications are the upstream notifications saying that lists or
+// resources it returned have changed.
+var changeNotifications = map[string]bool{
+	"notifications/tools/list_changed":     true,
+	"notifications/resources/list_changed": true,
+	"notifications/prompts/list_changed":   true,
+	methodResourceUpdated:                  true,
+}
+
+// unsubscribeTimeout limits the resources/unsubscribe the proxy sends for
+// subscriptions left by closed sessions.
+const unsubscribeTimeout = 10 * time.Second
+
+// Subscriptions records which sessions subscribed to which resource URIs,
+// so update notifications from the shared upstream connection reach the
+// right clients. The upstream holds one subscription per URI for all of
+// them, which is only cancelled once no session is subscribed any more.
+type Subscriptions struct {
+	mu    sync.Mutex
+	byURI map[string]map[string]*session.Session // uri -> session ID -> session
+}
+
+// NewSubscriptions creates an empty subscription registry.
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{byURI: make(map[string]map[string]*session.Session)}
+}
+
+// Add subscribes sess to updates of uri.
+func (s *Subscriptions) Add(uri string, sess *session.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := s.byURI[uri]
+	if subs == nil {
+		subs = make(map[string]*session.Session)
+		s.byURI[uri] = subs
+	}
+	subs[sess.ID] = sess
+}
+
+// Remove unsubscribes the session from updates of uri and returns the
+// number of sessions still subscribed to it.
+func (s *Subscriptions) Remove(uri, sessionID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.byURI[uri], sessionID)
+	if len(s.byURI[uri]) == 0 {
+		delete(s.byURI, uri)
+	}
+	return len(s.byURI[uri])
+}
+
+// RemoveSession unsubscribes the session from every URI and returns the
+// URIs it was the last subscriber of.
+func (s *Subscriptions) RemoveSession(sessionID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var unused []string
+	for uri, subs := range s.byURI {
+		if _, ok := subs[sessionID]; !ok {
+			continue
+		}
+		delete(subs, sessionID)
+		if len(subs) == 0 {
+			delete(s.byURI, uri)
+			unused = append(unused, uri)
+		}
+	}
+	return unused
+}
+
+// Sessions returns the open sessions subscribed to uri. Closed sessions are
+// dropped from the registry.
+func (s *Subscriptions) Sessions(uri string) []*session.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var open []*session.Session
+	for id, sess := range s.byURI[uri] {
+		if sess.IsClosed() {
+			delete(s.byURI[uri], id)
+			continue
+		}
+		open = append(open, sess)
+	}
+	if len(s.byURI[uri]) == 0 {
+		delete(s.byURI, uri)
+	}
+	return open
+}
+
+// trackSubscription updates the registry after a resources/subscribe
+// request. Subscribes count only once the upstream has accepted them.
+func (r *Router) trackSubscription(sess *session.Session, reqCtx *RequestContext, response []byte) {
+	if reqCtx.Method != "resources/subscribe" || reqCtx.ResourceURI == "" {
+		return
+	}
+
+	var resp Response
+	if err := json.Unmarshal(response, &resp); err != nil || resp.Error != nil || resp.Result == nil {
+		return
+	}
+	r.subscriptions.Add(reqCtx.ResourceURI, sess)
+	log.Debug().
+		Str("session_id", sess.ID).
+		Str("uri", reqCtx.ResourceURI).
+		Msg("Resource subscription added")
+}
+
+// unsubscribe removes the session's subscription for a resources/unsubscribe
+// request and reports whether other sessions are still subscribed to the
+// resource, in which case the request must not reach the upstream.
+func (r *Router) unsubscribe(sess *session.Session, reqCtx *RequestContext) bool {
+	if reqCtx.Method != "resources/unsubscribe" || reqCtx.ResourceURI == "" {
+		return false
+	}
+	return r.subscriptions.Remove(reqCtx.ResourceURI, sess.ID) > 0
+}
+
+// SessionClosed drops the subscriptions of a closed session, cancelling
+// upstream those no other session shares.
+func (r *Router) SessionClosed(sess *session.Session) {
+	for _, uri := range r.subscriptions.RemoveSession(sess.ID) {
+		go r.unsubscribeUpstream(uri)
+	}
+}
+
+// unsubscribeUpstream sends resources/unsubscribe for uri to the upstream.
+func (r *Router) unsubscribeUpstream(uri string) {
+	if r.upstreamSender == nil {
+		return
+	}
+	message, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      "unsubscribe",
+		"method":  "resources/unsubscribe",
+		"params":  map[string]string{"uri": uri},
+	})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+	defer cancel()
+	if _, err := r.upstreamSender(ctx, message); err != nil && !errors.Is(err, ErrStandalone) {
+		log.Warn().Err(err).Str("uri", uri).Msg("Failed to cancel upstream resource subscription")
+		return
+	}
+	log.Debug().Str("uri", uri).Msg("Upstream resource subscription cancelled")
+}
+
+// HandleNotification relays a notification pushed by the upstream to the
+// sessions it concerns. Resource update notifications go to the sessions
+// subscribed to the resource; other notifications are dropped. Change
+// notifications clear the response cache, whose results they make stale.
+func (r *Router) HandleNotification(message []byte) {
+	var notification struct {
+		Method string `json:"method"`
+		Params struct {
+			URI string `json:"uri"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(message, &notification); err != nil {
+		log.Warn().Err(err).Msg("Failed to parse upstream notification")
+		return
+	}
+
+	if r.responseCache != nil && changeNotifications[notification.Method] {
+		r.responseCache.Clear()
+	}
+
+	if notification.Method != methodResourceUpdated {
+		log.Debug().Str("method", notification.Method).Msg("Dropping upstream notification")
+		return
+	}
+
+	for _, sess := range r.subscriptions.Sessions(notification.Params.URI) {
+		// Deliver may wait for room under the session's overflow policy;
+		// never hold up the upstream reader on a slow client
+		go relayNotification(sess, notification.Params.URI, message)
+	}
+}
+
+// relayNotification delivers an upstream notification to sess, applying the
+// session's overflow policy when its message buffer is full.
+func relayNotification(sess *session.Session, uri string, message []byte) {
+	switch err := sess.Deliver(message); {
+	case errors.Is(err, session.ErrSessionOverflow):
+		log.Error().
+			Str("session_id", sess.ID).
+			Str("uri", uri).
+			Msg("Closed session: message buffer stayed full")
+	case err != nil:
+		log.Warn().
+			Err(err).
+			Str("session_id", sess.ID).
+			Str("uri", uri).
+			Msg("Failed to relay resource update")
+	}
+}
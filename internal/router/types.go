@@ -96,6 +96,7 @@ type PolicyViolationData struct {
 	RequiredCapability string   `json:"required_capability,omitempty"`
 	AgentCapabilities  []string `json:"agent_capabilities,omitempty"`
 	Violations         []string `json:"violations"`
+	Categories         []string `json:"categories,omitempty"` // Distinct violation categories, e.g. "capability"
 	PolicyMode         string   `json:"policy_mode"`
 	Timestamp          string   `json:"timestamp"`
 }
@@ -107,15 +108,30 @@ type ToolCallParams struct {
 	Meta      *MetaParams            `json:"_meta,omitempty"`
 }
 
+// InitializeParams represents parameters for the initialize method.
+type InitializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities,omitempty"`
+	Meta            *MetaParams            `json:"_meta,omitempty"`
+}
+
 // ResourceReadParams represents parameters for resources/read method.
 type ResourceReadParams struct {
 	URI  string      `json:"uri"`
 	Meta *MetaParams `json:"_meta,omitempty"`
 }
 
+// PromptGetParams represents parameters for prompts/get method.
+type PromptGetParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+	Meta      *MetaParams       `json:"_meta,omitempty"`
+}
+
 // MetaParams contains metadata fields like AgentFacts token.
 type MetaParams struct {
 	AgentFacts string `json:"agentfacts,omitempty"`
+	DryRun     bool   `json:"dry_run,omitempty"`
 }
 
 // HandlerType defines how a method should be handled.
@@ -214,6 +230,13 @@ var MethodRegistry = map[string]MethodConfig{
 	},
 }
 
+// unknownMethodConfig applies to methods not in MethodRegistry.
+var unknownMethodConfig = MethodConfig{
+	Handler:     HandlerPassthrough,
+	LogLevel:    LogMetadata,
+	Description: "Unknown method",
+}
+
 // RequestContext holds parsed information about a request for policy evaluation.
 type RequestContext struct {
 	// Original request
@@ -224,16 +247,27 @@ type RequestContext struct {
 	Method      string
 	Tool        string // For tools/call
 	ResourceURI string // For resources/read
+	Prompt      string // For prompts/get
 	Arguments   map[string]interface{}
+	Initialize  *InitializeParams // For initialize
 
 	// Handler configuration
 	Config MethodConfig
 
 	// Timing
-	ReceivedAt time.Time
+	ReceivedAt      time.Time
+	PolicyLatency   time.Duration // Time spent evaluating policy
+	UpstreamLatency time.Duration // Time spent waiting on the upstream
 
 	// AgentFacts token if present
 	AgentFactsToken string
+
+	// DryRun treats a denial as audit mode for this request only
+	DryRun bool
+
+	// Echoed is set when no upstream was connected and the request was
+	// echoed back as the response
+	Echoed bool
 }
 
 // NewRequestContext creates a RequestContext from a parsed request.
@@ -253,21 +287,22 @@ func NewRequestContextAt(req *Request, receivedAt time.Time) *RequestContext {
 	ctx.RequestID = generateRequestID()
 	ctx.Method = req.Method
 	ctx.ReceivedAt = receivedAt
+	ctx.PolicyLatency = 0
+	ctx.UpstreamLatency = 0
 	ctx.Tool = ""
 	ctx.ResourceURI = ""
+	ctx.Prompt = ""
 	ctx.Arguments = nil
+	ctx.Initialize = nil
 	ctx.AgentFactsToken = ""
+	ctx.DryRun = false
+	ctx.Echoed = false
 
 	// Get method configuration
 	if cfg, ok := MethodRegistry[req.Method]; ok {
 		ctx.Config = cfg
 	} else {
-		// Unknown method - default to passthrough
-		ctx.Config = MethodConfig{
-			Handler:     HandlerPassthrough,
-			LogLevel:    LogMetadata,
-			Description: "Unknown method",
-		}
+		ctx.Config = unknownMethodConfig
 	}
 
 	return ctx
@@ -284,6 +319,7 @@ func (ctx *RequestContext) Release() {
 	// Clear references to help GC
 	ctx.Request = nil
 	ctx.Arguments = nil
+	ctx.Initialize = nil
 	requestContextPool.Put(ctx)
 }
 
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"time"
+)
+
+// Overflow policies applied when a session's message buffer stays full.
+const (
+	OverflowBlock = "block" // Wait for room, then drop the message
+	OverflowClose = "close" // Wait for room, then close the session as unhealthy
+)
+
+// DefaultMessageBufferSize is the message buffer size of a session.
+const DefaultMessageBufferSize = 100
+
+// backpressure controls what Deliver does when the message buffer is full.
+type backpressure struct {
+	policy  string
+	timeout time.Duration
+	onDrop  func(policy string)
+}
+
+// SetBackpressure sets how Deliver handles a full message buffer: it waits
+// up to timeout for room, then applies policy. A zero timeout applies the
+// policy at once. onDrop, if non-nil, is called
+// whenever a message is not delivered because the buffer stayed full.
+func (s *Session) SetBackpressure(policy string, timeout time.Duration, onDrop func(policy string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backpressure = backpressure{policy: policy, timeout: timeout, onDrop: onDrop}
+}
+
+// Deliver queues a message for the client, waiting for room if the buffer
+// is full. If it stays full, the message is dropped and, under
+// OverflowClose, the session is closed. Unlike SendMessage, a message that
+// cannot be delivered is always reported as an error.
+func (s *Session) Deliver(msg []byte) error {
+	if s.draining.Load() || s.IsClosed() {
+		return ErrSessionClosed
+	}
+
+	// Fast path: room in the buffer
+	select {
+	case s.MessageChan <- msg:
+		return nil
+	default:
+	}
+
+	s.mu.RLock()
+	bp := s.backpressure
+	s.mu.RUnlock()
+
+	if bp.timeout > 0 {
+		timer := time.NewTimer(bp.timeout)
+		defer timer.Stop()
+
+		select {
+		case s.MessageChan <- msg:
+			return nil
+		case <-s.Done:
+			return ErrSessionClosed
+		case <-timer.C:
+		}
+	}
+
+	if bp.onDrop != nil {
+		bp.onDrop(bp.policy)
+	}
+	if bp.policy == OverflowClose {
+		s.Close()
+		return ErrSessionOverflow
+	}
+	return ErrMessageDropped
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDeliverOverflow tests the overflow policies applied when a session's
+// message buffer stays full.
+func TestDeliverOverflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		wantErr    error
+		wantClosed bool
+	}{
+		{name: "block drops the message", policy: OverflowBlock, wantErr: ErrMessageDropped},
+		{name: "close closes the session", policy: OverflowClose, wantErr: ErrSessionOverflow, wantClosed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dropped []string
+			mgr := NewManager(ManagerConfig{
+				MessageBufferSize: 2,
+				OverflowPolicy:    tt.policy,
+				OverflowTimeout:   20 * time.Millisecond,
+			})
+			mgr.SetOnMessageDropped(func(policy string) { dropped = append(dropped, policy) })
+
+			sess, err := mgr.Create(context.Background())
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if got := cap(sess.MessageChan); got != 2 {
+				t.Fatalf("cap(MessageChan) = %d, want 2", got)
+			}
+
+			// Fill the buffer
+			for i := 0; i < 2; i++ {
+				if err := sess.Deliver([]byte("msg")); err != nil {
+					t.Fatalf("Deliver() #%d error = %v", i, err)
+				}
+			}
+
+			start := time.Now()
+			err = sess.Deliver([]byte("overflow"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Deliver() error = %v, want %v", err, tt.wantErr)
+			}
+			if waited := time.Since(start); waited < 20*time.Millisecond {
+				t.Errorf("Deliver() returned after %s, want it to wait for the overflow timeout", waited)
+			}
+			if sess.IsClosed() != tt.wantClosed {
+				t.Errorf("IsClosed() = %v, want %v", sess.IsClosed(), tt.wantClosed)
+			}
+			if len(dropped) != 1 || dropped[0] != tt.policy {
+				t.Errorf("dropped = %v, want [%s]", dropped, tt.policy)
+			}
+		})
+	}
+}
+
+// TestDeliverWaitsForRoom tests that a message is delivered once the client
+// drains the buffer within the overflow timeout.
+func TestDeliverWaitsForRoom(t *testing.T) {
+	mgr := NewManager(ManagerConfig{
+		MessageBufferSize: 1,
+		OverflowTimeout:   time.Second,
+	})
+	sess, err := mgr.Create(context.Background())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := sess.Deliver([]byte("first")); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-sess.MessageChan
+	}()
+
+	if err := sess.Deliver([]byte("second")); err != nil {
+		t.Errorf("Deliver() error = %v, want delivery once room is made", err)
+	}
+	if got := string(<-sess.MessageChan); got != "second" {
+		t.Errorf("received %q, want second", got)
+	}
+}
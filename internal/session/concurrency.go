@@ -0,0 +1,26 @@
+package session
+
+// AcquireRequestSlot claims one of limit slots for an in-flight request,
+// returning false if all are taken. Each successful call must be paired
+// with ReleaseRequestSlot once the request completes.
+func (s *Session) AcquireRequestSlot(limit int) bool {
+	for {
+		n := s.inFlight.Load()
+		if n >= int64(limit) {
+			return false
+		}
+		if s.inFlight.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// ReleaseRequestSlot frees a slot claimed with AcquireRequestSlot.
+func (s *Session) ReleaseRequestSlot() {
+	s.inFlight.Add(-1)
+}
+
+// InFlight returns the number of requests holding a slot.
+func (s *Session) InFlight() int {
+	return int(s.inFlight.Load())
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestRequestSlots tests that no more than limit slots can be held at once
+// and that released slots can be claimed again.
+func TestRequestSlots(t *testing.T) {
+	s := NewSession("sess1")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	acquired := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.AcquireRequestSlot(5) {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 5 || s.InFlight() != 5 {
+		t.Fatalf("acquired %d slots, in flight %d, want 5", acquired, s.InFlight())
+	}
+
+	s.ReleaseRequestSlot()
+	if !s.AcquireRequestSlot(5) {
+		t.Error("AcquireRequestSlot() after release = false, want true")
+	}
+	if s.AcquireRequestSlot(5) {
+		t.Error("AcquireRequestSlot() at the limit = true, want false")
+	}
+}
@@ -0,0 +1,16 @@
+package session
+
+import "context"
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the session a request belongs to.
+func NewContext(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, sess)
+}
+
+// FromContext returns the session stored by NewContext, or nil.
+func FromContext(ctx context.Context) *Session {
+	sess, _ := ctx.Value(contextKey{}).(*Session)
+	return sess
+}
@@ -14,9 +14,27 @@ type Manager struct {
 	sessions sync.Map // map[string]*Session
 
 	// Configuration
-	sessionTTL    time.Duration
-	cleanupTicker *time.Ticker
-	maxSessions   int
+	sessionTTL       time.Duration
+	idleTimeout      time.Duration
+	maxLifetime      time.Duration
+	cleanupInterval  time.Duration
+	cleanupTicker    *time.Ticker
+	maxSessions      int
+	evictionPolicy   string
+	replayBufferSize int
+	messageBuffer    int
+	overflowPolicy   string
+	overflowTimeout  time.Duration
+	onMessageDropped func(policy string)
+
+	// onSessionCreated is called with each session Create returns
+	onSessionCreated func(sess *Session)
+
+	// onSessionClosed is called with each session the manager removes
+	onSessionClosed func(sess *Session)
+
+	// onCleanup is called after each cleanup pass with the oldest age
+	onCleanup func(oldest time.Duration)
 
 	// Metrics
 	mu           sync.RWMutex
@@ -29,17 +47,40 @@ type Manager struct {
 
 // ManagerConfig holds session manager configuration.
 type ManagerConfig struct {
-	SessionTTL      time.Duration
-	CleanupInterval time.Duration
-	MaxSessions     int
+	SessionTTL       time.Duration
+	CleanupInterval  time.Duration
+	MaxSessions      int
+	EvictionPolicy   string // EvictionReject (default) or EvictionLRU
+	ReplayBufferSize int    // Streamed events kept per session for resumption (negative disables)
+
+	// Message buffering toward each client
+	MessageBufferSize int           // Capacity of each session's message channel
+	OverflowPolicy    string        // OverflowBlock (default) or OverflowClose
+	OverflowTimeout   time.Duration // How long Deliver waits for room in a full buffer; 0 does not wait
+
+	// MaxLifetime closes sessions this long after they were created, however
+	// active they are, so clients reconnect and re-authenticate. Zero
+	// disables it.
+	MaxLifetime time.Duration
+
+	// IdleTimeout closes sessions with no activity for this long. Zero
+	// defaults to half the SessionTTL.
+	IdleTimeout time.Duration
 }
 
+// Eviction policies applied when MaxSessions is reached.
+const (
+	EvictionReject = "reject" // Refuse new sessions
+	EvictionLRU    = "lru"    // Close the least recently active session
+)
+
 // DefaultManagerConfig returns sensible defaults.
 func DefaultManagerConfig() ManagerConfig {
 	return ManagerConfig{
-		SessionTTL:      2 * time.Hour,
-		CleanupInterval: 1 * time.Minute,
-		MaxSessions:     10000,
+		SessionTTL:       2 * time.Hour,
+		CleanupInterval:  1 * time.Minute,
+		MaxSessions:      10000,
+		ReplayBufferSize: 100,
 	}
 }
 
@@ -48,23 +89,46 @@ func NewManager(cfg ManagerConfig) *Manager {
 	if cfg.SessionTTL == 0 {
 		cfg.SessionTTL = 2 * time.Hour
 	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = cfg.SessionTTL / 2
+	}
 	if cfg.CleanupInterval == 0 {
 		cfg.CleanupInterval = 1 * time.Minute
 	}
 	if cfg.MaxSessions == 0 {
 		cfg.MaxSessions = 10000
 	}
+	if cfg.ReplayBufferSize == 0 {
+		cfg.ReplayBufferSize = 100
+	}
+	if cfg.EvictionPolicy == "" {
+		cfg.EvictionPolicy = EvictionReject
+	}
+	if cfg.MessageBufferSize <= 0 {
+		cfg.MessageBufferSize = DefaultMessageBufferSize
+	}
+	if cfg.OverflowPolicy == "" {
+		cfg.OverflowPolicy = OverflowBlock
+	}
 
 	return &Manager{
-		sessionTTL:  cfg.SessionTTL,
-		maxSessions: cfg.MaxSessions,
-		done:        make(chan struct{}),
+		sessionTTL:       cfg.SessionTTL,
+		idleTimeout:      cfg.IdleTimeout,
+		maxLifetime:      cfg.MaxLifetime,
+		cleanupInterval:  cfg.CleanupInterval,
+		maxSessions:      cfg.MaxSessions,
+		evictionPolicy:   cfg.EvictionPolicy,
+		replayBufferSize: cfg.ReplayBufferSize,
+		messageBuffer:    cfg.MessageBufferSize,
+		overflowPolicy:   cfg.OverflowPolicy,
+		overflowTimeout:  cfg.OverflowTimeout,
+		done:             make(chan struct{}),
 	}
 }
 
 // Start begins the background cleanup goroutine.
 func (m *Manager) Start(ctx context.Context) {
-	m.cleanupTicker = time.NewTicker(1 * time.Minute)
+	m.cleanupTicker = time.NewTicker(m.cleanupInterval)
 
 	go func() {
 		for {
@@ -83,7 +147,10 @@ func (m *Manager) Start(ctx context.Context) {
 
 	log.Info().
 		Dur("session_ttl", m.sessionTTL).
+		Dur("idle_timeout", m.idleTimeout).
+		Dur("cleanup_interval", m.cleanupInterval).
 		Int("max_sessions", m.maxSessions).
+		Str("eviction_policy", m.evictionPolicy).
 		Msg("Session manager started")
 }
 
@@ -93,10 +160,17 @@ func (m *Manager) Stop() {
 
 	// Close all active sessions
 	m.sessions.Range(func(key, value any) bool {
-		if sess, ok := value.(*Session); ok {
-			sess.Close()
+		sess, ok := value.(*Session)
+		if !ok {
+			m.sessions.Delete(key)
+			return true
+		}
+		sess.Close()
+		if m.sessions.CompareAndDelete(key, sess) {
+			m.mu.Lock()
+			m.activeCount--
+			m.mu.Unlock()
 		}
-		m.sessions.Delete(key)
 		return true
 	})
 
@@ -108,11 +182,13 @@ func (m *Manager) Create(ctx context.Context) (*Session, error) {
 	// Use a single lock to prevent race condition between check and increment
 	m.mu.Lock()
 
-	// Check max sessions limit
+	// Check max sessions limit, evicting to make room if configured
 	if m.activeCount >= m.maxSessions {
-		m.mu.Unlock()
-		log.Warn().Int("max", m.maxSessions).Msg("Max sessions limit reached")
-		return nil, ErrMaxSessionsReached
+		if m.evictionPolicy != EvictionLRU || !m.evictLRU() {
+			m.mu.Unlock()
+			log.Warn().Int("max", m.maxSessions).Msg("Max sessions limit reached")
+			return nil, ErrMaxSessionsReached
+		}
 	}
 
 	// Generate unique session ID using full UUID for maximum entropy (122 bits)
@@ -120,7 +196,7 @@ func (m *Manager) Create(ctx context.Context) (*Session, error) {
 	sessionID := "sess_" + uuid.New().String()
 
 	// Create session
-	sess := NewSession(sessionID)
+	sess := m.newSession(sessionID)
 
 	// Store session and update metrics atomically
 	m.sessions.Store(sessionID, sess)
@@ -132,9 +208,109 @@ func (m *Manager) Create(ctx context.Context) (*Session, error) {
 		Str("session_id", sessionID).
 		Msg("Session created")
 
+	if m.onSessionCreated != nil {
+		m.onSessionCreated(sess)
+	}
 	return sess, nil
 }
 
+// SetOnMessageDropped sets a callback invoked whenever a message to a client
+// is dropped because its buffer stayed full. Must be called before sessions
+// are created.
+func (m *Manager) SetOnMessageDropped(fn func(policy string)) {
+	m.onMessageDropped = fn
+}
+
+// SetOnSessionCreated sets a callback invoked with each session Create
+// returns. Sessions restored from a snapshot are not reported. Must be
+// called before sessions are created.
+func (m *Manager) SetOnSessionCreated(fn func(sess *Session)) {
+	m.onSessionCreated = fn
+}
+
+// SetOnSessionClosed sets a callback invoked with each session removed by
+// Delete, eviction or cleanup, after it is closed. Sessions still open when
+// the manager stops are not reported. Must be called before Start.
+func (m *Manager) SetOnSessionClosed(fn func(sess *Session)) {
+	m.onSessionClosed = fn
+}
+
+// SetOnCleanup sets a callback invoked after each cleanup pass with the age
+// of the oldest remaining session, or zero if there are none. Must be
+// called before Start.
+func (m *Manager) SetOnCleanup(fn func(oldest time.Duration)) {
+	m.onCleanup = fn
+}
+
+// remove deletes sess from the manager if it is still stored, decrementing
+// the active count and reporting it closed, and reports whether it did.
+// Removals race between Get, Delete and cleanup; only the one that takes
+// the session out of the map counts it.
+func (m *Manager) remove(sess *Session) bool {
+	if !m.sessions.CompareAndDelete(sess.ID, sess) {
+		return false
+	}
+
+	m.mu.Lock()
+	m.activeCount--
+	m.mu.Unlock()
+
+	m.sessionClosed(sess)
+	return true
+}
+
+// sessionClosed reports a removed session to the onSessionClosed callback.
+func (m *Manager) sessionClosed(sess *Session) {
+	if m.onSessionClosed != nil {
+		m.onSessionClosed(sess)
+	}
+}
+
+// newSession creates a session with the manager's buffering settings.
+func (m *Manager) newSession(id string) *Session {
+	sess := NewSession(id)
+	sess.MessageChan = make(chan []byte, m.messageBuffer)
+	if m.replayBufferSize > 0 {
+		sess.SetReplayBufferSize(m.replayBufferSize)
+	}
+	sess.SetBackpressure(m.overflowPolicy, m.overflowTimeout, m.onMessageDropped)
+	return sess
+}
+
+// evictLRU closes and removes the least recently active session, reporting
+// whether one was evicted. Must be called with m.mu held.
+func (m *Manager) evictLRU() bool {
+	var victim *Session
+	var victimIdle time.Duration
+	m.sessions.Range(func(key, value any) bool {
+		sess, ok := value.(*Session)
+		if !ok {
+			return true
+		}
+		if idle := sess.IdleTime(); victim == nil || idle > victimIdle {
+			victim, victimIdle = sess, idle
+		}
+		return true
+	})
+	if victim == nil {
+		return false
+	}
+
+	if _, loaded := m.sessions.LoadAndDelete(victim.ID); !loaded {
+		return false
+	}
+	victim.Close()
+	m.activeCount--
+	m.sessionClosed(victim)
+
+	log.Info().
+		Str("session_id", victim.ID).
+		Dur("idle_time", victimIdle).
+		Msg("Evicted least recently active session")
+
+	return true
+}
+
 // Get retrieves a session by ID.
 func (m *Manager) Get(sessionID string) (*Session, bool) {
 	value, ok := m.sessions.Load(sessionID)
@@ -156,18 +332,19 @@ func (m *Manager) Get(sessionID string) (*Session, bool) {
 	return sess, true
 }
 
-// Delete removes a session.
+// Delete closes and removes a session.
 func (m *Manager) Delete(sessionID string) {
-	value, loaded := m.sessions.LoadAndDelete(sessionID)
-	if loaded {
-		if sess, ok := value.(*Session); ok {
-			sess.Close()
-		}
-
-		m.mu.Lock()
-		m.activeCount--
-		m.mu.Unlock()
+	value, ok := m.sessions.Load(sessionID)
+	if !ok {
+		return
+	}
+	sess, ok := value.(*Session)
+	if !ok {
+		return
+	}
 
+	sess.Close()
+	if m.remove(sess) {
 		log.Debug().
 			Str("session_id", sessionID).
 			Msg("Session deleted")
@@ -190,6 +367,12 @@ func (m *Manager) ActiveCount() int {
 	return m.activeCount
 }
 
+// MaxLifetime returns how long sessions may live however active they are,
+// or zero if there is no limit.
+func (m *Manager) MaxLifetime() time.Duration {
+	return m.maxLifetime
+}
+
 // TotalCreated returns the total number of sessions created.
 func (m *Manager) TotalCreated() int64 {
 	m.mu.RLock()
@@ -199,7 +382,8 @@ func (m *Manager) TotalCreated() int64 {
 
 // cleanup removes expired and idle sessions.
 func (m *Manager) cleanup() {
-	var expired, idle int
+	var expired, idle, overLifetime int
+	var oldest time.Duration
 
 	m.sessions.Range(func(key, value any) bool {
 		sessionID, _ := key.(string)
@@ -211,20 +395,30 @@ func (m *Manager) cleanup() {
 
 		// Remove closed sessions
 		if sess.IsClosed() {
-			m.sessions.Delete(key)
-			m.mu.Lock()
-			m.activeCount--
-			m.mu.Unlock()
+			m.remove(sess)
+			return true
+		}
+
+		// Remove sessions past their maximum lifetime, even if active
+		if m.maxLifetime > 0 && sess.Age() > m.maxLifetime {
+			sess.Close()
+			if !m.remove(sess) {
+				return true
+			}
+			overLifetime++
+			log.Debug().
+				Str("session_id", sessionID).
+				Dur("age", sess.Age()).
+				Msg("Session reached maximum lifetime")
 			return true
 		}
 
 		// Remove sessions that exceed TTL
 		if sess.Age() > m.sessionTTL {
 			sess.Close()
-			m.sessions.Delete(key)
-			m.mu.Lock()
-			m.activeCount--
-			m.mu.Unlock()
+			if !m.remove(sess) {
+				return true
+			}
 			expired++
 			log.Debug().
 				Str("session_id", sessionID).
@@ -233,13 +427,12 @@ func (m *Manager) cleanup() {
 			return true
 		}
 
-		// Remove sessions idle for more than half the TTL
-		if sess.IdleTime() > m.sessionTTL/2 {
+		// Remove sessions idle for longer than the idle timeout
+		if sess.IdleTime() > m.idleTimeout {
 			sess.Close()
-			m.sessions.Delete(key)
-			m.mu.Lock()
-			m.activeCount--
-			m.mu.Unlock()
+			if !m.remove(sess) {
+				return true
+			}
 			idle++
 			log.Debug().
 				Str("session_id", sessionID).
@@ -248,13 +441,21 @@ func (m *Manager) cleanup() {
 			return true
 		}
 
+		if age := sess.Age(); age > oldest {
+			oldest = age
+		}
 		return true
 	})
 
-	if expired > 0 || idle > 0 {
+	if m.onCleanup != nil {
+		m.onCleanup(oldest)
+	}
+
+	if expired > 0 || idle > 0 || overLifetime > 0 {
 		log.Info().
 			Int("expired", expired).
 			Int("idle", idle).
+			Int("max_lifetime", overLifetime).
 			Int("active", m.ActiveCount()).
 			Msg("Session cleanup completed")
 	}
@@ -278,6 +479,9 @@ func (m *Manager) List() []*Session {
 var (
 	ErrMaxSessionsReached = &SessionError{Message: "maximum sessions limit reached"}
 	ErrSessionNotFound    = &SessionError{Message: "session not found"}
+	ErrSessionClosed      = &SessionError{Message: "session closed"}
+	ErrMessageDropped     = &SessionError{Message: "message buffer full, message dropped"}
+	ErrSessionOverflow    = &SessionError{Message: "message buffer full, session closed"}
 )
 
 // SessionError represents a session-related error.
@@ -2,6 +2,9 @@ package session
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -244,6 +247,63 @@ func TestSessionTTLExpiration(t *testing.T) {
 	}
 }
 
+// TestSessionMaxLifetime tests that cleanup closes sessions past their
+// maximum lifetime even if they were just active.
+func TestSessionMaxLifetime(t *testing.T) {
+	mgr := NewManager(ManagerConfig{
+		SessionTTL:  time.Hour,
+		MaxSessions: 10,
+		MaxLifetime: 50 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	sess, err := mgr.Create(ctx)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	sess.IncrementRequestCount()
+	mgr.cleanup()
+
+	if _, ok := mgr.Get(sess.ID); ok {
+		t.Error("Session still exists after its maximum lifetime")
+	}
+	if !sess.IsClosed() {
+		t.Error("Session should be closed after its maximum lifetime")
+	}
+	if mgr.ActiveCount() != 0 {
+		t.Errorf("ActiveCount() = %d, want 0", mgr.ActiveCount())
+	}
+}
+
+// TestCleanupInterval tests that the background cleanup runs at the
+// configured interval.
+func TestCleanupInterval(t *testing.T) {
+	mgr := NewManager(ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: 10 * time.Millisecond,
+		MaxSessions:     10,
+		MaxLifetime:     50 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+
+	sess, err := mgr.Create(ctx)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !sess.IsClosed() {
+		if time.Now().After(deadline) {
+			t.Fatal("Session not closed by background cleanup within 1s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // TestSessionIdleTimeout tests cleanup of idle sessions.
 func TestSessionIdleTimeout(t *testing.T) {
 	// Short TTL for testing, idle timeout is TTL/2
@@ -271,6 +331,32 @@ func TestSessionIdleTimeout(t *testing.T) {
 	}
 }
 
+// TestSessionIdleTimeoutIndependentOfTTL tests that an explicit idle
+// timeout evicts idle sessions long before the TTL, without touching active
+// ones.
+func TestSessionIdleTimeoutIndependentOfTTL(t *testing.T) {
+	mgr := NewManager(ManagerConfig{
+		SessionTTL:  2 * time.Hour,
+		IdleTimeout: 50 * time.Millisecond,
+		MaxSessions: 10,
+	})
+	ctx := context.Background()
+
+	idleSess, _ := mgr.Create(ctx)
+	activeSess, _ := mgr.Create(ctx)
+
+	time.Sleep(60 * time.Millisecond)
+	activeSess.IncrementRequestCount()
+	mgr.cleanup()
+
+	if _, ok := mgr.Get(idleSess.ID); ok {
+		t.Error("Idle session still exists after the idle timeout")
+	}
+	if _, ok := mgr.Get(activeSess.ID); !ok {
+		t.Error("Active session was removed before its TTL")
+	}
+}
+
 // TestMaxSessionsLimit tests enforcement of max sessions limit.
 func TestMaxSessionsLimit(t *testing.T) {
 	mgr := NewManager(ManagerConfig{
@@ -303,6 +389,71 @@ func TestMaxSessionsLimit(t *testing.T) {
 	}
 }
 
+// TestMaxSessionsLRUEviction tests that LRU eviction closes the least
+// recently active session instead of rejecting the new one.
+func TestMaxSessionsLRUEviction(t *testing.T) {
+	tests := []struct {
+		name        string
+		touch       int // index of a session to mark active, -1 for none
+		wantEvicted int
+	}{
+		{"oldest evicted", -1, 0},
+		{"recently active kept", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := NewManager(ManagerConfig{
+				SessionTTL:      1 * time.Hour,
+				CleanupInterval: 1 * time.Minute,
+				MaxSessions:     3,
+				EvictionPolicy:  EvictionLRU,
+			})
+			ctx := context.Background()
+
+			var sessions []*Session
+			for i := 0; i < 3; i++ {
+				sess, err := mgr.Create(ctx)
+				if err != nil {
+					t.Fatalf("Create() error on session %d: %v", i, err)
+				}
+				sessions = append(sessions, sess)
+				time.Sleep(2 * time.Millisecond)
+			}
+			if tt.touch >= 0 {
+				sessions[tt.touch].IncrementRequestCount()
+			}
+
+			newest, err := mgr.Create(ctx)
+			if err != nil {
+				t.Fatalf("Create() error = %v, want eviction", err)
+			}
+
+			evicted := sessions[tt.wantEvicted]
+			if !evicted.IsClosed() {
+				t.Error("Evicted session was not closed")
+			}
+			if _, ok := mgr.Get(evicted.ID); ok {
+				t.Error("Evicted session still retrievable")
+			}
+			for i, sess := range sessions {
+				if i == tt.wantEvicted {
+					continue
+				}
+				if _, ok := mgr.Get(sess.ID); !ok {
+					t.Errorf("Session %d was evicted, want session %d", i, tt.wantEvicted)
+				}
+			}
+			if _, ok := mgr.Get(newest.ID); !ok {
+				t.Error("New session not retrievable")
+			}
+			if mgr.ActiveCount() != 3 {
+				t.Errorf("ActiveCount = %d, want 3", mgr.ActiveCount())
+			}
+		})
+	}
+}
+
 // TestConcurrentAccess tests thread safety of session operations.
 func TestConcurrentAccess(t *testing.T) {
 	mgr := NewManager(ManagerConfig{
@@ -418,10 +569,9 @@ func TestManagerStartStop(t *testing.T) {
 		}
 	}
 
-	// Note: ActiveCount may not be 0 immediately after Stop() since the cleanup
-	// happens in the Range loop which deletes but the activeCount decrement
-	// is not guaranteed to be visible immediately. The important thing is that
-	// sessions are closed and deleted.
+	if mgr.ActiveCount() != 0 {
+		t.Errorf("ActiveCount = %d after Stop(), want 0", mgr.ActiveCount())
+	}
 }
 
 // TestSessionListReturnsOnlyActive tests that List only returns non-closed sessions.
@@ -488,8 +638,53 @@ func TestGetClosedSession(t *testing.T) {
 	}
 
 	// Session should be removed from manager
-	// Note: The current implementation deletes closed sessions in Get()
-	// but doesn't update activeCount. This might be a bug in the original code.
+	if mgr.ActiveCount() != 0 {
+		t.Errorf("ActiveCount = %d, want 0", mgr.ActiveCount())
+	}
+}
+
+// TestActiveCountWithConcurrentRemoval tests that a session closed and then
+// removed concurrently by Get, Delete and cleanup is only counted out once.
+func TestActiveCountWithConcurrentRemoval(t *testing.T) {
+	mgr := NewManager(ManagerConfig{
+		SessionTTL:  time.Hour,
+		MaxSessions: 1000,
+	})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		sess, err := mgr.Create(ctx)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if i%2 == 0 {
+			continue
+		}
+
+		sess.Close()
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			mgr.Get(sess.ID)
+		}()
+		go func() {
+			defer wg.Done()
+			mgr.Delete(sess.ID)
+		}()
+		go func() {
+			defer wg.Done()
+			mgr.cleanup()
+		}()
+	}
+	wg.Wait()
+
+	if got, want := mgr.ActiveCount(), len(mgr.List()); got != want {
+		t.Errorf("ActiveCount() = %d, want len(List()) = %d", got, want)
+	}
+	if mgr.ActiveCount() != 250 {
+		t.Errorf("ActiveCount() = %d, want 250", mgr.ActiveCount())
+	}
 }
 
 // TestCleanupRemovesClosedSessions tests that cleanup removes manually closed sessions.
@@ -524,6 +719,43 @@ func TestCleanupRemovesClosedSessions(t *testing.T) {
 	}
 }
 
+// TestOnSessionClosed tests that sessions removed by Delete and by cleanup
+// are reported, and that cleanup reports the oldest remaining session.
+func TestOnSessionClosed(t *testing.T) {
+	mgr := NewManager(ManagerConfig{
+		SessionTTL:  50 * time.Millisecond,
+		MaxSessions: 10,
+	})
+	ctx := context.Background()
+
+	var closed []string
+	mgr.SetOnSessionClosed(func(sess *Session) {
+		if !sess.IsClosed() {
+			t.Errorf("session %s reported before it was closed", sess.ID)
+		}
+		closed = append(closed, sess.ID)
+	})
+	oldest := time.Duration(-1)
+	mgr.SetOnCleanup(func(d time.Duration) { oldest = d })
+
+	deleted, _ := mgr.Create(ctx)
+	expired, _ := mgr.Create(ctx)
+
+	mgr.Delete(deleted.ID)
+	mgr.Delete(deleted.ID)
+
+	time.Sleep(60 * time.Millisecond)
+	fresh, _ := mgr.Create(ctx)
+	mgr.cleanup()
+
+	if len(closed) != 2 || closed[0] != deleted.ID || closed[1] != expired.ID {
+		t.Errorf("closed sessions = %v, want [%s %s]", closed, deleted.ID, expired.ID)
+	}
+	if oldest < 0 || oldest > fresh.Age() {
+		t.Errorf("oldest age = %s, want the fresh session's age (at most %s)", oldest, fresh.Age())
+	}
+}
+
 // TestSessionAgeAndIdleTime tests session age and idle time calculations.
 func TestSessionAgeAndIdleTime(t *testing.T) {
 	sess := NewSession("test_sess")
@@ -566,3 +798,86 @@ func TestSessionAgeAndIdleTime(t *testing.T) {
 		t.Errorf("Age() = %v, expected at least 40ms", age)
 	}
 }
+
+// TestSnapshotRoundTrip tests that session metadata saved on shutdown is
+// restored by a new manager.
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	m1 := NewManager(ManagerConfig{MaxSessions: 10})
+	sess, err := m1.Create(context.Background())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	sess.SetAgent("agent1", "Test Agent", []string{"read:files"})
+	sess.SetIdentity(true, "did:key:z6Mk")
+	sess.SetAuthToken("secret-token")
+	sess.SetInitialize("2025-06-18", map[string]interface{}{"roots": map[string]interface{}{}})
+	sess.IncrementRequestCount()
+	sess.IncrementRequestCount()
+	sess.IncrementReads()
+	sess.IncrementWrites()
+
+	if err := m1.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+	m1.Stop()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Error("Snapshot should not contain the raw auth token")
+	}
+
+	m2 := NewManager(ManagerConfig{MaxSessions: 10})
+	defer m2.Stop()
+
+	n, err := m2.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	if n != 1 || m2.ActiveCount() != 1 {
+		t.Fatalf("LoadSnapshot() restored %d (count %d), want 1", n, m2.ActiveCount())
+	}
+
+	restored, ok := m2.Get(sess.ID)
+	if !ok {
+		t.Fatalf("Session %s not restored", sess.ID)
+	}
+	if restored.AgentID != "agent1" || restored.AgentName != "Test Agent" {
+		t.Errorf("Agent = %s/%s, want agent1/Test Agent", restored.AgentID, restored.AgentName)
+	}
+	if len(restored.Capabilities) != 1 || restored.Capabilities[0] != "read:files" {
+		t.Errorf("Capabilities = %v, want [read:files]", restored.Capabilities)
+	}
+	if got := restored.GetRequestCount(); got != 2 {
+		t.Errorf("RequestCount = %d, want 2", got)
+	}
+	if reads, writes := restored.GetCumulativeCounts(); reads != 1 || writes != 1 {
+		t.Errorf("CumulativeCounts = %d/%d, want 1/1", reads, writes)
+	}
+	if verified, did := restored.GetIdentity(); !verified || did != "did:key:z6Mk" {
+		t.Errorf("Identity = %v/%s, want true/did:key:z6Mk", verified, did)
+	}
+	if version, caps := restored.GetInitialize(); version != "2025-06-18" || caps["roots"] == nil {
+		t.Errorf("Initialize = %s/%v, want 2025-06-18 with roots", version, caps)
+	}
+	if !restored.CreatedAt.Equal(sess.CreatedAt) {
+		t.Errorf("CreatedAt = %v, want %v", restored.CreatedAt, sess.CreatedAt)
+	}
+
+	if restored.MatchesAuthToken("wrong-token") {
+		t.Error("MatchesAuthToken() should reject a different token")
+	}
+	if !restored.MatchesAuthToken("secret-token") {
+		t.Error("MatchesAuthToken() should accept the original token")
+	}
+
+	// A missing snapshot restores nothing
+	n, err = NewManager(ManagerConfig{}).LoadSnapshot(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || n != 0 {
+		t.Errorf("LoadSnapshot(missing) = %d, %v, want 0, nil", n, err)
+	}
+}
@@ -0,0 +1,53 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket is a token-bucket rate limiter allowing limit requests per
+// window, refilled continuously. The zero value starts full.
+type TokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// Take consumes a token if one is available at now. When none is, it returns
+// false and how long until the next token arrives.
+func (b *TokenBucket) Take(limit int, window time.Duration, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rate := float64(limit) / window.Seconds() // tokens per second
+	if b.last.IsZero() {
+		b.tokens = float64(limit)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > float64(limit) {
+			b.tokens = float64(limit)
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// Idle reports whether the bucket has been unused for at least d as of now,
+// by which time it would be full again.
+func (b *TokenBucket) Idle(d time.Duration, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.Sub(b.last) >= d
+}
+
+// TakeRateToken consumes a token from the session's rate limit bucket.
+func (s *Session) TakeRateToken(limit int, window time.Duration, now time.Time) (bool, time.Duration) {
+	return s.rateBucket.Take(limit, window, now)
+}
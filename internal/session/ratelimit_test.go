@@ -0,0 +1,39 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTokenBucket tests that the bucket allows a burst of limit requests and
+// refills over the window.
+func TestTokenBucket(t *testing.T) {
+	var b TokenBucket
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Take(3, 3*time.Second, now); !ok {
+			t.Fatalf("Take() %d = false, want true", i+1)
+		}
+	}
+
+	ok, wait := b.Take(3, 3*time.Second, now)
+	if ok {
+		t.Fatal("Take() over the limit = true, want false")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Retry after = %v, want (0, 1s]", wait)
+	}
+
+	// One token refills per second
+	if ok, _ := b.Take(3, 3*time.Second, now.Add(time.Second)); !ok {
+		t.Error("Take() after refill = false, want true")
+	}
+	if ok, _ := b.Take(3, 3*time.Second, now.Add(time.Second)); ok {
+		t.Error("Take() with the refilled token spent = true, want false")
+	}
+
+	if !b.Idle(3*time.Second, now.Add(5*time.Second)) {
+		t.Error("Idle() = false, want true after a full window")
+	}
+}
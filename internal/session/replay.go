@@ -0,0 +1,95 @@
+package session
+
+// Event is a message streamed to the client with a sequence ID.
+type Event struct {
+	ID   uint64
+	Data []byte
+}
+
+// Stream tracks a single client event stream attached to a session.
+type Stream struct {
+	detached chan struct{}
+	stopped  chan struct{}
+}
+
+// Detached is closed when a newer stream takes over the session.
+func (st *Stream) Detached() <-chan struct{} {
+	return st.detached
+}
+
+// Close marks the stream as exited. It must be called exactly once.
+func (st *Stream) Close() {
+	close(st.stopped)
+}
+
+// SetReplayBufferSize sets how many streamed events are kept for replay.
+// Zero disables buffering.
+func (s *Session) SetReplayBufferSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxEvents = n
+	if len(s.events) > n {
+		s.events = append([]Event(nil), s.events[len(s.events)-n:]...)
+	}
+}
+
+// RecordEvent assigns the next event ID to data and buffers it for replay,
+// evicting the oldest entry when the buffer is full.
+func (s *Session) RecordEvent(data []byte) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastEventID++
+	if s.maxEvents > 0 {
+		if len(s.events) >= s.maxEvents {
+			s.events = s.events[1:]
+		}
+		s.events = append(s.events, Event{ID: s.lastEventID, Data: data})
+	}
+	return s.lastEventID
+}
+
+// EventsSince returns buffered events with IDs greater than id.
+// complete is false if events after id have already been evicted.
+func (s *Session) EventsSince(id uint64) (events []Event, complete bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	complete = id >= s.lastEventID || (len(s.events) > 0 && s.events[0].ID <= id+1)
+	for _, ev := range s.events {
+		if ev.ID > id {
+			events = append(events, ev)
+		}
+	}
+	return events, complete
+}
+
+// AttachStream registers a new client stream for the session and detaches
+// the previous one. The returned channel is closed once the previous stream
+// has exited, after which all messages it consumed have been recorded.
+func (s *Session) AttachStream() (*Stream, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prevStopped chan struct{}
+	if s.stream != nil {
+		close(s.stream.detached)
+		prevStopped = s.stream.stopped
+	} else {
+		prevStopped = make(chan struct{})
+		close(prevStopped)
+	}
+
+	s.stream = &Stream{
+		detached: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	return s.stream, prevStopped
+}
+
+// IsCurrentStream returns true if st is the most recently attached stream.
+func (s *Session) IsCurrentStream(st *Stream) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stream == st
+}
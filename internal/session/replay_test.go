@@ -0,0 +1,81 @@
+package session
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestReplayBuffer tests event recording, eviction, and replay.
+func TestReplayBuffer(t *testing.T) {
+	sess := NewSession("test_sess")
+	sess.SetReplayBufferSize(3)
+
+	for i := 1; i <= 5; i++ {
+		if id := sess.RecordEvent([]byte(fmt.Sprintf("msg%d", i))); id != uint64(i) {
+			t.Fatalf("RecordEvent() = %d, expected %d", id, i)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		since    uint64
+		expected []string
+		complete bool
+	}{
+		{"up to date", 5, nil, true},
+		{"within buffer", 3, []string{"msg4", "msg5"}, true},
+		{"oldest buffered", 2, []string{"msg3", "msg4", "msg5"}, true},
+		{"evicted", 1, []string{"msg3", "msg4", "msg5"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, complete := sess.EventsSince(tt.since)
+			if complete != tt.complete {
+				t.Errorf("complete = %v, expected %v", complete, tt.complete)
+			}
+			if len(events) != len(tt.expected) {
+				t.Fatalf("got %d events, expected %d", len(events), len(tt.expected))
+			}
+			for i, ev := range events {
+				if string(ev.Data) != tt.expected[i] {
+					t.Errorf("event %d = %s, expected %s", i, ev.Data, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+// TestAttachStream tests that attaching a stream detaches the previous one.
+func TestAttachStream(t *testing.T) {
+	sess := NewSession("test_sess")
+
+	first, prevStopped := sess.AttachStream()
+	select {
+	case <-prevStopped:
+	default:
+		t.Fatal("expected no previous stream to wait for")
+	}
+
+	second, prevStopped := sess.AttachStream()
+	select {
+	case <-first.Detached():
+	default:
+		t.Error("expected first stream to be detached")
+	}
+	select {
+	case <-prevStopped:
+		t.Error("previous stream reported stopped before Close")
+	default:
+	}
+
+	first.Close()
+	<-prevStopped
+
+	if sess.IsCurrentStream(first) {
+		t.Error("first stream should not be current")
+	}
+	if !sess.IsCurrentStream(second) {
+		t.Error("second stream should be current")
+	}
+}
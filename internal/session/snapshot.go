@@ -0,0 +1,199 @@
+package session
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// snapshotVersion is the current session snapshot file format.
+const snapshotVersion = 1
+
+// snapshot is the on-disk form of the session table.
+type snapshot struct {
+	Version  int            `json:"version"`
+	SavedAt  time.Time      `json:"saved_at"`
+	Sessions []savedSession `json:"sessions"`
+}
+
+// savedSession is the restorable metadata of one session. Live channels and
+// the replay buffer are not saved, and the bearer token is kept only as a
+// SHA-256 hash so the file does not hold credentials.
+type savedSession struct {
+	ID               string    `json:"id"`
+	AgentID          string    `json:"agent_id"`
+	AgentName        string    `json:"agent_name,omitempty"`
+	Capabilities     []string  `json:"capabilities,omitempty"`
+	RequestCount     int       `json:"request_count"`
+	CumulativeReads  int       `json:"cumulative_reads"`
+	CumulativeWrites int       `json:"cumulative_writes"`
+	IdentityVerified bool      `json:"identity_verified"`
+	DID              string    `json:"did,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	AuthTokenHash    string    `json:"auth_token_sha256,omitempty"`
+
+	// Declared by the client in initialize, which a resumed client does
+	// not send again
+	ProtocolVersion    string                 `json:"protocol_version,omitempty"`
+	ClientCapabilities map[string]interface{} `json:"client_capabilities,omitempty"`
+}
+
+// hashToken returns the hex SHA-256 of a bearer token, or "" for no token.
+func hashToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchesAuthToken reports whether token is the one that authenticated the
+// session. Sessions restored from a snapshot only know the token's hash; the
+// first matching token is recorded again.
+func (s *Session) MatchesAuthToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.AuthToken != "" || s.authTokenHash == "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(s.AuthToken)) == 1
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(s.authTokenHash)) != 1 {
+		return false
+	}
+	s.AuthToken = token
+	return true
+}
+
+// SaveSnapshot writes the metadata of all open sessions to path, replacing
+// the file atomically.
+func (m *Manager) SaveSnapshot(path string) error {
+	snap := snapshot{Version: snapshotVersion, SavedAt: time.Now().UTC()}
+
+	m.sessions.Range(func(key, value any) bool {
+		sess, ok := value.(*Session)
+		if !ok || sess.IsClosed() {
+			return true
+		}
+
+		sess.mu.RLock()
+		saved := savedSession{
+			ID:               sess.ID,
+			AgentID:          sess.AgentID,
+			AgentName:        sess.AgentName,
+			Capabilities:     sess.Capabilities,
+			RequestCount:     sess.RequestCount,
+			CumulativeReads:  sess.CumulativeReads,
+			CumulativeWrites: sess.CumulativeWrites,
+			IdentityVerified: sess.IdentityVerified,
+			DID:              sess.DID,
+			CreatedAt:        sess.CreatedAt,
+			AuthTokenHash:    sess.authTokenHash,
+
+			ProtocolVersion:    sess.ProtocolVersion,
+			ClientCapabilities: sess.ClientCapabilities,
+		}
+		if sess.AuthToken != "" {
+			saved.AuthTokenHash = hashToken(sess.AuthToken)
+		}
+		sess.mu.RUnlock()
+
+		snap.Sessions = append(snap.Sessions, saved)
+		return true
+	})
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode session snapshot: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(filepath.Clean(tmp), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write session snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace session snapshot: %w", err)
+	}
+
+	log.Info().
+		Str("path", path).
+		Int("sessions", len(snap.Sessions)).
+		Msg("Saved session snapshot")
+
+	return nil
+}
+
+// LoadSnapshot restores sessions saved by SaveSnapshot, returning how many
+// were restored. A missing file restores nothing. Sessions older than the
+// session TTL are skipped, as are any beyond the session limit. Restored
+// sessions count as active from the time they are loaded.
+func (m *Manager) LoadSnapshot(path string) (int, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read session snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("failed to parse session snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported session snapshot version: %d", snap.Version)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	restored := 0
+	for _, saved := range snap.Sessions {
+		if time.Since(saved.CreatedAt) > m.sessionTTL {
+			continue
+		}
+		if m.activeCount >= m.maxSessions {
+			log.Warn().
+				Int("max", m.maxSessions).
+				Int("skipped", len(snap.Sessions)-restored).
+				Msg("Session limit reached while restoring snapshot")
+			break
+		}
+		if _, exists := m.sessions.Load(saved.ID); exists {
+			continue
+		}
+
+		sess := m.newSession(saved.ID)
+		sess.AgentID = saved.AgentID
+		sess.AgentName = saved.AgentName
+		sess.Capabilities = saved.Capabilities
+		sess.RequestCount = saved.RequestCount
+		sess.CumulativeReads = saved.CumulativeReads
+		sess.CumulativeWrites = saved.CumulativeWrites
+		sess.IdentityVerified = saved.IdentityVerified
+		sess.DID = saved.DID
+		sess.CreatedAt = saved.CreatedAt
+		sess.authTokenHash = saved.AuthTokenHash
+		sess.ProtocolVersion = saved.ProtocolVersion
+		sess.ClientCapabilities = saved.ClientCapabilities
+
+		m.sessions.Store(sess.ID, sess)
+		m.activeCount++
+		restored++
+	}
+
+	log.Info().
+		Str("path", path).
+		Int("restored", restored).
+		Int("saved", len(snap.Sessions)).
+		Msg("Restored session snapshot")
+
+	return restored, nil
+}
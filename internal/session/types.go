@@ -3,6 +3,7 @@ package session
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +21,12 @@ type Session struct {
 	// RequestCount is the total number of requests in this session
 	RequestCount int `json:"request_count"`
 
+	// CumulativeReads is the number of resource reads forwarded in this session
+	CumulativeReads int `json:"cumulative_reads"`
+
+	// CumulativeWrites is the number of write tool calls forwarded in this session
+	CumulativeWrites int `json:"cumulative_writes"`
+
 	// AgentID is the identifier of the connected agent (from config or AgentFacts)
 	AgentID string `json:"agent_id"`
 
@@ -41,12 +48,49 @@ type Session struct {
 	// UserAgent is the client's user agent string
 	UserAgent string `json:"user_agent,omitempty"`
 
+	// AuthToken is the bearer token that authenticated the session (never serialized)
+	AuthToken string `json:"-"`
+
+	// ClientCertSubject is the subject of the client's TLS certificate (mTLS)
+	ClientCertSubject string `json:"client_cert_subject,omitempty"`
+
+	// ProtocolVersion is the MCP protocol version the client sent in initialize
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+
+	// ClientCapabilities are the capabilities the client declared in initialize
+	ClientCapabilities map[string]interface{} `json:"client_capabilities,omitempty"`
+
 	// MessageChan is used to send SSE messages back to the client
 	MessageChan chan []byte `json:"-"`
 
 	// Done is closed when the session is terminated
 	Done chan struct{} `json:"-"`
 
+	// events buffers recently streamed messages for Last-Event-ID replay
+	events      []Event
+	maxEvents   int
+	lastEventID uint64
+
+	// stream is the currently attached client stream
+	stream *Stream
+
+	// authTokenHash is the SHA-256 of the bearer token for sessions restored
+	// from a snapshot, which do not keep the token itself
+	authTokenHash string
+
+	// rateBucket holds the session's request rate limit state
+	rateBucket TokenBucket
+
+	// inFlight counts requests holding a concurrency slot
+	inFlight atomic.Int64
+
+	// draining is set once the transport is shutting down; no further
+	// messages are queued
+	draining atomic.Bool
+
+	// backpressure controls Deliver when MessageChan is full
+	backpressure backpressure
+
 	// mu protects concurrent access to session fields
 	mu sync.RWMutex `json:"-"`
 }
@@ -58,7 +102,7 @@ func NewSession(id string) *Session {
 		CreatedAt:      time.Now(),
 		LastActivityAt: time.Now(),
 		RequestCount:   0,
-		MessageChan:    make(chan []byte, 100), // Buffered channel for messages
+		MessageChan:    make(chan []byte, DefaultMessageBufferSize), // Buffered channel for messages
 		Done:           make(chan struct{}),
 	}
 }
@@ -79,6 +123,29 @@ func (s *Session) GetRequestCount() int {
 	return s.RequestCount
 }
 
+// IncrementReads increments the cumulative read counter and returns the new value.
+func (s *Session) IncrementReads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CumulativeReads++
+	return s.CumulativeReads
+}
+
+// IncrementWrites increments the cumulative write counter and returns the new value.
+func (s *Session) IncrementWrites() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CumulativeWrites++
+	return s.CumulativeWrites
+}
+
+// GetCumulativeCounts returns the cumulative read and write counters.
+func (s *Session) GetCumulativeCounts() (reads, writes int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.CumulativeReads, s.CumulativeWrites
+}
+
 // SetAgent sets the agent identity information.
 func (s *Session) SetAgent(agentID, agentName string, capabilities []string) {
 	s.mu.Lock()
@@ -96,6 +163,13 @@ func (s *Session) SetIdentity(verified bool, did string) {
 	s.DID = did
 }
 
+// GetIdentity returns the verified identity information.
+func (s *Session) GetIdentity() (verified bool, did string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.IdentityVerified, s.DID
+}
+
 // SetClientInfo sets the client connection information.
 func (s *Session) SetClientInfo(sourceIP, userAgent string) {
 	s.mu.Lock()
@@ -104,6 +178,51 @@ func (s *Session) SetClientInfo(sourceIP, userAgent string) {
 	s.UserAgent = userAgent
 }
 
+// SetAuthToken records the bearer token that authenticated the session.
+func (s *Session) SetAuthToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.AuthToken = token
+}
+
+// GetAuthToken returns the bearer token that authenticated the session.
+func (s *Session) GetAuthToken() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.AuthToken
+}
+
+// SetClientCertSubject records the subject of the client's TLS certificate.
+func (s *Session) SetClientCertSubject(subject string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ClientCertSubject = subject
+}
+
+// GetClientCertSubject returns the subject of the client's TLS certificate.
+func (s *Session) GetClientCertSubject() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ClientCertSubject
+}
+
+// SetInitialize records the protocol version and capabilities the client
+// declared in its initialize request.
+func (s *Session) SetInitialize(protocolVersion string, capabilities map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ProtocolVersion = protocolVersion
+	s.ClientCapabilities = capabilities
+}
+
+// GetInitialize returns the protocol version and capabilities the client
+// declared in its initialize request.
+func (s *Session) GetInitialize() (protocolVersion string, capabilities map[string]interface{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ProtocolVersion, s.ClientCapabilities
+}
+
 // Close closes the session channels.
 func (s *Session) Close() {
 	s.mu.Lock()
@@ -126,9 +245,23 @@ func (s *Session) IsClosed() bool {
 	}
 }
 
+// StartDraining stops the session accepting new messages. Messages already
+// queued can still be delivered.
+func (s *Session) StartDraining() {
+	s.draining.Store(true)
+}
+
+// IsDraining returns true once StartDraining has been called.
+func (s *Session) IsDraining() bool {
+	return s.draining.Load()
+}
+
 // SendMessage sends a message to the client via the message channel.
-// Returns false if the session is closed or the channel is full.
+// Returns false if the session is closed or draining, or the channel is full.
 func (s *Session) SendMessage(msg []byte) bool {
+	if s.draining.Load() {
+		return false
+	}
 	select {
 	case <-s.Done:
 		return false
@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// Authenticator validates bearer tokens on incoming HTTP requests.
+type Authenticator struct {
+	tokens [][]byte
+}
+
+// NewAuthenticator creates an authenticator from the auth configuration.
+// Returns nil if authentication is disabled.
+func NewAuthenticator(cfg config.AuthConfig) *Authenticator {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	a := &Authenticator{}
+	for _, t := range cfg.Tokens {
+		if t != "" {
+			a.tokens = append(a.tokens, []byte(t))
+		}
+	}
+	if cfg.Secret != "" {
+		a.tokens = append(a.tokens, []byte(cfg.Secret))
+	}
+	return a
+}
+
+// Authenticate checks the request's Authorization header and returns the
+// presented token if it is accepted.
+func (a *Authenticator) Authenticate(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", false
+	}
+
+	// Compare against every token so timing does not reveal which matched
+	presented := []byte(token)
+	matched := 0
+	for _, t := range a.tokens {
+		matched |= subtle.ConstantTimeCompare(presented, t)
+	}
+
+	return token, matched == 1
+}
+
+// TokenFingerprint returns a stable, non-reversible identifier for a token,
+// suitable for logs and policy input.
+func TokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
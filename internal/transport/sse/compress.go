@@ -0,0 +1,65 @@
+package sse
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipStream compresses an SSE stream. Every flush also flushes the gzip
+// writer, so each event reaches the client as soon as it is sent rather
+// than when the compressor's buffer fills.
+type gzipStream struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	flusher http.Flusher
+}
+
+// newGzipStream wraps w, which must also implement http.Flusher, and marks
+// the response as gzip-encoded. Call Close when the stream ends.
+func newGzipStream(w http.ResponseWriter, flusher http.Flusher) *gzipStream {
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Del("Content-Length")
+
+	return &gzipStream{
+		ResponseWriter: w,
+		gz:             gzip.NewWriter(w),
+		flusher:        flusher,
+	}
+}
+
+func (g *gzipStream) Write(p []byte) (int, error) {
+	return g.gz.Write(p)
+}
+
+// Flush writes any buffered compressed data to the client.
+func (g *gzipStream) Flush() {
+	g.gz.Flush()
+	g.flusher.Flush()
+}
+
+// Close writes the gzip trailer.
+func (g *gzipStream) Close() error {
+	return g.gz.Close()
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses gzip
+		name, value, ok := strings.Cut(strings.TrimSpace(params), "=")
+		if ok && strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
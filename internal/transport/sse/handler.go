@@ -2,10 +2,13 @@ package sse
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/agentfacts/mcp-proxy/internal/config"
@@ -17,12 +20,44 @@ import (
 // MessageHandler is an alias for the transport.MessageHandler type.
 type MessageHandler = transport.MessageHandler
 
+// DefaultResumeWindow is how long a disconnected session is kept for resumption.
+const DefaultResumeWindow = 30 * time.Second
+
+// DefaultHeartbeatInterval is the default keep-alive ping interval.
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// DefaultMaxReplayEvents is the most buffered events replayed to a resumed
+// stream. A client further behind gets a reset event instead.
+const DefaultMaxReplayEvents = 1000
+
+// resetEvent tells a resumed client that missed messages can't be replayed,
+// so it must re-sync its state, e.g. by re-issuing pending requests.
+const resetEvent = "reset"
+
+// drainRetryAfter is the Retry-After, in seconds, of requests refused while
+// the server shuts down, by when a replacement should be accepting them.
+const drainRetryAfter = "5"
+
+// DefaultMaxRequestBytes is the default maximum message body size.
+const DefaultMaxRequestBytes = config.DefaultMaxRequestBytes
+
 // Handler handles SSE connections and messages.
 type Handler struct {
-	sessionManager *session.Manager
-	agentCfg       config.AgentConfig
-	securityCfg    config.SecurityConfig
-	messageHandler MessageHandler
+	sessionManager    *session.Manager
+	agentCfg          config.AgentConfig
+	securityCfg       config.SecurityConfig
+	corsMu            sync.RWMutex // Guards securityCfg.CORSAllowedOrigins
+	messageHandler    MessageHandler
+	resumeWindow      time.Duration
+	maxReplayEvents   int
+	maxRequestBytes   int64
+	heartbeatInterval time.Duration
+	compression       bool
+	auth              *transport.Authenticator
+
+	// draining is closed when the server begins shutting down
+	draining     chan struct{}
+	drainingOnce sync.Once
 }
 
 // NewHandler creates a new SSE handler with default security settings.
@@ -34,16 +69,105 @@ func NewHandler(sessionMgr *session.Manager, agentCfg config.AgentConfig) *Handl
 			EnableSecurityHeaders: true,
 			CORSAllowedOrigins:    []string{}, // Empty = same-origin only (secure default)
 		},
+		resumeWindow:      DefaultResumeWindow,
+		maxReplayEvents:   DefaultMaxReplayEvents,
+		maxRequestBytes:   DefaultMaxRequestBytes,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		draining:          make(chan struct{}),
 	}
 }
 
 // NewHandlerWithSecurity creates a new SSE handler with custom security configuration.
 func NewHandlerWithSecurity(sessionMgr *session.Manager, agentCfg config.AgentConfig, securityCfg config.SecurityConfig) *Handler {
 	return &Handler{
-		sessionManager: sessionMgr,
-		agentCfg:       agentCfg,
-		securityCfg:    securityCfg,
+		sessionManager:    sessionMgr,
+		agentCfg:          agentCfg,
+		securityCfg:       securityCfg,
+		resumeWindow:      DefaultResumeWindow,
+		maxReplayEvents:   DefaultMaxReplayEvents,
+		maxRequestBytes:   DefaultMaxRequestBytes,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		draining:          make(chan struct{}),
+	}
+}
+
+// SetAuthenticator enables bearer-token authentication. Nil disables it.
+func (h *Handler) SetAuthenticator(auth *transport.Authenticator) {
+	h.auth = auth
+}
+
+// authenticate validates the request's bearer token, writing a 401 response
+// on failure.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.auth == nil {
+		return "", true
+	}
+
+	token, ok := h.auth.Authenticate(r)
+	if !ok {
+		h.unauthorized(w, r)
+		return "", false
+	}
+	return token, true
+}
+
+// ownsSession reports whether token is the one that opened sess.
+func (h *Handler) ownsSession(sess *session.Session, token string) bool {
+	if h.auth == nil {
+		return true
 	}
+	return sess.MatchesAuthToken(token)
+}
+
+// sameClientCert reports whether r carries the verified client certificate
+// subject of the connection that opened sess, or like it none.
+func sameClientCert(sess *session.Session, r *http.Request) bool {
+	return transport.ClientCertSubject(r) == sess.GetClientCertSubject()
+}
+
+// unauthorized writes a 401 response with a JSON-RPC error body.
+func (h *Handler) unauthorized(w http.ResponseWriter, r *http.Request) {
+	log.Warn().Str("remote_addr", r.RemoteAddr).Msg("Unauthorized request")
+	w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-proxy"`)
+	h.sendError(w, http.StatusUnauthorized, -32600, "Unauthorized")
+}
+
+// SetHeartbeatInterval sets the keep-alive ping interval. Zero disables heartbeats.
+func (h *Handler) SetHeartbeatInterval(d time.Duration) {
+	h.heartbeatInterval = d
+}
+
+// SetMaxRequestBytes sets the maximum accepted message body size.
+func (h *Handler) SetMaxRequestBytes(n int64) {
+	h.maxRequestBytes = n
+}
+
+// SetCompression enables gzip compression of event streams for clients that
+// send "Accept-Encoding: gzip". The whole stream is one gzip member, flushed
+// after every event.
+func (h *Handler) SetCompression(enabled bool) {
+	h.compression = enabled
+}
+
+// SetResumeWindow sets how long a session outlives its dropped SSE stream.
+// Zero deletes sessions as soon as the client disconnects.
+func (h *Handler) SetResumeWindow(d time.Duration) {
+	h.resumeWindow = d
+}
+
+// SetCORSAllowedOrigins replaces the allowed CORS origins. It is safe to
+// call while requests are being served.
+func (h *Handler) SetCORSAllowedOrigins(origins []string) {
+	h.corsMu.Lock()
+	defer h.corsMu.Unlock()
+	h.securityCfg.CORSAllowedOrigins = origins
+}
+
+// allowedOrigins returns the current allowed CORS origins.
+func (h *Handler) allowedOrigins() []string {
+	h.corsMu.RLock()
+	defer h.corsMu.RUnlock()
+	return h.securityCfg.CORSAllowedOrigins
 }
 
 // setSecurityHeaders adds security headers to the response.
@@ -58,30 +182,50 @@ func (h *Handler) setSecurityHeaders(w http.ResponseWriter) {
 }
 
 // setCORSHeaders sets CORS headers based on configuration.
-func (h *Handler) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+// Returns true if the request's origin is allowed.
+func (h *Handler) setCORSHeaders(w http.ResponseWriter, r *http.Request) bool {
 	origin := r.Header.Get("Origin")
+	origins := h.allowedOrigins()
 
 	// If no allowed origins configured, only allow same-origin (no CORS header)
-	if len(h.securityCfg.CORSAllowedOrigins) == 0 {
-		return
+	if len(origins) == 0 {
+		return false
 	}
 
 	// Check if wildcard is allowed
-	for _, allowed := range h.securityCfg.CORSAllowedOrigins {
+	for _, allowed := range origins {
 		if allowed == "*" {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			return
+			return true
 		}
 	}
 
 	// Check if the origin is in the allowed list
-	for _, allowed := range h.securityCfg.CORSAllowedOrigins {
+	for _, allowed := range origins {
 		if strings.EqualFold(origin, allowed) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Vary", "Origin")
-			return
+			return true
 		}
 	}
+
+	return false
+}
+
+// HandlePreflight answers CORS preflight requests (OPTIONS).
+func (h *Handler) HandlePreflight(w http.ResponseWriter, r *http.Request) {
+	h.setSecurityHeaders(w)
+
+	if !h.setCORSHeaders(w, r) {
+		// Omitting the allow headers makes the browser block the request
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID, "+transport.DryRunHeader+", "+transport.RequestIDHeader)
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // SetMessageHandler sets the callback for processing messages.
@@ -89,7 +233,28 @@ func (h *Handler) SetMessageHandler(handler MessageHandler) {
 	h.messageHandler = handler
 }
 
+// Drain tells every open stream to stop accepting messages, deliver what is
+// already queued, send a final shutdown event, and end. New streams are
+// refused from then on.
+func (h *Handler) Drain() {
+	h.drainingOnce.Do(func() { close(h.draining) })
+}
+
+// isDraining returns true once Drain has been called.
+func (h *Handler) isDraining() bool {
+	select {
+	case <-h.draining:
+		return true
+	default:
+		return false
+	}
+}
+
 // HandleSSE handles the SSE stream connection (GET /).
+// A request carrying a Last-Event-ID for a live session resumes that session,
+// replaying any buffered messages sent after the given event. If some were
+// evicted from the buffer, or more than the replay limit were missed, a
+// reset event is sent instead.
 func (h *Handler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 	// Check if client supports SSE
 	flusher, ok := w.(http.Flusher)
@@ -98,25 +263,58 @@ func (h *Handler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create new session
-	sess, err := h.sessionManager.Create(r.Context())
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create session")
-		http.Error(w, "Failed to create session", http.StatusServiceUnavailable)
+	if h.isDraining() {
+		w.Header().Set("Retry-After", drainRetryAfter)
+		http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	token, ok := h.authenticate(w, r)
+	if !ok {
 		return
 	}
 
-	// Set default agent info from config
-	sess.SetAgent(h.agentCfg.ID, h.agentCfg.Name, h.agentCfg.Capabilities)
+	sess, lastEventID, resumed := h.resumeSession(r.Header.Get("Last-Event-ID"))
+	if resumed && (!h.ownsSession(sess, token) || !sameClientCert(sess, r)) {
+		// Only the client that opened a session may resume it
+		resumed = false
+	}
+	if !resumed {
+		// Create new session
+		var err error
+		sess, err = h.sessionManager.Create(r.Context())
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create session")
+			http.Error(w, "Failed to create session", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Set default agent info from config
+		sess.SetAgent(h.agentCfg.ID, h.agentCfg.Name, h.agentCfg.Capabilities)
+		sess.SetAuthToken(token)
+		sess.SetClientCertSubject(transport.ClientCertSubject(r))
+	}
 
 	// Set client info
-	sess.SetClientInfo(r.RemoteAddr, r.UserAgent())
+	sess.SetClientInfo(transport.ClientIP(r), r.UserAgent())
+
+	// Take over the session stream
+	stream, prevStopped := sess.AttachStream()
+	defer stream.Close()
 
 	log.Info().
 		Str("session_id", sess.ID).
 		Str("remote_addr", r.RemoteAddr).
+		Bool("resumed", resumed).
 		Msg("SSE connection established")
 
+	// Compress the stream if enabled and the client accepts gzip
+	if h.compression && acceptsGzip(r) {
+		gw := newGzipStream(w, flusher)
+		defer gw.Close()
+		w, flusher = gw, gw
+	}
+
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
@@ -129,14 +327,55 @@ func (h *Handler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 
 	// Send endpoint event with message URL
 	messageURL := fmt.Sprintf("/message?sessionId=%s", sess.ID)
-	h.sendEvent(w, flusher, "endpoint", messageURL)
+	h.sendEvent(w, flusher, "", "endpoint", messageURL)
 
 	// Create done channel for cleanup
 	clientGone := r.Context().Done()
 
-	// Heartbeat ticker
-	heartbeat := time.NewTicker(30 * time.Second)
-	defer heartbeat.Stop()
+	if resumed {
+		// Wait for the previous stream to exit so every message it consumed
+		// has been recorded before replaying
+		select {
+		case <-prevStopped:
+		case <-clientGone:
+			h.releaseSession(sess, stream)
+			return
+		}
+
+		events, complete := sess.EventsSince(lastEventID)
+		if !complete || len(events) > h.maxReplayEvents {
+			// Don't replay a partial or oversized backlog; the client
+			// re-syncs from the reset instead
+			log.Warn().
+				Str("session_id", sess.ID).
+				Uint64("last_event_id", lastEventID).
+				Int("missed", len(events)).
+				Bool("lost", !complete).
+				Msg("Too many missed messages to replay - resetting stream")
+			h.sendEvent(w, flusher, "", resetEvent, `{"reason":"missed messages not replayed"}`)
+			events = nil
+		}
+		for _, ev := range events {
+			h.sendEvent(w, flusher, formatEventID(sess.ID, ev.ID), "message", string(ev.Data))
+		}
+	}
+
+	// Heartbeat ticker (nil channel blocks forever when disabled)
+	var heartbeat <-chan time.Time
+	if h.heartbeatInterval > 0 {
+		ticker := time.NewTicker(h.heartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	// Maximum lifetime timer, counted from session creation so that
+	// resuming doesn't extend it (nil channel blocks forever when disabled)
+	var lifetime <-chan time.Time
+	if maxLifetime := h.sessionManager.MaxLifetime(); maxLifetime > 0 {
+		timer := time.NewTimer(maxLifetime - sess.Age())
+		defer timer.Stop()
+		lifetime = timer.C
+	}
 
 	// Main event loop
 	for {
@@ -147,7 +386,12 @@ func (h *Handler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 				Str("session_id", sess.ID).
 				Int("request_count", sess.GetRequestCount()).
 				Msg("SSE client disconnected")
-			h.sessionManager.Delete(sess.ID)
+			h.releaseSession(sess, stream)
+			return
+
+		case <-stream.Detached():
+			// A resumed connection took over this session
+			log.Debug().Str("session_id", sess.ID).Msg("SSE stream replaced by resumed connection")
 			return
 
 		case <-sess.Done:
@@ -157,17 +401,126 @@ func (h *Handler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 
 		case msg := <-sess.MessageChan:
 			// Send message to client
-			h.sendEvent(w, flusher, "message", string(msg))
+			id := sess.RecordEvent(msg)
+			h.sendEvent(w, flusher, formatEventID(sess.ID, id), "message", string(msg))
 
-		case <-heartbeat.C:
+		case <-heartbeat:
 			// Send heartbeat to keep connection alive
-			h.sendEvent(w, flusher, "ping", "")
+			h.sendEvent(w, flusher, "", "ping", "")
+
+		case <-lifetime:
+			// Session is too old - deliver queued messages, then close it
+			// and tell the client to reconnect with a new session
+			sess.StartDraining()
+			h.flushQueued(w, flusher, sess)
+			h.sendEvent(w, flusher, "", "shutdown", "")
+			h.sessionManager.Delete(sess.ID)
+			log.Info().
+				Str("session_id", sess.ID).
+				Dur("age", sess.Age()).
+				Msg("SSE session closed at maximum lifetime")
+			return
+
+		case <-h.draining:
+			// Server is shutting down - deliver queued messages, then tell
+			// the client so it can reconnect elsewhere. The session is kept
+			// for the session manager to close or snapshot.
+			sess.StartDraining()
+			h.flushQueued(w, flusher, sess)
+			h.sendEvent(w, flusher, "", "shutdown", "")
+			log.Info().Str("session_id", sess.ID).Msg("SSE stream drained for shutdown")
+			return
 		}
 	}
 }
 
+// flushQueued sends every message already queued on the session.
+func (h *Handler) flushQueued(w http.ResponseWriter, flusher http.Flusher, sess *session.Session) {
+	for {
+		select {
+		case msg := <-sess.MessageChan:
+			id := sess.RecordEvent(msg)
+			h.sendEvent(w, flusher, formatEventID(sess.ID, id), "message", string(msg))
+		default:
+			return
+		}
+	}
+}
+
+// resumeSession looks up the session named by a Last-Event-ID header.
+func (h *Handler) resumeSession(lastEventID string) (*session.Session, uint64, bool) {
+	if lastEventID == "" {
+		return nil, 0, false
+	}
+
+	sessionID, id, ok := parseEventID(lastEventID)
+	if !ok {
+		return nil, 0, false
+	}
+
+	sess, ok := h.sessionManager.Get(sessionID)
+	if !ok {
+		log.Debug().Str("session_id", sessionID).Msg("Cannot resume unknown session")
+		return nil, 0, false
+	}
+
+	return sess, id, true
+}
+
+// releaseSession deletes a session after its stream disconnects, unless a
+// client resumes it within the resume window.
+func (h *Handler) releaseSession(sess *session.Session, stream *session.Stream) {
+	if h.resumeWindow <= 0 {
+		h.sessionManager.Delete(sess.ID)
+		return
+	}
+
+	time.AfterFunc(h.resumeWindow, func() {
+		if sess.IsCurrentStream(stream) {
+			h.sessionManager.Delete(sess.ID)
+		}
+	})
+}
+
+// formatEventID encodes a session-scoped SSE event ID.
+func formatEventID(sessionID string, id uint64) string {
+	return fmt.Sprintf("%s:%d", sessionID, id)
+}
+
+// parseEventID decodes an event ID produced by formatEventID.
+func parseEventID(eventID string) (string, uint64, bool) {
+	i := strings.LastIndex(eventID, ":")
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	id, err := strconv.ParseUint(eventID[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return eventID[:i], id, true
+}
+
 // HandleMessage handles incoming MCP messages (POST /message).
 func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
+	if h.setCORSHeaders(w, r) {
+		w.Header().Set("Access-Control-Expose-Headers", transport.RequestIDHeader)
+	}
+
+	// Echo the client's request ID on every response, including errors
+	requestID := transport.RequestIDFrom(r)
+	if requestID != "" {
+		w.Header().Set(transport.RequestIDHeader, requestID)
+	}
+
+	// Messages arriving during shutdown would race the session teardown
+	if h.isDraining() {
+		w.Header().Set("Retry-After", drainRetryAfter)
+		h.sendError(w, http.StatusServiceUnavailable, -32603, "Server shutting down")
+		return
+	}
+
 	// Get session ID from query parameter
 	sessionID := r.URL.Query().Get("sessionId")
 	if sessionID == "" {
@@ -175,6 +528,12 @@ func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject unauthenticated requests before revealing whether the session exists
+	token, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
 	// Get session
 	sess, ok := h.sessionManager.Get(sessionID)
 	if !ok {
@@ -182,14 +541,37 @@ func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read request body
-	body, err := io.ReadAll(io.LimitReader(r.Body, 1*1024*1024)) // 1MB limit
+	// The token must match the one that opened the session
+	if !h.ownsSession(sess, token) {
+		h.unauthorized(w, r)
+		return
+	}
+
+	// So must the client certificate, which policies see as the session's
+	if !sameClientCert(sess, r) {
+		log.Warn().Str("session_id", sessionID).Str("remote_addr", r.RemoteAddr).Msg("Client certificate does not match the session")
+		h.sendError(w, http.StatusForbidden, -32600, "Client certificate does not match the session")
+		return
+	}
+
+	// Read request body, reading one extra byte to detect oversized payloads
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.maxRequestBytes+1))
 	if err != nil {
 		h.sendError(w, http.StatusBadRequest, -32700, "Failed to read request body")
 		return
 	}
 	defer r.Body.Close()
 
+	if int64(len(body)) > h.maxRequestBytes {
+		log.Warn().
+			Str("session_id", sessionID).
+			Int64("max_bytes", h.maxRequestBytes).
+			Msg("Request body too large")
+		h.sendError(w, http.StatusRequestEntityTooLarge, -32600,
+			fmt.Sprintf("Request body exceeds %d bytes", h.maxRequestBytes))
+		return
+	}
+
 	// Validate JSON
 	if !json.Valid(body) {
 		h.sendError(w, http.StatusBadRequest, -32700, "Invalid JSON")
@@ -206,9 +588,17 @@ func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
 		Msg("Received MCP message")
 
 	// Process message through handler
+	ctx := r.Context()
+	if transport.DryRunRequested(r) {
+		ctx = transport.WithDryRun(ctx)
+	}
+	if requestID != "" {
+		ctx = transport.WithRequestID(ctx, requestID)
+	}
+
 	var response []byte
 	if h.messageHandler != nil {
-		response, err = h.messageHandler(r.Context(), sess, body)
+		response, err = h.messageHandler(ctx, sess, body)
 		if err != nil {
 			// Log full error internally but return sanitized message to client
 			log.Error().Err(err).Str("session_id", sessionID).Msg("Message handler error")
@@ -222,8 +612,11 @@ func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
 
 	// Send response via SSE stream
 	if response != nil {
-		if !sess.SendMessage(response) {
-			log.Warn().Str("session_id", sessionID).Msg("Failed to send response - session closed or buffer full")
+		switch err := sess.Deliver(response); {
+		case errors.Is(err, session.ErrSessionOverflow):
+			log.Error().Str("session_id", sessionID).Msg("Closed session: message buffer stayed full")
+		case err != nil:
+			log.Warn().Err(err).Str("session_id", sessionID).Msg("Failed to send response")
 		}
 	}
 
@@ -231,8 +624,11 @@ func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
-// sendEvent sends an SSE event to the client.
-func (h *Handler) sendEvent(w http.ResponseWriter, flusher http.Flusher, event, data string) {
+// sendEvent sends an SSE event to the client. An empty id omits the id field.
+func (h *Handler) sendEvent(w http.ResponseWriter, flusher http.Flusher, id, event, data string) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
 	if event != "" {
 		fmt.Fprintf(w, "event: %s\n", event)
 	}
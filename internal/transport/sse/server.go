@@ -10,6 +10,7 @@ import (
 
 	"github.com/agentfacts/mcp-proxy/internal/config"
 	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
 	"github.com/rs/zerolog/log"
 )
 
@@ -20,6 +21,8 @@ type Server struct {
 	sessionManager *session.Manager
 	httpServer     *http.Server
 	handler        *Handler
+	tlsCfg         config.TLSConfig
+	listener       net.Listener
 
 	// Lifecycle
 	mu      sync.RWMutex
@@ -37,7 +40,14 @@ func NewServer(cfg config.ServerConfig, agentCfg config.AgentConfig, sessionMgr
 	}
 
 	// Create the handler
-	s.handler = NewHandler(s.sessionManager, agentCfg)
+	s.handler = NewHandlerWithSecurity(s.sessionManager, agentCfg, cfg.Security)
+	s.handler.SetHeartbeatInterval(cfg.HeartbeatInterval)
+	s.handler.SetAuthenticator(transport.NewAuthenticator(cfg.Auth))
+	if cfg.MaxRequestBytes > 0 {
+		s.handler.SetMaxRequestBytes(cfg.MaxRequestBytes)
+	}
+	s.handler.SetResumeWindow(cfg.SSEResumeWindow)
+	s.handler.SetCompression(cfg.SSECompression)
 
 	return s
 }
@@ -47,6 +57,16 @@ func (s *Server) SetMessageHandler(h MessageHandler) {
 	s.handler.SetMessageHandler(h)
 }
 
+// SetTLSConfig enables HTTPS when cfg.Enabled is set. Must be called before Start.
+func (s *Server) SetTLSConfig(cfg config.TLSConfig) {
+	s.tlsCfg = cfg
+}
+
+// SetCORSAllowedOrigins replaces the allowed CORS origins at runtime.
+func (s *Server) SetCORSAllowedOrigins(origins []string) {
+	s.handler.SetCORSAllowedOrigins(origins)
+}
+
 // Start begins accepting SSE connections.
 func (s *Server) Start(ctx context.Context) error {
 	s.mu.Lock()
@@ -66,6 +86,9 @@ func (s *Server) Start(ctx context.Context) error {
 	// Message endpoint - receives MCP messages
 	mux.HandleFunc("POST /message", s.handler.HandleMessage)
 
+	// CORS preflight for cross-origin browser clients
+	mux.HandleFunc("OPTIONS /", s.handler.HandlePreflight)
+
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%d", s.cfg.Listen.Address, s.cfg.Listen.Port)
 	s.httpServer = &http.Server{
@@ -79,20 +102,40 @@ func (s *Server) Start(ctx context.Context) error {
 		},
 	}
 
+	if s.tlsCfg.Enabled {
+		tlsConfig, err := transport.NewTLSConfig(s.tlsCfg)
+		if err != nil {
+			return err
+		}
+		s.httpServer.TLSConfig = tlsConfig
+	}
+
 	// Start listening
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
 
 	log.Info().
-		Str("address", addr).
+		Str("address", listener.Addr().String()).
 		Str("transport", "sse").
+		Bool("tls", s.tlsCfg.Enabled).
+		Str("client_auth", s.tlsCfg.ClientAuth).
 		Msg("SSE server listening")
 
 	// Start serving in goroutine
 	go func() {
-		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+		var err error
+		if s.httpServer.TLSConfig != nil {
+			// Certificates are already loaded into TLSConfig
+			err = s.httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = s.httpServer.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Error().Err(err).Msg("SSE server error")
 		}
 	}()
@@ -100,6 +143,16 @@ func (s *Server) Start(ctx context.Context) error {
 	return nil
 }
 
+// Addr returns the address the server is listening on, or nil before Start.
+func (s *Server) Addr() net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
 // Stop gracefully shuts down the server.
 func (s *Server) Stop(ctx context.Context) error {
 	s.mu.Lock()
@@ -114,9 +167,15 @@ func (s *Server) Stop(ctx context.Context) error {
 
 	log.Info().Msg("Shutting down SSE server...")
 
+	// Ask open streams to send a shutdown event and end, so that Shutdown
+	// is not left waiting on them until the deadline
+	s.handler.Drain()
+
 	// Gracefully shutdown HTTP server
 	if s.httpServer != nil {
 		if err := s.httpServer.Shutdown(ctx); err != nil {
+			// Deadline passed with streams still open - cut them off
+			_ = s.httpServer.Close()
 			return fmt.Errorf("server shutdown error: %w", err)
 		}
 	}
@@ -2,17 +2,31 @@ package sse
 
 import (
 	"bufio"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/agentfacts/mcp-proxy/internal/config"
 	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
 )
 
 func TestNewServer(t *testing.T) {
@@ -40,6 +54,10 @@ func TestNewServer(t *testing.T) {
 	if server == nil {
 		t.Fatal("NewServer returned nil")
 	}
+	// An unset resume window disables resumption rather than defaulting
+	if server.handler.resumeWindow != 0 {
+		t.Errorf("resumeWindow = %s, want 0", server.handler.resumeWindow)
+	}
 }
 
 func TestNewHandler(t *testing.T) {
@@ -598,6 +616,73 @@ func TestCORSHeaders(t *testing.T) {
 	}
 }
 
+// TestCORSPreflight tests OPTIONS preflight handling for allowed and disallowed origins.
+func TestCORSPreflight(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+	})
+	sm.Start(context.Background())
+	defer sm.Stop()
+
+	handler := NewHandlerWithSecurity(sm, config.AgentConfig{ID: "test-agent"}, config.SecurityConfig{
+		EnableSecurityHeaders: true,
+		CORSAllowedOrigins:    []string{"https://app.example"},
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /message", handler.HandleMessage)
+	mux.HandleFunc("OPTIONS /", handler.HandlePreflight)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	tests := []struct {
+		name           string
+		origin         string
+		expectedStatus int
+		expectedOrigin string
+	}{
+		{"allowed origin", "https://app.example", http.StatusNoContent, "https://app.example"},
+		{"disallowed origin", "https://evil.example", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("OPTIONS", ts.URL+"/message?sessionId=abc", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "content-type, authorization")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.expectedOrigin, got)
+			}
+
+			methods := resp.Header.Get("Access-Control-Allow-Methods")
+			headers := resp.Header.Get("Access-Control-Allow-Headers")
+			if tt.expectedStatus == http.StatusNoContent {
+				if !strings.Contains(methods, "POST") {
+					t.Errorf("Expected POST in Access-Control-Allow-Methods, got %q", methods)
+				}
+				if !strings.Contains(headers, "Authorization") || !strings.Contains(headers, "Content-Type") {
+					t.Errorf("Expected Content-Type and Authorization in Access-Control-Allow-Headers, got %q", headers)
+				}
+			} else if methods != "" || headers != "" {
+				t.Errorf("Expected no allow headers for disallowed origin, got methods=%q headers=%q", methods, headers)
+			}
+		})
+	}
+}
+
 func TestLargePayload(t *testing.T) {
 	sm := session.NewManager(session.ManagerConfig{
 		SessionTTL:      time.Hour,
@@ -643,6 +728,70 @@ func TestLargePayload(t *testing.T) {
 	}
 }
 
+// TestPayloadTooLarge tests that bodies over the configured limit are rejected, not truncated.
+func TestPayloadTooLarge(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+	})
+	ctx := context.Background()
+	sm.Start(ctx)
+	defer sm.Stop()
+
+	const limit = 1024
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+	handler.SetMaxRequestBytes(limit)
+
+	sess, _ := sm.Create(ctx)
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleMessage))
+	defer ts.Close()
+
+	envelope := `{"jsonrpc":"2.0","id":"1","method":"test","params":{"data":"%s"}}`
+	padding := limit - len(fmt.Sprintf(envelope, ""))
+
+	tests := []struct {
+		name           string
+		size           int
+		expectedStatus int
+	}{
+		{"at limit", padding, http.StatusAccepted},
+		{"one byte over", padding + 1, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := fmt.Sprintf(envelope, strings.Repeat("x", tt.size))
+
+			resp, err := http.Post(ts.URL+"?sessionId="+sess.ID, "application/json", strings.NewReader(msg))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if tt.expectedStatus == http.StatusRequestEntityTooLarge {
+				var body struct {
+					Error struct {
+						Code int `json:"code"`
+					} `json:"error"`
+				}
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+					t.Fatalf("Failed to decode error: %v", err)
+				}
+				if body.Error.Code != -32600 {
+					t.Errorf("Expected error code -32600, got %d", body.Error.Code)
+				}
+			}
+		})
+	}
+}
+
 func TestServerName(t *testing.T) {
 	sm := session.NewManager(session.ManagerConfig{
 		SessionTTL:      time.Hour,
@@ -754,3 +903,998 @@ func TestNoMessageHandler(t *testing.T) {
 		t.Errorf("Expected status 202, got %d", resp.StatusCode)
 	}
 }
+
+// readSSEEvent reads one SSE event, returning its id, type, and data.
+func readSSEEvent(t *testing.T, reader *bufio.Reader) (id, event, data string) {
+	t.Helper()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			return id, event, data
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// TestLastEventIDResumption tests that a dropped stream can be resumed without message loss.
+func TestLastEventIDResumption(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:       time.Hour,
+		CleanupInterval:  time.Minute,
+		MaxSessions:      100,
+		ReplayBufferSize: 10,
+	})
+	ctx := context.Background()
+	sm.Start(ctx)
+	defer sm.Stop()
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", handler.HandleSSE)
+	mux.HandleFunc("POST /message", handler.HandleMessage)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	connect := func(ctx context.Context, lastEventID string) (*http.Response, *bufio.Reader, string) {
+		req, err := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		_, event, endpoint := readSSEEvent(t, reader)
+		if event != "endpoint" {
+			t.Fatalf("Expected endpoint event, got %q", event)
+		}
+		return resp, reader, endpoint
+	}
+
+	post := func(endpoint string, id int) {
+		msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"ping"}`, id)
+		resp, err := client.Post(ts.URL+endpoint, "application/json", strings.NewReader(msg))
+		if err != nil {
+			t.Fatalf("Failed to post message: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", resp.StatusCode)
+		}
+	}
+
+	// First connection receives message 1, then drops before reading message 2
+	ctx1, drop := context.WithCancel(ctx)
+	resp1, reader1, endpoint := connect(ctx1, "")
+
+	post(endpoint, 1)
+	lastID, _, data := readSSEEvent(t, reader1)
+	if lastID == "" {
+		t.Fatal("Expected message event to carry an id")
+	}
+	if !strings.Contains(data, `"id":1`) {
+		t.Fatalf("Expected message 1, got %s", data)
+	}
+
+	post(endpoint, 2)
+	drop()
+	resp1.Body.Close()
+
+	// Resume and send one more message while connected
+	resp2, reader2, endpoint2 := connect(ctx, lastID)
+	defer resp2.Body.Close()
+
+	if endpoint2 != endpoint {
+		t.Errorf("Expected resumed session endpoint %s, got %s", endpoint, endpoint2)
+	}
+
+	post(endpoint2, 3)
+
+	seen := map[string]bool{lastID: true}
+	for _, want := range []string{`"id":2`, `"id":3`} {
+		id, event, data := readSSEEvent(t, reader2)
+		if event != "message" {
+			t.Fatalf("Expected message event, got %q", event)
+		}
+		if !strings.Contains(data, want) {
+			t.Errorf("Expected message with %s, got %s", want, data)
+		}
+		if seen[id] {
+			t.Errorf("Event id %s delivered twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+// TestResumeReset tests that a resumed stream gets a reset event instead of
+// a replay when too many messages were missed or some were evicted.
+func TestResumeReset(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:       time.Hour,
+		CleanupInterval:  time.Minute,
+		MaxSessions:      100,
+		ReplayBufferSize: 3,
+	})
+	ctx := context.Background()
+	sm.Start(ctx)
+	defer sm.Stop()
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+	handler.maxReplayEvents = 2
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleSSE))
+	defer ts.Close()
+
+	sess, err := sm.Create(ctx)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	// Event 1 is evicted from the three-event buffer
+	for i := 1; i <= 4; i++ {
+		sess.RecordEvent([]byte(fmt.Sprintf(`{"id":%d}`, i)))
+	}
+
+	tests := []struct {
+		name      string
+		lastEvent uint64
+		want      []string
+	}{
+		{name: "within the limit", lastEvent: 2, want: []string{"message", "message"}},
+		{name: "past the limit", lastEvent: 1, want: []string{resetEvent}},
+		{name: "evicted", lastEvent: 0, want: []string{resetEvent}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Last-Event-ID", formatEventID(sess.ID, tt.lastEvent))
+
+			resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer resp.Body.Close()
+
+			reader := bufio.NewReader(resp.Body)
+			if _, event, _ := readSSEEvent(t, reader); event != "endpoint" {
+				t.Fatalf("Expected endpoint event, got %q", event)
+			}
+			for _, want := range tt.want {
+				if _, event, _ := readSSEEvent(t, reader); event != want {
+					t.Errorf("event = %q, want %q", event, want)
+				}
+			}
+		})
+	}
+}
+
+// TestResumeUnknownSession tests that an unknown Last-Event-ID starts a new session.
+func TestResumeUnknownSession(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+	})
+	ctx := context.Background()
+	sm.Start(ctx)
+	defer sm.Stop()
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleSSE))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Last-Event-ID", "sess_missing:5")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	_, event, data := readSSEEvent(t, bufio.NewReader(resp.Body))
+	if event != "endpoint" {
+		t.Fatalf("Expected endpoint event, got %q", event)
+	}
+	if strings.Contains(data, "sess_missing") {
+		t.Errorf("Expected a new session, got %s", data)
+	}
+}
+
+// TestHeartbeatInterval tests configurable and disabled heartbeats.
+func TestHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		name          string
+		interval      time.Duration
+		expectedEvent string
+	}{
+		{"enabled", 20 * time.Millisecond, "ping"},
+		{"disabled", 0, "message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := session.NewManager(session.ManagerConfig{
+				SessionTTL:      time.Hour,
+				CleanupInterval: time.Minute,
+				MaxSessions:     100,
+			})
+			sm.Start(context.Background())
+			defer sm.Stop()
+
+			handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+			handler.SetHeartbeatInterval(tt.interval)
+
+			ts := httptest.NewServer(http.HandlerFunc(handler.HandleSSE))
+			defer ts.Close()
+
+			client := &http.Client{Timeout: 5 * time.Second}
+			resp, err := client.Get(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer resp.Body.Close()
+
+			reader := bufio.NewReader(resp.Body)
+			_, _, endpoint := readSSEEvent(t, reader)
+			sessionID := strings.TrimPrefix(endpoint, "/message?sessionId=")
+
+			// Queue a message after several heartbeat intervals would have elapsed
+			time.Sleep(100 * time.Millisecond)
+			sess, ok := sm.Get(sessionID)
+			if !ok {
+				t.Fatal("Session not found")
+			}
+			sess.SendMessage([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+
+			_, event, _ := readSSEEvent(t, reader)
+			if event != tt.expectedEvent {
+				t.Errorf("Expected first event %q, got %q", tt.expectedEvent, event)
+			}
+		})
+	}
+}
+
+// TestMaxSessionLifetime tests that a session is closed with a shutdown
+// event once it reaches its maximum lifetime, even while the client keeps it
+// busy.
+func TestMaxSessionLifetime(t *testing.T) {
+	const maxLifetime = 300 * time.Millisecond
+
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+		MaxLifetime:     maxLifetime,
+	})
+	sm.Start(context.Background())
+	defer sm.Stop()
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+	handler.SetMessageHandler(func(ctx context.Context, sess *session.Session, msg []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler.HandleSSE)
+	mux.HandleFunc("/message", handler.HandleMessage)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	_, _, endpoint := readSSEEvent(t, reader)
+	sessionID := strings.TrimPrefix(endpoint, "/message?sessionId=")
+	start := time.Now()
+
+	// Keep the session active until it is closed
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				resp, err := client.Post(ts.URL+endpoint, "application/json",
+					strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+				if err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+	}()
+
+	for {
+		_, event, _ := readSSEEvent(t, reader)
+		if event == "shutdown" {
+			break
+		}
+		if event != "message" && event != "ping" {
+			t.Fatalf("Unexpected event %q", event)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < maxLifetime-50*time.Millisecond {
+		t.Errorf("Session closed after %s, want about %s", elapsed, maxLifetime)
+	}
+	if _, ok := sm.Get(sessionID); ok {
+		t.Error("Session should be removed at its maximum lifetime")
+	}
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("Expected the stream to end after the shutdown event, got %v", err)
+	}
+}
+
+// TestBearerAuth tests bearer-token authentication on the SSE and message endpoints.
+func TestBearerAuth(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+	})
+	ctx := context.Background()
+	sm.Start(ctx)
+	defer sm.Stop()
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+	handler.SetAuthenticator(transport.NewAuthenticator(config.AuthConfig{
+		Enabled: true,
+		Tokens:  []string{"token-a", "token-b"},
+		Secret:  "shared-secret",
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", handler.HandleSSE)
+	mux.HandleFunc("POST /message", handler.HandleMessage)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic dG9rZW4tYQ==", http.StatusUnauthorized},
+		{"unknown token", "Bearer nope", http.StatusUnauthorized},
+		{"static token", "Bearer token-a", http.StatusOK},
+		{"shared secret", "Bearer shared-secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", ts.URL, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if tt.expectedStatus == http.StatusUnauthorized {
+				var body struct {
+					Error struct {
+						Code int `json:"code"`
+					} `json:"error"`
+				}
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+					t.Fatalf("Expected JSON-RPC error body: %v", err)
+				}
+				if body.Error.Code != -32600 {
+					t.Errorf("Expected error code -32600, got %d", body.Error.Code)
+				}
+			}
+		})
+	}
+
+	// Open a session with token-a
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Authorization", "Bearer token-a")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	_, _, endpoint := readSSEEvent(t, bufio.NewReader(resp.Body))
+	sessionID := strings.TrimPrefix(endpoint, "/message?sessionId=")
+
+	sess, ok := sm.Get(sessionID)
+	if !ok {
+		t.Fatal("Session not found")
+	}
+	if sess.GetAuthToken() != "token-a" {
+		t.Errorf("Expected session token token-a, got %q", sess.GetAuthToken())
+	}
+
+	// Only the token that opened the session may use it
+	messageTests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"other valid token", "Bearer token-b", http.StatusUnauthorized},
+		{"owning token", "Bearer token-a", http.StatusAccepted},
+	}
+
+	for _, tt := range messageTests {
+		t.Run("message "+tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", ts.URL+endpoint, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// testCert is a generated certificate and its PEM encoding.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate signed by parent, or self-signed if
+// parent is nil.
+func newTestCert(t *testing.T, tmpl *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// TestServerTLS tests that the server negotiates TLS, requires client
+// certificates, attaches the client certificate subject to the session and
+// only accepts messages for the session with that certificate.
+func TestServerTLS(t *testing.T) {
+	ca := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "proxy"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	clientCert := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "agent-client", Organization: []string{"Acme"}},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ca.pem":     ca.certPEM,
+		"server.pem": serverCert.certPEM,
+		"server.key": serverCert.keyPEM,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sm.Start(ctx)
+	defer sm.Stop()
+
+	server := NewServer(config.ServerConfig{
+		Listen:    config.ListenConfig{Address: "127.0.0.1", Port: 0},
+		Transport: "sse",
+	}, config.AgentConfig{ID: "test-agent"}, sm)
+	server.SetTLSConfig(config.TLSConfig{
+		Enabled:    true,
+		CertFile:   filepath.Join(dir, "server.pem"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		MinVersion: "1.3",
+		ClientAuth: "require",
+	})
+	if err := server.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer server.Stop(context.Background())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	url := "https://" + server.Addr().String() + "/"
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      roots,
+				Certificates: certs,
+			}},
+		}
+	}
+
+	// Without a client certificate the handshake is rejected
+	if resp, err := newClient().Get(url); err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected request without client certificate to fail")
+	}
+
+	pair, err := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load client key pair: %v", err)
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := newClient(pair).Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.TLS == nil || resp.TLS.Version != tls.VersionTLS13 {
+		t.Fatalf("Expected TLS 1.3, got %+v", resp.TLS)
+	}
+
+	// The endpoint event carries the session ID
+	reader := bufio.NewReader(resp.Body)
+	var sessionID string
+	for sessionID == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read endpoint event: %v", err)
+		}
+		if _, id, ok := strings.Cut(strings.TrimSpace(line), "sessionId="); ok {
+			sessionID = id
+		}
+	}
+
+	sess, ok := sm.Get(sessionID)
+	if !ok {
+		t.Fatalf("Session %s not found", sessionID)
+	}
+	if got, want := sess.GetClientCertSubject(), "CN=agent-client,O=Acme"; got != want {
+		t.Errorf("ClientCertSubject = %q, want %q", got, want)
+	}
+
+	// Messages must come with the certificate that opened the session
+	otherCert := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "other-client"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	otherPair, err := tls.X509KeyPair(otherCert.certPEM, otherCert.keyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load client key pair: %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		cert tls.Certificate
+		want int
+	}{
+		{"same certificate", pair, http.StatusAccepted},
+		{"other certificate", otherPair, http.StatusForbidden},
+	} {
+		body := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+		resp, err := newClient(tc.cert).Post(url+"message?sessionId="+sessionID, "application/json", body)
+		if err != nil {
+			t.Fatalf("POST with %s error = %v", tc.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("POST with %s status = %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+// TestServerStopDrainsStreams tests that Stop sends a shutdown event to
+// connected clients and stops the session accepting messages.
+func TestServerStopDrainsStreams(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{MaxSessions: 10})
+	defer sm.Stop()
+
+	server := NewServer(config.ServerConfig{
+		Listen:    config.ListenConfig{Address: "127.0.0.1", Port: 0},
+		Transport: "sse",
+	}, config.AgentConfig{ID: "test-agent"}, sm)
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + server.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Wait for the endpoint event so the stream is established
+	reader := bufio.NewReader(resp.Body)
+	var sessionID string
+	for sessionID == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read endpoint event: %v", err)
+		}
+		if _, id, ok := strings.Cut(line, "sessionId="); ok {
+			sessionID = strings.TrimSpace(id)
+		}
+	}
+	sess, ok := sm.Get(sessionID)
+	if !ok {
+		t.Fatalf("Session %s not found", sessionID)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Stop(stopCtx) }()
+
+	var gotShutdown bool
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if strings.TrimSpace(line) == "event: shutdown" {
+			gotShutdown = true
+		}
+	}
+	if !gotShutdown {
+		t.Error("Expected a shutdown event before the stream closed")
+	}
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Stop() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() did not return")
+	}
+
+	if !sess.IsDraining() {
+		t.Error("Session should be draining after Stop")
+	}
+	if sess.SendMessage([]byte(`{"jsonrpc":"2.0"}`)) {
+		t.Error("SendMessage() should fail once the session is draining")
+	}
+}
+
+// TestDrainingRejectsMessages tests that messages posted while the server
+// shuts down are refused with a Retry-After, even for a live session.
+func TestDrainingRejectsMessages(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{MaxSessions: 10})
+	defer sm.Stop()
+	sess, err := sm.Create(context.Background())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+	handled := false
+	handler.SetMessageHandler(func(ctx context.Context, sess *session.Session, message []byte) ([]byte, error) {
+		handled = true
+		return message, nil
+	})
+	handler.Drain()
+
+	req := httptest.NewRequest(http.MethodPost, "/message?sessionId="+sess.ID, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	rec := httptest.NewRecorder()
+	handler.HandleMessage(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+	if handled {
+		t.Error("Message handler called while draining")
+	}
+}
+
+// TestSSECompression tests that event streams are gzipped only when enabled
+// and accepted by the client, and that events arrive without waiting for the
+// stream to end.
+func TestSSECompression(t *testing.T) {
+	tests := []struct {
+		name           string
+		enabled        bool
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"enabled and accepted", true, "gzip, deflate", true},
+		{"enabled but not accepted", true, "", false},
+		{"enabled but refused", true, "gzip;q=0", false},
+		{"disabled", false, "gzip", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := session.NewManager(session.ManagerConfig{
+				SessionTTL:      time.Hour,
+				CleanupInterval: time.Minute,
+				MaxSessions:     100,
+			})
+			sm.Start(context.Background())
+			defer sm.Stop()
+
+			handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+			handler.SetHeartbeatInterval(0)
+			handler.SetCompression(tt.enabled)
+
+			ts := httptest.NewServer(http.HandlerFunc(handler.HandleSSE))
+			defer ts.Close()
+
+			req, err := http.NewRequest("GET", ts.URL, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			// Setting Accept-Encoding explicitly stops the client from
+			// decompressing transparently
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			if tt.acceptEncoding == "" {
+				req.Header.Set("Accept-Encoding", "identity")
+			}
+
+			client := &http.Client{Timeout: 5 * time.Second}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			defer resp.Body.Close()
+
+			gotGzip := resp.Header.Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %q, want gzip %v", resp.Header.Get("Content-Encoding"), tt.wantGzip)
+			}
+
+			var body io.Reader = resp.Body
+			if gotGzip {
+				gz, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() error = %v", err)
+				}
+				body = gz
+			}
+			reader := bufio.NewReader(body)
+
+			_, event, endpoint := readSSEEvent(t, reader)
+			if event != "endpoint" {
+				t.Fatalf("Expected endpoint event, got %q", event)
+			}
+			sessionID := strings.TrimPrefix(endpoint, "/message?sessionId=")
+
+			sess, ok := sm.Get(sessionID)
+			if !ok {
+				t.Fatal("Session not found")
+			}
+			payload := `{"jsonrpc":"2.0","id":1,"result":{"content":"` + strings.Repeat("x", 4096) + `"}}`
+			sess.SendMessage([]byte(payload))
+
+			_, event, data := readSSEEvent(t, reader)
+			if event != "message" || data != payload {
+				t.Errorf("Expected message event with payload, got %q (%d bytes)", event, len(data))
+			}
+		})
+	}
+}
+
+// TestDryRunHeader tests that the dry-run header marks the message context.
+func TestDryRunHeader(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+	})
+	ctx := context.Background()
+	sm.Start(ctx)
+	defer sm.Stop()
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+
+	var dryRun bool
+	handler.SetMessageHandler(func(ctx context.Context, sess *session.Session, msg []byte) ([]byte, error) {
+		dryRun = transport.IsDryRun(ctx)
+		return nil, nil
+	})
+
+	sess, _ := sm.Create(ctx)
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleMessage))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"no header", "", false},
+		{"true", "true", true},
+		{"false", "false", false},
+		{"invalid", "yes please", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := `{"jsonrpc":"2.0","id":"1","method":"test"}`
+			req, _ := http.NewRequest("POST", ts.URL+"?sessionId="+sess.ID, strings.NewReader(msg))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(transport.DryRunHeader, tt.header)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if dryRun != tt.want {
+				t.Errorf("IsDryRun() = %v, want %v", dryRun, tt.want)
+			}
+		})
+	}
+}
+
+// TestRequestIDHeader tests that a valid request ID header is passed to the
+// message handler and echoed back, including on errors.
+func TestRequestIDHeader(t *testing.T) {
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+	})
+	ctx := context.Background()
+	sm.Start(ctx)
+	defer sm.Stop()
+
+	handler := NewHandler(sm, config.AgentConfig{ID: "test-agent"})
+
+	var gotID string
+	handler.SetMessageHandler(func(ctx context.Context, sess *session.Session, msg []byte) ([]byte, error) {
+		gotID = transport.RequestIDFromContext(ctx)
+		return nil, nil
+	})
+
+	sess, _ := sm.Create(ctx)
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleMessage))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		sessionID  string
+		header     string
+		wantID     string
+		wantStatus int
+	}{
+		{"provided", sess.ID, "trace-123", "trace-123", http.StatusAccepted},
+		{"absent", sess.ID, "", "", http.StatusAccepted},
+		{"invalid", sess.ID, "bad id\twith spaces", "", http.StatusAccepted},
+		{"too long", sess.ID, strings.Repeat("a", 129), "", http.StatusAccepted},
+		{"error response", "missing", "trace-456", "trace-456", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID = ""
+			msg := `{"jsonrpc":"2.0","id":"1","method":"test"}`
+			req, _ := http.NewRequest("POST", ts.URL+"?sessionId="+tt.sessionID, strings.NewReader(msg))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(transport.RequestIDHeader, tt.header)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get(transport.RequestIDHeader); got != tt.wantID {
+				t.Errorf("echoed %s = %q, want %q", transport.RequestIDHeader, got, tt.wantID)
+			}
+			if tt.wantStatus == http.StatusAccepted && gotID != tt.wantID {
+				t.Errorf("RequestIDFromContext() = %q, want %q", gotID, tt.wantID)
+			}
+		})
+	}
+}
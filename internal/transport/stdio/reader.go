@@ -2,17 +2,37 @@ package stdio
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
 )
 
-// DefaultMaxMessageSize is the default maximum size of a single JSON message (1MB).
-const DefaultMaxMessageSize = 1024 * 1024
+// DefaultMaxMessageSize is the default maximum size of a single JSON message.
+const DefaultMaxMessageSize = config.DefaultMaxRequestBytes
+
+// Framing is how messages are delimited on the stdio streams.
+type Framing string
+
+const (
+	// FramingNDJSON delimits messages with newlines, one JSON message per
+	// line. It is the default.
+	FramingNDJSON Framing = "ndjson"
 
-// Reader handles reading newline-delimited JSON messages from stdin.
+	// FramingContentLength precedes each message with a header block holding
+	// its Content-Length in bytes, ended by a blank line, as in the Language
+	// Server Protocol.
+	FramingContentLength Framing = "content-length"
+)
+
+// Reader handles reading JSON messages from stdin.
 type Reader struct {
-	scanner        *bufio.Scanner
+	framing        Framing
+	buf            *bufio.Reader
 	maxMessageSize int
 }
 
@@ -23,11 +43,14 @@ func NewReader(in io.Reader) *Reader {
 
 // NewReaderWithMaxSize creates a new Reader with a custom max message size.
 func NewReaderWithMaxSize(in io.Reader, maxSize int) *Reader {
-	scanner := bufio.NewScanner(in)
-	scanner.Buffer(make([]byte, 0, 64*1024), maxSize)
+	return NewFramedReader(in, FramingNDJSON, maxSize)
+}
 
+// NewFramedReader creates a new Reader for messages delimited by framing.
+func NewFramedReader(in io.Reader, framing Framing, maxSize int) *Reader {
 	return &Reader{
-		scanner:        scanner,
+		framing:        framing,
+		buf:            bufio.NewReader(in),
 		maxMessageSize: maxSize,
 	}
 }
@@ -35,27 +58,133 @@ func NewReaderWithMaxSize(in io.Reader, maxSize int) *Reader {
 // ReadMessage reads the next JSON message from the input.
 // Returns io.EOF when there are no more messages.
 func (r *Reader) ReadMessage() ([]byte, error) {
-	if !r.scanner.Scan() {
-		if err := r.scanner.Err(); err != nil {
+	if r.framing == FramingContentLength {
+		return r.readContentLength()
+	}
+
+	msg, err := r.readLine()
+	for err == nil && len(msg) == 0 {
+		// Skip empty lines
+		msg, err = r.readLine()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate JSON
+	if !json.Valid(msg) {
+		return nil, fmt.Errorf("invalid JSON message")
+	}
+
+	return msg, nil
+}
+
+// readLine reads the next line, without its line ending. A line longer
+// than the max message size is discarded through its newline and reported
+// as an error, so the next line is read normally. A last line without a
+// newline is returned before io.EOF.
+func (r *Reader) readLine() ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.buf.ReadSlice('\n')
+		// Allow for the "\r\n" line ending
+		if !tooLong && len(line)+len(chunk) > r.maxMessageSize+2 {
+			tooLong, line = true, nil
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(line) == 0 && !tooLong:
+			return nil, io.EOF
+		case err != nil && err != io.EOF:
 			return nil, fmt.Errorf("reading input: %w", err)
 		}
-		return nil, io.EOF
+
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if tooLong || len(line) > r.maxMessageSize {
+			return nil, fmt.Errorf("message exceeds the %d byte limit", r.maxMessageSize)
+		}
+		return line, nil
 	}
+}
 
-	line := r.scanner.Bytes()
-	if len(line) == 0 {
-		// Skip empty lines
-		return r.ReadMessage()
+// readContentLength reads a header block and then exactly the number of
+// bytes its Content-Length names. Headers other than Content-Length, such
+// as Content-Type, are ignored.
+func (r *Reader) readContentLength() ([]byte, error) {
+	length := -1
+	headers := 0
+	for {
+		// Header lines are bounded like messages, so a client can't make
+		// the proxy buffer an endless line
+		raw, err := r.readLine()
+		if err != nil {
+			if err == io.EOF && headers == 0 {
+				return nil, io.EOF
+			}
+			if err == io.EOF {
+				return nil, fmt.Errorf("reading headers: %w", io.ErrUnexpectedEOF)
+			}
+			return nil, fmt.Errorf("reading headers: %w", err)
+		}
+
+		line := string(raw)
+		if line == "" {
+			if headers == 0 {
+				// Skip blank lines between messages
+				continue
+			}
+			break
+		}
+		headers++
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed header %q", line)
+		}
+		if !strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid Content-Length %q", strings.TrimSpace(value))
+		}
+		length = n
 	}
 
-	// Make a copy since scanner reuses the buffer
-	msg := make([]byte, len(line))
-	copy(msg, line)
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	if length > r.maxMessageSize {
+		// Skip the body so the next message is read from its headers
+		if _, err := io.CopyN(io.Discard, r.buf, int64(length)); err != nil {
+			return nil, fmt.Errorf("reading body: %w", unexpectedEOF(err))
+		}
+		return nil, fmt.Errorf("message of %d bytes exceeds the %d byte limit", length, r.maxMessageSize)
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r.buf, msg); err != nil {
+		return nil, fmt.Errorf("reading body: %w", unexpectedEOF(err))
+	}
 
-	// Validate JSON
 	if !json.Valid(msg) {
 		return nil, fmt.Errorf("invalid JSON message")
 	}
 
 	return msg, nil
 }
+
+// unexpectedEOF turns io.EOF in the middle of a message into
+// io.ErrUnexpectedEOF, so that it is not mistaken for the end of input.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -26,14 +26,21 @@ type Server struct {
 	session        *session.Session // Single session for stdio
 
 	// I/O streams (configurable for testing)
-	stdin  io.Reader
-	stdout io.Writer
+	stdin   io.Reader
+	stdout  io.Writer
+	framing Framing
+
+	// maxMessageSize bounds each message read from stdin
+	maxMessageSize int
 
 	// Lifecycle
 	mu      sync.RWMutex
 	started bool
 	done    chan struct{}
 	wg      sync.WaitGroup
+
+	// finished is closed when the read loop returns
+	finished chan struct{}
 }
 
 // NewServer creates a new stdio transport server.
@@ -43,7 +50,10 @@ func NewServer(agentCfg config.AgentConfig, sessionMgr *session.Manager) *Server
 		sessionManager: sessionMgr,
 		stdin:          os.Stdin,
 		stdout:         os.Stdout,
+		framing:        FramingNDJSON,
+		maxMessageSize: DefaultMaxMessageSize,
 		done:           make(chan struct{}),
+		finished:       make(chan struct{}),
 	}
 }
 
@@ -55,7 +65,10 @@ func NewServerWithIO(agentCfg config.AgentConfig, sessionMgr *session.Manager, s
 		sessionManager: sessionMgr,
 		stdin:          stdin,
 		stdout:         stdout,
+		framing:        FramingNDJSON,
+		maxMessageSize: DefaultMaxMessageSize,
 		done:           make(chan struct{}),
+		finished:       make(chan struct{}),
 	}
 }
 
@@ -64,6 +77,18 @@ func (s *Server) SetMessageHandler(h MessageHandler) {
 	s.messageHandler = h
 }
 
+// SetFraming sets how messages are delimited on stdin and stdout. It must
+// be called before Start.
+func (s *Server) SetFraming(f Framing) {
+	s.framing = f
+}
+
+// SetMaxMessageSize sets the largest message accepted on stdin. It must be
+// called before Start.
+func (s *Server) SetMaxMessageSize(n int) {
+	s.maxMessageSize = n
+}
+
 // Start begins reading from stdin and processing messages.
 func (s *Server) Start(ctx context.Context) error {
 	s.mu.Lock()
@@ -133,36 +158,77 @@ func (s *Server) Stop(ctx context.Context) error {
 	return nil
 }
 
+// Done returns a channel that is closed once the server stops reading: stdin
+// was closed, stdout failed, or the server was stopped. Nothing more can be
+// served after that, so the application should shut down.
+func (s *Server) Done() <-chan struct{} {
+	return s.finished
+}
+
 // Name returns the transport name.
 func (s *Server) Name() string {
 	return "stdio"
 }
 
+// readResult is one message, or the error reading it, from readMessages.
+type readResult struct {
+	msg []byte
+	err error
+}
+
+// readMessages reads messages in a goroutine and delivers them on the
+// returned channel, so that the read loop can stop while a read is blocked.
+// The goroutine returns after delivering io.EOF or once the server is done;
+// a read blocked on idle input keeps it alive until the input is closed.
+func (s *Server) readMessages(reader *Reader) <-chan readResult {
+	results := make(chan readResult)
+	go func() {
+		for {
+			msg, err := reader.ReadMessage()
+			select {
+			case results <- readResult{msg: msg, err: err}:
+			case <-s.done:
+				return
+			}
+			if err == io.EOF {
+				return
+			}
+		}
+	}()
+	return results
+}
+
 // readLoop continuously reads messages from stdin and processes them.
 func (s *Server) readLoop(ctx context.Context) {
 	defer s.wg.Done()
+	defer close(s.finished)
 
-	reader := NewReader(s.stdin)
-	writer := NewWriter(s.stdout)
+	reader := NewFramedReader(s.stdin, s.framing, s.maxMessageSize)
+	writer := NewFramedWriter(s.stdout, s.framing)
+	messages := s.readMessages(reader)
 
 	for {
+		// Wait for the next message, or for shutdown
+		var result readResult
 		select {
 		case <-s.done:
 			return
 		case <-ctx.Done():
 			return
-		default:
+		case result = <-messages:
 		}
 
-		// Read next message
-		msg, err := reader.ReadMessage()
+		msg, err := result.msg, result.err
 		if err != nil {
 			if err == io.EOF {
 				log.Info().Msg("Stdin closed (EOF), shutting down")
 				return
 			}
 			log.Error().Err(err).Msg("Error reading message")
-			s.writeError(writer, nil, -32700, "Parse error")
+			if err := s.writeError(writer, nil, -32700, "Parse error"); err != nil {
+				log.Error().Err(err).Msg("Stdout failed, shutting down")
+				return
+			}
 			continue
 		}
 
@@ -183,7 +249,10 @@ func (s *Server) readLoop(ctx context.Context) {
 				log.Error().Err(err).Str("session_id", s.session.ID).Msg("Message handler error")
 				// Try to extract request ID for error response
 				id := extractRequestID(msg)
-				s.writeError(writer, id, -32603, "Internal error")
+				if err := s.writeError(writer, id, -32603, "Internal error"); err != nil {
+					log.Error().Err(err).Msg("Stdout failed, shutting down")
+					return
+				}
 				continue
 			}
 		} else {
@@ -191,17 +260,20 @@ func (s *Server) readLoop(ctx context.Context) {
 			response = msg
 		}
 
-		// Write response
+		// Write response. Nothing more can reach the client once stdout
+		// fails, so the server stops reading.
 		if response != nil {
 			if err := writer.Write(response); err != nil {
-				log.Error().Err(err).Msg("Error writing response")
+				log.Error().Err(err).Msg("Error writing response, shutting down")
+				return
 			}
 		}
 	}
 }
 
-// writeError writes a JSON-RPC error response to stdout.
-func (s *Server) writeError(writer *Writer, id interface{}, code int, message string) {
+// writeError writes a JSON-RPC error response to stdout. It returns an
+// error only if stdout failed.
+func (s *Server) writeError(writer *Writer, id interface{}, code int, message string) error {
 	errResp := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      id,
@@ -214,12 +286,10 @@ func (s *Server) writeError(writer *Writer, id interface{}, code int, message st
 	data, err := json.Marshal(errResp)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to marshal error response")
-		return
+		return nil
 	}
 
-	if err := writer.Write(data); err != nil {
-		log.Error().Err(err).Msg("Failed to write error response")
-	}
+	return writer.Write(data)
 }
 
 // extractRequestID attempts to extract the request ID from a JSON-RPC message.
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -251,8 +255,12 @@ func TestServerEOFShutdown(t *testing.T) {
 		t.Fatalf("Start failed: %v", err)
 	}
 
-	// Server should detect EOF and be ready to stop
-	time.Sleep(100 * time.Millisecond)
+	// Server should detect EOF and report that it is done
+	select {
+	case <-server.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done() not closed after EOF")
+	}
 
 	stopCtx, stopCancel := context.WithTimeout(ctx, time.Second)
 	defer stopCancel()
@@ -261,6 +269,64 @@ func TestServerEOFShutdown(t *testing.T) {
 	}
 }
 
+func TestServerStopWhileIdle(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(server *Server, cancel context.CancelFunc)
+	}{
+		{
+			name: "stop",
+			stop: func(server *Server, cancel context.CancelFunc) {
+				stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer stopCancel()
+				if err := server.Stop(stopCtx); err != nil {
+					t.Errorf("Stop failed: %v", err)
+				}
+			},
+		},
+		{
+			name: "context canceled",
+			stop: func(server *Server, cancel context.CancelFunc) {
+				cancel()
+				server.wg.Wait()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Nothing is ever written, so the read blocks until the pipe closes
+			stdinReader, stdinWriter := io.Pipe()
+			defer stdinWriter.Close()
+
+			server := NewServerWithIO(config.AgentConfig{ID: "test-agent"}, newTestSessionManager(), stdinReader, &bytes.Buffer{})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err := server.Start(ctx); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			stopped := make(chan struct{})
+			start := time.Now()
+			go func() {
+				tt.stop(server, cancel)
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("Read loop took %v to stop, want it to stop promptly", elapsed)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatal("Read loop did not stop while stdin was idle")
+			}
+		})
+	}
+}
+
 func TestReaderBasic(t *testing.T) {
 	input := `{"jsonrpc":"2.0","method":"test","id":1}
 {"jsonrpc":"2.0","method":"test2","id":2}
@@ -373,6 +439,259 @@ func TestWriterMultiple(t *testing.T) {
 	}
 }
 
+// TestServerMaxMessageSize tests that messages larger than the configured
+// size are rejected with a parse error and the next message is still read.
+func TestServerMaxMessageSize(t *testing.T) {
+	small := `{"id":1}`
+	stdin := strings.NewReader(`{"id":2,"method":"0123456789abcdef"}` + "\n" + small + "\n")
+	stdout := &bytes.Buffer{}
+
+	server := NewServerWithIO(config.AgentConfig{ID: "test-agent"}, newTestSessionManager(), stdin, stdout)
+	server.SetMaxMessageSize(16)
+
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	server.wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "-32700") || lines[1] != small {
+		t.Errorf("Output = %q, want a parse error then %s", lines, small)
+	}
+}
+
+func TestReaderContentLength(t *testing.T) {
+	// Lengths count bytes, not characters: "é" is 2 bytes and "🔒" is 4
+	msg1 := `{"jsonrpc":"2.0","id":1,"params":{"text":"café 🔒"}}`
+	msg2 := `{"jsonrpc":"2.0","id":2}`
+	input := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg1), msg1) +
+		"\r\n" + // Blank lines between messages are skipped
+		fmt.Sprintf("content-length: %d\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n%s", len(msg2), msg2)
+
+	reader := NewFramedReader(strings.NewReader(input), FramingContentLength, DefaultMaxMessageSize)
+	for _, want := range []string{msg1, msg2} {
+		got, err := reader.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() error: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("ReadMessage() = %q, want %q", got, want)
+		}
+	}
+
+	if _, err := reader.ReadMessage(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestReaderContentLengthErrors(t *testing.T) {
+	large := fmt.Sprintf("Content-Length: 40\r\n\r\n{\"a\":\"%s\"}", strings.Repeat("x", 32))
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "missing length", input: "Content-Type: application/json\r\n\r\n{}", wantErr: "missing Content-Length"},
+		{name: "invalid length", input: "Content-Length: abc\r\n\r\n{}", wantErr: "invalid Content-Length"},
+		{name: "malformed header", input: "Content-Length 2\r\n\r\n{}", wantErr: "malformed header"},
+		{name: "truncated body", input: "Content-Length: 10\r\n\r\n{}", wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "truncated headers", input: "Content-Length: 2\r\n", wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "invalid JSON", input: "Content-Length: 3\r\n\r\n{{{", wantErr: "invalid JSON"},
+		{name: "too large", input: large, wantErr: "exceeds"},
+		{name: "header too long", input: "X-Padding: " + strings.Repeat("a", 64) + "\r\nContent-Length: 2\r\n\r\n{}", wantErr: "exceeds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewFramedReader(strings.NewReader(tt.input), FramingContentLength, 32)
+			_, err := reader.ReadMessage()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadMessage() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// An oversized message is skipped and the next one is read
+	next := `{"id":2}`
+	input := large + fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(next), next)
+	reader := NewFramedReader(strings.NewReader(input), FramingContentLength, 32)
+	if _, err := reader.ReadMessage(); err == nil {
+		t.Fatal("Expected error for oversized message")
+	}
+	if got, err := reader.ReadMessage(); err != nil || string(got) != next {
+		t.Errorf("ReadMessage() = %q, %v, want %q", got, err, next)
+	}
+}
+
+func TestWriterContentLength(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := NewFramedWriter(buf, FramingContentLength)
+
+	msg1 := []byte(`{"id":1,"result":"naïve ✓"}`)
+	msg2 := []byte(`{"id":2}`)
+	for _, msg := range [][]byte{msg1, msg2} {
+		if err := writer.Write(msg); err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+	}
+
+	expected := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg1), msg1) +
+		fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg2), msg2)
+	if got := buf.String(); got != expected {
+		t.Errorf("Output = %q, want %q", got, expected)
+	}
+
+	// What the writer frames, the reader reads back
+	reader := NewFramedReader(buf, FramingContentLength, DefaultMaxMessageSize)
+	for _, want := range [][]byte{msg1, msg2} {
+		got, err := reader.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() error: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("ReadMessage() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestServerContentLengthFraming(t *testing.T) {
+	msg := `{"jsonrpc":"2.0","method":"ping","id":"ü"}`
+	stdin := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg), msg))
+	stdout := &bytes.Buffer{}
+
+	server := NewServerWithIO(config.AgentConfig{ID: "test-agent"}, newTestSessionManager(), stdin, stdout)
+	server.SetFraming(FramingContentLength)
+
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	// EOF on stdin ends the read loop once the message is echoed back
+	server.wg.Wait()
+
+	want := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	if got := stdout.String(); got != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+}
+
+// callRecorder records each Write call separately.
+type callRecorder struct {
+	mu    sync.Mutex
+	calls [][]byte
+}
+
+func (c *callRecorder) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func TestWriterConcurrent(t *testing.T) {
+	const goroutines, perGoroutine = 8, 50
+
+	for _, framing := range []Framing{FramingNDJSON, FramingContentLength} {
+		t.Run(string(framing), func(t *testing.T) {
+			out := &callRecorder{}
+			writer := NewFramedWriter(out, framing)
+
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":"%d-%d","result":{"text":"%s"}}`, g, i, strings.Repeat("x", 100*i))
+						if err := writer.Write([]byte(msg)); err != nil {
+							t.Errorf("Write() error: %v", err)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			// Each message is written as one framed unit
+			if len(out.calls) != goroutines*perGoroutine {
+				t.Errorf("Write calls = %d, want one per message (%d)", len(out.calls), goroutines*perGoroutine)
+			}
+
+			reader := NewFramedReader(bytes.NewReader(bytes.Join(out.calls, nil)), framing, DefaultMaxMessageSize)
+			seen := make(map[string]bool)
+			for {
+				msg, err := reader.ReadMessage()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("ReadMessage() error: %v (messages interleaved)", err)
+				}
+				var resp struct {
+					ID string `json:"id"`
+				}
+				if err := json.Unmarshal(msg, &resp); err != nil {
+					t.Fatalf("Failed to parse message: %v", err)
+				}
+				seen[resp.ID] = true
+			}
+			if len(seen) != goroutines*perGoroutine {
+				t.Errorf("Read %d distinct messages, want %d", len(seen), goroutines*perGoroutine)
+			}
+		})
+	}
+}
+
+// failingWriter fails every write with err.
+type failingWriter struct {
+	err   error
+	calls int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	f.calls++
+	return 0, f.err
+}
+
+func TestWriterError(t *testing.T) {
+	out := &failingWriter{err: syscall.EPIPE}
+	writer := NewWriter(out)
+
+	err := writer.Write([]byte(`{"id":1}`))
+	if !errors.Is(err, syscall.EPIPE) {
+		t.Fatalf("Write() error = %v, want EPIPE", err)
+	}
+	if err := writer.Write([]byte(`{"id":2}`)); !errors.Is(err, syscall.EPIPE) {
+		t.Errorf("Second Write() error = %v, want the first error", err)
+	}
+	if out.calls != 1 {
+		t.Errorf("Write calls = %d, want 1: nothing is written after a failure", out.calls)
+	}
+	if !errors.Is(writer.Err(), syscall.EPIPE) {
+		t.Errorf("Err() = %v, want EPIPE", writer.Err())
+	}
+}
+
+func TestServerStopsOnWriteError(t *testing.T) {
+	// More input is pending, but nothing can be answered
+	stdinReader, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	stdout := &failingWriter{err: syscall.EPIPE}
+
+	server := NewServerWithIO(config.AgentConfig{ID: "test-agent"}, newTestSessionManager(), stdinReader, stdout)
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Stop(context.Background())
+
+	go stdinWriter.Write([]byte(`{"jsonrpc":"2.0","method":"ping","id":1}` + "\n"))
+
+	// Done tells the application to shut down
+	select {
+	case <-server.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Read loop kept running after stdout failed")
+	}
+}
+
 func TestServerSessionInfo(t *testing.T) {
 	sessionMgr := newTestSessionManager()
 	agentCfg := config.AgentConfig{
@@ -1,43 +1,89 @@
 package stdio
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"sync"
 )
 
-// Writer handles thread-safe writes to stdout with newline framing.
+// maxRetainedFrame is the largest frame buffer kept for reuse between
+// messages.
+const maxRetainedFrame = 1024 * 1024
+
+// Writer handles thread-safe writes of framed messages to stdout. Each
+// message is assembled with its framing in a buffer and written in a single
+// call, so concurrent messages never interleave on the output.
+//
+// The first write error is kept: stdout can't recover from a failed or
+// partial write (e.g. a broken pipe), so every later Write returns that
+// error without writing.
 type Writer struct {
-	out io.Writer
-	mu  sync.Mutex
+	out     io.Writer
+	framing Framing
+
+	mu    sync.Mutex
+	frame bytes.Buffer // Reused for each message
+	err   error
 }
 
 // NewWriter creates a new Writer for the given output stream.
 func NewWriter(out io.Writer) *Writer {
+	return NewFramedWriter(out, FramingNDJSON)
+}
+
+// NewFramedWriter creates a new Writer delimiting messages by framing.
+func NewFramedWriter(out io.Writer, framing Framing) *Writer {
 	return &Writer{
-		out: out,
+		out:     out,
+		framing: framing,
 	}
 }
 
-// Write writes a JSON message followed by a newline.
+// Write writes a JSON message with its framing: followed by a newline, or
+// preceded by a Content-Length header block.
 // It is safe for concurrent use.
 func (w *Writer) Write(data []byte) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	// Write the message
-	if _, err := w.out.Write(data); err != nil {
-		return err
+	if w.err != nil {
+		return w.err
 	}
 
-	// Write newline delimiter
-	if _, err := w.out.Write([]byte{'\n'}); err != nil {
-		return err
+	w.frame.Reset()
+	if w.framing == FramingContentLength {
+		fmt.Fprintf(&w.frame, "Content-Length: %d\r\n\r\n", len(data))
+		w.frame.Write(data)
+	} else {
+		w.frame.Write(data)
+		w.frame.WriteByte('\n')
+	}
+
+	_, err := w.out.Write(w.frame.Bytes())
+	if w.frame.Cap() > maxRetainedFrame {
+		// Don't hold on to the buffer of an unusually large message
+		w.frame = bytes.Buffer{}
+	}
+	if err != nil {
+		w.err = fmt.Errorf("writing output: %w", err)
+		return w.err
 	}
 
 	// Flush if the writer supports it
 	if f, ok := w.out.(interface{ Flush() error }); ok {
-		return f.Flush()
+		if err := f.Flush(); err != nil {
+			w.err = fmt.Errorf("flushing output: %w", err)
+			return w.err
+		}
 	}
 
 	return nil
 }
+
+// Err returns the error that failed an earlier write, or nil.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
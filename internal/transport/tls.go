@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// NewTLSConfig builds a server TLS configuration from the TLS settings,
+// loading the certificate key pair and, for client authentication, the CA
+// used to verify client certificates.
+func NewTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	switch cfg.MinVersion {
+	case "", "1.2":
+		tlsCfg.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tlsCfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS min_version: %s (must be 1.2 or 1.3)", cfg.MinVersion)
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(filepath.Clean(cfg.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", cfg.CAFile)
+		}
+		tlsCfg.ClientCAs = pool
+	}
+
+	switch cfg.ClientAuth {
+	case "", "none":
+		tlsCfg.ClientAuth = tls.NoClientCert
+	case "request":
+		// Verify certificates that are presented, if there is a CA to verify against
+		tlsCfg.ClientAuth = tls.RequestClientCert
+		if tlsCfg.ClientCAs != nil {
+			tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	case "require":
+		if tlsCfg.ClientCAs == nil {
+			return nil, fmt.Errorf("TLS client_auth require needs a ca_file")
+		}
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unsupported TLS client_auth: %s (must be none, request, or require)", cfg.ClientAuth)
+	}
+
+	return tlsCfg, nil
+}
+
+// ClientCertSubject returns the subject of the client certificate verified
+// on a TLS connection, or "" if there is none. A certificate presented but
+// not verified, as client_auth request without a ca_file allows, is ignored:
+// its subject could be anything.
+func ClientCertSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String()
+}
@@ -2,6 +2,9 @@ package transport
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"strconv"
 
 	"github.com/agentfacts/mcp-proxy/internal/session"
 )
@@ -11,7 +14,7 @@ import (
 type MessageHandler func(ctx context.Context, sess *session.Session, message []byte) ([]byte, error)
 
 // Transport defines the interface for MCP transport implementations.
-// Supported transports: SSE, stdio, HTTP
+// Supported transports: SSE, stdio, HTTP, WebSocket
 type Transport interface {
 	// Start begins accepting connections and processing messages.
 	Start(ctx context.Context) error
@@ -19,13 +22,26 @@ type Transport interface {
 	// Stop gracefully shuts down the transport, closing all connections.
 	Stop(ctx context.Context) error
 
-	// Name returns the transport type name (e.g., "sse", "stdio", "http")
+	// Name returns the transport type name (e.g., "sse", "stdio", "websocket")
 	Name() string
 
 	// SetMessageHandler sets the callback for processing incoming messages.
 	SetMessageHandler(handler MessageHandler)
 }
 
+// CORSConfigurable is implemented by HTTP transports whose allowed CORS
+// origins can be changed while running (e.g., on config reload).
+type CORSConfigurable interface {
+	SetCORSAllowedOrigins(origins []string)
+}
+
+// Finisher is implemented by transports that can stop serving on their own,
+// such as stdio when stdin closes. Done is closed when that happens, so the
+// application can shut down.
+type Finisher interface {
+	Done() <-chan struct{}
+}
+
 // ConnectionHandler is called when a new connection is established or closed.
 type ConnectionHandler interface {
 	OnConnect(ctx context.Context, sessionID string)
@@ -40,3 +56,71 @@ type TransportConfig struct {
 	WriteTimeout   int // seconds
 	MaxConnections int
 }
+
+// ClientIP returns the IP address of the client that sent r, without the
+// port, so that it can be matched against CIDR ranges.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// DryRunHeader is the HTTP header that asks for a single request to be
+// evaluated in audit mode.
+const DryRunHeader = "X-MCP-Dry-Run"
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context marking the request it carries as a dry run.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether the context was marked with WithDryRun.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+// DryRunRequested reports whether r carries a true DryRunHeader.
+func DryRunRequested(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.Header.Get(DryRunHeader))
+	return dryRun
+}
+
+// RequestIDHeader is the HTTP header that carries a client-chosen ID for a
+// request, used to correlate logs across clients, the proxy and upstreams.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds accepted request IDs, which are written to logs.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID set with WithRequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDFrom returns the RequestIDHeader of r, or "" if it is absent, too
+// long or contains anything but printable ASCII without spaces.
+func RequestIDFrom(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if len(id) > maxRequestIDLen {
+		return ""
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return ""
+		}
+	}
+	return id
+}
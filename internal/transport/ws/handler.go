@@ -0,0 +1,329 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
+	"github.com/rs/zerolog/log"
+)
+
+// MessageHandler is an alias for the transport.MessageHandler type.
+type MessageHandler = transport.MessageHandler
+
+// DefaultHeartbeatInterval is the default keep-alive ping interval.
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// DefaultMaxMessageSize is the default maximum size of a single message.
+const DefaultMaxMessageSize = config.DefaultMaxRequestBytes
+
+// Handler handles WebSocket connections.
+type Handler struct {
+	sessionManager    *session.Manager
+	agentCfg          config.AgentConfig
+	securityCfg       config.SecurityConfig
+	corsMu            sync.RWMutex // Guards securityCfg.CORSAllowedOrigins
+	messageHandler    MessageHandler
+	maxMessageSize    int
+	heartbeatInterval time.Duration
+	auth              *transport.Authenticator
+
+	// Open connections, closed on shutdown
+	mu    sync.Mutex
+	conns map[*Conn]struct{}
+}
+
+// NewHandler creates a new WebSocket handler with default security settings.
+func NewHandler(sessionMgr *session.Manager, agentCfg config.AgentConfig) *Handler {
+	return NewHandlerWithSecurity(sessionMgr, agentCfg, config.SecurityConfig{
+		EnableSecurityHeaders: true,
+		CORSAllowedOrigins:    []string{}, // Empty = same-origin only (secure default)
+	})
+}
+
+// NewHandlerWithSecurity creates a new WebSocket handler with custom security configuration.
+func NewHandlerWithSecurity(sessionMgr *session.Manager, agentCfg config.AgentConfig, securityCfg config.SecurityConfig) *Handler {
+	return &Handler{
+		sessionManager:    sessionMgr,
+		agentCfg:          agentCfg,
+		securityCfg:       securityCfg,
+		maxMessageSize:    DefaultMaxMessageSize,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		conns:             make(map[*Conn]struct{}),
+	}
+}
+
+// SetAuthenticator enables bearer-token authentication. Nil disables it.
+func (h *Handler) SetAuthenticator(auth *transport.Authenticator) {
+	h.auth = auth
+}
+
+// SetHeartbeatInterval sets the keep-alive ping interval. Zero disables heartbeats.
+func (h *Handler) SetHeartbeatInterval(d time.Duration) {
+	h.heartbeatInterval = d
+}
+
+// SetMaxMessageSize sets the maximum accepted message size.
+func (h *Handler) SetMaxMessageSize(n int) {
+	h.maxMessageSize = n
+}
+
+// SetMessageHandler sets the callback for processing messages.
+func (h *Handler) SetMessageHandler(handler MessageHandler) {
+	h.messageHandler = handler
+}
+
+// SetCORSAllowedOrigins replaces the allowed CORS origins. It is safe to
+// call while requests are being served.
+func (h *Handler) SetCORSAllowedOrigins(origins []string) {
+	h.corsMu.Lock()
+	defer h.corsMu.Unlock()
+	h.securityCfg.CORSAllowedOrigins = origins
+}
+
+// allowedOrigins returns the current allowed CORS origins.
+func (h *Handler) allowedOrigins() []string {
+	h.corsMu.RLock()
+	defer h.corsMu.RUnlock()
+	return h.securityCfg.CORSAllowedOrigins
+}
+
+// setSecurityHeaders adds security headers to the response.
+func (h *Handler) setSecurityHeaders(w http.ResponseWriter) {
+	if !h.securityCfg.EnableSecurityHeaders {
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
+	w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
+}
+
+// checkOrigin reports whether the request's Origin may open a WebSocket.
+// Browsers do not apply CORS to WebSockets, so the allowed-origins list is
+// enforced here. Requests without an Origin (non-browser clients) and
+// same-origin requests are always allowed.
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range h.allowedOrigins() {
+		if allowed == "*" || strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HandleWebSocket upgrades the connection and processes JSON-RPC messages
+// sent as WebSocket text frames (GET /).
+func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !h.checkOrigin(r) {
+		log.Warn().
+			Str("origin", r.Header.Get("Origin")).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("WebSocket origin rejected")
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	var token string
+	if h.auth != nil {
+		var ok bool
+		if token, ok = h.auth.Authenticate(r); !ok {
+			log.Warn().Str("remote_addr", r.RemoteAddr).Msg("Unauthorized request")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-proxy"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(errorResponse(-32600, "Unauthorized"))
+			return
+		}
+	}
+
+	// Create new session
+	sess, err := h.sessionManager.Create(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create session")
+		http.Error(w, "Failed to create session", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Set default agent info from config
+	sess.SetAgent(h.agentCfg.ID, h.agentCfg.Name, h.agentCfg.Capabilities)
+
+	// Set client info
+	sess.SetClientInfo(transport.ClientIP(r), r.UserAgent())
+	sess.SetAuthToken(token)
+
+	h.setSecurityHeaders(w)
+
+	conn, err := Upgrade(w, r, h.maxMessageSize)
+	if err != nil {
+		h.sessionManager.Delete(sess.ID)
+		log.Debug().Err(err).Str("remote_addr", r.RemoteAddr).Msg("WebSocket upgrade failed")
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return
+	}
+
+	h.track(conn)
+	defer h.untrack(conn)
+	defer h.sessionManager.Delete(sess.ID)
+
+	log.Info().
+		Str("session_id", sess.ID).
+		Str("remote_addr", r.RemoteAddr).
+		Msg("WebSocket connection established")
+
+	// Deliver messages pushed to the session and keep the connection alive
+	readDone := make(chan struct{})
+	defer close(readDone)
+	go h.writeLoop(conn, sess, readDone)
+
+	ctx := sess.Context()
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Debug().Err(err).Str("session_id", sess.ID).Msg("WebSocket read error")
+			}
+			log.Info().
+				Str("session_id", sess.ID).
+				Int("request_count", sess.GetRequestCount()).
+				Msg("WebSocket client disconnected")
+			conn.Close(closeNormal)
+			return
+		}
+
+		// Validate JSON
+		if !json.Valid(msg) {
+			h.sendError(conn, -32700, "Invalid JSON")
+			continue
+		}
+
+		// Increment request count
+		sess.IncrementRequestCount()
+
+		log.Debug().
+			Str("session_id", sess.ID).
+			Int("body_size", len(msg)).
+			Int("request_count", sess.GetRequestCount()).
+			Msg("Received MCP message")
+
+		// Process message through handler
+		var response []byte
+		if h.messageHandler != nil {
+			response, err = h.messageHandler(ctx, sess, msg)
+			if err != nil {
+				// Log full error internally but return sanitized message to client
+				log.Error().Err(err).Str("session_id", sess.ID).Msg("Message handler error")
+				h.sendError(conn, -32603, "Internal server error")
+				continue
+			}
+		} else {
+			// No handler configured - echo back for testing
+			response = msg
+		}
+
+		if response != nil {
+			if err := conn.WriteMessage(response); err != nil {
+				log.Debug().Err(err).Str("session_id", sess.ID).Msg("Failed to write WebSocket response")
+			}
+		}
+	}
+}
+
+// writeLoop forwards session messages and sends periodic pings until the
+// read loop exits or the session is closed.
+func (h *Handler) writeLoop(conn *Conn, sess *session.Session, readDone <-chan struct{}) {
+	// Heartbeat ticker (nil channel blocks forever when disabled)
+	var heartbeat <-chan time.Time
+	if h.heartbeatInterval > 0 {
+		ticker := time.NewTicker(h.heartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-readDone:
+			return
+
+		case <-sess.Done:
+			// Session was closed externally
+			conn.Close(closeGoingAway)
+			return
+
+		case msg := <-sess.MessageChan:
+			if err := conn.WriteMessage(msg); err != nil {
+				log.Debug().Err(err).Str("session_id", sess.ID).Msg("Failed to write WebSocket message")
+			}
+
+		case <-heartbeat:
+			if err := conn.Ping(); err != nil {
+				log.Debug().Err(err).Str("session_id", sess.ID).Msg("Failed to send WebSocket ping")
+			}
+		}
+	}
+}
+
+// sendError writes a JSON-RPC error response to the socket.
+func (h *Handler) sendError(conn *Conn, code int, message string) {
+	if err := conn.WriteMessage(errorResponse(code, message)); err != nil {
+		log.Debug().Err(err).Msg("Failed to write WebSocket error")
+	}
+}
+
+// errorResponse builds a JSON-RPC error response with a null id.
+func errorResponse(code int, message string) []byte {
+	response := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	}
+
+	data, _ := json.Marshal(response)
+	return data
+}
+
+// track registers an open connection.
+func (h *Handler) track(conn *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[conn] = struct{}{}
+}
+
+// untrack removes a closed connection.
+func (h *Handler) untrack(conn *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, conn)
+}
+
+// CloseAll closes every open connection. Hijacked connections are not
+// closed by http.Server.Shutdown, so the server calls this on stop.
+func (h *Handler) CloseAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.conns {
+		conn.Close(closeGoingAway)
+	}
+}
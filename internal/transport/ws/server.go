@@ -0,0 +1,134 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
+	"github.com/rs/zerolog/log"
+)
+
+// Server implements the WebSocket transport for MCP.
+type Server struct {
+	cfg            config.ServerConfig
+	agentCfg       config.AgentConfig
+	sessionManager *session.Manager
+	httpServer     *http.Server
+	handler        *Handler
+
+	// Lifecycle
+	mu      sync.RWMutex
+	started bool
+}
+
+// NewServer creates a new WebSocket transport server.
+func NewServer(cfg config.ServerConfig, agentCfg config.AgentConfig, sessionMgr *session.Manager) *Server {
+	s := &Server{
+		cfg:            cfg,
+		agentCfg:       agentCfg,
+		sessionManager: sessionMgr,
+		handler:        NewHandlerWithSecurity(sessionMgr, agentCfg, cfg.Security),
+	}
+
+	s.handler.SetHeartbeatInterval(cfg.HeartbeatInterval)
+	s.handler.SetAuthenticator(transport.NewAuthenticator(cfg.Auth))
+	if cfg.MaxRequestBytes > 0 {
+		s.handler.SetMaxMessageSize(int(cfg.MaxRequestBytes))
+	}
+
+	return s
+}
+
+// SetMessageHandler sets the callback for processing incoming messages.
+func (s *Server) SetMessageHandler(h MessageHandler) {
+	s.handler.SetMessageHandler(h)
+}
+
+// SetCORSAllowedOrigins replaces the allowed CORS origins at runtime.
+func (s *Server) SetCORSAllowedOrigins(origins []string) {
+	s.handler.SetCORSAllowedOrigins(origins)
+}
+
+// Start begins accepting WebSocket connections.
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return fmt.Errorf("server already started")
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	// Create HTTP mux
+	mux := http.NewServeMux()
+
+	// WebSocket endpoint - upgrades and carries all MCP messages
+	mux.HandleFunc("GET /", s.handler.HandleWebSocket)
+
+	// Create HTTP server
+	addr := fmt.Sprintf("%s:%d", s.cfg.Listen.Address, s.cfg.Listen.Port)
+	s.httpServer = &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		ReadTimeout: s.cfg.ReadTimeout,
+		IdleTimeout: s.cfg.IdleTimeout,
+		BaseContext: func(l net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	// Start listening
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	log.Info().
+		Str("address", addr).
+		Str("transport", "websocket").
+		Msg("WebSocket server listening")
+
+	// Start serving in goroutine
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("WebSocket server error")
+		}
+	}()
+
+	return nil
+}
+
+// Stop gracefully shuts down the server.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return nil
+	}
+	s.started = false
+	s.mu.Unlock()
+
+	log.Info().Msg("Shutting down WebSocket server...")
+
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			return fmt.Errorf("server shutdown error: %w", err)
+		}
+	}
+
+	// Shutdown does not track hijacked connections
+	s.handler.CloseAll()
+
+	log.Info().Msg("WebSocket server stopped")
+	return nil
+}
+
+// Name returns the transport name.
+func (s *Server) Name() string {
+	return "websocket"
+}
@@ -0,0 +1,256 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+)
+
+// testClient is a minimal WebSocket client for exercising the handler.
+type testClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+	resp *http.Response
+}
+
+func dial(t *testing.T, serverURL string, header http.Header) *testClient {
+	t.Helper()
+
+	addr := strings.TrimPrefix(serverURL, "http://")
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest("GET", serverURL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Failed to write handshake: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+
+	return &testClient{conn: conn, br: br, resp: resp}
+}
+
+// writeFrame writes a masked frame as a client must.
+func (c *testClient) writeFrame(t *testing.T, opcode byte, payload []byte) {
+	t.Helper()
+
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+// readFrame reads an unmasked server frame.
+func (c *testClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+
+	return header[0] & 0x0F, payload
+}
+
+func newTestHandler(t *testing.T, securityCfg config.SecurityConfig) (*Handler, *httptest.Server) {
+	t.Helper()
+
+	sm := session.NewManager(session.ManagerConfig{
+		SessionTTL:      time.Hour,
+		CleanupInterval: time.Minute,
+		MaxSessions:     100,
+	})
+	sm.Start(context.Background())
+	t.Cleanup(sm.Stop)
+
+	handler := NewHandlerWithSecurity(sm, config.AgentConfig{ID: "test-agent"}, securityCfg)
+	ts := httptest.NewServer(http.HandlerFunc(handler.HandleWebSocket))
+	t.Cleanup(func() {
+		handler.CloseAll()
+		ts.Close()
+	})
+
+	return handler, ts
+}
+
+// TestAcceptKey tests the handshake accept key against the RFC 6455 example.
+func TestAcceptKey(t *testing.T) {
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("acceptKey() = %s", got)
+	}
+}
+
+// TestWebSocketMessage tests request/response over a WebSocket connection.
+func TestWebSocketMessage(t *testing.T) {
+	handler, ts := newTestHandler(t, config.SecurityConfig{EnableSecurityHeaders: true})
+
+	handler.SetMessageHandler(func(ctx context.Context, sess *session.Session, msg []byte) ([]byte, error) {
+		var req map[string]interface{}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req["id"],
+			"result":  sess.AgentID,
+		})
+	})
+
+	client := dial(t, ts.URL, nil)
+	defer client.conn.Close()
+
+	if client.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", client.resp.StatusCode)
+	}
+	if got := client.resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected Sec-WebSocket-Accept: %s", got)
+	}
+	if client.resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("Expected security headers on handshake response")
+	}
+
+	client.writeFrame(t, opText, []byte(`{"jsonrpc":"2.0","id":1,"method":"test"}`))
+
+	opcode, payload := client.readFrame(t)
+	if opcode != opText {
+		t.Fatalf("Expected text frame, got opcode %d", opcode)
+	}
+	if string(payload) != `{"id":1,"jsonrpc":"2.0","result":"test-agent"}` {
+		t.Errorf("Unexpected response: %s", payload)
+	}
+}
+
+// TestWebSocketInvalidJSON tests that malformed messages get a parse error.
+func TestWebSocketInvalidJSON(t *testing.T) {
+	_, ts := newTestHandler(t, config.SecurityConfig{})
+
+	client := dial(t, ts.URL, nil)
+	defer client.conn.Close()
+
+	client.writeFrame(t, opText, []byte(`{not json`))
+
+	_, payload := client.readFrame(t)
+	if !strings.Contains(string(payload), "-32700") {
+		t.Errorf("Expected parse error, got %s", payload)
+	}
+}
+
+// TestWebSocketControlFrames tests ping/pong and close handling.
+func TestWebSocketControlFrames(t *testing.T) {
+	_, ts := newTestHandler(t, config.SecurityConfig{})
+
+	client := dial(t, ts.URL, nil)
+	defer client.conn.Close()
+
+	client.writeFrame(t, opPing, []byte("hi"))
+	opcode, payload := client.readFrame(t)
+	if opcode != opPong || string(payload) != "hi" {
+		t.Errorf("Expected pong with payload, got opcode %d payload %q", opcode, payload)
+	}
+
+	client.writeFrame(t, opClose, binary.BigEndian.AppendUint16(nil, closeNormal))
+	opcode, _ = client.readFrame(t)
+	if opcode != opClose {
+		t.Errorf("Expected close frame, got opcode %d", opcode)
+	}
+}
+
+// TestWebSocketOrigin tests origin checks.
+func TestWebSocketOrigin(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowedOrigins []string
+		origin         string
+		expectedStatus int
+	}{
+		{"no origin", nil, "", http.StatusSwitchingProtocols},
+		{"disallowed origin", nil, "https://evil.example", http.StatusForbidden},
+		{"allowed origin", []string{"https://app.example"}, "https://app.example", http.StatusSwitchingProtocols},
+		{"wildcard", []string{"*"}, "https://any.example", http.StatusSwitchingProtocols},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ts := newTestHandler(t, config.SecurityConfig{CORSAllowedOrigins: tt.allowedOrigins})
+
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+
+			client := dial(t, ts.URL, header)
+			defer client.conn.Close()
+
+			if client.resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, client.resp.StatusCode)
+			}
+		})
+	}
+}
+
+// TestServerName tests transport name.
+func TestServerName(t *testing.T) {
+	server := NewServer(config.ServerConfig{}, config.AgentConfig{}, session.NewManager(session.DefaultManagerConfig()))
+	if server.Name() != "websocket" {
+		t.Errorf("Expected name websocket, got %s", server.Name())
+	}
+}
@@ -0,0 +1,186 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker.Allow while the circuit is
+// open.
+var ErrCircuitOpen = errors.New("upstream circuit open")
+
+// CircuitState is the state of a CircuitBreaker. The values are those of the
+// upstream_circuit_state gauge.
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // Requests are sent
+	CircuitHalfOpen                     // One trial request is sent
+	CircuitOpen                         // Requests fail with ErrCircuitOpen
+)
+
+// String returns the state's name.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops requests reaching an upstream that keeps failing.
+// After cfg.Threshold consecutive failures the circuit opens and requests
+// fail fast. Once cfg.Timeout has passed it is half-open: one trial request
+// is let through, and closes the circuit if it succeeds or opens it again
+// if it fails. JSON-RPC error responses are not failures; only sends that
+// return an error are.
+//
+// Each state change starts a new generation. Allow returns the current one,
+// and outcomes recorded for an older generation are ignored, so a request
+// sent while closed that finishes during a trial doesn't decide it.
+type CircuitBreaker struct {
+	threshold int
+	timeout   time.Duration
+	now       func() time.Time
+
+	mu         sync.Mutex
+	state      CircuitState
+	generation uint64 // Incremented on every state change
+	failures   int
+	openedAt   time.Time
+	trial      bool // A half-open trial request is in flight
+}
+
+// NewCircuitBreaker creates a closed circuit breaker.
+func NewCircuitBreaker(cfg config.CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: cfg.Threshold,
+		timeout:   cfg.Timeout,
+		now:       time.Now,
+	}
+}
+
+// State returns the current state. An open circuit whose timeout has passed
+// is reported half-open, since the next request is its trial.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+// currentState returns the state, moving an open circuit to half-open once
+// its timeout has passed. Callers must hold mu.
+func (b *CircuitBreaker) currentState() CircuitState {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.timeout {
+		b.setState(CircuitHalfOpen)
+	}
+	return b.state
+}
+
+// Allow reports whether a request may be sent, returning ErrCircuitOpen if
+// not. An allowed request gets the current generation, which must be passed
+// to Record with its outcome.
+func (b *CircuitBreaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case CircuitOpen:
+		return 0, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.trial {
+			return 0, ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return b.generation, nil
+}
+
+// Record records the outcome of a request allowed by Allow in generation.
+// Outcomes from an earlier generation are ignored. Requests cancelled by the
+// caller count as neither success nor failure.
+func (b *CircuitBreaker) Record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	if errors.Is(err, context.Canceled) {
+		if b.state == CircuitHalfOpen {
+			b.trial = false
+		}
+		return
+	}
+
+	switch b.state {
+	case CircuitClosed:
+		if err == nil {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	case CircuitHalfOpen:
+		b.trial = false
+		if err == nil {
+			b.failures = 0
+			b.setState(CircuitClosed)
+			return
+		}
+		b.open()
+	}
+}
+
+// Send sends message to u unless the circuit is open, recording the
+// outcome. A nil breaker sends every message.
+func (b *CircuitBreaker) Send(ctx context.Context, u Upstream, message []byte) ([]byte, error) {
+	if b == nil {
+		return u.Send(ctx, message)
+	}
+	generation, err := b.Allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.Send(ctx, message)
+	b.Record(generation, err)
+	return resp, err
+}
+
+// open opens the circuit. Callers must hold mu.
+func (b *CircuitBreaker) open() {
+	b.failures = 0
+	b.openedAt = b.now()
+	b.setState(CircuitOpen)
+}
+
+// setState changes the state, logging the transition. Callers must hold mu.
+func (b *CircuitBreaker) setState(state CircuitState) {
+	if state == b.state {
+		return
+	}
+	event := log.Info()
+	if state == CircuitOpen {
+		event = log.Warn()
+	}
+	event.
+		Str("from", b.state.String()).
+		Str("to", state.String()).
+		Msg("Upstream circuit breaker state changed")
+	b.state = state
+	b.generation++
+	b.trial = false
+}
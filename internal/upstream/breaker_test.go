@@ -0,0 +1,82 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// TestCircuitBreaker tests that the breaker opens after the threshold, lets
+// one trial through once the timeout passes, and closes or reopens on its
+// outcome alone.
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreaker(config.CircuitBreakerConfig{Enabled: true, Threshold: 2, Timeout: 30 * time.Second})
+	b.now = func() time.Time { return now }
+	errUpstream := errors.New("connection refused")
+
+	expect := func(want CircuitState) {
+		t.Helper()
+		if got := b.State(); got != want {
+			t.Fatalf("State() = %s, want %s", got, want)
+		}
+	}
+	allow := func() uint64 {
+		t.Helper()
+		generation, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		return generation
+	}
+	send := func(err error) {
+		t.Helper()
+		b.Record(allow(), err)
+	}
+
+	// A success resets the consecutive failure count
+	send(errUpstream)
+	send(nil)
+	send(errUpstream)
+	expect(CircuitClosed)
+
+	// Caller cancellations don't count
+	send(context.Canceled)
+	expect(CircuitClosed)
+
+	// A request sent while closed is still in flight when the circuit opens
+	stale := allow()
+	send(errUpstream)
+	expect(CircuitOpen)
+	if _, err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() while open error = %v, want ErrCircuitOpen", err)
+	}
+
+	// After the timeout only one trial is let through; its failure reopens
+	now = now.Add(30 * time.Second)
+	expect(CircuitHalfOpen)
+	trial := allow()
+	if _, err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() during trial error = %v, want ErrCircuitOpen", err)
+	}
+
+	// The stale request finishing doesn't decide the trial or end it
+	b.Record(stale, nil)
+	expect(CircuitHalfOpen)
+	if _, err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow() after stale outcome error = %v, want ErrCircuitOpen", err)
+	}
+
+	b.Record(trial, errUpstream)
+	expect(CircuitOpen)
+
+	// A successful trial closes the circuit
+	now = now.Add(30 * time.Second)
+	send(nil)
+	expect(CircuitClosed)
+	send(errUpstream)
+	expect(CircuitClosed)
+}
@@ -5,14 +5,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
 	"github.com/rs/zerolog/log"
 )
 
@@ -22,15 +29,30 @@ type Client struct {
 	httpClient *http.Client
 
 	// Connection state
-	mu           sync.RWMutex
-	connected    bool
-	messageURL   string
-	sseConn      *http.Response
-	responseChan chan *Response
-
-	// Pending requests waiting for responses
+	mu            sync.RWMutex
+	connected     bool
+	messageURL    string
+	endpointErr   error         // Why the endpoint event was rejected, if it was
+	endpointReady chan struct{} // Closed once messageURL or endpointErr is known
+	sseConn       *http.Response
+
+	// Pending requests waiting for responses, keyed by proxy-assigned ID,
+	// and their proxy-assigned IDs by session and client ID
 	pending   map[interface{}]chan *Response
+	inflight  map[string]string
 	pendingMu sync.RWMutex
+	nextID    atomic.Uint64
+
+	// Response buffering per pending request; responses that don't fit are
+	// dropped and reported to onDropped
+	responseBuffer int
+	onDropped      func()
+
+	// Server-initiated notifications
+	onNotification NotificationHandler
+
+	// Session setup sent through the client, replayed when it reconnects
+	hs handshake
 
 	// Lifecycle
 	done   chan struct{}
@@ -47,29 +69,79 @@ type Response struct {
 
 // NewClient creates a new upstream client.
 func NewClient(cfg config.UpstreamConfig) *Client {
-	return &Client{
-		cfg: cfg,
-		httpClient: &http.Client{
-			Timeout: cfg.Timeout,
-			Transport: &http.Transport{
-				MaxIdleConns:        cfg.ConnectionPool.MaxIdle,
-				MaxIdleConnsPerHost: cfg.ConnectionPool.MaxIdle,
-				IdleConnTimeout:     cfg.ConnectionPool.IdleTimeout,
-			},
+	c := &Client{
+		cfg:           cfg,
+		httpClient:    newHTTPClient(cfg),
+		pending:       make(map[interface{}]chan *Response),
+		inflight:      make(map[string]string),
+		endpointReady: make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	c.responseBuffer = responseBuffering(cfg.ResponseBuffer)
+	return c
+}
+
+// newHTTPClient creates an HTTP client using the upstream connection pool settings.
+func newHTTPClient(cfg config.UpstreamConfig) *http.Client {
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        cfg.ConnectionPool.MaxIdle,
+			MaxIdleConnsPerHost: cfg.ConnectionPool.MaxIdle,
+			IdleConnTimeout:     cfg.ConnectionPool.IdleTimeout,
 		},
-		pending:      make(map[interface{}]chan *Response),
-		responseChan: make(chan *Response, 100),
-		done:         make(chan struct{}),
 	}
 }
 
-// Connect establishes an SSE connection to the upstream server.
+// setHeaders applies the configured headers, such as credentials, and the
+// request ID carried by its context to an outgoing request. Protocol headers
+// set afterwards take precedence.
+func setHeaders(req *http.Request, cfg config.UpstreamConfig) {
+	for name, value := range cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	if id := transport.RequestIDFromContext(req.Context()); id != "" {
+		req.Header.Set(transport.RequestIDHeader, id)
+	}
+}
+
+// SetNotificationHandler sets the handler for notifications the upstream
+// pushes over the SSE stream.
+func (c *Client) SetNotificationHandler(h NotificationHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onNotification = h
+}
+
+// SetOnResponseDropped sets a callback invoked for each response dropped
+// because its request's buffer was full. Call it before Connect.
+func (c *Client) SetOnResponseDropped(fn func()) {
+	c.onDropped = fn
+}
+
+// Connect establishes an SSE connection to the upstream server. On a
+// reconnect, the handshake and subscriptions sent on the earlier connection
+// are replayed, since the server sees the new stream as a new client.
 func (c *Client) Connect(ctx context.Context) error {
 	c.mu.Lock()
 	if c.connected {
 		c.mu.Unlock()
 		return nil
 	}
+	// Reset state left by an earlier connection; the new stream announces
+	// its own endpoint
+	select {
+	case <-c.done:
+		c.done = make(chan struct{})
+	default:
+	}
+	select {
+	case <-c.endpointReady:
+		c.endpointReady = make(chan struct{})
+		c.messageURL = ""
+		c.endpointErr = nil
+	default:
+	}
 	c.mu.Unlock()
 
 	c.ctx, c.cancel = context.WithCancel(ctx)
@@ -80,6 +152,7 @@ func (c *Client) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to create SSE request: %w", err)
 	}
 
+	setHeaders(req, c.cfg)
 	req.Header.Set("Accept", "text/event-stream")
 	req.Header.Set("Cache-Control", "no-cache")
 
@@ -102,11 +175,11 @@ func (c *Client) Connect(ctx context.Context) error {
 	c.mu.Unlock()
 
 	// Start reading SSE events
-	go c.readEvents()
+	go c.readEvents(c.ctx)
 
 	log.Info().Str("url", c.cfg.URL).Msg("Connected to upstream MCP server")
 
-	return nil
+	return c.hs.replay(ctx, c)
 }
 
 // Disconnect closes the upstream connection.
@@ -135,53 +208,49 @@ func (c *Client) Disconnect() {
 
 // Send sends a message to the upstream server and waits for a response.
 func (c *Client) Send(ctx context.Context, message []byte) ([]byte, error) {
-	c.mu.RLock()
-	if !c.connected {
-		c.mu.RUnlock()
+	if !c.IsConnected() {
 		return nil, fmt.Errorf("not connected to upstream")
 	}
-	messageURL := c.messageURL
-	c.mu.RUnlock()
-
-	if messageURL == "" {
-		return nil, fmt.Errorf("upstream message URL not yet received")
+	messageURL, err := c.waitForEndpoint(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract request ID for response matching
-	var parsed map[string]interface{}
-	if err := json.Unmarshal(message, &parsed); err != nil {
+	// Replace the request ID with a proxy-unique one so that requests from
+	// different sessions using the same ID can't collide on the shared stream
+	var req rpcRequest
+	if err := json.Unmarshal(message, &req); err != nil {
 		return nil, fmt.Errorf("invalid JSON message: %w", err)
 	}
-	requestID := parsed["id"]
+	originalID := req.ID
+	requestID := "proxy-" + strconv.FormatUint(c.nextID.Add(1), 10)
+	req.ID = json.RawMessage(strconv.Quote(requestID))
+	if message, err = json.Marshal(req); err != nil {
+		return nil, fmt.Errorf("failed to rewrite request ID: %w", err)
+	}
+	method := req.Method
 
-	// Create response channel for this request
-	respChan := make(chan *Response, 1)
+	// Create response channel for this request. Registered once up front so
+	// retried POSTs share the same channel.
+	respChan := make(chan *Response, c.responseBuffer)
+	key := inflightKey(ctx, originalID)
 	c.pendingMu.Lock()
 	c.pending[requestID] = respChan
+	c.inflight[key] = requestID
 	c.pendingMu.Unlock()
 
 	defer func() {
 		c.pendingMu.Lock()
 		delete(c.pending, requestID)
+		if c.inflight[key] == requestID {
+			delete(c.inflight, key)
+		}
 		c.pendingMu.Unlock()
 	}()
 
 	// Send message to upstream
-	req, err := http.NewRequestWithContext(ctx, "POST", messageURL, bytes.NewReader(message))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send to upstream: %w", err)
-	}
-	resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		return nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	if err := c.postWithRetry(ctx, messageURL, message, method); err != nil {
+		return nil, err
 	}
 
 	// Wait for response via SSE
@@ -192,94 +261,356 @@ func (c *Client) Send(ctx context.Context, message []byte) ([]byte, error) {
 		if response.Error != nil {
 			return nil, response.Error
 		}
-		return response.Data, nil
+		c.hs.record(message, response.Data)
+		return restoreID(response.Data, originalID)
 	case <-time.After(c.cfg.Timeout):
 		return nil, fmt.Errorf("timeout waiting for upstream response")
 	}
 }
 
-// SendAsync sends a message without waiting for a response.
+// methodCancelled is the notification a client sends to cancel one of its
+// requests, identified by params.requestId.
+const methodCancelled = "notifications/cancelled"
+
+// inflightKey identifies a client request by the calling session and the
+// client's request ID.
+func inflightKey(ctx context.Context, id json.RawMessage) string {
+	var sessionID string
+	if sess := session.FromContext(ctx); sess != nil {
+		sessionID = sess.ID
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, id); err != nil {
+		compact.Reset()
+		compact.Write(id)
+	}
+	return sessionID + "\x00" + compact.String()
+}
+
+// rewriteCancelled replaces the requestId of a notifications/cancelled with
+// the proxy-assigned ID of the request it cancels. It reports false if that
+// request is not pending.
+func (c *Client) rewriteCancelled(ctx context.Context, message []byte) ([]byte, bool) {
+	var notification struct {
+		JSONRPC string                     `json:"jsonrpc"`
+		Method  string                     `json:"method"`
+		Params  map[string]json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(message, &notification); err != nil || notification.Params["requestId"] == nil {
+		return nil, false
+	}
+
+	c.pendingMu.RLock()
+	requestID, ok := c.inflight[inflightKey(ctx, notification.Params["requestId"])]
+	c.pendingMu.RUnlock()
+	if !ok {
+		log.Debug().Msg("Dropping cancellation of a request that is not pending")
+		return nil, false
+	}
+
+	notification.Params["requestId"] = json.RawMessage(strconv.Quote(requestID))
+	rewritten, err := json.Marshal(notification)
+	if err != nil {
+		return nil, false
+	}
+	return rewritten, true
+}
+
+// rpcRequest is a JSON-RPC request whose ID is rewritten by Send.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC response whose ID is restored by Send.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+// restoreID replaces the proxy-assigned ID on an upstream response with the
+// client's original ID, which may be a string, a number or null.
+func restoreID(data []byte, id json.RawMessage) ([]byte, error) {
+	var resp rpcResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid upstream response: %w", err)
+	}
+	resp.ID = id
+	return json.Marshal(resp)
+}
+
+// SendAsync sends a message without waiting for a response. The request a
+// notifications/cancelled refers to is looked up among the calling
+// session's pending requests and given its proxy-assigned ID; if it is no
+// longer pending, the notification is dropped.
 func (c *Client) SendAsync(ctx context.Context, message []byte) error {
-	c.mu.RLock()
-	if !c.connected {
-		c.mu.RUnlock()
+	if !c.IsConnected() {
 		return fmt.Errorf("not connected to upstream")
 	}
-	messageURL := c.messageURL
+	messageURL, err := c.waitForEndpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	var parsed struct {
+		Method string `json:"method"`
+	}
+	_ = json.Unmarshal(message, &parsed)
+
+	if parsed.Method == methodCancelled {
+		var ok bool
+		if message, ok = c.rewriteCancelled(ctx, message); !ok {
+			return nil
+		}
+	}
+
+	if err := c.postWithRetry(ctx, messageURL, message, parsed.Method); err != nil {
+		return err
+	}
+	c.hs.record(message, nil)
+	return nil
+}
+
+// waitForEndpoint returns the upstream message URL, waiting for the endpoint
+// event if the connection has not received it yet.
+func (c *Client) waitForEndpoint(ctx context.Context) (string, error) {
+	c.mu.RLock()
+	ready, done := c.endpointReady, c.done
 	c.mu.RUnlock()
 
-	if messageURL == "" {
-		return fmt.Errorf("upstream message URL not yet received")
+	select {
+	case <-ready:
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.messageURL, c.endpointErr
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-done:
+		return "", fmt.Errorf("not connected to upstream")
+	case <-time.After(c.cfg.Timeout):
+		return "", fmt.Errorf("upstream message URL not yet received")
+	}
+}
+
+// idempotentMethod reports whether method is safe to send twice: the list
+// methods, resources/read and ping. Other methods, such as tools/call, may
+// have side effects and are only retried when the request provably never
+// left the proxy.
+func idempotentMethod(method string) bool {
+	return strings.HasSuffix(method, "/list") || method == "resources/read" || method == "ping"
+}
+
+// postWithRetry POSTs a message to the upstream message endpoint when
+// retries are enabled, retrying connection errors and, for idempotent
+// methods, failed sends and 5xx responses.
+func (c *Client) postWithRetry(ctx context.Context, messageURL string, message []byte, method string) error {
+	attempts := 1
+	if c.cfg.Retry.Enabled && c.cfg.Retry.MaxAttempts > 1 {
+		attempts = c.cfg.Retry.MaxAttempts
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			delay := c.retryDelay(attempt - 1)
+			log.Debug().
+				Err(lastErr).
+				Str("method", method).
+				Int("attempt", attempt).
+				Dur("delay", delay).
+				Msg("Retrying upstream request")
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		retryable, err := c.post(ctx, messageURL, message, method)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
 	}
 
+	return lastErr
+}
+
+// post performs a single POST and reports whether a failure may be retried.
+func (c *Client) post(ctx context.Context, messageURL string, message []byte, method string) (bool, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", messageURL, bytes.NewReader(message))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return false, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	setHeaders(req, c.cfg)
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send to upstream: %w", err)
+		if ctx.Err() != nil {
+			return false, fmt.Errorf("failed to send to upstream: %w", err)
+		}
+		// The server may have received the message - only retry if the
+		// method is safe to repeat or the connection was never established.
+		return idempotentMethod(method) || isDialError(err), fmt.Errorf("failed to send to upstream: %w", err)
 	}
 	resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		// The server received the message and may have acted on it
+		return idempotentMethod(method), fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("upstream returned status %d", resp.StatusCode)
+		return false, fmt.Errorf("upstream returned status %d", resp.StatusCode)
 	}
 
-	return nil
+	return false, nil
+}
+
+// retryDelay returns the backoff delay before the given retry (1-based).
+func (c *Client) retryDelay(retry int) time.Duration {
+	delay := c.cfg.Retry.InitialDelay
+
+	switch c.cfg.Retry.Backoff {
+	case "constant":
+		// delay stays at InitialDelay
+	case "linear":
+		delay = c.cfg.Retry.InitialDelay * time.Duration(retry)
+	default: // exponential
+		delay = c.cfg.Retry.InitialDelay << (retry - 1)
+	}
+
+	if c.cfg.Retry.MaxDelay > 0 && (delay > c.cfg.Retry.MaxDelay || delay <= 0) {
+		delay = c.cfg.Retry.MaxDelay
+	}
+	return delay
 }
 
-// readEvents reads SSE events from the upstream connection.
-func (c *Client) readEvents() {
+// isDialError reports whether err occurred while establishing the connection.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// readEvents reads SSE events from the upstream connection until it ends,
+// the client disconnects, or ctx is cancelled.
+func (c *Client) readEvents(ctx context.Context) {
 	c.mu.RLock()
-	conn := c.sseConn
+	conn, done := c.sseConn, c.done
 	c.mu.RUnlock()
 
 	if conn == nil {
 		return
 	}
 
+	// Close the stream once ctx ends, so a read waiting for the next line
+	// returns at once instead of when the upstream next sends something
+	stop := context.AfterFunc(ctx, func() { conn.Body.Close() })
+	defer stop()
+
 	reader := bufio.NewReader(conn.Body)
-	var event, data string
+	var event string
+	var data []string // One entry per data line; an event may span several
 
 	for {
 		select {
-		case <-c.done:
+		case <-done:
 			return
 		default:
 		}
 
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			if err != io.EOF {
+			if err != io.EOF && ctx.Err() == nil {
 				log.Error().Err(err).Msg("Error reading from upstream SSE")
 			}
-			c.handleDisconnect()
+			c.handleDisconnect(conn)
 			return
 		}
 
-		line = strings.TrimSpace(line)
+		line = strings.TrimRight(line, "\r\n")
 
-		// Empty line marks end of event
+		// Empty line marks end of event; its data lines are joined with
+		// newlines as the SSE spec requires
 		if line == "" {
-			if event != "" || data != "" {
-				c.handleEvent(event, data)
+			if event != "" || len(data) > 0 {
+				c.handleEvent(event, strings.Join(data, "\n"))
 				event = ""
-				data = ""
+				data = data[:0]
 			}
 			continue
 		}
 
 		// Parse SSE fields
-		if strings.HasPrefix(line, "event:") {
-			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
-		} else if strings.HasPrefix(line, "data:") {
-			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		switch field, value := parseSSELine(line); field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
+
+// resolveEndpoint returns the message URL announced by an endpoint event.
+// Messages carry the configured credential headers, so an absolute URL must
+// have the configured URL's scheme, host and port.
+func (c *Client) resolveEndpoint(endpoint string) (string, error) {
+	// Convert an absolute path to a URL under the upstream URL; "//" starts
+	// a URL with a host
+	if strings.HasPrefix(endpoint, "/") && !strings.HasPrefix(endpoint, "//") {
+		return strings.TrimSuffix(c.cfg.URL, "/") + endpoint, nil
+	}
+
+	base, err := url.Parse(c.cfg.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid upstream URL: %w", err)
+	}
+	ref, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid message endpoint %q: %w", endpoint, err)
+	}
+	resolved := base.ResolveReference(ref)
+	if !sameOrigin(base, resolved) {
+		return "", fmt.Errorf("message endpoint %s is not on the upstream's origin %s://%s", resolved.Redacted(), base.Scheme, base.Host)
+	}
+	return resolved.String(), nil
+}
+
+// sameOrigin reports whether a and b have the same scheme, host and port,
+// filling in the scheme's default port where it is omitted.
+func sameOrigin(a, b *url.URL) bool {
+	port := func(u *url.URL) string {
+		if p := u.Port(); p != "" {
+			return p
 		}
+		switch strings.ToLower(u.Scheme) {
+		case "https":
+			return "443"
+		case "http":
+			return "80"
+		}
+		return ""
 	}
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		port(a) == port(b)
+}
+
+// parseSSELine splits an SSE line, without its line ending, into field name
+// and value. As the SSE spec requires, only a single space after the colon
+// is removed; the rest of the value is kept as sent.
+func parseSSELine(line string) (field, value string) {
+	field, value, _ = strings.Cut(line, ":")
+	return field, strings.TrimPrefix(value, " ")
 }
 
 // handleEvent processes a received SSE event.
@@ -287,16 +618,20 @@ func (c *Client) handleEvent(event, data string) {
 	switch event {
 	case "endpoint":
 		// Store the message URL
+		messageURL, err := c.resolveEndpoint(data)
 		c.mu.Lock()
-		// Convert relative URL to absolute
-		if strings.HasPrefix(data, "/") {
-			// Parse base URL and append path
-			c.messageURL = strings.TrimSuffix(c.cfg.URL, "/") + data
-		} else {
-			c.messageURL = data
+		c.messageURL, c.endpointErr = messageURL, err
+		select {
+		case <-c.endpointReady:
+		default:
+			close(c.endpointReady)
 		}
 		c.mu.Unlock()
-		log.Debug().Str("message_url", c.messageURL).Msg("Received upstream message endpoint")
+		if err != nil {
+			log.Error().Err(err).Msg("Rejected upstream message endpoint")
+			return
+		}
+		log.Debug().Str("message_url", messageURL).Msg("Received upstream message endpoint")
 
 	case "message":
 		// Parse response to find matching request
@@ -306,16 +641,29 @@ func (c *Client) handleEvent(event, data string) {
 			return
 		}
 
+		if isNotification(parsed) {
+			c.mu.RLock()
+			onNotification := c.onNotification
+			c.mu.RUnlock()
+			if onNotification != nil {
+				onNotification([]byte(data))
+			} else {
+				log.Debug().Interface("method", parsed["method"]).Msg("Received upstream notification")
+			}
+			return
+		}
+
 		requestID := parsed["id"]
 		c.pendingMu.RLock()
 		respChan, ok := c.pending[requestID]
 		c.pendingMu.RUnlock()
 
 		if ok {
-			select {
-			case respChan <- &Response{Data: []byte(data)}:
-			default:
-				log.Warn().Interface("id", requestID).Msg("Response channel full")
+			if !deliverResponse(respChan, &Response{Data: []byte(data)}) {
+				log.Warn().Interface("id", requestID).Msg("Response channel full, response dropped")
+				if c.onDropped != nil {
+					c.onDropped()
+				}
 			}
 		} else {
 			log.Debug().Interface("id", requestID).Msg("Received response for unknown request")
@@ -330,9 +678,14 @@ func (c *Client) handleEvent(event, data string) {
 	}
 }
 
-// handleDisconnect handles upstream disconnection.
-func (c *Client) handleDisconnect() {
+// handleDisconnect handles the loss of the stream conn. It does nothing if
+// the client has since reconnected on a new stream.
+func (c *Client) handleDisconnect(conn *http.Response) {
 	c.mu.Lock()
+	if c.sseConn != conn {
+		c.mu.Unlock()
+		return
+	}
 	wasConnected := c.connected
 	c.connected = false
 	c.mu.Unlock()
@@ -350,8 +703,6 @@ func (c *Client) handleDisconnect() {
 			delete(c.pending, id)
 		}
 		c.pendingMu.Unlock()
-
-		// TODO: Implement reconnection logic with backoff
 	}
 }
 
@@ -0,0 +1,703 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+)
+
+// flakyUpstream is a minimal SSE MCP server whose message endpoint fails
+// a fixed number of times before accepting requests.
+type flakyUpstream struct {
+	failures int32
+	posts    atomic.Int32
+	events   chan string
+
+	// echoParams answers with the request params as the result
+	echoParams bool
+
+	// ids records the request IDs the upstream received
+	mu  sync.Mutex
+	ids []string
+
+	// methods records the method of every message, and cancelled the
+	// requestId of each notifications/cancelled
+	methods   []string
+	cancelled []string
+
+	// overlap, if set, holds responses until it is closed
+	overlap chan struct{}
+}
+
+func newFlakyUpstream(failures int32) *flakyUpstream {
+	return &flakyUpstream{
+		failures: failures,
+		events:   make(chan string, 10),
+	}
+}
+
+func (u *flakyUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /message\n\n")
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case data := <-u.events:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+				w.(http.Flusher).Flush()
+			}
+		}
+
+	case http.MethodPost:
+		if u.posts.Add(1) <= u.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		_ = json.Unmarshal(body, &req)
+
+		u.mu.Lock()
+		u.methods = append(u.methods, req.Method)
+		u.mu.Unlock()
+
+		if req.ID == nil {
+			if req.Method == methodCancelled {
+				var params struct {
+					RequestID json.RawMessage `json:"requestId"`
+				}
+				_ = json.Unmarshal(req.Params, &params)
+				u.mu.Lock()
+				u.cancelled = append(u.cancelled, string(params.RequestID))
+				u.mu.Unlock()
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		u.mu.Lock()
+		u.ids = append(u.ids, string(req.ID))
+		u.mu.Unlock()
+
+		result := "{}"
+		if u.echoParams && req.Params != nil {
+			result = string(req.Params)
+		}
+		resp := fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, result)
+		if u.overlap != nil {
+			go func() {
+				<-u.overlap
+				u.events <- resp
+			}()
+		} else {
+			u.events <- resp
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func connectClient(t *testing.T, cfg config.UpstreamConfig) *Client {
+	t.Helper()
+
+	client := NewClient(cfg)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(client.Disconnect)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for client.GetMessageURL() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for endpoint event")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return client
+}
+
+// TestSendRetry tests that failed POSTs are retried until the upstream succeeds.
+func TestSendRetry(t *testing.T) {
+	upstream := newFlakyUpstream(2)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+		Retry: config.RetryConfig{
+			Enabled:      true,
+			MaxAttempts:  3,
+			InitialDelay: time.Millisecond,
+			MaxDelay:     10 * time.Millisecond,
+			Backoff:      "exponential",
+		},
+	})
+
+	resp, err := client.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if string(resp) != `{"jsonrpc":"2.0","id":1,"result":{}}` {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	if got := upstream.posts.Load(); got != 3 {
+		t.Errorf("expected 3 POST attempts, got %d", got)
+	}
+}
+
+// TestSendRetryDisabled tests that a failed POST is not retried by default.
+func TestSendRetryDisabled(t *testing.T) {
+	upstream := newFlakyUpstream(1)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+	})
+
+	_, err := client.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	if err == nil {
+		t.Fatal("expected error without retries")
+	}
+	if got := upstream.posts.Load(); got != 1 {
+		t.Errorf("expected 1 POST attempt, got %d", got)
+	}
+}
+
+// TestSendRetryNonIdempotent tests that a tools/call the upstream answered
+// with a 5xx is not retried, since the call may already have run.
+func TestSendRetryNonIdempotent(t *testing.T) {
+	upstream := newFlakyUpstream(1)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+		Retry: config.RetryConfig{
+			Enabled:      true,
+			MaxAttempts:  3,
+			InitialDelay: time.Millisecond,
+		},
+	})
+
+	_, err := client.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_file"}}`))
+	if err == nil {
+		t.Fatal("expected error for a failed tools/call")
+	}
+	if got := upstream.posts.Load(); got != 1 {
+		t.Errorf("expected 1 POST attempt, got %d", got)
+	}
+}
+
+// TestRetryDelay tests backoff delay calculation.
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  string
+		retry    int
+		expected time.Duration
+	}{
+		{"exponential first", "exponential", 1, 100 * time.Millisecond},
+		{"exponential third", "exponential", 3, 400 * time.Millisecond},
+		{"exponential capped", "exponential", 10, time.Second},
+		{"linear", "linear", 3, 300 * time.Millisecond},
+		{"constant", "constant", 5, 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(config.UpstreamConfig{
+				Retry: config.RetryConfig{
+					InitialDelay: 100 * time.Millisecond,
+					MaxDelay:     time.Second,
+					Backoff:      tt.backoff,
+				},
+			})
+
+			if got := client.retryDelay(tt.retry); got != tt.expected {
+				t.Errorf("retryDelay(%d) = %v, expected %v", tt.retry, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestNotificationHandler tests that notifications pushed by the upstream
+// are passed to the notification handler rather than matched to requests.
+func TestNotificationHandler(t *testing.T) {
+	upstream := newFlakyUpstream(0)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+	})
+
+	notifications := make(chan string, 1)
+	client.SetNotificationHandler(func(message []byte) {
+		notifications <- string(message)
+	})
+
+	// Subscribe, then have the upstream push an update
+	if _, err := client.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"file:///notes.txt"}}`)); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	update := `{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"file:///notes.txt"}}`
+	upstream.events <- update
+
+	select {
+	case got := <-notifications:
+		if got != update {
+			t.Errorf("notification = %s, want %s", got, update)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+}
+
+// TestSendRemapsIDs tests that concurrent requests using the same ID each
+// get their own response, with the original ID restored.
+func TestSendRemapsIDs(t *testing.T) {
+	upstream := newFlakyUpstream(0)
+	upstream.echoParams = true
+	upstream.overlap = make(chan struct{})
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+	})
+
+	const sends = 2
+	results := make([]string, sends)
+	errs := make([]error, sends)
+	var wg sync.WaitGroup
+	for i := range sends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"n":%d}}`, i)
+			resp, err := client.Send(context.Background(), []byte(msg))
+			results[i], errs[i] = string(resp), err
+		}()
+	}
+
+	// Release the responses once both requests are pending upstream
+	deadline := time.Now().Add(2 * time.Second)
+	for upstream.posts.Load() < sends {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for requests")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(upstream.overlap)
+	wg.Wait()
+
+	for i := range sends {
+		if errs[i] != nil {
+			t.Fatalf("Send %d failed: %v", i, errs[i])
+		}
+		want := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"result":{"n":%d}}`, i)
+		if results[i] != want {
+			t.Errorf("Send %d response = %s, want %s", i, results[i], want)
+		}
+	}
+	if upstream.ids[0] == upstream.ids[1] {
+		t.Errorf("upstream received the same ID %s twice", upstream.ids[0])
+	}
+}
+
+// TestSendAsyncRemapsCancelledID tests that a cancellation names the
+// upstream ID of the calling session's request, and is dropped when no such
+// request is pending.
+func TestSendAsyncRemapsCancelledID(t *testing.T) {
+	upstream := newFlakyUpstream(0)
+	upstream.overlap = make(chan struct{})
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+	})
+
+	ctx := session.NewContext(context.Background(), session.NewSession("sess-1"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = client.Send(ctx, []byte(`{"jsonrpc":"2.0","id":7,"method":"tools/call"}`))
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for upstream.posts.Load() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	otherCtx := session.NewContext(context.Background(), session.NewSession("sess-2"))
+	cancels := []struct {
+		ctx context.Context
+		id  string
+	}{
+		{ctx, "8"},      // not pending
+		{otherCtx, "7"}, // another session's ID
+		{ctx, "7"},
+	}
+	for _, cancel := range cancels {
+		msg := fmt.Sprintf(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":%s}}`, cancel.id)
+		if err := client.SendAsync(cancel.ctx, []byte(msg)); err != nil {
+			t.Fatalf("SendAsync failed: %v", err)
+		}
+	}
+	close(upstream.overlap)
+	<-done
+
+	upstream.mu.Lock()
+	defer upstream.mu.Unlock()
+	if len(upstream.cancelled) != 1 {
+		t.Fatalf("upstream received %d cancellations, want 1: %v", len(upstream.cancelled), upstream.cancelled)
+	}
+	if upstream.cancelled[0] != upstream.ids[0] {
+		t.Errorf("cancelled requestId = %s, want %s", upstream.cancelled[0], upstream.ids[0])
+	}
+}
+
+// TestSendRestoresIDTypes tests that string, number and null IDs survive
+// the round trip unchanged.
+func TestSendRestoresIDTypes(t *testing.T) {
+	upstream := newFlakyUpstream(0)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+	})
+
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"string", `"req-abc"`},
+		{"number", `7`},
+		{"large number", `12345678901234567890`},
+		{"null", `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := `{"jsonrpc":"2.0","id":` + tt.id + `,"method":"tools/list"}`
+			resp, err := client.Send(context.Background(), []byte(msg))
+			if err != nil {
+				t.Fatalf("Send failed: %v", err)
+			}
+			want := `{"jsonrpc":"2.0","id":` + tt.id + `,"result":{}}`
+			if string(resp) != want {
+				t.Errorf("response = %s, want %s", resp, want)
+			}
+		})
+	}
+}
+
+// TestUpstreamHeaders tests that configured headers are sent on both the SSE
+// stream request and message POSTs, without overriding protocol headers.
+func TestUpstreamHeaders(t *testing.T) {
+	upstream := newFlakyUpstream(0)
+
+	var (
+		mu       sync.Mutex
+		requests = make(map[string]http.Header)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method] = r.Header.Clone()
+		mu.Unlock()
+		upstream.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+		Headers: map[string]string{
+			"Authorization": "Bearer secret",
+			"X-API-Key":     "key",
+			"Accept":        "text/plain",
+		},
+	})
+	if _, err := client.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		header, ok := requests[method]
+		if !ok {
+			t.Fatalf("no %s request received", method)
+		}
+		if got := header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("%s Authorization = %q, want %q", method, got, "Bearer secret")
+		}
+		if got := header.Get("X-API-Key"); got != "key" {
+			t.Errorf("%s X-API-Key = %q, want %q", method, got, "key")
+		}
+	}
+	if got := requests[http.MethodGet].Get("Accept"); got != "text/event-stream" {
+		t.Errorf("GET Accept = %q, want text/event-stream", got)
+	}
+}
+
+// TestResolveEndpoint tests that message endpoints are resolved against the
+// upstream URL and rejected on another origin, where the configured
+// credential headers would leak.
+func TestResolveEndpoint(t *testing.T) {
+	c := &Client{cfg: config.UpstreamConfig{URL: "https://mcp.example.com/sse"}}
+
+	tests := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{"/message?sessionId=1", "https://mcp.example.com/sse/message?sessionId=1", false},
+		{"message?sessionId=1", "https://mcp.example.com/message?sessionId=1", false},
+		{"https://mcp.example.com/message", "https://mcp.example.com/message", false},
+		{"https://MCP.example.com:443/message", "https://MCP.example.com:443/message", false},
+		{"https://other.example.com/message", "", true},
+		{"http://mcp.example.com/message", "", true},
+		{"https://mcp.example.com:8443/message", "", true},
+		{"//other.example.com/message", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := c.resolveEndpoint(tt.endpoint)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveEndpoint(%q) = %q, %v, want %q, error %v", tt.endpoint, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestReconnect tests that a disconnected client can connect again and
+// send on the new stream.
+func TestReconnect(t *testing.T) {
+	server := httptest.NewServer(newFlakyUpstream(0))
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{URL: server.URL, Timeout: 5 * time.Second})
+	client.Disconnect()
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() after Disconnect() error = %v", err)
+	}
+
+	if _, err := client.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err != nil {
+		t.Errorf("Send() after reconnect error = %v", err)
+	}
+}
+
+// TestReconnectReplaysHandshake tests that a reconnected client sends the
+// upstream the initialize handshake it sent on the earlier connection.
+func TestReconnectReplaysHandshake(t *testing.T) {
+	upstream := newFlakyUpstream(0)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+	})
+	ctx := context.Background()
+
+	if _, err := client.Send(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)); err != nil {
+		t.Fatalf("Send(initialize) failed: %v", err)
+	}
+	if err := client.SendAsync(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		t.Fatalf("SendAsync(initialized) failed: %v", err)
+	}
+
+	client.Disconnect()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	upstream.mu.Lock()
+	defer upstream.mu.Unlock()
+	want := []string{"initialize", "notifications/initialized", "initialize", "notifications/initialized"}
+	if !slices.Equal(upstream.methods, want) {
+		t.Errorf("upstream methods = %v, want %v", upstream.methods, want)
+	}
+}
+
+// blockingStream is a RoundTripper serving an SSE stream that sends the
+// endpoint event and then blocks, ignoring the request context the way a
+// stalled proxy or custom transport might.
+type blockingStream struct{}
+
+func (blockingStream) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, w := io.Pipe()
+	go fmt.Fprint(w, "event: endpoint\ndata: /message\n\n")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       body,
+		Request:    req,
+	}, nil
+}
+
+// TestReadEventsContextCancel tests that cancelling the context passed to
+// Connect tears down a stream blocked waiting for the next line.
+func TestReadEventsContextCancel(t *testing.T) {
+	client := NewClient(config.UpstreamConfig{URL: "http://upstream.invalid/sse", Timeout: 5 * time.Second})
+	client.httpClient = &http.Client{Transport: blockingStream{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(client.Disconnect)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for client.GetMessageURL() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for endpoint event")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+
+	deadline = time.Now().Add(500 * time.Millisecond)
+	for client.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("read loop did not exit after the context was cancelled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestResponseBurst tests that a burst of responses fills the configured
+// per-request buffer, and that the next one is dropped and counted at once
+// rather than holding up the read loop.
+func TestResponseBurst(t *testing.T) {
+	client := NewClient(config.UpstreamConfig{
+		URL:            "http://upstream.invalid/sse",
+		ResponseBuffer: config.ResponseBufferConfig{PerRequest: 5},
+	})
+	var dropped atomic.Int64
+	client.SetOnResponseDropped(func() { dropped.Add(1) })
+
+	respChan := make(chan *Response, client.responseBuffer)
+	client.pending["proxy-1"] = respChan
+
+	const burst = 6
+	start := time.Now()
+	for i := 0; i < burst; i++ {
+		client.handleEvent("message", fmt.Sprintf(`{"jsonrpc":"2.0","id":"proxy-1","result":{"n":%d}}`, i))
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("burst took %s, want no waiting on the full buffer", elapsed)
+	}
+
+	if got := dropped.Load(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+	for i := 0; i < client.responseBuffer; i++ {
+		resp := <-respChan
+		if want := fmt.Sprintf(`"n":%d`, i); !strings.Contains(string(resp.Data), want) {
+			t.Errorf("response %d = %s, want %s", i, resp.Data, want)
+		}
+	}
+}
+
+// TestMultiLineData tests that an event whose JSON is split across several
+// data lines is reassembled before it is parsed.
+func TestMultiLineData(t *testing.T) {
+	upstream := newFlakyUpstream(0)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	client := connectClient(t, config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+	})
+
+	notifications := make(chan string, 1)
+	client.SetNotificationHandler(func(message []byte) {
+		notifications <- string(message)
+	})
+
+	// The upstream writes the first line after "data: "; the rest follow
+	// as further data lines of the same event
+	upstream.events <- "{\"jsonrpc\":\"2.0\",\ndata: \"method\":\"notifications/message\",\ndata: \"params\":{\"level\":\"info\",\"data\":\"split\"}}"
+
+	select {
+	case got := <-notifications:
+		var msg struct {
+			Method string `json:"method"`
+			Params struct {
+				Data string `json:"data"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(got), &msg); err != nil {
+			t.Fatalf("reassembled data %q does not parse: %v", got, err)
+		}
+		if msg.Method != "notifications/message" || msg.Params.Data != "split" {
+			t.Errorf("message = %+v, want notifications/message with data split", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+}
+
+// TestParseSSELine tests that only the single space after the colon is
+// removed from a field value.
+func TestParseSSELine(t *testing.T) {
+	tests := []struct {
+		line      string
+		wantField string
+		wantValue string
+	}{
+		{"data: {\"a\":1}", "data", `{"a":1}`},
+		{"data:{\"a\":1}", "data", `{"a":1}`},
+		{"data:   indented  ", "data", "  indented  "},
+		{"data:", "data", ""},
+		{"event: endpoint", "event", "endpoint"},
+		{": comment", "", "comment"},
+	}
+
+	for _, tt := range tests {
+		field, value := parseSSELine(tt.line)
+		if field != tt.wantField || value != tt.wantValue {
+			t.Errorf("parseSSELine(%q) = %q, %q, want %q, %q", tt.line, field, value, tt.wantField, tt.wantValue)
+		}
+	}
+}
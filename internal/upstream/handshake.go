@@ -0,0 +1,113 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// handshake holds the messages a client sent to set up its session on an
+// upstream server: initialize, notifications/initialized and its resource
+// subscriptions. A new connection is a new client to the server, so they
+// are replayed on a connection that replaces the one they were sent on.
+type handshake struct {
+	mu            sync.Mutex
+	initialize    []byte
+	initialized   []byte
+	subscriptions map[string][]byte // resources/subscribe requests by URI
+}
+
+// record keeps message if it is part of the session setup. resp is the
+// upstream's response, nil for notifications; requests it rejected are not
+// kept.
+func (h *handshake) record(message, resp []byte) {
+	var req struct {
+		Method string `json:"method"`
+		Params struct {
+			URI string `json:"uri"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(message, &req); err != nil {
+		return
+	}
+	if resp != nil && rpcError(resp) != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch req.Method {
+	case "initialize":
+		h.initialize = message
+		h.initialized = nil
+		h.subscriptions = nil
+	case "notifications/initialized":
+		h.initialized = message
+	case "resources/subscribe":
+		if h.subscriptions == nil {
+			h.subscriptions = make(map[string][]byte)
+		}
+		h.subscriptions[req.Params.URI] = message
+	case "resources/unsubscribe":
+		delete(h.subscriptions, req.Params.URI)
+	}
+}
+
+// replay sends the recorded setup to u, which must be connected. It does
+// nothing if the client has not initialized yet.
+func (h *handshake) replay(ctx context.Context, u Upstream) error {
+	h.mu.Lock()
+	initialize, initialized := h.initialize, h.initialized
+	subscriptions := make([][]byte, 0, len(h.subscriptions))
+	for _, message := range h.subscriptions {
+		subscriptions = append(subscriptions, message)
+	}
+	h.mu.Unlock()
+
+	if initialize == nil {
+		return nil
+	}
+	if err := sendChecked(ctx, u, initialize); err != nil {
+		return fmt.Errorf("replaying initialize: %w", err)
+	}
+	if initialized != nil {
+		if err := SendNotification(ctx, u, initialized); err != nil {
+			return fmt.Errorf("replaying notifications/initialized: %w", err)
+		}
+	}
+	for _, message := range subscriptions {
+		if err := sendChecked(ctx, u, message); err != nil {
+			return fmt.Errorf("replaying resources/subscribe: %w", err)
+		}
+	}
+	return nil
+}
+
+// sendChecked sends a request to u and returns the JSON-RPC error of its
+// response, if any.
+func sendChecked(ctx context.Context, u Upstream, message []byte) error {
+	resp, err := u.Send(ctx, message)
+	if err != nil {
+		return err
+	}
+	return rpcError(resp)
+}
+
+// rpcError returns the error carried by a JSON-RPC response, or nil if it
+// has none.
+func rpcError(resp []byte) error {
+	var parsed struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &parsed); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if parsed.Error != nil {
+		return errors.New(parsed.Error.Message)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// HTTPClient talks to an upstream MCP server over plain request/response
+// HTTP. Each message is POSTed to the configured URL and the JSON-RPC
+// response is read from the response body.
+type HTTPClient struct {
+	cfg        config.UpstreamConfig
+	httpClient *http.Client
+
+	mu        sync.RWMutex
+	connected bool
+}
+
+// NewHTTPClient creates a new plain HTTP upstream client.
+func NewHTTPClient(cfg config.UpstreamConfig) *HTTPClient {
+	return &HTTPClient{
+		cfg:        cfg,
+		httpClient: newHTTPClient(cfg),
+	}
+}
+
+// Connect marks the client ready. Plain HTTP needs no handshake.
+func (c *HTTPClient) Connect(ctx context.Context) error {
+	if c.cfg.URL == "" {
+		return fmt.Errorf("no upstream URL configured")
+	}
+
+	c.mu.Lock()
+	c.connected = true
+	c.mu.Unlock()
+
+	log.Info().Str("url", c.cfg.URL).Msg("Using HTTP upstream MCP server")
+
+	return nil
+}
+
+// Disconnect releases idle connections.
+func (c *HTTPClient) Disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return
+	}
+
+	c.connected = false
+	c.httpClient.CloseIdleConnections()
+
+	log.Info().Msg("Disconnected from upstream MCP server")
+}
+
+// Send POSTs a message and returns the response body.
+// Notifications that the server acknowledges without a body return nil.
+func (c *HTTPClient) Send(ctx context.Context, message []byte) ([]byte, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected to upstream")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.URL, bytes.NewReader(message))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	setHeaders(req, c.cfg)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send to upstream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upstream response: %w", err)
+		}
+		return body, nil
+	case http.StatusAccepted, http.StatusNoContent:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+}
+
+// SendAsync POSTs a message, discarding any response body.
+func (c *HTTPClient) SendAsync(ctx context.Context, message []byte) error {
+	_, err := c.Send(ctx, message)
+	return err
+}
+
+// IsConnected returns true once Connect has been called.
+func (c *HTTPClient) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connected
+}
@@ -0,0 +1,167 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/transport"
+)
+
+// TestHTTPClientSend tests request/response over plain HTTP.
+func TestHTTPClientSend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		switch string(body) {
+		case `{"jsonrpc":"2.0","method":"notifications/initialized"}`:
+			w.WriteHeader(http.StatusAccepted)
+		case `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`:
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(config.UpstreamConfig{
+		URL:       server.URL,
+		Transport: "http",
+		Timeout:   5 * time.Second,
+	})
+
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "request",
+			message:  `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			expected: `{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`,
+		},
+		{
+			name:     "notification",
+			message:  `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+			expected: "",
+		},
+		{
+			name:    "server error",
+			message: `{"jsonrpc":"2.0","id":2,"method":"tools/call"}`,
+			wantErr: true,
+		},
+	}
+
+	if _, err := client.Send(context.Background(), []byte(tests[0].message)); err == nil {
+		t.Fatal("expected error before Connect")
+	}
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Disconnect()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Send(context.Background(), []byte(tt.message))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(resp) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, resp)
+			}
+		})
+	}
+}
+
+// TestHTTPClientTimeout tests that the configured timeout is respected.
+func TestHTTPClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewHTTPClient(config.UpstreamConfig{
+		URL:     server.URL,
+		Timeout: 50 * time.Millisecond,
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if _, err := client.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+// TestHTTPClientHeaders tests that configured headers and the request ID
+// are sent with each POST.
+func TestHTTPClientHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(transport.RequestIDHeader) != "req-42" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":{}}`)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(config.UpstreamConfig{
+		URL:       server.URL,
+		Transport: "http",
+		Timeout:   5 * time.Second,
+		Headers:   map[string]string{"Authorization": "Bearer secret"},
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Disconnect()
+
+	ctx := transport.WithRequestID(context.Background(), "req-42")
+	if _, err := client.Send(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)); err != nil {
+		t.Errorf("Send() error = %v", err)
+	}
+}
+
+// TestHTTPClientSendAsync tests that notifications acknowledged without a
+// body are delivered through SendNotification.
+func TestHTTPClientSendAsync(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(config.UpstreamConfig{URL: server.URL, Transport: "http", Timeout: 5 * time.Second})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Disconnect()
+
+	const msg = `{"jsonrpc":"2.0","method":"notifications/initialized"}`
+	if err := SendNotification(context.Background(), client, []byte(msg)); err != nil {
+		t.Fatalf("SendNotification() error = %v", err)
+	}
+	if got := <-received; got != msg {
+		t.Errorf("upstream received %s, want %s", got, msg)
+	}
+}
@@ -0,0 +1,327 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrPoolExhausted is returned when every pooled upstream connection is busy
+// and a new session needs one.
+var ErrPoolExhausted = errors.New("upstream connection pool exhausted")
+
+// Pool gives each downstream session its own upstream connection, so that
+// upstream sessions are isolated and JSON-RPC ids used by different clients
+// cannot collide. Requests whose context carries no session use a shared
+// connection.
+//
+// A connection is closed once its session closes, or earlier if the pool
+// is full and it is the least recently used. A session whose connection
+// was closed early gets a new one, to which its initialize handshake and
+// resource subscriptions are replayed.
+type Pool struct {
+	cfg  config.ConnectionPoolConfig
+	dial func() (Upstream, error)
+
+	mu             sync.Mutex
+	ctx            context.Context
+	cancel         context.CancelFunc
+	shared         Upstream
+	members        map[string]*poolMember
+	evicted        map[string]*poolMember // Live sessions whose connection was closed
+	onNotification NotificationHandler
+	onDropped      func()
+}
+
+// poolMember is the upstream connection of one downstream session.
+type poolMember struct {
+	conn     Upstream
+	sess     *session.Session
+	hs       *handshake
+	ready    chan struct{} // Closed once conn is connected or err is set
+	err      error
+	inFlight int
+	lastUsed time.Time
+}
+
+// NewPool creates a pool that opens connections with dial, keeping at most
+// cfg.MaxOpen per-session connections.
+func NewPool(cfg config.ConnectionPoolConfig, dial func() (Upstream, error)) (*Pool, error) {
+	shared, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return &Pool{
+		cfg:     cfg,
+		dial:    dial,
+		shared:  shared,
+		members: make(map[string]*poolMember),
+		evicted: make(map[string]*poolMember),
+	}, nil
+}
+
+// SetNotificationHandler sets the handler for notifications pushed on any
+// pooled connection.
+func (p *Pool) SetNotificationHandler(h NotificationHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onNotification = h
+	if n, ok := p.shared.(Notifier); ok {
+		n.SetNotificationHandler(h)
+	}
+}
+
+// SetOnResponseDropped sets the callback for responses dropped on any
+// pooled connection.
+func (p *Pool) SetOnResponseDropped(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onDropped = fn
+	if r, ok := p.shared.(DropReporter); ok {
+		r.SetOnResponseDropped(fn)
+	}
+}
+
+// Connect connects the shared connection and starts closing those of
+// closed sessions. Per-session connections are opened on first use.
+func (p *Pool) Connect(ctx context.Context) error {
+	p.mu.Lock()
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	p.mu.Unlock()
+
+	if err := p.shared.Connect(ctx); err != nil {
+		return err
+	}
+
+	if p.cfg.IdleTimeout > 0 {
+		go p.reapClosed(p.ctx)
+	}
+	return nil
+}
+
+// Send sends the message on the connection of the session in ctx.
+func (p *Pool) Send(ctx context.Context, message []byte) ([]byte, error) {
+	sess := session.FromContext(ctx)
+	if sess == nil {
+		return p.shared.Send(ctx, message)
+	}
+
+	m, err := p.acquire(sess)
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(m)
+
+	resp, err := m.conn.Send(ctx, message)
+	if err == nil {
+		m.hs.record(message, resp)
+	}
+	return resp, err
+}
+
+// SendAsync delivers a notification over the calling session's connection
+// without waiting for a response.
+func (p *Pool) SendAsync(ctx context.Context, message []byte) error {
+	sess := session.FromContext(ctx)
+	if sess == nil {
+		return SendNotification(ctx, p.shared, message)
+	}
+
+	m, err := p.acquire(sess)
+	if err != nil {
+		return err
+	}
+	defer p.release(m)
+
+	if err := SendNotification(ctx, m.conn, message); err != nil {
+		return err
+	}
+	m.hs.record(message, nil)
+	return nil
+}
+
+// Disconnect closes every pooled connection.
+func (p *Pool) Disconnect() {
+	p.mu.Lock()
+	if p.cancel != nil {
+		p.cancel()
+	}
+	members := p.members
+	p.members = make(map[string]*poolMember)
+	p.evicted = make(map[string]*poolMember)
+	p.mu.Unlock()
+
+	for _, m := range members {
+		<-m.ready
+		if m.err == nil {
+			m.conn.Disconnect()
+		}
+	}
+	p.shared.Disconnect()
+}
+
+// IsConnected reports whether the shared connection is up.
+func (p *Pool) IsConnected() bool {
+	return p.shared.IsConnected()
+}
+
+// Size returns the number of per-session connections.
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.members)
+}
+
+// acquire returns the session's connection, opening one if needed. The
+// caller must release it.
+func (p *Pool) acquire(sess *session.Session) (*poolMember, error) {
+	p.mu.Lock()
+	if m, ok := p.members[sess.ID]; ok {
+		m.inFlight++
+		m.lastUsed = time.Now()
+		p.mu.Unlock()
+
+		<-m.ready
+		if m.err != nil {
+			p.release(m)
+			return nil, m.err
+		}
+		return m, nil
+	}
+
+	if p.cfg.MaxOpen > 0 && len(p.members) >= p.cfg.MaxOpen && !p.evictLocked() {
+		p.mu.Unlock()
+		return nil, ErrPoolExhausted
+	}
+
+	m := &poolMember{
+		sess:     sess,
+		hs:       &handshake{},
+		ready:    make(chan struct{}),
+		inFlight: 1,
+		lastUsed: time.Now(),
+	}
+	if evicted, ok := p.evicted[sess.ID]; ok {
+		m.hs = evicted.hs
+		delete(p.evicted, sess.ID)
+	}
+	p.members[sess.ID] = m
+	ctx, onNotification, onDropped := p.ctx, p.onNotification, p.onDropped
+	p.mu.Unlock()
+
+	// Connect outside the lock; other requests for the session wait on ready
+	m.conn, m.err = p.dial()
+	if m.err == nil {
+		if n, ok := m.conn.(Notifier); ok && onNotification != nil {
+			n.SetNotificationHandler(onNotification)
+		}
+		if r, ok := m.conn.(DropReporter); ok && onDropped != nil {
+			r.SetOnResponseDropped(onDropped)
+		}
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		m.err = m.conn.Connect(ctx)
+		if m.err == nil {
+			if m.err = m.hs.replay(ctx, m.conn); m.err != nil {
+				m.conn.Disconnect()
+			}
+		}
+	}
+	close(m.ready)
+
+	if m.err != nil {
+		log.Warn().Err(m.err).Str("session_id", sess.ID).Msg("Failed to open upstream connection for session")
+		p.mu.Lock()
+		if p.members[sess.ID] == m {
+			delete(p.members, sess.ID)
+			p.evicted[sess.ID] = m
+		}
+		p.mu.Unlock()
+		return nil, m.err
+	}
+
+	log.Debug().Str("session_id", sess.ID).Msg("Opened upstream connection for session")
+	return m, nil
+}
+
+// release marks a request on the member as finished.
+func (p *Pool) release(m *poolMember) {
+	p.mu.Lock()
+	m.inFlight--
+	m.lastUsed = time.Now()
+	p.mu.Unlock()
+}
+
+// evictLocked makes room for one connection by closing those of closed
+// sessions or, failing that, the least recently used idle one, whose
+// session is set up again on its next request. It reports whether there
+// is room. Must be called with p.mu held.
+func (p *Pool) evictLocked() bool {
+	if p.removeLocked(func(m *poolMember) bool { return m.sess.IsClosed() }) > 0 {
+		return true
+	}
+
+	var lru *poolMember
+	for _, m := range p.members {
+		if m.inFlight == 0 && (lru == nil || m.lastUsed.Before(lru.lastUsed)) {
+			lru = m
+		}
+	}
+	if lru == nil {
+		return false
+	}
+	p.removeLocked(func(m *poolMember) bool { return m == lru })
+	return true
+}
+
+// removeLocked disconnects and removes idle members matching fn, returning
+// how many were removed. The setup of live sessions is kept for their next
+// connection. Must be called with p.mu held.
+func (p *Pool) removeLocked(fn func(m *poolMember) bool) int {
+	removed := 0
+	for id, m := range p.members {
+		if m.inFlight > 0 || !fn(m) {
+			continue
+		}
+		delete(p.members, id)
+		if !m.sess.IsClosed() {
+			p.evicted[id] = m
+		}
+		go m.conn.Disconnect()
+		removed++
+	}
+	return removed
+}
+
+// reapClosed periodically closes the connections of closed sessions. The
+// connections of live sessions stay open however long they are idle,
+// since the upstream server would see a new connection as a new client.
+func (p *Pool) reapClosed(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.IdleTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			removed := p.removeLocked(func(m *poolMember) bool { return m.sess.IsClosed() })
+			for id, m := range p.evicted {
+				if m.sess.IsClosed() {
+					delete(p.evicted, id)
+				}
+			}
+			p.mu.Unlock()
+			if removed > 0 {
+				log.Debug().Int("closed", removed).Msg("Closed upstream connections of closed sessions")
+			}
+		}
+	}
+}
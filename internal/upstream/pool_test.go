@@ -0,0 +1,318 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/session"
+)
+
+// multiStreamUpstream is an SSE MCP server that gives each connection its
+// own message endpoint and answers with the connection number. It holds
+// responses until want requests have arrived so that they overlap.
+type multiStreamUpstream struct {
+	want int32
+
+	mu      sync.Mutex
+	streams []chan string
+	posts   atomic.Int32
+	overlap chan struct{}
+}
+
+func newMultiStreamUpstream(want int32) *multiStreamUpstream {
+	return &multiStreamUpstream{want: want, overlap: make(chan struct{})}
+}
+
+func (u *multiStreamUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		events := make(chan string, 10)
+		u.mu.Lock()
+		conn := len(u.streams)
+		u.streams = append(u.streams, events)
+		u.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: endpoint\ndata: /message?conn=%d\n\n", conn)
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case data := <-events:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+				w.(http.Flusher).Flush()
+			}
+		}
+
+	case http.MethodPost:
+		var conn int
+		fmt.Sscan(r.URL.Query().Get("conn"), &conn)
+		u.mu.Lock()
+		events := u.streams[conn]
+		u.mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		_ = json.Unmarshal(body, &req)
+
+		if u.posts.Add(1) == u.want {
+			close(u.overlap)
+		}
+		go func() {
+			<-u.overlap
+			events <- fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":{"conn":%d}}`, req.ID, conn)
+		}()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// TestPoolOverlappingIDs tests that two sessions using the same JSON-RPC id
+// at the same time each get the response to their own request.
+func TestPoolOverlappingIDs(t *testing.T) {
+	upstream := newMultiStreamUpstream(2)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	pool, err := NewPool(config.ConnectionPoolConfig{MaxOpen: 10}, func() (Upstream, error) {
+		return NewClient(config.UpstreamConfig{URL: server.URL, Timeout: 5 * time.Second}), nil
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+	if err := pool.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(pool.Disconnect)
+
+	sessions := []*session.Session{session.NewSession("sess_a"), session.NewSession("sess_b")}
+	results := make([]string, len(sessions))
+	errs := make([]error, len(sessions))
+
+	var wg sync.WaitGroup
+	for i, sess := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := session.NewContext(context.Background(), sess)
+			resp, err := pool.Send(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+			results[i], errs[i] = string(resp), err
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Send() for %s error = %v", sessions[i].ID, err)
+		}
+	}
+	if results[0] == results[1] {
+		t.Errorf("Both sessions got %s, want responses from separate connections", results[0])
+	}
+	if got := pool.Size(); got != 2 {
+		t.Errorf("Size() = %d, want 2", got)
+	}
+}
+
+// fakeUpstream is an in-memory upstream that echoes messages, blocking on
+// "block" until released.
+type fakeUpstream struct {
+	connected atomic.Bool
+	started   chan struct{}
+	release   chan struct{}
+
+	mu       sync.Mutex
+	received []string
+}
+
+func (f *fakeUpstream) Connect(ctx context.Context) error {
+	f.connected.Store(true)
+	return nil
+}
+
+func (f *fakeUpstream) Send(ctx context.Context, message []byte) ([]byte, error) {
+	f.mu.Lock()
+	f.received = append(f.received, string(message))
+	f.mu.Unlock()
+	if string(message) == "block" {
+		close(f.started)
+		<-f.release
+	}
+	return message, nil
+}
+
+func (f *fakeUpstream) Disconnect()       { f.connected.Store(false) }
+func (f *fakeUpstream) IsConnected() bool { return f.connected.Load() }
+
+func (f *fakeUpstream) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.received)
+}
+
+// TestPoolEviction tests that a full pool makes room by closing connections
+// of closed or idle sessions, and fails when every connection is busy.
+func TestPoolEviction(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns []*fakeUpstream
+	)
+	pool, err := NewPool(config.ConnectionPoolConfig{MaxOpen: 1}, func() (Upstream, error) {
+		f := &fakeUpstream{started: make(chan struct{}), release: make(chan struct{})}
+		mu.Lock()
+		conns = append(conns, f)
+		mu.Unlock()
+		return f, nil
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+	if err := pool.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(pool.Disconnect)
+
+	send := func(sess *session.Session, message string) error {
+		_, err := pool.Send(session.NewContext(context.Background(), sess), []byte(message))
+		return err
+	}
+	conn := func(i int) *fakeUpstream {
+		mu.Lock()
+		defer mu.Unlock()
+		return conns[i]
+	}
+	dialed := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(conns)
+	}
+
+	// conns[0] is the shared connection
+	a, b, c := session.NewSession("sess_a"), session.NewSession("sess_b"), session.NewSession("sess_c")
+	if err := send(a, "ping"); err != nil {
+		t.Fatalf("Send() for a error = %v", err)
+	}
+
+	// The idle connection of a is evicted for b
+	done := make(chan error, 1)
+	go func() { done <- send(b, "block") }()
+	eventually(t, func() bool { return dialed() == 3 })
+	<-conn(2).started
+	eventually(t, func() bool { return !conn(1).IsConnected() })
+
+	// Every connection is busy
+	if err := send(c, "ping"); !errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("Send() with busy pool error = %v, want ErrPoolExhausted", err)
+	}
+
+	close(conn(2).release)
+	if err := <-done; err != nil {
+		t.Fatalf("Send() for b error = %v", err)
+	}
+
+	// The connection of a closed session is reclaimed
+	b.Close()
+	if err := send(c, "ping"); err != nil {
+		t.Fatalf("Send() after session close error = %v", err)
+	}
+	eventually(t, func() bool { return !conn(2).IsConnected() })
+	if got := pool.Size(); got != 1 {
+		t.Errorf("Size() = %d, want 1", got)
+	}
+}
+
+// TestPoolReplaysHandshake tests that a live session whose connection was
+// evicted gets its initialize handshake and subscriptions replayed on its
+// next connection, and that the reaper leaves live sessions connected.
+func TestPoolReplaysHandshake(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns []*fakeUpstream
+	)
+	pool, err := NewPool(config.ConnectionPoolConfig{MaxOpen: 1, IdleTimeout: 10 * time.Millisecond}, func() (Upstream, error) {
+		f := &fakeUpstream{}
+		mu.Lock()
+		conns = append(conns, f)
+		mu.Unlock()
+		return f, nil
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+	if err := pool.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(pool.Disconnect)
+
+	conn := func(i int) *fakeUpstream {
+		mu.Lock()
+		defer mu.Unlock()
+		return conns[i]
+	}
+
+	const (
+		initialize  = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`
+		initialized = `{"jsonrpc":"2.0","method":"notifications/initialized"}`
+		subscribe   = `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"file:///a"}}`
+		list        = `{"jsonrpc":"2.0","id":3,"method":"tools/list"}`
+	)
+	a, b := session.NewSession("sess_a"), session.NewSession("sess_b")
+	ctxA := session.NewContext(context.Background(), a)
+	if _, err := pool.Send(ctxA, []byte(initialize)); err != nil {
+		t.Fatalf("Send(initialize) error = %v", err)
+	}
+	if err := pool.SendAsync(ctxA, []byte(initialized)); err != nil {
+		t.Fatalf("SendAsync(initialized) error = %v", err)
+	}
+	if _, err := pool.Send(ctxA, []byte(subscribe)); err != nil {
+		t.Fatalf("Send(subscribe) error = %v", err)
+	}
+
+	// Idle but live sessions are not reaped
+	time.Sleep(50 * time.Millisecond)
+	if !conn(1).IsConnected() {
+		t.Fatal("connection of a live session was reaped")
+	}
+
+	// b evicts the idle connection of a
+	if _, err := pool.Send(session.NewContext(context.Background(), b), []byte(list)); err != nil {
+		t.Fatalf("Send() for b error = %v", err)
+	}
+	eventually(t, func() bool { return !conn(1).IsConnected() })
+
+	// a is set up again on a new connection before its request
+	b.Close()
+	if _, err := pool.Send(ctxA, []byte(list)); err != nil {
+		t.Fatalf("Send() after eviction error = %v", err)
+	}
+	want := []string{initialize, initialized, subscribe, list}
+	if got := conn(3).messages(); !slices.Equal(got, want) {
+		t.Errorf("new connection received %v, want %v", got, want)
+	}
+}
+
+// eventually fails the test if cond does not become true within a second.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
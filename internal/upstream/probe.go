@@ -0,0 +1,187 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// pingRequest is the MCP ping sent by the probe.
+var pingRequest = []byte(`{"jsonrpc":"2.0","id":"probe","method":"ping"}`)
+
+// Prober periodically pings an upstream to check that it actually responds,
+// not just that its connection is open. After cfg.Probe.FailureThreshold
+// consecutive failures it resets the connection, and it connects upstreams
+// that are down. Reconnected upstreams replay their client's handshake. The upstreams of a Set are pinged and reset one by one,
+// since a ping sent through the Set only reaches its default upstream.
+type Prober struct {
+	targets []*probeTarget
+	cfg     config.UpstreamConfig
+
+	mu       sync.Mutex
+	probed   bool
+	healthy  bool
+	onResult func(healthy bool)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// probeTarget is an upstream pinged by a Prober.
+type probeTarget struct {
+	name     string
+	upstream Upstream
+	failures int // Consecutive failed pings, guarded by Prober.mu
+}
+
+// NewProber creates a prober for u using cfg.Probe.
+func NewProber(u Upstream, cfg config.UpstreamConfig) *Prober {
+	return &Prober{targets: probeTargets(u), cfg: cfg}
+}
+
+// probeTargets returns the upstreams to check for u: the members of a Set,
+// or u itself.
+func probeTargets(u Upstream) []*probeTarget {
+	set, ok := u.(*Set)
+	if !ok {
+		return []*probeTarget{{name: "default", upstream: u}}
+	}
+	var targets []*probeTarget
+	if set.def != nil {
+		targets = append(targets, &probeTarget{name: "default", upstream: set.def})
+	}
+	for _, r := range set.routes {
+		targets = append(targets, &probeTarget{name: r.Name, upstream: r.Upstream})
+	}
+	return targets
+}
+
+// SetOnResult sets a callback run after every probe with its outcome.
+func (p *Prober) SetOnResult(fn func(healthy bool)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onResult = fn
+}
+
+// Start probes once and then every cfg.Probe.Interval until Stop.
+func (p *Prober) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.cfg.Probe.Interval)
+		defer ticker.Stop()
+
+		for {
+			p.probe(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops probing and waits for a running probe to finish.
+func (p *Prober) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+		<-p.done
+	}
+}
+
+// Healthy reports whether every upstream answered the last probe.
+func (p *Prober) Healthy() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.healthy
+}
+
+// probe pings every upstream once and records the outcome.
+func (p *Prober) probe(ctx context.Context) {
+	healthy := true
+	for _, t := range p.targets {
+		if !p.probeOne(ctx, t) {
+			healthy = false
+		}
+	}
+
+	p.mu.Lock()
+	if healthy && p.probed && !p.healthy {
+		log.Info().Msg("Upstream probe recovered")
+	}
+	p.healthy = healthy
+	p.probed = true
+	onResult := p.onResult
+	p.mu.Unlock()
+
+	if onResult != nil {
+		onResult(healthy)
+	}
+}
+
+// probeOne pings one upstream, resetting its connection once it reaches
+// the failure threshold. It reports whether the ping succeeded.
+func (p *Prober) probeOne(ctx context.Context, t *probeTarget) bool {
+	err := p.ping(ctx, t.upstream)
+
+	p.mu.Lock()
+	if err == nil {
+		t.failures = 0
+	} else {
+		t.failures++
+		log.Warn().Err(err).Str("upstream", t.name).Int("failures", t.failures).Msg("Upstream probe failed")
+	}
+	reset := err != nil && p.cfg.Probe.FailureThreshold > 0 && t.failures >= p.cfg.Probe.FailureThreshold
+	if reset {
+		t.failures = 0
+	}
+	p.mu.Unlock()
+
+	if reset && ctx.Err() == nil {
+		log.Warn().Str("upstream", t.name).Msg("Upstream unresponsive, resetting connection")
+		t.upstream.Disconnect()
+		if err := t.upstream.Connect(ctx); err != nil {
+			log.Warn().Err(err).Str("upstream", t.name).Msg("Failed to reconnect to upstream")
+		}
+	}
+	return err == nil
+}
+
+// ping connects u if needed and sends it an MCP ping.
+func (p *Prober) ping(ctx context.Context, u Upstream) error {
+	if !u.IsConnected() {
+		if err := u.Connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, p.cfg.Probe.Timeout)
+	defer cancel()
+
+	resp, err := u.Send(pingCtx, pingRequest)
+	if err != nil {
+		return err
+	}
+
+	var parsed struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &parsed); err != nil {
+		return fmt.Errorf("invalid ping response: %w", err)
+	}
+	if parsed.Error != nil {
+		return fmt.Errorf("ping failed: %s", parsed.Error.Message)
+	}
+	return nil
+}
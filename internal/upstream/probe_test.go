@@ -0,0 +1,164 @@
+package upstream
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// pingUpstream is an in-memory upstream whose pings fail while failing is
+// set. It counts how often it was connected.
+type pingUpstream struct {
+	failing   atomic.Bool
+	connected atomic.Bool
+	connects  atomic.Int32
+}
+
+func (u *pingUpstream) Connect(ctx context.Context) error {
+	u.connects.Add(1)
+	u.connected.Store(true)
+	return nil
+}
+
+func (u *pingUpstream) Send(ctx context.Context, message []byte) ([]byte, error) {
+	if u.failing.Load() {
+		return []byte(`{"jsonrpc":"2.0","id":"probe","error":{"code":-32603,"message":"overloaded"}}`), nil
+	}
+	return []byte(`{"jsonrpc":"2.0","id":"probe","result":{}}`), nil
+}
+
+func (u *pingUpstream) Disconnect()       { u.connected.Store(false) }
+func (u *pingUpstream) IsConnected() bool { return u.connected.Load() }
+
+// TestProber tests that failing pings mark the upstream unhealthy, reset the
+// connection after the failure threshold, and recover once pings
+// succeed.
+func TestProber(t *testing.T) {
+	u := &pingUpstream{}
+	u.failing.Store(true)
+	if err := u.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	prober := NewProber(u, config.UpstreamConfig{
+		Probe: config.ProbeConfig{Enabled: true, Interval: time.Hour, Timeout: time.Second, FailureThreshold: 2},
+	})
+	var results []bool
+	prober.SetOnResult(func(healthy bool) { results = append(results, healthy) })
+	ctx := context.Background()
+
+	prober.probe(ctx)
+	if prober.Healthy() {
+		t.Error("Healthy() after failed ping = true, want false")
+	}
+	if got := u.connects.Load(); got != 1 {
+		t.Errorf("connects after one failure = %d, want 1", got)
+	}
+
+	// The second consecutive failure reaches the threshold
+	prober.probe(ctx)
+	if got := u.connects.Load(); got != 2 {
+		t.Errorf("connects after threshold = %d, want 2 (reset)", got)
+	}
+
+	u.failing.Store(false)
+	prober.probe(ctx)
+	if !prober.Healthy() {
+		t.Error("Healthy() after successful ping = false, want true")
+	}
+
+	want := []bool{false, false, true}
+	if len(results) != len(want) {
+		t.Fatalf("results = %v, want %v", results, want)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("results = %v, want %v", results, want)
+			break
+		}
+	}
+}
+
+// TestProberConnects tests that a running prober connects an upstream that
+// is down and stops cleanly.
+func TestProberConnects(t *testing.T) {
+	u := &pingUpstream{}
+	prober := NewProber(u, config.UpstreamConfig{
+		Probe: config.ProbeConfig{Enabled: true, Interval: time.Millisecond, Timeout: time.Second},
+	})
+	prober.Start(context.Background())
+	eventually(t, prober.Healthy)
+	prober.Stop()
+
+	if !u.IsConnected() {
+		t.Error("IsConnected() = false, want true")
+	}
+}
+
+// TestProberSet tests that the upstreams of a set without a default are
+// pinged directly, and only the failing one is reset.
+func TestProberSet(t *testing.T) {
+	search, db := &pingUpstream{}, &pingUpstream{}
+	db.failing.Store(true)
+	set := NewSet(nil, []Route{
+		{Name: "search", Match: config.UpstreamMatch{ToolPrefixes: []string{"search_"}}, Upstream: search},
+		{Name: "db", Match: config.UpstreamMatch{ToolPrefixes: []string{"db_"}}, Upstream: db},
+	})
+
+	prober := NewProber(set, config.UpstreamConfig{
+		Probe: config.ProbeConfig{Enabled: true, Interval: time.Hour, Timeout: time.Second, FailureThreshold: 2},
+	})
+	ctx := context.Background()
+
+	prober.probe(ctx)
+	prober.probe(ctx)
+	if prober.Healthy() {
+		t.Error("Healthy() with a failing upstream = true, want false")
+	}
+	if got := search.connects.Load(); got != 1 {
+		t.Errorf("search connects = %d, want 1 (not reset)", got)
+	}
+	if got := db.connects.Load(); got != 2 {
+		t.Errorf("db connects = %d, want 2 (reset)", got)
+	}
+
+	db.failing.Store(false)
+	prober.probe(ctx)
+	if !prober.Healthy() {
+		t.Error("Healthy() after every upstream answers = false, want true")
+	}
+}
+
+// TestReconnector tests that a reconnector connects an upstream that is
+// down and leaves a connected one alone.
+func TestReconnector(t *testing.T) {
+	u := &pingUpstream{}
+	r := NewReconnector(u, 10*time.Millisecond)
+	r.Start(context.Background())
+	defer r.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for !u.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !u.IsConnected() {
+		t.Fatal("Reconnector did not connect the upstream")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := u.connects.Load(); got != 1 {
+		t.Errorf("connects = %d, want a connected upstream left alone", got)
+	}
+
+	u.Disconnect()
+	deadline = time.Now().Add(time.Second)
+	for !u.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := u.connects.Load(); got != 2 {
+		t.Errorf("connects after disconnect = %d, want 2", got)
+	}
+}
@@ -0,0 +1,70 @@
+package upstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reconnector connects an upstream that is down every interval. It keeps a
+// required upstream that isn't probed from staying down after a failed
+// start or a dropped connection. Unlike the Prober it never pings, so it
+// only notices connections that have closed.
+type Reconnector struct {
+	targets  []*probeTarget
+	interval time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewReconnector creates a reconnector for u, checking it every interval.
+// The upstreams of a Set are checked one by one.
+func NewReconnector(u Upstream, interval time.Duration) *Reconnector {
+	return &Reconnector{targets: probeTargets(u), interval: interval}
+}
+
+// Start checks the upstreams every interval until Stop.
+func (r *Reconnector) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.reconnect(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops checking and waits for a running connect to finish.
+func (r *Reconnector) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+		<-r.done
+	}
+}
+
+// reconnect connects every upstream that is not connected.
+func (r *Reconnector) reconnect(ctx context.Context) {
+	for _, t := range r.targets {
+		if t.upstream.IsConnected() {
+			continue
+		}
+		if err := t.upstream.Connect(ctx); err != nil {
+			log.Warn().Err(err).Str("upstream", t.name).Msg("Failed to reconnect to upstream")
+			continue
+		}
+		log.Info().Str("upstream", t.name).Msg("Reconnected to upstream")
+	}
+}
@@ -0,0 +1,516 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNoUpstream is returned when a request matches no route and there is no
+// default upstream.
+var ErrNoUpstream = errors.New("no upstream for request")
+
+// Route sends the requests matching its rules to a named upstream.
+type Route struct {
+	Name     string
+	Match    config.UpstreamMatch
+	Upstream Upstream
+}
+
+// matches reports whether a request with the given method and tool name
+// fits the route's rules.
+func (r Route) matches(method, tool string) bool {
+	for _, pattern := range r.Match.Methods {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	if tool == "" {
+		return false
+	}
+	for _, prefix := range r.Match.ToolPrefixes {
+		if strings.HasPrefix(tool, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set fronts several upstream servers, sending each request to the first
+// route that matches its method or tool name and the rest to a default
+// upstream.
+//
+// The initialize handshake goes to every upstream, and the results of
+// tools/list, resources/list and prompts/list are merged. A tool or prompt
+// listed by an upstream its name would not be routed to is listed as
+// "<upstream>.<name>", which routes to that upstream under its own name.
+// Reads of a resource go to the upstream that listed it. Each upstream may
+// have its own circuit breaker, so one that keeps failing doesn't cut off
+// the others.
+type Set struct {
+	def      Upstream
+	routes   []Route
+	breakers map[string]*CircuitBreaker // By upstream name, for those with one enabled
+
+	mu             sync.Mutex
+	resourceOwners map[string]string // Resource URI to the name of the upstream listing it
+}
+
+// listMethods are the list methods whose results a Set merges, with the
+// field holding the items and the method that uses an item by name.
+var listMethods = map[string]struct{ items, use string }{
+	"tools/list":     {"tools", "tools/call"},
+	"resources/list": {"resources", ""},
+	"prompts/list":   {"prompts", "prompts/get"},
+}
+
+// maxListPages bounds the pages fetched from one upstream for a merged list.
+const maxListPages = 100
+
+// NewSet creates a set of routes with a fallback upstream. def may be nil,
+// in which case unmatched requests fail with ErrNoUpstream.
+func NewSet(def Upstream, routes []Route) *Set {
+	return &Set{
+		def:            def,
+		routes:         routes,
+		breakers:       make(map[string]*CircuitBreaker),
+		resourceOwners: make(map[string]string),
+	}
+}
+
+// NewSetFromConfig creates the default upstream, if configured, and one
+// upstream per named entry, each with a circuit breaker if its
+// circuit_breaker is enabled.
+func NewSetFromConfig(def config.UpstreamConfig, named []config.NamedUpstream) (*Set, error) {
+	breakers := make(map[string]*CircuitBreaker)
+
+	var defUpstream Upstream
+	if def.URL != "" || def.Command != "" {
+		u, err := New(def)
+		if err != nil {
+			return nil, err
+		}
+		defUpstream = u
+		if def.CircuitBreaker.Enabled {
+			breakers["default"] = NewCircuitBreaker(def.CircuitBreaker)
+		}
+	}
+
+	routes := make([]Route, 0, len(named))
+	for _, n := range named {
+		u, err := New(n.UpstreamConfig)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s: %w", n.Name, err)
+		}
+		routes = append(routes, Route{Name: n.Name, Match: n.Match, Upstream: u})
+		if n.CircuitBreaker.Enabled {
+			breakers[n.Name] = NewCircuitBreaker(n.CircuitBreaker)
+		}
+	}
+
+	set := NewSet(defUpstream, routes)
+	set.breakers = breakers
+	return set, nil
+}
+
+// CircuitState returns the most severe state of the upstreams' circuit
+// breakers: open if any is open, otherwise half-open if any is. Without
+// breakers it is closed.
+func (s *Set) CircuitState() CircuitState {
+	state := CircuitClosed
+	for _, b := range s.breakers {
+		state = max(state, b.State())
+	}
+	return state
+}
+
+// setRequest is the part of a request a Set routes on.
+type setRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Name string `json:"name"`
+		URI  string `json:"uri"`
+	} `json:"params"`
+}
+
+// Pick returns the name and upstream that should receive the message, and
+// the message to send it, with a namespaced tool or prompt name replaced by
+// the upstream's own. The default upstream is named "default" and may be
+// nil.
+func (s *Set) Pick(message []byte) (string, Upstream, []byte) {
+	var req setRequest
+	if err := json.Unmarshal(message, &req); err != nil {
+		return "default", s.def, message
+	}
+
+	switch req.Method {
+	case "tools/call", "prompts/get":
+		if member, name, ok := strings.Cut(req.Params.Name, "."); ok {
+			if u := s.member(member); u != nil {
+				if rewritten, err := setParam(message, "name", name); err == nil {
+					return member, u, rewritten
+				}
+			}
+		}
+	case "resources/read", "resources/subscribe", "resources/unsubscribe":
+		s.mu.Lock()
+		owner, ok := s.resourceOwners[req.Params.URI]
+		s.mu.Unlock()
+		if ok {
+			return owner, s.member(owner), message
+		}
+	}
+
+	name, u := s.pickByRules(req.Method, req.Params.Name)
+	return name, u, message
+}
+
+// pickByRules returns the first route matching a request for method, with
+// name as the tool name of a tools/call, or the default upstream.
+func (s *Set) pickByRules(method, name string) (string, Upstream) {
+	tool := ""
+	if method == "tools/call" {
+		tool = name
+	}
+	for _, r := range s.routes {
+		if r.matches(method, tool) {
+			return r.Name, r.Upstream
+		}
+	}
+	return "default", s.def
+}
+
+// member returns the upstream with the given name, or nil.
+func (s *Set) member(name string) Upstream {
+	if name == "default" {
+		return s.def
+	}
+	for _, r := range s.routes {
+		if r.Name == name {
+			return r.Upstream
+		}
+	}
+	return nil
+}
+
+// SetNotificationHandler sets the handler on every upstream that supports
+// server-initiated notifications.
+func (s *Set) SetNotificationHandler(h NotificationHandler) {
+	for _, u := range s.all() {
+		if n, ok := u.(Notifier); ok {
+			n.SetNotificationHandler(h)
+		}
+	}
+}
+
+// SetOnResponseDropped sets the callback on every upstream that drops
+// responses.
+func (s *Set) SetOnResponseDropped(fn func()) {
+	for _, u := range s.all() {
+		if r, ok := u.(DropReporter); ok {
+			r.SetOnResponseDropped(fn)
+		}
+	}
+}
+
+// Connect connects every upstream, returning the errors of those that
+// failed. Upstreams that connected stay connected.
+func (s *Set) Connect(ctx context.Context) error {
+	var errs []error
+	for name, u := range s.named() {
+		if err := u.Connect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("upstream %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Send sends the message to the upstream picked for it. initialize goes to
+// every upstream and list methods are merged; the default upstream, or the
+// first route without one, answers initialize for the set.
+func (s *Set) Send(ctx context.Context, message []byte) ([]byte, error) {
+	var req setRequest
+	if err := json.Unmarshal(message, &req); err == nil {
+		if req.Method == "initialize" {
+			return s.broadcast(ctx, message)
+		}
+		if list, ok := listMethods[req.Method]; ok {
+			return s.mergeList(ctx, req, list.items, list.use)
+		}
+	}
+
+	name, u, message := s.Pick(message)
+	if u == nil {
+		return nil, ErrNoUpstream
+	}
+	if !u.IsConnected() {
+		return nil, fmt.Errorf("upstream %s not connected", name)
+	}
+	return s.breakers[name].Send(ctx, u, message)
+}
+
+// SendAsync forwards a notification to the upstream picked for it without
+// waiting for a response. notifications/initialized goes to every upstream,
+// as does notifications/cancelled, which only the upstream with the
+// cancelled request pending forwards.
+func (s *Set) SendAsync(ctx context.Context, message []byte) error {
+	var req setRequest
+	if err := json.Unmarshal(message, &req); err == nil && (req.Method == "notifications/initialized" || req.Method == methodCancelled) {
+		var errs []error
+		for name, u := range s.named() {
+			if err := SendNotification(ctx, u, message); err != nil {
+				errs = append(errs, fmt.Errorf("upstream %s: %w", name, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	name, u, message := s.Pick(message)
+	if u == nil {
+		return ErrNoUpstream
+	}
+	if !u.IsConnected() {
+		return fmt.Errorf("upstream %s not connected", name)
+	}
+	return SendNotification(ctx, u, message)
+}
+
+// broadcast sends the message to every upstream, returning the response of
+// the first one. Failures of the others are logged: their requests fail
+// until they are initialized.
+func (s *Set) broadcast(ctx context.Context, message []byte) ([]byte, error) {
+	var (
+		resp     []byte
+		firstErr error
+	)
+	for i, u := range s.all() {
+		name := s.nameOf(i)
+		r, err := s.breakers[name].Send(ctx, u, message)
+		if err == nil {
+			err = rpcError(r)
+		}
+		if i == 0 {
+			resp, firstErr = r, err
+			continue
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("upstream", name).Msg("Failed to initialize upstream")
+		}
+	}
+	if resp == nil {
+		return nil, firstErr
+	}
+	return resp, nil
+}
+
+// mergeList answers a list request with the items of every upstream that
+// answers it, fetching all their pages. Items whose name would not route
+// back to their upstream through use are namespaced.
+func (s *Set) mergeList(ctx context.Context, req setRequest, field, use string) ([]byte, error) {
+	var (
+		items    []json.RawMessage
+		owners   = make(map[string]string)
+		answered bool
+		firstErr error
+	)
+	for i, u := range s.all() {
+		name := s.nameOf(i)
+		listed, err := listAll(ctx, u, s.breakers[name], req, field)
+		if err != nil {
+			log.Warn().Err(err).Str("upstream", name).Str("method", req.Method).Msg("Failed to list upstream items")
+			if firstErr == nil {
+				firstErr = fmt.Errorf("upstream %s: %w", name, err)
+			}
+			continue
+		}
+		answered = true
+
+		for _, item := range listed {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(item, &fields); err != nil {
+				continue
+			}
+			if use == "" {
+				var uri string
+				if err := json.Unmarshal(fields["uri"], &uri); err == nil {
+					if _, taken := owners[uri]; !taken {
+						owners[uri] = name
+					}
+				}
+				items = append(items, item)
+				continue
+			}
+
+			var itemName string
+			if err := json.Unmarshal(fields["name"], &itemName); err != nil {
+				continue
+			}
+			if routed, _ := s.pickByRules(use, itemName); routed != name {
+				fields["name"], _ = json.Marshal(name + "." + itemName)
+				item, _ = json.Marshal(fields)
+			}
+			items = append(items, item)
+		}
+	}
+	if !answered {
+		return nil, firstErr
+	}
+
+	if use == "" {
+		s.mu.Lock()
+		s.resourceOwners = owners
+		s.mu.Unlock()
+	}
+
+	if items == nil {
+		items = []json.RawMessage{}
+	}
+	result, err := json.Marshal(map[string]interface{}{field: items})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.ID,
+		"result":  json.RawMessage(result),
+	})
+}
+
+// listAll requests every page of a list method from u, through its breaker
+// b if it has one, and returns the items in field.
+func listAll(ctx context.Context, u Upstream, b *CircuitBreaker, req setRequest, field string) ([]json.RawMessage, error) {
+	if !u.IsConnected() {
+		return nil, errors.New("not connected")
+	}
+
+	var (
+		items  []json.RawMessage
+		cursor string
+	)
+	for page := 0; page < maxListPages; page++ {
+		params := map[string]string{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		message, err := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"method":  req.Method,
+			"params":  params,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp, err := b.Send(ctx, u, message)
+		if err != nil {
+			return nil, err
+		}
+
+		var parsed struct {
+			Result map[string]json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(resp, &parsed); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		if parsed.Error != nil {
+			return nil, errors.New(parsed.Error.Message)
+		}
+		var pageItems []json.RawMessage
+		if raw, ok := parsed.Result[field]; ok {
+			if err := json.Unmarshal(raw, &pageItems); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", field, err)
+			}
+		}
+		items = append(items, pageItems...)
+
+		cursor = ""
+		if raw, ok := parsed.Result["nextCursor"]; ok {
+			_ = json.Unmarshal(raw, &cursor)
+		}
+		if cursor == "" {
+			return items, nil
+		}
+	}
+	return items, nil
+}
+
+// setParam returns message with params[key] set to value.
+func setParam(message []byte, key, value string) ([]byte, error) {
+	var parsed map[string]json.RawMessage
+	if err := json.Unmarshal(message, &parsed); err != nil {
+		return nil, err
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(parsed["params"], &params); err != nil {
+		return nil, err
+	}
+	params[key], _ = json.Marshal(value)
+	var err error
+	if parsed["params"], err = json.Marshal(params); err != nil {
+		return nil, err
+	}
+	return json.Marshal(parsed)
+}
+
+// Disconnect closes every upstream.
+func (s *Set) Disconnect() {
+	for _, u := range s.all() {
+		u.Disconnect()
+	}
+}
+
+// IsConnected returns true if every upstream is connected.
+func (s *Set) IsConnected() bool {
+	for _, u := range s.all() {
+		if !u.IsConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+// all returns the default upstream, if any, followed by the routed ones.
+func (s *Set) all() []Upstream {
+	all := make([]Upstream, 0, len(s.routes)+1)
+	if s.def != nil {
+		all = append(all, s.def)
+	}
+	for _, r := range s.routes {
+		all = append(all, r.Upstream)
+	}
+	return all
+}
+
+// nameOf returns the name of the i-th upstream returned by all.
+func (s *Set) nameOf(i int) string {
+	if s.def != nil {
+		if i == 0 {
+			return "default"
+		}
+		i--
+	}
+	return s.routes[i].Name
+}
+
+// named returns every upstream keyed by name.
+func (s *Set) named() map[string]Upstream {
+	named := make(map[string]Upstream, len(s.routes)+1)
+	if s.def != nil {
+		named["default"] = s.def
+	}
+	for _, r := range s.routes {
+		named[r.Name] = r.Upstream
+	}
+	return named
+}
@@ -0,0 +1,289 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// namedUpstream is an in-memory upstream that answers with its name, or
+// fails with err if set.
+type namedUpstream struct {
+	name      string
+	connected bool
+	err       error
+}
+
+func (n *namedUpstream) Connect(ctx context.Context) error { n.connected = true; return nil }
+func (n *namedUpstream) Disconnect()                       { n.connected = false }
+func (n *namedUpstream) IsConnected() bool                 { return n.connected }
+
+func (n *namedUpstream) Send(ctx context.Context, message []byte) ([]byte, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	return []byte(n.name), nil
+}
+
+// TestSetRouting tests that requests go to the first upstream matching their
+// method or tool name, and to the default upstream otherwise.
+func TestSetRouting(t *testing.T) {
+	set := NewSet(&namedUpstream{name: "default"}, []Route{
+		{
+			Name:     "search",
+			Match:    config.UpstreamMatch{ToolPrefixes: []string{"search_"}},
+			Upstream: &namedUpstream{name: "search"},
+		},
+		{
+			Name:     "files",
+			Match:    config.UpstreamMatch{Methods: []string{"resources/*"}, ToolPrefixes: []string{"read_"}},
+			Upstream: &namedUpstream{name: "files"},
+		},
+	})
+	if err := set.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"search tool", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search_web"}}`, "search"},
+		{"file tool", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"read_file"}}`, "files"},
+		{"resource method", `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"file:///a"}}`, "files"},
+		{"unmatched tool", `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run_query"}}`, "default"},
+		{"prompt named like a tool", `{"jsonrpc":"2.0","id":1,"method":"prompts/get","params":{"name":"search_help"}}`, "default"},
+		{"unmatched method", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, "default"},
+		{"invalid JSON", `{`, "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := set.Send(context.Background(), []byte(tt.message))
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if got := string(resp); got != tt.want {
+				t.Errorf("Send() went to %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if !set.IsConnected() {
+		t.Error("IsConnected() = false, want true")
+	}
+	set.Disconnect()
+	if set.IsConnected() {
+		t.Error("IsConnected() after Disconnect() = true, want false")
+	}
+}
+
+// TestSetWithoutDefault tests that unmatched requests fail when there is no
+// default upstream.
+func TestSetWithoutDefault(t *testing.T) {
+	set := NewSet(nil, []Route{{
+		Name:     "search",
+		Match:    config.UpstreamMatch{ToolPrefixes: []string{"search_"}},
+		Upstream: &namedUpstream{name: "search"},
+	}})
+
+	_, err := set.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if !errors.Is(err, ErrNoUpstream) {
+		t.Errorf("Send() error = %v, want ErrNoUpstream", err)
+	}
+}
+
+// TestSetCircuitBreakers tests that an upstream whose circuit opens fails
+// fast without cutting off the others, and that the set reports the open
+// circuit.
+func TestSetCircuitBreakers(t *testing.T) {
+	set := NewSet(&namedUpstream{name: "default"}, []Route{{
+		Name:     "search",
+		Match:    config.UpstreamMatch{ToolPrefixes: []string{"search_"}},
+		Upstream: &namedUpstream{name: "search", err: errors.New("connection refused")},
+	}})
+	cfg := config.CircuitBreakerConfig{Enabled: true, Threshold: 1, Timeout: time.Hour}
+	set.breakers["default"] = NewCircuitBreaker(cfg)
+	set.breakers["search"] = NewCircuitBreaker(cfg)
+	if err := set.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if got := set.CircuitState(); got != CircuitClosed {
+		t.Errorf("CircuitState() = %s, want closed", got)
+	}
+
+	search := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search_web"}}`)
+	if _, err := set.Send(context.Background(), search); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Send() error = %v, want the upstream's error", err)
+	}
+	if _, err := set.Send(context.Background(), search); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Send() after the failure error = %v, want ErrCircuitOpen", err)
+	}
+	if got := set.CircuitState(); got != CircuitOpen {
+		t.Errorf("CircuitState() = %s, want open", got)
+	}
+
+	resp, err := set.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+	if err != nil || string(resp) != "default" {
+		t.Errorf("Send() to the default upstream = %s, %v, want its answer", resp, err)
+	}
+}
+
+// listingUpstream is an in-memory MCP server that lists the given tools,
+// one per page, and resources, and records the requests it receives.
+type listingUpstream struct {
+	name      string
+	tools     []string
+	resources []string
+
+	mu       sync.Mutex
+	received []string
+}
+
+func (l *listingUpstream) Connect(ctx context.Context) error { return nil }
+func (l *listingUpstream) Disconnect()                       {}
+func (l *listingUpstream) IsConnected() bool                 { return true }
+
+func (l *listingUpstream) Send(ctx context.Context, message []byte) ([]byte, error) {
+	var req struct {
+		Method string `json:"method"`
+		Params struct {
+			Name   string `json:"name"`
+			Cursor string `json:"cursor"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(message, &req); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	l.received = append(l.received, strings.TrimSpace(req.Method+" "+req.Params.Name))
+	l.mu.Unlock()
+
+	var result interface{}
+	switch req.Method {
+	case "tools/list":
+		page := 0
+		fmt.Sscan(req.Params.Cursor, &page)
+		tools := map[string]interface{}{"tools": []interface{}{}}
+		if page < len(l.tools) {
+			tools["tools"] = []interface{}{map[string]string{"name": l.tools[page], "description": l.name}}
+			if page+1 < len(l.tools) {
+				tools["nextCursor"] = fmt.Sprint(page + 1)
+			}
+		}
+		result = tools
+	case "resources/list":
+		resources := []interface{}{}
+		for _, uri := range l.resources {
+			resources = append(resources, map[string]string{"uri": uri})
+		}
+		result = map[string]interface{}{"resources": resources}
+	default:
+		result = map[string]string{"upstream": l.name}
+	}
+	return json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+}
+
+func (l *listingUpstream) requests() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.received)
+}
+
+// TestSetHandshakeAndLists tests that initialize reaches every upstream,
+// that list results are merged with names namespaced where they would not
+// route back to their upstream, and that namespaced names and listed
+// resources route to the upstream that listed them.
+func TestSetHandshakeAndLists(t *testing.T) {
+	def := &listingUpstream{name: "default", tools: []string{"run_query", "search_web"}, resources: []string{"mem://notes"}}
+	search := &listingUpstream{name: "search", tools: []string{"search_web", "status"}}
+	files := &listingUpstream{name: "files", resources: []string{"file:///a"}}
+	set := NewSet(def, []Route{
+		{Name: "search", Match: config.UpstreamMatch{ToolPrefixes: []string{"search_"}}, Upstream: search},
+		{Name: "files", Match: config.UpstreamMatch{Methods: []string{"resources/*"}}, Upstream: files},
+	})
+	ctx := context.Background()
+
+	send := func(message string) string {
+		t.Helper()
+		resp, err := set.Send(ctx, []byte(message))
+		if err != nil {
+			t.Fatalf("Send(%s) error = %v", message, err)
+		}
+		var parsed struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(resp, &parsed); err != nil {
+			t.Fatalf("Send(%s) response %s: %v", message, resp, err)
+		}
+		return string(parsed.Result)
+	}
+
+	if got := send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`); got != `{"upstream":"default"}` {
+		t.Errorf("initialize answered with %s, want the default upstream's result", got)
+	}
+	if err := set.SendAsync(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		t.Fatalf("SendAsync() error = %v", err)
+	}
+	for _, u := range []*listingUpstream{def, search, files} {
+		if got := u.requests(); !slices.Equal(got, []string{"initialize", "notifications/initialized"}) {
+			t.Errorf("%s received %v, want the handshake", u.name, got)
+		}
+	}
+
+	var tools struct {
+		Tools []struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal([]byte(send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)), &tools); err != nil {
+		t.Fatalf("tools/list result: %v", err)
+	}
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name+"@"+tool.Description)
+	}
+	wantNames := []string{"run_query@default", "default.search_web@default", "search_web@search", "search.status@search"}
+	if !slices.Equal(names, wantNames) {
+		t.Errorf("tools/list = %v, want %v", names, wantNames)
+	}
+
+	calls := []struct {
+		name, upstream, sent string
+	}{
+		{"search_web", "search", "tools/call search_web"},
+		{"search.status", "search", "tools/call status"},
+		{"default.search_web", "default", "tools/call search_web"},
+		{"run_query", "default", "tools/call run_query"},
+	}
+	for _, c := range calls {
+		got := send(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"` + c.name + `"}}`)
+		if want := `{"upstream":"` + c.upstream + `"}`; got != want {
+			t.Errorf("tools/call %s went to %s, want %s", c.name, got, want)
+		}
+		u := map[string]*listingUpstream{"default": def, "search": search}[c.upstream]
+		if requests := u.requests(); requests[len(requests)-1] != c.sent {
+			t.Errorf("%s received %q, want %q", c.upstream, requests[len(requests)-1], c.sent)
+		}
+	}
+
+	if got := send(`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`); got != `{"resources":[{"uri":"mem://notes"},{"uri":"file:///a"}]}` {
+		t.Errorf("resources/list = %s", got)
+	}
+	for uri, want := range map[string]string{"mem://notes": "default", "file:///a": "files", "file:///unlisted": "files"} {
+		got := send(`{"jsonrpc":"2.0","id":5,"method":"resources/read","params":{"uri":"` + uri + `"}}`)
+		if got != `{"upstream":"`+want+`"}` {
+			t.Errorf("resources/read %s went to %s, want %s", uri, got, want)
+		}
+	}
+}
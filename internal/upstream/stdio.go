@@ -0,0 +1,306 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+	"github.com/agentfacts/mcp-proxy/internal/transport/stdio"
+	"github.com/rs/zerolog/log"
+)
+
+// StdioClient manages an upstream MCP server running as a subprocess.
+// Messages are exchanged as newline-delimited JSON over the process's
+// stdin and stdout.
+type StdioClient struct {
+	cfg config.UpstreamConfig
+
+	// Process state
+	mu        sync.RWMutex
+	connected bool
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	writer    *stdio.Writer
+
+	// Pending requests waiting for responses
+	pending   map[interface{}]chan *Response
+	pendingMu sync.RWMutex
+
+	// Response buffering per pending request; responses that don't fit are
+	// dropped and reported to onDropped
+	responseBuffer int
+	onDropped      func()
+
+	// Server-initiated notifications
+	onNotification NotificationHandler
+
+	// Session setup sent through the client, replayed when it restarts
+	hs handshake
+
+	// Lifecycle
+	cancel context.CancelFunc
+}
+
+// NewStdioClient creates a new stdio upstream client.
+func NewStdioClient(cfg config.UpstreamConfig) *StdioClient {
+	c := &StdioClient{
+		cfg:     cfg,
+		pending: make(map[interface{}]chan *Response),
+	}
+	c.responseBuffer = responseBuffering(cfg.ResponseBuffer)
+	return c
+}
+
+// SetNotificationHandler sets the handler for notifications the subprocess
+// writes to stdout.
+func (c *StdioClient) SetNotificationHandler(h NotificationHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onNotification = h
+}
+
+// SetOnResponseDropped sets a callback invoked for each response dropped
+// because its request's buffer was full. Call it before Connect.
+func (c *StdioClient) SetOnResponseDropped(fn func()) {
+	c.onDropped = fn
+}
+
+// Connect starts the upstream subprocess. A restarted subprocess is sent
+// the handshake and subscriptions the earlier one received.
+func (c *StdioClient) Connect(ctx context.Context) error {
+	started, err := c.start(ctx)
+	if err != nil || !started {
+		return err
+	}
+	return c.hs.replay(ctx, c)
+}
+
+// start starts the subprocess unless it is running, reporting whether it
+// did.
+func (c *StdioClient) start(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connected {
+		return false, nil
+	}
+
+	if c.cfg.Command == "" {
+		return false, fmt.Errorf("no upstream command configured")
+	}
+
+	procCtx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(procCtx, c.cfg.Command, c.cfg.Args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return false, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return false, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	log.Info().Str("command", c.cfg.Command).Msg("Starting upstream MCP server")
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return false, fmt.Errorf("failed to start upstream: %w", err)
+	}
+
+	c.cmd = cmd
+	c.stdin = stdin
+	c.writer = stdio.NewWriter(stdin)
+	c.cancel = cancel
+	c.connected = true
+
+	// Start reading responses
+	go c.readMessages(stdio.NewReader(stdout))
+
+	log.Info().
+		Str("command", c.cfg.Command).
+		Int("pid", cmd.Process.Pid).
+		Msg("Connected to upstream MCP server")
+
+	return true, nil
+}
+
+// Disconnect stops the upstream subprocess.
+func (c *StdioClient) Disconnect() {
+	c.mu.Lock()
+	cmd := c.cmd
+	if cmd == nil {
+		c.mu.Unlock()
+		return
+	}
+
+	c.connected = false
+	c.cmd = nil
+
+	// Closing stdin lets well-behaved servers exit; cancel kills the rest
+	c.stdin.Close()
+	c.cancel()
+	c.mu.Unlock()
+
+	_ = cmd.Wait()
+
+	log.Info().Msg("Disconnected from upstream MCP server")
+}
+
+// Send writes a message to the subprocess and waits for its response.
+func (c *StdioClient) Send(ctx context.Context, message []byte) ([]byte, error) {
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return nil, fmt.Errorf("not connected to upstream")
+	}
+	writer := c.writer
+	c.mu.RUnlock()
+
+	// Extract request ID for response matching
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(message, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON message: %w", err)
+	}
+	requestID := parsed["id"]
+
+	// Create response channel for this request
+	respChan := make(chan *Response, c.responseBuffer)
+	c.pendingMu.Lock()
+	c.pending[requestID] = respChan
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, requestID)
+		c.pendingMu.Unlock()
+	}()
+
+	if err := writer.Write(message); err != nil {
+		return nil, fmt.Errorf("failed to send to upstream: %w", err)
+	}
+
+	// Wait for response on stdout
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case response := <-respChan:
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		c.hs.record(message, response.Data)
+		return response.Data, nil
+	case <-time.After(c.cfg.Timeout):
+		return nil, fmt.Errorf("timeout waiting for upstream response")
+	}
+}
+
+// SendAsync writes a message to the subprocess without waiting for a
+// response.
+func (c *StdioClient) SendAsync(ctx context.Context, message []byte) error {
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return fmt.Errorf("not connected to upstream")
+	}
+	writer := c.writer
+	c.mu.RUnlock()
+
+	if err := writer.Write(message); err != nil {
+		return fmt.Errorf("failed to send to upstream: %w", err)
+	}
+	c.hs.record(message, nil)
+	return nil
+}
+
+// readMessages reads responses from the subprocess stdout.
+func (c *StdioClient) readMessages(reader *stdio.Reader) {
+	for {
+		data, err := reader.ReadMessage()
+		if err != nil {
+			if err != io.EOF {
+				log.Error().Err(err).Msg("Error reading from upstream stdout")
+			}
+			c.handleDisconnect()
+			return
+		}
+
+		var parsed map[string]interface{}
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			log.Warn().Err(err).Msg("Failed to parse upstream message")
+			continue
+		}
+
+		if isNotification(parsed) {
+			c.mu.RLock()
+			onNotification := c.onNotification
+			c.mu.RUnlock()
+			if onNotification != nil {
+				onNotification(data)
+			} else {
+				log.Debug().Interface("method", parsed["method"]).Msg("Received upstream notification")
+			}
+			continue
+		}
+
+		requestID, ok := parsed["id"]
+		if !ok {
+			continue
+		}
+
+		c.pendingMu.RLock()
+		respChan, ok := c.pending[requestID]
+		c.pendingMu.RUnlock()
+
+		if ok {
+			if !deliverResponse(respChan, &Response{Data: data}) {
+				log.Warn().Interface("id", requestID).Msg("Response channel full, response dropped")
+				if c.onDropped != nil {
+					c.onDropped()
+				}
+			}
+		} else {
+			log.Debug().Interface("id", requestID).Msg("Received response for unknown request")
+		}
+	}
+}
+
+// handleDisconnect handles the subprocess closing its stdout.
+func (c *StdioClient) handleDisconnect() {
+	c.mu.Lock()
+	wasConnected := c.connected
+	c.connected = false
+	c.mu.Unlock()
+
+	if wasConnected {
+		log.Warn().Msg("Upstream process exited")
+
+		// Fail all pending requests
+		c.pendingMu.Lock()
+		for id, ch := range c.pending {
+			select {
+			case ch <- &Response{Error: fmt.Errorf("upstream disconnected")}:
+			default:
+			}
+			delete(c.pending, id)
+		}
+		c.pendingMu.Unlock()
+	}
+}
+
+// IsConnected returns true if the upstream process is running.
+func (c *StdioClient) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connected
+}
@@ -0,0 +1,95 @@
+package upstream
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// TestStdioClientSend tests request/response matching over a subprocess.
+func TestStdioClientSend(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat not available")
+	}
+
+	// cat echoes each request back, which matches on the same id
+	client := NewStdioClient(config.UpstreamConfig{
+		Transport: "stdio",
+		Command:   "cat",
+		Timeout:   5 * time.Second,
+	})
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Disconnect()
+
+	if !client.IsConnected() {
+		t.Fatal("expected client to be connected")
+	}
+
+	tests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":"abc","method":"resources/list"}`,
+	}
+
+	for _, msg := range tests {
+		resp, err := client.Send(context.Background(), []byte(msg))
+		if err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		if string(resp) != msg {
+			t.Errorf("expected %s, got %s", msg, resp)
+		}
+	}
+}
+
+// TestStdioClientDisconnect tests that Send fails once the process is stopped.
+func TestStdioClientDisconnect(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat not available")
+	}
+
+	client := NewStdioClient(config.UpstreamConfig{
+		Command: "cat",
+		Timeout: time.Second,
+	})
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	client.Disconnect()
+
+	if client.IsConnected() {
+		t.Error("expected client to be disconnected")
+	}
+	if _, err := client.Send(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)); err == nil {
+		t.Error("expected error after disconnect")
+	}
+}
+
+// TestNew tests upstream transport selection.
+func TestNew(t *testing.T) {
+	tests := []struct {
+		transport string
+		wantErr   bool
+	}{
+		{"", false},
+		{"sse", false},
+		{"http", false},
+		{"stdio", false},
+		{"websocket", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			_, err := New(config.UpstreamConfig{Transport: tt.transport})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New(%q) error = %v, wantErr %v", tt.transport, err, tt.wantErr)
+			}
+		})
+	}
+}
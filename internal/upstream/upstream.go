@@ -0,0 +1,117 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/agentfacts/mcp-proxy/internal/config"
+)
+
+// DefaultResponseBuffer is the per-request response buffer used when
+// UpstreamConfig.ResponseBuffer is unset.
+const DefaultResponseBuffer = 1
+
+// Upstream is a connection to an upstream MCP server.
+type Upstream interface {
+	// Connect establishes the connection to the upstream server.
+	Connect(ctx context.Context) error
+
+	// Send sends a message and waits for the matching response.
+	Send(ctx context.Context, message []byte) ([]byte, error)
+
+	// Disconnect closes the connection.
+	Disconnect()
+
+	// IsConnected returns true if the upstream is reachable.
+	IsConnected() bool
+}
+
+// NotificationHandler receives notifications the upstream server sends on
+// its own, such as notifications/resources/updated after a subscribe.
+type NotificationHandler func(message []byte)
+
+// Notifier is implemented by upstreams whose transport lets the server push
+// messages to the proxy.
+type Notifier interface {
+	// SetNotificationHandler sets the handler for server-initiated
+	// notifications. Call it before Connect.
+	SetNotificationHandler(h NotificationHandler)
+}
+
+// DropReporter is implemented by upstreams that drop responses arriving
+// while the request's buffer is full, rather than stall their read loop.
+type DropReporter interface {
+	// SetOnResponseDropped sets a callback invoked for each dropped
+	// response. Call it before Connect.
+	SetOnResponseDropped(fn func())
+}
+
+// AsyncSender is implemented by upstreams that can deliver a message
+// without waiting for a response, as JSON-RPC notifications require.
+type AsyncSender interface {
+	SendAsync(ctx context.Context, message []byte) error
+}
+
+// SendNotification delivers a notification to u, without waiting for a
+// response if u is an AsyncSender.
+func SendNotification(ctx context.Context, u Upstream, message []byte) error {
+	if a, ok := u.(AsyncSender); ok {
+		return a.SendAsync(ctx, message)
+	}
+	_, err := u.Send(ctx, message)
+	return err
+}
+
+// isNotification reports whether a parsed JSON-RPC message is a
+// notification: it has a method but no ID.
+func isNotification(parsed map[string]interface{}) bool {
+	_, hasID := parsed["id"]
+	_, hasMethod := parsed["method"]
+	return hasMethod && !hasID
+}
+
+// responseBuffering returns the per-request response buffer size
+// configured in rb, or the default.
+func responseBuffering(rb config.ResponseBufferConfig) int {
+	if rb.PerRequest <= 0 {
+		return DefaultResponseBuffer
+	}
+	return rb.PerRequest
+}
+
+// deliverResponse sends resp on ch if it has room, and reports whether it
+// did. It never waits: the caller is the connection's only read loop, which
+// would hold up every other request's response meanwhile.
+func deliverResponse(ch chan *Response, resp *Response) bool {
+	select {
+	case ch <- resp:
+		return true
+	default:
+		return false
+	}
+}
+
+// New creates an upstream connection for the configured transport, pooled
+// per downstream session if configured.
+func New(cfg config.UpstreamConfig) (Upstream, error) {
+	if cfg.ConnectionPool.PerSession {
+		return NewPool(cfg.ConnectionPool, func() (Upstream, error) {
+			return newConnection(cfg)
+		})
+	}
+	return newConnection(cfg)
+}
+
+// newConnection creates a single connection for the configured transport.
+func newConnection(cfg config.UpstreamConfig) (Upstream, error) {
+	switch cfg.Transport {
+	case "", "sse":
+		return NewClient(cfg), nil
+	case "http":
+		return NewHTTPClient(cfg), nil
+	case "stdio":
+		return NewStdioClient(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported upstream transport: %s", cfg.Transport)
+	}
+}
@@ -1,5 +1,5 @@
 # MCP Proxy - Blocklist Policy
-# Blocks specific agents, tools, and DIDs
+# Blocks specific agents, tools, resources, and DIDs
 
 package mcp.policy
 
@@ -13,6 +13,17 @@ blocked if {
     input.request.tool in data.blocked_tools
 }
 
+# Block if resource URI matches a blocked pattern
+blocked if {
+    resource_blocked
+}
+
+resource_blocked if {
+    input.request.resource_uri != ""
+    some pattern in data.blocked_resources
+    glob.match(pattern, ["/"], input.request.resource_uri)
+}
+
 # Block if agent ID is in blocklist
 blocked if {
     input.agent.id in data.blocked_agents
@@ -25,20 +36,42 @@ blocked if {
 }
 
 # Violation message for blocked tool
-violations[msg] if {
+violations contains violation if {
     input.request.tool in data.blocked_tools
-    msg := sprintf("Tool '%s' is blocked by policy", [input.request.tool])
+    violation := {
+        "category": "blocklist",
+        "message": sprintf("Tool '%s' is blocked by policy", [input.request.tool]),
+        "detail": input.request.tool,
+    }
+}
+
+# Violation message for blocked resource
+violations contains violation if {
+    resource_blocked
+    violation := {
+        "category": "blocklist",
+        "message": sprintf("Resource '%s' is blocked by policy", [input.request.resource_uri]),
+        "detail": input.request.resource_uri,
+    }
 }
 
 # Violation message for blocked agent
-violations[msg] if {
+violations contains violation if {
     input.agent.id in data.blocked_agents
-    msg := sprintf("Agent '%s' is blocked by policy", [input.agent.id])
+    violation := {
+        "category": "blocklist",
+        "message": sprintf("Agent '%s' is blocked by policy", [input.agent.id]),
+        "detail": input.agent.id,
+    }
 }
 
 # Violation message for blocked DID
-violations[msg] if {
+violations contains violation if {
     input.identity.verified
     input.identity.did in data.blocked_dids
-    msg := sprintf("DID '%s' is blocked by policy", [input.identity.did])
+    violation := {
+        "category": "blocklist",
+        "message": sprintf("DID '%s' is blocked by policy", [input.identity.did]),
+        "detail": input.identity.did,
+    }
 }
@@ -43,9 +43,13 @@ capability_matches(granted, _) if {
 }
 
 # Collect capability violations
-violations[msg] if {
+violations contains violation if {
     required := required_capability(input.request.tool)
     not capability_check
-    msg := sprintf("Agent '%s' lacks capability '%s' required for tool '%s'",
-        [input.agent.id, required, input.request.tool])
+    violation := {
+        "category": "capability",
+        "message": sprintf("Agent '%s' lacks capability '%s' required for tool '%s'",
+            [input.agent.id, required, input.request.tool]),
+        "detail": required,
+    }
 }
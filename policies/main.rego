@@ -13,6 +13,7 @@ decision := {
     "allow": allow,
     "violations": violations,
     "matched_rule": matched_rule,
+    "fired_rules": fired_rules,
 }
 
 # Allow if all checks pass
@@ -33,3 +34,17 @@ matched_rule := "blocked" if {
 } else := "allowed" if {
     allow
 } else := "default_deny"
+
+# Every check that failed, for per-rule metrics. Unlike matched_rule this
+# reports all of them, not just the first.
+fired_rules contains "blocked" if {
+    blocked
+}
+
+fired_rules contains "rate_limit_exceeded" if {
+    not rate_limit_ok
+}
+
+fired_rules contains "missing_capability" if {
+    not capability_check
+}
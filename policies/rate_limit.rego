@@ -37,10 +37,14 @@ rate_limit_ok := false if {
     input.session.request_count >= limit
 }
 
-# Add violation message when rate limit exceeded
-violations[msg] if {
+# Add a violation when the rate limit is exceeded
+violations contains violation if {
     not rate_limit_ok
     limit := get_rate_limit(input.agent.id)
-    msg := sprintf("Agent '%s' exceeded rate limit (%d/%d requests in session)",
-        [input.agent.id, input.session.request_count, limit])
+    violation := {
+        "category": "rate_limit",
+        "message": sprintf("Agent '%s' exceeded rate limit (%d/%d requests in session)",
+            [input.agent.id, input.session.request_count, limit]),
+        "detail": sprintf("%d/%d", [input.session.request_count, limit]),
+    }
 }